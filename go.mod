@@ -1,7 +1,9 @@
-module go-docker-proxy
+module github.com/DeyiXu/go-docker-proxy
 
-go 1.23
+go 1.23.0
 
 require github.com/go-chi/chi/v5 v5.0.12
 
 require github.com/hashicorp/golang-lru/v2 v2.0.7
+
+require golang.org/x/crypto v0.36.0
@@ -0,0 +1,48 @@
+package cache
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// =============================================================================
+// 访问时间 - 命中缓存时更新缓存文件的修改时间，重启后仍可得知条目最近一次被访问的时间；
+// 同一文件在 accessResolution 内只更新一次，避免每次命中都写磁盘
+// =============================================================================
+
+// accessResolution 访问时间的精度
+const accessResolution = time.Minute
+
+// accessTracker 记录最近更新过修改时间的文件
+type accessTracker struct {
+	mu      sync.Mutex
+	touched map[string]time.Time // 文件路径 -> 最近一次更新时间
+}
+
+// touch 把文件修改时间更新为当前时间
+func (a *accessTracker) touch(path string) {
+	now := time.Now()
+	a.mu.Lock()
+	if a.touched == nil {
+		a.touched = make(map[string]time.Time)
+	}
+	if last, ok := a.touched[path]; ok && now.Sub(last) < accessResolution {
+		a.mu.Unlock()
+		return
+	}
+	a.touched[path] = now
+	a.mu.Unlock()
+	os.Chtimes(path, now, now)
+}
+
+// prune 释放超过精度时间的记录
+func (a *accessTracker) prune() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for path, last := range a.touched {
+		if time.Since(last) >= accessResolution {
+			delete(a.touched, path)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+)
+
+// =============================================================================
+// 元数据压缩 - manifest 与 .meta 文件可选 gzip 压缩，读取时按文件头透明解压，
+// 压缩与未压缩的文件可以混用，切换设置无需清空缓存
+// =============================================================================
+
+// gzipMagic gzip 文件头；未压缩的元数据是 JSON，总是以 { 开头
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// ReadMetadataFile 读取 manifest 或 .meta 文件，gzip 压缩的内容透明解压
+func ReadMetadataFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return decodeMetadata(data)
+}
+
+// decodeMetadata 解压 gzip 内容，未压缩的内容原样返回
+func decodeMetadata(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, gzipMagic) {
+		return data, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// encodeMetadata 按设置压缩写入磁盘的元数据
+func encodeMetadata(data []byte, compress bool) []byte {
+	if !compress {
+		return data
+	}
+	var buf bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&buf, gzip.BestSpeed)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
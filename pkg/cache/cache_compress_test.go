@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestCompressMetadata(t *testing.T) {
+	dir := t.TempDir()
+	open := func(compress bool) *CacheManager {
+		config := DefaultCacheConfig()
+		config.Dir = dir
+		config.CompressMeta = compress
+		cm, err := NewCacheManager(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cm
+	}
+	ctx := context.Background()
+	manifest := []byte(`{"schemaVersion":2,"layers":[]}`)
+	layer := bytes.Repeat([]byte("layer"), 100)
+	sum := sha256.Sum256(layer)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	blobKey := CacheKey("registry.test", "/v2/team/app/blobs/"+digest)
+
+	// 启用压缩：manifest 与 .meta 以 gzip 写入，blob 内容原样保存
+	cm := open(true)
+	if err := cm.PutManifest(ctx, "team/app", "v1", manifest, map[string][]string{"Content-Type": {"application/json"}}, 200); err != nil {
+		t.Fatal(err)
+	}
+	if err := cm.PutBlob(ctx, blobKey, digest, bytes.NewReader(layer), int64(len(layer)), nil); err != nil {
+		t.Fatal(err)
+	}
+	blobPath := cm.blobStore.getPath(digest)
+	for path, want := range map[string]bool{
+		cm.ManifestPath("team/app", "v1"): true,
+		blobPath + ".meta":                true,
+		blobPath:                          false,
+	} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := bytes.HasPrefix(data, gzipMagic); got != want {
+			t.Errorf("%s: gzip = %v, want %v", path, got, want)
+		}
+	}
+	if data, _ := os.ReadFile(blobPath); !bytes.Equal(data, layer) {
+		t.Error("blob content was modified on disk")
+	}
+	cm.Close()
+
+	// 关闭压缩后重新打开：已压缩的文件透明解压，新写入的文件不压缩
+	cm = open(false)
+	defer cm.Close()
+	entry, err := cm.GetManifest(ctx, "team/app", "v1")
+	if err != nil || !bytes.Equal(entry.Data, manifest) {
+		t.Fatalf("compressed manifest after reopen: %v", err)
+	}
+	_, reader, err := cm.GetBlob(ctx, blobKey, digest)
+	if err != nil {
+		t.Fatalf("blob with compressed .meta after reopen: %v", err)
+	}
+	data, _ := io.ReadAll(reader)
+	reader.Close()
+	if !bytes.Equal(data, layer) {
+		t.Error("blob content changed")
+	}
+
+	if err := cm.PutManifest(ctx, "team/app", "v2", manifest, nil, 200); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := os.ReadFile(cm.ManifestPath("team/app", "v2"))
+	if !bytes.HasPrefix(raw, []byte("{")) {
+		t.Errorf("manifest written without compression starts with %q", raw[:2])
+	}
+	if entry, err := cm.GetManifest(ctx, "team/app", "v2"); err != nil || !bytes.Equal(entry.Data, manifest) {
+		t.Errorf("uncompressed manifest: %v", err)
+	}
+}
+
+func TestDecodeMetadata(t *testing.T) {
+	plain := []byte(`{"digest":"sha256:abc"}`)
+	for name, data := range map[string][]byte{
+		"plain":      plain,
+		"compressed": encodeMetadata(plain, true),
+	} {
+		if got, err := decodeMetadata(data); err != nil || !bytes.Equal(got, plain) {
+			t.Errorf("%s: decodeMetadata = %q, %v", name, got, err)
+		}
+	}
+	if !bytes.Equal(encodeMetadata(plain, false), plain) {
+		t.Error("encodeMetadata compressed with compression disabled")
+	}
+	if _, err := decodeMetadata(append([]byte{}, gzipMagic...)); err == nil {
+		t.Error("decodeMetadata accepted a truncated gzip stream")
+	}
+}
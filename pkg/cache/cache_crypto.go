@@ -0,0 +1,260 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// =============================================================================
+// 静态加密 - AES-256-GCM 加密磁盘上的 blob 与 manifest 文件
+//
+// blob 按 64KB 分段加密以支持流式写入与 Range 读取：文件头为 magic + 8 字节随机前缀，
+// 每段的 nonce 为前缀 + 段序号，附加数据标记是否为最后一段；最后一段总是短于完整段
+// （可以为空），因此截断、重排或拼接的文件都无法通过认证。
+// 未加密的旧文件仍可读取，启用加密后无需清空缓存；没有密钥时加密文件视为未缓存
+// =============================================================================
+
+const (
+	encryptedMagic    = "GDPENC1\n"
+	encryptedHeader   = len(encryptedMagic) + 8
+	encryptSegment    = 64 << 10
+	encryptedSegment  = encryptSegment + 16 // 加上 GCM tag
+	encryptedKeyBytes = 32
+)
+
+// ErrEncrypted 文件已加密但未配置密钥
+var ErrEncrypted = errors.New("cache file is encrypted but no encryption key is configured")
+
+// Cipher 缓存文件的加解密器
+type Cipher struct {
+	aead cipher.AEAD
+}
+
+// NewCipher 使用 32 字节密钥创建 AES-256-GCM 加解密器
+func NewCipher(key []byte) (*Cipher, error) {
+	if len(key) != encryptedKeyBytes {
+		return nil, fmt.Errorf("encryption key must be %d bytes, got %d", encryptedKeyBytes, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Cipher{aead: aead}, nil
+}
+
+// isEncrypted 内容是否为加密格式
+func isEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(encryptedMagic))
+}
+
+// nonce 第 index 段的 nonce
+func segmentNonce(prefix []byte, index int64) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[8:], uint32(index))
+	return nonce
+}
+
+// segmentAAD 附加数据：是否为最后一段
+func segmentAAD(final bool) []byte {
+	if final {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// seal 加密整个文件内容（manifest），c 为 nil 时原样返回
+func (c *Cipher) seal(data []byte) ([]byte, error) {
+	if c == nil {
+		return data, nil
+	}
+	var buf bytes.Buffer
+	w, err := c.newEncryptWriter(&buf)
+	if err != nil {
+		return nil, err
+	}
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// open 解密整个文件内容，未加密的内容原样返回
+func (c *Cipher) open(data []byte) ([]byte, error) {
+	if !isEncrypted(data) {
+		return data, nil
+	}
+	if c == nil {
+		return nil, ErrEncrypted
+	}
+	r, err := c.newDecryptReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// encryptWriter 分段加密写入
+type encryptWriter struct {
+	c      *Cipher
+	w      io.Writer
+	prefix []byte
+	buf    []byte
+	index  int64
+	err    error
+}
+
+// newEncryptWriter 写入文件头并返回分段加密写入器，调用方必须 Close 以写入最后一段
+func (c *Cipher) newEncryptWriter(w io.Writer) (*encryptWriter, error) {
+	prefix := make([]byte, 8)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(append([]byte(encryptedMagic), prefix...)); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{c: c, w: w, prefix: prefix, buf: make([]byte, 0, encryptSegment)}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 && e.err == nil {
+		n := copy(e.buf[len(e.buf):encryptSegment], p)
+		e.buf = e.buf[:len(e.buf)+n]
+		p = p[n:]
+		written += n
+		if len(e.buf) == encryptSegment {
+			e.flush(false)
+		}
+	}
+	return written, e.err
+}
+
+func (e *encryptWriter) flush(final bool) {
+	sealed := e.c.aead.Seal(nil, segmentNonce(e.prefix, e.index), e.buf, segmentAAD(final))
+	if _, err := e.w.Write(sealed); err != nil {
+		e.err = err
+	}
+	e.index++
+	e.buf = e.buf[:0]
+}
+
+// Close 写入最后一段（少于完整段，可以为空）
+func (e *encryptWriter) Close() error {
+	if e.err == nil {
+		e.flush(true)
+	}
+	return e.err
+}
+
+// decryptReader 分段解密读取，支持 Seek 以便按 Range 读取
+type decryptReader struct {
+	c       *Cipher
+	r       io.ReaderAt
+	closer  io.Closer
+	prefix  []byte
+	size    int64 // 明文大小
+	pos     int64
+	index   int64 // 已解密的段序号（-1 表示没有）
+	plain   []byte
+	segment []byte
+}
+
+// newDecryptReader 读取文件头并根据密文长度计算明文大小
+func (c *Cipher) newDecryptReader(r io.ReaderAt, fileSize int64) (*decryptReader, error) {
+	header := make([]byte, encryptedHeader)
+	if _, err := r.ReadAt(header, 0); err != nil || !isEncrypted(header) {
+		return nil, fmt.Errorf("invalid encrypted cache file header")
+	}
+	body := fileSize - int64(encryptedHeader)
+	full, rem := body/encryptedSegment, body%encryptedSegment
+	if rem < 16 {
+		return nil, fmt.Errorf("encrypted cache file is truncated")
+	}
+	return &decryptReader{
+		c:       c,
+		r:       r,
+		prefix:  header[len(encryptedMagic):],
+		size:    full*encryptSegment + rem - 16,
+		index:   -1,
+		segment: make([]byte, encryptedSegment),
+	}, nil
+}
+
+// openEncryptedFile 打开加密的 blob 文件
+func (c *Cipher) openEncryptedFile(f *os.File) (*decryptReader, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	r, err := c.newDecryptReader(f, info.Size())
+	if err != nil {
+		return nil, err
+	}
+	r.closer = f
+	return r, nil
+}
+
+func (d *decryptReader) load(index int64) error {
+	offset := int64(encryptedHeader) + index*encryptedSegment
+	n, err := d.r.ReadAt(d.segment, offset)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	final := n < encryptedSegment
+	plain, err := d.c.aead.Open(d.plain[:0], segmentNonce(d.prefix, index), d.segment[:n], segmentAAD(final))
+	if err != nil {
+		return fmt.Errorf("encrypted cache file segment %d failed authentication", index)
+	}
+	d.plain = plain
+	d.index = index
+	return nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	if d.pos >= d.size {
+		return 0, io.EOF
+	}
+	index := d.pos / encryptSegment
+	if index != d.index {
+		if err := d.load(index); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain[d.pos-index*encryptSegment:])
+	d.pos += int64(n)
+	return n, nil
+}
+
+func (d *decryptReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += d.pos
+	case io.SeekEnd:
+		offset += d.size
+	}
+	if offset < 0 {
+		return 0, errors.New("negative seek position")
+	}
+	d.pos = offset
+	return offset, nil
+}
+
+func (d *decryptReader) Close() error {
+	if d.closer != nil {
+		return d.closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// =============================================================================
+// 崩溃安全 - 元数据与 manifest 先写入临时文件再原子重命名，启用 fsync 时在提交前
+// 将文件与所在目录刷到磁盘；启动加载索引时清理断电或崩溃留下的临时文件与孤立文件
+// =============================================================================
+
+// 临时文件名前缀（与正式文件位于同一目录，保证重命名是原子操作）
+const (
+	tempBlobPrefix     = "blob-"
+	tempMetaPrefix     = "blob-meta-"
+	tempManifestPrefix = "manifest-"
+)
+
+// reconcileGrace 文件修改时间精度有限（通常为时钟节拍），只清理比打开存储早于该间隔的文件，
+// 避免误删刚开始写入的临时文件
+const reconcileGrace = 5 * time.Second
+
+// isTempFile 文件名是否为写入中的临时文件
+func isTempFile(name string) bool {
+	return strings.HasPrefix(name, tempBlobPrefix) || strings.HasPrefix(name, tempManifestPrefix)
+}
+
+// writeFileAtomic 将 data 写入同目录的临时文件后重命名为 path，sync 为 true 时
+// 重命名前刷新文件、重命名后刷新目录，读取方不会看到写了一半的文件
+func writeFileAtomic(path string, data []byte, prefix string, sync bool) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), prefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if sync {
+		if err := tmp.Sync(); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	if sync {
+		return syncDir(filepath.Dir(path))
+	}
+	return nil
+}
+
+// syncDir 刷新目录项，使重命名在断电后仍然有效
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("failed to sync directory %s: %w", dir, err)
+	}
+	return nil
+}
+
+// reconcileStats 启动时清理的文件
+type reconcileStats struct {
+	tempFiles   int // 写入中断残留的临时文件
+	orphanBlobs int // 没有 .meta 的数据文件
+	orphanMetas int // 数据文件已不存在的 .meta
+	reclaimed   int64
+}
+
+// remove 删除打开存储之前留下的文件，之后修改过的文件可能正在写入，保留
+func (r *reconcileStats) remove(path string, info os.FileInfo, openedAt time.Time, counter *int) {
+	if !info.ModTime().Before(openedAt.Add(-reconcileGrace)) {
+		return
+	}
+	if err := os.Remove(path); err == nil {
+		*counter++
+		r.reclaimed += info.Size()
+	}
+}
+
+// log 有清理时输出一行汇总
+func (r *reconcileStats) log(store string) {
+	if r.tempFiles+r.orphanBlobs+r.orphanMetas == 0 {
+		return
+	}
+	log.Printf("[Cache] Startup reconciliation of %s: removed %d temp files and %d orphan files (%s)",
+		store, r.tempFiles, r.orphanBlobs+r.orphanMetas, FormatBytes(r.reclaimed))
+}
@@ -0,0 +1,153 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// =============================================================================
+// 文件缓存 - 非 OCI 内容（如 Helm chart 仓库的 index.yaml 与 chart 包）按 命名空间 + 路径
+// 存入 manifest 存储，过期时间由调用方指定，同样参与过期清理与垃圾回收；
+// 大文件按 sha256 存入 blob 存储，manifest 存储中只保存 路径 -> digest 的引用
+// =============================================================================
+
+// FileRepoPrefix 文件缓存条目的仓库名前缀（镜像仓库名不含冒号，不会冲突）
+const FileRepoPrefix = "files:"
+
+// GetFile 获取缓存的文件，不存在或已过期时返回 false
+func (cm *CacheManager) GetFile(namespace, name string) (*CacheEntry, bool) {
+	entry, err := cm.manifestStore.Get(context.Background(), FileRepoPrefix+namespace, name)
+	return entry, err == nil
+}
+
+// GetStaleFile 获取已过期但仍在保留期内的文件，用于上游不可用时返回过期内容
+func (cm *CacheManager) GetStaleFile(namespace, name string) (*CacheEntry, bool) {
+	entry, err := cm.manifestStore.GetStale(context.Background(), FileRepoPrefix+namespace, name)
+	return entry, err == nil
+}
+
+// PutFile 缓存文件内容，ttl 后过期
+func (cm *CacheManager) PutFile(namespace, name string, data []byte, headers map[string][]string, ttl time.Duration) error {
+	hash := sha256.Sum256(data)
+	now := time.Now()
+	entry := &CacheEntry{
+		Descriptor: Descriptor{
+			Digest:    "sha256:" + hex.EncodeToString(hash[:]),
+			Size:      int64(len(data)),
+			MediaType: http.Header(headers).Get("Content-Type"),
+		},
+		Headers:    headers,
+		StatusCode: http.StatusOK,
+		Data:       data,
+		CachedAt:   now,
+		ExpiresAt:  now.Add(ttl),
+	}
+	if err := cm.manifestStore.Put(context.Background(), FileRepoPrefix+namespace, name, entry); err != nil {
+		return err
+	}
+
+	cm.stats.ManifestCount.Add(1)
+	cm.stats.TotalSize.Add(int64(len(data)))
+	return nil
+}
+
+// PutFileRef 记录文件路径对应的 blob（内容已由 ContentWriter 存入 blob 存储），ttl 后过期
+func (cm *CacheManager) PutFileRef(namespace, name string, desc Descriptor, headers map[string][]string, ttl time.Duration) error {
+	now := time.Now()
+	entry := &CacheEntry{
+		Descriptor: desc,
+		Headers:    headers,
+		StatusCode: http.StatusOK,
+		CachedAt:   now,
+		ExpiresAt:  now.Add(ttl),
+	}
+	if err := cm.manifestStore.Put(context.Background(), FileRepoPrefix+namespace, name, entry); err != nil {
+		return err
+	}
+	cm.stats.ManifestCount.Add(1)
+	return nil
+}
+
+// ContentWriter 写入事先不知道 digest 的内容：先写入 blob 目录下的临时文件，
+// Commit 时按计算出的 sha256 存入 blob 存储，与镜像 blob 共享去重、过期与淘汰
+type ContentWriter struct {
+	cm     *CacheManager
+	file   *os.File
+	buf    *bufio.Writer
+	hasher hash.Hash
+	size   int64
+	done   bool
+}
+
+// ContentWriter 创建内容写入器，调用方必须调用 Commit 或 Cancel
+func (cm *CacheManager) ContentWriter() (*ContentWriter, error) {
+	if err := os.MkdirAll(cm.blobStore.dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+	file, err := os.CreateTemp(cm.blobStore.dir, tempBlobPrefix+"*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	return &ContentWriter{
+		cm:     cm,
+		file:   file,
+		buf:    bufio.NewWriterSize(file, 256*1024),
+		hasher: sha256.New(),
+	}, nil
+}
+
+// Write 写入内容并同时计算哈希
+func (w *ContentWriter) Write(p []byte) (int, error) {
+	n, err := w.buf.Write(p)
+	w.hasher.Write(p[:n])
+	w.size += int64(n)
+	return n, err
+}
+
+// Size 已写入的字节数
+func (w *ContentWriter) Size() int64 {
+	return w.size
+}
+
+// Cancel 放弃写入并删除临时文件，可重复调用
+func (w *ContentWriter) Cancel() {
+	if w.done {
+		return
+	}
+	w.done = true
+	w.file.Close()
+	os.Remove(w.file.Name())
+}
+
+// Commit 将内容存入 blob 存储（相同内容已缓存时直接复用），返回内容的描述符
+func (w *ContentWriter) Commit(ctx context.Context, mediaType string) (Descriptor, error) {
+	if w.done {
+		return Descriptor{}, fmt.Errorf("content writer already closed")
+	}
+	defer w.Cancel()
+
+	if err := w.buf.Flush(); err != nil {
+		return Descriptor{}, fmt.Errorf("failed to flush: %w", err)
+	}
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return Descriptor{}, err
+	}
+	desc := Descriptor{
+		Digest:    "sha256:" + hex.EncodeToString(w.hasher.Sum(nil)),
+		Size:      w.size,
+		MediaType: mediaType,
+	}
+	headers := map[string][]string{"Content-Type": {mediaType}}
+	if err := w.cm.PutBlob(ctx, desc.Digest, desc.Digest, w.file, w.size, headers); err != nil {
+		return Descriptor{}, err
+	}
+	return desc, nil
+}
@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// =============================================================================
+// 缓存目录格式版本 - 目录中的 VERSION 文件记录布局版本，升级时由 cache migrate 迁移
+// =============================================================================
+
+// 缓存目录格式版本
+const (
+	FormatLegacy  = 1 // 旧版 FileCache：按缓存键哈希存放在 {dir}/ab/cd/{sha256(key)}，元数据在同名 .meta
+	FormatCurrent = 2 // blobs/ 按 digest 存放，manifests/ 按仓库与引用存放
+)
+
+// FormatFile 记录格式版本的文件名
+const FormatFile = "VERSION"
+
+var (
+	legacyShardPattern = regexp.MustCompile(`^[0-9a-f]{2}$`)
+	legacyEntryPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+)
+
+// ReadFormatVersion 读取缓存目录的格式版本；没有 VERSION 文件时，
+// 存在旧版条目视为 FormatLegacy，否则视为 FormatCurrent
+func ReadFormatVersion(dir string) (int, error) {
+	data, err := os.ReadFile(filepath.Join(dir, FormatFile))
+	if os.IsNotExist(err) {
+		if len(LegacyEntries(dir)) > 0 {
+			return FormatLegacy, nil
+		}
+		return FormatCurrent, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	version, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || version < FormatLegacy {
+		return 0, fmt.Errorf("invalid %s file: %q", FormatFile, strings.TrimSpace(string(data)))
+	}
+	return version, nil
+}
+
+// WriteFormatVersion 将缓存目录标记为当前格式
+func WriteFormatVersion(dir string) error {
+	return os.WriteFile(filepath.Join(dir, FormatFile), []byte(strconv.Itoa(FormatCurrent)+"\n"), 0o644)
+}
+
+// LegacyEntries 返回旧版 FileCache 留下的数据文件路径（不含 .meta）
+func LegacyEntries(dir string) []string {
+	var entries []string
+	shards, _ := filepath.Glob(filepath.Join(dir, "*", "*", "*"))
+	for _, path := range shards {
+		shard2 := filepath.Dir(path)
+		shard1 := filepath.Dir(shard2)
+		if filepath.Dir(shard1) != filepath.Clean(dir) ||
+			!legacyShardPattern.MatchString(filepath.Base(shard1)) ||
+			!legacyShardPattern.MatchString(filepath.Base(shard2)) ||
+			!legacyEntryPattern.MatchString(filepath.Base(path)) {
+			continue
+		}
+		entries = append(entries, path)
+	}
+	return entries
+}
+
+// checkFormat 启动时检查缓存目录格式：拒绝更新版本的格式，
+// 旧版布局提示运行 cache migrate（旧条目不会被读取），新目录写入版本标记
+func checkFormat(dir string) error {
+	version, err := ReadFormatVersion(dir)
+	if err != nil {
+		return err
+	}
+	switch {
+	case version > FormatCurrent:
+		return fmt.Errorf("cache directory %s uses format version %d, this build supports up to %d", dir, version, FormatCurrent)
+	case version < FormatCurrent:
+		log.Printf("[Cache] %s contains %d entries in the legacy layout that will not be served; run `go-docker-proxy cache migrate` to convert them",
+			dir, len(LegacyEntries(dir)))
+		return nil
+	}
+	if _, err := os.Stat(filepath.Join(dir, FormatFile)); os.IsNotExist(err) {
+		return WriteFormatVersion(dir)
+	}
+	return nil
+}
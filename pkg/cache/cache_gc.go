@@ -0,0 +1,290 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// =============================================================================
+// 垃圾回收 - 删除超过保留期的 manifest 与过期 blob，总大小超过目标时按缓存时间淘汰最早的 blob，
+// 再按仓库配额淘汰。后台每 CleanupInterval 执行一次，也可手动触发（指定目标大小或只统计不删除），
+// 执行进度与最近一次结果通过 GCStatus 查询
+// =============================================================================
+
+// ErrGCRunning 已有回收正在执行
+var ErrGCRunning = errors.New("garbage collection is already running")
+
+// GC 阶段
+const (
+	GCPhaseManifests = "manifests" // 删除超过保留期的 manifest
+	GCPhaseExpired   = "expired"   // 删除过期 blob
+	GCPhaseSize      = "size"      // 超过目标大小，淘汰最早缓存的 blob
+	GCPhaseQuotas    = "quotas"    // 按仓库配额淘汰
+	GCPhaseDone      = "done"
+)
+
+// GCOptions 回收参数
+type GCOptions struct {
+	TargetSize int64  // blob 总大小目标（0 表示使用 CacheConfig.MaxSize）
+	DryRun     bool   // 只统计将删除的内容，不修改缓存
+	Trigger    string // scheduled 或 manual
+}
+
+// GCStatus 一次回收的进度与结果
+type GCStatus struct {
+	Trigger          string     `json:"trigger"`
+	DryRun           bool       `json:"dryRun"`
+	TargetSize       int64      `json:"targetSize"`
+	Phase            string     `json:"phase"`
+	StartedAt        time.Time  `json:"startedAt"`
+	FinishedAt       *time.Time `json:"finishedAt,omitempty"`
+	Duration         string     `json:"duration,omitempty"`
+	SizeBefore       int64      `json:"sizeBefore"`   // 开始时的 blob 总大小
+	Candidates       int        `json:"candidates"`   // 当前阶段待删除的 blob 数
+	Processed        int        `json:"processed"`    // 当前阶段已处理的 blob 数
+	BlobsDeleted     int        `json:"blobsDeleted"` // dry-run 时为将删除的数量
+	ManifestsDeleted int        `json:"manifestsDeleted"`
+	ReclaimedBytes   int64      `json:"reclaimedBytes"` // dry-run 时为可回收的字节数
+	Error            string     `json:"error,omitempty"`
+}
+
+// gcState 正在执行与最近完成的回收
+type gcState struct {
+	mu      sync.Mutex
+	current *GCStatus
+	last    *GCStatus
+}
+
+// GCStatus 返回正在执行的回收（未执行时为 nil）与最近一次完成的回收（从未执行时为 nil）
+func (cm *CacheManager) GCStatus() (current, last *GCStatus) {
+	cm.gc.mu.Lock()
+	defer cm.gc.mu.Unlock()
+	if cm.gc.current != nil {
+		snapshot := *cm.gc.current
+		current = &snapshot
+	}
+	if cm.gc.last != nil {
+		snapshot := *cm.gc.last
+		last = &snapshot
+	}
+	return current, last
+}
+
+// StartGC 在后台开始一次回收，已有回收正在执行时返回 ErrGCRunning
+func (cm *CacheManager) StartGC(opts GCOptions) (*GCStatus, error) {
+	status, err := cm.beginGC(opts)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := *status
+	cm.wg.Add(1)
+	go func() {
+		defer cm.wg.Done()
+		cm.runGC(cm.ctx, status)
+	}()
+	return &snapshot, nil
+}
+
+// RunGC 同步执行一次回收并返回结果
+func (cm *CacheManager) RunGC(ctx context.Context, opts GCOptions) (*GCStatus, error) {
+	status, err := cm.beginGC(opts)
+	if err != nil {
+		return nil, err
+	}
+	cm.runGC(ctx, status)
+	return status, nil
+}
+
+// beginGC 登记一次新的回收
+func (cm *CacheManager) beginGC(opts GCOptions) (*GCStatus, error) {
+	if opts.TargetSize <= 0 {
+		opts.TargetSize = cm.config.MaxSize
+	}
+	cm.gc.mu.Lock()
+	defer cm.gc.mu.Unlock()
+	if cm.gc.current != nil {
+		return nil, ErrGCRunning
+	}
+	cm.gc.current = &GCStatus{
+		Trigger:    opts.Trigger,
+		DryRun:     opts.DryRun,
+		TargetSize: opts.TargetSize,
+		Phase:      GCPhaseManifests,
+		StartedAt:  time.Now(),
+	}
+	return cm.gc.current, nil
+}
+
+// updateGC 在锁内修改进度
+func (cm *CacheManager) updateGC(fn func()) {
+	cm.gc.mu.Lock()
+	fn()
+	cm.gc.mu.Unlock()
+}
+
+// runGC 执行回收并记录结果
+func (cm *CacheManager) runGC(ctx context.Context, status *GCStatus) {
+	err := cm.collect(ctx, status)
+
+	finished := time.Now()
+	cm.updateGC(func() {
+		status.Phase = GCPhaseDone
+		status.FinishedAt = &finished
+		status.Duration = finished.Sub(status.StartedAt).Round(time.Millisecond).String()
+		if err != nil {
+			status.Error = err.Error()
+		}
+		cm.gc.last = status
+		cm.gc.current = nil
+	})
+	if !status.DryRun {
+		cm.stats.LastCleanup = finished
+	}
+
+	switch {
+	case err != nil:
+		log.Printf("[Cache] Garbage collection (%s) stopped: %v", status.Trigger, err)
+	case status.Trigger != "scheduled" || (cm.config.Debug && status.BlobsDeleted+status.ManifestsDeleted > 0):
+		verb := "reclaimed"
+		if status.DryRun {
+			verb = "would reclaim"
+		}
+		log.Printf("[Cache] Garbage collection (%s): %d blobs and %d manifests, %s %s in %s",
+			status.Trigger, status.BlobsDeleted, status.ManifestsDeleted, verb, FormatBytes(status.ReclaimedBytes), status.Duration)
+	}
+}
+
+// collect 依次执行各阶段
+func (cm *CacheManager) collect(ctx context.Context, status *GCStatus) error {
+	if err := cm.collectManifests(ctx, status); err != nil {
+		return err
+	}
+
+	// 按索引快照规划待删除的 blob：过期 blob、超过目标大小时最早缓存的 blob、超出配额的 blob
+	now := time.Now()
+	var live []*BlobMeta
+	var expired []*BlobMeta
+	var total, before int64
+	cm.blobStore.mu.RLock()
+	for _, meta := range cm.blobStore.index {
+		if now.After(meta.ExpiresAt) {
+			expired = append(expired, meta)
+		} else {
+			live = append(live, meta)
+			total += meta.Size
+		}
+		before += meta.Size
+	}
+	cm.blobStore.mu.RUnlock()
+	cm.updateGC(func() { status.SizeBefore = before })
+	sort.Slice(live, func(i, j int) bool { return live[i].CachedAt.Before(live[j].CachedAt) })
+
+	if err := cm.deleteBlobs(ctx, status, GCPhaseExpired, expired); err != nil {
+		return err
+	}
+
+	var oldest []*BlobMeta
+	for _, meta := range live {
+		if total <= status.TargetSize {
+			break
+		}
+		oldest = append(oldest, meta)
+		total -= meta.Size
+	}
+	live = live[len(oldest):]
+	if err := cm.deleteBlobs(ctx, status, GCPhaseSize, oldest); err != nil {
+		return err
+	}
+
+	var overQuota []*BlobMeta
+	if quotas := cm.quotas.Load(); quotas != nil {
+		for _, q := range *quotas {
+			var used int64
+			var owned []*BlobMeta
+			for _, meta := range live {
+				if owner, ok := cm.quotaFor(meta.Repo); ok && owner.Pattern == q.Pattern {
+					owned = append(owned, meta)
+					used += meta.Size
+				}
+			}
+			for _, meta := range owned {
+				if used <= q.MaxSize {
+					break
+				}
+				overQuota = append(overQuota, meta)
+				used -= meta.Size
+			}
+		}
+	}
+	return cm.deleteBlobs(ctx, status, GCPhaseQuotas, overQuota)
+}
+
+// collectManifests 删除超过过期保留期的 manifest 文件，并释放内存缓存中的过期条目
+func (cm *CacheManager) collectManifests(ctx context.Context, status *GCStatus) error {
+	s := cm.manifestStore
+	err := filepath.Walk(s.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		// 无法读取的文件（如加密密钥不匹配）保留，与加载索引时的处理一致
+		var entry CacheEntry
+		data, err := s.readFile(path)
+		if err != nil || json.Unmarshal(data, &entry) != nil || !s.pastStale(&entry) {
+			return nil
+		}
+		if !status.DryRun {
+			if err := os.Remove(path); err != nil {
+				return nil
+			}
+			if entry.Repo != "" {
+				s.hot.Delete("manifest:" + s.getKey(entry.Repo, entry.Reference))
+			}
+		}
+		cm.updateGC(func() {
+			status.ManifestsDeleted++
+			status.ReclaimedBytes += info.Size()
+		})
+		return nil
+	})
+	if !status.DryRun {
+		s.Cleanup()
+	}
+	return err
+}
+
+// deleteBlobs 删除一个阶段规划的 blob，同时移除描述符缓存与内存缓存
+func (cm *CacheManager) deleteBlobs(ctx context.Context, status *GCStatus, phase string, blobs []*BlobMeta) error {
+	cm.updateGC(func() {
+		status.Phase = phase
+		status.Candidates = len(blobs)
+		status.Processed = 0
+	})
+	for _, meta := range blobs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !status.DryRun {
+			cm.blobStore.Delete(ctx, meta.Digest)
+			cm.descriptorCache.Delete(meta.Digest)
+			cm.hot.Delete("blob:" + meta.Digest)
+			cm.stats.BlobCount.Add(-1)
+			cm.stats.TotalSize.Add(-meta.Size)
+		}
+		cm.updateGC(func() {
+			status.Processed++
+			status.BlobsDeleted++
+			status.ReclaimedBytes += meta.Size
+		})
+	}
+	return nil
+}
@@ -1,10 +1,11 @@
-package main
+package cache
 
 import (
 	"bytes"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -38,6 +39,8 @@ type CacheEntry struct {
 	BodyPath   string              `json:"bodyPath,omitempty"` // 大文件路径
 	CachedAt   time.Time           `json:"cachedAt"`
 	ExpiresAt  time.Time           `json:"expiresAt"`
+	Repo       string              `json:"repo,omitempty"`      // manifest 所属仓库（manifest 文件名是哈希，目录列表依赖该字段）
+	Reference  string              `json:"reference,omitempty"` // manifest 的 tag 或 digest
 }
 
 // BlobStore 定义 blob 存储接口
@@ -90,6 +93,8 @@ type CacheStatistics struct {
 	BlobCount      atomic.Int64
 	ManifestCount  atomic.Int64
 	Deduplication  atomic.Int64 // 请求去重次数
+	BlobVerified   atomic.Int64 // 读取时校验的 blob 数
+	BlobCorrupted  atomic.Int64 // 校验发现损坏并删除的 blob 数
 	LastCleanup    time.Time
 }
 
@@ -116,11 +121,13 @@ func (s *CacheStatistics) Snapshot() map[string]interface{} {
 
 	return map[string]interface{}{
 		"blob": map[string]interface{}{
-			"count":    s.BlobCount.Load(),
-			"requests": blobTotal,
-			"hits":     blobHits,
-			"misses":   blobMisses,
-			"hitRate":  blobHitRate,
+			"count":     s.BlobCount.Load(),
+			"requests":  blobTotal,
+			"hits":      blobHits,
+			"misses":    blobMisses,
+			"hitRate":   blobHitRate,
+			"verified":  s.BlobVerified.Load(),
+			"corrupted": s.BlobCorrupted.Load(),
 		},
 		"manifest": map[string]interface{}{
 			"count":    s.ManifestCount.Load(),
@@ -130,7 +137,7 @@ func (s *CacheStatistics) Snapshot() map[string]interface{} {
 			"hitRate":  manifestHitRate,
 		},
 		"totalSize":      s.TotalSize.Load(),
-		"totalSizeHuman": formatBytes(s.TotalSize.Load()),
+		"totalSizeHuman": FormatBytes(s.TotalSize.Load()),
 		"deduplication":  s.Deduplication.Load(),
 		"lastCleanup":    formatLastCleanup(s.LastCleanup),
 	}
@@ -155,6 +162,15 @@ type CacheConfig struct {
 	ManifestTTL     time.Duration // manifest by tag 过期时间
 	BlobTTL         time.Duration // blob 过期时间（不可变内容）
 	CleanupInterval time.Duration // 清理间隔
+	HotCacheSize    int64         // 内存缓存总字节数（0 表示不启用）
+	HotCacheMaxItem int64         // 可放入内存缓存的单个对象上限
+	TTLPolicy       TTLPolicy     // 按上游响应头计算有效期的策略（零值表示使用固定 TTL）
+	VerifyRate      float64       // 读取 blob 时重新校验 sha256 的比例（0 不校验，1 每次校验）
+	Quotas          []Quota       // 按仓库的空间配额
+	CompressMeta    bool          // gzip 压缩 manifest 与 .meta 文件
+	Fsync           bool          // 提交 blob、元数据与 manifest 前刷到磁盘
+	Cipher          *Cipher       // 加密 blob 与 manifest 文件（nil 表示不加密）
+	StaleTTL        time.Duration // manifest 过期后继续保留的时间，上游限流时返回过期内容（0 表示过期即删除）
 	Debug           bool          // 调试模式
 }
 
@@ -172,7 +188,10 @@ func DefaultCacheConfig() *CacheConfig {
 
 // CacheManager 缓存管理器
 type CacheManager struct {
-	config *CacheConfig
+	config      *CacheConfig
+	manifestTTL atomic.Int64 // time.Duration，tag 引用的 manifest 有效期，可通过 SetTTL 热更新
+	ttlPolicy   atomic.Pointer[TTLPolicy]
+	quotas      atomic.Pointer[[]Quota]
 
 	// 存储层
 	blobStore     *FileBlobStore
@@ -180,6 +199,7 @@ type CacheManager struct {
 
 	// 内存缓存层
 	descriptorCache *LRUDescriptorCache
+	hot             *HotCache // manifest 与小 blob 内容
 
 	// 请求去重
 	inflight *InflightManager
@@ -187,6 +207,9 @@ type CacheManager struct {
 	// 统计
 	stats *CacheStatistics
 
+	// 垃圾回收进度
+	gc gcState
+
 	// 控制
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -212,23 +235,42 @@ func NewCacheManager(config *CacheConfig) (*CacheManager, error) {
 		}
 	}
 
+	if err := checkFormat(config.Dir); err != nil {
+		return nil, err
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
+	hot := NewHotCache(config.HotCacheSize, config.HotCacheMaxItem)
 
 	cm := &CacheManager{
 		config:          config,
 		blobStore:       NewFileBlobStore(filepath.Join(config.Dir, "blobs"), config.BlobTTL),
-		manifestStore:   NewFileManifestStore(filepath.Join(config.Dir, "manifests"), config.ManifestTTL, config.BlobTTL),
+		manifestStore:   NewFileManifestStore(filepath.Join(config.Dir, "manifests"), config.ManifestTTL, config.BlobTTL, hot),
 		descriptorCache: NewLRUDescriptorCache(10000),
+		hot:             hot,
 		inflight:        NewInflightManager(),
 		stats:           &CacheStatistics{},
 		ctx:             ctx,
 		cancel:          cancel,
 	}
+	cm.manifestTTL.Store(int64(config.ManifestTTL))
+	cm.blobStore.compress = config.CompressMeta
+	cm.manifestStore.compress = config.CompressMeta
+	cm.blobStore.fsync = config.Fsync
+	cm.manifestStore.fsync = config.Fsync
+	cm.blobStore.cipher = config.Cipher
+	cm.manifestStore.cipher = config.Cipher
+	cm.manifestStore.staleTTL = config.StaleTTL
+	cm.SetTTLPolicy(config.TTLPolicy)
+	cm.SetQuotas(config.Quotas)
 
 	// 启动后台清理
 	cm.wg.Add(1)
 	go cm.cleanupLoop()
 
+	// 接近 GOMEMLIMIT 时收缩内存缓存
+	go hot.memoryPressureLoop(ctx, 10*time.Second)
+
 	// 启动时加载索引
 	cm.wg.Add(1)
 	go func() {
@@ -239,6 +281,68 @@ func NewCacheManager(config *CacheConfig) (*CacheManager, error) {
 	return cm, nil
 }
 
+// OpenOffline 打开缓存目录供命令行工具读写
+// 不启动后台清理与索引加载，也不使用内存缓存
+func OpenOffline(config *CacheConfig) *CacheManager {
+	cm := &CacheManager{
+		config:          config,
+		blobStore:       NewFileBlobStore(filepath.Join(config.Dir, "blobs"), config.BlobTTL),
+		manifestStore:   NewFileManifestStore(filepath.Join(config.Dir, "manifests"), config.ManifestTTL, config.BlobTTL, nil),
+		descriptorCache: NewLRUDescriptorCache(1000),
+		inflight:        NewInflightManager(),
+		stats:           &CacheStatistics{},
+		ctx:             context.Background(),
+		cancel:          func() {},
+	}
+	cm.manifestTTL.Store(int64(config.ManifestTTL))
+	cm.blobStore.compress = config.CompressMeta
+	cm.manifestStore.compress = config.CompressMeta
+	cm.blobStore.fsync = config.Fsync
+	cm.manifestStore.fsync = config.Fsync
+	cm.blobStore.cipher = config.Cipher
+	cm.manifestStore.cipher = config.Cipher
+	cm.manifestStore.staleTTL = config.StaleTTL
+	cm.SetTTLPolicy(config.TTLPolicy)
+	cm.SetQuotas(config.Quotas)
+	return cm
+}
+
+// SetTTL 修改缓存有效期，对之后写入的内容生效
+func (cm *CacheManager) SetTTL(manifestTTL, blobTTL time.Duration) {
+	cm.manifestTTL.Store(int64(manifestTTL))
+	cm.blobStore.SetTTL(blobTTL)
+}
+
+// ManifestTTL 返回按 tag 缓存的 manifest 的有效期
+func (cm *CacheManager) ManifestTTL() time.Duration {
+	return time.Duration(cm.manifestTTL.Load())
+}
+
+// BlobStore 返回 blob 文件存储
+func (cm *CacheManager) BlobStore() *FileBlobStore {
+	return cm.blobStore
+}
+
+// ManifestPath 返回 manifest 缓存文件路径
+func (cm *CacheManager) ManifestPath(repo, reference string) string {
+	return cm.manifestStore.getPath(repo, reference)
+}
+
+// ReadManifestFile 读取 manifest 缓存文件（解密、解压后的 JSON），不检查有效期
+func (cm *CacheManager) ReadManifestFile(repo, reference string) ([]byte, error) {
+	return cm.manifestStore.readFile(cm.manifestStore.getPath(repo, reference))
+}
+
+// WalkManifests 遍历缓存的 manifest（含过期但仍在保留期内的），lastAccess 为最近一次命中的时间（未命中过时为写入时间）
+func (cm *CacheManager) WalkManifests(fn func(entry *CacheEntry, lastAccess time.Time)) {
+	cm.manifestStore.Walk(fn)
+}
+
+// Context 缓存管理器的生命周期 context，Close 时取消；后台缓存写入以它为父 context
+func (cm *CacheManager) Context() context.Context {
+	return cm.ctx
+}
+
 // Close 关闭缓存管理器
 func (cm *CacheManager) Close() error {
 	cm.cancel()
@@ -252,10 +356,20 @@ func (cm *CacheManager) Close() error {
 
 // GetBlob 获取 blob
 func (cm *CacheManager) GetBlob(ctx context.Context, cacheKey, digest string) (*CacheEntry, io.ReadCloser, error) {
+	// 0. 小 blob 直接从内存读取
+	if entry, ok := cm.hot.Get("blob:" + digest); ok {
+		cm.stats.BlobHits.Add(1)
+		return &CacheEntry{
+			Descriptor: entry.Descriptor,
+			StatusCode: http.StatusOK,
+			CachedAt:   entry.CachedAt,
+		}, memoryBlob{bytes.NewReader(entry.Data)}, nil
+	}
+
 	// 1. 先检查描述符缓存
 	if desc, ok := cm.descriptorCache.Get(digest); ok {
 		// 尝试从存储获取内容
-		reader, err := cm.blobStore.Get(ctx, digest)
+		reader, err := cm.openBlob(ctx, desc)
 		if err == nil {
 			cm.stats.BlobHits.Add(1)
 			return &CacheEntry{
@@ -270,7 +384,7 @@ func (cm *CacheManager) GetBlob(ctx context.Context, cacheKey, digest string) (*
 	// 2. 直接检查存储
 	desc, err := cm.blobStore.Stat(ctx, digest)
 	if err == nil {
-		reader, err := cm.blobStore.Get(ctx, digest)
+		reader, err := cm.openBlob(ctx, desc)
 		if err == nil {
 			cm.stats.BlobHits.Add(1)
 			cm.descriptorCache.Set(digest, desc)
@@ -285,10 +399,59 @@ func (cm *CacheManager) GetBlob(ctx context.Context, cacheKey, digest string) (*
 	return nil, nil, ErrNotFound
 }
 
-// PutBlob 存储 blob
+// memoryBlob 内存中的 blob 内容，实现 io.ReadSeeker 以支持 Range 请求
+type memoryBlob struct {
+	*bytes.Reader
+}
+
+func (memoryBlob) Close() error { return nil }
+
+// openBlob 打开缓存的 blob，小 blob 读入内存缓存，后续请求不再访问磁盘
+func (cm *CacheManager) openBlob(ctx context.Context, desc Descriptor) (io.ReadCloser, error) {
+	reader, err := cm.blobStore.Get(ctx, desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+	verify := cm.shouldVerify()
+	if !cm.hot.Fits(desc.Size) {
+		if verify {
+			return cm.verifyReader(desc, reader)
+		}
+		return reader, nil
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(io.LimitReader(reader, desc.Size+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != desc.Size {
+		return nil, ErrNotFound
+	}
+	if verify && !cm.verifyData(desc, data) {
+		return nil, ErrNotFound
+	}
+	cm.hot.Set("blob:"+desc.Digest, &CacheEntry{Descriptor: desc, Data: data, CachedAt: time.Now()})
+	return memoryBlob{bytes.NewReader(data)}, nil
+}
+
+// PutBlob 存储 blob，已缓存时不再写入；同一 digest 正在写入时等待其完成
 func (cm *CacheManager) PutBlob(ctx context.Context, cacheKey, digest string, content io.Reader, size int64, headers map[string][]string) error {
-	// 存储内容
-	if err := cm.blobStore.Put(ctx, digest, content, size); err != nil {
+	// 存储内容，记录所属仓库以便按仓库配额
+	bw, err := cm.blobStore.writerWait(ctx, digest)
+	if errors.Is(err, ErrBlobExists) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, repo, _ := ParsePath(cacheKey)
+	bw.SetRepo(repo)
+	if _, err := io.Copy(bw, content); err != nil {
+		bw.Cancel()
+		return fmt.Errorf("failed to write content: %w", err)
+	}
+	if err := bw.Commit(-1); err != nil {
 		return err
 	}
 
@@ -307,9 +470,30 @@ func (cm *CacheManager) PutBlob(ctx context.Context, cacheKey, digest string, co
 	cm.stats.BlobCount.Add(1)
 	cm.stats.TotalSize.Add(size)
 
+	if q, ok := cm.quotaFor(repo); ok {
+		cm.enforceQuota(q)
+	}
 	return nil
 }
 
+// BlobWriter 创建流式写入 blob 的写入器，Commit 校验通过后更新描述符缓存与统计；
+// blob 已缓存或正在由其他请求写入时返回 ErrBlobExists / ErrBlobWriteInProgress
+func (cm *CacheManager) BlobWriter(digest, mediaType string) (*BlobWriter, error) {
+	bw, err := cm.blobStore.Writer(digest)
+	if err != nil {
+		return nil, err
+	}
+	bw.onCommit = func(meta *BlobMeta) {
+		cm.descriptorCache.Set(digest, Descriptor{Digest: digest, Size: meta.Size, MediaType: mediaType})
+		cm.stats.BlobCount.Add(1)
+		cm.stats.TotalSize.Add(meta.Size)
+		if q, ok := cm.quotaFor(meta.Repo); ok {
+			cm.enforceQuota(q)
+		}
+	}
+	return bw, nil
+}
+
 // GetManifest 获取 manifest
 func (cm *CacheManager) GetManifest(ctx context.Context, repo, reference string) (*CacheEntry, error) {
 	entry, err := cm.manifestStore.Get(ctx, repo, reference)
@@ -348,10 +532,10 @@ func (cm *CacheManager) PutManifest(ctx context.Context, repo, reference string,
 	// 根据引用类型设置过期时间
 	if strings.HasPrefix(reference, "sha256:") {
 		// digest 引用，内容不可变
-		entry.ExpiresAt = time.Now().Add(cm.config.BlobTTL)
+		entry.ExpiresAt = time.Now().Add(cm.blobStore.TTL())
 	} else {
 		// tag 引用，可能会更新
-		entry.ExpiresAt = time.Now().Add(cm.config.ManifestTTL)
+		entry.ExpiresAt = time.Now().Add(cm.ManifestTTL())
 	}
 
 	if err := cm.manifestStore.Put(ctx, repo, reference, entry); err != nil {
@@ -416,6 +600,12 @@ func (cm *CacheManager) Get(cacheKey string) (*CacheEntry, bool) {
 			return entry, true
 		}
 		// GetManifest 内部已经记录了 miss
+	case "referrers":
+		// referrers 索引与 manifest 共用存储，使用独立的 reference 前缀避免冲突
+		entry, err := cm.GetManifest(ctx, repo, referrersReference(reference))
+		if err == nil && entry != nil {
+			return entry, true
+		}
 	case "blob":
 		// 对于 blob，仅返回元数据（检查是否存在）
 		// 实际数据通过 GetBlobReader 流式读取
@@ -438,6 +628,24 @@ func (cm *CacheManager) Get(cacheKey string) (*CacheEntry, bool) {
 	return nil, false
 }
 
+// GetStale 获取已过期但仍在保留期内的 manifest（含 referrers 索引），
+// 用于上游限流或不可用时返回过期内容
+func (cm *CacheManager) GetStale(cacheKey string) (*CacheEntry, bool) {
+	pathType, repo, reference := ParsePath(cacheKey)
+	switch pathType {
+	case "referrers":
+		reference = referrersReference(reference)
+	case "manifest":
+	default:
+		return nil, false
+	}
+	entry, err := cm.manifestStore.GetStale(context.Background(), repo, reference)
+	if err != nil || len(entry.Data) == 0 {
+		return nil, false
+	}
+	return entry, true
+}
+
 // setBlobHeaders 设置 blob 响应的标准 headers
 func (cm *CacheManager) setBlobHeaders(entry *CacheEntry) {
 	if entry.Headers == nil {
@@ -469,6 +677,22 @@ func (cm *CacheManager) GetBlobReader(cacheKey string) (*CacheEntry, io.ReadClos
 	return entry, reader, true
 }
 
+// HasBlob blob 是否已缓存：只检查元数据与数据文件是否存在，不打开或校验内容
+func (cm *CacheManager) HasBlob(cacheKey string) bool {
+	digest := GetDigestFromPath(cacheKey)
+	if digest == "" {
+		return false
+	}
+	if _, ok := cm.hot.Get("blob:" + digest); ok {
+		return true
+	}
+	if _, err := cm.blobStore.Stat(context.Background(), digest); err != nil {
+		return false
+	}
+	_, err := os.Stat(cm.blobStore.getPath(digest))
+	return err == nil
+}
+
 // Put 存储缓存条目（统一接口）
 func (cm *CacheManager) Put(cacheKey string, entry *CacheEntry) error {
 	pathType, repo, reference := ParsePath(cacheKey)
@@ -479,6 +703,8 @@ func (cm *CacheManager) Put(cacheKey string, entry *CacheEntry) error {
 	case "manifest":
 		// Manifest 存储需要数据
 		return cm.manifestStore.Put(ctx, repo, reference, entry)
+	case "referrers":
+		return cm.manifestStore.Put(ctx, repo, referrersReference(reference), entry)
 	case "blob":
 		// Blob 存储：写入实际数据到文件存储
 		digest := GetDigestFromPath(cacheKey)
@@ -488,6 +714,13 @@ func (cm *CacheManager) Put(cacheKey string, entry *CacheEntry) error {
 			if err := cm.PutBlob(ctx, cacheKey, digest, reader, int64(len(entry.Data)), entry.Headers); err != nil {
 				return err
 			}
+			if cm.hot.Fits(int64(len(entry.Data))) {
+				cm.hot.Set("blob:"+digest, &CacheEntry{
+					Descriptor: Descriptor{Digest: digest, Size: int64(len(entry.Data)), MediaType: entry.Descriptor.MediaType},
+					Data:       entry.Data,
+					CachedAt:   time.Now(),
+				})
+			}
 		} else if digest != "" {
 			// 仅更新描述符缓存（无数据时）
 			cm.descriptorCache.Set(digest, entry.Descriptor)
@@ -507,7 +740,8 @@ func CacheKey(host, path string) string {
 }
 
 // ParsePath 解析路径，提取 repo 和 reference
-// 路径格式: host/v2/{repo}/manifests/{reference} 或 /v2/{repo}/blobs/{digest}
+// 路径格式: host/v2/{repo}/manifests/{reference}、/v2/{repo}/blobs/{digest}
+// 或 /v2/{repo}/referrers/{digest}（OCI 1.1 Referrers API）
 func ParsePath(path string) (pathType, repo, reference string) {
 	// 找到 /v2/ 的位置（cacheKey 可能包含 host 前缀）
 	idx := strings.Index(path, "/v2/")
@@ -533,6 +767,11 @@ func ParsePath(path string) (pathType, repo, reference string) {
 			reference = strings.Join(parts[i+1:], "/")
 			return "blob", repo, reference
 		}
+		if part == "referrers" && i+1 < len(parts) {
+			repo = strings.Join(parts[:i], "/")
+			reference = strings.Join(parts[i+1:], "/")
+			return "referrers", repo, reference
+		}
 	}
 
 	return "", "", ""
@@ -540,7 +779,25 @@ func ParsePath(path string) (pathType, repo, reference string) {
 
 // IsCacheable 判断路径是否可缓存
 func IsCacheable(path string) bool {
-	return strings.Contains(path, "/manifests/") || strings.Contains(path, "/blobs/sha256:")
+	return strings.Contains(path, "/manifests/") ||
+		strings.Contains(path, "/blobs/sha256:") ||
+		strings.Contains(path, "/referrers/sha256:")
+}
+
+// ReferrersCacheKey 生成 referrers 请求的缓存键
+// referrers 支持 artifactType 过滤，不同过滤条件的结果需要分别缓存
+func ReferrersCacheKey(host, path, artifactType string) string {
+	key := CacheKey(host, path)
+	if artifactType != "" {
+		key += "?artifactType=" + artifactType
+	}
+	return key
+}
+
+// referrersReference 将 referrers 的 digest 映射为 manifest 存储中的 reference
+// 前缀 "referrers/" 不会与 tag 或 digest 引用冲突
+func referrersReference(reference string) string {
+	return "referrers/" + reference
 }
 
 // GetDigestFromPath 从路径提取 digest
@@ -550,15 +807,15 @@ func GetDigestFromPath(path string) string {
 		// SHA256 digest 格式: sha256: (7 chars) + 64 hex chars = 71 chars total
 		const digestLength = 71
 		end := idx + digestLength
-		
+
 		// 检查是否有足够的字符来形成完整的 digest
 		if end > len(path) {
 			// 路径被截断，无法提取有效的 digest
 			return ""
 		}
-		
+
 		digest := path[idx:end]
-		
+
 		// 验证后缀是否都是十六进制字符
 		hashPart := digest[7:] // 跳过 "sha256:" 前缀
 		for _, c := range hashPart {
@@ -566,7 +823,7 @@ func GetDigestFromPath(path string) string {
 				return ""
 			}
 		}
-		
+
 		return digest
 	}
 	return ""
@@ -592,20 +849,9 @@ func (cm *CacheManager) cleanupLoop() {
 	}
 }
 
+// cleanup 定期回收：过期内容、超过 MaxSize 的最早 blob 与超出配额的 blob（手动回收正在执行时跳过）
 func (cm *CacheManager) cleanup() {
-	now := time.Now()
-
-	// 清理 manifest
-	cleaned := cm.manifestStore.Cleanup()
-
-	// 清理 blob（基于 LRU 和大小限制）
-	cleaned += cm.blobStore.Cleanup(cm.config.MaxSize)
-
-	cm.stats.LastCleanup = now
-
-	if cleaned > 0 && cm.config.Debug {
-		log.Printf("[Cache] Cleaned up %d expired items", cleaned)
-	}
+	cm.RunGC(cm.ctx, GCOptions{Trigger: "scheduled"})
 }
 
 func (cm *CacheManager) loadIndex() {
@@ -624,7 +870,7 @@ func (cm *CacheManager) loadIndex() {
 
 	if cm.config.Debug {
 		log.Printf("[Cache] Loaded index: %d blobs, %d manifests, %s total",
-			blobCount, manifestCount+manifestCount2, formatBytes(totalSize+manifestSize))
+			blobCount, manifestCount+manifestCount2, FormatBytes(totalSize+manifestSize))
 	}
 }
 
@@ -632,23 +878,38 @@ func (cm *CacheManager) loadIndex() {
 func (cm *CacheManager) Stats() map[string]interface{} {
 	stats := cm.stats.Snapshot()
 	stats["inflight"] = cm.inflight.Stats()
+	if cm.hot != nil {
+		stats["hotCache"] = cm.hot.Stats()
+	}
+	if quotas := cm.quotas.Load(); quotas != nil && len(*quotas) > 0 {
+		stats["quotas"] = cm.QuotaUsage()
+	}
 	return stats
 }
 
+// Statistics 返回缓存计数器
+func (cm *CacheManager) Statistics() *CacheStatistics {
+	return cm.stats
+}
+
 // =============================================================================
 // 错误定义
 // =============================================================================
 
 var (
-	ErrNotFound = fmt.Errorf("not found in cache")
-	ErrExpired  = fmt.Errorf("cache entry expired")
+	ErrNotFound       = fmt.Errorf("not found in cache")
+	ErrExpired        = fmt.Errorf("cache entry expired")
+	ErrDigestMismatch = fmt.Errorf("digest mismatch")
+
+	ErrBlobExists          = fmt.Errorf("blob already cached")
+	ErrBlobWriteInProgress = fmt.Errorf("blob is already being written")
 )
 
 // =============================================================================
 // 辅助函数
 // =============================================================================
 
-func formatBytes(bytes int64) string {
+func FormatBytes(bytes int64) string {
 	const unit = 1024
 	if bytes < unit {
 		return fmt.Sprintf("%d B", bytes)
@@ -0,0 +1,400 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"log"
+	"math"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+)
+
+// =============================================================================
+// LRU Descriptor Cache - 内存层描述符缓存
+// =============================================================================
+
+// LRUDescriptorCache 使用 LRU 算法的描述符缓存
+type LRUDescriptorCache struct {
+	cache *expirable.LRU[string, Descriptor]
+	mu    sync.RWMutex
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// NewLRUDescriptorCache 创建 LRU 描述符缓存
+func NewLRUDescriptorCache(maxSize int) *LRUDescriptorCache {
+	if maxSize <= 0 {
+		maxSize = 10000
+	}
+
+	cache := expirable.NewLRU[string, Descriptor](maxSize, nil, 24*time.Hour)
+
+	return &LRUDescriptorCache{
+		cache: cache,
+	}
+}
+
+// Get 获取描述符
+func (c *LRUDescriptorCache) Get(key string) (Descriptor, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	desc, ok := c.cache.Get(key)
+	if ok {
+		c.hits.Add(1)
+		return desc, true
+	}
+	c.misses.Add(1)
+	return Descriptor{}, false
+}
+
+// Set 设置描述符
+func (c *LRUDescriptorCache) Set(key string, desc Descriptor) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cache.Add(key, desc)
+}
+
+// Delete 删除描述符
+func (c *LRUDescriptorCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cache.Remove(key)
+}
+
+// Stats 获取统计信息
+func (c *LRUDescriptorCache) Stats() map[string]interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	hits := c.hits.Load()
+	misses := c.misses.Load()
+	total := hits + misses
+	hitRate := float64(0)
+	if total > 0 {
+		hitRate = float64(hits) / float64(total) * 100
+	}
+
+	return map[string]interface{}{
+		"size":    c.cache.Len(),
+		"hits":    hits,
+		"misses":  misses,
+		"hitRate": hitRate,
+	}
+}
+
+// =============================================================================
+// Inflight Manager - 请求去重
+// =============================================================================
+
+// InflightManager 管理正在进行的请求，防止重复请求上游
+type InflightManager struct {
+	mu       sync.Mutex
+	inflight map[string]*inflightEntry
+
+	totalRequests atomic.Int64
+	deduplicated  atomic.Int64
+}
+
+type inflightEntry struct {
+	done     chan struct{}
+	err      error
+	watchers int
+	started  time.Time
+}
+
+// NewInflightManager 创建请求去重管理器
+func NewInflightManager() *InflightManager {
+	return &InflightManager{
+		inflight: make(map[string]*inflightEntry),
+	}
+}
+
+// TryStart 尝试开始一个请求
+// 返回值：
+//   - isFirst: 是否是第一个请求者
+//   - wait: 等待函数（非第一个请求者使用）
+//   - done: 完成函数（第一个请求者完成后调用）
+func (m *InflightManager) TryStart(key string) (isFirst bool, wait func(ctx context.Context) error, done func(err error)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.totalRequests.Add(1)
+
+	// 检查是否已有请求
+	if entry, exists := m.inflight[key]; exists {
+		entry.watchers++
+		m.deduplicated.Add(1)
+
+		return false, func(ctx context.Context) error {
+			select {
+			case <-entry.done:
+				// 成功完成，减少 watchers 计数
+				m.mu.Lock()
+				entry.watchers--
+				m.mu.Unlock()
+				return entry.err
+			case <-ctx.Done():
+				m.mu.Lock()
+				entry.watchers--
+				m.mu.Unlock()
+				return ctx.Err()
+			}
+		}, nil
+	}
+
+	// 创建新条目
+	entry := &inflightEntry{
+		done:     make(chan struct{}),
+		watchers: 0,
+		started:  time.Now(),
+	}
+	m.inflight[key] = entry
+
+	return true, nil, func(err error) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		entry.err = err
+		close(entry.done)
+		delete(m.inflight, key)
+	}
+}
+
+// Stats 获取统计信息
+func (m *InflightManager) Stats() map[string]interface{} {
+	m.mu.Lock()
+	activeKeys := make([]string, 0, len(m.inflight))
+	for key := range m.inflight {
+		activeKeys = append(activeKeys, key)
+	}
+	m.mu.Unlock()
+
+	totalReqs := m.totalRequests.Load()
+	dedup := m.deduplicated.Load()
+
+	savingsRate := float64(0)
+	if totalReqs > 0 {
+		savingsRate = float64(dedup) / float64(totalReqs) * 100
+	}
+
+	return map[string]interface{}{
+		"totalRequests": totalReqs,
+		"deduplicated":  dedup,
+		"savingsRate":   savingsRate,
+		"currentActive": len(m.inflight),
+		"activeKeys":    activeKeys,
+	}
+}
+
+// =============================================================================
+// Hot Cache - 小对象内存缓存（manifest、小 blob），按总字节数限制并 LRU 淘汰
+// =============================================================================
+
+// hotItemOverhead 每个条目的估算额外开销（响应头、索引等）
+const hotItemOverhead = 512
+
+// HotCache 按字节预算淘汰的 LRU 缓存，nil 表示不启用
+type HotCache struct {
+	mu      sync.Mutex
+	budget  int64
+	maxItem int64
+	used    int64
+	ll      *list.List
+	items   map[string]*list.Element
+
+	hits      atomic.Int64
+	misses    atomic.Int64
+	evictions atomic.Int64
+}
+
+type hotItem struct {
+	key   string
+	entry *CacheEntry
+	size  int64
+}
+
+// NewHotCache 创建内存缓存，budget <= 0 时返回 nil
+func NewHotCache(budget, maxItem int64) *HotCache {
+	if budget <= 0 {
+		return nil
+	}
+	if maxItem <= 0 || maxItem > budget {
+		maxItem = budget
+	}
+	return &HotCache{
+		budget:  budget,
+		maxItem: maxItem,
+		ll:      list.New(),
+		items:   make(map[string]*list.Element),
+	}
+}
+
+// Fits 判断该大小的对象是否适合放入内存缓存
+func (c *HotCache) Fits(size int64) bool {
+	return c != nil && size >= 0 && size <= c.maxItem
+}
+
+// Get 获取条目，已过期的条目会被移除
+func (c *HotCache) Get(key string) (*CacheEntry, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		c.misses.Add(1)
+		return nil, false
+	}
+	item := elem.Value.(*hotItem)
+	if !item.entry.ExpiresAt.IsZero() && time.Now().After(item.entry.ExpiresAt) {
+		c.removeElement(elem)
+		c.misses.Add(1)
+		return nil, false
+	}
+	c.ll.MoveToFront(elem)
+	c.hits.Add(1)
+	return item.entry, true
+}
+
+// Set 写入条目，超过单条上限的对象不缓存
+func (c *HotCache) Set(key string, entry *CacheEntry) {
+	if c == nil {
+		return
+	}
+	size := int64(len(entry.Data)) + hotItemOverhead
+	if size > c.maxItem+hotItemOverhead {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.removeElement(elem)
+	}
+	c.items[key] = c.ll.PushFront(&hotItem{key: key, entry: entry, size: size})
+	c.used += size
+	c.evict(c.budget)
+}
+
+// Delete 删除条目
+func (c *HotCache) Delete(key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.items[key]; ok {
+		c.removeElement(elem)
+	}
+}
+
+// DeleteExpired 移除所有已过期的条目
+func (c *HotCache) DeleteExpired() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	removed := 0
+	for elem := c.ll.Back(); elem != nil; {
+		prev := elem.Prev()
+		if expires := elem.Value.(*hotItem).entry.ExpiresAt; !expires.IsZero() && now.After(expires) {
+			c.removeElement(elem)
+			removed++
+		}
+		elem = prev
+	}
+	return removed
+}
+
+// Shrink 内存紧张时淘汰到当前占用的 fraction 以下
+func (c *HotCache) Shrink(fraction float64) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.evict(int64(float64(c.used) * fraction))
+}
+
+func (c *HotCache) evict(target int64) {
+	for c.used > target {
+		elem := c.ll.Back()
+		if elem == nil {
+			return
+		}
+		c.removeElement(elem)
+		c.evictions.Add(1)
+	}
+}
+
+func (c *HotCache) removeElement(elem *list.Element) {
+	item := elem.Value.(*hotItem)
+	c.ll.Remove(elem)
+	delete(c.items, item.key)
+	c.used -= item.size
+}
+
+// Stats 获取统计信息
+func (c *HotCache) Stats() map[string]interface{} {
+	c.mu.Lock()
+	used, count := c.used, c.ll.Len()
+	c.mu.Unlock()
+
+	hits := c.hits.Load()
+	misses := c.misses.Load()
+	hitRate := float64(0)
+	if total := hits + misses; total > 0 {
+		hitRate = float64(hits) / float64(total) * 100
+	}
+
+	return map[string]interface{}{
+		"items":     count,
+		"used":      FormatBytes(used),
+		"budget":    FormatBytes(c.budget),
+		"hits":      hits,
+		"misses":    misses,
+		"hitRate":   hitRate,
+		"evictions": c.evictions.Load(),
+	}
+}
+
+// memoryPressureLoop 定期检查堆内存，接近 GOMEMLIMIT 时收缩内存缓存
+func (c *HotCache) memoryPressureLoop(ctx context.Context, interval time.Duration) {
+	limit := debug.SetMemoryLimit(-1)
+	if c == nil || limit == math.MaxInt64 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var stats runtime.MemStats
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			runtime.ReadMemStats(&stats)
+			if float64(stats.HeapAlloc) > float64(limit)*0.9 {
+				c.Shrink(0.5)
+				log.Printf("[Cache] Heap %s near memory limit %s, shrinking hot cache",
+					FormatBytes(int64(stats.HeapAlloc)), FormatBytes(limit))
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package cache
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestHotCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	item := func() *CacheEntry { return &CacheEntry{Data: bytes.Repeat([]byte("x"), 100)} }
+	c := NewHotCache(3*(100+hotItemOverhead), 200)
+
+	c.Set("a", item())
+	c.Set("b", item())
+	c.Set("c", item())
+	c.Get("a")
+	c.Set("d", item())
+	for key, want := range map[string]bool{"a": true, "b": false, "c": true, "d": true} {
+		if _, ok := c.Get(key); ok != want {
+			t.Errorf("Get(%s) found = %v, want %v", key, ok, want)
+		}
+	}
+
+	// 超过单条上限的对象不缓存
+	if c.Fits(300) {
+		t.Error("Fits(300) with a 200 byte item limit")
+	}
+	c.Set("large", &CacheEntry{Data: bytes.Repeat([]byte("x"), 300)})
+	if _, ok := c.Get("large"); ok {
+		t.Error("cached an item over the size limit")
+	}
+
+	c.Shrink(0.5)
+	if items := c.Stats()["items"]; items != 1 {
+		t.Errorf("items after Shrink(0.5) = %v, want 1", items)
+	}
+}
+
+func TestHotCacheExpiry(t *testing.T) {
+	c := NewHotCache(1<<20, 0)
+	c.Set("expired", &CacheEntry{Data: []byte("old"), ExpiresAt: time.Now().Add(-time.Second)})
+	c.Set("stale", &CacheEntry{Data: []byte("old"), ExpiresAt: time.Now().Add(-time.Second)})
+	c.Set("fresh", &CacheEntry{Data: []byte("new"), ExpiresAt: time.Now().Add(time.Hour)})
+
+	if _, ok := c.Get("expired"); ok {
+		t.Error("Get returned an expired entry")
+	}
+	if removed := c.DeleteExpired(); removed != 1 {
+		t.Errorf("DeleteExpired removed %d entries, want 1", removed)
+	}
+	if _, ok := c.Get("fresh"); !ok {
+		t.Error("fresh entry missing")
+	}
+	if NewHotCache(0, 0) != nil {
+		t.Error("NewHotCache(0) enabled the cache")
+	}
+}
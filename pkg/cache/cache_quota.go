@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"context"
+	"log"
+	"path"
+	"sort"
+	"strings"
+)
+
+// =============================================================================
+// 按仓库配额 - 限制匹配仓库的 blob 占用空间，超出时只淘汰这些仓库最早缓存的 blob
+// =============================================================================
+
+// Quota 仓库配额
+type Quota struct {
+	Pattern string // 仓库匹配模式：以 /* 结尾时匹配该命名空间下任意层级的仓库，否则按 path.Match 匹配
+	MaxSize int64  // 最大占用字节数
+}
+
+// Match 仓库是否属于该配额
+func (q Quota) Match(repo string) bool {
+	if prefix, ok := strings.CutSuffix(q.Pattern, "/*"); ok {
+		return strings.HasPrefix(repo, prefix+"/")
+	}
+	matched, _ := path.Match(q.Pattern, repo)
+	return matched
+}
+
+// SetQuotas 修改仓库配额，下次写入或清理时生效
+func (cm *CacheManager) SetQuotas(quotas []Quota) {
+	cm.quotas.Store(&quotas)
+}
+
+// quotaFor 返回仓库匹配的第一个配额
+func (cm *CacheManager) quotaFor(repo string) (Quota, bool) {
+	if quotas := cm.quotas.Load(); quotas != nil && repo != "" {
+		for _, q := range *quotas {
+			if q.Match(repo) {
+				return q, true
+			}
+		}
+	}
+	return Quota{}, false
+}
+
+// QuotaUsage 返回各配额当前占用的字节数（按配置顺序，blob 计入其仓库匹配的第一个配额）
+func (cm *CacheManager) QuotaUsage() map[string]int64 {
+	usage := make(map[string]int64)
+	quotas := cm.quotas.Load()
+	if quotas == nil {
+		return usage
+	}
+	for _, q := range *quotas {
+		usage[q.Pattern] = 0
+	}
+	cm.blobStore.mu.RLock()
+	defer cm.blobStore.mu.RUnlock()
+	for _, meta := range cm.blobStore.index {
+		if q, ok := cm.quotaFor(meta.Repo); ok {
+			usage[q.Pattern] += meta.Size
+		}
+	}
+	return usage
+}
+
+// enforceQuota 配额超出时按缓存时间淘汰该配额内最早的 blob
+func (cm *CacheManager) enforceQuota(q Quota) int {
+	var blobs []*BlobMeta
+	var total int64
+	cm.blobStore.mu.RLock()
+	for _, meta := range cm.blobStore.index {
+		if owner, ok := cm.quotaFor(meta.Repo); ok && owner.Pattern == q.Pattern {
+			blobs = append(blobs, meta)
+			total += meta.Size
+		}
+	}
+	cm.blobStore.mu.RUnlock()
+	if total <= q.MaxSize {
+		return 0
+	}
+
+	sort.Slice(blobs, func(i, j int) bool {
+		return blobs[i].CachedAt.Before(blobs[j].CachedAt)
+	})
+	evicted := 0
+	for _, meta := range blobs {
+		if total <= q.MaxSize {
+			break
+		}
+		cm.blobStore.Delete(context.Background(), meta.Digest)
+		cm.descriptorCache.Delete(meta.Digest)
+		cm.hot.Delete("blob:" + meta.Digest)
+		total -= meta.Size
+		evicted++
+	}
+	if cm.config.Debug {
+		log.Printf("[Cache] Quota %s exceeded, evicted %d blobs (%s remaining of %s)",
+			q.Pattern, evicted, FormatBytes(total), FormatBytes(q.MaxSize))
+	}
+	return evicted
+}
@@ -0,0 +1,779 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// =============================================================================
+// FileBlobStore - 文件系统 Blob 存储
+// =============================================================================
+
+// FileBlobStore 基于文件系统的 blob 存储
+type FileBlobStore struct {
+	dir      string
+	ttl      atomic.Int64 // time.Duration，可通过 SetTTL 热更新
+	compress bool         // gzip 压缩 .meta 文件
+	cipher   *Cipher      // 加密 blob 文件（nil 表示不加密）
+	fsync    bool         // 提交前将数据、元数据与目录刷到磁盘
+	openedAt time.Time    // 早于该时间的临时文件与孤立文件在加载索引时清理
+
+	mu      sync.RWMutex
+	index   map[string]*BlobMeta     // digest -> metadata
+	writing map[string]chan struct{} // digest -> 正在写入，写入结束时关闭
+}
+
+type BlobMeta struct {
+	Digest    string    `json:"digest"`
+	Size      int64     `json:"size"`
+	MediaType string    `json:"mediaType"`
+	CachedAt  time.Time `json:"cachedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	FilePath  string    `json:"filePath"`
+	Repo      string    `json:"repo,omitempty"` // 首次缓存该 blob 的仓库，用于按仓库配额
+}
+
+// NewFileBlobStore 创建 blob 存储
+func NewFileBlobStore(dir string, ttl time.Duration) *FileBlobStore {
+	s := &FileBlobStore{
+		dir:      dir,
+		index:    make(map[string]*BlobMeta),
+		writing:  make(map[string]chan struct{}),
+		openedAt: time.Now(),
+	}
+	s.ttl.Store(int64(ttl))
+	return s
+}
+
+// Stat 检查 blob 是否存在
+func (s *FileBlobStore) Stat(ctx context.Context, digest string) (Descriptor, error) {
+	s.mu.RLock()
+	meta, ok := s.index[digest]
+	s.mu.RUnlock()
+
+	if ok && time.Now().Before(meta.ExpiresAt) {
+		return Descriptor{
+			Digest:    meta.Digest,
+			Size:      meta.Size,
+			MediaType: meta.MediaType,
+		}, nil
+	}
+
+	// 尝试从文件加载
+	path := s.getPath(digest)
+	metaPath := path + ".meta"
+
+	metaBytes, err := ReadMetadataFile(metaPath)
+	if err != nil {
+		return Descriptor{}, ErrNotFound
+	}
+
+	var fileMeta BlobMeta
+	if err := json.Unmarshal(metaBytes, &fileMeta); err != nil {
+		os.Remove(path)
+		os.Remove(metaPath)
+		return Descriptor{}, ErrNotFound
+	}
+
+	if time.Now().After(fileMeta.ExpiresAt) {
+		os.Remove(path)
+		os.Remove(metaPath)
+		return Descriptor{}, ErrExpired
+	}
+
+	// 更新索引
+	s.mu.Lock()
+	s.index[digest] = &fileMeta
+	s.mu.Unlock()
+
+	return Descriptor{
+		Digest:    fileMeta.Digest,
+		Size:      fileMeta.Size,
+		MediaType: fileMeta.MediaType,
+	}, nil
+}
+
+// Get 获取 blob 内容
+func (s *FileBlobStore) Get(ctx context.Context, digest string) (io.ReadCloser, error) {
+	// 先检查是否存在
+	if _, err := s.Stat(ctx, digest); err != nil {
+		return nil, err
+	}
+
+	reader, err := s.Open(digest)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	return reader, nil
+}
+
+// SetCipher 设置 blob 文件的加解密器（nil 表示不加密），对之后的读写生效
+func (s *FileBlobStore) SetCipher(c *Cipher) {
+	s.cipher = c
+}
+
+// Open 打开 blob 文件读取明文内容，不检查有效期；加密的文件透明解密
+func (s *FileBlobStore) Open(digest string) (io.ReadSeekCloser, error) {
+	return s.OpenPath(s.getPath(digest))
+}
+
+// OpenPath 打开指定路径的 blob 文件读取明文内容
+func (s *FileBlobStore) OpenPath(path string) (io.ReadSeekCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, len(encryptedMagic))
+	if n, _ := io.ReadFull(file, header); !isEncrypted(header[:n]) {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			file.Close()
+			return nil, err
+		}
+		return file, nil
+	}
+	if s.cipher == nil {
+		file.Close()
+		return nil, ErrEncrypted
+	}
+	reader, err := s.cipher.openEncryptedFile(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return reader, nil
+}
+
+// Put 存储 blob，已存在时不再写入；同一 digest 正在写入时等待其完成
+func (s *FileBlobStore) Put(ctx context.Context, digest string, content io.Reader, size int64) error {
+	bw, err := s.writerWait(ctx, digest)
+	if errors.Is(err, ErrBlobExists) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(bw, content); err != nil {
+		bw.Cancel()
+		return fmt.Errorf("failed to write content: %w", err)
+	}
+	return bw.Commit(-1)
+}
+
+// BlobWriter 流式写入 blob：内容先写入同目录的临时文件并计算 sha256，
+// Commit 校验 digest 与大小后原子地移入存储，校验失败或 Cancel 时删除临时文件，
+// 传输中断或被截断的内容不会进入缓存
+type BlobWriter struct {
+	store    *FileBlobStore
+	digest   string
+	path     string
+	file     *os.File
+	buf      *bufio.Writer
+	enc      *encryptWriter // 启用加密时位于 buf 与 file 之间
+	hasher   hash.Hash
+	size     int64
+	ttl      time.Duration // 0 表示使用存储的默认 TTL
+	repo     string
+	done     bool
+	onCommit func(*BlobMeta)
+}
+
+// Writer 为 digest 创建流式写入器，调用方必须调用 Commit 或 Cancel。
+// 同一 digest 同时只允许一个写入器：blob 已缓存且未过期时返回 ErrBlobExists，
+// 另一个写入器尚未结束时返回 ErrBlobWriteInProgress，避免重复写入与提交时互相覆盖
+func (s *FileBlobStore) Writer(digest string) (*BlobWriter, error) {
+	if !s.claimWrite(digest) {
+		return nil, ErrBlobWriteInProgress
+	}
+	path := s.getPath(digest)
+	if s.exists(digest, path) {
+		s.releaseWrite(digest)
+		return nil, ErrBlobExists
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		s.releaseWrite(digest)
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	// 使用临时文件写入
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), tempBlobPrefix+"*")
+	if err != nil {
+		s.releaseWrite(digest)
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	bw := &BlobWriter{
+		store:  s,
+		digest: digest,
+		path:   path,
+		file:   tmpFile,
+		buf:    bufio.NewWriterSize(tmpFile, 256*1024), // 使用缓冲写入
+		hasher: sha256.New(),
+	}
+	if s.cipher != nil {
+		if bw.enc, err = s.cipher.newEncryptWriter(tmpFile); err != nil {
+			bw.Cancel()
+			return nil, fmt.Errorf("failed to start encrypted write: %w", err)
+		}
+		bw.buf.Reset(bw.enc)
+	}
+	return bw, nil
+}
+
+// writerWait 与 Writer 相同，但同一 digest 正在写入时等待其结束后重试
+func (s *FileBlobStore) writerWait(ctx context.Context, digest string) (*BlobWriter, error) {
+	for {
+		bw, err := s.Writer(digest)
+		if !errors.Is(err, ErrBlobWriteInProgress) {
+			return bw, err
+		}
+		s.mu.RLock()
+		done, ok := s.writing[digest]
+		s.mu.RUnlock()
+		if !ok {
+			continue
+		}
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// claimWrite 登记 digest 正在写入，已有写入器时返回 false
+func (s *FileBlobStore) claimWrite(digest string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, busy := s.writing[digest]; busy {
+		return false
+	}
+	s.writing[digest] = make(chan struct{})
+	return true
+}
+
+// releaseWrite 结束 digest 的写入并唤醒等待者
+func (s *FileBlobStore) releaseWrite(digest string) {
+	s.mu.Lock()
+	if done, ok := s.writing[digest]; ok {
+		close(done)
+		delete(s.writing, digest)
+	}
+	s.mu.Unlock()
+}
+
+// exists blob 是否已缓存且未过期（索引中存在且数据文件仍在磁盘上）
+func (s *FileBlobStore) exists(digest, path string) bool {
+	s.mu.RLock()
+	meta, ok := s.index[digest]
+	s.mu.RUnlock()
+	if !ok || !time.Now().Before(meta.ExpiresAt) {
+		return false
+	}
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Write 写入内容并同时计算哈希
+func (bw *BlobWriter) Write(p []byte) (int, error) {
+	n, err := bw.buf.Write(p)
+	bw.hasher.Write(p[:n])
+	bw.size += int64(n)
+	return n, err
+}
+
+// Size 已写入的字节数
+func (bw *BlobWriter) Size() int64 {
+	return bw.size
+}
+
+// SetTTL 指定提交后的有效期（如按上游响应头计算的值）
+func (bw *BlobWriter) SetTTL(ttl time.Duration) {
+	bw.ttl = ttl
+}
+
+// SetRepo 记录 blob 所属的仓库，用于按仓库配额
+func (bw *BlobWriter) SetRepo(repo string) {
+	bw.repo = repo
+}
+
+// Cancel 放弃写入并删除临时文件，可重复调用
+func (bw *BlobWriter) Cancel() {
+	if bw.done {
+		return
+	}
+	bw.done = true
+	bw.file.Close()
+	os.Remove(bw.file.Name())
+	bw.store.releaseWrite(bw.digest)
+}
+
+// Commit 校验 digest（expectedSize >= 0 时同时校验大小）后移入最终位置并保存元数据
+func (bw *BlobWriter) Commit(expectedSize int64) error {
+	if bw.done {
+		return fmt.Errorf("blob writer already closed")
+	}
+	defer bw.Cancel()
+	tmpPath := bw.file.Name()
+
+	if err := bw.buf.Flush(); err != nil {
+		return fmt.Errorf("failed to flush: %w", err)
+	}
+	if bw.enc != nil {
+		if err := bw.enc.Close(); err != nil {
+			return fmt.Errorf("failed to flush: %w", err)
+		}
+	}
+	if bw.store.fsync {
+		if err := bw.file.Sync(); err != nil {
+			return fmt.Errorf("failed to sync: %w", err)
+		}
+	}
+	if err := bw.file.Close(); err != nil {
+		return fmt.Errorf("failed to close: %w", err)
+	}
+
+	// 验证大小与哈希
+	if expectedSize >= 0 && bw.size != expectedSize {
+		return fmt.Errorf("size mismatch: expected %d, got %d", expectedSize, bw.size)
+	}
+	actualHash := "sha256:" + hex.EncodeToString(bw.hasher.Sum(nil))
+	if bw.digest != "" && bw.digest != actualHash {
+		return fmt.Errorf("%w: expected %s, got %s", ErrDigestMismatch, bw.digest, actualHash)
+	}
+
+	// 移动到最终位置；先提交数据再写入元数据，崩溃时最多留下没有 .meta 的数据文件（启动时清理）
+	path := bw.path
+	if err := os.Rename(tmpPath, path); err != nil {
+		// 可能跨文件系统，尝试复制
+		if err := copyFile(tmpPath, path); err != nil {
+			return fmt.Errorf("failed to move file: %w", err)
+		}
+	}
+	if bw.store.fsync {
+		if err := syncDir(filepath.Dir(path)); err != nil {
+			_ = os.Remove(path)
+			return err
+		}
+	}
+
+	// 保存元数据
+	ttl := bw.ttl
+	if ttl <= 0 {
+		ttl = bw.store.TTL()
+	}
+	now := time.Now()
+	meta := &BlobMeta{
+		Digest:    bw.digest,
+		Size:      bw.size,
+		CachedAt:  now,
+		ExpiresAt: now.Add(ttl),
+		FilePath:  path,
+		Repo:      bw.repo,
+	}
+
+	metaBytes, err := json.Marshal(meta)
+	if err != nil {
+		// 元数据序列化失败，删除数据文件以避免产生孤立文件
+		_ = os.Remove(path)
+		return fmt.Errorf("failed to marshal blob metadata: %w", err)
+	}
+
+	if err := writeFileAtomic(path+".meta", encodeMetadata(metaBytes, bw.store.compress), tempMetaPrefix, bw.store.fsync); err != nil {
+		// 元数据保存失败视为致命错误，删除数据文件以避免产生孤立文件
+		_ = os.Remove(path)
+		return fmt.Errorf("failed to save blob metadata: %w", err)
+	}
+
+	// 更新索引
+	bw.store.mu.Lock()
+	bw.store.index[bw.digest] = meta
+	bw.store.mu.Unlock()
+
+	if bw.onCommit != nil {
+		bw.onCommit(meta)
+	}
+	return nil
+}
+
+// Delete 删除 blob
+func (s *FileBlobStore) Delete(ctx context.Context, digest string) error {
+	s.mu.Lock()
+	delete(s.index, digest)
+	s.mu.Unlock()
+
+	path := s.getPath(digest)
+	os.Remove(path)
+	os.Remove(path + ".meta")
+
+	return nil
+}
+
+// LoadIndex 加载现有缓存索引，同时清理打开存储之前留下的临时文件、
+// 没有 .meta 的数据文件与数据已不存在的 .meta
+func (s *FileBlobStore) LoadIndex() (count int64, manifestCount int64, totalSize int64) {
+	var reconciled reconcileStats
+	filepath.Walk(s.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// 记录错误但继续处理其他文件
+			fmt.Printf("Warning: error accessing path %s: %v\n", path, err)
+			return nil
+		}
+
+		if info.IsDir() {
+			return nil
+		}
+
+		if isTempFile(info.Name()) {
+			reconciled.remove(path, info, s.openedAt, &reconciled.tempFiles)
+			return nil
+		}
+		if !strings.HasSuffix(path, ".meta") {
+			if _, err := os.Stat(path + ".meta"); os.IsNotExist(err) {
+				reconciled.remove(path, info, s.openedAt, &reconciled.orphanBlobs)
+			}
+			return nil
+		}
+		if _, err := os.Stat(strings.TrimSuffix(path, ".meta")); os.IsNotExist(err) {
+			reconciled.remove(path, info, s.openedAt, &reconciled.orphanMetas)
+			return nil
+		}
+
+		metaBytes, err := ReadMetadataFile(path)
+		if err != nil {
+			fmt.Printf("Warning: failed to read metadata file %s: %v\n", path, err)
+			return nil
+		}
+
+		var meta BlobMeta
+		if err := json.Unmarshal(metaBytes, &meta); err != nil {
+			fmt.Printf("Warning: failed to unmarshal metadata file %s: %v\n", path, err)
+			return nil
+		}
+
+		// 检查是否过期
+		if time.Now().After(meta.ExpiresAt) {
+			dataPath := strings.TrimSuffix(path, ".meta")
+			os.Remove(path)
+			os.Remove(dataPath)
+			return nil
+		}
+
+		// 加入索引
+		s.mu.Lock()
+		s.index[meta.Digest] = &meta
+		s.mu.Unlock()
+
+		count++
+		totalSize += meta.Size
+
+		return nil
+	})
+	reconciled.log("blobs")
+
+	return count, 0, totalSize
+}
+
+// Digests 返回 since 之后缓存且未过期的 blob digest，since 为零值时返回全部
+func (s *FileBlobStore) Digests(since time.Time) []string {
+	now := time.Now()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	digests := make([]string, 0, len(s.index))
+	for digest, meta := range s.index {
+		if meta.CachedAt.After(since) && now.Before(meta.ExpiresAt) {
+			digests = append(digests, digest)
+		}
+	}
+	return digests
+}
+
+// getPath 获取 blob 文件路径
+// Dir 返回 blob 存储目录
+func (s *FileBlobStore) Dir() string {
+	return s.dir
+}
+
+// TTL 返回 blob 的缓存有效期
+func (s *FileBlobStore) TTL() time.Duration {
+	return time.Duration(s.ttl.Load())
+}
+
+// SetTTL 修改之后写入的 blob 的缓存有效期
+func (s *FileBlobStore) SetTTL(ttl time.Duration) {
+	s.ttl.Store(int64(ttl))
+}
+
+// Path 返回 blob 数据文件路径
+func (s *FileBlobStore) Path(digest string) string {
+	return s.getPath(digest)
+}
+
+func (s *FileBlobStore) getPath(digest string) string {
+	// 移除 sha256: 前缀
+	hash := strings.TrimPrefix(digest, "sha256:")
+
+	// 兜底保护：确保 hash 至少有 4 个字符，避免切片越界
+	// hashKey 总是返回 64 字符的 SHA256 哈希，但为了防御性编程保留此检查
+	if len(hash) < 4 {
+		sum := sha256.Sum256([]byte(digest))
+		hash = hex.EncodeToString(sum[:])
+	}
+
+	// 使用前 4 个字符分层
+	return filepath.Join(s.dir, hash[:2], hash[2:4], hash)
+}
+
+// =============================================================================
+// FileManifestStore - 文件系统 Manifest 存储
+// =============================================================================
+
+// FileManifestStore 基于文件系统的 manifest 存储
+type FileManifestStore struct {
+	dir       string
+	tagTTL    time.Duration
+	digestTTL time.Duration
+
+	hot      *HotCache     // 内存缓存（未启用时为 nil，每次读取文件）
+	compress bool          // gzip 压缩 manifest 文件
+	cipher   *Cipher       // 加密 manifest 文件（nil 表示不加密）
+	staleTTL time.Duration // 过期后继续保留的时间，上游限流时可作为过期内容返回
+	fsync    bool          // 提交前将文件与目录刷到磁盘
+	openedAt time.Time     // 早于该时间的临时文件在加载索引时清理
+
+	access accessTracker // 最近访问时间（文件修改时间）
+}
+
+// NewFileManifestStore 创建 manifest 存储
+func NewFileManifestStore(dir string, tagTTL, digestTTL time.Duration, hot *HotCache) *FileManifestStore {
+	return &FileManifestStore{
+		dir:       dir,
+		tagTTL:    tagTTL,
+		digestTTL: digestTTL,
+		hot:       hot,
+		openedAt:  time.Now(),
+	}
+}
+
+// Get 获取 manifest
+func (s *FileManifestStore) Get(ctx context.Context, repo, reference string) (*CacheEntry, error) {
+	key := s.getKey(repo, reference)
+
+	// 先查内存缓存
+	if entry, ok := s.hot.Get("manifest:" + key); ok {
+		s.access.touch(s.getPath(repo, reference))
+		return entry, nil
+	}
+
+	// 从文件加载
+	path := s.getPath(repo, reference)
+	data, err := s.readFile(path)
+	if err != nil {
+		return nil, ErrNotFound
+	}
+
+	entry := &CacheEntry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		os.Remove(path)
+		return nil, ErrNotFound
+	}
+
+	if time.Now().After(entry.ExpiresAt) {
+		if s.pastStale(entry) {
+			os.Remove(path)
+		}
+		return nil, ErrExpired
+	}
+
+	// 更新内存缓存
+	s.hot.Set("manifest:"+key, entry)
+	s.access.touch(path)
+
+	return entry, nil
+}
+
+// GetStale 获取已过期但仍在保留期内的 manifest，不更新内存缓存
+func (s *FileManifestStore) GetStale(ctx context.Context, repo, reference string) (*CacheEntry, error) {
+	data, err := s.readFile(s.getPath(repo, reference))
+	if err != nil {
+		return nil, ErrNotFound
+	}
+	entry := &CacheEntry{}
+	if err := json.Unmarshal(data, entry); err != nil || s.pastStale(entry) {
+		return nil, ErrNotFound
+	}
+	return entry, nil
+}
+
+// pastStale 条目是否已超过过期后的保留期
+func (s *FileManifestStore) pastStale(entry *CacheEntry) bool {
+	return time.Now().After(entry.ExpiresAt.Add(s.staleTTL))
+}
+
+// Put 存储 manifest
+func (s *FileManifestStore) Put(ctx context.Context, repo, reference string, entry *CacheEntry) error {
+	key := s.getKey(repo, reference)
+	path := s.getPath(repo, reference)
+
+	// 确保目录存在
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	entry.Repo, entry.Reference = repo, reference
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal entry: %w", err)
+	}
+
+	data, err = s.cipher.seal(encodeMetadata(data, s.compress))
+	if err != nil {
+		return fmt.Errorf("failed to encrypt entry: %w", err)
+	}
+	if err := writeFileAtomic(path, data, tempManifestPrefix, s.fsync); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	// 更新内存缓存
+	s.hot.Set("manifest:"+key, entry)
+
+	return nil
+}
+
+// Delete 删除 manifest
+func (s *FileManifestStore) Delete(ctx context.Context, repo, reference string) error {
+	key := s.getKey(repo, reference)
+
+	s.hot.Delete("manifest:" + key)
+
+	path := s.getPath(repo, reference)
+	return os.Remove(path)
+}
+
+// Cleanup 清理过期缓存
+// 过期文件在下次读取或启动加载索引时删除，这里只释放内存缓存
+func (s *FileManifestStore) Cleanup() int {
+	s.access.prune()
+	return s.hot.DeleteExpired()
+}
+
+// Walk 遍历 manifest 文件（含过期但仍在保留期内的），返回文件的修改时间作为最近访问时间
+func (s *FileManifestStore) Walk(fn func(entry *CacheEntry, lastAccess time.Time)) {
+	filepath.Walk(s.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		data, err := s.readFile(path)
+		if err != nil {
+			return nil
+		}
+		var entry CacheEntry
+		if err := json.Unmarshal(data, &entry); err != nil || s.pastStale(&entry) {
+			return nil
+		}
+		fn(&entry, info.ModTime())
+		return nil
+	})
+}
+
+// LoadIndex 加载现有缓存索引，同时清理打开存储之前留下的临时文件
+func (s *FileManifestStore) LoadIndex() (count int64, totalSize int64) {
+	var reconciled reconcileStats
+	filepath.Walk(s.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return nil
+		}
+		if isTempFile(info.Name()) {
+			reconciled.remove(path, info, s.openedAt, &reconciled.tempFiles)
+			return nil
+		}
+
+		data, err := s.readFile(path)
+		if err != nil {
+			return nil
+		}
+
+		var entry CacheEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			os.Remove(path)
+			return nil
+		}
+
+		if time.Now().After(entry.ExpiresAt) {
+			if s.pastStale(&entry) {
+				os.Remove(path)
+			}
+			return nil
+		}
+
+		count++
+		totalSize += entry.Descriptor.Size
+
+		return nil
+	})
+	reconciled.log("manifests")
+
+	return count, totalSize
+}
+
+// readFile 读取 manifest 文件，按需解密与解压
+func (s *FileManifestStore) readFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = s.cipher.open(data); err != nil {
+		return nil, err
+	}
+	return decodeMetadata(data)
+}
+
+func (s *FileManifestStore) getKey(repo, reference string) string {
+	return repo + "/" + reference
+}
+
+func (s *FileManifestStore) getPath(repo, reference string) string {
+	// 使用哈希避免文件名问题
+	key := s.getKey(repo, reference)
+	hash := hashKey(key)
+	return filepath.Join(s.dir, hash[:2], hash[2:4], hash+".json")
+}
+
+// =============================================================================
+// 辅助函数
+// =============================================================================
+
+func hashKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+func copyFile(src, dst string) error {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	dstFile, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer dstFile.Close()
+
+	buf := make([]byte, 256*1024)
+	_, err = io.CopyBuffer(dstFile, srcFile, buf)
+	return err
+}
@@ -0,0 +1,182 @@
+package cache
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// =============================================================================
+// 缓存有效期 - 按上游 Cache-Control / Expires 计算，并按内容类别限制在配置范围内；
+// 可按路由域名指定固定有效期或不缓存
+// =============================================================================
+
+// 内容类别
+const (
+	ContentClassManifest = "manifest" // 按 tag 引用的 manifest，可能被上游更新
+	ContentClassBlob     = "blob"     // 按 digest 引用的不可变内容（blob 与按 digest 拉取的 manifest）
+)
+
+// TTLBounds 有效期上下限（Max 为 0 表示不限制）
+type TTLBounds struct {
+	Min time.Duration
+	Max time.Duration
+}
+
+// TTLPolicy 有效期计算策略
+type TTLPolicy struct {
+	HonorUpstream bool      // 是否采用上游响应头给出的有效期
+	Manifest      TTLBounds // ContentClassManifest 的上下限
+	Blob          TTLBounds // ContentClassBlob 的上下限
+
+	// 按路由域名（缓存键的 host 部分，不含端口）覆盖的有效期
+	Hosts map[string]TTLOverride
+}
+
+// TTLOverride 单个路由的固定有效期（0 表示沿用全局设置）
+type TTLOverride struct {
+	Manifest time.Duration
+	Blob     time.Duration
+	Disabled bool // 该路由的内容既不写入也不读取缓存
+}
+
+// ContentClass 根据缓存键判断内容类别
+func ContentClass(cacheKey string) string {
+	pathType, _, reference := ParsePath(cacheKey)
+	if pathType == "blob" || (pathType == "manifest" && strings.HasPrefix(reference, "sha256:")) {
+		return ContentClassBlob
+	}
+	return ContentClassManifest
+}
+
+// SetTTLPolicy 修改有效期计算策略，对之后写入的内容生效
+func (cm *CacheManager) SetTTLPolicy(policy TTLPolicy) {
+	cm.ttlPolicy.Store(&policy)
+}
+
+// TTLFor 计算缓存键对应内容的有效期：默认使用类别的 TTL，启用 HonorUpstream 时
+// 改用上游 Cache-Control（s-maxage / max-age / no-store / no-cache / private）或 Expires 给出的有效期，
+// immutable 视为可缓存到上限；结果限制在类别的上下限之内，返回 0 表示不应缓存。
+// 路由指定了该类别的固定有效期时直接使用，不再参考上游响应头与上下限；路由禁用缓存时返回 0
+func (cm *CacheManager) TTLFor(cacheKey string, header http.Header) time.Duration {
+	class := ContentClass(cacheKey)
+	ttl := cm.ManifestTTL()
+	if class == ContentClassBlob {
+		ttl = cm.blobStore.TTL()
+	}
+
+	policy := cm.ttlPolicy.Load()
+	if policy == nil {
+		return ttl
+	}
+	if override, ok := policy.hostOverride(cacheKey); ok {
+		switch {
+		case override.Disabled:
+			return 0
+		case class == ContentClassManifest && override.Manifest > 0:
+			return override.Manifest
+		case class == ContentClassBlob && override.Blob > 0:
+			return override.Blob
+		}
+	}
+	bounds := policy.Manifest
+	if class == ContentClassBlob {
+		bounds = policy.Blob
+	}
+
+	if policy.HonorUpstream {
+		if freshness, immutable, ok := upstreamFreshness(header, time.Now()); immutable {
+			if bounds.Max > 0 {
+				ttl = bounds.Max
+			}
+		} else if ok {
+			ttl = freshness
+		}
+	}
+
+	if ttl < bounds.Min {
+		ttl = bounds.Min
+	}
+	if bounds.Max > 0 && ttl > bounds.Max {
+		ttl = bounds.Max
+	}
+	if ttl < 0 {
+		ttl = 0
+	}
+	return ttl
+}
+
+// CachingDisabled 缓存键所属路由是否禁用了缓存
+func (cm *CacheManager) CachingDisabled(cacheKey string) bool {
+	policy := cm.ttlPolicy.Load()
+	if policy == nil {
+		return false
+	}
+	override, ok := policy.hostOverride(cacheKey)
+	return ok && override.Disabled
+}
+
+// hostOverride 查找缓存键所属路由的设置
+func (p *TTLPolicy) hostOverride(cacheKey string) (TTLOverride, bool) {
+	idx := strings.Index(cacheKey, "/v2/")
+	if len(p.Hosts) == 0 || idx <= 0 {
+		return TTLOverride{}, false
+	}
+	host := strings.ToLower(cacheKey[:idx])
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	override, ok := p.Hosts[host]
+	return override, ok
+}
+
+// upstreamFreshness 按 RFC 9111 共享缓存的规则解析响应头中的有效期
+func upstreamFreshness(header http.Header, now time.Time) (ttl time.Duration, immutable, ok bool) {
+	directives := make(map[string]string)
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+		}
+	}
+
+	for _, name := range []string{"no-store", "no-cache", "private"} {
+		if _, found := directives[name]; found {
+			return 0, false, true
+		}
+	}
+	if _, found := directives["immutable"]; found {
+		return 0, true, true
+	}
+
+	for _, name := range []string{"s-maxage", "max-age"} {
+		arg, found := directives[name]
+		if !found {
+			continue
+		}
+		seconds, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return 0, false, true // 无效值视为已过期
+		}
+		ttl = time.Duration(seconds) * time.Second
+		if age, err := strconv.ParseInt(header.Get("Age"), 10, 64); err == nil && age > 0 {
+			ttl -= time.Duration(age) * time.Second
+		}
+		return ttl, false, true
+	}
+
+	if value := header.Get("Expires"); value != "" {
+		expires, err := http.ParseTime(value)
+		if err != nil {
+			return 0, false, true // 无效日期（如 "0"）视为已过期
+		}
+		date, err := http.ParseTime(header.Get("Date"))
+		if err != nil {
+			date = now
+		}
+		return expires.Sub(date), false, true
+	}
+	return 0, false, false
+}
@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTTLForUpstreamCacheControl(t *testing.T) {
+	config := DefaultCacheConfig()
+	config.Dir = t.TempDir()
+	config.ManifestTTL = time.Hour
+	config.TTLPolicy = TTLPolicy{
+		HonorUpstream: true,
+		Manifest:      TTLBounds{Min: time.Minute, Max: 2 * time.Hour},
+		Blob:          TTLBounds{Max: 24 * time.Hour},
+	}
+	cm, err := NewCacheManager(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cm.Close()
+
+	manifest := "registry.test/v2/team/app/manifests/v1"
+	blob := "registry.test/v2/team/app/blobs/sha256:" + strings.Repeat("a", 64)
+	for _, tc := range []struct {
+		name   string
+		key    string
+		header http.Header
+		want   time.Duration
+	}{
+		{"no headers", manifest, http.Header{}, time.Hour},
+		{"max-age", manifest, http.Header{"Cache-Control": {"public, max-age=600"}}, 10 * time.Minute},
+		{"s-maxage wins", manifest, http.Header{"Cache-Control": {"max-age=600, s-maxage=1200"}}, 20 * time.Minute},
+		{"age subtracted", manifest, http.Header{"Cache-Control": {"max-age=600"}, "Age": {"300"}}, 5 * time.Minute},
+		{"clamped to max", manifest, http.Header{"Cache-Control": {"max-age=86400"}}, 2 * time.Hour},
+		{"clamped to min", manifest, http.Header{"Cache-Control": {"max-age=5"}}, time.Minute},
+		{"no-store", manifest, http.Header{"Cache-Control": {"no-store"}}, time.Minute},
+		{"private", manifest, http.Header{"Cache-Control": {"private, max-age=600"}}, time.Minute},
+		{"no-cache", manifest, http.Header{"Cache-Control": {"no-cache"}}, time.Minute},
+		{"invalid max-age", manifest, http.Header{"Cache-Control": {"max-age=soon"}}, time.Minute},
+		{"expires", manifest, http.Header{
+			"Date":    {"Mon, 01 Jan 2024 00:00:00 GMT"},
+			"Expires": {"Mon, 01 Jan 2024 00:30:00 GMT"},
+		}, 30 * time.Minute},
+		{"immutable blob", blob, http.Header{"Cache-Control": {"public, immutable"}}, 24 * time.Hour},
+		{"no-store blob without minimum", blob, http.Header{"Cache-Control": {"no-store"}}, 0},
+	} {
+		if got := cm.TTLFor(tc.key, tc.header); got != tc.want {
+			t.Errorf("%s: TTLFor = %s, want %s", tc.name, got, tc.want)
+		}
+	}
+
+	// 未启用 HonorUpstream 时忽略上游响应头，只按上下限收紧配置的 TTL
+	cm.SetTTLPolicy(TTLPolicy{Manifest: TTLBounds{Max: 30 * time.Minute}})
+	if got := cm.TTLFor(manifest, http.Header{"Cache-Control": {"no-store"}}); got != 30*time.Minute {
+		t.Errorf("without HonorUpstream: TTLFor = %s, want 30m", got)
+	}
+}
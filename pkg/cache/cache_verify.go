@@ -0,0 +1,62 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"math/rand/v2"
+)
+
+// =============================================================================
+// 读取校验 - 按比例在提供缓存 blob 前重新计算 sha256，损坏的文件自动删除
+// =============================================================================
+
+// shouldVerify 本次读取是否需要校验（VerifyRate: 0 不校验，1 每次校验，之间为抽查比例）
+func (cm *CacheManager) shouldVerify() bool {
+	rate := cm.config.VerifyRate
+	return rate >= 1 || (rate > 0 && rand.Float64() < rate)
+}
+
+// verifyData 校验内存中的 blob 内容
+func (cm *CacheManager) verifyData(desc Descriptor, data []byte) bool {
+	sum := sha256.Sum256(data)
+	return cm.checkDigest(desc, "sha256:"+hex.EncodeToString(sum[:]))
+}
+
+// verifyReader 校验可 Seek 的 blob 文件并回到开头；不可 Seek 时跳过校验
+func (cm *CacheManager) verifyReader(desc Descriptor, reader io.ReadCloser) (io.ReadCloser, error) {
+	seeker, ok := reader.(io.ReadSeeker)
+	if !ok {
+		return reader, nil
+	}
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, seeker); err != nil {
+		reader.Close()
+		return nil, err
+	}
+	if !cm.checkDigest(desc, "sha256:"+hex.EncodeToString(hasher.Sum(nil))) {
+		reader.Close()
+		return nil, ErrNotFound
+	}
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		reader.Close()
+		return nil, err
+	}
+	return reader, nil
+}
+
+// checkDigest 比较实际哈希，不一致时计数并删除损坏的 blob，调用方按未命中处理并回源重新缓存
+func (cm *CacheManager) checkDigest(desc Descriptor, actual string) bool {
+	cm.stats.BlobVerified.Add(1)
+	if actual == desc.Digest {
+		return true
+	}
+	cm.stats.BlobCorrupted.Add(1)
+	log.Printf("Cached blob %s is corrupted (actual %s), evicting", desc.Digest, actual)
+	cm.blobStore.Delete(context.Background(), desc.Digest)
+	cm.descriptorCache.Delete(desc.Digest)
+	cm.hot.Delete("blob:" + desc.Digest)
+	return false
+}
@@ -0,0 +1,248 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// =============================================================================
+// 访问日志 - 与 middleware.Logger 相同的格式，按 ACCESS_LOG_SAMPLE 抽样记录常规请求；
+// 5xx、429 与超过 SLOW_REQUEST_THRESHOLD 的请求始终记录，慢请求另外输出耗时分解。
+// TIMING_HEADER 启用时通过 X-Proxy-Timing 响应头（及 trailer）返回各阶段耗时
+// =============================================================================
+
+// headerProxyTiming 各阶段耗时，格式与 Server-Timing 相同：route;dur=0.1, cache;dur=0.3, ...（毫秒）
+const headerProxyTiming = "X-Proxy-Timing"
+
+// 耗时阶段
+const (
+	PhaseRoute      = "route"       // 进入处理器前的中间件（不含认证）
+	PhaseAuth       = "auth"        // 客户端凭据校验与上游 token 获取
+	PhaseCache      = "cache"       // 缓存查找
+	PhaseUpstream   = "upstream"    // 等待上游响应头（含重试）
+	PhaseTransfer   = "transfer"    // 首字节到响应结束
+	PhaseCacheWrite = "cache_write" // 传输过程中写入缓存与提交
+)
+
+// requestTiming 单个客户端请求的耗时记录，经 context 传给上游请求
+type requestTiming struct {
+	start  time.Time
+	header bool // 返回 X-Proxy-Timing
+
+	mu            sync.Mutex
+	firstByte     time.Time     // 开始向客户端写响应的时间
+	upstreamWait  time.Duration // 等待上游响应头的累计时间（含重试）
+	upstreamCalls int
+	phases        map[string]time.Duration
+}
+
+type requestTimingKey struct{}
+
+// timingFromContext 返回请求的耗时记录，不存在时返回 nil
+func timingFromContext(ctx context.Context) *requestTiming {
+	t, _ := ctx.Value(requestTimingKey{}).(*requestTiming)
+	return t
+}
+
+// addUpstream 记录一次上游请求（到收到响应头为止）的耗时
+func (t *requestTiming) addUpstream(d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.upstreamWait += d
+	t.upstreamCalls++
+	t.mu.Unlock()
+}
+
+// add 累加某个阶段的耗时
+func (t *requestTiming) add(phase string, d time.Duration) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	if t.phases == nil {
+		t.phases = make(map[string]time.Duration)
+	}
+	t.phases[phase] += d
+	t.mu.Unlock()
+}
+
+// markRouted 请求进入处理器，此前（除认证外）的耗时计为 route
+func (t *requestTiming) markRouted() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	route := time.Since(t.start) - t.phases[PhaseAuth]
+	t.mu.Unlock()
+	t.add(PhaseRoute, route)
+}
+
+// markFirstByte 记录首次写响应的时间，启用时写入 X-Proxy-Timing 响应头（到首字节为止的阶段）
+func (t *requestTiming) markFirstByte(header http.Header) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.firstByte.IsZero() {
+		return
+	}
+	t.firstByte = time.Now()
+	if t.header {
+		header.Set(headerProxyTiming, t.format(false))
+	}
+}
+
+// format 输出各阶段耗时，final 时包含传输、缓存写入与总耗时；调用方持有锁
+func (t *requestTiming) format(final bool) string {
+	phases := map[string]time.Duration{PhaseUpstream: t.upstreamWait}
+	for phase, d := range t.phases {
+		phases[phase] = d
+	}
+	order := []string{PhaseRoute, PhaseAuth, PhaseCache, PhaseUpstream}
+	if final {
+		if !t.firstByte.IsZero() {
+			phases[PhaseTransfer] = time.Since(t.firstByte)
+		}
+		order = append(order, PhaseTransfer, PhaseCacheWrite)
+	}
+	parts := make([]string, 0, len(order)+1)
+	for _, phase := range order {
+		if d, ok := phases[phase]; ok && (d > 0 || phase == PhaseRoute) {
+			parts = append(parts, fmt.Sprintf("%s;dur=%.1f", phase, float64(d.Microseconds())/1000))
+		}
+	}
+	if final {
+		parts = append(parts, fmt.Sprintf("total;dur=%.1f", float64(time.Since(t.start).Microseconds())/1000))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// timingWriter 记录首字节时间，并保留 Flush、Hijack 与 ReadFrom 能力
+type timingWriter struct {
+	http.ResponseWriter
+	timing *requestTiming
+}
+
+func (w *timingWriter) WriteHeader(status int) {
+	w.timing.markFirstByte(w.Header())
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *timingWriter) Write(b []byte) (int, error) {
+	w.timing.markFirstByte(w.Header())
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *timingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// ReadFrom 保留底层连接的 sendfile 零拷贝发送
+func (w *timingWriter) ReadFrom(src io.Reader) (int64, error) {
+	w.timing.markFirstByte(w.Header())
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		return rf.ReadFrom(src)
+	}
+	return io.Copy(w.ResponseWriter, src)
+}
+
+// Hijack 使外层的 middleware.NewWrapResponseWriter 选择同样支持 ReadFrom 的包装
+func (w *timingWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+func (w *timingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// accessLog 访问日志设置
+type accessLog struct {
+	formatter middleware.LogFormatter
+	sample    float64       // 常规请求的记录比例（1 全部记录）
+	slow      time.Duration // 慢请求阈值（0 不启用）
+	header    bool          // 返回 X-Proxy-Timing
+}
+
+// newAccessLog 按配置创建访问日志，格式与 middleware.Logger 相同
+func newAccessLog(config *Config) *accessLog {
+	sample := config.AccessLogSample
+	if sample < 0 || sample > 1 {
+		sample = 1
+	}
+	if sample < 1 {
+		log.Printf("Access log sampling: %.2f%% of routine requests (5xx, 429 and slow requests are always logged)", sample*100)
+	}
+	if config.SlowRequestThreshold > 0 {
+		log.Printf("Slow request logging enabled: threshold %s", config.SlowRequestThreshold)
+	}
+	return &accessLog{
+		formatter: &middleware.DefaultLogFormatter{Logger: log.New(os.Stdout, "", log.LstdFlags), NoColor: runtime.GOOS == "windows"},
+		sample:    sample,
+		slow:      config.SlowRequestThreshold,
+		header:    config.TimingHeader,
+	}
+}
+
+// middleware 记录访问日志；日志条目写入 context，middleware.Recoverer 通过它输出 panic
+func (l *accessLog) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timing := &requestTiming{start: time.Now(), header: l.header}
+		entry := l.formatter.NewLogEntry(r)
+		ww := middleware.NewWrapResponseWriter(&timingWriter{ResponseWriter: w, timing: timing}, r.ProtoMajor)
+
+		defer func() {
+			if l.header {
+				// 响应为分块传输（或 HTTP/2）时，完整的耗时分解作为 trailer 发送
+				timing.mu.Lock()
+				ww.Header().Set(http.TrailerPrefix+headerProxyTiming, timing.format(true))
+				timing.mu.Unlock()
+			}
+			elapsed := time.Since(timing.start)
+			status := ww.Status()
+			slow := l.slow > 0 && elapsed >= l.slow
+			if slow || status >= http.StatusInternalServerError || status == http.StatusTooManyRequests ||
+				l.sample >= 1 || rand.Float64() < l.sample {
+				entry.Write(status, ww.BytesWritten(), ww.Header(), elapsed, nil)
+			}
+			if slow {
+				l.logSlow(r, status, ww.BytesWritten(), elapsed, timing)
+			}
+		}()
+
+		ctx := context.WithValue(r.Context(), requestTimingKey{}, timing)
+		next.ServeHTTP(ww, middleware.WithLogEntry(r.WithContext(ctx), entry))
+	})
+}
+
+// logSlow 输出慢请求的客户端身份与耗时分解：等待上游响应头、首字节与传输
+func (l *accessLog) logSlow(r *http.Request, status, bytes int, elapsed time.Duration, t *requestTiming) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	firstByte, transfer := elapsed, time.Duration(0)
+	if !t.firstByte.IsZero() {
+		firstByte = t.firstByte.Sub(t.start)
+		transfer = elapsed - firstByte
+	}
+	log.Printf("[SLOW] [%s] %s %s%s from %s -> %d, %dB in %s (upstream wait %s over %d request(s), first byte %s, transfer %s; %s)",
+		middleware.GetReqID(r.Context()), r.Method, r.Host, r.URL.RequestURI(), clientIdentityOf(r), status, bytes,
+		elapsed.Round(time.Millisecond), t.upstreamWait.Round(time.Millisecond), t.upstreamCalls,
+		firstByte.Round(time.Millisecond), transfer.Round(time.Millisecond), t.format(true))
+}
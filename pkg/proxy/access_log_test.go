@@ -0,0 +1,126 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// lockedBuffer 可并发写入的日志缓冲
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestSlowRequestLogging(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	upstream.addImage("team/app", "v1", []byte("slow layer"))
+	p, client := newTestProxy(t, upstream, map[string]string{"SLOW_REQUEST_THRESHOLD": "150ms", "ACCESS_LOG_SAMPLE": "0"})
+	var accessLog, stdLog lockedBuffer
+	p.accessLog.formatter = &middleware.DefaultLogFormatter{Logger: log.New(&accessLog, "", 0), NoColor: true}
+	log.SetOutput(&stdLog)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	client.login("team/app")
+	upstream.configure(func(f *fakeRegistry) { f.manifestDelay = 200 * time.Millisecond })
+	client.pull("team/app", "v1")
+	upstream.configure(func(f *fakeRegistry) { f.manifestDelay = 0 })
+	resp, _ := client.do(http.MethodGet, "/v2/team/app/manifests/missing", nil)
+	resp.Body.Close()
+
+	// 常规请求不记录（抽样为 0），慢请求始终记录并输出耗时分解
+	lines := strings.Split(strings.TrimSpace(accessLog.String()), "\n")
+	if len(lines) != 1 || !strings.Contains(lines[0], "/v2/team/app/manifests/v1") {
+		t.Errorf("access log = %q, want only the slow manifest request", lines)
+	}
+	slow := stdLog.String()
+	if !strings.Contains(slow, "[SLOW]") || !strings.Contains(slow, "registry.test/v2/team/app/manifests/v1 from 127.0.0.1 -> 200") ||
+		!strings.Contains(slow, "over 1 request(s)") {
+		t.Errorf("slow log = %q", slow)
+	}
+}
+
+func TestTimingHeader(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	_, layers := upstream.addImage("team/app", "v1", []byte("timed layer"))
+	p, client := newTestProxy(t, upstream, map[string]string{"TIMING_HEADER": "true"})
+
+	client.login("team/app")
+	resp, _ := client.do(http.MethodGet, "/v2/team/app/manifests/v1", nil)
+	if timing := resp.Header.Get("X-Proxy-Timing"); !strings.HasPrefix(timing, "route;dur=") || !strings.Contains(timing, "upstream;dur=") {
+		t.Errorf("miss timing = %q", timing)
+	}
+	client.pull("team/app", "v1")
+	waitCached(t, p, "team/app", "v1", layers)
+
+	resp, _ = client.do(http.MethodGet, "/v2/team/app/manifests/v1", nil)
+	timing := resp.Header.Get("X-Proxy-Timing")
+	if resp.Header.Get("X-Cache") != "HIT" || !strings.Contains(timing, "cache;dur=") || strings.Contains(timing, "upstream") {
+		t.Errorf("hit timing = %q (X-Cache %s)", timing, resp.Header.Get("X-Cache"))
+	}
+}
+
+// sendfileRecorder 与 net/http 的响应一样支持 Flush、Hijack 与 ReadFrom，并记录是否经由 ReadFrom 写出
+type sendfileRecorder struct {
+	*httptest.ResponseRecorder
+	readFrom bool
+}
+
+func newSendfileRecorder() *sendfileRecorder {
+	return &sendfileRecorder{ResponseRecorder: httptest.NewRecorder()}
+}
+
+func (r *sendfileRecorder) ReadFrom(src io.Reader) (int64, error) {
+	r.readFrom = true
+	return io.Copy(r.ResponseRecorder, src)
+}
+
+func (r *sendfileRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, http.ErrNotSupported
+}
+
+func TestTimingWriterKeepsReadFrom(t *testing.T) {
+	l := newAccessLog(&Config{AccessLogSample: 1, TimingHeader: true})
+	rec := newSendfileRecorder()
+	l.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(io.ReaderFrom); !ok {
+			t.Errorf("%T does not implement io.ReaderFrom", w)
+		}
+		// LimitReader 没有 WriteTo，io.Copy 只能走 ReadFrom
+		io.Copy(w, io.LimitReader(strings.NewReader("blob data"), 9))
+	})).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v2/team/app/blobs/sha256:abc", nil))
+
+	if !rec.readFrom {
+		t.Error("ReadFrom was not passed through to the connection")
+	}
+	if rec.Code != http.StatusOK || rec.Body.String() != "blob data" {
+		t.Errorf("response = %d %q", rec.Code, rec.Body.String())
+	}
+	// 首字节时写入（此处没有经过任何阶段，值为空）
+	if _, ok := rec.Header()[headerProxyTiming]; !ok {
+		t.Errorf("missing %s header: first byte not recorded", headerProxyTiming)
+	}
+}
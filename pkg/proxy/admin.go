@@ -0,0 +1,245 @@
+package proxy
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// =============================================================================
+// 管理接口 - /admin/*，以及可选的 /metrics 与 /stats。
+// 管理认证独立于仓库客户端认证：静态 token、htpasswd Basic 认证或客户端证书（mTLS），任一通过即可
+// =============================================================================
+
+// AdminAuthConfig 管理接口认证配置
+type AdminAuthConfig struct {
+	Token          string   // Authorization: Bearer <token>
+	Htpasswd       string   // Basic 认证使用的 htpasswd 文件（bcrypt）
+	ClientCA       string   // 签发管理客户端证书的 CA（PEM），需启用 TLS
+	ClientNames    []string // 允许的客户端证书 CN / DNS SAN，为空时接受该 CA 签发的任意证书
+	ProtectMetrics bool     // /metrics 与 /stats 同样要求管理认证
+}
+
+// loadAdminAuthConfig 从环境变量读取管理认证配置
+//
+//	ADMIN_TOKEN             静态 token
+//	ADMIN_HTPASSWD          htpasswd 文件
+//	ADMIN_CLIENT_CA         客户端证书 CA
+//	ADMIN_CLIENT_NAMES      允许的证书名称（逗号分隔）
+//	ADMIN_PROTECT_METRICS   保护 /metrics 与 /stats
+func loadAdminAuthConfig() AdminAuthConfig {
+	return AdminAuthConfig{
+		Token:          getEnv("ADMIN_TOKEN", ""),
+		Htpasswd:       getEnv("ADMIN_HTPASSWD", ""),
+		ClientCA:       getEnv("ADMIN_CLIENT_CA", ""),
+		ClientNames:    getEnvList("ADMIN_CLIENT_NAMES"),
+		ProtectMetrics: getEnv("ADMIN_PROTECT_METRICS", "false") == "true",
+	}
+}
+
+// Enabled 是否配置了任一管理认证方式（未配置时不开放 /admin）
+func (c AdminAuthConfig) Enabled() bool {
+	return c.Token != "" || c.Htpasswd != "" || c.ClientCA != ""
+}
+
+// Methods 已配置的认证方式，用于启动日志与配置检查
+func (c AdminAuthConfig) Methods() []string {
+	var methods []string
+	if c.Token != "" {
+		methods = append(methods, "token")
+	}
+	if c.Htpasswd != "" {
+		methods = append(methods, "basic")
+	}
+	if c.ClientCA != "" {
+		methods = append(methods, "mtls")
+	}
+	return methods
+}
+
+// AdminAuth 校验管理请求
+type AdminAuth struct {
+	config    AdminAuthConfig
+	clientCAs *x509.CertPool
+
+	mu    sync.RWMutex
+	users map[string]string // htpasswd 用户 -> bcrypt 哈希
+}
+
+// NewAdminAuth 加载 htpasswd 与客户端证书 CA，未配置管理认证时返回 nil
+func NewAdminAuth(config AdminAuthConfig) (*AdminAuth, error) {
+	if !config.Enabled() {
+		return nil, nil
+	}
+	a := &AdminAuth{config: config}
+	if config.ClientCA != "" {
+		data, err := os.ReadFile(config.ClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read admin client CA: %w", err)
+		}
+		a.clientCAs = x509.NewCertPool()
+		if !a.clientCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("admin client CA %s contains no PEM certificates", config.ClientCA)
+		}
+	}
+	if err := a.Reload(); err != nil {
+		return nil, err
+	}
+	log.Printf("Admin API enabled: %s", strings.Join(config.Methods(), ", "))
+	return a, nil
+}
+
+// Reload 重新加载管理 htpasswd 文件
+func (a *AdminAuth) Reload() error {
+	users, err := a.loadUsers()
+	if err != nil {
+		return err
+	}
+	a.setUsers(users)
+	return nil
+}
+
+// loadUsers 读取管理 htpasswd 文件但不生效，未配置文件时返回 nil
+func (a *AdminAuth) loadUsers() (map[string]string, error) {
+	if a == nil || a.config.Htpasswd == "" {
+		return nil, nil
+	}
+	users, err := loadHtpasswd(a.config.Htpasswd)
+	if err != nil {
+		return nil, fmt.Errorf("admin htpasswd: %w", err)
+	}
+	return users, nil
+}
+
+// setUsers 替换管理用户表
+func (a *AdminAuth) setUsers(users map[string]string) {
+	if a == nil || a.config.Htpasswd == "" {
+		return
+	}
+	a.mu.Lock()
+	a.users = users
+	a.mu.Unlock()
+}
+
+// TLSConfig 配置了客户端证书 CA 时返回请求（但不强制）客户端证书的 TLS 配置，
+// 证书只用于管理接口认证，仓库客户端不受影响
+func (a *AdminAuth) TLSConfig() *tls.Config {
+	if a == nil || a.clientCAs == nil {
+		return nil
+	}
+	return &tls.Config{
+		ClientCAs:  a.clientCAs,
+		ClientAuth: tls.VerifyClientCertIfGiven,
+	}
+}
+
+// authenticate 返回通过认证的管理身份
+func (a *AdminAuth) authenticate(r *http.Request) (string, bool) {
+	if a.clientCAs != nil && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		if name, ok := a.certificateName(r.TLS.VerifiedChains[0][0]); ok {
+			return "cert:" + name, true
+		}
+	}
+	auth := r.Header.Get("Authorization")
+	if token, ok := strings.CutPrefix(auth, "Bearer "); ok && a.config.Token != "" &&
+		subtle.ConstantTimeCompare([]byte(token), []byte(a.config.Token)) == 1 {
+		return "token", true
+	}
+	if user, password, ok := r.BasicAuth(); ok && a.config.Htpasswd != "" {
+		a.mu.RLock()
+		hash, exists := a.users[user]
+		a.mu.RUnlock()
+		if exists && bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil {
+			return "user:" + user, true
+		}
+	}
+	return "", false
+}
+
+// certificateName 客户端证书的 CN 或 DNS SAN 是否在允许列表中（列表为空时接受任意证书）
+func (a *AdminAuth) certificateName(cert *x509.Certificate) (string, bool) {
+	if len(a.config.ClientNames) == 0 {
+		return cert.Subject.CommonName, true
+	}
+	for _, allowed := range a.config.ClientNames {
+		if cert.Subject.CommonName == allowed {
+			return allowed, true
+		}
+		for _, name := range cert.DNSNames {
+			if name == allowed {
+				return allowed, true
+			}
+		}
+	}
+	return "", false
+}
+
+// registerAdminRoutes 注册管理接口，未配置管理认证时不开放
+func (p *ProxyServer) registerAdminRoutes(r chi.Router) {
+	if p.adminAuth == nil {
+		return
+	}
+
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(p.adminAuthMiddleware)
+
+		if p.apiTokens != nil {
+			p.registerTokenAdminRoutes(r)
+		}
+		if p.scanner != nil {
+			p.registerScanAdminRoutes(r)
+		}
+		if p.usage != nil {
+			p.registerUsageAdminRoutes(r)
+		}
+		if p.replicator != nil {
+			p.registerReplicationAdminRoutes(r)
+		}
+		if p.cacheManager != nil {
+			p.registerCatalogAdminRoutes(r)
+			p.registerGCAdminRoutes(r)
+		}
+		p.registerMaintenanceAdminRoutes(r)
+		p.registerDiagnosticsAdminRoutes(r)
+		p.registerEventAdminRoutes(r)
+		r.Post("/reload", p.handleAdminReload)
+	})
+}
+
+// adminAuthMiddleware 校验管理认证（token、Basic 或客户端证书）
+func (p *ProxyServer) adminAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := p.adminAuth.authenticate(r)
+		if !ok {
+			if p.adminAuth.config.Token != "" {
+				w.Header().Add("WWW-Authenticate", `Bearer realm="go-docker-proxy-admin"`)
+			}
+			if p.adminAuth.config.Htpasswd != "" {
+				w.Header().Add("WWW-Authenticate", `Basic realm="go-docker-proxy-admin"`)
+			}
+			p.writeErrorResponse(w, "admin authentication required", http.StatusUnauthorized)
+			return
+		}
+		if p.config.Debug {
+			log.Printf("[DEBUG] Admin request %s %s by %s", r.Method, r.URL.Path, identity)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// metricsAuthMiddleware ADMIN_PROTECT_METRICS 时 /metrics、/stats 与 /api/routes 要求管理认证
+func (p *ProxyServer) metricsAuthMiddleware(next http.Handler) http.Handler {
+	if p.adminAuth == nil || !p.config.Admin.ProtectMetrics {
+		return next
+	}
+	return p.adminAuthMiddleware(next)
+}
@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAdminTokenLifecycle(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	upstream.addImage("team/app", "v1", []byte("layer"))
+	_, client := newTestProxy(t, upstream, map[string]string{
+		"ADMIN_TOKEN":        testAdminToken,
+		"API_TOKENS_ENABLED": "true",
+	})
+
+	// 管理接口需要管理认证，仓库客户端的 token 无效
+	resp, _ := client.do("POST", "/admin/tokens", http.Header{"Authorization": {"Bearer fake-token"}})
+	if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") == "" {
+		t.Fatalf("POST /admin/tokens without admin token: status %d", resp.StatusCode)
+	}
+
+	resp, body := client.admin("POST", "/admin/tokens", `{"name": "ci", "requestsPerDay": 2}`)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create token: status %d: %s", resp.StatusCode, body)
+	}
+	var created APIToken
+	if err := json.Unmarshal(body, &created); err != nil || !strings.HasPrefix(created.Token, "gdp_") {
+		t.Fatalf("created token %s: %v", body, err)
+	}
+	if resp, _ := client.admin("POST", "/admin/tokens", `{"name": "ci"}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("duplicate token name: status %d, want 400", resp.StatusCode)
+	}
+	if resp, _ := client.admin("POST", "/admin/tokens", `{"token": "no-name"}`); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("token without name: status %d, want 400", resp.StatusCode)
+	}
+
+	// token 可直接作为 Bearer token 使用，用量计入报告
+	client.token = created.Token
+	for i := 0; i < 2; i++ {
+		if resp, _ := client.do("GET", "/v2/", nil); resp.StatusCode == http.StatusTooManyRequests {
+			t.Fatalf("request %d rejected by quota", i+1)
+		}
+	}
+	if resp, _ := client.do("GET", "/v2/", nil); resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("request over quota: status %d, want 429", resp.StatusCode)
+	}
+	_, body = client.admin("GET", "/admin/usage", "")
+	var usage struct {
+		Tokens []struct {
+			Name  string `json:"name"`
+			Today struct {
+				Requests int64 `json:"requests"`
+			} `json:"today"`
+		} `json:"tokens"`
+	}
+	if err := json.Unmarshal(body, &usage); err != nil || len(usage.Tokens) != 1 || usage.Tokens[0].Today.Requests != 2 {
+		t.Errorf("usage report %s: %v", body, err)
+	}
+	if strings.Contains(string(body), created.Token) {
+		t.Error("usage report contains the token secret")
+	}
+
+	// 删除后 token 立即失效
+	if resp, _ := client.admin("DELETE", "/admin/tokens/ci", ""); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("delete token: status %d", resp.StatusCode)
+	}
+	if resp, _ := client.do("GET", "/v2/", nil); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("deleted token: status %d, want 401", resp.StatusCode)
+	}
+	if resp, _ := client.admin("DELETE", "/admin/tokens/ci", ""); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("delete unknown token: status %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestAdminAuth(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+	htpasswd := filepath.Join(t.TempDir(), "admin.htpasswd")
+	os.WriteFile(htpasswd, []byte("ops:"+string(hash)+"\n"), 0o600)
+	p, client := newTestProxy(t, upstream, map[string]string{
+		"ADMIN_TOKEN":           "admin-token",
+		"ADMIN_HTPASSWD":        htpasswd,
+		"ADMIN_PROTECT_METRICS": "true",
+	})
+
+	status := func(path string, set func(*http.Request)) int {
+		req, _ := http.NewRequest("GET", client.base+path, nil)
+		if set != nil {
+			set(req)
+		}
+		resp, err := client.http.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	for _, path := range []string{"/admin/usage", "/metrics", "/stats"} {
+		if got := status(path, nil); got != http.StatusUnauthorized {
+			t.Errorf("%s without credentials: status %d", path, got)
+		}
+	}
+	if got := status("/metrics", func(r *http.Request) { r.Header.Set("Authorization", "Bearer admin-token") }); got != http.StatusOK {
+		t.Errorf("/metrics with token: status %d", got)
+	}
+	if got := status("/stats", func(r *http.Request) { r.SetBasicAuth("ops", "s3cret") }); got != http.StatusOK {
+		t.Errorf("/stats with basic auth: status %d", got)
+	}
+	if got := status("/stats", func(r *http.Request) { r.SetBasicAuth("ops", "wrong") }); got != http.StatusUnauthorized {
+		t.Errorf("/stats with wrong password: status %d", got)
+	}
+	// 仓库客户端的认证不受影响
+	if got := status("/health", nil); got != http.StatusOK {
+		t.Errorf("/health: status %d", got)
+	}
+
+	// 客户端证书：CN 或 DNS SAN 在允许列表中才通过
+	p.adminAuth.clientCAs = x509.NewCertPool()
+	p.adminAuth.config.ClientNames = []string{"ops.example.test"}
+	withCert := func(cert *x509.Certificate) *http.Request {
+		req := httptest.NewRequest("GET", "/admin/usage", nil)
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		return req
+	}
+	if _, ok := p.adminAuth.authenticate(withCert(&x509.Certificate{DNSNames: []string{"ops.example.test"}})); !ok {
+		t.Error("certificate with allowed SAN rejected")
+	}
+	if _, ok := p.adminAuth.authenticate(withCert(&x509.Certificate{Subject: pkix.Name{CommonName: "intruder"}})); ok {
+		t.Error("certificate with unknown name accepted")
+	}
+}
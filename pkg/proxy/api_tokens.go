@@ -0,0 +1,407 @@
+package proxy
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+// =============================================================================
+// API Token - 按客户端的配额与用量统计
+// =============================================================================
+
+const (
+	// apiTokenUserPrefix API token 身份在用户名中的前缀
+	apiTokenUserPrefix = "token:"
+	// tokenUsageSaveInterval 用量写回文件的间隔，进程异常退出时最多丢失这段时间内的计数
+	tokenUsageSaveInterval = 10 * time.Second
+)
+
+// APIToken 静态 API token 定义
+type APIToken struct {
+	Name              string `json:"name"`
+	Token             string `json:"token"`
+	RequestsPerDay    int64  `json:"requestsPerDay,omitempty"`    // 每日请求数上限，0 表示不限
+	EgressBytesPerDay int64  `json:"egressBytesPerDay,omitempty"` // 每日出口流量上限（字节），0 表示不限
+}
+
+// tokenUsage 单个 token 的用量（按 UTC 自然日重置）
+type tokenUsage struct {
+	Day              string    `json:"day"`
+	Requests         int64     `json:"requests"`
+	EgressBytes      int64     `json:"egressBytes"`
+	TotalRequests    int64     `json:"totalRequests"`
+	TotalEgressBytes int64     `json:"totalEgressBytes"`
+	LastUsed         time.Time `json:"lastUsed"`
+}
+
+// TokenStore 管理 API token 及其用量
+type TokenStore struct {
+	path      string // 持久化文件（为空则仅内存，配额随进程重启清零）
+	usagePath string // 用量文件，与 token 文件放在同一目录
+
+	mu     sync.Mutex
+	tokens map[string]*APIToken   // name -> token
+	usage  map[string]*tokenUsage // name -> usage
+	dirty  bool                   // 用量有未写回的变化
+}
+
+// NewTokenStore 从 JSON 文件加载 API token 与用量，文件不存在时创建空存储
+func NewTokenStore(path string) (*TokenStore, error) {
+	s := &TokenStore{
+		path:   path,
+		tokens: make(map[string]*APIToken),
+		usage:  make(map[string]*tokenUsage),
+	}
+	if path == "" {
+		return s, nil
+	}
+	s.usagePath = strings.TrimSuffix(path, filepath.Ext(path)) + ".usage.json"
+	if err := s.loadUsage(); err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API tokens file: %w", err)
+	}
+
+	var tokens []*APIToken
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("failed to parse API tokens file: %w", err)
+	}
+	for _, t := range tokens {
+		if t.Name == "" || t.Token == "" {
+			return nil, fmt.Errorf("API token entries require name and token")
+		}
+		if err := s.checkUniqueLocked(t); err != nil {
+			return nil, err
+		}
+		s.tokens[t.Name] = t
+	}
+	// 文件中已删除的 token 不保留用量，同名的新 token 从零开始计数
+	for name := range s.usage {
+		if _, exists := s.tokens[name]; !exists {
+			delete(s.usage, name)
+		}
+	}
+
+	log.Printf("Loaded %d API tokens from %s", len(s.tokens), path)
+	return s, nil
+}
+
+// loadUsage 读取上次保存的用量，重启后配额继续累计
+func (s *TokenStore) loadUsage() error {
+	data, err := os.ReadFile(s.usagePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read API token usage file: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.usage); err != nil {
+		return fmt.Errorf("failed to parse API token usage file: %w", err)
+	}
+	return nil
+}
+
+// checkUniqueLocked 名称与 secret 都不能与已有 token 重复，否则 Authenticate 的结果取决于遍历顺序（调用方需持有锁）
+func (s *TokenStore) checkUniqueLocked(t *APIToken) error {
+	if _, exists := s.tokens[t.Name]; exists {
+		return fmt.Errorf("token %q already exists", t.Name)
+	}
+	for name, existing := range s.tokens {
+		if subtle.ConstantTimeCompare([]byte(existing.Token), []byte(t.Token)) == 1 {
+			return fmt.Errorf("token %q uses the same secret as token %q", t.Name, name)
+		}
+	}
+	return nil
+}
+
+// Authenticate 校验 token，返回对应的用户身份
+func (s *TokenStore) Authenticate(secret string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name, t := range s.tokens {
+		if subtle.ConstantTimeCompare([]byte(t.Token), []byte(secret)) == 1 {
+			return apiTokenUserPrefix + name, true
+		}
+	}
+	return "", false
+}
+
+// usageFor 获取当日用量（调用方需持有锁）
+func (s *TokenStore) usageFor(name string) *tokenUsage {
+	today := time.Now().UTC().Format("2006-01-02")
+	u, ok := s.usage[name]
+	if !ok {
+		u = &tokenUsage{Day: today}
+		s.usage[name] = u
+	}
+	if u.Day != today {
+		u.Day = today
+		u.Requests = 0
+		u.EgressBytes = 0
+	}
+	return u
+}
+
+// Admit 检查配额并计入一次请求，超出配额时返回原因
+func (s *TokenStore) Admit(user string) (string, bool) {
+	name, ok := strings.CutPrefix(user, apiTokenUserPrefix)
+	if !ok {
+		return "", true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, exists := s.tokens[name]
+	if !exists {
+		return "token revoked", false
+	}
+
+	u := s.usageFor(name)
+	if t.RequestsPerDay > 0 && u.Requests >= t.RequestsPerDay {
+		return fmt.Sprintf("daily request quota of %d exceeded", t.RequestsPerDay), false
+	}
+	if t.EgressBytesPerDay > 0 && u.EgressBytes >= t.EgressBytesPerDay {
+		return fmt.Sprintf("daily egress quota of %s exceeded", cache.FormatBytes(t.EgressBytesPerDay)), false
+	}
+
+	u.Requests++
+	u.TotalRequests++
+	u.LastUsed = time.Now()
+	s.dirty = true
+	return "", true
+}
+
+// RecordEgress 记录响应字节数
+func (s *TokenStore) RecordEgress(user string, bytes int64) {
+	name, ok := strings.CutPrefix(user, apiTokenUserPrefix)
+	if !ok || bytes <= 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.usageFor(name)
+	u.EgressBytes += bytes
+	u.TotalEgressBytes += bytes
+	s.dirty = true
+}
+
+// Run 周期性写回用量，直到 ctx 结束
+func (s *TokenStore) Run(ctx context.Context) {
+	if s == nil || s.usagePath == "" {
+		return
+	}
+
+	ticker := time.NewTicker(tokenUsageSaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.SaveUsage()
+		}
+	}
+}
+
+// SaveUsage 有变化时将用量写回文件（关闭时调用，保证正常退出不丢失计数）
+func (s *TokenStore) SaveUsage() {
+	if s == nil || s.usagePath == "" {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.dirty {
+		return
+	}
+	if err := writeJSONFile(s.usagePath, s.usage); err != nil {
+		log.Printf("Failed to save API token usage: %v", err)
+		return
+	}
+	s.dirty = false
+}
+
+// Create 创建新 token（未指定 secret 时随机生成）并持久化
+func (s *TokenStore) Create(t *APIToken) error {
+	if t.Name == "" {
+		return fmt.Errorf("token name is required")
+	}
+	if t.Token == "" {
+		buf := make([]byte, 24)
+		if _, err := rand.Read(buf); err != nil {
+			return err
+		}
+		t.Token = "gdp_" + hex.EncodeToString(buf)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkUniqueLocked(t); err != nil {
+		return err
+	}
+	s.tokens[t.Name] = t
+	return s.saveLocked()
+}
+
+// Delete 删除 token 并持久化
+func (s *TokenStore) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.tokens[name]; !exists {
+		return fmt.Errorf("token %q not found", name)
+	}
+	delete(s.tokens, name)
+	delete(s.usage, name)
+	s.dirty = true
+	return s.saveLocked()
+}
+
+// saveLocked 写回持久化文件（调用方需持有锁）
+func (s *TokenStore) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+
+	tokens := make([]*APIToken, 0, len(s.tokens))
+	for _, t := range s.tokens {
+		tokens = append(tokens, t)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Name < tokens[j].Name })
+
+	if err := writeJSONFile(s.path, tokens); err != nil {
+		return fmt.Errorf("failed to write API tokens file: %w", err)
+	}
+	return nil
+}
+
+// writeJSONFile 先写临时文件再重命名，避免写入中途退出留下不完整的文件
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// Report 生成用量报告（不包含 token 原文）
+func (s *TokenStore) Report() []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.tokens))
+	for name := range s.tokens {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	report := make([]map[string]interface{}, 0, len(names))
+	for _, name := range names {
+		t := s.tokens[name]
+		u := s.usageFor(name)
+		lastUsed := "N/A"
+		if !u.LastUsed.IsZero() {
+			lastUsed = u.LastUsed.UTC().Format(time.RFC3339)
+		}
+		report = append(report, map[string]interface{}{
+			"name":              name,
+			"requestsPerDay":    t.RequestsPerDay,
+			"egressBytesPerDay": t.EgressBytesPerDay,
+			"today": map[string]interface{}{
+				"day":         u.Day,
+				"requests":    u.Requests,
+				"egressBytes": u.EgressBytes,
+				"egressHuman": cache.FormatBytes(u.EgressBytes),
+			},
+			"totalRequests":    u.TotalRequests,
+			"totalEgressBytes": u.TotalEgressBytes,
+			"lastUsed":         lastUsed,
+		})
+	}
+	return report
+}
+
+// ServeWithQuota 执行配额检查，并统计本次响应的出口流量
+func (s *TokenStore) ServeWithQuota(p *ProxyServer, user string, next http.Handler, w http.ResponseWriter, r *http.Request) {
+	if reason, ok := s.Admit(user); !ok {
+		p.writeRegistryError(w, http.StatusTooManyRequests, "TOOMANYREQUESTS", reason)
+		return
+	}
+
+	ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+	defer func() {
+		s.RecordEgress(user, int64(ww.BytesWritten()))
+	}()
+	next.ServeHTTP(ww, r)
+}
+
+// =============================================================================
+// 管理接口
+// =============================================================================
+
+// registerTokenAdminRoutes 注册 token 管理与用量报告接口
+func (p *ProxyServer) registerTokenAdminRoutes(r chi.Router) {
+	r.Get("/tokens", func(w http.ResponseWriter, r *http.Request) {
+		p.writeJSON(w, http.StatusOK, map[string]interface{}{
+			"tokens": p.apiTokens.Report(),
+		})
+	})
+	r.Post("/tokens", func(w http.ResponseWriter, r *http.Request) {
+		var t APIToken
+		if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+			p.writeErrorResponse(w, fmt.Sprintf("invalid token definition: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := p.apiTokens.Create(&t); err != nil {
+			p.writeErrorResponse(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// 仅在创建时返回 token 原文
+		p.writeJSON(w, http.StatusCreated, t)
+	})
+	r.Delete("/tokens/{name}", func(w http.ResponseWriter, r *http.Request) {
+		if err := p.apiTokens.Delete(chi.URLParam(r, "name")); err != nil {
+			p.writeErrorResponse(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	r.Get("/usage", func(w http.ResponseWriter, r *http.Request) {
+		p.writeJSON(w, http.StatusOK, map[string]interface{}{
+			"generatedAt": time.Now().UTC().Format(time.RFC3339),
+			"tokens":      p.apiTokens.Report(),
+		})
+	})
+}
@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAPITokenQuotaSurvivesRestart(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	upstream.addImage("team/app", "v1", []byte("layer"))
+	tokensFile := filepath.Join(t.TempDir(), "tokens.json")
+	os.WriteFile(tokensFile, []byte(`[{"name": "ci", "token": "ci-secret", "requestsPerDay": 2}]`), 0o600)
+	env := map[string]string{"API_TOKENS_FILE": tokensFile}
+
+	// 配额按 token 计数（上游未登录返回 401，只关心是否超出配额）
+	manifest := func(client *testClient) int {
+		resp, _ := client.do("GET", "/v2/team/app/manifests/v1", http.Header{"Authorization": {"Bearer ci-secret"}})
+		return resp.StatusCode
+	}
+
+	p, client := newTestProxy(t, upstream, env)
+	for i := 1; i <= 3; i++ {
+		if limited := manifest(client) == http.StatusTooManyRequests; limited != (i == 3) {
+			t.Errorf("request %d: limited = %v", i, limited)
+		}
+	}
+	p.apiTokens.SaveUsage()
+
+	_, restarted := newTestProxy(t, upstream, env)
+	if got := manifest(restarted); got != http.StatusTooManyRequests {
+		t.Errorf("after restart: status %d, want 429", got)
+	}
+}
+
+func TestAPITokenCreateRejectsDuplicateSecret(t *testing.T) {
+	store, err := NewTokenStore(filepath.Join(t.TempDir(), "tokens.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Create(&APIToken{Name: "ci", Token: "shared-secret"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Create(&APIToken{Name: "dev", Token: "shared-secret"}); err == nil {
+		t.Error("created a token with a duplicate secret")
+	}
+	if err := store.Create(&APIToken{Name: "ci", Token: "other-secret"}); err == nil {
+		t.Error("created a token with a duplicate name")
+	}
+	if user, ok := store.Authenticate("shared-secret"); !ok || user != apiTokenUserPrefix+"ci" {
+		t.Errorf("Authenticate = %q, %v", user, ok)
+	}
+
+	dir := t.TempDir()
+	tokensFile := filepath.Join(dir, "tokens.json")
+	os.WriteFile(tokensFile, []byte(`[{"name": "a", "token": "same"}, {"name": "b", "token": "same"}]`), 0o600)
+	if _, err := NewTokenStore(tokensFile); err == nil {
+		t.Error("loaded a tokens file with duplicate secrets")
+	}
+}
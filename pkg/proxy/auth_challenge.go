@@ -0,0 +1,65 @@
+package proxy
+
+import (
+	"sync"
+	"time"
+)
+
+// =============================================================================
+// 认证挑战缓存 - 按上游缓存 WWW-Authenticate 解析结果
+// =============================================================================
+
+type authChallenge struct {
+	params    map[string]string // realm / service 等参数
+	expiresAt time.Time
+}
+
+// AuthChallengeCache 缓存上游 /v2/ 返回的认证挑战，
+// 避免每次签发 token 都先探测一次上游 /v2/
+type AuthChallengeCache struct {
+	ttl time.Duration
+
+	mu      sync.RWMutex
+	entries map[string]authChallenge // upstream -> challenge
+}
+
+// NewAuthChallengeCache 创建认证挑战缓存，ttl <= 0 时不缓存
+func NewAuthChallengeCache(ttl time.Duration) *AuthChallengeCache {
+	return &AuthChallengeCache{
+		ttl:     ttl,
+		entries: make(map[string]authChallenge),
+	}
+}
+
+// Get 获取未过期的认证挑战
+func (c *AuthChallengeCache) Get(upstream string) (map[string]string, bool) {
+	c.mu.RLock()
+	entry, ok := c.entries[upstream]
+	c.mu.RUnlock()
+
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.params, true
+}
+
+// Set 记录认证挑战
+func (c *AuthChallengeCache) Set(upstream string, params map[string]string) {
+	if c.ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	c.entries[upstream] = authChallenge{
+		params:    params,
+		expiresAt: time.Now().Add(c.ttl),
+	}
+	c.mu.Unlock()
+}
+
+// Invalidate 丢弃上游的认证挑战
+func (c *AuthChallengeCache) Invalidate(upstream string) {
+	c.mu.Lock()
+	delete(c.entries, upstream)
+	c.mu.Unlock()
+}
@@ -0,0 +1,30 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAuthChallengeCache(t *testing.T) {
+	for _, tt := range []struct {
+		ttl    string
+		probes int
+	}{
+		{"10m", 1},
+		{"0", 3},
+	} {
+		upstream := newFakeRegistry(t)
+		_, client := newTestProxy(t, upstream, map[string]string{"AUTH_CHALLENGE_TTL": tt.ttl})
+
+		// 直接请求 /v2/auth，只有未命中缓存时才探测上游 /v2/
+		for range 3 {
+			resp, body := client.do("GET", "/v2/auth?scope=repository:team/app:pull", nil)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("AUTH_CHALLENGE_TTL=%s: token status %d: %s", tt.ttl, resp.StatusCode, body)
+			}
+		}
+		if probes := upstream.count("GET", "/v2/"); probes != tt.probes {
+			t.Errorf("AUTH_CHALLENGE_TTL=%s: upstream /v2/ probed %d times, want %d", tt.ttl, probes, tt.probes)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// =============================================================================
+// AWS 凭据链 - 环境变量 / IRSA (Web Identity) / ECS 任务角色 / EC2 实例角色
+// =============================================================================
+
+const (
+	imdsEndpoint = "http://169.254.169.254"
+	ecsEndpoint  = "http://169.254.170.2"
+	// awsCredentialRefreshWindow 临时凭据在过期前多久刷新
+	awsCredentialRefreshWindow = 5 * time.Minute
+)
+
+// awsCredentials AWS 访问凭据
+type awsCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expires         time.Time // 零值表示长期凭据
+}
+
+// expired 判断凭据是否即将过期
+func (c *awsCredentials) expired() bool {
+	return !c.Expires.IsZero() && time.Now().Add(awsCredentialRefreshWindow).After(c.Expires)
+}
+
+// AWSCredentialProvider 按标准顺序解析 AWS 凭据并缓存临时凭据
+type AWSCredentialProvider struct {
+	client *http.Client
+
+	mu     sync.Mutex
+	cached *awsCredentials
+	source string
+}
+
+// NewAWSCredentialProvider 创建凭据提供者，client 用于访问 STS / 元数据服务
+func NewAWSCredentialProvider(client *http.Client) *AWSCredentialProvider {
+	return &AWSCredentialProvider{client: client}
+}
+
+// Retrieve 获取有效凭据
+func (p *AWSCredentialProvider) Retrieve(ctx context.Context) (*awsCredentials, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cached != nil && !p.cached.expired() {
+		return p.cached, nil
+	}
+
+	creds, source, err := p.resolve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.cached = creds
+	p.source = source
+	return creds, nil
+}
+
+// Source 返回当前凭据来源（用于日志与诊断）
+func (p *AWSCredentialProvider) Source() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.source
+}
+
+func (p *AWSCredentialProvider) resolve(ctx context.Context) (*awsCredentials, string, error) {
+	// 1. 环境变量
+	if id, secret := getEnv("AWS_ACCESS_KEY_ID", ""), getEnv("AWS_SECRET_ACCESS_KEY", ""); id != "" && secret != "" {
+		return &awsCredentials{
+			AccessKeyID:     id,
+			SecretAccessKey: secret,
+			SessionToken:    getEnv("AWS_SESSION_TOKEN", ""),
+		}, "env", nil
+	}
+
+	// 2. IRSA / Web Identity
+	if tokenFile, roleARN := getEnv("AWS_WEB_IDENTITY_TOKEN_FILE", ""), getEnv("AWS_ROLE_ARN", ""); tokenFile != "" && roleARN != "" {
+		creds, err := p.assumeRoleWithWebIdentity(ctx, tokenFile, roleARN)
+		return creds, "web-identity", err
+	}
+
+	// 3. ECS 任务角色
+	if relURI := getEnv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", ""); relURI != "" {
+		creds, err := p.fetchContainerCredentials(ctx, ecsEndpoint+relURI, "")
+		return creds, "ecs", err
+	}
+	if fullURI := getEnv("AWS_CONTAINER_CREDENTIALS_FULL_URI", ""); fullURI != "" {
+		creds, err := p.fetchContainerCredentials(ctx, fullURI, getEnv("AWS_CONTAINER_AUTHORIZATION_TOKEN", ""))
+		return creds, "ecs", err
+	}
+
+	// 4. EC2 实例角色 (IMDSv2)
+	creds, err := p.fetchInstanceCredentials(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("no AWS credentials found (env, web identity, ECS, instance profile): %w", err)
+	}
+	return creds, "instance-profile", nil
+}
+
+// assumeRoleWithWebIdentity 通过 STS 用 OIDC token 换取临时凭据（该调用无需签名）
+func (p *AWSCredentialProvider) assumeRoleWithWebIdentity(ctx context.Context, tokenFile, roleARN string) (*awsCredentials, error) {
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read web identity token: %w", err)
+	}
+
+	sessionName := getEnv("AWS_ROLE_SESSION_NAME", "")
+	if sessionName == "" {
+		sessionName = "go-docker-proxy"
+	}
+
+	endpoint := "https://sts.amazonaws.com/"
+	if region := awsRegionFromEnv(); region != "" {
+		endpoint = "https://sts." + region + ".amazonaws.com/"
+	}
+
+	q := url.Values{}
+	q.Set("Action", "AssumeRoleWithWebIdentity")
+	q.Set("Version", "2011-06-15")
+	q.Set("RoleArn", roleARN)
+	q.Set("RoleSessionName", sessionName)
+	q.Set("WebIdentityToken", strings.TrimSpace(string(token)))
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(q.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	body, err := p.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("AssumeRoleWithWebIdentity failed: %w", err)
+	}
+
+	var result struct {
+		Credentials struct {
+			AccessKeyID     string    `xml:"AccessKeyId"`
+			SecretAccessKey string    `xml:"SecretAccessKey"`
+			SessionToken    string    `xml:"SessionToken"`
+			Expiration      time.Time `xml:"Expiration"`
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}
+	if err := xml.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("invalid STS response: %w", err)
+	}
+	return &awsCredentials{
+		AccessKeyID:     result.Credentials.AccessKeyID,
+		SecretAccessKey: result.Credentials.SecretAccessKey,
+		SessionToken:    result.Credentials.SessionToken,
+		Expires:         result.Credentials.Expiration,
+	}, nil
+}
+
+// containerCredentials ECS 与 IMDS 共用的凭据 JSON 格式
+type containerCredentials struct {
+	AccessKeyID     string    `json:"AccessKeyId"`
+	SecretAccessKey string    `json:"SecretAccessKey"`
+	Token           string    `json:"Token"`
+	Expiration      time.Time `json:"Expiration"`
+}
+
+func (c *containerCredentials) toCredentials() *awsCredentials {
+	return &awsCredentials{
+		AccessKeyID:     c.AccessKeyID,
+		SecretAccessKey: c.SecretAccessKey,
+		SessionToken:    c.Token,
+		Expires:         c.Expiration,
+	}
+}
+
+// fetchContainerCredentials 从 ECS 容器凭据端点获取凭据
+func (p *AWSCredentialProvider) fetchContainerCredentials(ctx context.Context, endpoint, authToken string) (*awsCredentials, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	if authToken != "" {
+		req.Header.Set("Authorization", authToken)
+	}
+
+	body, err := p.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("container credentials request failed: %w", err)
+	}
+
+	var cc containerCredentials
+	if err := json.Unmarshal(body, &cc); err != nil {
+		return nil, fmt.Errorf("invalid container credentials: %w", err)
+	}
+	return cc.toCredentials(), nil
+}
+
+// fetchInstanceCredentials 通过 IMDSv2 获取 EC2 实例角色凭据
+func (p *AWSCredentialProvider) fetchInstanceCredentials(ctx context.Context) (*awsCredentials, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	tokenReq, err := http.NewRequestWithContext(ctx, "PUT", imdsEndpoint+"/latest/api/token", nil)
+	if err != nil {
+		return nil, err
+	}
+	tokenReq.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "21600")
+	token, err := p.do(tokenReq)
+	if err != nil {
+		return nil, fmt.Errorf("IMDS token request failed: %w", err)
+	}
+
+	get := func(path string) ([]byte, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", imdsEndpoint+path, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("X-aws-ec2-metadata-token", string(token))
+		return p.do(req)
+	}
+
+	roles, err := get("/latest/meta-data/iam/security-credentials/")
+	if err != nil {
+		return nil, fmt.Errorf("IMDS role lookup failed: %w", err)
+	}
+	role := strings.TrimSpace(strings.SplitN(string(roles), "\n", 2)[0])
+	if role == "" {
+		return nil, fmt.Errorf("no instance profile role attached")
+	}
+
+	body, err := get("/latest/meta-data/iam/security-credentials/" + role)
+	if err != nil {
+		return nil, fmt.Errorf("IMDS credentials request failed: %w", err)
+	}
+
+	var cc containerCredentials
+	if err := json.Unmarshal(body, &cc); err != nil {
+		return nil, fmt.Errorf("invalid instance credentials: %w", err)
+	}
+	return cc.toCredentials(), nil
+}
+
+func (p *AWSCredentialProvider) do(req *http.Request) ([]byte, error) {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return body, nil
+}
+
+// awsRegionFromEnv 读取 AWS_REGION / AWS_DEFAULT_REGION
+func awsRegionFromEnv() string {
+	if region := getEnv("AWS_REGION", ""); region != "" {
+		return region
+	}
+	return getEnv("AWS_DEFAULT_REGION", "")
+}
@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// clearAWSEnv 清除可能来自运行环境的 AWS 凭据配置
+func clearAWSEnv(t *testing.T) {
+	t.Helper()
+	for _, key := range []string{
+		"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN",
+		"AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_ROLE_ARN",
+		"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "AWS_CONTAINER_CREDENTIALS_FULL_URI", "AWS_CONTAINER_AUTHORIZATION_TOKEN",
+	} {
+		t.Setenv(key, "")
+	}
+}
+
+func TestAWSCredentialsFromEnv(t *testing.T) {
+	clearAWSEnv(t)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "session")
+
+	provider := NewAWSCredentialProvider(http.DefaultClient)
+	creds, err := provider.Retrieve(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AccessKeyID != "AKID" || creds.SecretAccessKey != "secret" || creds.SessionToken != "session" || provider.Source() != "env" {
+		t.Errorf("credentials = %+v from %s", creds, provider.Source())
+	}
+}
+
+func TestAWSCredentialsFromContainerEndpoint(t *testing.T) {
+	clearAWSEnv(t)
+	var requests atomic.Int32
+	var expiresIn atomic.Int64
+	expiresIn.Store(int64(time.Hour))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get("Authorization") != "container-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(containerCredentials{
+			AccessKeyID:     "ASIA",
+			SecretAccessKey: "temporary",
+			Token:           "session",
+			Expiration:      time.Now().Add(time.Duration(expiresIn.Load())),
+		})
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", server.URL+"/creds")
+	t.Setenv("AWS_CONTAINER_AUTHORIZATION_TOKEN", "container-token")
+
+	provider := NewAWSCredentialProvider(server.Client())
+	for range 2 {
+		creds, err := provider.Retrieve(context.Background())
+		if err != nil || creds.AccessKeyID != "ASIA" || creds.SessionToken != "session" || provider.Source() != "ecs" {
+			t.Fatalf("Retrieve = %+v, %v", creds, err)
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("credentials fetched %d times, want 1", n)
+	}
+
+	// 临近过期的凭据每次都重新获取
+	expiresIn.Store(int64(time.Minute))
+	provider = NewAWSCredentialProvider(server.Client())
+	requests.Store(0)
+	for range 2 {
+		if _, err := provider.Retrieve(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := requests.Load(); n != 2 {
+		t.Errorf("expiring credentials fetched %d times, want 2", n)
+	}
+
+	t.Setenv("AWS_CONTAINER_AUTHORIZATION_TOKEN", "wrong")
+	if _, err := NewAWSCredentialProvider(server.Client()).Retrieve(context.Background()); err == nil {
+		t.Error("Retrieve succeeded with a rejected authorization token")
+	}
+}
@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+// =============================================================================
+// blob 流式缓存 - 边向客户端传输边写入临时文件，校验 digest 后才提交到缓存
+// =============================================================================
+
+// errBlobTooLarge 流式写入时超过 CACHE_MAX_BLOB_SIZE
+var errBlobTooLarge = errors.New("blob exceeds CACHE_MAX_BLOB_SIZE")
+
+// cacheFillWriter 同时写入客户端与缓存：客户端断开后继续写入缓存（配合 CACHE_DETACH_MAX），
+// 超过大小上限或写入失败时放弃缓存但不影响客户端
+type cacheFillWriter struct {
+	client    http.ResponseWriter
+	cache     *cache.BlobWriter
+	limit     int64 // 可缓存的最大大小（<= 0 表示不限制）
+	clientErr error
+	cacheErr  error
+	writeTime time.Duration // 写入缓存的累计耗时
+}
+
+func (f *cacheFillWriter) Write(b []byte) (int, error) {
+	if f.cacheErr == nil {
+		start := time.Now()
+		if f.limit > 0 && f.cache.Size()+int64(len(b)) > f.limit {
+			f.cacheErr = errBlobTooLarge
+		} else if _, err := f.cache.Write(b); err != nil {
+			f.cacheErr = err
+		}
+		f.writeTime += time.Since(start)
+		if f.cacheErr != nil {
+			f.cache.Cancel()
+		}
+	}
+	if f.clientErr == nil {
+		if _, err := f.client.Write(b); err != nil {
+			f.clientErr = err
+			// 被策略拒绝（如超过 MAX_BLOB_SIZE）的 blob 不继续缓存
+			if errors.Is(err, errPolicyDenied) && f.cacheErr == nil {
+				f.cacheErr = err
+				f.cache.Cancel()
+			}
+		}
+	}
+	// 客户端与缓存都不再需要数据时停止读取上游
+	if f.clientErr != nil && f.cacheErr != nil {
+		return 0, f.clientErr
+	}
+	return len(b), nil
+}
+
+// Flush 实时刷新数据到客户端
+func (f *cacheFillWriter) Flush() {
+	if flusher, ok := f.client.(http.Flusher); ok && f.clientErr == nil {
+		flusher.Flush()
+	}
+}
+
+// streamBlobToCache 向客户端流式传输 blob，同时写入缓存临时文件；
+// 传输完整且 sha256 与 URL 中的 digest 一致时才原子地提交到缓存，
+// 上游中途断开、被截断或内容不符的 blob 不会被缓存
+func (p *ProxyServer) streamBlobToCache(w http.ResponseWriter, resp *http.Response, cacheKey, digest string, contentLength int64, headers map[string][]string) {
+	mediaType := ""
+	if ct := headers["Content-Type"]; len(ct) > 0 {
+		mediaType = ct[0]
+	}
+
+	ttl := p.cacheManager.TTLFor(cacheKey, resp.Header)
+	var bw *cache.BlobWriter
+	var err error
+	if ttl > 0 {
+		bw, err = p.cacheManager.BlobWriter(digest, mediaType)
+	}
+	if bw == nil {
+		// 已缓存或其他请求正在写入同一 blob 时只转发，不重复写入
+		if err != nil && !errors.Is(err, cache.ErrBlobExists) && !errors.Is(err, cache.ErrBlobWriteInProgress) {
+			log.Printf("Failed to start cache fill for %s: %v", cacheKey, err)
+		}
+		w.Header().Set("X-Cache", "BYPASS")
+		w.WriteHeader(resp.StatusCode)
+		p.streamCopy(w, resp.Body)
+		return
+	}
+
+	bw.SetTTL(ttl)
+	_, repo, _ := cache.ParsePath(cacheKey)
+	bw.SetRepo(repo)
+	w.Header().Set("X-Cache", "MISS")
+	w.WriteHeader(resp.StatusCode)
+
+	fill := &cacheFillWriter{client: w, cache: bw, limit: p.config.CacheMaxBlobSize}
+	if resp.Request != nil {
+		timing := timingFromContext(resp.Request.Context())
+		defer func() { timing.add(PhaseCacheWrite, fill.writeTime) }()
+	}
+	if _, err := p.streamCopy(fill, resp.Body); err != nil || fill.cacheErr != nil {
+		bw.Cancel()
+		if p.config.Debug {
+			log.Printf("[DEBUG] Blob cache fill aborted for %s after %d bytes: read=%v cache=%v client=%v",
+				cacheKey, bw.Size(), err, fill.cacheErr, fill.clientErr)
+		}
+		return
+	}
+	if fill.clientErr != nil && p.config.Debug {
+		log.Printf("[DEBUG] Client disconnected, blob transfer continued for cache: %s", cacheKey)
+	}
+
+	commitStart := time.Now()
+	err = bw.Commit(contentLength)
+	fill.writeTime += time.Since(commitStart)
+	if err != nil {
+		log.Printf("Discarding blob cache fill for %s: %v", cacheKey, err)
+		return
+	}
+
+	now := time.Now()
+	entry := &cache.CacheEntry{
+		Descriptor: cache.Descriptor{
+			Digest:    digest,
+			Size:      bw.Size(),
+			MediaType: mediaType,
+		},
+		Headers:    headers,
+		StatusCode: resp.StatusCode,
+		CachedAt:   now,
+		ExpiresAt:  now.Add(ttl),
+	}
+	p.cacheWrites.submit(cacheKey, false, func(context.Context) { p.afterCacheFill(cacheKey, entry) })
+	if p.config.Debug {
+		log.Printf("[DEBUG] Cached blob %s (%d bytes, digest verified)", cacheKey, bw.Size())
+	}
+}
@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+func TestTruncatedBlobIsNotCached(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	layer := bytes.Repeat([]byte("truncated layer data "), 4096)
+	_, layers := upstream.addImage("team/app", "v1", layer)
+	p, client := newTestProxy(t, upstream, map[string]string{"UPSTREAM_RESUME_RETRIES": "0"})
+	blobPath := "/v2/team/app/blobs/" + layers[0]
+
+	client.login("team/app")
+	upstream.configure(func(f *fakeRegistry) { f.truncateBlobs = 1 })
+	req, _ := http.NewRequest("GET", client.base+blobPath, nil)
+	req.Host = testRegistryHost
+	req.Header.Set("Authorization", "Bearer "+client.token)
+	resp, err := client.http.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(resp.Body); err == nil {
+		t.Fatal("truncated transfer was delivered as complete")
+	}
+	resp.Body.Close()
+
+	// 截断的内容不会提交到缓存，下一次拉取回源并完整缓存
+	resp, body := client.do("GET", blobPath, nil)
+	if resp.Header.Get("X-Cache") != "MISS" || !bytes.Equal(body, layer) {
+		t.Fatalf("X-Cache %q, intact=%v; want a fresh upstream fetch", resp.Header.Get("X-Cache"), bytes.Equal(body, layer))
+	}
+	eventually(t, "blob cache fill", func() bool {
+		_, reader, found := p.cacheManager.GetBlobReader(cache.CacheKey(testRegistryHost, blobPath))
+		if found {
+			reader.Close()
+		}
+		return found
+	})
+	if resp, _ := client.do("GET", blobPath, nil); resp.Header.Get("X-Cache") != "HIT" {
+		t.Fatalf("X-Cache %q, want HIT", resp.Header.Get("X-Cache"))
+	}
+}
+
+// TestConcurrentBlobWrites 覆盖同一 digest 的并发写入：第二个写入器被拒绝，PutBlob 等待前一个写入完成后跳过已缓存的 blob
+func TestConcurrentBlobWrites(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	p, _ := newTestProxy(t, upstream, nil)
+	content := []byte("concurrently written blob")
+	digest := digestOf(content)
+	key := cache.CacheKey(testRegistryHost, "/v2/team/app/blobs/"+digest)
+
+	first, err := p.cacheManager.BlobWriter(digest, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.cacheManager.BlobWriter(digest, ""); !errors.Is(err, cache.ErrBlobWriteInProgress) {
+		t.Fatalf("second writer: err = %v, want ErrBlobWriteInProgress", err)
+	}
+
+	put := make(chan error, 1)
+	go func() {
+		put <- p.cacheManager.PutBlob(context.Background(), key, digest, bytes.NewReader(content), int64(len(content)), nil)
+	}()
+	select {
+	case err := <-put:
+		t.Fatalf("PutBlob returned while another writer was active: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	first.Write(content)
+	if err := first.Commit(int64(len(content))); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-put; err != nil {
+		t.Fatalf("PutBlob: %v", err)
+	}
+	if _, err := p.cacheManager.BlobWriter(digest, ""); !errors.Is(err, cache.ErrBlobExists) {
+		t.Errorf("writer for a cached blob: err = %v, want ErrBlobExists", err)
+	}
+	if count := p.cacheManager.Stats()["blob"].(map[string]interface{})["count"]; count != int64(1) {
+		t.Errorf("blob count = %d, want 1", count)
+	}
+}
@@ -0,0 +1,154 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestBucketRoute 覆盖指向 S3 兼容存储桶的路由：按存储驱动目录结构读取 manifest、blob 与标签列表，
+// 每个对象请求都以 SigV4 签名，未链接到仓库的 blob 不可访问
+func TestBucketRoute(t *testing.T) {
+	layer := []byte("bucket layer")
+	config := []byte(`{"architecture":"amd64","os":"linux"}`)
+	manifest, _ := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"config":        map[string]interface{}{"mediaType": "application/vnd.oci.image.config.v1+json", "digest": digestOf(config), "size": len(config)},
+		"layers":        []map[string]interface{}{{"mediaType": "application/vnd.oci.image.layer.v1.tar+gzip", "digest": digestOf(layer), "size": len(layer)}},
+	})
+	const root = "exports/docker/registry/v2/"
+	objects := map[string][]byte{
+		root + "repositories/team/app/_manifests/tags/v1/current/link":                                            []byte(digestOf(manifest)),
+		root + "repositories/team/app/_manifests/tags/v2/current/link":                                            []byte(digestOf(manifest)),
+		root + "repositories/team/app/_manifests/revisions/sha256/" + digestOf(manifest)[7:] + "/link":            []byte(digestOf(manifest)),
+		root + "repositories/team/app/_layers/sha256/" + digestOf(layer)[7:] + "/link":                            []byte(digestOf(layer)),
+		root + "repositories/team/app/_layers/sha256/" + digestOf(config)[7:] + "/link":                           []byte(digestOf(config)),
+		root + "repositories/team/other/_manifests/tags/v1/current/link":                                          []byte(digestOf(manifest)),
+		root + "blobs/sha256/" + digestOf(manifest)[7:9] + "/" + digestOf(manifest)[7:] + "/data":                 manifest,
+		root + "blobs/sha256/" + digestOf(layer)[7:9] + "/" + digestOf(layer)[7:] + "/data":                       layer,
+		root + "blobs/sha256/" + digestOf(config)[7:9] + "/" + digestOf(config)[7:] + "/data":                     config,
+		root + "blobs/sha256/" + digestOf([]byte("secret"))[7:9] + "/" + digestOf([]byte("secret"))[7:] + "/data": []byte("secret"),
+	}
+	var requests, unsigned atomic.Int32
+	bucket := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		// 用相同的凭据与时间重新签名，签名不一致时按 S3 的方式拒绝
+		signedAt, _ := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+		check, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+		signRequestV4(check, r.Header.Get("X-Amz-Content-Sha256"), &awsCredentials{AccessKeyID: "AKTEST", SecretAccessKey: "bucket-secret"}, "auto", "s3", signedAt)
+		if r.Header.Get("Authorization") == "" || check.Header.Get("Authorization") != r.Header.Get("Authorization") {
+			unsigned.Add(1)
+			w.WriteHeader(http.StatusForbidden)
+			io.WriteString(w, "<Error><Code>SignatureDoesNotMatch</Code><Message>bad signature</Message></Error>")
+			return
+		}
+		key, ok := strings.CutPrefix(r.URL.Path, "/images/")
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, "<Error><Code>NoSuchBucket</Code></Error>")
+			return
+		}
+		if key == "" {
+			prefix, seen := r.URL.Query().Get("prefix"), make(map[string]bool)
+			var b strings.Builder
+			b.WriteString("<ListBucketResult>")
+			for name := range objects {
+				if rest, ok := strings.CutPrefix(name, prefix); ok && strings.Contains(rest, "/") {
+					dir := prefix + rest[:strings.Index(rest, "/")+1]
+					if !seen[dir] {
+						seen[dir] = true
+						fmt.Fprintf(&b, "<CommonPrefixes><Prefix>%s</Prefix></CommonPrefixes>", dir)
+					}
+				}
+			}
+			b.WriteString("<IsTruncated>false</IsTruncated></ListBucketResult>")
+			io.WriteString(w, b.String())
+			return
+		}
+		data, ok := objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, "<Error><Code>NoSuchKey</Code></Error>")
+			return
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+	t.Cleanup(bucket.Close)
+
+	t.Setenv("TESTBUCKET_ACCESS_KEY_ID", "AKTEST")
+	t.Setenv("TESTBUCKET_SECRET_ACCESS_KEY", "bucket-secret")
+	p, client := newTestProxy(t, newFakeRegistry(t), map[string]string{
+		"BUCKET_ROUTES": "exports=s3://images/exports;region:auto;endpoint:" + bucket.URL + ";credentials:testbucket",
+	})
+	get := func(path string, header http.Header) (*http.Response, []byte) {
+		t.Helper()
+		req, _ := http.NewRequest("GET", client.base+path, nil)
+		req.Host = "exports.example.test"
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		resp, err := client.http.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, body
+	}
+
+	if resp, body := get("/v2/", nil); resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /v2/: status %d: %s", resp.StatusCode, body)
+	}
+	resp, body := get("/v2/team/app/manifests/v1", http.Header{"Accept": {fakeManifestType}})
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, manifest) {
+		t.Fatalf("manifest by tag: status %d: %s", resp.StatusCode, body)
+	}
+	if ct, digest := resp.Header.Get("Content-Type"), resp.Header.Get("Docker-Content-Digest"); ct != MediaTypeOCIManifest || digest != digestOf(manifest) {
+		t.Errorf("manifest Content-Type %q, digest %q", ct, digest)
+	}
+	if resp, _ := get("/v2/team/app/manifests/"+digestOf(manifest), nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("manifest by digest: status %d", resp.StatusCode)
+	}
+	// 其他仓库没有该 manifest 的 revision 链接
+	if resp, _ := get("/v2/team/other/manifests/"+digestOf(manifest), nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("manifest by digest in unlinked repository: status %d, want 404", resp.StatusCode)
+	}
+	if resp, body := get("/v2/team/app/blobs/"+digestOf(layer), nil); resp.StatusCode != http.StatusOK || !bytes.Equal(body, layer) {
+		t.Errorf("blob: status %d, body %q", resp.StatusCode, body)
+	}
+	waitCached(t, p, "team/app", "v1", []string{digestOf(layer)})
+	if resp, _ := get("/v2/team/app/blobs/"+digestOf([]byte("secret")), nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("blob not linked to the repository: status %d, want 404", resp.StatusCode)
+	}
+	if resp, _ := get("/v2/team/app/manifests/missing", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("missing tag: status %d, want 404", resp.StatusCode)
+	}
+
+	resp, body = get("/v2/team/app/tags/list", nil)
+	var tags struct {
+		Name string   `json:"name"`
+		Tags []string `json:"tags"`
+	}
+	if err := json.Unmarshal(body, &tags); err != nil || resp.StatusCode != http.StatusOK || strings.Join(tags.Tags, ",") != "v1,v2" {
+		t.Errorf("tags list: status %d: %s", resp.StatusCode, body)
+	}
+	if unsigned.Load() != 0 || requests.Load() == 0 {
+		t.Errorf("bucket requests = %d, rejected signatures = %d", requests.Load(), unsigned.Load())
+	}
+
+	// 凭据错误不会被当作镜像不存在
+	t.Setenv("TESTBUCKET_SECRET_ACCESS_KEY", "wrong")
+	if err := p.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if resp, body := get("/v2/team/app/manifests/v2", nil); resp.StatusCode != http.StatusBadGateway || !strings.Contains(string(body), "SignatureDoesNotMatch") {
+		t.Errorf("wrong credentials: status %d: %s", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// readArchive 读取 tar 归档中的所有文件
+func readArchive(t *testing.T, path string) map[string][]byte {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	files := make(map[string][]byte)
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[hdr.Name], _ = io.ReadAll(tr)
+	}
+}
+
+func TestCacheExportImportRoundTrip(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	manifestDigest, layers := upstream.addImage("team/app", "v1", []byte("exported layer"))
+	sourceDir := t.TempDir()
+	p, client := newTestProxy(t, upstream, map[string]string{"CACHE_DIR": sourceDir})
+	client.login("team/app")
+	client.pull("team/app", "v1")
+	waitCached(t, p, "team/app", "v1", layers)
+
+	archive := filepath.Join(t.TempDir(), "app.tar")
+	if code := runCacheExport([]string{"-dir", sourceDir, "-format", "docker", "-o", archive, testRegistryHost + "/team/app:v1"}); code != 0 {
+		t.Fatalf("cache export exited %d", code)
+	}
+	files := readArchive(t, archive)
+	if _, ok := files[blobEntryName(layers[0])]; !ok {
+		t.Errorf("archive is missing layer %s", layers[0])
+	}
+	var index ImageManifest
+	if err := json.Unmarshal(files[ociIndexFile], &index); err != nil || len(index.Manifests) != 1 || index.Manifests[0].Digest != manifestDigest {
+		t.Fatalf("index.json = %s", files[ociIndexFile])
+	}
+	var dockerManifest []struct{ RepoTags []string }
+	if err := json.Unmarshal(files[dockerManifestFile], &dockerManifest); err != nil || len(dockerManifest) != 1 || len(dockerManifest[0].RepoTags) != 1 {
+		t.Errorf("manifest.json = %s", files[dockerManifestFile])
+	}
+
+	// 导入到新的缓存目录后，上游没有该镜像也能拉取
+	targetDir := t.TempDir()
+	if code := runCacheImport([]string{"-dir", targetDir, archive}); code != 0 {
+		t.Fatalf("cache import exited %d", code)
+	}
+	_, offline := newTestProxy(t, newFakeRegistry(t), map[string]string{"CACHE_DIR": targetDir})
+	offline.login("team/app")
+	offline.pull("team/app", "v1")
+	resp, _ := offline.do("GET", "/v2/team/app/blobs/"+layers[0], nil)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Cache") != "HIT" {
+		t.Errorf("imported blob: status %d, X-Cache %q", resp.StatusCode, resp.Header.Get("X-Cache"))
+	}
+}
+
+func TestParseImageRef(t *testing.T) {
+	for image, want := range map[string][2]string{
+		"nginx":                            {"library/nginx", "latest"},
+		"team/app:v1":                      {"team/app", "v1"},
+		"registry.example.com/team/app:v1": {"team/app", "v1"},
+		"localhost/app@sha256:abc":         {"library/app", "sha256:abc"},
+		"localhost:5000/team/app":          {"team/app", "latest"},
+	} {
+		if repo, reference := parseImageRef(image); repo != want[0] || reference != want[1] {
+			t.Errorf("parseImageRef(%q) = %q, %q; want %q, %q", image, repo, reference, want[0], want[1])
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package proxy
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+// =============================================================================
+// 客户端缓存控制 - Cache-Control: no-cache / max-age=0 时向上游确认 manifest，
+// X-Proxy-Refresh 强制重新拉取；blob 按 digest 寻址，始终直接使用缓存
+// =============================================================================
+
+// 客户端请求的缓存行为
+const (
+	clientCacheDefault    = iota
+	clientCacheRevalidate // 向上游确认 manifest 未变化后再使用缓存
+	clientCacheRefresh    // 忽略缓存，重新拉取 manifest
+)
+
+// clientCacheDirective 解析客户端的 X-Proxy-Refresh、Cache-Control 与 Pragma 请求头
+func clientCacheDirective(r *http.Request) int {
+	if refresh := strings.ToLower(r.Header.Get("X-Proxy-Refresh")); refresh == "1" || refresh == "true" {
+		return clientCacheRefresh
+	}
+	for _, value := range r.Header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			switch strings.ToLower(strings.ReplaceAll(directive, " ", "")) {
+			case "no-cache", "no-store", "max-age=0":
+				return clientCacheRevalidate
+			}
+		}
+	}
+	if strings.EqualFold(r.Header.Get("Pragma"), "no-cache") {
+		return clientCacheRevalidate
+	}
+	return clientCacheDefault
+}
+
+// revalidateManifest 以缓存的 digest 向上游发起条件请求（If-None-Match），
+// 上游返回 304 或相同 digest 时刷新有效期并返回 true，继续使用缓存；
+// manifest 已变化或需要认证等情况返回 false，由调用方按缓存未命中重新拉取。
+// 按 digest 引用的 manifest 不可变，上游不可达或因 429 暂停时同样继续使用缓存
+func (p *ProxyServer) revalidateManifest(r *http.Request, upstream, cacheKey string, entry *cache.CacheEntry) bool {
+	if cache.ContentClass(cacheKey) == cache.ContentClassBlob {
+		return true
+	}
+	digest := entry.Descriptor.Digest
+	if values := entry.Headers["Docker-Content-Digest"]; len(values) > 0 {
+		digest = values[0]
+	}
+	if digest == "" || (len(entry.Data) == 0 && r.Method != http.MethodHead) {
+		return false
+	}
+
+	upstreamURL, err := url.Parse(upstream + p.flavorFor(upstream).upstreamPath(r.URL.Path))
+	if err != nil {
+		return false
+	}
+	// 上游因 429 暂停期间不发起确认请求，直接使用缓存
+	if p.rateLimits.pausedFor(upstreamURL.Host) > 0 {
+		if p.config.Debug {
+			log.Printf("[DEBUG] Upstream rate limited, skipping manifest revalidation: %s", cacheKey)
+		}
+		return true
+	}
+	req := p.createProxyRequest(r, upstreamURL)
+	req.Header.Del("If-Modified-Since")
+	req.Header.Set("If-None-Match", `"`+digest+`"`)
+
+	resp, err := p.roundTrip(req)
+	if err != nil {
+		if p.config.Debug {
+			log.Printf("[DEBUG] Manifest revalidation failed, serving cached copy: %s: %v", cacheKey, err)
+		}
+		return true
+	}
+	defer resp.Body.Close()
+
+	unchanged := resp.StatusCode == http.StatusNotModified ||
+		(resp.StatusCode == http.StatusOK && resp.Header.Get("Docker-Content-Digest") == digest)
+	if !unchanged {
+		if p.config.Debug {
+			log.Printf("[DEBUG] Manifest changed upstream (status %d, digest %q), refetching: %s",
+				resp.StatusCode, resp.Header.Get("Docker-Content-Digest"), cacheKey)
+		}
+		return false
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, retryDrainLimit))
+
+	// 上游确认未变化，按本次响应重新计算有效期
+	if ttl := p.cacheManager.TTLFor(cacheKey, resp.Header); ttl > 0 {
+		refreshed := *entry
+		refreshed.ExpiresAt = time.Now().Add(ttl)
+		if err := p.cacheManager.Put(cacheKey, &refreshed); err != nil && p.config.Debug {
+			log.Printf("[DEBUG] Failed to refresh manifest expiry: %s: %v", cacheKey, err)
+		}
+	}
+	if p.config.Debug {
+		log.Printf("[DEBUG] Manifest revalidated (status %d): %s", resp.StatusCode, cacheKey)
+	}
+	return true
+}
@@ -0,0 +1,185 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+// TestClientRefreshRefetchesManifest 标签在上游变化后，默认请求继续命中缓存，
+// Cache-Control: no-cache 向上游确认后拉取新内容，X-Proxy-Refresh 直接重新拉取
+func TestClientRefreshRefetchesManifest(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		header http.Header
+	}{
+		{"no-cache", http.Header{"Cache-Control": {"no-cache"}}},
+		{"pragma", http.Header{"Pragma": {"no-cache"}}},
+		{"refresh", http.Header{"X-Proxy-Refresh": {"1"}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			upstream := newFakeRegistry(t)
+			upstream.addImage("team/app", "v1", []byte("old layer"))
+			p, client := newTestProxy(t, upstream, nil)
+			manifestPath := "/v2/team/app/manifests/v1"
+
+			client.login("team/app")
+			old := client.pull("team/app", "v1")
+			waitCached(t, p, "team/app", "v1", nil)
+			upstream.addImage("team/app", "v1", []byte("new layer"))
+			fetches := upstream.count("GET", manifestPath)
+
+			resp, body := client.do("GET", manifestPath, http.Header{"Accept": {fakeManifestType}})
+			if resp.Header.Get("X-Cache") != "HIT" || !bytes.Equal(body, old) {
+				t.Fatalf("plain request: X-Cache %q, want cached manifest", resp.Header.Get("X-Cache"))
+			}
+			if n := upstream.count("GET", manifestPath); n != fetches {
+				t.Fatalf("plain request contacted upstream %d times", n-fetches)
+			}
+
+			header := tc.header.Clone()
+			header.Set("Accept", fakeManifestType)
+			resp, body = client.do("GET", manifestPath, header)
+			if resp.StatusCode != http.StatusOK || bytes.Equal(body, old) {
+				t.Fatalf("%s request: status %d, got the cached manifest", tc.name, resp.StatusCode)
+			}
+			if n := upstream.count("GET", manifestPath); n == fetches {
+				t.Fatalf("%s request did not contact upstream", tc.name)
+			}
+
+			// 重新拉取的内容替换缓存
+			updated := body
+			eventually(t, "cache update", func() bool {
+				resp, body := client.do("GET", manifestPath, http.Header{"Accept": {fakeManifestType}})
+				return resp.Header.Get("X-Cache") == "HIT" && bytes.Equal(body, updated)
+			})
+		})
+	}
+}
+
+// TestClientRevalidationKeepsUnchangedManifest 上游未变化时 no-cache 只发起条件请求，继续使用缓存
+func TestClientRevalidationKeepsUnchangedManifest(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	upstream.addImage("team/app", "v1", []byte("layer"))
+	p, client := newTestProxy(t, upstream, nil)
+	manifestPath := "/v2/team/app/manifests/v1"
+
+	client.login("team/app")
+	want := client.pull("team/app", "v1")
+	waitCached(t, p, "team/app", "v1", nil)
+
+	resp, body := client.do("GET", manifestPath, http.Header{"Accept": {fakeManifestType}, "Cache-Control": {"no-cache"}})
+	if resp.Header.Get("X-Cache") != "HIT" || !bytes.Equal(body, want) {
+		t.Fatalf("X-Cache %q, want revalidated cache hit", resp.Header.Get("X-Cache"))
+	}
+	if got := upstream.header("GET", manifestPath).Get("If-None-Match"); got == "" {
+		t.Error("revalidation was not a conditional request")
+	}
+}
+
+// TestClientRefreshRequiresAuth 刷新请求同样经过客户端认证，未认证时不回源
+func TestClientRefreshRequiresAuth(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	upstream.addImage("team/app", "v1", []byte("layer"))
+	p, client := newTestProxy(t, upstream, map[string]string{
+		"AUTH_HTPASSWD": writeHtpasswd(t, map[string]string{"dev": "s3cret"}),
+	})
+	manifestPath := "/v2/team/app/manifests/v1"
+
+	authPath := "/v2/auth?" + url.Values{"service": {"go-docker-proxy"}, "scope": {"repository:team/app:pull"}}.Encode()
+	resp, body := client.do("GET", authPath, basicAuth("dev", "s3cret"))
+	var token struct {
+		Token string `json:"token"`
+	}
+	if resp.StatusCode != http.StatusOK || json.Unmarshal(body, &token) != nil {
+		t.Fatalf("GET /v2/auth: status %d: %s", resp.StatusCode, body)
+	}
+	client.token = token.Token
+	client.pull("team/app", "v1")
+	waitCached(t, p, "team/app", "v1", nil)
+	fetches := upstream.count("GET", manifestPath)
+
+	client.token = ""
+	for _, refresh := range []http.Header{
+		{"X-Proxy-Refresh": {"1"}},
+		{"Cache-Control": {"no-cache"}},
+	} {
+		refresh.Set("Accept", fakeManifestType)
+		if resp, _ := client.do("GET", manifestPath, refresh); resp.StatusCode != http.StatusUnauthorized {
+			t.Errorf("unauthenticated %v: status %d, want 401", refresh, resp.StatusCode)
+		}
+	}
+	if n := upstream.count("GET", manifestPath); n != fetches {
+		t.Errorf("unauthenticated refreshes reached upstream %d times", n-fetches)
+	}
+
+	client.token = token.Token
+	if resp, _ := client.do("GET", manifestPath, http.Header{"Accept": {fakeManifestType}, "X-Proxy-Refresh": {"1"}}); resp.StatusCode != http.StatusOK {
+		t.Errorf("authenticated refresh: status %d", resp.StatusCode)
+	}
+	if n := upstream.count("GET", manifestPath); n != fetches+1 {
+		t.Errorf("authenticated refresh: upstream requests = %d, want 1", n-fetches)
+	}
+}
+
+// TestClientRefreshRateLimited 刷新请求计入客户端限流，被限流时不回源
+func TestClientRefreshRateLimited(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	upstream.addImage("team/app", "v1", []byte("layer"))
+	_, client := newTestProxy(t, upstream, map[string]string{
+		"CLIENT_RATE_LIMIT": "0.01",
+		"CLIENT_RATE_BURST": "10",
+	})
+	manifestPath := "/v2/team/app/manifests/v1"
+	client.login("team/app")
+
+	header := http.Header{"Accept": {fakeManifestType}, "X-Proxy-Refresh": {"1"}}
+	for i := 0; i < 10; i++ {
+		fetches := upstream.count("GET", manifestPath)
+		resp, _ := client.do("GET", manifestPath, header)
+		if resp.StatusCode != http.StatusTooManyRequests {
+			continue
+		}
+		if n := upstream.count("GET", manifestPath); n != fetches {
+			t.Errorf("rate limited refresh reached upstream")
+		}
+		return
+	}
+	t.Fatal("refresh requests were never rate limited")
+}
+
+// TestClientRefreshWhileUpstreamPaused 上游因 429 暂停期间，刷新与确认请求都不回源，返回缓存内容
+func TestClientRefreshWhileUpstreamPaused(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	upstream.addImage("team/app", "v1", []byte("layer"))
+	upstream.addImage("team/app", "v2", []byte("other layer"))
+	p, client := newTestProxy(t, upstream, nil)
+	v1Path, v2Path := "/v2/team/app/manifests/v1", "/v2/team/app/manifests/v2"
+
+	client.login("team/app")
+	want := client.pull("team/app", "v1")
+	waitCached(t, p, "team/app", "v1", nil)
+
+	// 一次未缓存的请求触发上游 429，此后上游暂停
+	upstream.configure(func(f *fakeRegistry) { f.throttle = 1 })
+	if resp, _ := client.do("GET", v2Path, http.Header{"Accept": {fakeManifestType}}); resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("throttled request: status %d, want 429", resp.StatusCode)
+	}
+	fetches := upstream.count("GET", v1Path)
+
+	for _, refresh := range []http.Header{
+		{"Cache-Control": {"no-cache"}},
+		{"X-Proxy-Refresh": {"1"}},
+	} {
+		refresh.Set("Accept", fakeManifestType)
+		resp, body := client.do("GET", v1Path, refresh)
+		if resp.StatusCode != http.StatusOK || !bytes.Equal(body, want) {
+			t.Errorf("%v while paused: status %d, want cached manifest", refresh, resp.StatusCode)
+		}
+	}
+	if n := upstream.count("GET", v1Path); n != fetches {
+		t.Errorf("upstream contacted %d times while paused", n-fetches)
+	}
+}
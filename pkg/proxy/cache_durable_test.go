@@ -0,0 +1,58 @@
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestCacheStartupReconciliation 覆盖启动时的崩溃恢复：删除残留临时文件、没有 .meta 的数据文件与孤立 .meta，
+// 并在 CACHE_FSYNC 下正常缓存新内容
+func TestCacheStartupReconciliation(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-time.Hour)
+	leftover := func(path string) string {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("leftover"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, old, old); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	hash := strings.Repeat("ab", 32)
+	leftovers := []string{
+		leftover("blobs/ab/ab/blob-123"),
+		leftover("blobs/ab/ab/blob-meta-456"),
+		leftover("blobs/ab/ab/" + hash),
+		leftover("blobs/cd/cd/" + strings.Repeat("cd", 32) + ".meta"),
+		leftover("manifests/ab/cd/manifest-789"),
+	}
+
+	upstream := newFakeRegistry(t)
+	_, layers := upstream.addImage("team/app", "v1", []byte("durable layer"))
+	p, client := newTestProxy(t, upstream, map[string]string{"CACHE_DIR": dir, "CACHE_FSYNC": "true"})
+
+	eventually(t, "leftover files removed", func() bool {
+		for _, path := range leftovers {
+			if _, err := os.Stat(path); err == nil {
+				return false
+			}
+		}
+		return true
+	})
+
+	client.login("team/app")
+	client.pull("team/app", "v1")
+	waitCached(t, p, "team/app", "v1", layers)
+	meta := p.cacheManager.BlobStore().Path(layers[0]) + ".meta"
+	if _, err := os.Stat(meta); err != nil {
+		t.Errorf("blob metadata not written: %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+// =============================================================================
+// 缓存加密密钥 - CACHE_ENCRYPTION_KEY / CACHE_ENCRYPTION_KEY_FILE / CACHE_ENCRYPTION_KEY_KMS
+// =============================================================================
+
+// CacheEncryptionConfig 缓存加密密钥来源，按 Key、KeyFile、KMSKey 的顺序取第一个已配置的
+type CacheEncryptionConfig struct {
+	Key     string // 64 位十六进制或 base64 编码的密钥
+	KeyFile string // 密钥文件路径
+	KMSKey  string // AWS KMS 加密的数据密钥（base64）
+}
+
+// loadCacheEncryptionConfig 从环境变量读取缓存加密密钥来源
+func loadCacheEncryptionConfig() CacheEncryptionConfig {
+	return CacheEncryptionConfig{
+		Key:     getEnv("CACHE_ENCRYPTION_KEY", ""),
+		KeyFile: getEnv("CACHE_ENCRYPTION_KEY_FILE", ""),
+		KMSKey:  getEnv("CACHE_ENCRYPTION_KEY_KMS", ""),
+	}
+}
+
+// Source 描述配置的密钥来源，未配置加密时返回空字符串
+func (c CacheEncryptionConfig) Source() string {
+	switch {
+	case c.Key != "":
+		return "CACHE_ENCRYPTION_KEY"
+	case c.KeyFile != "":
+		return "file " + c.KeyFile
+	case c.KMSKey != "":
+		return "AWS KMS"
+	}
+	return ""
+}
+
+// loadCacheCipher 按配置加载缓存加密密钥，未配置时返回 nil；source 描述密钥来源
+func loadCacheCipher(config CacheEncryptionConfig) (c *cache.Cipher, source string, err error) {
+	var key []byte
+	switch {
+	case config.Key != "":
+		key, err = decodeCacheKey([]byte(config.Key))
+	case config.KeyFile != "":
+		var data []byte
+		if data, err = os.ReadFile(config.KeyFile); err == nil {
+			key, err = decodeCacheKey(data)
+		}
+	case config.KMSKey != "":
+		key, err = decryptKMSDataKey(context.Background(), config.KMSKey)
+	default:
+		return nil, "", nil
+	}
+	source = config.Source()
+	if err != nil {
+		return nil, source, fmt.Errorf("cache encryption key from %s: %w", source, err)
+	}
+	if c, err = cache.NewCipher(key); err != nil {
+		return nil, source, fmt.Errorf("cache encryption key from %s: %w", source, err)
+	}
+	return c, source, nil
+}
+
+// decodeCacheKey 解析 32 字节密钥：64 位十六进制、base64 或原始字节（密钥文件）
+func decodeCacheKey(data []byte) ([]byte, error) {
+	if len(data) == 32 {
+		return data, nil
+	}
+	text := strings.TrimSpace(string(data))
+	if key, err := hex.DecodeString(text); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(text); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	return nil, fmt.Errorf("expected a 32-byte key as 64 hex characters or base64 (e.g. openssl rand -base64 32)")
+}
+
+// decryptKMSDataKey 调用 AWS KMS Decrypt 解密数据密钥（aws kms generate-data-key --key-spec AES_256
+// 返回的 CiphertextBlob，base64 编码），凭据与区域按 AWS SDK 的默认方式获取
+func decryptKMSDataKey(ctx context.Context, ciphertext string) ([]byte, error) {
+	region := awsRegionFromEnv()
+	if region == "" {
+		return nil, fmt.Errorf("AWS_REGION is required for KMS")
+	}
+	provider := NewAWSCredentialProvider(&http.Client{Timeout: 30 * time.Second})
+	creds, err := provider.Retrieve(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, _ := json.Marshal(map[string]string{"CiphertextBlob": strings.TrimSpace(ciphertext)})
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://kms."+region+".amazonaws.com/", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService.Decrypt")
+	signRequestV4(req, sha256Hex(payload), creds, region, "kms", time.Now())
+
+	body, err := provider.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("KMS Decrypt failed: %w", err)
+	}
+	var result struct {
+		Plaintext []byte `json:"Plaintext"` // base64，由 encoding/json 解码
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("invalid KMS Decrypt response: %w", err)
+	}
+	return result.Plaintext, nil
+}
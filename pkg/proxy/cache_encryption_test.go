@@ -0,0 +1,30 @@
+package proxy
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestEncryptedCacheServesPlaintext(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	layer := bytes.Repeat([]byte("encrypted layer data "), 8192) // 跨越多个加密分段
+	_, layers := upstream.addImage("team/app", "v1", layer)
+	p, client := newTestProxy(t, upstream, map[string]string{
+		"CACHE_ENCRYPTION_KEY":    "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=",
+		"HOT_CACHE_MAX_ITEM_SIZE": "1KB",
+	})
+
+	client.login("team/app")
+	client.pull("team/app", "v1")
+	waitCached(t, p, "team/app", "v1", layers)
+
+	onDisk, err := os.ReadFile(p.cacheManager.BlobStore().Path(layers[0]))
+	if err != nil || bytes.Contains(onDisk, []byte("encrypted layer data")) {
+		t.Fatalf("blob stored in plaintext (err %v)", err)
+	}
+	resp, body := client.do("GET", "/v2/team/app/blobs/"+layers[0], nil)
+	if resp.Header.Get("X-Cache") != "HIT" || !bytes.Equal(body, layer) {
+		t.Fatalf("X-Cache %q, intact=%v; want decrypted cache hit", resp.Header.Get("X-Cache"), bytes.Equal(body, layer))
+	}
+}
@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+	"github.com/go-chi/chi/v5"
+)
+
+// =============================================================================
+// 缓存回收管理接口 - 立即执行回收（可指定目标大小、只统计不删除），并查询进度与最近一次结果，
+// 不必等待后台每 CACHE_CLEANUP_INTERVAL 一次的清理
+// =============================================================================
+
+// registerGCAdminRoutes 缓存回收管理接口
+//
+//	POST /admin/gc          {"targetSize": "5GB", "dryRun": true, "wait": false}
+//	GET  /admin/gc/status   正在执行的回收进度与最近一次结果
+func (p *ProxyServer) registerGCAdminRoutes(r chi.Router) {
+	r.Post("/gc", p.handleAdminGC)
+	r.Get("/gc/status", func(w http.ResponseWriter, r *http.Request) {
+		current, last := p.cacheManager.GCStatus()
+		p.writeJSON(w, http.StatusOK, map[string]interface{}{
+			"running": current != nil,
+			"current": current,
+			"last":    last,
+		})
+	})
+}
+
+// handleAdminGC 开始一次回收：默认在后台执行并返回 202，wait 为 true 时执行完成后返回结果
+func (p *ProxyServer) handleAdminGC(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		TargetSize string `json:"targetSize"`
+		DryRun     bool   `json:"dryRun"`
+		Wait       bool   `json:"wait"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		p.writeErrorResponse(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	opts := cache.GCOptions{DryRun: req.DryRun, Trigger: "manual"}
+	if req.TargetSize != "" {
+		size, err := parseSizeValue(req.TargetSize)
+		if err != nil || size <= 0 {
+			p.writeErrorResponse(w, fmt.Sprintf("invalid targetSize %q: must be a positive size", req.TargetSize), http.StatusBadRequest)
+			return
+		}
+		opts.TargetSize = size
+	}
+
+	var status *cache.GCStatus
+	var err error
+	if req.Wait {
+		status, err = p.cacheManager.RunGC(r.Context(), opts)
+	} else {
+		status, err = p.cacheManager.StartGC(opts)
+	}
+	switch {
+	case errors.Is(err, cache.ErrGCRunning):
+		p.writeErrorResponse(w, err.Error(), http.StatusConflict)
+	case req.Wait:
+		p.writeJSON(w, http.StatusOK, status)
+	default:
+		p.writeJSON(w, http.StatusAccepted, status)
+	}
+}
@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+// TestAdminGC 覆盖 /admin/gc：dry-run 只统计，目标大小以下按缓存时间淘汰 blob（包括内存缓存），状态接口返回最近一次结果
+func TestAdminGC(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	_, layers := upstream.addImage("team/app", "v1", []byte("collected layer"))
+	p, client := newTestProxy(t, upstream, map[string]string{"ADMIN_TOKEN": "admin-token"})
+
+	client.login("team/app")
+	client.pull("team/app", "v1")
+	waitCached(t, p, "team/app", "v1", layers)
+	blobKey := cache.CacheKey(testRegistryHost, "/v2/team/app/blobs/"+layers[0])
+
+	client.token = "admin-token"
+	gc := func(body string) (int, cache.GCStatus) {
+		req, err := http.NewRequest(http.MethodPost, client.base+"/admin/gc", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer admin-token")
+		resp, err := client.http.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var status cache.GCStatus
+		json.NewDecoder(resp.Body).Decode(&status)
+		return resp.StatusCode, status
+	}
+
+	code, status := gc(`{"targetSize": "1B", "dryRun": true, "wait": true}`)
+	if code != http.StatusOK || !status.DryRun || status.BlobsDeleted != 2 || status.ReclaimedBytes == 0 {
+		t.Fatalf("dry run: status %d, %+v", code, status)
+	}
+	if _, reader, found := p.cacheManager.GetBlobReader(blobKey); !found {
+		t.Fatal("dry run deleted a blob")
+	} else {
+		reader.Close()
+	}
+
+	if code, _ := gc(`{"targetSize": "0"}`); code != http.StatusBadRequest {
+		t.Errorf("targetSize 0: status %d", code)
+	}
+
+	code, status = gc(`{"targetSize": "1B"}`)
+	if code != http.StatusAccepted || status.Trigger != "manual" {
+		t.Fatalf("gc: status %d, %+v", code, status)
+	}
+	var result struct {
+		Running bool
+		Last    *cache.GCStatus
+	}
+	eventually(t, "gc finished", func() bool {
+		_, body := client.do(http.MethodGet, "/admin/gc/status", nil)
+		json.Unmarshal(body, &result)
+		return !result.Running && result.Last != nil && !result.Last.DryRun
+	})
+	if result.Last.BlobsDeleted != 2 || result.Last.Phase != cache.GCPhaseDone || result.Last.Error != "" {
+		t.Errorf("last gc = %+v", result.Last)
+	}
+	if _, _, found := p.cacheManager.GetBlobReader(blobKey); found {
+		t.Error("blob still served from cache after gc")
+	}
+}
@@ -0,0 +1,196 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+// =============================================================================
+// 缓存迁移 - go-docker-proxy cache migrate，将旧版 FileCache 条目转换为当前的 blob / manifest 布局
+// =============================================================================
+
+// legacyMeta 旧版 FileCache 的 .meta 内容
+type legacyMeta struct {
+	Key         string              `json:"key"`
+	Headers     map[string][]string `json:"headers"`
+	StatusCode  int                 `json:"statusCode"`
+	ContentType string              `json:"contentType"`
+	ExpiresAt   time.Time           `json:"expiresAt"`
+}
+
+// migrateReport 迁移结果
+type migrateReport struct {
+	Blobs     int
+	Manifests int
+	Bytes     int64
+	Expired   int
+	Corrupted int
+	Skipped   int
+	Errors    int
+}
+
+// runCacheMigrate 迁移旧版缓存目录并写入格式版本
+func runCacheMigrate(args []string) int {
+	fs := flag.NewFlagSet("cache migrate", flag.ExitOnError)
+	dir := fs.String("dir", getEnv("CACHE_DIR", "./cache"), "Cache directory")
+	keep := fs.Bool("keep", false, "Keep the legacy files after converting them")
+	dryRun := fs.Bool("dry-run", false, "Only report what would be migrated, do not modify the cache")
+	fs.Parse(args)
+
+	version, err := cache.ReadFormatVersion(*dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read cache format of %s: %v\n", *dir, err)
+		return 1
+	}
+	if version > cache.FormatCurrent {
+		fmt.Fprintf(os.Stderr, "Cache directory %s uses format version %d, this build supports up to %d\n",
+			*dir, version, cache.FormatCurrent)
+		return 1
+	}
+
+	entries := cache.LegacyEntries(*dir)
+	cm := openOfflineCache(*dir)
+	report := &migrateReport{}
+	start := time.Now()
+	for _, path := range entries {
+		migrated, err := migrateLegacyEntry(cm, path, report, *dryRun)
+		if err != nil {
+			report.Errors++
+			fmt.Fprintf(os.Stderr, "  ✗ %s: %v\n", path, err)
+			continue
+		}
+		// 无法识别的条目保留在原处，由用户自行处理
+		if !migrated {
+			report.Skipped++
+			continue
+		}
+		if !*dryRun && !*keep {
+			os.Remove(path)
+			os.Remove(path + ".meta")
+			os.Remove(filepath.Dir(path))
+			os.Remove(filepath.Dir(filepath.Dir(path)))
+		}
+	}
+
+	mode := ""
+	if *dryRun {
+		mode = " (dry run)"
+	}
+	fmt.Printf("Migrated %s%s in %s: %d blobs, %d manifests (%s), %d expired, %d corrupted, %d skipped, %d errors\n",
+		*dir, mode, time.Since(start).Round(time.Millisecond), report.Blobs, report.Manifests,
+		cache.FormatBytes(report.Bytes), report.Expired, report.Corrupted, report.Skipped, report.Errors)
+
+	if report.Errors > 0 {
+		return 1
+	}
+	if !*dryRun {
+		if err := cache.WriteFormatVersion(*dir); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write %s: %v\n", cache.FormatFile, err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// migrateLegacyEntry 转换单个旧版条目：blob 重新计算 digest 后写入 blobs/，
+// manifest 写入 manifests/；已过期、非 200 或无法识别的条目不迁移（返回 false）
+func migrateLegacyEntry(cm *cache.CacheManager, path string, report *migrateReport, dryRun bool) (bool, error) {
+	data, err := os.ReadFile(path + ".meta")
+	if err != nil {
+		return false, nil
+	}
+	var meta legacyMeta
+	if err := json.Unmarshal(data, &meta); err != nil || meta.Key == "" {
+		return false, nil
+	}
+	if !meta.ExpiresAt.IsZero() && time.Now().After(meta.ExpiresAt) {
+		report.Expired++
+		return true, nil
+	}
+	if meta.StatusCode != 0 && meta.StatusCode != 200 {
+		return false, nil
+	}
+	headers := meta.Headers
+	if headers == nil {
+		headers = make(map[string][]string)
+	}
+	if _, ok := headers["Content-Type"]; !ok && meta.ContentType != "" {
+		headers["Content-Type"] = []string{meta.ContentType}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+
+	pathType, repo, reference := cache.ParsePath(meta.Key)
+	switch pathType {
+	case "blob":
+		digest := cache.GetDigestFromPath(meta.Key)
+		if digest == "" {
+			return false, nil
+		}
+		if !dryRun {
+			err := migrateLegacyBlob(cm, path, digest, headers, info.Size())
+			if errors.Is(err, cache.ErrDigestMismatch) {
+				// 内容已损坏，无法提供给客户端，与过期条目一样直接删除
+				report.Corrupted++
+				return true, nil
+			}
+			if err != nil {
+				return false, err
+			}
+		}
+		report.Blobs++
+	case "manifest":
+		if !dryRun {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return false, err
+			}
+			if err := cm.PutManifest(context.Background(), repo, reference, content, headers, 200); err != nil {
+				return false, err
+			}
+		}
+		report.Manifests++
+	default:
+		return false, nil
+	}
+	report.Bytes += info.Size()
+	return true, nil
+}
+
+// migrateLegacyBlob 流式写入 blob，digest 不一致的内容不会提交
+func migrateLegacyBlob(cm *cache.CacheManager, path, digest string, headers map[string][]string, size int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	mediaType := ""
+	if ct := headers["Content-Type"]; len(ct) > 0 {
+		mediaType = ct[0]
+	}
+	bw, err := cm.BlobWriter(digest, mediaType)
+	if errors.Is(err, cache.ErrBlobExists) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(bw, f); err != nil {
+		bw.Cancel()
+		return err
+	}
+	return bw.Commit(size)
+}
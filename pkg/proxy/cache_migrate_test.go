@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+// captureOutput 运行子命令并返回其标准输出与标准错误
+func captureOutput(t *testing.T, fn func()) (stdout, stderr string) {
+	t.Helper()
+	capture := func(target **os.File) func() string {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		saved := *target
+		*target = w
+		done := make(chan string)
+		go func() {
+			data, _ := io.ReadAll(r)
+			done <- string(data)
+		}()
+		return func() string {
+			*target = saved
+			w.Close()
+			return <-done
+		}
+	}
+	restoreStdout, restoreStderr := capture(&os.Stdout), capture(&os.Stderr)
+	defer func() {
+		stdout, stderr = restoreStdout(), restoreStderr()
+	}()
+	fn()
+	return
+}
+
+// writeLegacyEntry 按旧版 FileCache 布局写入条目：{dir}/ab/cd/{sha256(key)} 与同名 .meta
+func writeLegacyEntry(t *testing.T, dir, key string, content []byte, meta legacyMeta) string {
+	t.Helper()
+	sum := sha256.Sum256([]byte(key))
+	hash := hex.EncodeToString(sum[:])
+	path := filepath.Join(dir, hash[:2], hash[2:4], hash)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	meta.Key = key
+	data, _ := json.Marshal(meta)
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path+".meta", data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCacheMigrateLegacyLayout(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("CACHE_DIR", dir)
+	layer := []byte("legacy layer")
+	layerDigest := fakeDigest(layer)
+	manifest := []byte(`{"schemaVersion":2,"layers":[{"digest":"` + layerDigest + `"}]}`)
+	future := time.Now().Add(time.Hour)
+
+	blob := writeLegacyEntry(t, dir, cache.CacheKey(testRegistryHost, "/v2/team/app/blobs/"+layerDigest), layer,
+		legacyMeta{StatusCode: 200, ContentType: "application/octet-stream", ExpiresAt: future})
+	tag := writeLegacyEntry(t, dir, cache.CacheKey(testRegistryHost, "/v2/team/app/manifests/v1"), manifest,
+		legacyMeta{StatusCode: 200, Headers: map[string][]string{"Content-Type": {fakeManifestType}}, ExpiresAt: future})
+	expired := writeLegacyEntry(t, dir, cache.CacheKey(testRegistryHost, "/v2/team/app/manifests/old"), manifest,
+		legacyMeta{StatusCode: 200, ExpiresAt: time.Now().Add(-time.Hour)})
+	corrupted := writeLegacyEntry(t, dir, cache.CacheKey(testRegistryHost, "/v2/team/app/blobs/"+fakeDigest([]byte("other"))), []byte("bit rot"),
+		legacyMeta{StatusCode: 200, ExpiresAt: future})
+	notFound := writeLegacyEntry(t, dir, cache.CacheKey(testRegistryHost, "/v2/team/app/manifests/missing"), []byte("{}"),
+		legacyMeta{StatusCode: 404, ExpiresAt: future})
+
+	if version, err := cache.ReadFormatVersion(dir); err != nil || version != cache.FormatLegacy {
+		t.Fatalf("ReadFormatVersion before migration = %d, %v", version, err)
+	}
+	exists := func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+
+	// dry-run 只报告，不修改缓存目录（不读取 blob 内容，损坏的 blob 也计入迁移数）
+	var code int
+	stdout, _ := captureOutput(t, func() { code = runCacheMigrate([]string{"-dry-run"}) })
+	if code != 0 || !strings.Contains(stdout, "(dry run)") || !strings.Contains(stdout, "2 blobs, 1 manifests") {
+		t.Fatalf("cache migrate -dry-run exited %d: %s", code, stdout)
+	}
+	if !exists(blob) || !exists(tag) || exists(filepath.Join(dir, cache.FormatFile)) {
+		t.Fatal("cache migrate -dry-run modified the cache")
+	}
+
+	stdout, stderr := captureOutput(t, func() { code = runCacheMigrate(nil) })
+	if code != 0 {
+		t.Fatalf("cache migrate exited %d: %s%s", code, stdout, stderr)
+	}
+	for _, want := range []string{"1 blobs, 1 manifests", "1 expired", "1 corrupted", "1 skipped", "0 errors"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("migrate report %q missing %q", stdout, want)
+		}
+	}
+	for _, path := range []string{blob, tag, expired, corrupted} {
+		if exists(path) || exists(path+".meta") {
+			t.Errorf("legacy entry %s left after migration", path)
+		}
+	}
+	if !exists(notFound) {
+		t.Error("unrecognized legacy entry was removed")
+	}
+	if version, err := cache.ReadFormatVersion(dir); err != nil || version != cache.FormatCurrent {
+		t.Errorf("ReadFormatVersion after migration = %d, %v", version, err)
+	}
+
+	// 迁移后的内容无需上游即可命中
+	_, client := newTestProxy(t, newFakeRegistry(t), map[string]string{"CACHE_DIR": dir})
+	client.login("team/app")
+	resp, body := client.do("GET", "/v2/team/app/manifests/v1", http.Header{"Accept": {fakeManifestType}})
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Cache") != "HIT" || !bytes.Equal(body, manifest) {
+		t.Errorf("migrated manifest: status %d, X-Cache %q", resp.StatusCode, resp.Header.Get("X-Cache"))
+	}
+	resp, body = client.do("GET", "/v2/team/app/blobs/"+layerDigest, nil)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Cache") != "HIT" || !bytes.Equal(body, layer) {
+		t.Errorf("migrated blob: status %d, X-Cache %q", resp.StatusCode, resp.Header.Get("X-Cache"))
+	}
+}
+
+func TestCacheMigrateRejectsNewerFormat(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, cache.FormatFile), []byte("99\n"), 0o644)
+
+	var code int
+	_, stderr := captureOutput(t, func() { code = runCacheMigrate([]string{"-dir", dir}) })
+	if code != 1 || !strings.Contains(stderr, "format version 99") {
+		t.Errorf("cache migrate on a newer format exited %d: %s", code, stderr)
+	}
+}
@@ -0,0 +1,35 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestCacheQuotaEvictsOnlyMatchingRepos(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	layer := func(name string) []byte { return bytes.Repeat([]byte(name), 40<<10/len(name)) }
+	_, scratch := upstream.addImage("ci-scratch/build", "v1", layer("scratch-1 "), layer("scratch-2 "), layer("scratch-3 "))
+	_, base := upstream.addImage("team/base", "v1", layer("base layer "))
+	p, client := newTestProxy(t, upstream, map[string]string{"CACHE_QUOTAS": "ci-scratch/*=100KB"})
+	cached := func(digest string) bool {
+		_, err := p.cacheManager.BlobStore().Stat(context.Background(), digest)
+		return err == nil
+	}
+	pull := func(repo, digest string) {
+		client.login(repo)
+		client.do("GET", "/v2/"+repo+"/blobs/"+digest, nil)
+		eventually(t, "blob cache fill", func() bool { return cached(digest) })
+	}
+
+	pull("team/base", base[0])
+	for _, digest := range scratch {
+		pull("ci-scratch/build", digest)
+	}
+
+	// 超出配额时淘汰该命名空间最早缓存的 blob，其他仓库不受影响
+	eventually(t, "quota eviction", func() bool { return !cached(scratch[0]) })
+	if !cached(scratch[1]) || !cached(scratch[2]) || !cached(base[0]) {
+		t.Fatalf("cached after eviction: scratch %v %v, base %v", cached(scratch[1]), cached(scratch[2]), cached(base[0]))
+	}
+}
@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+// TestCacheTTLOverrides 覆盖 CACHE_TTL_OVERRIDES：指定路由的 manifest 使用固定有效期（忽略上游响应头），
+// 未指定的类别与其他路由沿用全局设置
+func TestCacheTTLOverrides(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	_, layers := upstream.addImage("team/app", "v1", []byte("layer"))
+	p, client := newTestProxy(t, upstream, map[string]string{
+		"ADMIN_TOKEN":         "admin-token",
+		"CACHE_TTL_OVERRIDES": testRegistryHost + "=manifest:2m",
+	})
+
+	manifestKey := "/v2/team/app/manifests/v1"
+	noCache := http.Header{"Cache-Control": []string{"no-cache"}}
+	if ttl := p.cacheManager.TTLFor(cache.CacheKey(testRegistryHost+":443", manifestKey), noCache); ttl != 2*time.Minute {
+		t.Errorf("overridden manifest TTL = %s, want 2m", ttl)
+	}
+	if ttl := p.cacheManager.TTLFor(cache.CacheKey(testRegistryHost, "/v2/team/app/blobs/"+layers[0]), nil); ttl != p.config.CacheBlobTTL {
+		t.Errorf("blob TTL = %s, want the global %s", ttl, p.config.CacheBlobTTL)
+	}
+	if ttl := p.cacheManager.TTLFor(cache.CacheKey("other.test", manifestKey), nil); ttl != p.config.CacheManifestTTL {
+		t.Errorf("other route manifest TTL = %s, want the global %s", ttl, p.config.CacheManifestTTL)
+	}
+
+	client.login("team/app")
+	client.pull("team/app", "v1")
+	waitCached(t, p, "team/app", "v1", layers)
+	client.token = "admin-token"
+	_, body := client.do(http.MethodGet, "/admin/catalog?repo=team/app", nil)
+	var catalog Catalog
+	if err := json.Unmarshal(body, &catalog); err != nil {
+		t.Fatal(err)
+	}
+	if len(catalog.Repositories) != 1 || len(catalog.Repositories[0].Tags) != 1 {
+		t.Fatalf("catalog = %s", body)
+	}
+	tag := catalog.Repositories[0].Tags[0]
+	if ttl := tag.ExpiresAt.Sub(tag.CachedAt).Round(time.Second); ttl != 2*time.Minute {
+		t.Errorf("cached manifest TTL = %s, want 2m", ttl)
+	}
+}
+
+// TestCacheRouteDisabled 覆盖 CACHE_TTL_OVERRIDES 的 off：该路由的请求每次回源且不写入缓存
+func TestCacheRouteDisabled(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	_, layers := upstream.addImage("staging/app", "dev", []byte("staging layer"))
+	p, client := newTestProxy(t, upstream, map[string]string{"CACHE_TTL_OVERRIDES": testRegistryHost + "=off"})
+
+	client.login("staging/app")
+	client.pull("staging/app", "dev")
+	client.pull("staging/app", "dev")
+
+	if n := upstream.count(http.MethodGet, "/v2/staging/app/manifests/dev"); n != 2 {
+		t.Errorf("upstream manifest requests = %d, want 2", n)
+	}
+	if n := upstream.count(http.MethodGet, "/v2/staging/app/blobs/"+layers[0]); n != 2 {
+		t.Errorf("upstream blob requests = %d, want 2", n)
+	}
+	if _, found := p.cacheManager.Get(cache.CacheKey(testRegistryHost, "/v2/staging/app/manifests/dev")); found {
+		t.Error("manifest was cached for a route with caching disabled")
+	}
+	if _, reader, found := p.cacheManager.GetBlobReader(cache.CacheKey(testRegistryHost, "/v2/staging/app/blobs/"+layers[0])); found {
+		reader.Close()
+		t.Error("blob was cached for a route with caching disabled")
+	}
+}
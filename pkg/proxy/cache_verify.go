@@ -0,0 +1,341 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+// =============================================================================
+// 缓存校验 - go-docker-proxy cache verify，重新计算 blob 哈希并修复损坏的缓存
+// =============================================================================
+
+// verifyReport 缓存校验结果
+type verifyReport struct {
+	Scanned      int
+	Healthy      int
+	Corrupted    int
+	Misplaced    int
+	MetaRepaired int
+	OrphanMeta   int
+	TempFiles    int
+	Unknown      int
+	Errors       int
+	ReclaimedB   int64
+}
+
+// cacheVerifier 遍历 {CACHE_DIR}/blobs 校验每个 blob
+type cacheVerifier struct {
+	store      *cache.FileBlobStore
+	quarantine string // 隔离目录，为空时直接删除损坏文件
+	dryRun     bool
+	report     verifyReport
+}
+
+// cacheUsage cache 子命令用法
+const cacheUsage = `Usage:
+  go-docker-proxy cache verify [-dir DIR] [-quarantine] [-dry-run]
+  go-docker-proxy cache export [-dir DIR] [-format oci|docker] [-platform os/arch] -o FILE IMAGE...
+  go-docker-proxy cache import [-dir DIR] [-repo REPOSITORY] FILE...
+  go-docker-proxy cache migrate [-dir DIR] [-keep] [-dry-run]`
+
+// RunCacheCommand 处理 cache 子命令
+func RunCacheCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, cacheUsage)
+		return 2
+	}
+	switch args[0] {
+	case "verify":
+		return runCacheVerify(args[1:])
+	case "export":
+		return runCacheExport(args[1:])
+	case "import":
+		return runCacheImport(args[1:])
+	case "migrate":
+		return runCacheMigrate(args[1:])
+	}
+	fmt.Fprintln(os.Stderr, cacheUsage)
+	return 2
+}
+
+// runCacheVerify 重新校验所有缓存的 blob
+func runCacheVerify(args []string) int {
+	fs := flag.NewFlagSet("cache verify", flag.ExitOnError)
+	dir := fs.String("dir", getEnv("CACHE_DIR", "./cache"), "Cache directory")
+	quarantine := fs.Bool("quarantine", false, "Move corrupted blobs to {dir}/quarantine instead of deleting them")
+	dryRun := fs.Bool("dry-run", false, "Only report problems, do not modify the cache")
+	fs.Parse(args)
+
+	blobTTL := parseDuration(getEnv("CACHE_BLOB_TTL", "1y"), 365*24*time.Hour)
+	v := &cacheVerifier{
+		store:  cache.NewFileBlobStore(filepath.Join(*dir, "blobs"), blobTTL),
+		dryRun: *dryRun,
+	}
+	cipher, _, err := loadCacheCipher(loadCacheEncryptionConfig())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	v.store.SetCipher(cipher)
+	if *quarantine {
+		v.quarantine = filepath.Join(*dir, "quarantine")
+	}
+
+	if _, err := os.Stat(v.store.Dir()); err != nil {
+		fmt.Fprintf(os.Stderr, "Cache directory %s not found: %v\n", v.store.Dir(), err)
+		return 1
+	}
+
+	start := time.Now()
+	v.run()
+	v.printReport(os.Stdout, time.Since(start))
+
+	if v.report.Errors > 0 {
+		return 1
+	}
+	return 0
+}
+
+func (v *cacheVerifier) run() {
+	var metas []string
+	filepath.Walk(v.store.Dir(), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// 遍历过程中被移动或删除的文件
+			if !os.IsNotExist(err) {
+				v.report.Errors++
+				v.problem("error", path, err.Error())
+			}
+			return nil
+		}
+		if info.IsDir() {
+			return nil
+		}
+		// .meta 在数据文件之后统一处理，以便识别孤立的元数据
+		if strings.HasSuffix(path, ".meta") {
+			metas = append(metas, path)
+			return nil
+		}
+		v.verifyBlob(path, info)
+		return nil
+	})
+
+	for _, metaPath := range metas {
+		if _, err := os.Stat(metaPath); err != nil {
+			continue
+		}
+		if _, err := os.Stat(strings.TrimSuffix(metaPath, ".meta")); os.IsNotExist(err) {
+			v.report.OrphanMeta++
+			v.problem("orphan-meta", metaPath, "metadata without blob data")
+			v.remove(metaPath)
+		}
+	}
+}
+
+// verifyBlob 校验单个数据文件：文件名即 sha256，内容哈希必须一致
+func (v *cacheVerifier) verifyBlob(path string, info os.FileInfo) {
+	name := filepath.Base(path)
+
+	// 写入中断残留的临时文件
+	if strings.HasPrefix(name, "blob-") {
+		v.report.TempFiles++
+		v.report.ReclaimedB += info.Size()
+		v.problem("temp", path, "leftover partial write")
+		v.remove(path)
+		return
+	}
+
+	if !isHexDigest(name) {
+		v.report.Unknown++
+		v.problem("unknown", path, "not a blob file, skipped")
+		return
+	}
+
+	v.report.Scanned++
+	digest := "sha256:" + name
+	actual, size, err := v.hashFile(path)
+	if err != nil {
+		v.report.Errors++
+		v.problem("error", path, err.Error())
+		return
+	}
+
+	if actual != digest {
+		v.report.Corrupted++
+		v.report.ReclaimedB += info.Size()
+		v.problem("corrupted", path, fmt.Sprintf("content hashes to %s", actual))
+		v.discard(path, name)
+		return
+	}
+
+	// 文件位置与 getPath 不一致时移动到正确位置
+	if expected := v.store.Path(digest); expected != path {
+		v.report.Misplaced++
+		v.problem("misplaced", path, "moved to "+expected)
+		if !v.dryRun {
+			if err := os.MkdirAll(filepath.Dir(expected), 0o755); err == nil {
+				if err := os.Rename(path, expected); err != nil {
+					v.report.Errors++
+					v.problem("error", path, err.Error())
+					return
+				}
+				os.Rename(path+".meta", expected+".meta")
+				path = expected
+			}
+		}
+	}
+
+	if v.repairMeta(path, digest, size) {
+		v.report.MetaRepaired++
+	}
+	v.report.Healthy++
+}
+
+// repairMeta 补全缺失或与数据不一致的 .meta，保留原有的缓存时间与媒体类型
+func (v *cacheVerifier) repairMeta(path, digest string, size int64) bool {
+	metaPath := path + ".meta"
+	var meta cache.BlobMeta
+	reason := ""
+
+	data, err := cache.ReadMetadataFile(metaPath)
+	switch {
+	case os.IsNotExist(err):
+		reason = "missing metadata"
+	case err != nil:
+		reason = err.Error()
+	case json.Unmarshal(data, &meta) != nil:
+		meta = cache.BlobMeta{}
+		reason = "unreadable metadata"
+	case meta.Digest != digest:
+		reason = fmt.Sprintf("metadata digest %q", meta.Digest)
+	case meta.Size != size:
+		reason = fmt.Sprintf("metadata size %d, actual %d", meta.Size, size)
+	case meta.FilePath != path:
+		reason = "metadata file path " + meta.FilePath
+	}
+	if reason == "" {
+		return false
+	}
+
+	v.problem("meta", metaPath, reason)
+	if v.dryRun {
+		return true
+	}
+
+	now := time.Now()
+	if meta.CachedAt.IsZero() {
+		meta.CachedAt = now
+	}
+	if meta.ExpiresAt.IsZero() {
+		meta.ExpiresAt = now.Add(v.store.TTL())
+	}
+	meta.Digest = digest
+	meta.Size = size
+	meta.FilePath = path
+
+	metaBytes, err := json.Marshal(&meta)
+	if err == nil {
+		err = os.WriteFile(metaPath, metaBytes, 0o644)
+	}
+	if err != nil {
+		v.report.Errors++
+		v.problem("error", metaPath, err.Error())
+	}
+	return true
+}
+
+// discard 删除或隔离损坏的 blob 及其元数据
+func (v *cacheVerifier) discard(path, name string) {
+	if v.quarantine == "" {
+		v.remove(path)
+		v.remove(path + ".meta")
+		return
+	}
+	if v.dryRun {
+		return
+	}
+
+	if err := os.MkdirAll(v.quarantine, 0o755); err != nil {
+		v.report.Errors++
+		v.problem("error", v.quarantine, err.Error())
+		return
+	}
+	target := filepath.Join(v.quarantine, fmt.Sprintf("%s-%d", name, time.Now().Unix()))
+	if err := os.Rename(path, target); err != nil {
+		v.report.Errors++
+		v.problem("error", path, err.Error())
+		return
+	}
+	os.Rename(path+".meta", target+".meta")
+}
+
+func (v *cacheVerifier) remove(path string) {
+	if v.dryRun {
+		return
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		v.report.Errors++
+		v.problem("error", path, err.Error())
+	}
+}
+
+func (v *cacheVerifier) problem(kind, path, detail string) {
+	fmt.Printf("%-12s %s: %s\n", kind, path, detail)
+}
+
+func (v *cacheVerifier) printReport(w io.Writer, elapsed time.Duration) {
+	r := v.report
+	action := "removed"
+	switch {
+	case v.dryRun:
+		action = "dry run, nothing changed"
+	case v.quarantine != "":
+		action = "quarantined to " + v.quarantine
+	}
+
+	fmt.Fprintf(w, "\nCache verify report for %s (%s)\n", v.store.Dir(), elapsed.Round(time.Millisecond))
+	fmt.Fprintf(w, "  blobs scanned:       %d\n", r.Scanned)
+	fmt.Fprintf(w, "  healthy:             %d\n", r.Healthy)
+	fmt.Fprintf(w, "  corrupted:           %d (%s)\n", r.Corrupted, action)
+	fmt.Fprintf(w, "  misplaced:           %d\n", r.Misplaced)
+	fmt.Fprintf(w, "  metadata repaired:   %d\n", r.MetaRepaired)
+	fmt.Fprintf(w, "  orphan metadata:     %d\n", r.OrphanMeta)
+	fmt.Fprintf(w, "  partial writes:      %d\n", r.TempFiles)
+	fmt.Fprintf(w, "  unknown files:       %d\n", r.Unknown)
+	fmt.Fprintf(w, "  errors:              %d\n", r.Errors)
+	fmt.Fprintf(w, "  space reclaimed:     %s\n", cache.FormatBytes(r.ReclaimedB))
+}
+
+// hashFile 计算文件的 sha256 digest 与大小
+func (v *cacheVerifier) hashFile(path string) (string, int64, error) {
+	f, err := v.store.OpenPath(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return "sha256:" + hex.EncodeToString(hasher.Sum(nil)), size, nil
+}
+
+// isHexDigest 判断是否为 64 位十六进制 sha256
+func isHexDigest(s string) bool {
+	if len(s) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+func TestCacheVerifyRepairsBlobs(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	_, layers := upstream.addImage("team/app", "v1", []byte("healthy layer"), []byte("corrupted layer"), []byte("layer without meta"))
+	p, client := newTestProxy(t, upstream, nil)
+	client.login("team/app")
+	client.pull("team/app", "v1")
+	waitCached(t, p, "team/app", "v1", layers)
+
+	store := cache.NewFileBlobStore(filepath.Join(os.Getenv("CACHE_DIR"), "blobs"), time.Hour)
+	healthy, corrupted, noMeta := store.Path(layers[0]), store.Path(layers[1]), store.Path(layers[2])
+	os.WriteFile(corrupted, []byte("bit rot"), 0o644)
+	os.Remove(noMeta + ".meta")
+	temp := filepath.Join(filepath.Dir(healthy), "blob-12345")
+	os.WriteFile(temp, []byte("partial"), 0o644)
+	orphan := filepath.Join(filepath.Dir(healthy), strings.Repeat("a", 64)+".meta")
+	os.WriteFile(orphan, []byte("{}"), 0o644)
+
+	exists := func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	}
+
+	// dry-run 只报告问题
+	if code := runCacheVerify([]string{"-dry-run"}); code != 0 {
+		t.Fatalf("cache verify -dry-run exited %d", code)
+	}
+	if !exists(corrupted) || !exists(temp) || !exists(orphan) || exists(noMeta+".meta") {
+		t.Fatal("cache verify -dry-run modified the cache")
+	}
+
+	if code := runCacheVerify([]string{"-quarantine"}); code != 0 {
+		t.Fatalf("cache verify exited %d", code)
+	}
+	if exists(corrupted) || exists(temp) || exists(orphan) {
+		t.Error("corrupted blob, partial write or orphan metadata left in the cache")
+	}
+	if !exists(healthy) || !exists(noMeta) || !exists(noMeta+".meta") {
+		t.Error("healthy blobs removed or missing metadata not repaired")
+	}
+	quarantined, _ := filepath.Glob(filepath.Join(os.Getenv("CACHE_DIR"), "quarantine", strings.TrimPrefix(layers[1], "sha256:")+"-*"))
+	if len(quarantined) == 0 {
+		t.Error("corrupted blob was not moved to the quarantine directory")
+	}
+}
+
+func TestCorruptedCachedBlobIsEvicted(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	layer := bytes.Repeat([]byte("verified layer data "), 4096)
+	_, layers := upstream.addImage("team/app", "v1", layer)
+	p, client := newTestProxy(t, upstream, map[string]string{"CACHE_VERIFY_READS": "1", "HOT_CACHE_MAX_ITEM_SIZE": "1KB"})
+	blobPath := "/v2/team/app/blobs/" + layers[0]
+	cacheKey := cache.CacheKey(testRegistryHost, blobPath)
+
+	client.login("team/app")
+	client.do("GET", blobPath, nil)
+	eventually(t, "blob cache fill", func() bool {
+		_, reader, found := p.cacheManager.GetBlobReader(cacheKey)
+		if found {
+			reader.Close()
+		}
+		return found
+	})
+
+	// 磁盘上的内容被静默损坏（大小不变），读取时校验不通过，删除后回源
+	corrupted := bytes.Repeat([]byte("X"), len(layer))
+	if err := os.WriteFile(p.cacheManager.BlobStore().Path(layers[0]), corrupted, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	resp, body := client.do("GET", blobPath, nil)
+	if resp.Header.Get("X-Cache") != "MISS" || !bytes.Equal(body, layer) {
+		t.Fatalf("X-Cache %q, intact=%v; want a fresh upstream fetch", resp.Header.Get("X-Cache"), bytes.Equal(body, layer))
+	}
+	if n := p.cacheManager.Statistics().BlobCorrupted.Load(); n != 1 {
+		t.Fatalf("corrupted blobs = %d, want 1", n)
+	}
+}
@@ -0,0 +1,118 @@
+package proxy
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// =============================================================================
+// 缓存写入队列 - 响应返回客户端后的缓存写入交给固定数量的 worker 执行，
+// 避免高负载时每个响应一个 goroutine 造成大量并发磁盘写入。
+// 任务以缓存管理器的生命周期 context 执行：关闭时排队中的写入不再执行，进行中的任务据此取消
+// =============================================================================
+
+const (
+	// cacheWriteWait 队列已满时普通写入等待空位的最长时间，超时后丢弃
+	cacheWriteWait = 10 * time.Second
+	// cacheShutdownGrace 关闭缓存管理器后等待已取消的写入与填充退出的时间
+	cacheShutdownGrace = 5 * time.Second
+)
+
+// cacheWriteQueue 有界的缓存写入队列
+type cacheWriteQueue struct {
+	ctx     context.Context // 缓存管理器的生命周期
+	jobs    chan func(context.Context)
+	pending atomic.Int64 // 已入队但尚未完成的任务
+
+	written   atomic.Int64
+	dropped   atomic.Int64
+	cancelled atomic.Int64 // 关闭时放弃的写入
+}
+
+// newCacheWriteQueue 启动 workers 个 worker，队列容量为 size；ctx 取消后不再执行新的写入
+func newCacheWriteQueue(ctx context.Context, workers, size int) *cacheWriteQueue {
+	if workers < 1 {
+		workers = 1
+	}
+	if size < 0 {
+		size = 0
+	}
+	q := &cacheWriteQueue{ctx: ctx, jobs: make(chan func(context.Context), size)}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range q.jobs {
+				if q.ctx.Err() != nil {
+					q.cancelled.Add(1)
+				} else {
+					job(q.ctx)
+					q.written.Add(1)
+				}
+				q.pending.Add(-1)
+			}
+		}()
+	}
+	return q
+}
+
+// submit 提交写入任务。lowValue 的任务（如只含响应头的 HEAD 条目）在队列已满时直接丢弃；
+// 其他任务等待空位（对调用方形成背压），等待超过 cacheWriteWait 时丢弃。返回是否已入队
+func (q *cacheWriteQueue) submit(name string, lowValue bool, job func(ctx context.Context)) bool {
+	if q.ctx.Err() != nil {
+		q.cancelled.Add(1)
+		return false
+	}
+	q.pending.Add(1)
+	select {
+	case q.jobs <- job:
+		return true
+	default:
+	}
+	if !lowValue {
+		timer := time.NewTimer(cacheWriteWait)
+		defer timer.Stop()
+		select {
+		case q.jobs <- job:
+			return true
+		case <-timer.C:
+		case <-q.ctx.Done():
+			q.pending.Add(-1)
+			q.cancelled.Add(1)
+			return false
+		}
+	}
+	q.pending.Add(-1)
+	q.dropped.Add(1)
+	log.Printf("Cache write queue full, dropping write: %s", name)
+	return false
+}
+
+// depth 排队中的任务数
+func (q *cacheWriteQueue) depth() int {
+	return len(q.jobs)
+}
+
+// drain 等待已入队的写入完成（用于优雅关闭），ctx 结束时返回其错误；
+// 生命周期 context 取消后排队中的任务直接跳过，因此随后的 drain 很快结束
+func (q *cacheWriteQueue) drain(ctx context.Context) error {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for q.pending.Load() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// writeMetrics 输出队列指标
+func (q *cacheWriteQueue) writeMetrics(m *metricsWriter) {
+	m.gauge("docker_proxy_cache_write_queue_depth", "Cache writes waiting for a worker", float64(q.depth()))
+	m.gauge("docker_proxy_cache_write_queue_capacity", "Capacity of the cache write queue", float64(cap(q.jobs)))
+	m.counter("docker_proxy_cache_writes_total", "Cache writes completed by the write queue", float64(q.written.Load()))
+	m.counter("docker_proxy_cache_writes_dropped_total", "Cache writes dropped because the write queue was full", float64(q.dropped.Load()))
+	m.counter("docker_proxy_cache_writes_cancelled_total", "Cache writes abandoned because the cache was shutting down", float64(q.cancelled.Load()))
+}
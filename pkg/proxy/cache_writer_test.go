@@ -0,0 +1,160 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestShutdownCancelsCacheWrites(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	_, layers := upstream.addImage("team/app", "v1", []byte("app layer"))
+	p, client := newTestProxy(t, upstream, nil)
+	client.login("team/app")
+	client.pull("team/app", "v1")
+	waitCached(t, p, "team/app", "v1", layers)
+
+	// 进行中的写入通过生命周期 context 得知缓存正在关闭
+	cancelled := make(chan struct{})
+	p.cacheWrites.submit("blocking", false, func(ctx context.Context) {
+		<-ctx.Done()
+		close(cancelled)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := p.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown = %v, want deadline exceeded while a write is pending", err)
+	}
+	select {
+	case <-cancelled:
+	default:
+		t.Fatal("pending cache write was not cancelled")
+	}
+	if p.cacheWrites.pending.Load() != 0 {
+		t.Errorf("pending writes after shutdown: %d", p.cacheWrites.pending.Load())
+	}
+	if p.cacheWrites.submit("late", false, func(context.Context) { t.Error("write ran after shutdown") }) {
+		t.Error("write accepted after shutdown")
+	}
+}
+
+func TestCacheWriteQueueWorkers(t *testing.T) {
+	q := newCacheWriteQueue(context.Background(), 3, 10)
+	release := make(chan struct{})
+	started := make(chan struct{}, 5)
+	for i := 0; i < 5; i++ {
+		q.submit(fmt.Sprint("job", i), false, func(context.Context) {
+			started <- struct{}{}
+			<-release
+		})
+	}
+
+	// 只有 3 个 worker，其余任务在队列中等待
+	for i := 0; i < 3; i++ {
+		<-started
+	}
+	select {
+	case <-started:
+		t.Fatal("more jobs running than workers")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if q.depth() != 2 {
+		t.Errorf("depth = %d, want 2", q.depth())
+	}
+
+	close(release)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := q.drain(ctx); err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+	if q.written.Load() != 5 {
+		t.Errorf("written = %d, want 5", q.written.Load())
+	}
+}
+
+func TestCacheWriteQueueFull(t *testing.T) {
+	q := newCacheWriteQueue(context.Background(), 1, 1)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	q.submit("running", false, func(context.Context) {
+		close(started)
+		<-release
+	})
+	<-started
+	if !q.submit("queued", false, func(context.Context) {}) {
+		t.Fatal("write rejected while the queue had room")
+	}
+
+	// 低价值的写入在队列满时直接丢弃
+	if q.submit("head", true, func(context.Context) { t.Error("dropped write ran") }) {
+		t.Error("low-value write queued into a full queue")
+	}
+	if q.dropped.Load() != 1 {
+		t.Errorf("dropped = %d, want 1", q.dropped.Load())
+	}
+
+	// 普通写入等待空位
+	var ran atomic.Bool
+	accepted := make(chan bool)
+	go func() {
+		accepted <- q.submit("waiting", false, func(context.Context) { ran.Store(true) })
+	}()
+	select {
+	case <-accepted:
+		t.Fatal("write did not wait for room in the queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	if !<-accepted {
+		t.Fatal("waiting write was dropped")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := q.drain(ctx); err != nil {
+		t.Fatalf("drain: %v", err)
+	}
+	if !ran.Load() || q.written.Load() != 3 {
+		t.Errorf("written = %d, waiting write ran = %v", q.written.Load(), ran.Load())
+	}
+}
+
+func TestCacheWriteQueueDrainOnShutdown(t *testing.T) {
+	lifetime, stop := context.WithCancel(context.Background())
+	q := newCacheWriteQueue(lifetime, 1, 4)
+	release := make(chan struct{})
+	started := make(chan struct{})
+	q.submit("running", false, func(ctx context.Context) {
+		close(started)
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+	})
+	<-started
+	for i := 0; i < 2; i++ {
+		q.submit(fmt.Sprint("queued", i), false, func(context.Context) { t.Error("queued write ran after shutdown") })
+	}
+
+	// 有写入未完成时 drain 在超时后返回
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := q.drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("drain = %v, want deadline exceeded", err)
+	}
+
+	// 生命周期结束后进行中的写入被取消，排队的写入直接跳过
+	stop()
+	ctx, cancel = context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if err := q.drain(ctx); err != nil {
+		t.Fatalf("drain after shutdown: %v", err)
+	}
+	if q.written.Load() != 1 || q.cancelled.Load() != 2 {
+		t.Errorf("written = %d, cancelled = %d, want 1 and 2", q.written.Load(), q.cancelled.Load())
+	}
+}
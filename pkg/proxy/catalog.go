@@ -0,0 +1,158 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+	"github.com/go-chi/chi/v5"
+)
+
+// =============================================================================
+// 缓存目录 - GET /admin/catalog 列出缓存中实际存在的仓库、tag 与 digest（而不是上游的 _catalog），
+// 包含各 manifest 引用的已缓存内容大小、缓存时间与最近访问时间
+// =============================================================================
+
+// CatalogManifest 缓存的一个 manifest 引用（tag 或 digest）
+type CatalogManifest struct {
+	Reference  string    `json:"reference"`
+	Digest     string    `json:"digest"`
+	MediaType  string    `json:"mediaType,omitempty"`
+	Size       int64     `json:"size"`  // manifest 及其已缓存的 config、层与子 manifest 的总大小
+	Blobs      int       `json:"blobs"` // 已缓存的 config 与层数量
+	CachedAt   time.Time `json:"cachedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	LastAccess time.Time `json:"lastAccess"`
+	Stale      bool      `json:"stale,omitempty"` // 已过期，仅在 CACHE_STALE_TTL 内保留
+}
+
+// CatalogRepository 一个仓库的缓存内容
+type CatalogRepository struct {
+	Name       string            `json:"name"`
+	Tags       []CatalogManifest `json:"tags"`
+	Digests    []CatalogManifest `json:"digests"`
+	Size       int64             `json:"size"` // 去重后的总大小
+	LastAccess time.Time         `json:"lastAccess"`
+}
+
+// Catalog 缓存目录
+type Catalog struct {
+	Repositories []*CatalogRepository `json:"repositories"`
+	TotalSize    int64                `json:"totalSize"` // 各仓库大小之和（仓库之间共享的 blob 会重复计算）
+	Unnamed      int                  `json:"unnamed,omitempty"`
+}
+
+// buildCatalog 遍历缓存的 manifest 生成目录，prefix 非空时只列出名称以其开头的仓库；
+// 未记录仓库名的旧条目只计数（在再次写入缓存后出现）
+func (p *ProxyServer) buildCatalog(ctx context.Context, prefix string) *Catalog {
+	type cachedManifest struct {
+		CatalogManifest
+		parsed *ImageManifest
+	}
+	repos := make(map[string][]*cachedManifest)
+	catalog := &Catalog{Repositories: []*CatalogRepository{}}
+	now := time.Now()
+
+	p.cacheManager.WalkManifests(func(entry *cache.CacheEntry, lastAccess time.Time) {
+		switch {
+		case entry.Repo == "":
+			catalog.Unnamed++
+			return
+		case strings.HasPrefix(entry.Reference, "referrers/"), strings.HasPrefix(entry.Repo, cache.FileRepoPrefix),
+			!strings.HasPrefix(entry.Repo, prefix):
+			return
+		}
+		// 代理写入的 manifest 条目不一定带描述符，按内容计算
+		contentType := http.Header(entry.Headers).Get("Content-Type")
+		if contentType == "" {
+			contentType = entry.Descriptor.MediaType
+		}
+		parsed, _ := ParseManifest(entry.Data, contentType)
+		repos[entry.Repo] = append(repos[entry.Repo], &cachedManifest{
+			CatalogManifest: CatalogManifest{
+				Reference:  entry.Reference,
+				Digest:     digestOf(entry.Data),
+				MediaType:  contentType,
+				Size:       int64(len(entry.Data)),
+				CachedAt:   entry.CachedAt,
+				ExpiresAt:  entry.ExpiresAt,
+				LastAccess: lastAccess,
+				Stale:      now.After(entry.ExpiresAt),
+			},
+			parsed: parsed,
+		})
+	})
+
+	store := p.cacheManager.BlobStore()
+	for name, manifests := range repos {
+		repo := &CatalogRepository{Name: name, Tags: []CatalogManifest{}, Digests: []CatalogManifest{}}
+		counted := make(map[string]bool) // 仓库内已计入大小的 digest
+		count := func(digest string, size int64) {
+			if !counted[digest] {
+				counted[digest] = true
+				repo.Size += size
+			}
+		}
+
+		// 先计算单平台 manifest，多平台 index 再累加已缓存的子 manifest
+		byDigest := make(map[string]*cachedManifest)
+		for _, m := range manifests {
+			count(m.Digest, m.Size)
+			if m.parsed == nil || len(m.parsed.Manifests) > 0 {
+				continue
+			}
+			blobs := m.parsed.Layers
+			if m.parsed.Config != nil {
+				blobs = append([]ManifestDescriptor{*m.parsed.Config}, blobs...)
+			}
+			for _, blob := range blobs {
+				if desc, err := store.Stat(ctx, blob.Digest); err == nil {
+					m.Size += desc.Size
+					m.Blobs++
+					count(blob.Digest, desc.Size)
+				}
+			}
+			byDigest[m.Digest] = m
+		}
+		for _, m := range manifests {
+			if m.parsed == nil || len(m.parsed.Manifests) == 0 {
+				continue
+			}
+			for _, child := range m.parsed.Manifests {
+				if c, ok := byDigest[child.Digest]; ok {
+					m.Size += c.Size
+					m.Blobs += c.Blobs
+				}
+			}
+		}
+
+		for _, m := range manifests {
+			if strings.HasPrefix(m.Reference, "sha256:") {
+				repo.Digests = append(repo.Digests, m.CatalogManifest)
+			} else {
+				repo.Tags = append(repo.Tags, m.CatalogManifest)
+			}
+			if m.LastAccess.After(repo.LastAccess) {
+				repo.LastAccess = m.LastAccess
+			}
+		}
+		sort.Slice(repo.Tags, func(i, j int) bool { return repo.Tags[i].Reference < repo.Tags[j].Reference })
+		sort.Slice(repo.Digests, func(i, j int) bool { return repo.Digests[i].Reference < repo.Digests[j].Reference })
+		catalog.Repositories = append(catalog.Repositories, repo)
+		catalog.TotalSize += repo.Size
+	}
+	sort.Slice(catalog.Repositories, func(i, j int) bool { return catalog.Repositories[i].Name < catalog.Repositories[j].Name })
+	return catalog
+}
+
+// registerCatalogAdminRoutes 缓存目录管理接口
+//
+//	GET /admin/catalog?repo=<前缀>   缓存中的仓库、tag 与 digest
+func (p *ProxyServer) registerCatalogAdminRoutes(r chi.Router) {
+	r.Get("/catalog", func(w http.ResponseWriter, r *http.Request) {
+		p.writeJSON(w, http.StatusOK, p.buildCatalog(r.Context(), r.URL.Query().Get("repo")))
+	})
+}
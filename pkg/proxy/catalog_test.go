@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestAdminCatalog 覆盖 /admin/catalog：列出缓存中的仓库、tag 与大小
+func TestAdminCatalog(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	digest, layers := upstream.addImage("team/app", "v1", []byte("first layer"), []byte("second layer"))
+	upstream.addImage("team/other", "latest", []byte("other layer"))
+	p, client := newTestProxy(t, upstream, map[string]string{"ADMIN_TOKEN": "admin-token"})
+
+	client.login("team/app")
+	manifest := client.pull("team/app", "v1")
+	waitCached(t, p, "team/app", "v1", layers)
+
+	client.token = "admin-token"
+	resp, body := client.do(http.MethodGet, "/admin/catalog?repo=team/", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("/admin/catalog: status %d", resp.StatusCode)
+	}
+	var catalog Catalog
+	if err := json.Unmarshal(body, &catalog); err != nil {
+		t.Fatal(err)
+	}
+	if len(catalog.Repositories) != 1 || catalog.Repositories[0].Name != "team/app" {
+		t.Fatalf("repositories = %+v", catalog.Repositories)
+	}
+	repo := catalog.Repositories[0]
+	if len(repo.Tags) != 1 || repo.Tags[0].Reference != "v1" || repo.Tags[0].Digest != digest {
+		t.Fatalf("tags = %+v", repo.Tags)
+	}
+	tag := repo.Tags[0]
+	// manifest + config + 两层
+	minSize := int64(len(manifest) + len("first layer") + len("second layer"))
+	if tag.Blobs != 3 || tag.Size <= minSize || repo.Size != tag.Size {
+		t.Errorf("tag v1: blobs %d, size %d (repo %d), want 3 blobs and more than %d bytes", tag.Blobs, tag.Size, repo.Size, minSize)
+	}
+	if tag.LastAccess.IsZero() || tag.CachedAt.IsZero() || tag.Stale {
+		t.Errorf("tag v1 times: %+v", tag)
+	}
+
+	resp, body = client.do(http.MethodGet, "/admin/catalog?repo=library/", nil)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `"repositories":[]`) {
+		t.Errorf("filtered catalog: status %d, body %s", resp.StatusCode, body)
+	}
+}
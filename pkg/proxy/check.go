@@ -0,0 +1,691 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+// =============================================================================
+// 配置校验 - go-docker-proxy check，解析全部配置并报告问题，避免运行时静默回退到默认值
+// =============================================================================
+
+// 通过 parseDuration / parseSize / parseInt 读取的环境变量，格式错误时运行时会静默使用默认值
+var (
+	durationSettings = []string{
+		"AUTH_CHALLENGE_TTL", "CACHE_BLOB_TTL", "CACHE_BLOB_TTL_MAX", "CACHE_BLOB_TTL_MIN",
+		"CACHE_CLEANUP_INTERVAL", "CACHE_DETACH_TIMEOUT", "CACHE_MANIFEST_TTL", "CACHE_MANIFEST_TTL_MAX", "CACHE_MANIFEST_TTL_MIN", "CACHE_STALE_TTL",
+		"CLUSTER_PEER_TIMEOUT", "CLUSTER_SYNC_INTERVAL", "CORS_MAX_AGE", "COSIGN_CACHE_TTL", "ERROR_REPORT_WINDOW",
+		"HEALTH_CHECK_TIMEOUT", "HEDGE_DELAY", "HSTS_MAX_AGE", "LIMIT_QUEUE_TIMEOUT", "LIMIT_RETRY_AFTER", "MAINTENANCE_RETRY_AFTER", "NOTIFY_TIMEOUT",
+		"REQUEST_TIMEOUT", "SCAN_TIMEOUT", "SERVER_IDLE_TIMEOUT", "SERVER_READ_HEADER_TIMEOUT",
+		"SERVER_READ_TIMEOUT", "SERVER_WRITE_TIMEOUT", "SHUTDOWN_TIMEOUT", "SLOW_REQUEST_THRESHOLD", "UPSTREAM_HEALTH_INTERVAL",
+		"UPSTREAM_DIAL_TIMEOUT", "UPSTREAM_FALLBACK_DELAY", "UPSTREAM_HEALTH_TIMEOUT", "UPSTREAM_KEEPALIVE", "UPSTREAM_PREWARM_INTERVAL", "UPSTREAM_RESPONSE_HEADER_TIMEOUT", "UPSTREAM_RETRY_BACKOFF",
+		"UPSTREAM_RETRY_MAX_BACKOFF", "UPSTREAM_TLS_HANDSHAKE_TIMEOUT", "UPSTREAM_429_BACKOFF", "UPSTREAM_429_MAX_BACKOFF", "USAGE_REPORT_RETENTION",
+	}
+	sizeSettings = []string{
+		"CACHE_MAX_BLOB_SIZE", "CACHE_MAX_SIZE", "HEALTH_MIN_FREE_DISK", "HOT_CACHE_MAX_ITEM_SIZE", "HOT_CACHE_SIZE", "MAX_BLOB_SIZE",
+		"MAX_IMAGE_SIZE", "PARALLEL_DOWNLOAD_CHUNK_SIZE", "PARALLEL_DOWNLOAD_MIN_SIZE",
+		"UPSTREAM_RETRY_BODY_LIMIT",
+	}
+	intSettings = []string{
+		"CACHE_DETACH_MAX", "CACHE_WRITE_QUEUE", "CACHE_WRITE_WORKERS", "CLIENT_RATE_BURST", "ERROR_REPORT_5XX_THRESHOLD", "LIMIT_QUEUE_SIZE", "MAX_BLOB_STREAMS", "MAX_UPSTREAM_REQUESTS",
+		"PARALLEL_DOWNLOAD_CHUNKS", "REDIRECT_MAX_HOPS", "UPSTREAM_HEALTH_THRESHOLD", "UPSTREAM_MAX_CONNS_PER_HOST", "UPSTREAM_PREWARM_CONNS", "UPSTREAM_RESUME_RETRIES",
+		"UPSTREAM_RETRIES", "UPSTREAM_TLS_SESSION_CACHE",
+	}
+	boolSettings = []string{
+		"CACHE_COMPRESS_METADATA", "CACHE_ENABLED", "CACHE_FSYNC", "CACHE_HONOR_UPSTREAM_TTL", "DEBUG", "DNS_ENABLED", "DNS_POISON_CHECK", "FOLLOW_ALL_REDIRECTS", "API_TOKENS_ENABLED", "ADMIN_PROTECT_METRICS", "MAINTENANCE_MODE",
+		"MANIFEST_HEAD_FETCH", "CORS_ALLOW_CREDENTIALS", "SECURITY_HEADERS", "HSTS_INCLUDE_SUBDOMAINS", "TIMING_HEADER",
+	}
+)
+
+var hostnamePattern = regexp.MustCompile(`^(?i)[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?(\.[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?)*$`)
+
+// configChecker 收集校验发现的问题
+type configChecker struct {
+	problems []string
+}
+
+func (c *configChecker) fail(format string, args ...interface{}) {
+	c.problems = append(c.problems, fmt.Sprintf(format, args...))
+}
+
+// RunCheckCommand 处理 check 子命令：校验配置并打印生效配置，存在问题时返回 1
+func RunCheckCommand(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	c := &configChecker{}
+	if err := applyConfigFile(); err != nil {
+		c.fail("CONFIG_FILE: %v", err)
+	}
+	c.checkValues()
+
+	config := loadEnvConfig()
+	registerChainedRoutes(config)
+	registerHelmRoutes(config)
+	registerFileMirrorRoutes(config)
+	registerBucketRoutes(config, http.DefaultTransport)
+	buildUpstreamAuth(config, http.DefaultTransport)
+	NewForeignLayerRewriter(config)
+
+	c.checkRoutes(config)
+	c.checkDNS(config)
+	c.checkEgress(config)
+	c.checkCacheDir(config.CacheDir)
+	if _, _, err := loadCacheCipher(config.CacheEncryption); err != nil {
+		c.fail("%v", err)
+	}
+	c.checkListen(config.Listen)
+	c.checkFiles(config)
+
+	printEffectiveConfig(os.Stdout, config)
+
+	if len(c.problems) == 0 {
+		fmt.Println("\nConfiguration OK")
+		return 0
+	}
+	fmt.Printf("\n%d problem(s) found:\n", len(c.problems))
+	for _, problem := range c.problems {
+		fmt.Printf("  ✗ %s\n", problem)
+	}
+	return 1
+}
+
+// checkValues 严格解析数值类环境变量
+func (c *configChecker) checkValues() {
+	for _, key := range durationSettings {
+		if value := getEnv(key, ""); value != "" {
+			if _, err := parseDurationValue(value); err != nil {
+				c.fail("%s: %v (the default would be used)", key, err)
+			}
+		}
+	}
+	for _, key := range sizeSettings {
+		if value := getEnv(key, ""); value != "" {
+			if _, err := parseSizeValue(value); err != nil {
+				c.fail("%s: %v (the default would be used)", key, err)
+			}
+		}
+	}
+	for _, key := range intSettings {
+		if value := getEnv(key, ""); value != "" {
+			if _, err := strconv.Atoi(strings.TrimSpace(value)); err != nil {
+				c.fail("%s: invalid integer %q (the default would be used)", key, value)
+			}
+		}
+	}
+	for _, key := range boolSettings {
+		if value := getEnv(key, ""); value != "" && value != "true" && value != "false" {
+			c.fail("%s: %q is treated as false, use true or false", key, value)
+		}
+	}
+	if value := getEnv("CACHE_VERIFY_READS", ""); value != "" {
+		if rate, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err != nil || rate < 0 || rate > 1 {
+			c.fail("CACHE_VERIFY_READS: %q must be a fraction between 0 and 1", value)
+		}
+	}
+	if value := getEnv("CLIENT_RATE_LIMIT", ""); value != "" {
+		if rate, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err != nil || rate < 0 {
+			c.fail("CLIENT_RATE_LIMIT: %q must be a non-negative number of requests per second", value)
+		}
+	}
+	if value := getEnv("UPSTREAM_PREWARM_INTERVAL", ""); value != "" {
+		if interval, err := parseDurationValue(value); err == nil && interval >= upstreamIdleConnTimeout {
+			c.fail("UPSTREAM_PREWARM_INTERVAL: %s must be below the %s idle connection timeout", value, upstreamIdleConnTimeout)
+		}
+	}
+	for _, entry := range getEnvList("CACHE_QUOTAS") {
+		pattern, size, ok := strings.Cut(entry, "=")
+		if n, err := parseSizeValue(size); !ok || strings.Trim(strings.TrimSpace(pattern), "/") == "" || err != nil || n <= 0 {
+			c.fail("CACHE_QUOTAS: invalid entry %q (expected repo/pattern=size)", entry)
+		}
+	}
+	for _, entry := range getEnvList("CACHE_TTL_OVERRIDES") {
+		if _, _, ok := parseCacheTTLOverride(entry); !ok {
+			c.fail("CACHE_TTL_OVERRIDES: invalid entry %q (expected host=manifest:1h;blob:30d or host=off)", entry)
+		}
+	}
+	for _, entry := range getEnvList("UPSTREAM_FLAVORS") {
+		if _, _, ok := parseUpstreamFlavor(entry); !ok {
+			c.fail("UPSTREAM_FLAVORS: invalid entry %q (expected host=dockerhub|harbor[:project]|artifactory[:repo-key]|gitlab|quay)", entry)
+		}
+	}
+	for _, entry := range getEnvList("REDIRECT_RULES") {
+		pattern, action, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(pattern) == "" || (strings.TrimSpace(action) != "follow" && strings.TrimSpace(action) != "pass") {
+			c.fail("REDIRECT_RULES: invalid entry %q (expected host=follow|pass)", entry)
+		}
+	}
+	for _, key := range []string{"RESPONSE_HEADERS_STRIP", "RESPONSE_HEADERS_KEEP", "RESPONSE_HEADERS_ADD"} {
+		for _, entry := range getEnvList(key) {
+			name, items, ok := strings.Cut(entry, "=")
+			if !ok || strings.TrimSpace(name) == "" {
+				c.fail("%s: invalid entry %q (expected route=Header|Header)", key, entry)
+				continue
+			}
+			for _, item := range strings.Split(items, "|") {
+				header, _, hasValue := strings.Cut(strings.TrimSpace(item), ":")
+				switch {
+				case key == "RESPONSE_HEADERS_ADD" && !hasValue:
+					c.fail("%s: %q must be Header:value", key, item)
+				case key == "RESPONSE_HEADERS_STRIP" && essentialResponseHeaders[http.CanonicalHeaderKey(header)]:
+					c.fail("%s: %s is required by clients and is always forwarded", key, header)
+				}
+			}
+		}
+	}
+	switch mode := getEnv("USER_AGENT_MODE", "forward"); mode {
+	case "forward", "proxy", "append":
+	default:
+		c.fail("USER_AGENT_MODE: %q must be forward, proxy or append", mode)
+	}
+	for _, item := range getEnvList("UPSTREAM_RETRY_STATUSES") {
+		if code, err := strconv.Atoi(item); err != nil || code < 100 || code > 599 {
+			c.fail("UPSTREAM_RETRY_STATUSES: %q is not an HTTP status code", item)
+		}
+	}
+}
+
+// checkRoutes 路由域名必须是合法的主机名，上游必须是 http(s) 地址
+func (c *configChecker) checkRoutes(config *Config) {
+	if !hostnamePattern.MatchString(config.CustomDomain) {
+		c.fail("CUSTOM_DOMAIN: %q is not a valid hostname", config.CustomDomain)
+	}
+	for _, host := range sortedRouteHosts(config) {
+		upstream := config.Routes[host]
+		if !hostnamePattern.MatchString(host) {
+			c.fail("route %q: not a valid hostname", host)
+		}
+		u, err := url.Parse(upstream)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			c.fail("route %s: invalid upstream URL %q", host, upstream)
+		}
+	}
+	for _, entry := range getEnvList("BUCKET_ROUTES") {
+		if _, _, err := parseBucketRoute(entry); err != nil {
+			c.fail("BUCKET_ROUTES: %v", err)
+		}
+	}
+	for host := range config.HelmRoutes {
+		if _, ok := config.Routes[host]; ok {
+			c.fail("HELM_ROUTES: %s is also an image route, the Helm repository takes precedence", host)
+		}
+	}
+	for _, host := range sortedFileMirrorHosts(config) {
+		if _, ok := config.Routes[host]; ok {
+			c.fail("FILE_MIRROR_ROUTES: %s is also an image route, the file mirror takes precedence", host)
+		}
+		if _, ok := config.HelmRoutes[host]; ok {
+			c.fail("FILE_MIRROR_ROUTES: %s is also a Helm repository route, the Helm repository takes precedence", host)
+		}
+	}
+	hosts := make([]string, 0, len(config.ResponseHeaders))
+	for host := range config.ResponseHeaders {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		if _, ok := config.Routes[host]; !ok && host != "*" {
+			c.fail("RESPONSE_HEADERS_*: %q does not match any route", host)
+		}
+	}
+	upstreamHosts := make(map[string]bool)
+	for _, upstream := range config.Routes {
+		if u, err := url.Parse(upstream); err == nil {
+			upstreamHosts[strings.ToLower(u.Host)] = true
+		}
+	}
+	splitHosts := make([]string, 0, len(config.UpstreamSplits))
+	for host, split := range config.UpstreamSplits {
+		splitHosts = append(splitHosts, host)
+		if u, err := url.Parse(split.Upstream); err == nil {
+			upstreamHosts[strings.ToLower(u.Host)] = true
+		}
+	}
+	sort.Strings(splitHosts)
+	for _, host := range splitHosts {
+		if _, ok := config.Routes[host]; !ok {
+			c.fail("UPSTREAM_SPLITS: %q does not match any route", host)
+		}
+	}
+	for host := range config.UpstreamFlavors {
+		if !upstreamHosts[host] {
+			c.fail("UPSTREAM_FLAVORS: %q is not the upstream host of any route", host)
+		}
+	}
+	for _, host := range config.SingleDomainHosts {
+		if !hostnamePattern.MatchString(host) {
+			c.fail("SINGLE_DOMAIN: %q is not a valid hostname", host)
+		}
+	}
+}
+
+// checkDNS DNS 服务器必须是 IP:端口
+func (c *configChecker) checkDNS(config *Config) {
+	if config.DNSEnabled && len(config.DNSServers) == 0 {
+		c.fail("DNS_ENABLED=true but DNS_SERVERS is empty")
+	}
+	if _, err := time.ParseDuration(config.DNSTimeout); err != nil {
+		c.fail("DNS_TIMEOUT: %v (5s would be used)", err)
+	}
+	for _, server := range config.DNSServers {
+		c.checkDNSServer("DNS_SERVERS", server)
+	}
+	for _, entry := range getEnvList("DNS_OVERRIDES") {
+		host, server, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(host) == "" || strings.TrimSpace(server) == "" {
+			c.fail("DNS_OVERRIDES: %q must be host=ip:port", entry)
+			continue
+		}
+		c.checkDNSServer("DNS_OVERRIDES", strings.TrimSpace(server))
+	}
+	for _, entry := range getEnvList("DNS_FALLBACK_IPS") {
+		if len(parseFallbackIPs([]string{entry})) == 0 {
+			c.fail("DNS_FALLBACK_IPS: %q must be host=ip|ip", entry)
+		}
+	}
+	// 备用 IP 的正确性依赖 TLS 证书校验，明文 HTTP 上游连到错误的主机也无法发现
+	for _, upstream := range config.Routes {
+		if u, err := url.Parse(upstream); err == nil && u.Scheme == "http" && config.DNSFallbackIPs[strings.ToLower(u.Hostname())] != nil {
+			c.fail("DNS_FALLBACK_IPS: %s is a plain HTTP upstream, fallback IPs cannot be verified by its certificate", u.Hostname())
+		}
+	}
+	for _, server := range config.DNSSecondaryServers {
+		if !strings.HasPrefix(server, "https://") {
+			c.checkDNSServer("DNS_SECONDARY_SERVERS", server)
+		} else if u, err := url.Parse(server); err != nil || u.Host == "" {
+			c.fail("DNS_SECONDARY_SERVERS: %q is not a valid DoH URL", server)
+		}
+	}
+	if len(config.DNSSecondaryServers) > 0 && !config.DNSPoisonCheck {
+		c.fail("DNS_SECONDARY_SERVERS is set but DNS_POISON_CHECK is not enabled")
+	}
+}
+
+// checkEgress 出口地址必须是本机 IP 或存在的网卡，地址族策略与连接参数覆盖必须有效
+func (c *configChecker) checkEgress(config *Config) {
+	if config.EgressBind != "" {
+		if _, err := resolveEgressAddr(config.EgressBind); err != nil {
+			c.fail("EGRESS_BIND: %v", err)
+		}
+	}
+	if !validIPFamily(config.UpstreamIPFamily) {
+		c.fail("UPSTREAM_IP_FAMILY: %q must be auto, ipv4, ipv6, prefer-ipv4 or prefer-ipv6 (auto would be used)", config.UpstreamIPFamily)
+	}
+	if _, err := parseDialOverrides(config.UpstreamDialOverrides, config.UpstreamDial); err != nil {
+		c.fail("UPSTREAM_DIAL_OVERRIDES: %v", err)
+	}
+	if _, err := parseTLSProfiles(config.UpstreamTLSProfiles); err != nil {
+		c.fail("UPSTREAM_TLS_PROFILES: %v", err)
+	}
+	for _, entry := range getEnvList("EGRESS_BIND_OVERRIDES") {
+		host, bind, ok := strings.Cut(entry, "=")
+		if !ok || strings.TrimSpace(host) == "" || strings.TrimSpace(bind) == "" {
+			c.fail("EGRESS_BIND_OVERRIDES: %q must be host=ip|interface", entry)
+			continue
+		}
+		if _, err := resolveEgressAddr(strings.TrimSpace(bind)); err != nil {
+			c.fail("EGRESS_BIND_OVERRIDES: %s: %v", strings.TrimSpace(host), err)
+		}
+	}
+}
+
+// checkDNSServer 校验单个 ip:port 形式的 DNS 服务器地址
+func (c *configChecker) checkDNSServer(key, server string) {
+	host, port, err := net.SplitHostPort(server)
+	if err != nil {
+		c.fail("%s: %q must be ip:port (%v)", key, server, err)
+		return
+	}
+	if net.ParseIP(host) == nil {
+		c.fail("%s: %q is not an IP address", key, host)
+	}
+	if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+		c.fail("%s: invalid port in %q", key, server)
+	}
+}
+
+// checkCacheDir 缓存目录必须可创建、可写
+func (c *configChecker) checkCacheDir(dir string) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		c.fail("CACHE_DIR: %v", err)
+		return
+	}
+	f, err := os.CreateTemp(dir, ".check-*")
+	if err != nil {
+		c.fail("CACHE_DIR: %s is not writable: %v", dir, err)
+		return
+	}
+	f.Close()
+	os.Remove(f.Name())
+}
+
+// checkListen 端口必须有效，证书与私钥必须成对配置且可以加载
+func (c *configChecker) checkListen(listen ListenConfig) {
+	if listen.Socket == "" {
+		if _, port, err := net.SplitHostPort(listen.Address); err != nil {
+			c.fail("listen address %q: %v", listen.Address, err)
+		} else if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+			c.fail("PORT: invalid port %q", port)
+		}
+	}
+	if (listen.TLSCertFile == "") != (listen.TLSKeyFile == "") {
+		c.fail("TLS_CERT_FILE and TLS_KEY_FILE must be set together (serving plain HTTP)")
+		return
+	}
+	if listen.TLS() {
+		if _, err := tls.LoadX509KeyPair(listen.TLSCertFile, listen.TLSKeyFile); err != nil {
+			c.fail("TLS: %v", err)
+		}
+	}
+}
+
+// checkFiles 加载各配置文件，报告与启动时相同的错误
+func (c *configChecker) checkFiles(config *Config) {
+	if _, err := LoadTimeouts(config.TimeoutsFile, config.CustomDomain, config.UpstreamTimeouts); err != nil {
+		c.fail("TIMEOUTS_FILE: %v", err)
+	}
+	if _, err := LoadScopeRewriter(config.ScopeRewriteFile); err != nil {
+		c.fail("SCOPE_REWRITE_RULES: %v", err)
+	}
+	if _, err := LoadHeaderRules(config.HeaderRulesFile, config.CustomDomain); err != nil {
+		c.fail("HEADER_RULES: %v", err)
+	}
+	if _, err := LoadTagPolicies(config.TagPolicyFile); err != nil {
+		c.fail("TAG_POLICY: %v", err)
+	}
+	if _, err := NewIPFilter(config.IPFilter, false); err != nil {
+		c.fail("IP filter: %v", err)
+	}
+	if _, err := NewSignatureVerifier(config.Signatures, false); err != nil {
+		c.fail("COSIGN_POLICY: %v", err)
+	}
+	if _, err := NewClientAuth(config.AuthHtpasswd, nil, false); err != nil {
+		c.fail("AUTH_HTPASSWD: %v", err)
+	}
+	if _, err := NewAdminAuth(config.Admin); err != nil {
+		c.fail("admin auth: %v", err)
+	}
+	if config.Admin.ClientCA != "" && !config.Listen.TLS() {
+		c.fail("ADMIN_CLIENT_CA requires TLS_CERT_FILE and TLS_KEY_FILE")
+	}
+	if config.APITokensFile != "" {
+		if _, err := NewTokenStore(config.APITokensFile); err != nil {
+			c.fail("API_TOKENS_FILE: %v", err)
+		}
+	}
+	if _, err := NewReplicator(nil, config.ReplicationFile); err != nil {
+		c.fail("REPLICATION_FILE: %v", err)
+	}
+}
+
+// printEffectiveConfig 打印解析后的生效配置
+func printEffectiveConfig(out io.Writer, config *Config) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	row := func(name string, value interface{}) {
+		fmt.Fprintf(w, "  %s\t%v\n", name, value)
+	}
+	duration := func(d time.Duration) string {
+		if d == 0 {
+			return "disabled"
+		}
+		return d.String()
+	}
+	size := func(n int64) string {
+		if n == 0 {
+			return "unlimited"
+		}
+		return cache.FormatBytes(n)
+	}
+
+	fmt.Fprintln(w, "Effective configuration:")
+	row("listen", config.Listen)
+	row("security headers", fmt.Sprintf("nosniff %v, HSTS %s, Server %q", config.Security.NoSniff,
+		duration(config.Security.HSTSMaxAge), config.Security.Server))
+	row("upstream User-Agent", fmt.Sprintf("%q (%s)", config.Security.UserAgent, config.Security.UserAgentMode))
+	row("custom domain", config.CustomDomain)
+	if len(config.SingleDomainHosts) > 0 {
+		row("single domain", strings.Join(config.SingleDomainHosts, ", "))
+	}
+	if len(config.CORS.AllowedOrigins) > 0 {
+		row("CORS origins", strings.Join(config.CORS.AllowedOrigins, ", "))
+	}
+	row("debug", config.Debug)
+	row("cache enabled", config.CacheEnabled)
+	row("cache dir", config.CacheDir)
+	row("manifest TTL", duration(config.CacheManifestTTL))
+	row("blob TTL", duration(config.CacheBlobTTL))
+	bounds := func(b cache.TTLBounds) string {
+		if b.Max == 0 {
+			return fmt.Sprintf(">= %s", b.Min)
+		}
+		return fmt.Sprintf("%s - %s", b.Min, b.Max)
+	}
+	row("upstream TTL headers", fmt.Sprintf("%v (manifest %s, blob %s)", config.CacheTTLPolicy.HonorUpstream,
+		bounds(config.CacheTTLPolicy.Manifest), bounds(config.CacheTTLPolicy.Blob)))
+	hosts := make([]string, 0, len(config.CacheTTLPolicy.Hosts))
+	for host := range config.CacheTTLPolicy.Hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		override := config.CacheTTLPolicy.Hosts[host]
+		if override.Disabled {
+			row("cache TTL "+host, "caching disabled")
+			continue
+		}
+		var parts []string
+		if override.Manifest > 0 {
+			parts = append(parts, "manifest "+duration(override.Manifest))
+		}
+		if override.Blob > 0 {
+			parts = append(parts, "blob "+duration(override.Blob))
+		}
+		row("cache TTL "+host, strings.Join(parts, ", "))
+	}
+	row("cache max size", size(config.CacheMaxSize))
+	row("cache cleanup interval", duration(config.CacheCleanupInterval))
+	row("cache max blob size", size(config.CacheMaxBlobSize))
+	row("cache verify reads", config.CacheVerifyReads)
+	row("cache compress metadata", config.CacheCompressMeta)
+	row("cache fsync", config.CacheFsync)
+	row("manifest HEAD fetch", config.ManifestHeadFetch)
+	row("cache write queue", fmt.Sprintf("%d workers, %d queued", config.CacheWriteWorkers, config.CacheWriteQueue))
+	if source := config.CacheEncryption.Source(); source != "" {
+		row("cache encryption", "AES-256-GCM (key from "+source+")")
+	} else {
+		row("cache encryption", "disabled")
+	}
+	for _, q := range config.CacheQuotas {
+		row("cache quota "+q.Pattern, size(q.MaxSize))
+	}
+	row("hot cache", fmt.Sprintf("%s (max item %s)", size(config.HotCacheSize), size(config.HotCacheMaxItem)))
+	row("follow all redirects", config.FollowAllRedirects)
+	for _, rule := range config.RedirectRules {
+		action := "pass to client"
+		if rule.Follow {
+			action = "follow"
+		}
+		row("redirects to "+rule.Pattern, action)
+	}
+	row("redirect max hops", config.RedirectMaxHops)
+	row("blocked hosts", strings.Join(config.BlockedHostPatterns, ", "))
+	flavorHosts := make([]string, 0, len(config.UpstreamFlavors))
+	for host := range config.UpstreamFlavors {
+		flavorHosts = append(flavorHosts, host)
+	}
+	sort.Strings(flavorHosts)
+	for _, host := range flavorHosts {
+		row("upstream flavor "+host, config.UpstreamFlavors[host].String())
+	}
+	splitHosts := make([]string, 0, len(config.UpstreamSplits))
+	for host := range config.UpstreamSplits {
+		splitHosts = append(splitHosts, host)
+	}
+	sort.Strings(splitHosts)
+	for _, host := range splitHosts {
+		split := config.UpstreamSplits[host]
+		row("upstream split "+host, fmt.Sprintf("%d%% to %s", split.Weight, split.Upstream))
+	}
+	if config.DNSEnabled {
+		row("DNS servers", fmt.Sprintf("%s (timeout %s)", strings.Join(config.DNSServers, ", "), config.DNSTimeout))
+	} else {
+		row("DNS servers", "system")
+	}
+	overrideHosts := make([]string, 0, len(config.DNSOverrides))
+	for host := range config.DNSOverrides {
+		overrideHosts = append(overrideHosts, host)
+	}
+	sort.Strings(overrideHosts)
+	for _, host := range overrideHosts {
+		row("DNS servers for "+host, strings.Join(config.DNSOverrides[host], ", "))
+	}
+	fallbackHosts := make([]string, 0, len(config.DNSFallbackIPs))
+	for host := range config.DNSFallbackIPs {
+		fallbackHosts = append(fallbackHosts, host)
+	}
+	sort.Strings(fallbackHosts)
+	for _, host := range fallbackHosts {
+		row("DNS fallback IPs for "+host, formatIPAddrs(config.DNSFallbackIPs[host]))
+	}
+	if config.DNSPoisonCheck {
+		secondary := "none"
+		if len(config.DNSSecondaryServers) > 0 {
+			secondary = strings.Join(config.DNSSecondaryServers, ", ")
+		}
+		row("DNS poisoning checks", "secondary resolvers: "+secondary)
+		if len(config.DNSPrivateHosts) > 0 {
+			row("DNS private hosts", strings.Join(config.DNSPrivateHosts, ", "))
+		}
+	}
+	if config.EgressBind != "" {
+		row("egress bind", config.EgressBind)
+	} else {
+		row("egress bind", "system")
+	}
+	egressHosts := make([]string, 0, len(config.EgressOverrides))
+	for host := range config.EgressOverrides {
+		egressHosts = append(egressHosts, host)
+	}
+	sort.Strings(egressHosts)
+	for _, host := range egressHosts {
+		row("egress bind for "+host, config.EgressOverrides[host])
+	}
+	row("upstream IP family", fmt.Sprintf("%s (fallback delay %s)", config.UpstreamIPFamily, duration(config.UpstreamFallbackDelay)))
+	dialSettings := func(d DialSettings) string {
+		return fmt.Sprintf("dial %s, TLS handshake %s, keep-alive %s, max conns %d",
+			duration(d.DialTimeout), duration(d.TLSHandshakeTimeout), duration(d.KeepAlive), d.MaxConnsPerHost)
+	}
+	row("upstream connections", dialSettings(config.UpstreamDial))
+	if dialOverrides, err := parseDialOverrides(config.UpstreamDialOverrides, config.UpstreamDial); err == nil {
+		dialHosts := make([]string, 0, len(dialOverrides))
+		for host := range dialOverrides {
+			dialHosts = append(dialHosts, host)
+		}
+		sort.Strings(dialHosts)
+		for _, host := range dialHosts {
+			row("upstream connections to "+host, dialSettings(dialOverrides[host]))
+		}
+	}
+	if tlsProfiles, err := parseTLSProfiles(config.UpstreamTLSProfiles); err == nil {
+		tlsHosts := make([]string, 0, len(tlsProfiles))
+		for host := range tlsProfiles {
+			tlsHosts = append(tlsHosts, host)
+		}
+		sort.Strings(tlsHosts)
+		for _, host := range tlsHosts {
+			row("upstream TLS to "+host, tlsProfiles[host].String())
+		}
+	}
+	row("upstream TLS session cache", config.UpstreamTLSSessionCache)
+	if len(config.UpstreamPrewarm) > 0 {
+		row("upstream prewarm", fmt.Sprintf("%s (%d connections every %s)", strings.Join(config.UpstreamPrewarm, ", "),
+			config.UpstreamPrewarmConns, config.UpstreamPrewarmInterval))
+	}
+	row("upstream header timeout", duration(config.UpstreamTimeouts.ResponseHeader))
+	row("request timeout", duration(config.UpstreamTimeouts.Request))
+	statuses := make([]int, 0, len(config.RetryStatuses))
+	for code := range config.RetryStatuses {
+		statuses = append(statuses, code)
+	}
+	sort.Ints(statuses)
+	row("upstream retries", fmt.Sprintf("%d (backoff %s, max %s, statuses %v)", config.UpstreamTimeouts.Retries,
+		config.UpstreamTimeouts.Backoff, duration(config.UpstreamTimeouts.MaxBackoff), statuses))
+	row("upstream 429 backoff", fmt.Sprintf("%s (max %s, stale manifests kept %s)", duration(config.RateLimitBackoff),
+		duration(config.RateLimitMaxBackoff), duration(config.CacheStaleTTL)))
+	row("server timeouts", fmt.Sprintf("read %s, write %s, idle %s, header %s, shutdown %s",
+		duration(config.ServerReadTimeout), duration(config.ServerWriteTimeout),
+		duration(config.ServerIdleTimeout), duration(config.ServerReadHeaderTimeout), duration(config.ShutdownTimeout)))
+	row("max upstream requests", config.MaxUpstreamRequests)
+	row("max blob streams", config.MaxBlobStreams)
+	if config.ClientRateLimit > 0 {
+		row("client rate limit", fmt.Sprintf("%g/s per client (burst %d)", config.ClientRateLimit, clientRateBurst(config.ClientRateLimit, config.ClientRateBurst)))
+	} else {
+		row("client rate limit", "disabled")
+	}
+	row("max blob size", size(config.MaxBlobSize))
+	row("max image size", size(config.MaxImageSize))
+	row("client auth", config.AuthHtpasswd != "" || config.APITokensEnabled)
+	if config.MaintenanceMode {
+		row("maintenance mode", fmt.Sprintf("cache only (Retry-After %s)", duration(config.MaintenanceRetryAfter)))
+	}
+	minFree := "not checked"
+	if config.HealthMinFreeDisk > 0 {
+		minFree = cache.FormatBytes(config.HealthMinFreeDisk)
+	}
+	row("deep health check", fmt.Sprintf("timeout %s, min free disk %s", duration(config.HealthCheckTimeout), minFree))
+	if config.Admin.Enabled() {
+		row("admin API", fmt.Sprintf("%s (metrics protected: %v)", strings.Join(config.Admin.Methods(), ", "), config.Admin.ProtectMetrics))
+	} else {
+		row("admin API", false)
+	}
+
+	fmt.Fprintln(w, "\nRoutes:")
+	for _, host := range sortedRouteHosts(config) {
+		if u, err := url.Parse(config.Routes[host]); err == nil && config.BucketOrigins[u.Host] != nil {
+			origin := config.BucketOrigins[u.Host]
+			row(host, fmt.Sprintf("%s (bucket, region %s, credentials from %s)", origin, origin.Region, origin.credsSource))
+			continue
+		}
+		row(host, config.Routes[host])
+	}
+	helmHosts := make([]string, 0, len(config.HelmRoutes))
+	for host := range config.HelmRoutes {
+		helmHosts = append(helmHosts, host)
+	}
+	sort.Strings(helmHosts)
+	for _, host := range helmHosts {
+		u, _ := url.Parse(config.HelmRoutes[host])
+		row(host, u.Redacted()+" (helm)")
+	}
+	for _, host := range sortedFileMirrorHosts(config) {
+		route := config.FileMirrors[host]
+		u, _ := url.Parse(route.Upstream)
+		row(host, fmt.Sprintf("%s (file mirror, paths: %s)", u.Redacted(), route.describePaths()))
+	}
+	w.Flush()
+}
+
+func sortedRouteHosts(config *Config) []string {
+	hosts := make([]string, 0, len(config.Routes))
+	for host := range config.Routes {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestCheckCommand(t *testing.T) {
+	notDir := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(notDir, nil, 0o644)
+
+	for _, tc := range []struct {
+		name     string
+		env      map[string]string
+		code     int
+		problems []string // 输出中应报告的问题
+	}{
+		{
+			name: "valid",
+			env: map[string]string{
+				"CACHE_MANIFEST_TTL":      "2h",
+				"CACHE_COMPRESS_METADATA": "true",
+				"DNS_SERVERS":             "1.1.1.1:53",
+			},
+			code: 0,
+		},
+		{
+			name: "invalid",
+			env: map[string]string{
+				"CUSTOM_DOMAIN":           "bad_domain!",
+				"CACHE_DIR":               filepath.Join(notDir, "cache"),
+				"CACHE_MANIFEST_TTL":      "soon",
+				"CACHE_COMPRESS_METADATA": "yes",
+				"DNS_ENABLED":             "true",
+				"DNS_SERVERS":             "dns.example:53",
+				"UPSTREAM_RETRY_STATUSES": "700",
+				"TLS_CERT_FILE":           "/missing/cert.pem",
+			},
+			code: 1,
+			problems: []string{
+				`CUSTOM_DOMAIN: "bad_domain!" is not a valid hostname`,
+				"CACHE_DIR:",
+				"CACHE_MANIFEST_TTL:",
+				`CACHE_COMPRESS_METADATA: "yes" is treated as false`,
+				`DNS_SERVERS: "dns.example" is not an IP address`,
+				`UPSTREAM_RETRY_STATUSES: "700" is not an HTTP status code`,
+				"TLS_CERT_FILE and TLS_KEY_FILE must be set together",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("CONFIG_FILE", "")
+			t.Setenv("CACHE_DIR", t.TempDir())
+			t.Setenv("CUSTOM_DOMAIN", "example.test")
+			for key, value := range tc.env {
+				t.Setenv(key, value)
+			}
+
+			var code int
+			stdout, _ := captureOutput(t, func() { code = RunCheckCommand(nil) })
+			if code != tc.code {
+				t.Errorf("check exited %d, want %d:\n%s", code, tc.code, stdout)
+			}
+			// 无论是否有问题都打印生效配置
+			if !strings.Contains(stdout, "Effective configuration:") || !regexp.MustCompile(`custom domain\s+\S`).MatchString(stdout) {
+				t.Errorf("effective configuration not printed:\n%s", stdout)
+			}
+			if tc.code == 0 {
+				if !strings.Contains(stdout, "Configuration OK") || strings.Contains(stdout, "✗") {
+					t.Errorf("valid configuration reported problems:\n%s", stdout)
+				}
+				if !regexp.MustCompile(`cache compress metadata\s+true`).MatchString(stdout) {
+					t.Errorf("effective configuration does not reflect the environment:\n%s", stdout)
+				}
+				return
+			}
+			if !regexp.MustCompile(`\d+ problem\(s\) found`).MatchString(stdout) {
+				t.Errorf("problem summary missing:\n%s", stdout)
+			}
+			for _, want := range tc.problems {
+				if !strings.Contains(stdout, "✗ "+want) {
+					t.Errorf("problem %q not reported:\n%s", want, stdout)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckCommandRejectsArguments(t *testing.T) {
+	var code int
+	captureOutput(t, func() { code = RunCheckCommand([]string{"-unknown"}) })
+	if code != 2 {
+		t.Errorf("check with an unknown flag exited %d, want 2", code)
+	}
+}
@@ -0,0 +1,327 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// =============================================================================
+// 客户端认证 - 基于 htpasswd (bcrypt) 的代理级访问控制
+// =============================================================================
+
+const (
+	// issuedTokenTTL 代理签发（或转发）的 token 有效期上限
+	issuedTokenTTL = time.Hour
+	// defaultTokenExpiresIn 上游未返回 expires_in 时使用的有效期（与 Docker Hub 一致）
+	defaultTokenExpiresIn = 300
+	// credentialCacheTTL 已验证凭据的缓存时间，避免每次请求都执行 bcrypt
+	credentialCacheTTL = 5 * time.Minute
+)
+
+// issuedToken 通过 /v2/auth 发放给客户端的 token
+type issuedToken struct {
+	User      string
+	Proxy     bool // 代理自行签发的 token（上游无需认证），转发时需要去掉
+	ExpiresAt time.Time
+}
+
+// ClientAuth htpasswd / API token 客户端认证
+//
+// 认证流程：
+//  1. /v2/auth 要求 Basic 认证，凭据通过 htpasswd 或 API token（作为密码）校验，
+//     客户端凭据不会转发给上游
+//  2. 上游需要认证时匿名获取上游 token 并登记；否则由代理签发 token
+//  3. 其余 /v2/* 请求必须携带已登记的 Bearer token（或有效的 Basic 凭据）
+type ClientAuth struct {
+	path      string
+	debug     bool
+	apiTokens *TokenStore // API token（可为 nil）
+
+	mu    sync.RWMutex
+	users map[string]string // 用户名 -> bcrypt 哈希
+
+	tokens      *expirable.LRU[string, issuedToken] // sha256(token) -> 登记信息
+	credentials *expirable.LRU[string, string]      // sha256(user:pass) -> 用户名
+}
+
+// NewClientAuth 创建客户端认证，path 为空时仅使用 API token
+func NewClientAuth(path string, apiTokens *TokenStore, debug bool) (*ClientAuth, error) {
+	a := &ClientAuth{
+		path:        path,
+		debug:       debug,
+		apiTokens:   apiTokens,
+		tokens:      expirable.NewLRU[string, issuedToken](100000, nil, issuedTokenTTL),
+		credentials: expirable.NewLRU[string, string](10000, nil, credentialCacheTTL),
+	}
+	if err := a.Reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Reload 重新加载 htpasswd 文件
+func (a *ClientAuth) Reload() error {
+	users, err := a.loadUsers()
+	if err != nil {
+		return err
+	}
+	a.setUsers(users)
+	return nil
+}
+
+// loadUsers 读取 htpasswd 文件但不生效，未配置文件时返回 nil
+func (a *ClientAuth) loadUsers() (map[string]string, error) {
+	if a.path == "" {
+		return nil, nil
+	}
+	return loadHtpasswd(a.path)
+}
+
+// setUsers 替换用户表并清空凭据校验缓存
+func (a *ClientAuth) setUsers(users map[string]string) {
+	if a.path == "" {
+		return
+	}
+
+	a.mu.Lock()
+	a.users = users
+	a.mu.Unlock()
+	a.credentials.Purge()
+
+	log.Printf("Client auth enabled: %d users loaded from %s", len(users), a.path)
+}
+
+// loadHtpasswd 解析 htpasswd 文件，只支持 bcrypt 哈希
+func loadHtpasswd(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open htpasswd file: %w", err)
+	}
+	defer file.Close()
+
+	users := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("htpasswd line %d: invalid format", lineNum)
+		}
+		if !strings.HasPrefix(hash, "$2") {
+			return nil, fmt.Errorf("htpasswd line %d: only bcrypt hashes are supported (use htpasswd -B)", lineNum)
+		}
+		users[user] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read htpasswd file: %w", err)
+	}
+	return users, nil
+}
+
+// verifyBasic 校验 Basic 认证凭据，返回客户端身份
+// 密码为 API token 时用户名任意，身份为 token:<name>
+func (a *ClientAuth) verifyBasic(user, password string) (string, bool) {
+	if a.apiTokens != nil {
+		if identity, ok := a.apiTokens.Authenticate(password); ok {
+			return identity, true
+		}
+	}
+
+	credKey := hashKey(user + ":" + password)
+	if cached, ok := a.credentials.Get(credKey); ok && cached == user {
+		return user, true
+	}
+
+	a.mu.RLock()
+	hash, exists := a.users[user]
+	a.mu.RUnlock()
+	if !exists {
+		return "", false
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return "", false
+	}
+	a.credentials.Add(credKey, user)
+	return user, true
+}
+
+// lookupToken 查找已登记的 Bearer token
+func (a *ClientAuth) lookupToken(token string) (issuedToken, bool) {
+	issued, ok := a.tokens.Get(hashKey(token))
+	if !ok || time.Now().After(issued.ExpiresAt) {
+		return issuedToken{}, false
+	}
+	return issued, true
+}
+
+// registerToken 登记发放给客户端的 token
+func (a *ClientAuth) registerToken(token, user string, proxy bool, expiresIn int) {
+	if token == "" {
+		return
+	}
+	if expiresIn <= 0 {
+		expiresIn = defaultTokenExpiresIn
+	}
+	ttl := time.Duration(expiresIn) * time.Second
+	if ttl > issuedTokenTTL {
+		ttl = issuedTokenTTL
+	}
+	a.tokens.Add(hashKey(token), issuedToken{
+		User:      user,
+		Proxy:     proxy,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+}
+
+// Middleware 在 /v2 路由上执行客户端认证
+func (a *ClientAuth) Middleware(p *ProxyServer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			isAuthEndpoint := r.URL.Path == "/v2/auth"
+
+			// Basic 认证：/v2/auth 的标准方式，其他端点也接受（如 curl -u）
+			if user, password, ok := r.BasicAuth(); ok {
+				start := time.Now()
+				identity, valid := a.verifyBasic(user, password)
+				timingFromContext(r.Context()).add(PhaseAuth, time.Since(start))
+				if !valid {
+					if a.debug {
+						log.Printf("[DEBUG] Client auth failed for user %q from %s", user, r.RemoteAddr)
+					}
+					a.writeBasicChallenge(w)
+					return
+				}
+				// 客户端凭据只用于代理认证，不能转发给上游
+				r.Header.Del("Authorization")
+				a.serve(p, identity, next, w, r)
+				return
+			}
+
+			if isAuthEndpoint {
+				a.writeBasicChallenge(w)
+				return
+			}
+
+			// Bearer token：通过 /v2/auth 发放的 token，或直接使用 API token
+			if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+				if issued, found := a.lookupToken(token); found {
+					if issued.Proxy {
+						r.Header.Del("Authorization")
+					}
+					a.serve(p, issued.User, next, w, r)
+					return
+				}
+				if a.apiTokens != nil {
+					if identity, valid := a.apiTokens.Authenticate(token); valid {
+						r.Header.Del("Authorization")
+						a.serve(p, identity, next, w, r)
+						return
+					}
+				}
+			}
+
+			// 未认证：Helm 等文件路由的客户端只支持 Basic 认证，镜像仓库返回 Bearer 挑战，引导客户端走 /v2/auth
+			if p.fileRoute(r) {
+				a.writeBasicChallenge(w)
+				return
+			}
+			p.responseUnauthorized(w, r)
+		})
+	}
+}
+
+// serve 将认证用户记入客户端身份并继续处理，扩展钩子可拒绝该身份，API token 身份需通过配额检查
+func (a *ClientAuth) serve(p *ProxyServer, identity string, next http.Handler, w http.ResponseWriter, r *http.Request) {
+	r = withAuthenticatedUser(r, identity)
+	if err := p.hookAuth(r, identity); err != nil {
+		p.writeRegistryError(w, http.StatusForbidden, "DENIED", err.Error())
+		return
+	}
+	if a.apiTokens != nil {
+		a.apiTokens.ServeWithQuota(p, identity, next, w, r)
+		return
+	}
+	next.ServeHTTP(w, r)
+}
+
+// writeBasicChallenge 返回 Basic 认证挑战
+func (a *ClientAuth) writeBasicChallenge(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="go-docker-proxy"`)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "UNAUTHORIZED",
+	})
+}
+
+// tokenResponse 上游 token 端点的响应（兼容 token 和 access_token 两种字段）
+type tokenResponse struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// RegisterUpstreamToken 读取上游 token 响应并登记，返回原始响应内容
+func (a *ClientAuth) RegisterUpstreamToken(resp *http.Response, user string) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		var tr tokenResponse
+		if err := json.Unmarshal(body, &tr); err == nil {
+			a.registerToken(tr.Token, user, false, tr.ExpiresIn)
+			if tr.AccessToken != "" && tr.AccessToken != tr.Token {
+				a.registerToken(tr.AccessToken, user, false, tr.ExpiresIn)
+			}
+		}
+	}
+	return body, nil
+}
+
+// WriteProxyToken 上游无需认证时由代理签发 token
+func (a *ClientAuth) WriteProxyToken(w http.ResponseWriter, user string) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		http.Error(w, "failed to issue token", http.StatusInternalServerError)
+		return
+	}
+	token := hex.EncodeToString(buf)
+	a.registerToken(token, user, true, defaultTokenExpiresIn)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":        token,
+		"access_token": token,
+		"expires_in":   defaultTokenExpiresIn,
+		"issued_at":    time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// hashKey 凭据与 token 在内存中只保存 sha256
+func hashKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
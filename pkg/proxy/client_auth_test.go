@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// writeHtpasswd 写入 bcrypt htpasswd 文件，users 为用户名 -> 密码
+func writeHtpasswd(t *testing.T, users map[string]string) string {
+	t.Helper()
+	var lines []string
+	for user, password := range users {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, user+":"+string(hash))
+	}
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func basicAuth(user, password string) http.Header {
+	return http.Header{"Authorization": {"Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+password))}}
+}
+
+func TestClientAuthHtpasswd(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	upstream.addImage("team/app", "v1", []byte("layer"))
+	_, client := newTestProxy(t, upstream, map[string]string{
+		"AUTH_HTPASSWD": writeHtpasswd(t, map[string]string{"dev": "s3cret"}),
+	})
+	manifestPath := "/v2/team/app/manifests/v1"
+
+	// 未认证的请求得到指向 /v2/auth 的 Bearer 挑战，/v2/auth 本身要求 Basic 认证
+	resp, _ := client.do("GET", "/v2/", nil)
+	if resp.StatusCode != http.StatusUnauthorized || !strings.Contains(resp.Header.Get("WWW-Authenticate"), "/v2/auth") {
+		t.Fatalf("GET /v2/: status %d, challenge %q", resp.StatusCode, resp.Header.Get("WWW-Authenticate"))
+	}
+	authPath := "/v2/auth?" + url.Values{"service": {"go-docker-proxy"}, "scope": {"repository:team/app:pull"}}.Encode()
+	for _, header := range []http.Header{nil, basicAuth("dev", "wrong"), basicAuth("nobody", "s3cret")} {
+		resp, _ := client.do("GET", authPath, header)
+		if resp.StatusCode != http.StatusUnauthorized || !strings.HasPrefix(resp.Header.Get("WWW-Authenticate"), "Basic ") {
+			t.Errorf("GET /v2/auth with %v: status %d, challenge %q", header, resp.StatusCode, resp.Header.Get("WWW-Authenticate"))
+		}
+	}
+	if n := upstream.count("GET", "/token"); n != 0 {
+		t.Errorf("unauthenticated token requests reached upstream %d times", n)
+	}
+
+	// 伪造的 Bearer token 不会转发给上游
+	requests := upstream.count("GET", manifestPath)
+	if resp, _ := client.do("GET", manifestPath, http.Header{"Authorization": {"Bearer forged"}, "Accept": {fakeManifestType}}); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("manifest with forged token: status %d, want 401", resp.StatusCode)
+	}
+	if upstream.count("GET", manifestPath) != requests {
+		t.Error("request with forged token reached upstream")
+	}
+
+	// 登录后换取上游 token 拉取，客户端凭据不会转发给上游
+	resp, body := client.do("GET", authPath, basicAuth("dev", "s3cret"))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /v2/auth with valid credentials: status %d: %s", resp.StatusCode, body)
+	}
+	if got := upstream.header("GET", "/token").Get("Authorization"); got != "" {
+		t.Errorf("client credentials forwarded to upstream token endpoint: %q", got)
+	}
+	var token struct {
+		Token string `json:"token"`
+	}
+	json.Unmarshal(body, &token)
+	client.token = token.Token
+	client.pull("team/app", "v1")
+
+	// 也可以直接以 Basic 认证访问（如 curl -u）
+	client.token = ""
+	header := basicAuth("dev", "s3cret")
+	header.Set("Accept", fakeManifestType)
+	if resp, body := client.do("GET", manifestPath, header); resp.StatusCode != http.StatusOK {
+		t.Errorf("manifest with Basic credentials: status %d: %s", resp.StatusCode, body)
+	}
+	if got := upstream.header("GET", manifestPath).Get("Authorization"); strings.HasPrefix(got, "Basic ") {
+		t.Error("client Basic credentials forwarded to upstream")
+	}
+}
+
+func TestLoadHtpasswd(t *testing.T) {
+	path := writeHtpasswd(t, map[string]string{"dev": "s3cret"})
+	users, err := loadHtpasswd(path)
+	if err != nil || !strings.HasPrefix(users["dev"], "$2") {
+		t.Fatalf("loadHtpasswd = %v, %v", users, err)
+	}
+
+	for name, content := range map[string]string{
+		"sha1":       "dev:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n",
+		"no hash":    "dev\n",
+		"empty user": ":$2y$05$abc\n",
+	} {
+		path := filepath.Join(t.TempDir(), "htpasswd")
+		os.WriteFile(path, []byte("# comment\n\n"+content), 0o600)
+		if _, err := loadHtpasswd(path); err == nil {
+			t.Errorf("%s: loadHtpasswd accepted %q", name, content)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/hashicorp/golang-lru/v2/expirable"
+)
+
+// =============================================================================
+// 客户端身份 - 每个请求解析一次（来源 IP、客户端证书 CN，通过认证后补充用户名或 API token），
+// 写入 context，供限流、配额、用量、事件、通知、错误报告与指标统一使用
+// =============================================================================
+
+// 身份类型，按优先级：API token > htpasswd 用户 > 客户端证书 > 来源 IP
+const (
+	IdentityToken = "token"
+	IdentityUser  = "user"
+	IdentityCert  = "cert"
+	IdentityIP    = "ip"
+)
+
+const (
+	// clientLimiterSize 限流器跟踪的客户端数上限，超出时淘汰最久未访问的客户端
+	clientLimiterSize = 10000
+	// clientLimiterIdle 客户端空闲超过该时间后丢弃其令牌桶
+	clientLimiterIdle = 10 * time.Minute
+	// maxClientMetrics 按身份输出指标的已认证客户端数上限，超出的计入 client="other"
+	maxClientMetrics = 1000
+)
+
+// ClientIdentity 请求的客户端身份
+type ClientIdentity struct {
+	IP   string // 来源 IP（仅采信 TRUSTED_PROXIES 转发的 X-Forwarded-For / X-Real-IP）
+	Cert string // 已验证的客户端证书 CN
+
+	mu   sync.Mutex
+	user string // 通过认证的 htpasswd 用户名，API token 为 token:名称
+}
+
+type clientIdentityKey struct{}
+
+// ClientIdentityFromContext 获取请求的客户端身份，未经过 clientIdentityMiddleware 时返回 nil
+func ClientIdentityFromContext(ctx context.Context) *ClientIdentity {
+	id, _ := ctx.Value(clientIdentityKey{}).(*ClientIdentity)
+	return id
+}
+
+// ClientUserFromContext 获取通过认证的客户端用户名
+func ClientUserFromContext(ctx context.Context) string {
+	return ClientIdentityFromContext(ctx).User()
+}
+
+// clientIdentityOf 返回请求的客户端身份；请求未经过 clientIdentityMiddleware 时按连接信息解析
+func clientIdentityOf(r *http.Request) *ClientIdentity {
+	if id := ClientIdentityFromContext(r.Context()); id != nil {
+		return id
+	}
+	return resolveClientIdentity(r)
+}
+
+// resolveClientIdentity 从连接信息解析身份：来源 IP 与已验证的客户端证书
+func resolveClientIdentity(r *http.Request) *ClientIdentity {
+	id := &ClientIdentity{IP: r.RemoteAddr}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		id.IP = host
+	}
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		id.Cert = r.TLS.VerifiedChains[0][0].Subject.CommonName
+	}
+	return id
+}
+
+// withAuthenticatedUser 记录通过认证的用户；身份在外层中间件中创建，外层在请求结束后也能读到用户
+func withAuthenticatedUser(r *http.Request, user string) *http.Request {
+	id := ClientIdentityFromContext(r.Context())
+	if id == nil {
+		id = resolveClientIdentity(r)
+		r = r.WithContext(context.WithValue(r.Context(), clientIdentityKey{}, id))
+	}
+	id.mu.Lock()
+	id.user = user
+	id.mu.Unlock()
+	return r
+}
+
+// User 通过认证的用户名（API token 为 token:名称），未认证时为空
+func (id *ClientIdentity) User() string {
+	if id == nil {
+		return ""
+	}
+	id.mu.Lock()
+	defer id.mu.Unlock()
+	return id.user
+}
+
+// Kind 身份类型
+func (id *ClientIdentity) Kind() string {
+	kind, _ := id.kindAndName()
+	return kind
+}
+
+// kindAndName 身份类型与名称（来源 IP 身份的名称为 IP）
+func (id *ClientIdentity) kindAndName() (string, string) {
+	if id == nil {
+		return IdentityIP, ""
+	}
+	if user := id.User(); user != "" {
+		if name, ok := strings.CutPrefix(user, apiTokenUserPrefix); ok {
+			return IdentityToken, name
+		}
+		return IdentityUser, user
+	}
+	if id.Cert != "" {
+		return IdentityCert, id.Cert
+	}
+	return IdentityIP, id.IP
+}
+
+// String 日志、用量与事件中显示的客户端：用户名、token:名称、cert:CN，或来源 IP
+func (id *ClientIdentity) String() string {
+	kind, name := id.kindAndName()
+	switch kind {
+	case IdentityToken, IdentityCert:
+		return kind + ":" + name
+	}
+	return name
+}
+
+// clientIdentityMiddleware 解析客户端身份写入 context，并按身份统计请求与响应字节数
+func (p *ProxyServer) clientIdentityMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := resolveClientIdentity(r)
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(context.WithValue(r.Context(), clientIdentityKey{}, id)))
+		p.clientStats.record(id, int64(ww.BytesWritten()))
+	})
+}
+
+// =============================================================================
+// 按身份限流 - CLIENT_RATE_LIMIT（每秒请求数）与 CLIENT_RATE_BURST 为每个客户端身份维护令牌桶，
+// 已认证客户端按用户 / token / 证书计数，不受共享出口 IP 影响
+// =============================================================================
+
+// clientBucket 单个客户端的令牌桶
+type clientBucket struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// clientLimiter 按客户端身份限流
+type clientLimiter struct {
+	rate    float64
+	burst   float64
+	buckets *expirable.LRU[string, *clientBucket]
+	mu      sync.Mutex // 保证同一客户端只创建一个令牌桶
+}
+
+// newClientLimiter rate <= 0 时返回 nil（不限流）
+func newClientLimiter(rate float64, burst int) *clientLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &clientLimiter{
+		rate:    rate,
+		burst:   float64(clientRateBurst(rate, burst)),
+		buckets: expirable.NewLRU[string, *clientBucket](clientLimiterSize, nil, clientLimiterIdle),
+	}
+}
+
+// clientRateBurst 突发上限，未设置 CLIENT_RATE_BURST 时为每秒请求数（至少 1）
+func clientRateBurst(rate float64, burst int) int {
+	if burst >= 1 {
+		return burst
+	}
+	if int(rate) >= 1 {
+		return int(rate)
+	}
+	return 1
+}
+
+// allow 取一个令牌，令牌不足时返回需要等待的时间
+func (l *clientLimiter) allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	b, ok := l.buckets.Get(key)
+	if !ok {
+		b = &clientBucket{tokens: l.burst, last: time.Now()}
+	}
+	l.buckets.Add(key, b) // 刷新空闲期限
+	l.mu.Unlock()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * l.rate
+	if b.tokens > l.burst {
+		b.tokens = l.burst
+	}
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// clientRateLimitMiddleware 位于客户端认证之后，按认证后的身份限流，超出时返回 429
+func (p *ProxyServer) clientRateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := ClientIdentityFromContext(r.Context())
+		kind, name := id.kindAndName()
+		if ok, wait := p.clientLimiter.allow(kind + ":" + name); !ok {
+			p.clientStats.limited(id)
+			w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			p.writeRegistryError(w, http.StatusTooManyRequests, "TOOMANYREQUESTS", "client request rate limit exceeded")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// =============================================================================
+// 按身份统计 - 已认证客户端按名称输出，来源 IP 身份只按类型汇总，避免指标基数随 IP 增长
+// =============================================================================
+
+// clientCounter 单个客户端的计数
+type clientCounter struct {
+	requests int64
+	bytes    int64
+	limited  int64
+}
+
+// clientStats 按 [身份类型, 名称] 统计
+type clientStats struct {
+	mu       sync.Mutex
+	counters map[[2]string]*clientCounter
+}
+
+func newClientStats() *clientStats {
+	return &clientStats{counters: make(map[[2]string]*clientCounter)}
+}
+
+// counterFor 获取身份的计数器（调用方持有锁）
+func (s *clientStats) counterFor(id *ClientIdentity) *clientCounter {
+	kind, name := id.kindAndName()
+	if kind == IdentityIP {
+		name = ""
+	}
+	key := [2]string{kind, name}
+	c, ok := s.counters[key]
+	if !ok {
+		if len(s.counters) >= maxClientMetrics {
+			key[1] = "other"
+			if c, ok = s.counters[key]; ok {
+				return c
+			}
+		}
+		c = &clientCounter{}
+		s.counters[key] = c
+	}
+	return c
+}
+
+func (s *clientStats) record(id *ClientIdentity, bytes int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.counterFor(id)
+	c.requests++
+	c.bytes += bytes
+}
+
+func (s *clientStats) limited(id *ClientIdentity) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counterFor(id).limited++
+}
+
+// writeMetrics 输出按客户端身份的请求、字节与限流计数
+func (s *clientStats) writeMetrics(m *metricsWriter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([][2]string, 0, len(s.counters))
+	for key := range s.counters {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	for _, key := range keys {
+		m.counter("docker_proxy_client_requests_total", "Requests by client identity (IP clients aggregated)",
+			float64(s.counters[key].requests), "kind", key[0], "client", key[1])
+	}
+	for _, key := range keys {
+		m.counter("docker_proxy_client_response_bytes_total", "Response bytes by client identity",
+			float64(s.counters[key].bytes), "kind", key[0], "client", key[1])
+	}
+	for _, key := range keys {
+		if c := s.counters[key]; c.limited > 0 {
+			m.counter("docker_proxy_client_rate_limited_total", "Requests rejected by CLIENT_RATE_LIMIT", float64(c.limited), "kind", key[0], "client", key[1])
+		}
+	}
+}
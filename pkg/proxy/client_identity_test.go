@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestClientIdentityRateLimit(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	upstream.addImage("team/app", "v1", []byte("app layer"))
+	var htpasswd bytes.Buffer
+	for _, user := range []string{"alice", "bob"} {
+		hash, _ := bcrypt.GenerateFromPassword([]byte(user+"-pw"), bcrypt.MinCost)
+		fmt.Fprintf(&htpasswd, "%s:%s\n", user, hash)
+	}
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	os.WriteFile(path, htpasswd.Bytes(), 0o600)
+	_, client := newTestProxy(t, upstream, map[string]string{
+		"AUTH_HTPASSWD":     path,
+		"CLIENT_RATE_LIMIT": "0.01",
+		"CLIENT_RATE_BURST": "2",
+	})
+
+	manifest := func(user string) int {
+		req, _ := http.NewRequest("GET", client.base+"/v2/team/app/manifests/v1", nil)
+		req.Host = testRegistryHost
+		req.SetBasicAuth(user, user+"-pw")
+		resp, err := client.http.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	// 限流按认证用户计数：同一来源 IP 的不同用户互不影响（上游未登录返回 401，只关心是否被限流）
+	for i := 1; i <= 3; i++ {
+		if limited := manifest("alice") == http.StatusTooManyRequests; limited != (i == 3) {
+			t.Errorf("alice request %d: limited = %v", i, limited)
+		}
+	}
+	if got := manifest("bob"); got == http.StatusTooManyRequests {
+		t.Error("bob limited by alice's requests")
+	}
+	_, body := client.do("GET", "/metrics", nil)
+	for _, want := range []string{
+		`docker_proxy_client_requests_total{kind="user",client="alice"} 3`,
+		`docker_proxy_client_requests_total{kind="user",client="bob"} 1`,
+		`docker_proxy_client_rate_limited_total{kind="user",client="alice"} 1`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics missing %s", want)
+		}
+	}
+}
+
+// TestTrustedProxyClientIP 只有直连地址属于 TRUSTED_PROXIES 时才按 X-Forwarded-For 区分客户端，
+// 否则伪造的转发头不能绕过按来源 IP 的限流
+func TestTrustedProxyClientIP(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		trusted string
+		limited []bool // 依次以不同的 X-Forwarded-For 请求时是否被限流
+	}{
+		{"untrusted peer", "", []bool{false, true, true}},
+		{"trusted proxy", "127.0.0.1", []bool{false, false, true}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			upstream := newFakeRegistry(t)
+			upstream.addImage("team/app", "v1", []byte("app layer"))
+			_, client := newTestProxy(t, upstream, map[string]string{
+				"TRUSTED_PROXIES":   tc.trusted,
+				"CLIENT_RATE_LIMIT": "0.01",
+				"CLIENT_RATE_BURST": "1",
+			})
+			for i, forwarded := range []string{"203.0.113.1", "203.0.113.2", "203.0.113.2"} {
+				req, _ := http.NewRequest("GET", client.base+"/v2/team/app/manifests/v1", nil)
+				req.Host = testRegistryHost
+				req.Header.Set("X-Forwarded-For", forwarded)
+				resp, err := client.http.Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp.Body.Close()
+				if limited := resp.StatusCode == http.StatusTooManyRequests; limited != tc.limited[i] {
+					t.Errorf("request %d from %s: limited = %v, want %v", i+1, forwarded, limited, tc.limited[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,587 @@
+package proxy
+
+import (
+	"context"
+	crand "crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+// =============================================================================
+// 集群缓存共享 - 各实例互相同步已缓存的 blob 列表，缓存未命中时先从同伴节点获取
+// hash 模式下按 digest 一致性哈希确定唯一的归属节点，其他节点经归属节点获取且不在本地缓存
+// =============================================================================
+
+const (
+	clusterModeP2P  = "p2p"
+	clusterModeHash = "hash"
+
+	// clusterFullSyncEvery 每隔多少轮做一次全量同步（增量同步无法感知已删除的 blob）
+	clusterFullSyncEvery = 10
+	// clusterRingReplicas 一致性哈希环上每个节点的虚拟节点数
+	clusterRingReplicas = 128
+	// clusterUpstreamAuthHeader /_cluster/fill 请求携带客户端的上游凭据（Authorization 用于节点间认证）
+	clusterUpstreamAuthHeader = "X-Cluster-Upstream-Authorization"
+)
+
+// clusterFillKey 标记经 /_cluster/fill 转发的请求，避免再次转发
+type clusterFillKey struct{}
+
+// Cluster 集群节点状态，nil 表示未启用
+type Cluster struct {
+	p        *ProxyServer
+	id       string   // 本节点 ID，用于在同伴列表中识别自己
+	peers    []string // 配置的同伴地址（http://host:port 或 dns+http://name:port）
+	mode     string   // p2p 或 hash
+	secret   string
+	interval time.Duration
+	client   *http.Client
+
+	mu    sync.RWMutex
+	nodes map[string]*clusterNode // 同伴 base URL -> 状态
+	ring  *hashRing               // hash 模式下由健康节点（含自身）构成
+	round int
+
+	peerHits         atomic.Int64
+	peerMisses       atomic.Int64
+	peerBytes        atomic.Int64
+	peerUnauthorized atomic.Int64 // 归属节点回源时上游返回 401
+}
+
+// clusterNode 单个同伴节点
+type clusterNode struct {
+	URL      string    `json:"url"`
+	ID       string    `json:"id,omitempty"`
+	Self     bool      `json:"self,omitempty"`
+	Healthy  bool      `json:"healthy"`
+	Blobs    int       `json:"blobs"`
+	LastSync time.Time `json:"lastSync"`
+	Error    string    `json:"error,omitempty"`
+
+	digests map[string]struct{}
+	since   string // 上次同步时对方的时间，用于增量同步
+}
+
+// clusterDigests /_cluster/digests 响应
+type clusterDigests struct {
+	Node    string   `json:"node"`
+	Time    string   `json:"time"`
+	Full    bool     `json:"full"`
+	Digests []string `json:"digests"`
+}
+
+// ClusterConfig 集群缓存共享配置，Peers 为空时不启用
+type ClusterConfig struct {
+	Peers        []string      // 同伴地址；dns+http://name:port 解析域名的所有地址（如 Kubernetes headless service）
+	Mode         string        // p2p（从已缓存的同伴获取）或 hash（一致性哈希，每个 blob 只缓存在归属节点）
+	Secret       string        // 节点间请求使用的共享密钥
+	SyncInterval time.Duration // 同步已缓存 blob 列表的间隔
+	PeerTimeout  time.Duration // 向同伴请求 blob 的响应头超时，超时后回源上游
+}
+
+// loadClusterConfig 从环境变量读取集群配置
+//
+//	CLUSTER_PEERS          同伴地址，逗号分隔
+//	CLUSTER_MODE           p2p（默认）或 hash
+//	CLUSTER_SECRET         节点间请求使用的共享密钥（必填）
+//	CLUSTER_SYNC_INTERVAL  同步间隔（默认 30s）
+//	CLUSTER_PEER_TIMEOUT   向同伴请求 blob 的响应头超时（默认 2s）
+func loadClusterConfig() ClusterConfig {
+	return ClusterConfig{
+		Peers:        getEnvList("CLUSTER_PEERS"),
+		Mode:         getEnv("CLUSTER_MODE", clusterModeP2P),
+		Secret:       getEnv("CLUSTER_SECRET", ""),
+		SyncInterval: parseDuration(getEnv("CLUSTER_SYNC_INTERVAL", "30s"), 30*time.Second),
+		PeerTimeout:  parseDuration(getEnv("CLUSTER_PEER_TIMEOUT", "2s"), 2*time.Second),
+	}
+}
+
+// NewCluster 按 p.config.Cluster 创建集群节点，未配置同伴时返回 nil
+// /_cluster 接口可以读取缓存并触发回源，不经过 /v2 的客户端认证与限流，因此必须配置共享密钥
+func NewCluster(p *ProxyServer) (*Cluster, error) {
+	config := p.config.Cluster
+	peers := config.Peers
+	if len(peers) == 0 {
+		return nil, nil
+	}
+	secret := config.Secret
+	if secret == "" {
+		return nil, fmt.Errorf("CLUSTER_SECRET is required when CLUSTER_PEERS is set")
+	}
+
+	id := make([]byte, 8)
+	crand.Read(id)
+
+	timeout := config.PeerTimeout
+	c := &Cluster{
+		p:        p,
+		id:       hex.EncodeToString(id),
+		peers:    peers,
+		mode:     config.Mode,
+		secret:   secret,
+		interval: config.SyncInterval,
+		client: &http.Client{
+			Transport: &http.Transport{
+				Proxy:                 nil, // 同伴在内网，不经过 HTTP_PROXY
+				DialContext:           (&net.Dialer{Timeout: timeout}).DialContext,
+				ResponseHeaderTimeout: timeout,
+				MaxIdleConnsPerHost:   16,
+				IdleConnTimeout:       90 * time.Second,
+			},
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		nodes: make(map[string]*clusterNode),
+	}
+	if c.mode != clusterModeP2P && c.mode != clusterModeHash {
+		log.Printf("[Cluster] Unknown CLUSTER_MODE %q, using %s", c.mode, clusterModeP2P)
+		c.mode = clusterModeP2P
+	}
+	if c.interval <= 0 {
+		c.interval = 30 * time.Second
+	}
+	log.Printf("[Cluster] Node %s (%s mode), peers: %s", c.id, c.mode, strings.Join(peers, ", "))
+	return c, nil
+}
+
+// Run 周期性同步同伴的 blob 列表，直到 ctx 结束
+func (c *Cluster) Run(ctx context.Context) {
+	if c == nil {
+		return
+	}
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		c.syncAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// resolvePeers 展开同伴地址，dns+ 前缀的地址解析为所有 IP
+func (c *Cluster) resolvePeers(ctx context.Context) []string {
+	var result []string
+	for _, peer := range c.peers {
+		spec, isDNS := strings.CutPrefix(peer, "dns+")
+		u, err := url.Parse(strings.TrimRight(spec, "/"))
+		if err != nil || u.Host == "" {
+			log.Printf("[Cluster] Invalid peer %q", peer)
+			continue
+		}
+		if !isDNS {
+			result = append(result, u.String())
+			continue
+		}
+
+		addrs, err := net.DefaultResolver.LookupHost(ctx, u.Hostname())
+		if err != nil {
+			log.Printf("[Cluster] Failed to resolve %s: %v", u.Hostname(), err)
+			continue
+		}
+		for _, addr := range addrs {
+			peerURL := *u
+			peerURL.Host = addr
+			if port := u.Port(); port != "" {
+				peerURL.Host = net.JoinHostPort(addr, port)
+			} else if strings.Contains(addr, ":") {
+				peerURL.Host = "[" + addr + "]"
+			}
+			result = append(result, peerURL.String())
+		}
+	}
+	return result
+}
+
+func (c *Cluster) syncAll(ctx context.Context) {
+	urls := c.resolvePeers(ctx)
+
+	c.mu.Lock()
+	c.round++
+	full := c.round%clusterFullSyncEvery == 1
+	current := make(map[string]*clusterNode, len(urls))
+	for _, u := range urls {
+		node, ok := c.nodes[u]
+		if !ok {
+			node = &clusterNode{URL: u, digests: make(map[string]struct{})}
+		}
+		current[u] = node
+	}
+	c.nodes = current
+	c.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, node := range current {
+		if node.Self {
+			continue
+		}
+		wg.Add(1)
+		go func(node *clusterNode) {
+			defer wg.Done()
+			c.sync(ctx, node, full)
+		}(node)
+	}
+	wg.Wait()
+
+	if c.mode == clusterModeHash {
+		c.mu.Lock()
+		c.ring = newHashRing(c.nodes)
+		c.mu.Unlock()
+	}
+}
+
+// sync 拉取同伴新缓存的 blob（全量同步时替换整个列表）
+func (c *Cluster) sync(ctx context.Context, node *clusterNode, full bool) {
+	c.mu.RLock()
+	since := node.since
+	c.mu.RUnlock()
+
+	target := node.URL + "/_cluster/digests"
+	if !full && since != "" {
+		target += "?since=" + url.QueryEscape(since)
+	}
+	var result clusterDigests
+	err := c.getJSON(ctx, target, &result)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	node.LastSync = time.Now()
+	if err != nil {
+		if node.Healthy {
+			log.Printf("[Cluster] Peer %s unreachable: %v", node.URL, err)
+		}
+		node.Healthy = false
+		node.Error = err.Error()
+		return
+	}
+
+	node.ID = result.Node
+	node.Error = ""
+	if result.Node == c.id {
+		node.Self = true
+		node.Healthy = true
+		node.digests = nil
+		return
+	}
+	if !node.Healthy {
+		log.Printf("[Cluster] Peer %s (%s) is up", node.URL, result.Node)
+	}
+	node.Healthy = true
+	node.since = result.Time
+	if c.mode == clusterModeHash {
+		return // hash 模式按归属节点获取，不需要对方的 blob 列表
+	}
+	if result.Full {
+		node.digests = make(map[string]struct{}, len(result.Digests))
+	}
+	for _, digest := range result.Digests {
+		node.digests[digest] = struct{}{}
+	}
+	node.Blobs = len(node.digests)
+}
+
+func (c *Cluster) getJSON(ctx context.Context, target string, v interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, c.interval)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+	if err != nil {
+		return err
+	}
+	c.authorize(req)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (c *Cluster) authorize(req *http.Request) {
+	req.Header.Set("Authorization", "Bearer "+c.secret)
+}
+
+// holders 返回已缓存该 digest 的健康同伴，顺序随机以分散负载
+func (c *Cluster) holders(digest string) []*clusterNode {
+	c.mu.RLock()
+	var result []*clusterNode
+	for _, node := range c.nodes {
+		if _, ok := node.digests[digest]; ok && node.Healthy && !node.Self {
+			result = append(result, node)
+		}
+	}
+	c.mu.RUnlock()
+
+	rand.Shuffle(len(result), func(i, j int) { result[i], result[j] = result[j], result[i] })
+	return result
+}
+
+// forget 同伴返回 404 时移除该 digest（已被对方清理）
+func (c *Cluster) forget(node *clusterNode, digest string) {
+	c.mu.Lock()
+	delete(node.digests, digest)
+	node.Blobs = len(node.digests)
+	c.mu.Unlock()
+}
+
+// fetchBlob 从集群获取 blob，返回 nil 时由调用方回源上游
+// p2p 模式从已缓存该 blob 的同伴获取，内容写入本地缓存时同样校验 digest；
+// hash 模式经归属节点获取（cacheable 为 false，不在本地重复缓存），自身为归属节点时直接回源；
+// 客户端的上游 token 经 X-Cluster-Upstream-Authorization 转交归属节点
+func (c *Cluster) fetchBlob(r, req *http.Request) (resp *http.Response, cacheable bool) {
+	if c == nil || req.Method != "GET" || r.Context().Value(clusterFillKey{}) != nil {
+		return nil, true
+	}
+	digest := cache.GetDigestFromPath(req.URL.Path)
+	if !strings.HasPrefix(digest, "sha256:") {
+		return nil, true
+	}
+
+	if c.mode == clusterModeHash {
+		owner := c.owner(digest)
+		if owner == nil || owner.Self {
+			return nil, true
+		}
+		query := url.Values{"host": {r.Host}, "path": {r.URL.Path}}
+		if resp := c.get(req, owner, "/_cluster/fill?"+query.Encode(), digest, r.Header.Get("Authorization")); resp != nil {
+			return resp, false
+		}
+		// 归属节点不可用时退化为本地回源并缓存
+		c.peerMisses.Add(1)
+		return nil, true
+	}
+
+	for _, node := range c.holders(digest) {
+		if resp := c.get(req, node, "/_cluster/blobs/"+digest, digest, ""); resp != nil {
+			return resp, true
+		}
+	}
+	c.peerMisses.Add(1)
+	return nil, true
+}
+
+// get 向节点请求 blob，只接受 200 / 206 响应；upstreamAuth 非空时作为归属节点回源使用的上游凭据
+func (c *Cluster) get(req *http.Request, node *clusterNode, path, digest, upstreamAuth string) *http.Response {
+	peerReq, err := http.NewRequestWithContext(req.Context(), "GET", node.URL+path, nil)
+	if err != nil {
+		return nil
+	}
+	if rangeHeader := req.Header.Get("Range"); rangeHeader != "" {
+		peerReq.Header.Set("Range", rangeHeader)
+	}
+	if upstreamAuth != "" {
+		peerReq.Header.Set(clusterUpstreamAuthHeader, upstreamAuth)
+	}
+	c.authorize(peerReq)
+
+	resp, err := c.client.Do(peerReq)
+	if err != nil {
+		log.Printf("[Cluster] Failed to fetch %s from %s: %v", digest, node.URL, err)
+		return nil
+	}
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusPartialContent {
+		c.peerHits.Add(1)
+		if resp.ContentLength > 0 {
+			c.peerBytes.Add(resp.ContentLength)
+		}
+		if c.p.config.Debug {
+			log.Printf("[DEBUG] [Cluster] %s served by peer %s", digest, node.URL)
+		}
+		return resp
+	}
+
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNotFound:
+		c.forget(node, digest)
+	case http.StatusUnauthorized:
+		// 节点间密钥不一致，或归属节点回源时上游拒绝了客户端的凭据
+		c.peerUnauthorized.Add(1)
+		log.Printf("[Cluster] Peer %s returned 401 for %s, fetching locally", node.URL, digest)
+	}
+	return nil
+}
+
+// owner 返回 digest 的归属节点，尚未建立哈希环时返回 nil
+func (c *Cluster) owner(digest string) *clusterNode {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.ring.lookup(digest)
+}
+
+// hashRing 一致性哈希环，节点增减时只有相邻区间的 digest 更换归属
+type hashRing struct {
+	points []uint64
+	nodes  map[uint64]*clusterNode
+}
+
+// newHashRing 以节点 URL 构建哈希环，各节点的同伴列表一致时得到相同的环
+func newHashRing(nodes map[string]*clusterNode) *hashRing {
+	ring := &hashRing{nodes: make(map[uint64]*clusterNode)}
+	for _, node := range nodes {
+		if !node.Healthy {
+			continue
+		}
+		for i := 0; i < clusterRingReplicas; i++ {
+			point := ringHash(node.URL + "#" + strconv.Itoa(i))
+			ring.points = append(ring.points, point)
+			ring.nodes[point] = node
+		}
+	}
+	sort.Slice(ring.points, func(i, j int) bool { return ring.points[i] < ring.points[j] })
+	return ring
+}
+
+func (r *hashRing) lookup(key string) *clusterNode {
+	if r == nil || len(r.points) == 0 {
+		return nil
+	}
+	h := ringHash(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.nodes[r.points[i]]
+}
+
+func ringHash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+// Stats 集群状态
+func (c *Cluster) Stats() map[string]interface{} {
+	c.mu.RLock()
+	nodes := make([]clusterNode, 0, len(c.nodes))
+	for _, node := range c.nodes {
+		nodes = append(nodes, *node)
+	}
+	c.mu.RUnlock()
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].URL < nodes[j].URL })
+
+	return map[string]interface{}{
+		"node":             c.id,
+		"mode":             c.mode,
+		"peers":            nodes,
+		"peerHits":         c.peerHits.Load(),
+		"peerMisses":       c.peerMisses.Load(),
+		"peerBytes":        cache.FormatBytes(c.peerBytes.Load()),
+		"peerUnauthorized": c.peerUnauthorized.Load(),
+	}
+}
+
+// writeMetrics 输出集群指标
+func (c *Cluster) writeMetrics(m *metricsWriter) {
+	m.counter("docker_proxy_cluster_peer_hits_total", "Blob cache misses served by a peer", float64(c.peerHits.Load()))
+	m.counter("docker_proxy_cluster_peer_misses_total", "Blob cache misses no peer could serve", float64(c.peerMisses.Load()))
+	m.counter("docker_proxy_cluster_peer_bytes_total", "Bytes fetched from peers", float64(c.peerBytes.Load()))
+	m.counter("docker_proxy_cluster_peer_unauthorized_total", "Peer blob requests answered with 401", float64(c.peerUnauthorized.Load()))
+}
+
+// =============================================================================
+// 节点间接口 - /_cluster/*
+// =============================================================================
+
+// registerClusterRoutes 注册节点间接口
+func (p *ProxyServer) registerClusterRoutes(r chi.Router) {
+	r.Route("/_cluster", func(r chi.Router) {
+		r.Use(p.cluster.authMiddleware(p))
+		r.Get("/digests", p.handleClusterDigests)
+		r.Get("/blobs/{digest}", p.handleClusterBlob)
+		r.Get("/fill", p.handleClusterFill)
+	})
+}
+
+func (c *Cluster) authMiddleware(p *ProxyServer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(c.secret)) != 1 {
+				p.writeErrorResponse(w, "cluster authentication required", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// handleClusterDigests 返回本节点已缓存的 blob 列表，?since= 只返回该时间之后缓存的
+func (p *ProxyServer) handleClusterDigests(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	result := clusterDigests{Node: p.cluster.id, Time: now.Format(time.RFC3339Nano), Full: true}
+
+	var since time.Time
+	if s := r.URL.Query().Get("since"); s != "" {
+		if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			since = t
+			result.Full = false
+		}
+	}
+	if p.cacheManager != nil {
+		result.Digests = p.cacheManager.BlobStore().Digests(since)
+	}
+	p.writeJSON(w, http.StatusOK, result)
+}
+
+// handleClusterBlob 只从本地缓存提供 blob，不回源上游
+func (p *ProxyServer) handleClusterBlob(w http.ResponseWriter, r *http.Request) {
+	digest := chi.URLParam(r, "digest")
+	if p.cacheManager == nil || !strings.HasPrefix(digest, "sha256:") {
+		http.NotFound(w, r)
+		return
+	}
+	entry, reader, found := p.cacheManager.GetBlobReader("/blobs/" + digest)
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	p.serveCachedBlobStream(w, r, entry, reader)
+}
+
+// handleClusterFill hash 模式下其他节点转发的 blob 请求：按原始路由与路径处理（命中缓存或回源并缓存），
+// 以转交的客户端上游凭据代替节点间密钥
+func (p *ProxyServer) handleClusterFill(w http.ResponseWriter, r *http.Request) {
+	host, path := r.URL.Query().Get("host"), r.URL.Query().Get("path")
+	if pathType, _, _ := cache.ParsePath(path); pathType != "blob" || host == "" {
+		p.writeErrorResponse(w, "invalid fill request", http.StatusBadRequest)
+		return
+	}
+
+	fill := r.Clone(context.WithValue(r.Context(), clusterFillKey{}, true))
+	fill.Host = host
+	fill.URL.Path = path
+	fill.URL.RawPath = ""
+	fill.URL.RawQuery = ""
+	fill.RequestURI = path
+	fill.Header.Del("Authorization")
+	if auth := fill.Header.Get(clusterUpstreamAuthHeader); auth != "" {
+		fill.Header.Set("Authorization", auth)
+	}
+	fill.Header.Del(clusterUpstreamAuthHeader)
+	p.handleV2Request(w, fill)
+}
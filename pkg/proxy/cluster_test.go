@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+func TestClusterRequiresSecret(t *testing.T) {
+	config := &Config{Cluster: ClusterConfig{Peers: []string{"http://127.0.0.1:1"}, Mode: clusterModeP2P}}
+	if _, err := NewCluster(&ProxyServer{config: config}); err == nil {
+		t.Fatal("NewCluster accepted CLUSTER_PEERS without CLUSTER_SECRET")
+	}
+}
+
+func TestClusterEndpointsRequireSecret(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	_, layers := upstream.addImage("team/app", "v1", []byte("layer"))
+	_, client := newTestProxy(t, upstream, map[string]string{
+		"CLUSTER_PEERS":  "http://127.0.0.1:1",
+		"CLUSTER_SECRET": "cluster-secret",
+	})
+
+	query := url.Values{"host": {testRegistryHost}, "path": {"/v2/team/app/blobs/" + layers[0]}}
+	for _, path := range []string{"/_cluster/fill?" + query.Encode(), "/_cluster/digests", "/_cluster/blobs/" + layers[0]} {
+		for _, auth := range []string{"", "Bearer wrong-secret", "Bearer fake-token"} {
+			header := http.Header{}
+			if auth != "" {
+				header.Set("Authorization", auth)
+			}
+			if resp, _ := client.do("GET", path, header); resp.StatusCode != http.StatusUnauthorized {
+				t.Errorf("GET %s with %q: status %d, want 401", path, auth, resp.StatusCode)
+			}
+		}
+	}
+	if n := upstream.count("GET", "/v2/team/app/blobs/"+layers[0]); n != 0 {
+		t.Errorf("unauthenticated fill reached upstream %d times", n)
+	}
+
+	resp, _ := client.do("GET", "/_cluster/digests", http.Header{"Authorization": {"Bearer cluster-secret"}})
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET /_cluster/digests with secret: status %d, want 200", resp.StatusCode)
+	}
+}
+
+// newTestCluster 创建 hash 模式下互为同伴的两个节点，并完成一轮同步建立哈希环
+// 节点创建时即开始后台同步，同伴地址需要预先确定，因此先启动转发到各节点的服务
+func newTestCluster(t *testing.T, upstream *fakeRegistry) ([]*ProxyServer, []*testClient) {
+	t.Helper()
+	var handlers [2]atomic.Pointer[http.Handler]
+	var peers []string
+	for i := range handlers {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if h := handlers[i].Load(); h != nil {
+				(*h).ServeHTTP(w, r)
+				return
+			}
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+		t.Cleanup(server.Close)
+		peers = append(peers, server.URL)
+	}
+
+	env := map[string]string{
+		"CLUSTER_PEERS":  strings.Join(peers, ","),
+		"CLUSTER_MODE":   clusterModeHash,
+		"CLUSTER_SECRET": "cluster-secret",
+	}
+	var nodes []*ProxyServer
+	var clients []*testClient
+	for i := range handlers {
+		p, client := newTestProxy(t, upstream, env)
+		handler := p.Handler()
+		handlers[i].Store(&handler)
+		nodes, clients = append(nodes, p), append(clients, client)
+	}
+	for _, p := range nodes {
+		p.cluster.syncAll(context.Background())
+	}
+	return nodes, clients
+}
+
+func TestClusterHashFillUsesClientUpstreamToken(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	_, layers := upstream.addImage("team/app", "v1", []byte("layer one"), []byte("layer two"), []byte("layer three"))
+	nodes, clients := newTestCluster(t, upstream)
+
+	blobCached := func(p *ProxyServer, digest string) bool {
+		_, reader, found := p.cacheManager.GetBlobReader(cache.CacheKey(testRegistryHost, "/v2/team/app/blobs/"+digest))
+		if found {
+			reader.Close()
+		}
+		return found
+	}
+
+	for _, digest := range layers {
+		owner := nodes[0].cluster.owner(digest)
+		if owner == nil {
+			t.Fatal("hash ring not built")
+		}
+		// 经非归属节点拉取，blob 应由归属节点回源并缓存
+		requester, holder := 0, 1
+		if owner.ID == nodes[0].cluster.id {
+			requester, holder = 1, 0
+		}
+		clients[requester].login("team/app")
+		resp, body := clients[requester].do("GET", "/v2/team/app/blobs/"+digest, nil)
+		if resp.StatusCode != http.StatusOK || fakeDigest(body) != digest {
+			t.Fatalf("GET blob %s via node %d: status %d", digest, requester, resp.StatusCode)
+		}
+
+		eventually(t, "blob cached on owner", func() bool { return blobCached(nodes[holder], digest) })
+		if blobCached(nodes[requester], digest) {
+			t.Errorf("blob %s cached on non-owner node %d", digest, requester)
+		}
+		if n := upstream.count("GET", "/v2/team/app/blobs/"+digest); n != 1 {
+			t.Errorf("blob %s fetched from upstream %d times, want 1", digest, n)
+		}
+	}
+
+	for _, p := range nodes {
+		if n := p.cluster.peerUnauthorized.Load(); n != 0 {
+			t.Errorf("peer 401s: %d", n)
+		}
+	}
+}
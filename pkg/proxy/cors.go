@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// =============================================================================
+// CORS - 允许浏览器中的镜像仓库 UI、WASM 工具等跨域调用 /v2 API
+// =============================================================================
+
+// CORSConfig 跨域访问配置，AllowedOrigins 为空时不启用
+type CORSConfig struct {
+	AllowedOrigins   []string // 允许的来源，支持 * 与 https://*.example.com
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string // 浏览器脚本可以读取的响应头
+	AllowCredentials bool
+	MaxAge           time.Duration // 预检结果缓存时间
+}
+
+// loadCORSConfig 从环境变量读取 CORS 配置
+func loadCORSConfig() CORSConfig {
+	config := CORSConfig{
+		AllowedOrigins:   getEnvList("CORS_ALLOWED_ORIGINS"),
+		AllowedMethods:   getEnvList("CORS_ALLOWED_METHODS"),
+		AllowedHeaders:   getEnvList("CORS_ALLOWED_HEADERS"),
+		ExposedHeaders:   getEnvList("CORS_EXPOSED_HEADERS"),
+		AllowCredentials: getEnv("CORS_ALLOW_CREDENTIALS", "false") == "true",
+		MaxAge:           parseDuration(getEnv("CORS_MAX_AGE", "10m"), 10*time.Minute),
+	}
+	if len(config.AllowedMethods) == 0 {
+		config.AllowedMethods = []string{"GET", "HEAD", "OPTIONS"}
+	}
+	if len(config.AllowedHeaders) == 0 {
+		config.AllowedHeaders = []string{"Authorization", "Accept", "Content-Type", "Range", "Docker-Distribution-Api-Version"}
+	}
+	if len(config.ExposedHeaders) == 0 {
+		config.ExposedHeaders = []string{
+			"Content-Length", "Content-Range", "Docker-Content-Digest", "Docker-Distribution-Api-Version",
+			"Link", "WWW-Authenticate", "X-Cache", "X-Cache-Upstream", "X-Proxy-Timing",
+		}
+	}
+	return config
+}
+
+// allowsOrigin 来源是否在允许列表中
+func (c *CORSConfig) allowsOrigin(origin string) bool {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		// https://*.example.com 匹配任意子域名
+		if scheme, domain, ok := strings.Cut(allowed, "://*."); ok {
+			rest, found := strings.CutPrefix(strings.ToLower(origin), strings.ToLower(scheme)+"://")
+			if found && strings.HasSuffix(rest, "."+strings.ToLower(domain)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// corsMiddleware 为允许的来源添加 CORS 响应头，并直接响应预检请求（预检不携带凭据，不经过客户端认证）
+func (p *ProxyServer) corsMiddleware(next http.Handler) http.Handler {
+	config := &p.config.CORS
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		if !config.allowsOrigin(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowOrigin := origin
+		if len(config.AllowedOrigins) == 1 && config.AllowedOrigins[0] == "*" && !config.AllowCredentials {
+			allowOrigin = "*"
+		}
+		w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+		if config.AllowCredentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(config.AllowedMethods, ", "))
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(config.AllowedHeaders, ", "))
+			if config.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(config.MaxAge.Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Set("Access-Control-Expose-Headers", strings.Join(config.ExposedHeaders, ", "))
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCORSPreflightAndResponseHeaders(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	upstream.addImage("team/app", "v1", []byte("layer"))
+	_, client := newTestProxy(t, upstream, map[string]string{
+		"CORS_ALLOWED_ORIGINS": "https://*.ui.test",
+	})
+
+	// 预检请求不携带 token，必须在客户端认证之前直接响应
+	preflight := http.Header{
+		"Origin":                         {"https://registry.ui.test"},
+		"Access-Control-Request-Method":  {"GET"},
+		"Access-Control-Request-Headers": {"authorization"},
+	}
+	resp, _ := client.do("OPTIONS", "/v2/team/app/manifests/v1", preflight)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("preflight: status %d, want 204", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "https://registry.ui.test" {
+		t.Errorf("preflight: Access-Control-Allow-Origin %q", got)
+	}
+	if !strings.Contains(resp.Header.Get("Access-Control-Allow-Headers"), "Authorization") {
+		t.Errorf("preflight: Access-Control-Allow-Headers %q lacks Authorization", resp.Header.Get("Access-Control-Allow-Headers"))
+	}
+
+	client.login("team/app")
+	resp, _ = client.do("GET", "/v2/team/app/manifests/v1", http.Header{"Origin": {"https://registry.ui.test"}})
+	if !strings.Contains(resp.Header.Get("Access-Control-Expose-Headers"), "Docker-Content-Digest") {
+		t.Errorf("Access-Control-Expose-Headers %q lacks Docker-Content-Digest", resp.Header.Get("Access-Control-Expose-Headers"))
+	}
+	resp, _ = client.do("GET", "/v2/team/app/manifests/v1", http.Header{"Origin": {"https://evil.test"}})
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("disallowed origin got Access-Control-Allow-Origin %q", got)
+	}
+}
@@ -0,0 +1,368 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+// =============================================================================
+// Cosign 签名校验 - 对配置的仓库在提供 manifest 前校验签名
+// =============================================================================
+
+const (
+	// cosignSignatureAnnotation 签名层上保存 base64 签名的注解
+	cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+	// cosignVerifyTimeout 单次校验（拉取签名或执行 cosign CLI）的超时时间
+	cosignVerifyTimeout = 60 * time.Second
+)
+
+var (
+	// errUnsigned 镜像没有签名
+	errUnsigned = errors.New("no cosign signature found")
+	// errInvalidSignature 存在签名但均未通过校验
+	errInvalidSignature = errors.New("no valid cosign signature")
+)
+
+// KeylessIdentity keyless（Fulcio 证书）签名的身份约束
+type KeylessIdentity struct {
+	Issuer         string `json:"issuer,omitempty"`
+	IssuerRegexp   string `json:"issuerRegexp,omitempty"`
+	Identity       string `json:"identity,omitempty"`
+	IdentityRegexp string `json:"identityRegexp,omitempty"`
+}
+
+// SignaturePolicy 一组仓库的签名要求，keys 与 keyless 满足其一即可
+//
+//	{"repositories": ["docker.example.com/myorg/*"], "keys": ["/etc/cosign/cosign.pub"]}
+type SignaturePolicy struct {
+	Repositories []string         `json:"repositories"`
+	Keys         []string         `json:"keys,omitempty"`
+	Keyless      *KeylessIdentity `json:"keyless,omitempty"`
+
+	publicKeys []crypto.PublicKey
+}
+
+// SignatureVerifier 按策略校验镜像签名并缓存结果
+type SignatureVerifier struct {
+	policies []*SignaturePolicy
+	enforce  bool
+	cosign   string // cosign CLI 路径（keyless 校验）
+	debug    bool
+
+	results *expirable.LRU[string, string] // {repo}@{digest} -> 失败原因（空字符串表示通过）
+}
+
+// SignatureConfig cosign 签名校验配置，Policy 为空时不启用
+type SignatureConfig struct {
+	Policy   string        // 策略文件（JSON）
+	Enforce  bool          // 拒绝未签名或签名无效的镜像（false 时只记录日志）
+	Binary   string        // keyless 校验使用的 cosign 可执行文件
+	CacheTTL time.Duration // 校验结果缓存时间
+}
+
+// loadSignatureConfig 从环境变量读取签名校验配置
+//
+//	COSIGN_POLICY     策略文件
+//	COSIGN_MODE       enforce（默认）或 warn
+//	COSIGN_BINARY     cosign 可执行文件（默认 cosign）
+//	COSIGN_CACHE_TTL  校验结果缓存时间（默认 1h）
+func loadSignatureConfig() SignatureConfig {
+	return SignatureConfig{
+		Policy:   getEnv("COSIGN_POLICY", ""),
+		Enforce:  getEnv("COSIGN_MODE", "enforce") != "warn",
+		Binary:   getEnv("COSIGN_BINARY", "cosign"),
+		CacheTTL: parseDuration(getEnv("COSIGN_CACHE_TTL", "1h"), time.Hour),
+	}
+}
+
+// NewSignatureVerifier 加载签名策略文件，未配置时返回 nil
+func NewSignatureVerifier(config SignatureConfig, debug bool) (*SignatureVerifier, error) {
+	path := config.Policy
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cosign policy: %w", err)
+	}
+	var policies []*SignaturePolicy
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return nil, fmt.Errorf("failed to parse cosign policy: %w", err)
+	}
+
+	needCLI := false
+	for i, policy := range policies {
+		if len(policy.Keys) == 0 && policy.Keyless == nil {
+			return nil, fmt.Errorf("cosign policy %d: keys or keyless is required", i)
+		}
+		for _, keyFile := range policy.Keys {
+			key, err := loadPublicKey(keyFile)
+			if err != nil {
+				return nil, fmt.Errorf("cosign policy %d: %w", i, err)
+			}
+			policy.publicKeys = append(policy.publicKeys, key)
+		}
+		if policy.Keyless != nil {
+			needCLI = true
+		}
+	}
+
+	v := &SignatureVerifier{
+		policies: policies,
+		enforce:  config.Enforce,
+		debug:    debug,
+		results:  expirable.NewLRU[string, string](10000, nil, config.CacheTTL),
+	}
+	if needCLI {
+		binary := config.Binary
+		if binary == "" {
+			binary = "cosign"
+		}
+		if v.cosign, err = exec.LookPath(binary); err != nil {
+			return nil, fmt.Errorf("keyless policy requires cosign CLI: %w", err)
+		}
+	}
+
+	log.Printf("Cosign signature verification enabled: %d policies (enforce: %v)", len(policies), v.enforce)
+	return v, nil
+}
+
+// loadPublicKey 读取 PEM 格式公钥（ECDSA / RSA / Ed25519）
+func loadPublicKey(path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("invalid PEM public key %s", path)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key %s: %w", path, err)
+	}
+	return key, nil
+}
+
+// verifyWithKey 使用公钥校验 payload 的签名
+func verifyWithKey(key crypto.PublicKey, payload, signature []byte) bool {
+	digest := sha256.Sum256(payload)
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.VerifyASN1(k, digest[:], signature)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], signature) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, payload, signature)
+	}
+	return false
+}
+
+// signaturePolicyCheck manifest 策略检查：对匹配策略的仓库校验签名
+func (p *ProxyServer) signaturePolicyCheck(r *http.Request, digest string) (string, bool) {
+	v := p.signatures
+	_, repo, _ := cache.ParsePath(r.URL.Path)
+	name := repositoryName(r.Host, repo)
+
+	var policy *SignaturePolicy
+	for _, sp := range v.policies {
+		if matchRepository(sp.Repositories, name) {
+			policy = sp
+			break
+		}
+	}
+	if policy == nil {
+		return "", false
+	}
+
+	var reason string
+	if digest == "" {
+		reason = "upstream response has no Docker-Content-Digest"
+	} else if cached, ok := v.results.Get(name + "@" + digest); ok {
+		reason = cached
+	} else {
+		upstream := p.routeByHost(r.Host)
+		err := v.verify(r.Context(), p, policy, upstream, repo, digest)
+		if err != nil {
+			reason = err.Error()
+		}
+		// 网络等临时错误不缓存，下次请求重新校验
+		if err == nil || errors.Is(err, errUnsigned) || errors.Is(err, errInvalidSignature) {
+			v.results.Add(name+"@"+digest, reason)
+		}
+	}
+
+	if reason == "" {
+		if v.debug {
+			log.Printf("[DEBUG] Cosign signature verified: %s@%s", name, digest)
+		}
+		return "", false
+	}
+	if !v.enforce {
+		log.Printf("Cosign verification failed (warn mode): %s@%s: %s", name, digest, reason)
+		return "", false
+	}
+	return fmt.Sprintf("signature verification failed for %s@%s: %s", name, digest, reason), true
+}
+
+// verify 按策略校验：公钥签名优先，其次 keyless
+func (v *SignatureVerifier) verify(ctx context.Context, p *ProxyServer, policy *SignaturePolicy, upstream, repo, digest string) error {
+	ctx, cancel := context.WithTimeout(ctx, cosignVerifyTimeout)
+	defer cancel()
+
+	var keyErr error
+	if len(policy.publicKeys) > 0 {
+		keyErr = v.verifyKeys(ctx, p, policy, upstream, repo, digest)
+		if keyErr == nil || policy.Keyless == nil {
+			return keyErr
+		}
+	}
+	return v.verifyKeyless(ctx, policy.Keyless, upstream, repo, digest)
+}
+
+// verifyKeys 拉取 sha256-{hex}.sig 签名 manifest，逐层校验 simple signing payload
+func (v *SignatureVerifier) verifyKeys(ctx context.Context, p *ProxyServer, policy *SignaturePolicy, upstream, repo, digest string) error {
+	sigTag := strings.Replace(digest, ":", "-", 1) + ".sig"
+	resp, err := p.fetchFromUpstream(ctx, upstream, repo, "manifests", sigTag,
+		[]string{MediaTypeOCIManifest, MediaTypeDockerManifest})
+	if err != nil {
+		return fmt.Errorf("failed to fetch signature: %w", err)
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxCacheableSize))
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return errUnsigned
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("signature manifest status %d", resp.StatusCode)
+	}
+
+	manifest, err := ParseManifest(body, resp.Header.Get("Content-Type"))
+	if err != nil {
+		return fmt.Errorf("invalid signature manifest: %w", err)
+	}
+
+	for _, layer := range manifest.Layers {
+		encoded := layer.Annotations[cosignSignatureAnnotation]
+		if encoded == "" {
+			continue
+		}
+		signature, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			continue
+		}
+
+		payload, err := v.fetchPayload(ctx, p, upstream, repo, layer.Digest)
+		if err != nil {
+			return err
+		}
+		if !payloadMatchesDigest(payload, digest) {
+			continue
+		}
+		for _, key := range policy.publicKeys {
+			if verifyWithKey(key, payload, signature) {
+				return nil
+			}
+		}
+	}
+	return errInvalidSignature
+}
+
+// fetchPayload 拉取签名层（simple signing payload）并校验其 digest
+func (v *SignatureVerifier) fetchPayload(ctx context.Context, p *ProxyServer, upstream, repo, layerDigest string) ([]byte, error) {
+	resp, err := p.fetchFromUpstream(ctx, upstream, repo, "blobs", layerDigest, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch signature payload: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("signature payload status %d", resp.StatusCode)
+	}
+
+	payload, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(payload)
+	if "sha256:"+hex.EncodeToString(sum[:]) != layerDigest {
+		return nil, fmt.Errorf("signature payload digest mismatch")
+	}
+	return payload, nil
+}
+
+// payloadMatchesDigest 检查 simple signing payload 是否指向该 manifest digest
+func payloadMatchesDigest(payload []byte, digest string) bool {
+	var simpleSigning struct {
+		Critical struct {
+			Image struct {
+				DockerManifestDigest string `json:"docker-manifest-digest"`
+			} `json:"image"`
+		} `json:"critical"`
+	}
+	if err := json.Unmarshal(payload, &simpleSigning); err != nil {
+		return false
+	}
+	return simpleSigning.Critical.Image.DockerManifestDigest == digest
+}
+
+// verifyKeyless 调用 cosign verify 校验 Fulcio 证书签名与 Rekor 记录（直接访问上游）
+func (v *SignatureVerifier) verifyKeyless(ctx context.Context, identity *KeylessIdentity, upstream, repo, digest string) error {
+	registry := strings.TrimPrefix(strings.TrimPrefix(upstream, "https://"), "http://")
+	if registry == "registry-1.docker.io" {
+		registry = "index.docker.io"
+	}
+
+	args := []string{"verify", "--output", "json"}
+	if identity.Issuer != "" {
+		args = append(args, "--certificate-oidc-issuer", identity.Issuer)
+	}
+	if identity.IssuerRegexp != "" {
+		args = append(args, "--certificate-oidc-issuer-regexp", identity.IssuerRegexp)
+	}
+	if identity.Identity != "" {
+		args = append(args, "--certificate-identity", identity.Identity)
+	}
+	if identity.IdentityRegexp != "" {
+		args = append(args, "--certificate-identity-regexp", identity.IdentityRegexp)
+	}
+	args = append(args, registry+"/"+repo+"@"+digest)
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, v.cosign, args...)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			msg := lastLine(stderr.String())
+			if strings.Contains(msg, "no signatures found") || strings.Contains(msg, "no matching signatures") {
+				return fmt.Errorf("%w: %s", errUnsigned, msg)
+			}
+			return fmt.Errorf("%w: %s", errInvalidSignature, msg)
+		}
+		return fmt.Errorf("cosign verify failed: %w", err)
+	}
+	return nil
+}
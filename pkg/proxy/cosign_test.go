@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// addCosignSignature 按 cosign 的存储方式为 manifest 添加公钥签名：
+// sha256-{hex}.sig 签名 manifest，层内容为 simple signing payload，签名放在层注解中
+func (f *fakeRegistry) addCosignSignature(repo, digest string, key *ecdsa.PrivateKey) {
+	payload, _ := json.Marshal(map[string]interface{}{
+		"critical": map[string]interface{}{
+			"identity": map[string]string{"docker-reference": testRegistryHost + "/" + repo},
+			"image":    map[string]string{"docker-manifest-digest": digest},
+			"type":     "cosign container image signature",
+		},
+	})
+	sum := sha256.Sum256(payload)
+	signature, err := ecdsa.SignASN1(rand.Reader, key, sum[:])
+	if err != nil {
+		panic(err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.blobs[fakeDigest(payload)] = payload
+	manifest, _ := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     fakeManifestType,
+		"config":        map[string]interface{}{"mediaType": "application/vnd.oci.image.config.v1+json", "digest": fakeDigest([]byte("{}")), "size": 2},
+		"layers": []interface{}{map[string]interface{}{
+			"mediaType":   "application/vnd.dev.cosign.simplesigning.v1+json",
+			"digest":      fakeDigest(payload),
+			"size":        len(payload),
+			"annotations": map[string]string{cosignSignatureAnnotation: base64.StdEncoding.EncodeToString(signature)},
+		}},
+	})
+	f.manifests[repo+":"+strings.Replace(digest, ":", "-", 1)+".sig"] = manifest
+}
+
+func TestCosignKeyVerification(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	signed, _ := upstream.addImage("team/app", "signed", []byte("signed layer"))
+	upstream.addImage("team/app", "unsigned", []byte("unsigned layer"))
+	forged, _ := upstream.addImage("team/app", "forged", []byte("forged layer"))
+	upstream.addImage("other/app", "v1", []byte("unchecked layer"))
+
+	policyFile, key := writeCosignPolicy(t)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream.addCosignSignature("team/app", signed, key)
+	upstream.addCosignSignature("team/app", forged, otherKey)
+	_, client := newTestProxy(t, upstream, map[string]string{"COSIGN_POLICY": policyFile})
+
+	accept := http.Header{"Accept": {fakeManifestType}}
+	client.login("team/app")
+	for _, tt := range []struct {
+		tag    string
+		status int
+		reason string
+	}{
+		{"signed", http.StatusOK, ""},
+		{"unsigned", http.StatusForbidden, errUnsigned.Error()},
+		{"forged", http.StatusForbidden, errInvalidSignature.Error()},
+	} {
+		resp, body := client.do("GET", "/v2/team/app/manifests/"+tt.tag, accept)
+		if resp.StatusCode != tt.status || !strings.Contains(string(body), tt.reason) {
+			t.Errorf("%s: status %d: %s", tt.tag, resp.StatusCode, body)
+		}
+	}
+
+	// 校验结果按 digest 缓存，不再拉取签名
+	sigPath := "/v2/team/app/manifests/" + strings.Replace(signed, ":", "-", 1) + ".sig"
+	if n := upstream.count("GET", sigPath); n == 0 {
+		t.Fatalf("signature manifest %s was never fetched", sigPath)
+	}
+	fetched := upstream.count("GET", sigPath)
+	client.do("GET", "/v2/team/app/manifests/"+signed, accept)
+	if n := upstream.count("GET", sigPath); n != fetched {
+		t.Errorf("signature manifest fetched %d more times for a verified digest", n-fetched)
+	}
+
+	// 策略之外的仓库不校验签名
+	client.login("other/app")
+	if resp, body := client.do("GET", "/v2/other/app/manifests/v1", accept); resp.StatusCode != http.StatusOK {
+		t.Errorf("repository outside the policy: status %d: %s", resp.StatusCode, body)
+	}
+}
+
+func TestCosignWarnMode(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	upstream.addImage("team/app", "unsigned", []byte("unsigned layer"))
+	policyFile, _ := writeCosignPolicy(t)
+	_, client := newTestProxy(t, upstream, map[string]string{"COSIGN_POLICY": policyFile, "COSIGN_MODE": "warn"})
+
+	client.login("team/app")
+	if resp, body := client.do("GET", "/v2/team/app/manifests/unsigned", http.Header{"Accept": {fakeManifestType}}); resp.StatusCode != http.StatusOK {
+		t.Errorf("unsigned manifest in warn mode: status %d: %s", resp.StatusCode, body)
+	}
+}
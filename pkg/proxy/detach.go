@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+// =============================================================================
+// 断开后继续缓存 - 客户端中途断开时上游传输在后台继续，内容仍写入缓存；
+// 传输随缓存管理器关闭而取消，未完成的内容不会提交到缓存
+// =============================================================================
+
+// detachLimiter 限制同时脱离客户端生命周期的上游传输数量
+type detachLimiter struct {
+	lifecycle context.Context // 缓存管理器的生命周期
+	slots     chan struct{}
+	timeout   time.Duration
+}
+
+// newDetachLimiter max <= 0 时返回 nil（不启用）
+func newDetachLimiter(lifecycle context.Context, max int, timeout time.Duration) *detachLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &detachLimiter{lifecycle: lifecycle, slots: make(chan struct{}, max), timeout: timeout}
+}
+
+// detach 返回不随客户端断开而取消的 context（仍有超时上限，缓存关闭时取消）
+// 没有空闲名额时返回 ok=false，调用方沿用客户端 context
+func (d *detachLimiter) detach(parent context.Context) (ctx context.Context, release func(), ok bool) {
+	if d == nil {
+		return nil, nil, false
+	}
+	select {
+	case d.slots <- struct{}{}:
+	default:
+		return nil, nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(parent), d.timeout)
+	stop := context.AfterFunc(d.lifecycle, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+		<-d.slots
+	}, true
+}
+
+// active 正在进行的脱离客户端的传输数
+func (d *detachLimiter) active() int {
+	if d == nil {
+		return 0
+	}
+	return len(d.slots)
+}
+
+// wait 等待脱离客户端的传输全部结束（用于优雅关闭），ctx 结束时返回其错误
+func (d *detachLimiter) wait(ctx context.Context) error {
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for d.active() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// detachCacheFill 可缓存的 GET 请求改用脱离客户端的 context，返回的 release 需在响应处理完成后调用
+func (p *ProxyServer) detachCacheFill(r *http.Request, req *http.Request) (*http.Request, func()) {
+	if r.Method != "GET" || !p.config.CacheEnabled || !cache.IsCacheable(r.URL.Path) {
+		return req, func() {}
+	}
+	ctx, release, ok := p.detach.detach(req.Context())
+	if !ok {
+		return req, func() {}
+	}
+	return req.WithContext(ctx), release
+}
@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestCacheFillContinuesAfterClientDisconnect(t *testing.T) {
+	for _, tc := range []struct {
+		detachMax string
+		cached    bool
+	}{
+		{"1", true},
+		{"0", false},
+	} {
+		upstream := newFakeRegistry(t)
+		// 层大小超过 socket 缓冲区，客户端断开后代理的写入才会失败
+		layer := bytes.Repeat([]byte("detached layer "), 1<<19)
+		_, layers := upstream.addImage("team/app", "v1", layer)
+		p, client := newTestProxy(t, upstream, map[string]string{"CACHE_DETACH_MAX": tc.detachMax})
+		client.login("team/app")
+
+		// 上游先发送一半内容，客户端读到一部分后断开
+		gate := make(chan struct{})
+		upstream.configure(func(f *fakeRegistry) { f.blobGate = gate })
+		req, _ := http.NewRequest("GET", client.base+"/v2/team/app/blobs/"+layers[0], nil)
+		req.Host = testRegistryHost
+		req.Header.Set("Authorization", "Bearer "+client.token)
+		resp, err := client.http.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadFull(resp.Body, make([]byte, len(layer)/4)); err != nil {
+			t.Fatalf("reading first part of blob: %v", err)
+		}
+		resp.Body.Close()
+		close(gate)
+
+		cached := func() bool { return blobCached(p, "team/app", layers[0]) }
+		if tc.cached {
+			eventually(t, "detached blob cache fill", cached)
+			eventually(t, "detached transfer to finish", func() bool { return p.detach.active() == 0 })
+			continue
+		}
+		time.Sleep(200 * time.Millisecond)
+		if cached() {
+			t.Error("blob cached after the client disconnected with CACHE_DETACH_MAX=0")
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// =============================================================================
+// 运行时诊断 - SIGUSR1 或 GET /admin/diagnostics 将正在处理的请求（含当前上游与已耗时）、
+// 缓存统计、上游连接池状态与全部 goroutine 栈输出到日志，用于事后分析卡顿、泄漏等问题
+// =============================================================================
+
+// trackedRequest 正在处理的客户端请求
+type trackedRequest struct {
+	id       string
+	method   string
+	path     string
+	client   string
+	start    time.Time
+	upstream atomic.Pointer[string] // 最近一次上游请求（host + path）
+}
+
+// requestTracker 正在处理的请求
+type requestTracker struct {
+	mu       sync.Mutex
+	next     uint64
+	requests map[uint64]*trackedRequest
+}
+
+type trackedRequestKey struct{}
+
+func newRequestTracker() *requestTracker {
+	return &requestTracker{requests: make(map[uint64]*trackedRequest)}
+}
+
+// middleware 记录请求的开始与结束，并把记录放入 context 供上游 Transport 标注当前上游
+func (t *requestTracker) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tr := &trackedRequest{
+			id:     middleware.GetReqID(r.Context()),
+			method: r.Method,
+			path:   r.URL.Path,
+			client: r.RemoteAddr,
+			start:  time.Now(),
+		}
+		t.mu.Lock()
+		t.next++
+		key := t.next
+		t.requests[key] = tr
+		t.mu.Unlock()
+		defer func() {
+			t.mu.Lock()
+			delete(t.requests, key)
+			t.mu.Unlock()
+		}()
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), trackedRequestKey{}, tr)))
+	})
+}
+
+// markUpstream 记录请求当前访问的上游
+func markUpstream(req *http.Request) {
+	if tr, ok := req.Context().Value(trackedRequestKey{}).(*trackedRequest); ok {
+		upstream := req.URL.Host + req.URL.Path
+		tr.upstream.Store(&upstream)
+	}
+}
+
+// snapshot 按已耗时从长到短返回正在处理的请求
+func (t *requestTracker) snapshot() []*trackedRequest {
+	t.mu.Lock()
+	requests := make([]*trackedRequest, 0, len(t.requests))
+	for _, tr := range t.requests {
+		requests = append(requests, tr)
+	}
+	t.mu.Unlock()
+	sort.Slice(requests, func(i, j int) bool { return requests[i].start.Before(requests[j].start) })
+	return requests
+}
+
+// connTracker 按上游统计拨号器建立的连接
+type connTracker struct {
+	mu     sync.Mutex
+	open   map[string]int64 // 上游 addr -> 当前打开的连接
+	dialed map[string]int64 // 上游 addr -> 累计建立的连接
+}
+
+func newConnTracker() *connTracker {
+	return &connTracker{open: make(map[string]int64), dialed: make(map[string]int64)}
+}
+
+// track 记录新连接，连接关闭时计数减一
+func (c *connTracker) track(addr string, conn net.Conn) net.Conn {
+	c.mu.Lock()
+	c.open[addr]++
+	c.dialed[addr]++
+	c.mu.Unlock()
+	return &trackedConn{Conn: conn, release: func() {
+		c.mu.Lock()
+		c.open[addr]--
+		c.mu.Unlock()
+	}}
+}
+
+// trackedConn 关闭时更新连接计数
+type trackedConn struct {
+	net.Conn
+	once    sync.Once
+	release func()
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(c.release)
+	return c.Conn.Close()
+}
+
+// DumpDiagnostics 将诊断信息写入日志
+func (p *ProxyServer) DumpDiagnostics() {
+	var buf bytes.Buffer
+	p.writeDiagnostics(&buf)
+	log.Printf("Runtime diagnostics dump:\n%s", buf.String())
+}
+
+// writeDiagnostics 输出诊断信息：构建信息、正在处理的请求、缓存统计、上游连接与 goroutine 栈
+func (p *ProxyServer) writeDiagnostics(w io.Writer) {
+	now := time.Now()
+	fmt.Fprintf(w, "=== %s, uptime %s, %d goroutines ===\n", GetBuildInfo(), now.Sub(startTime).Round(time.Second), runtime.NumGoroutine())
+
+	requests := p.requests.snapshot()
+	fmt.Fprintf(w, "\n=== In-flight requests (%d) ===\n", len(requests))
+	for _, tr := range requests {
+		upstream := "-"
+		if u := tr.upstream.Load(); u != nil {
+			upstream = *u
+		}
+		fmt.Fprintf(w, "%s %s %s client=%s elapsed=%s upstream=%s\n", tr.id, tr.method, tr.path, tr.client,
+			now.Sub(tr.start).Round(time.Millisecond), upstream)
+	}
+
+	fmt.Fprintln(w, "\n=== Cache ===")
+	if p.cacheManager != nil {
+		stats, _ := json.MarshalIndent(p.cacheManager.Stats(), "", "  ")
+		fmt.Fprintf(w, "%s\n", stats)
+	} else {
+		fmt.Fprintln(w, "disabled")
+	}
+
+	conns := p.transport.dialer.conns
+	conns.mu.Lock()
+	addrs := make([]string, 0, len(conns.dialed))
+	for addr := range conns.dialed {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	fmt.Fprintln(w, "\n=== Upstream connections ===")
+	for _, addr := range addrs {
+		fmt.Fprintf(w, "%s open=%d dialed=%d\n", addr, conns.open[addr], conns.dialed[addr])
+	}
+	conns.mu.Unlock()
+	if limits := p.limitStats(); limits != nil {
+		stats, _ := json.Marshal(limits)
+		fmt.Fprintf(w, "limits: %s\n", stats)
+	}
+
+	fmt.Fprintln(w, "\n=== Goroutines ===")
+	pprof.Lookup("goroutine").WriteTo(w, 2)
+}
+
+// registerDiagnosticsAdminRoutes 诊断管理接口
+//
+//	GET /admin/diagnostics   返回诊断信息（同时写入日志）
+func (p *ProxyServer) registerDiagnosticsAdminRoutes(r chi.Router) {
+	r.Get("/diagnostics", func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		p.writeDiagnostics(&buf)
+		log.Printf("Runtime diagnostics dump (admin request):\n%s", buf.String())
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(buf.Bytes())
+	})
+}
@@ -0,0 +1,14 @@
+//go:build !windows
+
+package proxy
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// NotifyDiagnostics 在收到 SIGUSR1 时通知 c，用于触发运行时诊断输出
+func NotifyDiagnostics(c chan<- os.Signal) {
+	signal.Notify(c, syscall.SIGUSR1)
+}
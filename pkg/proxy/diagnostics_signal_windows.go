@@ -0,0 +1,6 @@
+package proxy
+
+import "os"
+
+// NotifyDiagnostics Windows 没有 SIGUSR1，只能通过 GET /admin/diagnostics 触发
+func NotifyDiagnostics(c chan<- os.Signal) {}
@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestDiagnosticsDump 覆盖 /admin/diagnostics：正在处理的请求带当前上游与已耗时，并包含连接统计与 goroutine 栈
+func TestDiagnosticsDump(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	upstream.addImage("team/app", "v1", []byte("layer"))
+	p, client := newTestProxy(t, upstream, map[string]string{"ADMIN_TOKEN": "admin-token"})
+	client.login("team/app")
+
+	// 上游响应慢的 manifest 请求在诊断输出中可见
+	upstream.configure(func(f *fakeRegistry) { f.manifestDelay = time.Second })
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		client.do(http.MethodGet, "/v2/team/app/manifests/v1", nil)
+	}()
+	defer func() { <-done }()
+
+	upstreamHost := strings.TrimPrefix(upstream.server.URL, "http://")
+	var dump string
+	eventually(t, "in-flight request in diagnostics", func() bool {
+		var buf bytes.Buffer
+		p.writeDiagnostics(&buf)
+		dump = buf.String()
+		return strings.Contains(dump, "GET /v2/team/app/manifests/v1") && strings.Contains(dump, "upstream="+upstreamHost+"/v2/team/app/manifests/v1")
+	})
+	for _, want := range []string{"In-flight requests", upstreamHost + " open=", "goroutine "} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("diagnostics missing %q", want)
+		}
+	}
+
+	client.token = "admin-token"
+	resp, body := client.do(http.MethodGet, "/admin/diagnostics", nil)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), "=== Goroutines ===") {
+		t.Errorf("/admin/diagnostics: status %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,108 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// =============================================================================
+// 上游连接参数 - 连接超时、TLS 握手超时、TCP keep-alive 与每个上游的最大连接数，
+// 可按上游域名覆盖（同时匹配子域名）；有覆盖的上游使用单独的 Transport 与连接池
+// =============================================================================
+
+// DialSettings 上游连接参数
+type DialSettings struct {
+	DialTimeout         time.Duration // 建立 TCP 连接的超时（0 表示不限制）
+	TLSHandshakeTimeout time.Duration // TLS 握手超时（0 表示不限制）
+	KeepAlive           time.Duration // TCP keep-alive 探测间隔（负值表示关闭）
+	MaxConnsPerHost     int           // 每个上游的最大连接数（0 表示不限制）
+}
+
+// parseDialOverrides 解析 UPSTREAM_DIAL_OVERRIDES：
+// host=dial:5s;tls:5s;keepalive:15s;maxconns:100（逗号分隔，未设置的参数沿用默认值）
+func parseDialOverrides(entries []string, base DialSettings) (map[string]DialSettings, error) {
+	overrides := make(map[string]DialSettings)
+	for _, entry := range entries {
+		host, spec, ok := strings.Cut(entry, "=")
+		host = strings.ToLower(strings.TrimSpace(host))
+		if !ok || host == "" || strings.TrimSpace(spec) == "" {
+			return nil, fmt.Errorf("%q must be host=key:value;...", entry)
+		}
+		settings := base
+		for _, item := range strings.Split(spec, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(item), ":")
+			if !ok {
+				return nil, fmt.Errorf("%s: %q must be key:value", host, item)
+			}
+			value = strings.TrimSpace(value)
+			var err error
+			switch strings.TrimSpace(key) {
+			case "dial":
+				settings.DialTimeout, err = parseDurationValue(value)
+			case "tls":
+				settings.TLSHandshakeTimeout, err = parseDurationValue(value)
+			case "keepalive":
+				settings.KeepAlive, err = parseDurationValue(value)
+			case "maxconns":
+				settings.MaxConnsPerHost, err = strconv.Atoi(value)
+			default:
+				err = fmt.Errorf("unknown setting %q (dial, tls, keepalive or maxconns)", key)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", host, err)
+			}
+		}
+		overrides[host] = settings
+	}
+	return overrides, nil
+}
+
+// upstreamTransport 按上游域名选择 Transport：有连接参数覆盖的上游使用单独的 Transport
+type upstreamTransport struct {
+	base      *http.Transport
+	overrides map[string]*http.Transport               // 域名 -> Transport，同时匹配其子域名
+	dialer    *upstreamDialer                          // 上游拨号器（深度健康检查按其解析器检查 DNS）
+	sessions  *sessionCache                            // 共用的 TLS 会话缓存（未启用时为 nil）
+	paused    atomic.Bool                              // 维护模式：拒绝所有上游请求
+	buckets   atomic.Pointer[map[string]*BucketOrigin] // 对象存储源站 host -> 源站，随热重载替换
+}
+
+// newUpstreamTransport 以 base 为模板为每个覆盖的上游创建 Transport
+func newUpstreamTransport(base *http.Transport, dialer *upstreamDialer, overrides map[string]DialSettings) *upstreamTransport {
+	t := &upstreamTransport{base: base, overrides: make(map[string]*http.Transport), dialer: dialer}
+	for host, settings := range overrides {
+		transport := base.Clone()
+		transport.DialContext = dialer.withSettings(settings).DialContext
+		transport.TLSHandshakeTimeout = settings.TLSHandshakeTimeout
+		transport.MaxConnsPerHost = settings.MaxConnsPerHost
+		t.overrides[host] = transport
+		log.Printf("上游 %s 连接参数: dial %v, TLS handshake %v, keep-alive %v, max conns %d",
+			host, settings.DialTimeout, settings.TLSHandshakeTimeout, settings.KeepAlive, settings.MaxConnsPerHost)
+	}
+	return t
+}
+
+// RoundTrip 实现 http.RoundTripper
+func (t *upstreamTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.paused.Load() {
+		return nil, errMaintenance
+	}
+	markUpstream(req)
+	if origin, ok := t.bucketOrigin(req.URL.Host); ok {
+		return origin.roundTrip(req, t.send)
+	}
+	return t.send(req)
+}
+
+// send 按上游域名选择 Transport 发送请求
+func (t *upstreamTransport) send(req *http.Request) (*http.Response, error) {
+	if transport, ok := lookupHostMap(t.overrides, req.URL.Hostname()); ok {
+		return transport.RoundTrip(req)
+	}
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,30 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUpstreamDialOverrides(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	upstream.addImage("team/app", "v1", []byte("layer"))
+	p, client := newTestProxy(t, upstream, map[string]string{
+		"UPSTREAM_MAX_CONNS_PER_HOST": "8",
+		"UPSTREAM_DIAL_OVERRIDES":     "127.0.0.1=dial:2s;maxconns:1, registry.example.com=tls:3s",
+	})
+
+	if p.transport.base.MaxConnsPerHost != 8 {
+		t.Errorf("default MaxConnsPerHost = %d", p.transport.base.MaxConnsPerHost)
+	}
+	override := p.transport.overrides["127.0.0.1"]
+	if override == nil || override.MaxConnsPerHost != 1 || override.TLSHandshakeTimeout != 10*time.Second {
+		t.Fatalf("override transport = %+v", override)
+	}
+	// 覆盖的上游使用单连接的 Transport 也能正常拉取
+	client.login("team/app")
+	client.pull("team/app", "v1")
+
+	if _, err := parseDialOverrides([]string{"registry.example.com=retries:3"}, DialSettings{}); err == nil {
+		t.Error("unknown dial setting accepted")
+	}
+}
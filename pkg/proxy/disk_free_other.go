@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package proxy
+
+// diskFree 当前平台不支持查询剩余空间
+func diskFree(path string) (int64, error) {
+	return 0, errDiskFreeUnsupported
+}
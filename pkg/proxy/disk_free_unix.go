@@ -0,0 +1,14 @@
+//go:build linux || darwin
+
+package proxy
+
+import "syscall"
+
+// diskFree 返回 path 所在文件系统对非特权用户可用的剩余空间
+func diskFree(path string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return int64(uint64(st.Bavail) * uint64(st.Bsize)), nil
+}
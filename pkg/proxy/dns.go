@@ -0,0 +1,212 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// upstreamDialer 上游 Transport 使用的拨号器，按目标域名选择 DNS 解析器与出口地址
+// 只作用于代理自身的上游连接，不修改全局 net.DefaultResolver
+type upstreamDialer struct {
+	resolver  *net.Resolver            // 默认解析器（nil 表示系统 DNS）
+	overrides map[string]*net.Resolver // 域名 -> 专用解析器，同时匹配其子域名
+	localAddr *net.TCPAddr             // 默认出口地址（nil 表示由系统选择）
+	egress    map[string]*net.TCPAddr  // 域名 -> 专用出口地址，同时匹配其子域名
+
+	fallbackIPs map[string][]net.IPAddr // 域名 -> DNS 异常时改连的备用 IP（只匹配域名本身）
+	fallbacks   *dnsFallbackStats       // 改用备用 IP 的次数
+	poison      *poisonGuard            // DNS 污染检测（未启用时为 nil）
+
+	ipFamily      string        // 地址族策略（UPSTREAM_IP_FAMILY）
+	fallbackDelay time.Duration // 另一地址族的并发尝试延迟（UPSTREAM_FALLBACK_DELAY）
+
+	timeout   time.Duration // 建立连接的超时（UPSTREAM_DIAL_TIMEOUT）
+	keepAlive time.Duration // TCP keep-alive 间隔（UPSTREAM_KEEPALIVE）
+
+	conns *connTracker // 各上游的连接数（运行时诊断）
+}
+
+// newUpstreamDialer 根据 DNS_ENABLED/DNS_SERVERS/DNS_OVERRIDES 与 EGRESS_BIND/EGRESS_BIND_OVERRIDES 构建拨号器，
+// 出口地址无法解析时返回错误
+func newUpstreamDialer(config *Config) (*upstreamDialer, error) {
+	timeout, err := time.ParseDuration(config.DNSTimeout)
+	if err != nil {
+		log.Printf("DNS超时配置解析失败: %v, 使用默认值 5s", err)
+		timeout = 5 * time.Second
+	}
+
+	d := &upstreamDialer{
+		overrides:     make(map[string]*net.Resolver),
+		egress:        make(map[string]*net.TCPAddr),
+		ipFamily:      config.UpstreamIPFamily,
+		fallbackDelay: config.UpstreamFallbackDelay,
+		timeout:       config.UpstreamDial.DialTimeout,
+		keepAlive:     config.UpstreamDial.KeepAlive,
+		fallbackIPs:   config.DNSFallbackIPs,
+		fallbacks:     newDNSFallbackStats(),
+		conns:         newConnTracker(),
+	}
+	if !validIPFamily(d.ipFamily) {
+		log.Printf("Ignoring invalid UPSTREAM_IP_FAMILY %q, using auto", d.ipFamily)
+		d.ipFamily = ipFamilyAuto
+	}
+	if d.ipFamily != ipFamilyAuto {
+		log.Printf("上游连接地址族: %s (fallback delay %v)", d.ipFamily, d.fallbackDelay)
+	}
+	switch {
+	case !config.DNSEnabled:
+		log.Println("使用系统默认DNS解析器")
+	case len(config.DNSServers) == 0:
+		log.Println("DNS_ENABLED=true 但未配置 DNS_SERVERS，使用系统默认DNS")
+	default:
+		d.resolver = newResolver(config.DNSServers, timeout, config.Debug)
+		log.Printf("自定义DNS解析器已启用，服务器: %v, 超时: %v", config.DNSServers, timeout)
+	}
+
+	for host, servers := range config.DNSOverrides {
+		d.overrides[host] = newResolver(servers, timeout, config.Debug)
+		log.Printf("上游 %s 使用专用DNS服务器: %v", host, servers)
+	}
+	d.poison = newPoisonGuard(config, timeout)
+	for host, addrs := range d.fallbackIPs {
+		log.Printf("上游 %s 的DNS备用IP: %s", host, formatIPAddrs(addrs))
+	}
+
+	// 出口地址在启动时解析，网卡不存在等错误导致启动失败，避免流量从错误的出口发出
+	if config.EgressBind != "" {
+		addr, err := resolveEgressAddr(config.EgressBind)
+		if err != nil {
+			return nil, fmt.Errorf("EGRESS_BIND: %w", err)
+		}
+		d.localAddr = addr
+		log.Printf("上游连接绑定出口地址: %s (%s)", addr.IP, config.EgressBind)
+	}
+	for host, bind := range config.EgressOverrides {
+		addr, err := resolveEgressAddr(bind)
+		if err != nil {
+			return nil, fmt.Errorf("EGRESS_BIND_OVERRIDES: %s: %w", host, err)
+		}
+		d.egress[host] = addr
+		log.Printf("上游 %s 使用出口地址: %s (%s)", host, addr.IP, bind)
+	}
+	return d, nil
+}
+
+// newResolver 创建依次尝试给定 DNS 服务器的解析器
+func newResolver(servers []string, timeout time.Duration, debug bool) *net.Resolver {
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			d := net.Dialer{
+				Timeout: timeout,
+			}
+			// 尝试配置的所有DNS服务器
+			var lastErr error
+			for _, server := range servers {
+				conn, err := d.DialContext(ctx, network, server)
+				if err == nil {
+					if debug {
+						log.Printf("[DEBUG] 使用DNS服务器: %s", server)
+					}
+					return conn, nil
+				}
+				lastErr = err
+				if debug {
+					log.Printf("[DEBUG] DNS服务器 %s 连接失败: %v, 尝试下一个", server, err)
+				}
+			}
+			if lastErr != nil {
+				return nil, lastErr
+			}
+			return nil, &net.DNSError{
+				Err:  "all DNS servers failed",
+				Name: address,
+			}
+		},
+	}
+}
+
+// resolverFor 返回目标域名使用的解析器：精确匹配优先，其次最长的父域名匹配
+func (d *upstreamDialer) resolverFor(host string) *net.Resolver {
+	if r, ok := lookupHostMap(d.overrides, host); ok {
+		return r
+	}
+	return d.resolver
+}
+
+// lookupHostMap 按域名查找：精确匹配优先，其次最长的父域名匹配
+func lookupHostMap[V any](m map[string]V, host string) (V, bool) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for name := host; name != ""; {
+		if v, ok := m[name]; ok {
+			return v, true
+		}
+		_, parent, found := strings.Cut(name, ".")
+		if !found {
+			break
+		}
+		name = parent
+	}
+	var zero V
+	return zero, false
+}
+
+// withSettings 返回使用另一组连接超时与 keep-alive 的拨号器（解析器与出口地址共用）
+func (d *upstreamDialer) withSettings(settings DialSettings) *upstreamDialer {
+	clone := *d
+	clone.timeout = settings.DialTimeout
+	clone.keepAlive = settings.KeepAlive
+	return &clone
+}
+
+// DialContext 供 http.Transport 使用
+func (d *upstreamDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	dialer := &net.Dialer{
+		Timeout:       d.timeout,
+		KeepAlive:     d.keepAlive,
+		Resolver:      d.resolverFor(host),
+		LocalAddr:     d.localAddrFor(host),
+		FallbackDelay: d.fallbackDelay,
+	}
+	// 启用污染检测、配置了备用 IP 或优先某一地址族时自行解析；IP 地址直接连接
+	resolve := network == "tcp" && err == nil && net.ParseIP(host) == nil
+	fallback, hasFallback := d.fallbackIPs[strings.ToLower(host)]
+	checkPoison := d.poison != nil && !poisonCheckSkipped(ctx)
+	var conn net.Conn
+	switch {
+	case resolve && (hasFallback || checkPoison):
+		conn, err = d.dialChecked(ctx, dialer, host, port, fallback)
+	case resolve && (d.ipFamily == ipFamilyPreferIPv4 || d.ipFamily == ipFamilyPreferIPv6):
+		conn, err = dialPreferred(ctx, dialer, d.ipFamily == ipFamilyPreferIPv4, d.fallbackDelay, host, port)
+	default:
+		conn, err = dialer.DialContext(ctx, familyNetwork(d.ipFamily, network), addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d.conns.track(addr, conn), nil
+}
+
+// parseDNSOverrides 解析 DNS_OVERRIDES（host=ip:port，逗号分隔；同一域名重复出现表示多个服务器）
+func parseDNSOverrides(entries []string) map[string][]string {
+	overrides := make(map[string][]string)
+	for _, entry := range entries {
+		host, server, ok := strings.Cut(entry, "=")
+		host = strings.ToLower(strings.TrimSpace(host))
+		server = strings.TrimSpace(server)
+		if !ok || host == "" || server == "" {
+			log.Printf("Ignoring invalid DNS_OVERRIDES entry %q (expected host=ip:port)", entry)
+			continue
+		}
+		overrides[host] = append(overrides[host], server)
+	}
+	return overrides
+}
@@ -0,0 +1,197 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// =============================================================================
+// 上游备用 IP - DNS 被污染的网络中，DNS_FALLBACK_IPS 为上游域名指定已知可用的 IP：
+// 解析失败、解析结果明显异常（回环、未指定、保留地址段等）或解析出的地址全部连接失败时改连这些 IP。
+// TLS 握手仍以上游域名作为 SNI 并校验证书，连到错误的主机时握手失败，不会返回伪造的内容
+// =============================================================================
+
+// 改用备用 IP 的原因
+const (
+	dnsFallbackResolveError = "resolve_error" // 解析失败
+	dnsFallbackBogusAnswer  = "bogus_answer"  // 解析结果全部为明显异常的地址
+	dnsFallbackDialError    = "dial_error"    // 解析出的地址全部连接失败
+)
+
+// bogusNetworks 公网域名不可能解析到的地址段，污染的应答常见这些地址
+var bogusNetworks = mustParseCIDRs(
+	"0.0.0.0/8", "127.0.0.0/8", "169.254.0.0/16", "224.0.0.0/4", "240.0.0.0/4",
+	"::/128", "::1/128", "100::/64", "fe80::/10", "ff00::/8",
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// bogusAnswer 地址是否为明显异常的解析结果
+func bogusAnswer(ip net.IP) bool {
+	for _, network := range bogusNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// formatIPAddrs 日志中显示的地址列表，如 "1.2.3.4, 5.6.7.8"
+func formatIPAddrs(addrs []net.IPAddr) string {
+	parts := make([]string, len(addrs))
+	for i, addr := range addrs {
+		parts[i] = addr.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// parseFallbackIPs 解析 DNS_FALLBACK_IPS（host=ip|ip，逗号分隔，只匹配该域名本身）
+func parseFallbackIPs(entries []string) map[string][]net.IPAddr {
+	fallbacks := make(map[string][]net.IPAddr)
+	for _, entry := range entries {
+		host, list, ok := strings.Cut(entry, "=")
+		host = strings.ToLower(strings.TrimSpace(host))
+		var addrs []net.IPAddr
+		for _, value := range strings.Split(list, "|") {
+			ip := net.ParseIP(strings.TrimSpace(value))
+			if ip == nil {
+				addrs = nil
+				break
+			}
+			addrs = append(addrs, net.IPAddr{IP: ip})
+		}
+		if !ok || host == "" || len(addrs) == 0 {
+			log.Printf("Ignoring invalid DNS_FALLBACK_IPS entry %q (expected host=ip|ip)", entry)
+			continue
+		}
+		fallbacks[host] = append(fallbacks[host], addrs...)
+	}
+	return fallbacks
+}
+
+// resolveChecked 解析域名并去掉异常地址（启用 DNS_POISON_CHECK 时按其规则检查并尝试备用解析器），
+// 没有可用地址时返回改用备用 IP 的原因
+func (d *upstreamDialer) resolveChecked(ctx context.Context, resolver *net.Resolver, host string) ([]net.IPAddr, string, error) {
+	if d.poison != nil && !poisonCheckSkipped(ctx) {
+		return d.poison.lookup(ctx, resolver, host)
+	}
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, dnsFallbackResolveError, err
+	}
+	valid := make([]net.IPAddr, 0, len(addrs))
+	for _, addr := range addrs {
+		if !bogusAnswer(addr.IP) {
+			valid = append(valid, addr)
+		}
+	}
+	if len(valid) == 0 {
+		return nil, dnsFallbackBogusAnswer, fmt.Errorf("%s resolved to bogus addresses %s", host, formatIPAddrs(addrs))
+	}
+	return valid, "", nil
+}
+
+// dialChecked 自行解析域名并连接；解析失败、结果异常或全部连接失败时改连备用 IP（未配置时返回错误）
+func (d *upstreamDialer) dialChecked(ctx context.Context, dialer *net.Dialer, host, port string, fallback []net.IPAddr) (net.Conn, error) {
+	resolver := dialer.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	addrs, reason, err := d.resolveChecked(ctx, resolver, host)
+	if reason == "" {
+		conn, dialErr := d.dialAddrs(ctx, dialer, host, port, addrs)
+		if dialErr == nil || ctx.Err() != nil || len(fallback) == 0 {
+			return conn, dialErr
+		}
+		reason, err = dnsFallbackDialError, dialErr
+	}
+	if len(fallback) == 0 {
+		return nil, err
+	}
+
+	d.fallbacks.record(host, reason, err)
+	conn, fallbackErr := d.dialAddrs(ctx, dialer, host, port, fallback)
+	if fallbackErr != nil {
+		return nil, fmt.Errorf("%w (fallback IPs: %v)", err, fallbackErr)
+	}
+	return conn, nil
+}
+
+// dialAddrs 按地址族策略连接给定的地址
+func (d *upstreamDialer) dialAddrs(ctx context.Context, dialer *net.Dialer, host, port string, addrs []net.IPAddr) (net.Conn, error) {
+	filtered := make([]net.IPAddr, 0, len(addrs))
+	for _, addr := range addrs {
+		v4 := addr.IP.To4() != nil
+		if (d.ipFamily == ipFamilyIPv4 && !v4) || (d.ipFamily == ipFamilyIPv6 && v4) {
+			continue
+		}
+		filtered = append(filtered, addr)
+	}
+	if len(filtered) == 0 {
+		return nil, &net.DNSError{Err: "no suitable address", Name: host}
+	}
+	preferV4 := filtered[0].IP.To4() != nil
+	switch d.ipFamily {
+	case ipFamilyPreferIPv4:
+		preferV4 = true
+	case ipFamilyPreferIPv6:
+		preferV4 = false
+	}
+	return dialAddrs(ctx, dialer, preferV4, d.fallbackDelay, host, port, filtered)
+}
+
+// dnsFallbackStats 按上游域名与原因统计改用备用 IP 的次数
+type dnsFallbackStats struct {
+	mu     sync.Mutex
+	counts map[[2]string]int64
+}
+
+func newDNSFallbackStats() *dnsFallbackStats {
+	return &dnsFallbackStats{counts: make(map[[2]string]int64)}
+}
+
+// record 计数，每个域名与原因首次出现时输出日志
+func (s *dnsFallbackStats) record(host, reason string, err error) {
+	s.mu.Lock()
+	key := [2]string{host, reason}
+	s.counts[key]++
+	first := s.counts[key] == 1
+	s.mu.Unlock()
+	if first {
+		log.Printf("Upstream %s: %v, using DNS_FALLBACK_IPS (%s)", host, err, reason)
+	}
+}
+
+func (s *dnsFallbackStats) writeMetrics(m *metricsWriter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([][2]string, 0, len(s.counts))
+	for key := range s.counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	for _, key := range keys {
+		m.counter("docker_proxy_upstream_dns_fallback_total", "Upstream connections that used DNS_FALLBACK_IPS by reason",
+			float64(s.counts[key]), "host", key[0], "reason", key[1])
+	}
+}
@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDNSFallbackIPs(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(upstream.server.URL, "http://"))
+	d := newTestDialer(t, &Config{
+		DNSTimeout:       "5s",
+		UpstreamIPFamily: ipFamilyAuto,
+		DNSFallbackIPs:   parseFallbackIPs([]string{"registry.invalid=127.0.0.1", "localhost=127.0.0.1", "bad=not-an-ip"}),
+	})
+	dial := func(host string) error {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+		if err == nil {
+			conn.Close()
+		}
+		return err
+	}
+
+	// 解析失败与解析到回环地址（污染应答的典型结果）时改连备用 IP
+	if err := dial("registry.invalid"); err != nil {
+		t.Errorf("unresolvable host with fallback IPs: %v", err)
+	}
+	if err := dial("localhost"); err != nil {
+		t.Errorf("bogus answer with fallback IPs: %v", err)
+	}
+	if got := d.fallbacks.counts; got[[2]string{"registry.invalid", dnsFallbackResolveError}] != 1 || got[[2]string{"localhost", dnsFallbackBogusAnswer}] != 1 {
+		t.Errorf("fallback counts = %v", got)
+	}
+	if _, ok := d.fallbackIPs["bad"]; ok {
+		t.Error("invalid fallback entry accepted")
+	}
+
+	// 没有备用 IP 的域名按原样解析
+	if err := dial("other.invalid"); err == nil {
+		t.Error("unresolvable host without fallback IPs connected")
+	}
+}
@@ -0,0 +1,265 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// =============================================================================
+// DNS 污染检测 - DNS_POISON_CHECK 启用后，上游域名的解析结果逐个检查：回环、保留与文档地址段、
+// 运营商 NAT 地址等公网域名不可能使用的地址，以及未在 DNS_PRIVATE_HOSTS / DNS_OVERRIDES 中声明的
+// 内网地址（RFC 1918、IPv6 ULA）视为污染。应答被拒绝或解析失败时依次改用 DNS_SECONDARY_SERVERS
+// 中的解析器（ip:端口 走 TCP，避开注入的 UDP 应答；https:// 地址为 DoH JSON 接口），
+// 仍无可用结果时使用 DNS_FALLBACK_IPS
+// =============================================================================
+
+// suspiciousNetworks 除 bogusNetworks 外，公网域名通常不会解析到的地址段
+var suspiciousNetworks = mustParseCIDRs(
+	"100.64.0.0/10", "192.0.0.0/24", "192.0.2.0/24", "198.18.0.0/15", "198.51.100.0/24", "203.0.113.0/24",
+	"255.255.255.255/32", "2001:db8::/32", "64:ff9b:1::/48",
+)
+
+// privateNetworks 内网地址段，只有声明为内网的域名可以解析到这些地址
+var privateNetworks = mustParseCIDRs("10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7")
+
+type skipPoisonCheckKey struct{}
+
+// withoutPoisonCheck 标记请求的目标不是镜像仓库上游（如复制目标），拨号时不做污染检查；
+// 这类目标常部署在内网，解析到内网地址是正常结果
+func withoutPoisonCheck(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipPoisonCheckKey{}, true)
+}
+
+// poisonCheckSkipped 请求是否经 withoutPoisonCheck 标记
+func poisonCheckSkipped(ctx context.Context) bool {
+	skip, _ := ctx.Value(skipPoisonCheckKey{}).(bool)
+	return skip
+}
+
+// secondaryResolver 应答被拒绝后依次尝试的解析器
+type secondaryResolver interface {
+	name() string
+	lookup(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// poisonGuard 上游域名解析结果的检查与备用解析器
+type poisonGuard struct {
+	private   map[string]bool // 允许解析到内网地址的域名，同时匹配其子域名
+	secondary []secondaryResolver
+
+	mu     sync.Mutex
+	counts map[[2]string]int64 // [域名, 解析器] -> 被拒绝的应答数
+}
+
+// newPoisonGuard DNS_POISON_CHECK 未启用时返回 nil
+func newPoisonGuard(config *Config, timeout time.Duration) *poisonGuard {
+	if !config.DNSPoisonCheck {
+		return nil
+	}
+	g := &poisonGuard{private: make(map[string]bool), counts: make(map[[2]string]int64)}
+	for _, host := range config.DNSPrivateHosts {
+		g.private[strings.ToLower(host)] = true
+	}
+	// 通过专用 DNS 解析的域名通常是内网仓库
+	for host := range config.DNSOverrides {
+		g.private[host] = true
+	}
+	for _, server := range config.DNSSecondaryServers {
+		g.secondary = append(g.secondary, newSecondaryResolver(server, timeout))
+	}
+	log.Printf("DNS poisoning checks enabled: %d secondary resolvers, %d hosts allowed to resolve to private addresses",
+		len(g.secondary), len(g.private))
+	return g
+}
+
+// newSecondaryResolver https:// 地址为 DoH JSON 接口，其余为走 TCP 的 DNS 服务器
+func newSecondaryResolver(server string, timeout time.Duration) secondaryResolver {
+	if strings.HasPrefix(server, "https://") {
+		return &dohResolver{endpoint: server, client: &http.Client{Timeout: timeout}}
+	}
+	return &tcpResolver{server: server, resolver: &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			d := net.Dialer{Timeout: timeout}
+			return d.DialContext(ctx, "tcp", server)
+		},
+	}}
+}
+
+// suspicious 地址是否为 host 不应解析到的地址
+func (g *poisonGuard) suspicious(host string, ip net.IP) bool {
+	if bogusAnswer(ip) {
+		return true
+	}
+	for _, network := range suspiciousNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	if _, ok := lookupHostMap(g.private, host); ok {
+		return false
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clean 返回通过检查的地址；有地址被拒绝时计数并输出日志
+func (g *poisonGuard) clean(host, resolver string, addrs []net.IPAddr) []net.IPAddr {
+	valid := make([]net.IPAddr, 0, len(addrs))
+	for _, addr := range addrs {
+		if !g.suspicious(host, addr.IP) {
+			valid = append(valid, addr)
+		}
+	}
+	if len(valid) < len(addrs) {
+		g.mu.Lock()
+		g.counts[[2]string{host, resolver}]++
+		g.mu.Unlock()
+		log.Printf("Suspected DNS poisoning: %s resolved by %s to %s", host, resolver, formatIPAddrs(addrs))
+	}
+	return valid
+}
+
+// lookup 解析上游域名：主解析器的结果全部被拒绝或解析失败时依次尝试备用解析器；
+// 都没有可用地址时返回改用备用 IP 的原因（有应答被拒绝时为 bogus_answer）
+func (g *poisonGuard) lookup(ctx context.Context, resolver *net.Resolver, host string) ([]net.IPAddr, string, error) {
+	reason := dnsFallbackResolveError
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	if err == nil {
+		if valid := g.clean(host, "primary", addrs); len(valid) > 0 {
+			return valid, "", nil
+		}
+		reason, err = dnsFallbackBogusAnswer, fmt.Errorf("%s resolved to suspicious addresses %s", host, formatIPAddrs(addrs))
+	}
+	for _, secondary := range g.secondary {
+		if ctx.Err() != nil {
+			break
+		}
+		addrs, secondaryErr := secondary.lookup(ctx, host)
+		if secondaryErr != nil {
+			log.Printf("Secondary resolver %s failed for %s: %v", secondary.name(), host, secondaryErr)
+			continue
+		}
+		if valid := g.clean(host, secondary.name(), addrs); len(valid) > 0 {
+			return valid, "", nil
+		}
+		reason = dnsFallbackBogusAnswer
+	}
+	return nil, reason, err
+}
+
+func (g *poisonGuard) writeMetrics(m *metricsWriter) {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	keys := make([][2]string, 0, len(g.counts))
+	for key := range g.counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	for _, key := range keys {
+		m.counter("docker_proxy_upstream_dns_poisoned_total", "DNS answers for upstream hosts rejected as suspected poisoning",
+			float64(g.counts[key]), "host", key[0], "resolver", key[1])
+	}
+}
+
+// tcpResolver 通过 TCP 查询的 DNS 服务器
+type tcpResolver struct {
+	server   string
+	resolver *net.Resolver
+}
+
+func (r *tcpResolver) name() string { return r.server }
+
+func (r *tcpResolver) lookup(ctx context.Context, host string) ([]net.IPAddr, error) {
+	return r.resolver.LookupIPAddr(ctx, host)
+}
+
+// dohResolver DoH JSON 接口（application/dns-json，Cloudflare、Google、AliDNS 等均支持），
+// 地址建议使用 IP（如 https://1.1.1.1/dns-query），避免解析 DoH 服务器本身时再次被污染
+type dohResolver struct {
+	endpoint string
+	client   *http.Client
+}
+
+func (r *dohResolver) name() string { return r.endpoint }
+
+// dohResponse DoH JSON 应答中用到的字段
+type dohResponse struct {
+	Status int `json:"Status"`
+	Answer []struct {
+		Type int    `json:"type"`
+		Data string `json:"data"`
+	} `json:"Answer"`
+}
+
+func (r *dohResolver) lookup(ctx context.Context, host string) ([]net.IPAddr, error) {
+	var addrs []net.IPAddr
+	var firstErr error
+	for _, qtype := range []string{"A", "AAAA"} {
+		found, err := r.query(ctx, host, qtype)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		addrs = append(addrs, found...)
+	}
+	if len(addrs) == 0 {
+		if firstErr == nil {
+			firstErr = &net.DNSError{Err: "no addresses", Name: host, Server: r.endpoint}
+		}
+		return nil, firstErr
+	}
+	return addrs, nil
+}
+
+func (r *dohResolver) query(ctx context.Context, host, qtype string) ([]net.IPAddr, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		r.endpoint+"?name="+url.QueryEscape(host)+"&type="+qtype, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/dns-json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH %s: status %d", qtype, resp.StatusCode)
+	}
+	var answer dohResponse
+	if err := json.NewDecoder(resp.Body).Decode(&answer); err != nil {
+		return nil, fmt.Errorf("DoH %s: %w", qtype, err)
+	}
+	if answer.Status != 0 {
+		return nil, &net.DNSError{Err: fmt.Sprintf("DoH rcode %d", answer.Status), Name: host, Server: r.endpoint}
+	}
+	var addrs []net.IPAddr
+	for _, record := range answer.Answer {
+		// 只取 A（1）与 AAAA（28）记录，跳过 CNAME 链
+		if ip := net.ParseIP(record.Data); ip != nil && (record.Type == 1 || record.Type == 28) {
+			addrs = append(addrs, net.IPAddr{IP: ip})
+		}
+	}
+	return addrs, nil
+}
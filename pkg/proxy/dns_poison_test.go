@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDNSPoisonCheck(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(upstream.server.URL, "http://"))
+	var answer atomic.Value
+	answer.Store("93.184.216.34")
+	doh := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != "application/dns-json" {
+			http.Error(w, "bad accept", http.StatusBadRequest)
+			return
+		}
+		resp := map[string]interface{}{"Status": 0}
+		if r.URL.Query().Get("type") == "A" {
+			resp["Answer"] = []map[string]interface{}{{"type": 5, "data": "cdn.example."}, {"type": 1, "data": answer.Load()}}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(doh.Close)
+
+	d := newTestDialer(t, &Config{
+		DNSTimeout:       "5s",
+		UpstreamIPFamily: ipFamilyAuto,
+		DNSPoisonCheck:   true,
+		DNSPrivateHosts:  []string{"corp.internal"},
+		DNSFallbackIPs:   parseFallbackIPs([]string{"localhost=127.0.0.1"}),
+	})
+	d.poison.secondary = []secondaryResolver{&dohResolver{endpoint: doh.URL, client: doh.Client()}}
+
+	for _, tc := range []struct {
+		host, ip   string
+		suspicious bool
+	}{
+		{"registry-1.docker.io", "54.236.113.205", false},
+		{"registry-1.docker.io", "198.18.0.7", true},
+		{"registry-1.docker.io", "10.1.2.3", true},
+		{"registry.corp.internal", "10.1.2.3", false},
+		{"registry.corp.internal", "127.0.0.1", true},
+	} {
+		if got := d.poison.suspicious(tc.host, net.ParseIP(tc.ip)); got != tc.suspicious {
+			t.Errorf("suspicious(%s, %s) = %v", tc.host, tc.ip, got)
+		}
+	}
+
+	// 主解析器的应答（回环地址）被拒绝后使用备用解析器的结果
+	addrs, _, err := d.poison.lookup(context.Background(), net.DefaultResolver, "localhost")
+	if err != nil || formatIPAddrs(addrs) != "93.184.216.34" {
+		t.Fatalf("lookup = %v, %v", addrs, err)
+	}
+
+	// 备用解析器同样返回污染的地址时改连备用 IP
+	answer.Store("198.18.0.7")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort("localhost", port))
+	if err != nil {
+		t.Fatalf("dial with poisoned answers: %v", err)
+	}
+	conn.Close()
+	if got := d.fallbacks.counts[[2]string{"localhost", dnsFallbackBogusAnswer}]; got != 1 {
+		t.Errorf("fallback counts = %v", d.fallbacks.counts)
+	}
+	if got := d.poison.counts; got[[2]string{"localhost", "primary"}] != 2 || got[[2]string{"localhost", doh.URL}] != 1 {
+		t.Errorf("poisoned counts = %v", got)
+	}
+
+	// 复制目标等非上游连接不做检查，内网或回环地址照常连接
+	plain := newTestDialer(t, &Config{DNSTimeout: "5s", UpstreamIPFamily: ipFamilyAuto, DNSPoisonCheck: true})
+	if conn, err := plain.DialContext(ctx, "tcp", net.JoinHostPort("localhost", port)); err == nil {
+		conn.Close()
+		t.Error("dialed a loopback answer with poisoning checks enabled")
+	}
+	conn, err = plain.DialContext(withoutPoisonCheck(ctx), "tcp", net.JoinHostPort("localhost", port))
+	if err != nil {
+		t.Fatalf("dial without poisoning checks: %v", err)
+	}
+	conn.Close()
+}
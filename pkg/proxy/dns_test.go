@@ -0,0 +1,168 @@
+package proxy
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubDNS 只应答 A 记录的 UDP DNS 服务器，所有名称都解析到 answer，并记录收到的查询
+type stubDNS struct {
+	addr    string
+	answer  net.IP
+	mu      sync.Mutex
+	queries []string
+}
+
+func newStubDNS(t *testing.T, answer string) *stubDNS {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	s := &stubDNS{addr: conn.LocalAddr().String(), answer: net.ParseIP(answer).To4()}
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, peer, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if resp := s.reply(buf[:n]); resp != nil {
+				conn.WriteTo(resp, peer)
+			}
+		}
+	}()
+	return s
+}
+
+// reply 构造应答：复制查询头与问题段，A 查询附带一条指向问题名称的记录
+func (s *stubDNS) reply(query []byte) []byte {
+	if len(query) < 12 {
+		return nil
+	}
+	var labels []string
+	end := 12
+	for end < len(query) && query[end] != 0 {
+		size := int(query[end])
+		if end+1+size > len(query) {
+			return nil
+		}
+		labels = append(labels, string(query[end+1:end+1+size]))
+		end += 1 + size
+	}
+	end += 5 // 结束的 0 字节、类型与类别
+	if end > len(query) {
+		return nil
+	}
+	qtype := binary.BigEndian.Uint16(query[end-4:])
+	s.mu.Lock()
+	s.queries = append(s.queries, strings.Join(labels, "."))
+	s.mu.Unlock()
+
+	resp := append([]byte{}, query[:end]...)
+	binary.BigEndian.PutUint16(resp[2:], 0x8180) // 应答、期望递归、支持递归、NOERROR
+	binary.BigEndian.PutUint16(resp[6:], 0)
+	binary.BigEndian.PutUint16(resp[8:], 0)
+	binary.BigEndian.PutUint16(resp[10:], 0)
+	if qtype == 1 {
+		binary.BigEndian.PutUint16(resp[6:], 1)
+		resp = append(resp, 0xc0, 12, 0, 1, 0, 1, 0, 0, 0, 60, 0, 4)
+		resp = append(resp, s.answer...)
+	}
+	return resp
+}
+
+// queried 返回收到的对 name 的查询次数
+func (s *stubDNS) queried(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, q := range s.queries {
+		if q == name {
+			n++
+		}
+	}
+	return n
+}
+
+// newTestDialer 创建上游拨号器，配置无效时测试失败
+func newTestDialer(t *testing.T, config *Config) *upstreamDialer {
+	t.Helper()
+	d, err := newUpstreamDialer(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestUpstreamDialerUsesConfiguredResolver(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(upstream.server.URL, "http://"))
+	primary, override := newStubDNS(t, "127.0.0.1"), newStubDNS(t, "127.0.0.1")
+
+	d := newTestDialer(t, &Config{
+		DNSEnabled:       true,
+		DNSServers:       []string{primary.addr},
+		DNSOverrides:     map[string][]string{"mirror.test": {override.addr}},
+		DNSTimeout:       "5s",
+		UpstreamIPFamily: ipFamilyAuto,
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	dial := func(host string) {
+		t.Helper()
+		conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+		if err != nil {
+			t.Fatalf("dial %s: %v", host, err)
+		}
+		conn.Close()
+	}
+
+	// 默认解析器与按域名（含子域名）覆盖的解析器
+	dial("registry.stub.test")
+	if primary.queried("registry.stub.test") == 0 || override.queried("registry.stub.test") != 0 {
+		t.Errorf("registry.stub.test: primary %d, override %d queries", primary.queried("registry.stub.test"), override.queried("registry.stub.test"))
+	}
+	dial("eu.mirror.test")
+	if override.queried("eu.mirror.test") == 0 || primary.queried("eu.mirror.test") != 0 {
+		t.Errorf("eu.mirror.test: primary %d, override %d queries", primary.queried("eu.mirror.test"), override.queried("eu.mirror.test"))
+	}
+
+	// 只作用于上游连接：全局解析器不使用配置的 DNS 服务器
+	before := primary.queried("registry.stub.test")
+	if addrs, err := net.DefaultResolver.LookupHost(ctx, "registry.stub.test"); err == nil {
+		t.Errorf("net.DefaultResolver resolved registry.stub.test to %v", addrs)
+	}
+	if primary.queried("registry.stub.test") != before {
+		t.Error("net.DefaultResolver queried the configured DNS server")
+	}
+}
+
+func TestProxyTransportUsesConfiguredResolver(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	upstream.addImage("team/app", "v1", []byte("layer"))
+	stub := newStubDNS(t, "127.0.0.1")
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(upstream.server.URL, "http://"))
+
+	t.Setenv("CACHE_DIR", t.TempDir())
+	t.Setenv("CUSTOM_DOMAIN", "example.test")
+	t.Setenv("DNS_ENABLED", "true")
+	t.Setenv("DNS_SERVERS", stub.addr)
+	config := loadTestConfig(t)
+	config.Routes = map[string]string{testRegistryHost: (&url.URL{Scheme: "http", Host: net.JoinHostPort("registry.stub.test", port)}).String()}
+	client := serveTestProxy(t, newConfiguredProxy(t, config))
+
+	// 上游域名只能由配置的 DNS 服务器解析，拉取成功说明 Transport 使用了它
+	client.login("team/app")
+	client.pull("team/app", "v1")
+	if stub.queried("registry.stub.test") == 0 {
+		t.Error("upstream host was not resolved by the configured DNS server")
+	}
+}
@@ -0,0 +1,210 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+// =============================================================================
+// 关闭排空 - 收到 SIGTERM 后停止接受新连接与 keep-alive 连接上的新请求，
+// 在 SHUTDOWN_TIMEOUT 内等待进行中的 blob 传输完成并定期输出进度，超时后强制关闭连接
+// =============================================================================
+
+// drainProgressInterval 排空期间输出进度的间隔
+const drainProgressInterval = 5 * time.Second
+
+// blobStream 进行中的 blob 传输
+type blobStream struct {
+	path    string
+	client  string
+	start   time.Time
+	size    atomic.Int64 // 响应的 Content-Length（未知时为 -1）
+	written atomic.Int64
+}
+
+// blobStreamTracker 进行中的 blob 传输
+type blobStreamTracker struct {
+	mu      sync.Mutex
+	next    uint64
+	streams map[uint64]*blobStream
+}
+
+func newBlobStreamTracker() *blobStreamTracker {
+	return &blobStreamTracker{streams: make(map[uint64]*blobStream)}
+}
+
+// middleware 记录 blob GET 的传输进度
+func (t *blobStreamTracker) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if pathType, _, _ := cache.ParsePath(r.URL.Path); pathType != "blob" || r.Method != http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+		s := &blobStream{path: r.URL.Path, client: clientIdentityOf(r).String(), start: time.Now()}
+		s.size.Store(-1)
+		t.mu.Lock()
+		t.next++
+		key := t.next
+		t.streams[key] = s
+		t.mu.Unlock()
+		defer func() {
+			t.mu.Lock()
+			delete(t.streams, key)
+			t.mu.Unlock()
+		}()
+		next.ServeHTTP(&blobStreamWriter{ResponseWriter: w, stream: s}, r)
+	})
+}
+
+// snapshot 按开始时间返回进行中的 blob 传输
+func (t *blobStreamTracker) snapshot() []*blobStream {
+	t.mu.Lock()
+	streams := make([]*blobStream, 0, len(t.streams))
+	for _, s := range t.streams {
+		streams = append(streams, s)
+	}
+	t.mu.Unlock()
+	sort.Slice(streams, func(i, j int) bool { return streams[i].start.Before(streams[j].start) })
+	return streams
+}
+
+// blobStreamWriter 统计已写出的字节数，并保留 Flush、Hijack 与 ReadFrom 能力
+type blobStreamWriter struct {
+	http.ResponseWriter
+	stream      *blobStream
+	wroteHeader bool
+}
+
+func (w *blobStreamWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if size, err := strconv.ParseInt(w.Header().Get("Content-Length"), 10, 64); err == nil {
+			w.stream.size.Store(size)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *blobStreamWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.stream.written.Add(int64(n))
+	return n, err
+}
+
+func (w *blobStreamWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// ReadFrom 保留底层连接的 sendfile 零拷贝发送，同时统计字节数
+func (w *blobStreamWriter) ReadFrom(src io.Reader) (int64, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	rf, ok := w.ResponseWriter.(io.ReaderFrom)
+	if !ok {
+		// 隐藏 ReadFrom，避免 io.Copy 回到这里
+		return io.Copy(struct{ io.Writer }{w}, src)
+	}
+	n, err := rf.ReadFrom(src)
+	w.stream.written.Add(n)
+	return n, err
+}
+
+func (w *blobStreamWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+func (w *blobStreamWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// drainSummary 进行中的 blob 传输摘要，例如 "2 blob streams (12.00 MB / 1.50 GB)"
+func drainSummary(streams []*blobStream) string {
+	var written, total int64
+	known := true
+	for _, s := range streams {
+		written += s.written.Load()
+		if size := s.size.Load(); size >= 0 {
+			total += size
+		} else {
+			known = false
+		}
+	}
+	if !known || total == 0 {
+		return fmt.Sprintf("%d blob streams (%s sent)", len(streams), cache.FormatBytes(written))
+	}
+	return fmt.Sprintf("%d blob streams (%s / %s)", len(streams), cache.FormatBytes(written), cache.FormatBytes(total))
+}
+
+// describeStreams 列出最早开始的几个传输，用于超时时的日志
+func describeStreams(streams []*blobStream, limit int) string {
+	parts := make([]string, 0, limit)
+	for i, s := range streams {
+		if i == limit {
+			parts = append(parts, fmt.Sprintf("and %d more", len(streams)-limit))
+			break
+		}
+		progress := cache.FormatBytes(s.written.Load())
+		if size := s.size.Load(); size >= 0 {
+			progress += " / " + cache.FormatBytes(size)
+		}
+		parts = append(parts, fmt.Sprintf("%s to %s (%s, %s)", s.path, s.client, progress, time.Since(s.start).Round(time.Second)))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// drainConnections 停止接受新连接并等待进行中的请求完成，期间定期输出 blob 传输进度；
+// ctx 到期后强制关闭剩余连接
+func (p *ProxyServer) drainConnections(ctx context.Context) error {
+	if streams := p.blobStreams.snapshot(); len(streams) > 0 {
+		log.Printf("Shutdown: draining %s", drainSummary(streams))
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(drainProgressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if streams := p.blobStreams.snapshot(); len(streams) > 0 {
+					log.Printf("Shutdown: still draining %s", drainSummary(streams))
+				}
+			}
+		}
+	}()
+
+	p.events.close() // /admin/events 订阅不会自行结束
+	err := p.server.Shutdown(ctx)
+	if err != nil {
+		if streams := p.blobStreams.snapshot(); len(streams) > 0 {
+			log.Printf("Shutdown: drain timeout exceeded, closing %s: %s", drainSummary(streams), describeStreams(streams, 5))
+		}
+		p.server.Close()
+	}
+	return err
+}
@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShutdownDrainsBlobStreams(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	layer := bytes.Repeat([]byte("large layer "), 20000)
+	_, layers := upstream.addImage("team/app", "v1", layer)
+	p, client := newTestProxy(t, upstream, nil)
+
+	// 与 Start 一样通过 p.server 提供服务，Shutdown 才能排空连接
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.server = &http.Server{Handler: p.Handler()}
+	go p.server.Serve(listener)
+	client.base = "http://" + listener.Addr().String()
+	client.login("team/app")
+
+	gate := make(chan struct{})
+	upstream.configure(func(f *fakeRegistry) { f.blobGate = gate })
+	req, _ := http.NewRequest("GET", client.base+"/v2/team/app/blobs/"+layers[0], nil)
+	req.Host = testRegistryHost
+	req.Header.Set("Authorization", "Bearer "+client.token)
+	resp, err := client.http.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	head := make([]byte, len(layer)/4)
+	if _, err := io.ReadFull(resp.Body, head); err != nil {
+		t.Fatalf("reading first part of blob: %v", err)
+	}
+
+	shutdown := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdown <- p.Shutdown(ctx)
+	}()
+
+	// 排空期间不再接受新连接，进行中的传输继续
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			break
+		}
+		conn.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("proxy still accepts connections while draining")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if streams := p.blobStreams.snapshot(); len(streams) != 1 || streams[0].size.Load() != int64(len(layer)) {
+		t.Errorf("in-flight blob streams = %d, want 1 with known size", len(streams))
+	}
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown returned before the blob stream finished: %v", err)
+	default:
+	}
+
+	close(gate)
+	rest, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("blob stream interrupted by shutdown: %v", err)
+	}
+	if !bytes.Equal(append(head, rest...), layer) {
+		t.Error("blob content mismatch after draining")
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("Shutdown = %v, want nil after streams drained", err)
+	}
+}
+
+func TestBlobStreamWriterKeepsReadFrom(t *testing.T) {
+	tracker := newBlobStreamTracker()
+	rec := newSendfileRecorder()
+	tracker.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(io.ReaderFrom); !ok {
+			t.Errorf("%T does not implement io.ReaderFrom", w)
+		}
+		w.Header().Set("Content-Length", "9")
+		io.Copy(w, io.LimitReader(strings.NewReader("blob data"), 9))
+
+		streams := tracker.snapshot()
+		if len(streams) != 1 {
+			t.Fatalf("streams = %d, want 1", len(streams))
+		}
+		if written, size := streams[0].written.Load(), streams[0].size.Load(); written != 9 || size != 9 {
+			t.Errorf("stream progress = %d/%d, want 9/9", written, size)
+		}
+	})).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v2/team/app/blobs/sha256:abc", nil))
+
+	if !rec.readFrom {
+		t.Error("ReadFrom was not passed through to the connection")
+	}
+	if rec.Body.String() != "blob data" {
+		t.Errorf("body = %q", rec.Body.String())
+	}
+}
@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"strings"
+)
+
+// =============================================================================
+// 出口绑定 - 多出口服务器上把上游连接绑定到指定的本地 IP 或网卡，
+// 可按上游域名覆盖（同时匹配子域名），只有部分出口能访问境外仓库时使用
+// =============================================================================
+
+// parseEgressOverrides 解析 EGRESS_BIND_OVERRIDES（host=ip 或网卡名，逗号分隔）
+func parseEgressOverrides(entries []string) map[string]string {
+	overrides := make(map[string]string)
+	for _, entry := range entries {
+		host, bind, ok := strings.Cut(entry, "=")
+		host = strings.ToLower(strings.TrimSpace(host))
+		bind = strings.TrimSpace(bind)
+		if !ok || host == "" || bind == "" {
+			log.Printf("Ignoring invalid EGRESS_BIND_OVERRIDES entry %q (expected host=ip|interface)", entry)
+			continue
+		}
+		overrides[host] = bind
+	}
+	return overrides
+}
+
+// resolveEgressAddr 将本地 IP 或网卡名解析为拨号使用的本地地址；
+// 网卡优先使用其第一个 IPv4 地址，没有 IPv4 时使用 IPv6 地址（不含链路本地地址）
+func resolveEgressAddr(bind string) (*net.TCPAddr, error) {
+	if ip := net.ParseIP(bind); ip != nil {
+		return &net.TCPAddr{IP: ip}, nil
+	}
+	iface, err := net.InterfaceByName(bind)
+	if err != nil {
+		return nil, fmt.Errorf("%q is neither an IP address nor a network interface: %w", bind, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("interface %s: %w", bind, err)
+	}
+	var v6 net.IP
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if ipNet.IP.To4() != nil {
+			return &net.TCPAddr{IP: ipNet.IP}, nil
+		}
+		if v6 == nil {
+			v6 = ipNet.IP
+		}
+	}
+	if v6 != nil {
+		return &net.TCPAddr{IP: v6}, nil
+	}
+	return nil, fmt.Errorf("interface %s has no usable IP address", bind)
+}
+
+// localAddrFor 返回连接目标域名时绑定的本地地址：精确匹配优先，其次最长的父域名匹配，
+// 都没有时使用 EGRESS_BIND（nil 表示由系统选择）
+func (d *upstreamDialer) localAddrFor(host string) net.Addr {
+	if addr, ok := lookupHostMap(d.egress, host); ok {
+		return addr
+	}
+	if d.localAddr != nil {
+		return d.localAddr
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package proxy
+
+import "testing"
+
+func TestEgressBind(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	upstream.addImage("team/app", "v1", []byte("layer"))
+
+	// 127.0.0.0/8 都在回环网卡上，可以作为不同的出口地址
+	_, client := newTestProxy(t, upstream, map[string]string{"EGRESS_BIND": "127.0.0.2"})
+	client.login("team/app")
+	client.pull("team/app", "v1")
+	if got := upstream.sourceIPs(); len(got) != 1 || got[0] != "127.0.0.2" {
+		t.Fatalf("upstream saw connections from %v, want only 127.0.0.2", got)
+	}
+
+	// 按上游域名覆盖默认出口
+	upstream = newFakeRegistry(t)
+	upstream.addImage("team/app", "v1", []byte("layer"))
+	_, client = newTestProxy(t, upstream, map[string]string{
+		"EGRESS_BIND":           "127.0.0.2",
+		"EGRESS_BIND_OVERRIDES": "127.0.0.1=127.0.0.3",
+	})
+	client.login("team/app")
+	client.pull("team/app", "v1")
+	if got := upstream.sourceIPs(); len(got) != 1 || got[0] != "127.0.0.3" {
+		t.Fatalf("upstream saw connections from %v, want only 127.0.0.3", got)
+	}
+}
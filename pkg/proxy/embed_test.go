@@ -0,0 +1,81 @@
+package proxy_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/proxy"
+)
+
+// 作为外部包嵌入到其他服务的路由中
+func TestNewHandlerEmbedded(t *testing.T) {
+	var upstreamRequests atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamRequests.Add(1)
+		w.Header().Set("Docker-Distribution-Api-Version", "registry/2.0")
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(upstream.Close)
+
+	t.Setenv("CACHE_DIR", t.TempDir())
+	config, err := proxy.LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Routes = map[string]string{"registry.test": upstream.URL}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/app/status", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	handler, err := proxy.NewHandler(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux.Handle("/", handler)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	get := func(path string) int {
+		t.Helper()
+		req, _ := http.NewRequest("GET", server.URL+path, nil)
+		req.Host = "registry.test"
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := get("/app/status"); status != http.StatusTeapot {
+		t.Errorf("host route: status %d", status)
+	}
+	if status := get("/health"); status != http.StatusOK {
+		t.Errorf("/health: status %d", status)
+	}
+	if status := get("/v2/"); status != http.StatusOK || upstreamRequests.Load() == 0 {
+		t.Errorf("/v2/: status %d, upstream requests %d", status, upstreamRequests.Load())
+	}
+}
+
+// 配置无效时返回错误，不退出宿主进程
+func TestNewHandlerInvalidConfig(t *testing.T) {
+	t.Setenv("CACHE_DIR", t.TempDir())
+	t.Setenv("TAG_POLICY", filepath.Join(t.TempDir(), "missing.json"))
+	config, err := proxy.LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if handler, err := proxy.NewHandler(config); err == nil || handler != nil {
+		t.Fatalf("NewHandler with a missing tag policy file = %v, %v", handler, err)
+	}
+
+	t.Setenv("CONFIG_FILE", filepath.Join(t.TempDir(), "missing.env"))
+	if _, err := proxy.LoadConfig(); err == nil {
+		t.Error("LoadConfig accepted a missing CONFIG_FILE")
+	}
+}
@@ -0,0 +1,383 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// =============================================================================
+// 错误上报 - 处理请求时的 panic 与路由的 5xx 突增上报到 Sentry（DSN，直接调用 envelope 接口）
+// 和/或通用 webhook（JSON），附带请求上下文；同一错误在窗口期内只上报一次
+// =============================================================================
+
+// errorReportQueueSize 待发送报告的队列长度，队列满时丢弃
+const errorReportQueueSize = 256
+
+// 报告类型
+const (
+	ErrorKindPanic = "panic"
+	ErrorKindSpike = "5xx_spike"
+)
+
+// ErrorReportRequest 触发错误的请求
+type ErrorReportRequest struct {
+	ID        string `json:"id,omitempty"`
+	Method    string `json:"method"`
+	URL       string `json:"url"`
+	Host      string `json:"host"`
+	Client    string `json:"client,omitempty"` // 客户端身份：用户名、token:名称、cert:CN 或来源 IP
+	ClientIP  string `json:"clientIp,omitempty"`
+	UserAgent string `json:"userAgent,omitempty"`
+}
+
+// ErrorReport 一条错误报告，webhook 收到的即为该结构
+type ErrorReport struct {
+	Kind        string                 `json:"kind"` // panic 或 5xx_spike
+	Level       string                 `json:"level"`
+	Message     string                 `json:"message"`
+	Stack       string                 `json:"stack,omitempty"`
+	Route       string                 `json:"route,omitempty"`
+	Request     *ErrorReportRequest    `json:"request,omitempty"`
+	Extra       map[string]interface{} `json:"extra,omitempty"`
+	Timestamp   time.Time              `json:"timestamp"`
+	ServerName  string                 `json:"serverName"`
+	Release     string                 `json:"release"`
+	Environment string                 `json:"environment"`
+}
+
+// sentryDSN 解析后的 Sentry DSN
+type sentryDSN struct {
+	publicKey string
+	envelope  string // envelope 接口地址
+	raw       string
+}
+
+// parseSentryDSN 解析 https://<key>@<host>[/<path>]/<project>
+func parseSentryDSN(dsn string) (*sentryDSN, error) {
+	u, err := url.Parse(dsn)
+	if err != nil || u.User == nil || u.User.Username() == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid Sentry DSN")
+	}
+	path := strings.Trim(u.Path, "/")
+	idx := strings.LastIndex(path, "/")
+	prefix, project := "", path
+	if idx != -1 {
+		prefix, project = "/"+path[:idx], path[idx+1:]
+	}
+	if project == "" {
+		return nil, fmt.Errorf("Sentry DSN has no project ID")
+	}
+	return &sentryDSN{
+		publicKey: u.User.Username(),
+		envelope:  fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, prefix, project),
+		raw:       dsn,
+	}, nil
+}
+
+// ErrorReporter 错误上报器，nil 表示未启用
+type ErrorReporter struct {
+	sentry      *sentryDSN
+	webhook     string
+	environment string
+	serverName  string
+	release     string
+	threshold   int           // 窗口期内同一路由的 5xx 次数达到该值时上报
+	window      time.Duration // 去重与 5xx 计数的窗口
+	client      *http.Client
+	queue       chan ErrorReport
+
+	mu       sync.Mutex
+	reported map[string]time.Time   // 指纹 -> 上次上报时间
+	errors   map[string]*errorBurst // 路由 -> 窗口期内的 5xx
+}
+
+// errorBurst 路由在当前窗口内的 5xx 计数
+type errorBurst struct {
+	start    time.Time
+	count    int
+	statuses map[int]int
+}
+
+// ErrorReportConfig panic 与 5xx 突增上报配置，SentryDSN 与 Webhook 均为空时不启用
+type ErrorReportConfig struct {
+	SentryDSN         string        // Sentry 项目 DSN
+	SentryEnvironment string        // 环境名
+	Webhook           string        // 通用 webhook，POST JSON 格式的 ErrorReport
+	Threshold         int           // 窗口期内同一路由的 5xx 次数阈值（0 不上报 5xx）
+	Window            time.Duration // 去重与 5xx 计数窗口
+}
+
+// loadErrorReportConfig 从环境变量读取错误上报配置
+//
+//	SENTRY_DSN                   Sentry 项目 DSN
+//	SENTRY_ENVIRONMENT           环境名（默认 production）
+//	ERROR_WEBHOOK_URL            通用 webhook
+//	ERROR_REPORT_5XX_THRESHOLD   5xx 次数阈值（默认 20）
+//	ERROR_REPORT_WINDOW          去重与 5xx 计数窗口（默认 5m）
+func loadErrorReportConfig() ErrorReportConfig {
+	return ErrorReportConfig{
+		SentryDSN:         getEnv("SENTRY_DSN", ""),
+		SentryEnvironment: getEnv("SENTRY_ENVIRONMENT", "production"),
+		Webhook:           getEnv("ERROR_WEBHOOK_URL", ""),
+		Threshold:         parseInt(getEnv("ERROR_REPORT_5XX_THRESHOLD", "20"), 20),
+		Window:            parseDuration(getEnv("ERROR_REPORT_WINDOW", "5m"), 5*time.Minute),
+	}
+}
+
+// NewErrorReporter 创建错误上报器，SentryDSN 与 Webhook 均未配置时返回 nil
+func NewErrorReporter(config ErrorReportConfig) *ErrorReporter {
+	dsn, webhook := config.SentryDSN, config.Webhook
+	if dsn == "" && webhook == "" {
+		return nil
+	}
+
+	hostname, _ := os.Hostname()
+	// 上报使用独立的 Transport，上游连接暂停或被判定为 DNS 污染时仍能投递
+	e := &ErrorReporter{
+		webhook:     webhook,
+		environment: config.SentryEnvironment,
+		serverName:  hostname,
+		release:     "go-docker-proxy@" + GetBuildInfo().Version,
+		threshold:   config.Threshold,
+		window:      config.Window,
+		client:      &http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone(), Timeout: 10 * time.Second},
+		queue:       make(chan ErrorReport, errorReportQueueSize),
+		reported:    make(map[string]time.Time),
+		errors:      make(map[string]*errorBurst),
+	}
+	if dsn != "" {
+		parsed, err := parseSentryDSN(dsn)
+		if err != nil {
+			log.Printf("Ignoring SENTRY_DSN: %v", err)
+		} else {
+			e.sentry = parsed
+			log.Printf("Sentry error reporting enabled (environment: %s)", e.environment)
+		}
+	}
+	if webhook != "" {
+		log.Printf("Error webhook: %s", webhook)
+	}
+	if e.sentry == nil && webhook == "" {
+		return nil
+	}
+	go e.run()
+	return e
+}
+
+// Report 投递报告（非阻塞），同一指纹在窗口期内只上报一次
+func (e *ErrorReporter) Report(report ErrorReport) {
+	if e == nil {
+		return
+	}
+	fingerprint := report.Kind + "|" + report.Route + "|" + report.Message
+	now := time.Now()
+	e.mu.Lock()
+	if last, ok := e.reported[fingerprint]; ok && now.Sub(last) < e.window {
+		e.mu.Unlock()
+		return
+	}
+	e.reported[fingerprint] = now
+	for key, last := range e.reported {
+		if now.Sub(last) >= e.window {
+			delete(e.reported, key)
+		}
+	}
+	e.mu.Unlock()
+
+	report.Timestamp = now.UTC()
+	report.ServerName = e.serverName
+	report.Release = e.release
+	report.Environment = e.environment
+	select {
+	case e.queue <- report:
+	default:
+		log.Printf("Error report queue full, dropping %s report: %s", report.Kind, report.Message)
+	}
+}
+
+// observeStatus 记录路由的响应状态，窗口期内 5xx 达到阈值时上报一次
+func (e *ErrorReporter) observeStatus(route string, r *http.Request, status int) {
+	if e == nil || e.threshold <= 0 || status < http.StatusInternalServerError {
+		return
+	}
+	now := time.Now()
+	e.mu.Lock()
+	burst, ok := e.errors[route]
+	if !ok || now.Sub(burst.start) >= e.window {
+		burst = &errorBurst{start: now, statuses: make(map[int]int)}
+		e.errors[route] = burst
+	}
+	burst.count++
+	burst.statuses[status]++
+	if burst.count != e.threshold {
+		e.mu.Unlock()
+		return
+	}
+	statuses := make(map[string]int, len(burst.statuses))
+	for code, n := range burst.statuses {
+		statuses[fmt.Sprint(code)] = n
+	}
+	e.mu.Unlock()
+
+	e.Report(ErrorReport{
+		Kind:    ErrorKindSpike,
+		Level:   "warning",
+		Message: fmt.Sprintf("%d upstream failures (5xx) on %s within %s", e.threshold, route, e.window),
+		Route:   route,
+		Request: reportRequest(r),
+		Extra:   map[string]interface{}{"statuses": statuses},
+	})
+}
+
+// run 依次发送队列中的报告
+func (e *ErrorReporter) run() {
+	for report := range e.queue {
+		if e.sentry != nil {
+			if err := e.sendSentry(report); err != nil {
+				log.Printf("Failed to send error report to Sentry: %v", err)
+			}
+		}
+		if e.webhook != "" {
+			body, _ := json.Marshal(report)
+			if err := e.post(e.webhook, "application/json", body, nil); err != nil {
+				log.Printf("Failed to send error report to %s: %v", e.webhook, err)
+			}
+		}
+	}
+}
+
+// sendSentry 以 envelope 格式发送事件
+func (e *ErrorReporter) sendSentry(report ErrorReport) error {
+	eventID := newEventID()
+	event := map[string]interface{}{
+		"event_id":    eventID,
+		"timestamp":   report.Timestamp.Format(time.RFC3339Nano),
+		"platform":    "go",
+		"level":       report.Level,
+		"logger":      "go-docker-proxy",
+		"server_name": report.ServerName,
+		"release":     report.Release,
+		"environment": report.Environment,
+		"message":     map[string]string{"formatted": report.Message},
+		"tags":        map[string]string{"kind": report.Kind, "route": report.Route},
+		"fingerprint": []string{report.Kind, report.Route, report.Message},
+	}
+	extra := map[string]interface{}{}
+	for key, value := range report.Extra {
+		extra[key] = value
+	}
+	if report.Kind == ErrorKindPanic {
+		event["exception"] = map[string]interface{}{"values": []map[string]interface{}{{"type": "panic", "value": report.Message}}}
+		extra["stack"] = report.Stack
+	}
+	if report.Request != nil {
+		event["request"] = map[string]interface{}{
+			"method":  report.Request.Method,
+			"url":     report.Request.URL,
+			"headers": map[string]string{"User-Agent": report.Request.UserAgent, "Host": report.Request.Host},
+		}
+		user := map[string]string{"ip_address": report.Request.ClientIP}
+		if report.Request.Client != report.Request.ClientIP {
+			user["username"] = report.Request.Client
+		}
+		event["user"] = user
+		event["tags"].(map[string]string)["request_id"] = report.Request.ID
+	}
+	event["extra"] = extra
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	header, _ := json.Marshal(map[string]string{"event_id": eventID, "dsn": e.sentry.raw, "sent_at": time.Now().UTC().Format(time.RFC3339Nano)})
+	item, _ := json.Marshal(map[string]interface{}{"type": "event", "length": len(payload)})
+	body.Write(header)
+	body.WriteByte('\n')
+	body.Write(item)
+	body.WriteByte('\n')
+	body.Write(payload)
+	body.WriteByte('\n')
+
+	auth := fmt.Sprintf("Sentry sentry_version=7, sentry_key=%s, sentry_client=%s", e.sentry.publicKey, e.release)
+	return e.post(e.sentry.envelope, "application/x-sentry-envelope", body.Bytes(), map[string]string{"X-Sentry-Auth": auth})
+}
+
+func (e *ErrorReporter) post(endpoint, contentType string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// reportRequest 报告中的请求上下文（不含认证头）
+func reportRequest(r *http.Request) *ErrorReportRequest {
+	id := clientIdentityOf(r)
+	return &ErrorReportRequest{
+		ID:        middleware.GetReqID(r.Context()),
+		Method:    r.Method,
+		URL:       r.URL.RequestURI(),
+		Host:      r.Host,
+		Client:    id.String(),
+		ClientIP:  id.IP,
+		UserAgent: r.UserAgent(),
+	}
+}
+
+// errorReportMiddleware 位于 middleware.Recoverer 之内：panic 上报后继续抛出，由 Recoverer 记录日志并返回 500；
+// 同时按路由统计 5xx 响应
+func (p *ProxyServer) errorReportMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		defer func() {
+			if rec := recover(); rec != nil {
+				if rec != http.ErrAbortHandler {
+					p.errorReporter.Report(ErrorReport{
+						Kind:    ErrorKindPanic,
+						Level:   "fatal",
+						Message: fmt.Sprint(rec),
+						Stack:   string(debug.Stack()),
+						Route:   routeHostOf(r.Host),
+						Request: reportRequest(r),
+					})
+				}
+				panic(rec)
+			}
+		}()
+		next.ServeHTTP(ww, r)
+		p.errorReporter.observeStatus(routeHostOf(r.Host), r, ww.Status())
+	})
+}
+
+// routeHostOf 去掉端口的小写 host
+func routeHostOf(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
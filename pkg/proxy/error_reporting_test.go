@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+func TestErrorReporting(t *testing.T) {
+	reports := make(chan ErrorReport, 10)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var report ErrorReport
+		json.NewDecoder(r.Body).Decode(&report)
+		reports <- report
+	}))
+	t.Cleanup(webhook.Close)
+	envelopes := make(chan *http.Request, 10)
+	sentry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		envelopes <- r
+	}))
+	t.Cleanup(sentry.Close)
+
+	upstream := newFakeRegistry(t)
+	p, client := newTestProxy(t, upstream, map[string]string{
+		"ERROR_WEBHOOK_URL":          webhook.URL,
+		"SENTRY_DSN":                 strings.Replace(sentry.URL, "http://", "http://public-key@", 1) + "/42",
+		"ERROR_REPORT_5XX_THRESHOLD": "2",
+		"UPSTREAM_RETRIES":           "0",
+	})
+	waitReport := func(kind string) ErrorReport {
+		t.Helper()
+		select {
+		case report := <-reports:
+			if report.Kind != kind {
+				t.Fatalf("report kind = %q, want %q", report.Kind, kind)
+			}
+			select {
+			case r := <-envelopes:
+				if r.URL.Path != "/api/42/envelope/" || !strings.Contains(r.Header.Get("X-Sentry-Auth"), "sentry_key=public-key") {
+					t.Errorf("sentry request = %s %v", r.URL.Path, r.Header)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("no Sentry envelope")
+			}
+			return report
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no %s report", kind)
+		}
+		return ErrorReport{}
+	}
+
+	// 上游不可用，连续 5xx 达到阈值时上报一次
+	upstream.server.Close()
+	for i := 0; i < 3; i++ {
+		if resp, _ := client.do(http.MethodGet, "/v2/team/app/manifests/v1", nil); resp.StatusCode < 500 {
+			t.Fatalf("status = %d, want 5xx", resp.StatusCode)
+		}
+	}
+	if report := waitReport(ErrorKindSpike); report.Route != testRegistryHost || report.Request == nil || report.Request.ID == "" {
+		t.Errorf("spike report = %+v", report)
+	}
+
+	// panic 上报后仍由 Recoverer 返回 500；上报不经过上游 Transport，维护模式暂停上游连接时照常投递
+	p.transport.paused.Store(true)
+	handler := requestIDMiddleware(middleware.Recoverer(p.errorReportMiddleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("boom")
+	}))))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v2/", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d", rec.Code)
+	}
+	if report := waitReport(ErrorKindPanic); report.Message != "boom" || !strings.Contains(report.Stack, "TestErrorReporting") {
+		t.Errorf("panic report = %+v", report)
+	}
+}
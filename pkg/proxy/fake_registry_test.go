@@ -0,0 +1,643 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// =============================================================================
+// 测试用的进程内假上游仓库：manifest、blob、token 认证挑战，以及重定向到假 S3 存储
+// =============================================================================
+
+const (
+	fakeManifestType = "application/vnd.oci.image.manifest.v1+json"
+	fakeIndexType    = "application/vnd.oci.image.index.v1+json"
+)
+
+var fakeRegistryPath = regexp.MustCompile(`^/v2/(.+)/(manifests|blobs|referrers)/([^/]+)$`)
+
+// fakeRegistry 模拟需要 Bearer token 的上游仓库
+type fakeRegistry struct {
+	server  *httptest.Server
+	storage *httptest.Server // 模拟 S3：blob 重定向目标，不接受 Authorization 头
+
+	mu        sync.Mutex
+	token     string
+	manifests map[string][]byte           // repo:reference -> manifest（reference 为 tag 或 digest）
+	blobs     map[string][]byte           // digest -> 内容
+	referrers map[string][]fakeDescriptor // repo@subject digest -> 引用该 manifest 的制品
+	requests  map[string]int              // "METHOD path" -> 次数（包括存储）
+	scopes    []string                    // token 请求的 scope（多个 scope 参数分别记录）
+	ranges    []string                    // blob 请求携带的 Range 头
+	headers   map[string]http.Header      // "METHOD path" -> 最近一次请求的请求头
+	clientIPs map[string]bool             // 上游看到的连接来源 IP
+
+	redirectBlobs   bool          // blob 请求返回 307 重定向到存储
+	storageLoop     bool          // 存储把请求重定向回同一地址（重定向循环）
+	storageGetOnly  bool          // 存储拒绝 HEAD（预签名地址只签了 GET）
+	chunkedBlobs    bool          // 完整 blob 下载不带 Content-Length，分块发送
+	dropConnections int           // 接下来 N 次 /v2/ 请求直接断开连接
+	truncateBlobs   int           // 接下来 N 次完整 blob 下载只发送一半内容后断开
+	blobGate        chan struct{} // 非 nil 时完整 blob 下载先发送一半内容，通道关闭后再发送其余
+	manifestDelay   time.Duration // manifest 响应前的延迟，用于构造并发请求
+	rateLimit       string        // 非空时 manifest 响应携带 Docker Hub 形式的限流头（剩余额度）
+	throttle        int           // 接下来 N 次 manifest 请求返回 429（Retry-After: 60）
+	manifestDigest  string        // 非空时 manifest 响应的 Docker-Content-Digest 使用该值（模拟篡改内容的镜像源）
+}
+
+func newFakeRegistry(t *testing.T) *fakeRegistry {
+	t.Helper()
+	f := &fakeRegistry{
+		token:     "fake-token",
+		manifests: make(map[string][]byte),
+		blobs:     make(map[string][]byte),
+		referrers: make(map[string][]fakeDescriptor),
+		requests:  make(map[string]int),
+		headers:   make(map[string]http.Header),
+		clientIPs: make(map[string]bool),
+	}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serveRegistry))
+	f.storage = httptest.NewServer(http.HandlerFunc(f.serveStorage))
+	t.Cleanup(func() {
+		f.server.Close()
+		f.storage.Close()
+	})
+	return f
+}
+
+// addImage 添加镜像（OCI manifest + config + 各层），返回 manifest digest 和层 digest
+func (f *fakeRegistry) addImage(repo, tag string, layers ...[]byte) (string, []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	put := func(data []byte) map[string]interface{} {
+		digest := fakeDigest(data)
+		f.blobs[digest] = data
+		return map[string]interface{}{
+			"mediaType": "application/vnd.oci.image.layer.v1.tar+gzip",
+			"digest":    digest,
+			"size":      len(data),
+		}
+	}
+
+	config := put([]byte(fmt.Sprintf(`{"architecture":"amd64","os":"linux","tag":%q}`, tag)))
+	config["mediaType"] = "application/vnd.oci.image.config.v1+json"
+
+	var layerDigests []string
+	var descriptors []interface{}
+	for _, layer := range layers {
+		d := put(layer)
+		layerDigests = append(layerDigests, d["digest"].(string))
+		descriptors = append(descriptors, d)
+	}
+
+	manifest, _ := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     fakeManifestType,
+		"config":        config,
+		"layers":        descriptors,
+	})
+	digest := fakeDigest(manifest)
+	f.manifests[repo+":"+tag] = manifest
+	f.manifests[repo+":"+digest] = manifest
+	return digest, layerDigests
+}
+
+// addIndex 添加多平台 image index，platforms 为 os/arch -> 平台 manifest digest，返回 index 的 digest
+func (f *fakeRegistry) addIndex(repo, tag string, platforms map[string]string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	names := make([]string, 0, len(platforms))
+	for name := range platforms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var manifests []interface{}
+	for _, name := range names {
+		osName, arch, _ := strings.Cut(name, "/")
+		manifest := f.manifests[repo+":"+platforms[name]]
+		manifests = append(manifests, map[string]interface{}{
+			"mediaType": fakeManifestType,
+			"digest":    platforms[name],
+			"size":      len(manifest),
+			"platform":  map[string]string{"os": osName, "architecture": arch},
+		})
+	}
+	index, _ := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     fakeIndexType,
+		"manifests":     manifests,
+	})
+	digest := fakeDigest(index)
+	f.manifests[repo+":"+tag] = index
+	f.manifests[repo+":"+digest] = index
+	return digest
+}
+
+// fakeDescriptor OCI 描述符，用于 referrers 响应
+type fakeDescriptor struct {
+	MediaType    string `json:"mediaType"`
+	Digest       string `json:"digest"`
+	Size         int    `json:"size"`
+	ArtifactType string `json:"artifactType,omitempty"`
+}
+
+// addReferrer 为 subject 添加一个指定 artifactType 的引用制品（如签名、SBOM），返回制品 manifest 的 digest
+func (f *fakeRegistry) addReferrer(repo, subject, artifactType string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	manifest, _ := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     fakeManifestType,
+		"artifactType":  artifactType,
+		"subject":       map[string]interface{}{"mediaType": fakeManifestType, "digest": subject},
+	})
+	digest := fakeDigest(manifest)
+	f.manifests[repo+":"+digest] = manifest
+	f.referrers[repo+"@"+subject] = append(f.referrers[repo+"@"+subject], fakeDescriptor{
+		MediaType:    fakeManifestType,
+		Digest:       digest,
+		Size:         len(manifest),
+		ArtifactType: artifactType,
+	})
+	return digest
+}
+
+// count 返回某个请求收到的次数，例如 count("GET", "/v2/app/manifests/latest")
+func (f *fakeRegistry) count(method, path string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[method+" "+path]
+}
+
+// configure 在锁内修改行为开关（redirectBlobs、dropConnections 等）
+func (f *fakeRegistry) configure(fn func(f *fakeRegistry)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn(f)
+}
+
+// tokenScopes 返回 token 请求的 scope
+func (f *fakeRegistry) tokenScopes() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.scopes...)
+}
+
+// rangeRequests 返回 blob 请求携带的 Range 头
+func (f *fakeRegistry) rangeRequests() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.ranges...)
+}
+
+func (f *fakeRegistry) record(r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests[r.Method+" "+r.URL.Path]++
+	f.headers[r.Method+" "+r.URL.Path] = r.Header.Clone()
+	if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		f.clientIPs[ip] = true
+	}
+}
+
+// sourceIPs 返回上游看到的连接来源 IP
+func (f *fakeRegistry) sourceIPs() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ips := make([]string, 0, len(f.clientIPs))
+	for ip := range f.clientIPs {
+		ips = append(ips, ip)
+	}
+	sort.Strings(ips)
+	return ips
+}
+
+// header 返回某个请求最近一次携带的请求头
+func (f *fakeRegistry) header(method, path string) http.Header {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.headers[method+" "+path]
+}
+
+func (f *fakeRegistry) serveRegistry(w http.ResponseWriter, r *http.Request) {
+	f.record(r)
+
+	if r.URL.Path == "/token" {
+		f.mu.Lock()
+		f.scopes = append(f.scopes, r.URL.Query()["scope"]...)
+		f.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"token": f.token, "expires_in": 300})
+		return
+	}
+
+	if r.URL.Path == "/v2/" {
+		f.mu.Lock()
+		drop := f.dropConnections > 0
+		if drop {
+			f.dropConnections--
+		}
+		f.mu.Unlock()
+		if drop {
+			panic(http.ErrAbortHandler)
+		}
+	}
+
+	if r.Header.Get("Authorization") != "Bearer "+f.token {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="fake-registry"`, f.server.URL))
+		f.writeError(w, http.StatusUnauthorized, "UNAUTHORIZED", "authentication required")
+		return
+	}
+
+	if r.URL.Path == "/v2/" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("{}"))
+		return
+	}
+
+	m := fakeRegistryPath.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		f.writeError(w, http.StatusNotFound, "NOT_FOUND", "not found")
+		return
+	}
+	repo, kind, reference := m[1], m[2], m[3]
+	if kind == "referrers" {
+		f.serveReferrers(w, r, repo, reference)
+		return
+	}
+
+	f.mu.Lock()
+	manifest, manifestFound := f.manifests[repo+":"+reference]
+	blob, blobFound := f.blobs[reference]
+	redirect := f.redirectBlobs
+	chunked := kind == "blobs" && f.chunkedBlobs && r.Method == http.MethodGet && r.Header.Get("Range") == ""
+	truncate := kind == "blobs" && f.truncateBlobs > 0 && r.Method == http.MethodGet && r.Header.Get("Range") == ""
+	if truncate {
+		f.truncateBlobs--
+	}
+	gate := f.blobGate
+	if kind != "blobs" || r.Method != http.MethodGet || r.Header.Get("Range") != "" {
+		gate = nil
+	}
+	if kind == "blobs" && r.Header.Get("Range") != "" {
+		f.ranges = append(f.ranges, r.Header.Get("Range"))
+	}
+	delay, rateLimit, claimedDigest := f.manifestDelay, f.rateLimit, f.manifestDigest
+	throttle := kind == "manifests" && f.throttle > 0
+	if throttle {
+		f.throttle--
+	}
+	f.mu.Unlock()
+
+	if throttle {
+		w.Header().Set("Retry-After", "60")
+		f.writeError(w, http.StatusTooManyRequests, "TOOMANYREQUESTS", "rate limit exceeded")
+		return
+	}
+
+	if kind == "manifests" && delay > 0 {
+		time.Sleep(delay)
+	}
+
+	if kind == "manifests" && rateLimit != "" {
+		w.Header().Set("RateLimit-Limit", "100;w=21600")
+		w.Header().Set("RateLimit-Remaining", rateLimit+";w=21600")
+		w.Header().Set("Docker-RateLimit-Source", "203.0.113.7")
+	}
+
+	switch {
+	case kind == "manifests" && manifestFound:
+		var parsed struct {
+			MediaType string `json:"mediaType"`
+		}
+		if json.Unmarshal(manifest, &parsed); parsed.MediaType == "" {
+			parsed.MediaType = fakeManifestType
+		}
+		w.Header().Set("Content-Type", parsed.MediaType)
+		if claimedDigest == "" {
+			claimedDigest = fakeDigest(manifest)
+		}
+		w.Header().Set("Docker-Content-Digest", claimedDigest)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(manifest))
+	case kind == "manifests":
+		f.writeError(w, http.StatusNotFound, "MANIFEST_UNKNOWN", "manifest unknown")
+	case !blobFound:
+		f.writeError(w, http.StatusNotFound, "BLOB_UNKNOWN", "blob unknown")
+	case redirect:
+		http.Redirect(w, r, f.storage.URL+"/blobs/"+reference+"?X-Amz-Signature=fake", http.StatusTemporaryRedirect)
+	case truncate:
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", fmt.Sprint(len(blob)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(blob[:len(blob)/2])
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	case chunked:
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.WriteHeader(http.StatusOK)
+		for len(blob) > 0 {
+			n := min(len(blob), 64)
+			w.Write(blob[:n])
+			w.(http.Flusher).Flush()
+			blob = blob[n:]
+		}
+	case gate != nil:
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", fmt.Sprint(len(blob)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(blob[:len(blob)/2])
+		w.(http.Flusher).Flush()
+		select {
+		case <-gate:
+			w.Write(blob[len(blob)/2:])
+		case <-r.Context().Done():
+		}
+	default:
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Docker-Content-Digest", reference)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(blob))
+	}
+}
+
+// serveReferrers 实现 OCI 1.1 Referrers API，支持 artifactType 过滤
+func (f *fakeRegistry) serveReferrers(w http.ResponseWriter, r *http.Request, repo, subject string) {
+	artifactType := r.URL.Query().Get("artifactType")
+	f.mu.Lock()
+	manifests := []fakeDescriptor{}
+	for _, descriptor := range f.referrers[repo+"@"+subject] {
+		if artifactType == "" || descriptor.ArtifactType == artifactType {
+			manifests = append(manifests, descriptor)
+		}
+	}
+	f.mu.Unlock()
+
+	if artifactType != "" {
+		w.Header().Set("OCI-Filters-Applied", "artifactType")
+	}
+	w.Header().Set("Content-Type", fakeIndexType)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     fakeIndexType,
+		"manifests":     manifests,
+	})
+}
+
+// serveStorage 模拟 S3 预签名地址：与 S3 一样拒绝同时携带 Authorization 的请求
+func (f *fakeRegistry) serveStorage(w http.ResponseWriter, r *http.Request) {
+	f.record(r)
+
+	if r.Header.Get("Authorization") != "" {
+		http.Error(w, "Only one auth mechanism allowed", http.StatusBadRequest)
+		return
+	}
+	digest := strings.TrimPrefix(r.URL.Path, "/blobs/")
+	f.mu.Lock()
+	blob, found := f.blobs[digest]
+	loop, getOnly := f.storageLoop, f.storageGetOnly
+	f.mu.Unlock()
+	if loop {
+		w.Header().Set("Location", r.URL.RequestURI())
+		w.WriteHeader(http.StatusFound)
+		return
+	}
+	if getOnly && r.Method != http.MethodGet {
+		http.Error(w, "SignatureDoesNotMatch", http.StatusForbidden)
+		return
+	}
+	if !found || r.URL.Query().Get("X-Amz-Signature") == "" {
+		http.Error(w, "NoSuchKey", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(blob))
+}
+
+func (f *fakeRegistry) writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]string{{"code": code, "message": message}},
+	})
+}
+
+func fakeDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// =============================================================================
+// 代理与客户端
+// =============================================================================
+
+const testRegistryHost = "registry.test"
+
+// newTestProxy 创建指向假上游的代理，env 覆盖默认环境变量
+func newTestProxy(t *testing.T, upstream *fakeRegistry, env map[string]string) (*ProxyServer, *testClient) {
+	t.Helper()
+	p := newTestProxyServer(t, upstream, env)
+	return p, serveTestProxy(t, p)
+}
+
+// newTestProxyServer 创建代理但不启动，便于在启动前注册钩子
+func newTestProxyServer(t *testing.T, upstream *fakeRegistry, env map[string]string) *ProxyServer {
+	t.Helper()
+	t.Setenv("CACHE_DIR", t.TempDir())
+	t.Setenv("CUSTOM_DOMAIN", "example.test")
+	t.Setenv("UPSTREAM_RETRY_BACKOFF", "1ms")
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+
+	config := loadTestConfig(t)
+	config.Routes = map[string]string{testRegistryHost: upstream.server.URL}
+	return newConfiguredProxy(t, config)
+}
+
+// loadTestConfig 按当前环境变量加载配置
+func loadTestConfig(t *testing.T) *Config {
+	t.Helper()
+	config, err := LoadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+// newConfiguredProxy 按给定配置创建代理，配置无效时测试失败
+func newConfiguredProxy(t *testing.T, config *Config) *ProxyServer {
+	t.Helper()
+	p, err := NewProxyServer(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// serveTestProxy 启动代理的 HTTP 服务并返回访问它的客户端
+func serveTestProxy(t *testing.T, p *ProxyServer) *testClient {
+	t.Helper()
+	server := httptest.NewServer(p.Handler())
+	t.Cleanup(server.Close)
+
+	return &testClient{
+		t:    t,
+		base: server.URL,
+		http: &http.Client{
+			// 与 Docker 客户端一样自行处理重定向，便于断言代理返回的响应
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+			Timeout:       10 * time.Second,
+		},
+	}
+}
+
+// testClient 按 Docker 客户端的方式访问代理：先走 /v2/ 认证挑战，再携带 token 拉取
+type testClient struct {
+	t     *testing.T
+	base  string
+	http  *http.Client
+	token string
+}
+
+func (c *testClient) do(method, path string, header http.Header) (*http.Response, []byte) {
+	c.t.Helper()
+	req, err := http.NewRequest(method, c.base+path, nil)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	req.Host = testRegistryHost
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		c.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatalf("%s %s: reading body: %v", method, path, err)
+	}
+	return resp, body
+}
+
+// testAdminToken 测试中使用的 ADMIN_TOKEN
+const testAdminToken = "admin-token"
+
+// admin 以 testAdminToken 调用管理接口
+func (c *testClient) admin(method, path, body string) (*http.Response, []byte) {
+	c.t.Helper()
+	req, err := http.NewRequest(method, c.base+path, strings.NewReader(body))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+	resp, err := c.http.Do(req)
+	if err != nil {
+		c.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatalf("%s %s: reading body: %v", method, path, err)
+	}
+	return resp, data
+}
+
+// login 按 /v2/ 返回的认证挑战向代理的 /v2/auth 申请 repo 的拉取 token
+func (c *testClient) login(repo string) {
+	c.t.Helper()
+	c.token = ""
+	resp, _ := c.do("GET", "/v2/", nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		c.t.Fatalf("GET /v2/ without token: status %d, want 401", resp.StatusCode)
+	}
+
+	challenge := resp.Header.Get("WWW-Authenticate")
+	m := regexp.MustCompile(`realm="([^"]+)"`).FindStringSubmatch(challenge)
+	if m == nil {
+		c.t.Fatalf("no realm in challenge %q", challenge)
+	}
+	realm, err := url.Parse(m[1])
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	query := url.Values{"service": {"go-docker-proxy"}, "scope": {"repository:" + repo + ":pull"}}
+	resp, body := c.do("GET", realm.Path+"?"+query.Encode(), nil)
+	if resp.StatusCode != http.StatusOK {
+		c.t.Fatalf("token request: status %d: %s", resp.StatusCode, body)
+	}
+	var token struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil || token.Token == "" {
+		c.t.Fatalf("token response %q: %v", body, err)
+	}
+	c.token = token.Token
+}
+
+// pull 拉取 manifest 及其引用的全部 blob 并校验 digest，返回 manifest
+func (c *testClient) pull(repo, reference string) []byte {
+	c.t.Helper()
+	resp, manifest := c.do("GET", "/v2/"+repo+"/manifests/"+reference, http.Header{"Accept": {fakeManifestType}})
+	if resp.StatusCode != http.StatusOK {
+		c.t.Fatalf("GET manifest %s:%s: status %d: %s", repo, reference, resp.StatusCode, manifest)
+	}
+
+	var parsed struct {
+		Config struct {
+			Digest string `json:"digest"`
+		} `json:"config"`
+		Layers []struct {
+			Digest string `json:"digest"`
+		} `json:"layers"`
+	}
+	if err := json.Unmarshal(manifest, &parsed); err != nil {
+		c.t.Fatalf("parsing manifest: %v", err)
+	}
+
+	digests := []string{parsed.Config.Digest}
+	for _, layer := range parsed.Layers {
+		digests = append(digests, layer.Digest)
+	}
+	for _, digest := range digests {
+		resp, blob := c.do("GET", "/v2/"+repo+"/blobs/"+digest, nil)
+		if resp.StatusCode != http.StatusOK {
+			c.t.Fatalf("GET blob %s: status %d: %s", digest, resp.StatusCode, blob)
+		}
+		if got := fakeDigest(blob); got != digest {
+			c.t.Fatalf("blob %s: received content with digest %s", digest, got)
+		}
+	}
+	return manifest
+}
+
+// eventually 在超时前反复检查条件（缓存写入是异步的）
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
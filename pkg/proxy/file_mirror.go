@@ -0,0 +1,338 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+	"github.com/go-chi/chi/v5"
+)
+
+// =============================================================================
+// 文件镜像 - 普通 HTTP(S) 文件（GitHub Releases、Kubernetes 二进制等）的拉取缓存路由。
+// 文件内容按 sha256 存入 blob 存储，与镜像层共享去重、过期与淘汰；路径到 digest 的引用
+// 按 manifest TTL 过期，过期后携带 ETag / Last-Modified 向上游重新验证
+// =============================================================================
+
+// fileMirrorHeaders 随缓存文件保存并返回给客户端的响应头
+var fileMirrorHeaders = []string{"Content-Type", "Content-Disposition", "ETag", "Last-Modified"}
+
+// FileMirrorRoute 文件镜像路由
+type FileMirrorRoute struct {
+	Upstream string   // 上游地址（含路径前缀，不以 / 结尾）
+	Paths    []string // 允许的路径模式，* 匹配任意字符（含 /），为空时允许全部路径
+
+	allow []*regexp.Regexp
+}
+
+// allows 路径是否在允许列表中
+func (m *FileMirrorRoute) allows(name string) bool {
+	if len(m.allow) == 0 {
+		return true
+	}
+	for _, re := range m.allow {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// registerFileMirrorRoutes 按 FileMirrorRouteEntries（FILE_MIRROR_ROUTES，name=上游地址[;路径模式...]，
+// 如 github=https://github.com;/kubernetes/*/releases/download/*），生成 {name}.{CUSTOM_DOMAIN} 路由
+func registerFileMirrorRoutes(config *Config) {
+	mirrors := make(map[string]*FileMirrorRoute)
+	for _, entry := range config.FileMirrorRouteEntries {
+		name, value, ok := strings.Cut(entry, "=")
+		parts := strings.Split(value, ";")
+		name, upstream := strings.TrimSpace(name), strings.TrimSuffix(strings.TrimSpace(parts[0]), "/")
+		u, err := url.Parse(upstream)
+		if !ok || name == "" || err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			log.Printf("Ignoring invalid FILE_MIRROR_ROUTES entry %q (expected name=https://host[;/path/*...])", entry)
+			continue
+		}
+		route := &FileMirrorRoute{Upstream: upstream}
+		for _, pattern := range parts[1:] {
+			pattern = strings.TrimSpace(pattern)
+			if pattern == "" {
+				continue
+			}
+			if !strings.HasPrefix(pattern, "/") {
+				pattern = "/" + pattern
+			}
+			expr := "^" + strings.ReplaceAll(regexp.QuoteMeta(pattern), `\*`, ".*") + "$"
+			route.Paths = append(route.Paths, pattern)
+			route.allow = append(route.allow, regexp.MustCompile(expr))
+		}
+		routeHost := strings.ToLower(name + "." + config.CustomDomain)
+		mirrors[routeHost] = route
+		log.Printf("File mirror route: %s -> %s (paths: %s)", routeHost, u.Redacted(), route.describePaths())
+	}
+	config.FileMirrors = mirrors
+}
+
+// describePaths 路径允许列表的说明
+func (m *FileMirrorRoute) describePaths() string {
+	if len(m.Paths) == 0 {
+		return "all"
+	}
+	return strings.Join(m.Paths, ", ")
+}
+
+// sortedFileMirrorHosts 按域名排序的文件镜像路由
+func sortedFileMirrorHosts(config *Config) []string {
+	hosts := make([]string, 0, len(config.FileMirrors))
+	for host := range config.FileMirrors {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// fileMirrorStats 文件镜像请求统计
+type fileMirrorStats struct {
+	hits        atomic.Int64
+	misses      atomic.Int64
+	revalidated atomic.Int64 // 引用过期后上游返回 304，继续使用缓存内容
+	stale       atomic.Int64
+	redirected  atomic.Int64 // 重定向交给客户端，未经过缓存
+}
+
+// Stats 统计快照
+func (s *fileMirrorStats) Stats() map[string]interface{} {
+	return map[string]interface{}{
+		"hits":        s.hits.Load(),
+		"misses":      s.misses.Load(),
+		"revalidated": s.revalidated.Load(),
+		"stale":       s.stale.Load(),
+		"redirected":  s.redirected.Load(),
+	}
+}
+
+// fileMirrorMiddleware 文件镜像路由的请求不进入镜像仓库路由，经过与 /v2 相同的客户端认证、限流与用量统计后由 serveFileMirror 处理
+func (p *ProxyServer) fileMirrorMiddleware(next http.Handler) http.Handler {
+	mirror := chi.Chain(append(p.clientAccessMiddlewares(), p.clientAccountingMiddlewares()...)...).
+		HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host := routeHostname(r)
+			route, ok := p.current().fileMirrors[host]
+			if !ok {
+				// 认证期间路由已被热重载移除
+				next.ServeHTTP(w, r)
+				return
+			}
+			p.serveFileMirror(w, r, host, route)
+		})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := p.current().fileMirrors[routeHostname(r)]; !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		mirror.ServeHTTP(w, r)
+	})
+}
+
+// serveFileMirror 返回镜像文件：引用未过期且 blob 仍在缓存时直接返回，引用过期时向上游重新验证，
+// 未缓存时边转发边写入缓存；上游失败时返回保留期内的过期内容
+func (p *ProxyServer) serveFileMirror(w http.ResponseWriter, r *http.Request, routeHost string, route *FileMirrorRoute) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		p.writeErrorResponse(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := path.Clean("/" + r.URL.Path)
+	if !route.allows(name) {
+		p.writeErrorResponse(w, "path is not allowed for this file mirror", http.StatusForbidden)
+		return
+	}
+	target := route.Upstream + name
+	if r.URL.RawQuery != "" {
+		name += "?" + r.URL.RawQuery
+		target += "?" + r.URL.RawQuery
+	}
+	namespace := "mirror/" + routeHost
+
+	var stale *cache.CacheEntry
+	if p.cacheManager != nil {
+		if ref, ok := p.cacheManager.GetFile(namespace, name); ok {
+			if p.serveMirroredFile(w, r, ref, "HIT") {
+				p.mirrorStats.hits.Add(1)
+				return
+			}
+		} else if ref, ok := p.cacheManager.GetStaleFile(namespace, name); ok {
+			// 只有 blob 仍在缓存时才能按 304 继续使用
+			if _, err := p.cacheManager.BlobStore().Stat(r.Context(), ref.Descriptor.Digest); err == nil {
+				stale = ref
+			}
+		}
+	}
+	p.mirrorStats.misses.Add(1)
+
+	// 有过期引用时携带验证器，内容未变化时上游返回 304
+	conditional := make(http.Header)
+	if stale != nil {
+		if etag := http.Header(stale.Headers).Get("ETag"); etag != "" {
+			conditional.Set("If-None-Match", etag)
+		}
+		if modified := http.Header(stale.Headers).Get("Last-Modified"); modified != "" {
+			conditional.Set("If-Modified-Since", modified)
+		}
+	}
+	resp, err := p.fetchFile(r, target, conditional, func(u *url.URL) bool { return p.shouldFollowRedirect(u.Host) })
+	if err != nil || resp.StatusCode >= http.StatusInternalServerError {
+		if err == nil {
+			resp.Body.Close()
+			err = fmt.Errorf("upstream returned %d", resp.StatusCode)
+		}
+		if stale != nil && p.serveMirroredFile(w, r, stale, "STALE") {
+			p.mirrorStats.stale.Add(1)
+			return
+		}
+		p.writeErrorResponse(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && stale != nil:
+		if err := p.cacheManager.PutFileRef(namespace, name, stale.Descriptor, stale.Headers, p.cacheManager.ManifestTTL()); err != nil {
+			log.Printf("[FileMirror] Failed to refresh %s%s: %v", routeHost, name, err)
+		}
+		if p.serveMirroredFile(w, r, stale, "HIT") {
+			p.mirrorStats.revalidated.Add(1)
+			return
+		}
+		p.writeErrorResponse(w, "cached file is no longer available", http.StatusBadGateway)
+	case isRedirect(resp.StatusCode):
+		// 重定向目标不在服务器端跟随的范围内，交给客户端
+		p.mirrorStats.redirected.Add(1)
+		if location, err := resp.Location(); err == nil {
+			w.Header().Set("Location", location.String()) // 相对地址解析为上游的绝对地址
+		}
+		w.WriteHeader(resp.StatusCode)
+	case resp.StatusCode != http.StatusOK:
+		copyHeader(w.Header(), resp.Header, "Content-Type")
+		w.WriteHeader(resp.StatusCode)
+		if r.Method != http.MethodHead {
+			io.Copy(w, resp.Body)
+		}
+	default:
+		p.streamMirroredFile(w, r, namespace, name, resp)
+	}
+}
+
+// fetchFile 从上游获取文件（不转发客户端的认证信息），follow 决定重定向是否在服务器端跟随，
+// 不跟随时返回重定向响应
+func (p *ProxyServer) fetchFile(r *http.Request, target string, header http.Header, follow func(*url.URL) bool) (*http.Response, error) {
+	for hops := 0; ; hops++ {
+		req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, target, nil)
+		if err != nil {
+			return nil, err
+		}
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		p.setClientUserAgent(req, r.Header.Get("User-Agent"))
+		resp, err := p.roundTrip(req)
+		if err != nil || !isRedirect(resp.StatusCode) {
+			return resp, err
+		}
+		location, err := resp.Location()
+		if err != nil || !follow(location) {
+			return resp, nil
+		}
+		resp.Body.Close()
+		if hops >= p.config.RedirectMaxHops {
+			return nil, fmt.Errorf("stopped after %d redirects", hops)
+		}
+		target = location.String()
+	}
+}
+
+// serveMirroredFile 从 blob 存储返回引用指向的文件，blob 已被淘汰时返回 false
+func (p *ProxyServer) serveMirroredFile(w http.ResponseWriter, r *http.Request, ref *cache.CacheEntry, state string) bool {
+	entry, reader, err := p.cacheManager.GetBlob(r.Context(), ref.Descriptor.Digest, ref.Descriptor.Digest)
+	if err != nil {
+		return false
+	}
+	defer reader.Close()
+
+	for key, values := range ref.Headers {
+		w.Header()[key] = values
+	}
+	w.Header().Set("Docker-Content-Digest", entry.Descriptor.Digest)
+	w.Header().Set("X-Cache", state)
+	if rs, ok := reader.(io.ReadSeeker); ok {
+		// 支持 Range 与条件请求
+		http.ServeContent(w, r, "", ref.CachedAt, rs)
+		return true
+	}
+	w.Header().Set("Content-Length", strconv.FormatInt(entry.Descriptor.Size, 10))
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		p.streamCopy(w, reader)
+	}
+	return true
+}
+
+// streamMirroredFile 将上游文件转发给客户端并同时写入缓存，传输完整时提交 blob 与引用；
+// 超过 CACHE_MAX_BLOB_SIZE 的文件只转发
+func (p *ProxyServer) streamMirroredFile(w http.ResponseWriter, r *http.Request, namespace, name string, resp *http.Response) {
+	headers := make(map[string][]string)
+	for _, key := range fileMirrorHeaders {
+		if values := resp.Header.Values(key); len(values) > 0 {
+			headers[http.CanonicalHeaderKey(key)] = values
+		}
+	}
+	for key, values := range headers {
+		w.Header()[key] = values
+	}
+	if resp.ContentLength >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(resp.ContentLength, 10))
+	}
+	w.Header().Set("X-Cache", "MISS")
+
+	maxSize := p.config.CacheMaxBlobSize
+	var writer *cache.ContentWriter
+	if p.cacheManager != nil && (maxSize <= 0 || resp.ContentLength <= maxSize) {
+		var err error
+		if writer, err = p.cacheManager.ContentWriter(); err != nil {
+			log.Printf("[FileMirror] Failed to start cache write for %s: %v", name, err)
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+
+	var dst io.Writer = w
+	if r.Method == http.MethodHead {
+		dst = io.Discard // HEAD 同样下载完整内容写入缓存
+	}
+	var body io.Reader = resp.Body
+	if writer != nil {
+		body = io.TeeReader(resp.Body, writer)
+	}
+	_, err := io.Copy(dst, body)
+	if writer == nil {
+		return
+	}
+	if err != nil || (resp.ContentLength >= 0 && writer.Size() != resp.ContentLength) || (maxSize > 0 && writer.Size() > maxSize) {
+		writer.Cancel()
+		return
+	}
+
+	desc, err := writer.Commit(context.WithoutCancel(r.Context()), http.Header(headers).Get("Content-Type"))
+	if err == nil {
+		err = p.cacheManager.PutFileRef(namespace, name, desc, headers, p.cacheManager.ManifestTTL())
+	}
+	if err != nil {
+		log.Printf("[FileMirror] Failed to cache %s: %v", name, err)
+	}
+}
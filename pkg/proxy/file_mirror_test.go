@@ -0,0 +1,140 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TestFileMirror 覆盖文件镜像路由：路径允许列表、按规则在服务器端跟随重定向、内容写入 blob 存储，
+// 引用过期后按 ETag 重新验证，缓存内容支持 Range
+func TestFileMirror(t *testing.T) {
+	content := []byte("release binary content")
+	var downloads, notModified atomic.Int64
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/org/tool/releases/download/v1/tool":
+			http.Redirect(w, r, "/objects/tool", http.StatusFound)
+		case "/objects/tool":
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				notModified.Add(1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			downloads.Add(1)
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(content)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(files.Close)
+
+	p, client := newTestProxy(t, newFakeRegistry(t), map[string]string{
+		"FILE_MIRROR_ROUTES": "gh=" + files.URL + ";/org/*/releases/download/*",
+		"REDIRECT_RULES":     "127.0.0.1=follow",
+		"CACHE_MANIFEST_TTL": "1ms",
+	})
+	get := func(path string, header http.Header) (*http.Response, []byte) {
+		t.Helper()
+		req, _ := http.NewRequest("GET", client.base+path, nil)
+		req.Host = "gh.example.test"
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		resp, err := client.http.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, body
+	}
+
+	const file = "/org/tool/releases/download/v1/tool"
+	resp, body := get(file, nil)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Cache") != "MISS" || !bytes.Equal(body, content) {
+		t.Fatalf("first download: status %d, X-Cache %q, body %q", resp.StatusCode, resp.Header.Get("X-Cache"), body)
+	}
+	if _, reader, found := p.cacheManager.GetBlobReader(digestOf(content)); !found {
+		t.Fatal("file content was not stored in the blob store")
+	} else {
+		reader.Close()
+	}
+
+	// 引用已过期，上游按 ETag 返回 304 后继续使用缓存内容
+	time.Sleep(5 * time.Millisecond)
+	resp, body = get(file, http.Header{"Range": {"bytes=0-6"}})
+	if resp.StatusCode != http.StatusPartialContent || resp.Header.Get("X-Cache") != "HIT" || string(body) != "release" {
+		t.Errorf("revalidated range request: status %d, X-Cache %q, body %q", resp.StatusCode, resp.Header.Get("X-Cache"), body)
+	}
+	if downloads.Load() != 1 || notModified.Load() != 1 {
+		t.Errorf("upstream downloads = %d, not modified = %d, want 1 and 1", downloads.Load(), notModified.Load())
+	}
+
+	if resp, _ := get("/org/tool/archive/main.zip", nil); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("path outside the allowlist: status %d, want 403", resp.StatusCode)
+	}
+	if resp, _ := get("/org/tool/releases/download/v1/missing", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("missing file: status %d, want 404", resp.StatusCode)
+	}
+	if stats := p.mirrorStats.Stats(); stats["revalidated"] != int64(1) {
+		t.Errorf("file mirror stats = %v", stats)
+	}
+}
+
+// TestFileMirrorClientAuth 文件镜像路由与 /v2 一样需要客户端认证，未认证的请求不会到达上游
+func TestFileMirrorClientAuth(t *testing.T) {
+	var upstreamRequests atomic.Int64
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamRequests.Add(1)
+		w.Write([]byte("release binary"))
+	}))
+	t.Cleanup(files.Close)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("alice-pw"), bcrypt.MinCost)
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	os.WriteFile(path, []byte("alice:"+string(hash)+"\n"), 0o600)
+	p, client := newTestProxy(t, newFakeRegistry(t), map[string]string{
+		"FILE_MIRROR_ROUTES": "gh=" + files.URL + ";/releases/*",
+		"AUTH_HTPASSWD":      path,
+		"ADMIN_TOKEN":        "admin-token",
+	})
+	get := func(user string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest("GET", client.base+"/releases/tool", nil)
+		req.Host = "gh.example.test"
+		if user != "" {
+			req.SetBasicAuth(user, user+"-pw")
+		}
+		resp, err := client.http.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := get("")
+	if resp.StatusCode != http.StatusUnauthorized || !strings.HasPrefix(resp.Header.Get("WWW-Authenticate"), "Basic ") {
+		t.Fatalf("anonymous file request: status %d, challenge %q, want 401 with a Basic challenge", resp.StatusCode, resp.Header.Get("WWW-Authenticate"))
+	}
+	if upstreamRequests.Load() != 0 {
+		t.Errorf("anonymous request reached the upstream %d times", upstreamRequests.Load())
+	}
+	if resp := get("alice"); resp.StatusCode != http.StatusOK {
+		t.Errorf("authenticated file request: status %d, want 200", resp.StatusCode)
+	}
+	if report := p.usage.Report(time.Hour); len(report) != 1 || report[0].Repository != "gh.example.test" {
+		t.Errorf("usage report = %+v", report)
+	}
+}
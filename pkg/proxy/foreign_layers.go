@@ -0,0 +1,375 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+// =============================================================================
+// 外部层改写 - 将 manifest 中 foreign layer 的 urls 指回代理，使这些层同样经过缓存
+// =============================================================================
+
+const (
+	foreignLayerCacheSize = 10000
+	foreignLayerCacheTTL  = 24 * time.Hour
+)
+
+// foreignBlobPath 可经代理路由访问的外部层地址：/v2/{repo}/blobs/{digest}
+var foreignBlobPath = regexp.MustCompile(`^/v2/.+/blobs/sha256:[0-9a-f]{64}$`)
+
+// rewrittenManifest 改写后的 manifest，按新 digest 提供给客户端
+type rewrittenManifest struct {
+	data      []byte
+	mediaType string
+}
+
+// ForeignLayerRewriter 按映射表改写 foreign layer 的 urls
+type ForeignLayerRewriter struct {
+	hosts map[string]string // 外部层所在 host -> 代理路由域名
+
+	results   *expirable.LRU[string, string]             // {原 digest} {代理地址} -> 改写后的 digest（未改写时为空）
+	manifests *expirable.LRU[string, *rewrittenManifest] // 改写后的 digest -> 内容
+
+	rewritten atomic.Int64
+}
+
+// NewForeignLayerRewriter 按 ForeignLayerRoutes（FOREIGN_LAYER_ROUTES，name=host，如 mcr=mcr.microsoft.com），
+// 为每个 host 注册路由 {name}.{CUSTOM_DOMAIN}（已有指向该 host 的路由时复用），未配置时返回 nil
+func NewForeignLayerRewriter(config *Config) *ForeignLayerRewriter {
+	routes := config.ForeignLayerRoutes
+	if len(routes) == 0 {
+		return nil
+	}
+
+	f := &ForeignLayerRewriter{
+		hosts:     make(map[string]string),
+		results:   expirable.NewLRU[string, string](foreignLayerCacheSize, nil, foreignLayerCacheTTL),
+		manifests: expirable.NewLRU[string, *rewrittenManifest](foreignLayerCacheSize, nil, foreignLayerCacheTTL),
+	}
+	for name, host := range routes {
+		routeHost := name + "." + config.CustomDomain
+		for domain, upstream := range config.Routes {
+			if upstream == "https://"+host {
+				routeHost = domain
+				break
+			}
+		}
+		if _, ok := config.Routes[routeHost]; !ok {
+			config.Routes[routeHost] = "https://" + host
+		}
+		f.hosts[host] = routeHost
+		log.Printf("Foreign layer rewrite: %s -> %s", host, routeHost)
+	}
+	return f
+}
+
+// Stats 改写统计
+func (f *ForeignLayerRewriter) Stats() map[string]interface{} {
+	return map[string]interface{}{
+		"hosts":     f.hosts,
+		"rewritten": f.rewritten.Load(),
+		"tracked":   f.manifests.Len(),
+	}
+}
+
+// foreignLayerMiddleware 按 tag 拉取 manifest 时改写外部层地址；
+// 改写后 digest 变化，客户端随后按新 digest 拉取时由映射表直接返回。
+// 按原 digest 拉取的请求保持原样，否则客户端校验 digest 会失败
+func (p *ProxyServer) foreignLayerMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pathType, repo, reference := cache.ParsePath(r.URL.Path)
+		if pathType != "manifest" || (r.Method != "GET" && r.Method != "HEAD") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		f := p.foreignLayers
+
+		if strings.HasPrefix(reference, "sha256:") {
+			if m, ok := f.manifests.Get(reference); ok {
+				serveRewrittenManifest(w, r, reference, m)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		base := f.baseURL(p, r)
+		rec := &bufferedResponse{header: make(http.Header)}
+		next.ServeHTTP(rec, r)
+		if rec.status != http.StatusOK {
+			rec.writeTo(w)
+			return
+		}
+
+		body := rec.body.Bytes()
+		if r.Method == "HEAD" {
+			// 结果未知时按 GET 获取内容判断是否需要改写
+			digest, known := f.results.Get(rec.header.Get("Docker-Content-Digest") + " " + base)
+			if known {
+				if m, ok := f.manifests.Get(digest); ok {
+					serveRewrittenManifest(w, r, digest, m)
+					return
+				}
+				rec.writeTo(w)
+				return
+			}
+			get := r.Clone(r.Context())
+			get.Method = "GET"
+			full := &bufferedResponse{header: make(http.Header)}
+			next.ServeHTTP(full, get)
+			if full.status != http.StatusOK {
+				rec.writeTo(w)
+				return
+			}
+			body = full.body.Bytes()
+		}
+
+		if digest, m := f.rewrite(r.Context(), p, r, repo, body, rec.header.Get("Content-Type"), base); m != nil {
+			serveRewrittenManifest(w, r, digest, m)
+			return
+		}
+		rec.writeTo(w)
+	})
+}
+
+// baseURL 客户端访问外部层改写目标使用的协议与端口，如 https://{host}:8443
+func (f *ForeignLayerRewriter) baseURL(p *ProxyServer, r *http.Request) string {
+	scheme, port := p.externalScheme(r)
+	if port != "" {
+		port = ":" + port
+	}
+	return scheme + "://{host}" + port
+}
+
+// rewrite 改写 manifest，不需要改写时返回 nil；结果按原 digest 记录，重复请求不再解析
+func (f *ForeignLayerRewriter) rewrite(ctx context.Context, p *ProxyServer, r *http.Request, repo string, data []byte, contentType, base string) (string, *rewrittenManifest) {
+	key := digestOf(data) + " " + base
+	if digest, ok := f.results.Get(key); ok {
+		if m, ok := f.manifests.Get(digest); ok {
+			return digest, m
+		}
+		if digest == "" {
+			return "", nil
+		}
+	}
+
+	mediaType := manifestMediaType(data, contentType)
+	var rewritten []byte
+	if IsIndexMediaType(mediaType) {
+		rewritten = f.rewriteIndex(ctx, p, r, repo, data, mediaType, base)
+	} else {
+		rewritten = f.rewriteImage(data, base)
+	}
+	if rewritten == nil {
+		f.results.Add(key, "")
+		return "", nil
+	}
+
+	digest, m := f.store(ctx, p, repo, rewritten, mediaType)
+	f.results.Add(key, digest)
+	if p.config.Debug {
+		log.Printf("[DEBUG] Foreign layers rewritten: %s %s -> %s", repo, digestOf(data), digest)
+	}
+	return digest, m
+}
+
+// rewriteIndex 改写 Windows 平台的子 manifest，并将 index 中的条目指向改写后的 digest
+func (f *ForeignLayerRewriter) rewriteIndex(ctx context.Context, p *ProxyServer, r *http.Request, repo string, data []byte, mediaType, base string) []byte {
+	var index map[string]json.RawMessage
+	var children []map[string]json.RawMessage
+	if json.Unmarshal(data, &index) != nil || json.Unmarshal(index["manifests"], &children) != nil {
+		return nil
+	}
+
+	changed := false
+	for _, child := range children {
+		var desc ManifestDescriptor
+		raw, _ := json.Marshal(child)
+		if json.Unmarshal(raw, &desc) != nil || desc.Platform == nil || desc.Platform.OS != "windows" {
+			continue
+		}
+
+		key := desc.Digest + " " + base
+		digest, known := f.results.Get(key)
+		m, ok := f.manifests.Get(digest)
+		if !known || (digest != "" && !ok) {
+			childData, childType := f.childManifest(ctx, p, r, repo, desc.Digest)
+			digest, m = "", nil
+			if rewritten := f.rewriteImage(childData, base); rewritten != nil {
+				digest, m = f.store(ctx, p, repo, rewritten, manifestMediaType(childData, childType))
+			}
+			if childData != nil {
+				f.results.Add(key, digest)
+			}
+		}
+		if m == nil {
+			continue
+		}
+		child["digest"], _ = json.Marshal(digest)
+		child["size"], _ = json.Marshal(len(m.data))
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+
+	index["manifests"], _ = json.Marshal(children)
+	rewritten, err := json.Marshal(index)
+	if err != nil {
+		return nil
+	}
+	return rewritten
+}
+
+// childManifest 获取 index 中的子 manifest：优先缓存，其次上游
+func (f *ForeignLayerRewriter) childManifest(ctx context.Context, p *ProxyServer, r *http.Request, repo, digest string) ([]byte, string) {
+	if p.cacheManager != nil {
+		if entry, err := p.cacheManager.GetManifest(ctx, repo, digest); err == nil && entry.StatusCode == http.StatusOK {
+			contentType := ""
+			if ct := entry.Headers["Content-Type"]; len(ct) > 0 {
+				contentType = ct[0]
+			}
+			return entry.Data, contentType
+		}
+	}
+
+	upstream := p.routeByHost(r.Host)
+	if upstream == "" {
+		return nil, ""
+	}
+	resp, err := p.fetchFromUpstream(ctx, upstream, repo, "manifests", digest, []string{MediaTypeOCIManifest, MediaTypeDockerManifest})
+	if err != nil {
+		return nil, ""
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCacheableSize))
+	if err != nil || resp.StatusCode != http.StatusOK || digestOf(data) != digest {
+		return nil, ""
+	}
+	return data, resp.Header.Get("Content-Type")
+}
+
+// rewriteImage 改写单平台 manifest 中指向映射 host 的 layer urls，其余字段保持不变
+func (f *ForeignLayerRewriter) rewriteImage(data []byte, base string) []byte {
+	var manifest map[string]json.RawMessage
+	var layers []map[string]json.RawMessage
+	if json.Unmarshal(data, &manifest) != nil || json.Unmarshal(manifest["layers"], &layers) != nil {
+		return nil
+	}
+
+	changed := false
+	for _, layer := range layers {
+		var urls []string
+		if json.Unmarshal(layer["urls"], &urls) != nil || len(urls) == 0 {
+			continue
+		}
+		for i, raw := range urls {
+			u, err := url.Parse(raw)
+			if err != nil || !foreignBlobPath.MatchString(u.Path) {
+				continue
+			}
+			host := u.Hostname()
+			if u.Port() != "" {
+				host = net.JoinHostPort(host, u.Port())
+			}
+			routeHost, ok := f.hosts[host]
+			if !ok {
+				continue
+			}
+			urls[i] = strings.Replace(base, "{host}", routeHost, 1) + u.Path
+			changed = true
+		}
+		layer["urls"], _ = json.Marshal(urls)
+	}
+	if !changed {
+		return nil
+	}
+
+	manifest["layers"], _ = json.Marshal(layers)
+	rewritten, err := json.Marshal(manifest)
+	if err != nil {
+		return nil
+	}
+	return rewritten
+}
+
+// store 记录改写后的 manifest，同时写入 manifest 缓存，重启后仍可按新 digest 拉取
+func (f *ForeignLayerRewriter) store(ctx context.Context, p *ProxyServer, repo string, data []byte, mediaType string) (string, *rewrittenManifest) {
+	digest := digestOf(data)
+	m := &rewrittenManifest{data: data, mediaType: mediaType}
+	f.manifests.Add(digest, m)
+	f.rewritten.Add(1)
+
+	if p.config.CacheEnabled && p.cacheManager != nil {
+		headers := map[string][]string{
+			"Content-Type":          {mediaType},
+			"Content-Length":        {strconv.Itoa(len(data))},
+			"Docker-Content-Digest": {digest},
+		}
+		if err := p.cacheManager.PutManifest(ctx, repo, digest, data, headers, http.StatusOK); err != nil && p.config.Debug {
+			log.Printf("[DEBUG] Failed to cache rewritten manifest %s: %v", digest, err)
+		}
+	}
+	return digest, m
+}
+
+// serveRewrittenManifest 返回改写后的 manifest
+func serveRewrittenManifest(w http.ResponseWriter, r *http.Request, digest string, m *rewrittenManifest) {
+	w.Header().Set("Content-Type", m.mediaType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(m.data)))
+	w.Header().Set("Docker-Content-Digest", digest)
+	w.Header().Set("Docker-Distribution-Api-Version", "registry/2.0")
+	w.WriteHeader(http.StatusOK)
+	if r.Method != "HEAD" {
+		w.Write(m.data)
+	}
+}
+
+// bufferedResponse 缓冲下游处理器的完整响应
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header { return b.header }
+
+func (b *bufferedResponse) WriteHeader(statusCode int) {
+	if b.status == 0 {
+		b.status = statusCode
+	}
+}
+
+func (b *bufferedResponse) Write(data []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(data)
+}
+
+// writeTo 原样写出缓冲的响应
+func (b *bufferedResponse) writeTo(w http.ResponseWriter) {
+	for k, v := range b.header {
+		w.Header()[k] = v
+	}
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	w.WriteHeader(b.status)
+	w.Write(b.body.Bytes())
+}
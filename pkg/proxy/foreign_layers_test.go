@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// addForeignImage 添加带外部层的镜像，外部层的 urls 指向 urls 中的地址（{digest} 替换为层 digest）
+func (f *fakeRegistry) addForeignImage(repo, tag string, urls ...string) (string, string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	config := []byte(`{"architecture":"amd64","os":"windows"}`)
+	f.blobs[fakeDigest(config)] = config
+	layer := fakeDigest([]byte("foreign layer"))
+	for i := range urls {
+		urls[i] = strings.ReplaceAll(urls[i], "{digest}", layer)
+	}
+	manifest, _ := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     fakeManifestType,
+		"config":        map[string]interface{}{"mediaType": "application/vnd.oci.image.config.v1+json", "digest": fakeDigest(config), "size": len(config)},
+		"layers": []interface{}{map[string]interface{}{
+			"mediaType": "application/vnd.docker.image.rootfs.foreign.diff.tar.gzip",
+			"digest":    layer,
+			"size":      13,
+			"urls":      urls,
+		}},
+	})
+	digest := fakeDigest(manifest)
+	f.manifests[repo+":"+tag] = manifest
+	f.manifests[repo+":"+digest] = manifest
+	return digest, layer
+}
+
+func TestForeignLayerRewrite(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	original, layer := upstream.addForeignImage("windows/app", "ltsc2022",
+		"https://mcr.test/v2/windows/servercore/blobs/{digest}",
+		"https://other.test/v2/windows/servercore/blobs/{digest}")
+	plain, _ := upstream.addImage("team/app", "v1", []byte("layer"))
+	p, client := newTestProxy(t, upstream, map[string]string{"FOREIGN_LAYER_ROUTES": "mcr=mcr.test"})
+	if route := p.current().routes["mcr.example.test"]; route != "https://mcr.test" {
+		t.Fatalf("route for mcr.example.test = %q", route)
+	}
+
+	accept := http.Header{"Accept": {fakeManifestType}}
+	client.login("windows/app")
+	resp, body := client.do("GET", "/v2/windows/app/manifests/ltsc2022", accept)
+	rewritten := resp.Header.Get("Docker-Content-Digest")
+	if resp.StatusCode != http.StatusOK || rewritten == original || rewritten != fakeDigest(body) {
+		t.Fatalf("GET by tag: status %d, digest %s (original %s)", resp.StatusCode, rewritten, original)
+	}
+	// 只改写映射的 host，其余地址保持不变
+	var m ImageManifest
+	if err := json.Unmarshal(body, &m); err != nil || len(m.Layers) != 1 {
+		t.Fatalf("rewritten manifest = %s", body)
+	}
+	wantURLs := []string{
+		"http://mcr.example.test/v2/windows/servercore/blobs/" + layer,
+		"https://other.test/v2/windows/servercore/blobs/" + layer,
+	}
+	if urls := m.Layers[0].URLs; len(urls) != 2 || urls[0] != wantURLs[0] || urls[1] != wantURLs[1] {
+		t.Errorf("layer urls = %v, want %v", urls, wantURLs)
+	}
+
+	// 客户端随后按改写后的 digest 拉取
+	resp, byDigest := client.do("GET", "/v2/windows/app/manifests/"+rewritten, accept)
+	if resp.StatusCode != http.StatusOK || string(byDigest) != string(body) {
+		t.Errorf("GET by rewritten digest: status %d", resp.StatusCode)
+	}
+	resp, _ = client.do("HEAD", "/v2/windows/app/manifests/ltsc2022", accept)
+	if got := resp.Header.Get("Docker-Content-Digest"); got != rewritten {
+		t.Errorf("HEAD by tag: digest %s, want %s", got, rewritten)
+	}
+	resp, byOriginal := client.do("GET", "/v2/windows/app/manifests/"+original, accept)
+	if resp.StatusCode != http.StatusOK || fakeDigest(byOriginal) != original {
+		t.Errorf("GET by original digest: status %d, digest %s", resp.StatusCode, fakeDigest(byOriginal))
+	}
+
+	// 没有外部层的 manifest 不改写
+	client.login("team/app")
+	resp, _ = client.do("GET", "/v2/team/app/manifests/v1", accept)
+	if got := resp.Header.Get("Docker-Content-Digest"); got != plain {
+		t.Errorf("plain manifest digest %s, want %s", got, plain)
+	}
+}
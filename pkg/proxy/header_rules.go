@@ -0,0 +1,160 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// =============================================================================
+// 请求 / 响应头改写规则 - 按路由声明式地设置或移除请求头与响应头（HEADER_RULES，JSON）
+// =============================================================================
+
+// HeaderRule 单条改写规则
+//
+//	{"route": "internal", "request": {"set": {"Authorization": "Basic {env:INTERNAL_AUTH}", "X-Org-Team": "{user}"},
+//	  "remove": ["Cookie"]}, "response": {"remove": ["Set-Cookie"]}}
+//
+// route 为路由名（docker、ghcr 等）或完整域名，"*" 或留空表示所有路由。
+// 值支持占位符：{user} 客户端认证身份、{client_ip} 客户端 IP、{host} 请求域名、{env:NAME} 环境变量（加载时展开）
+type HeaderRule struct {
+	Route    string         `json:"route"`
+	Request  HeaderMutation `json:"request"`
+	Response HeaderMutation `json:"response"`
+
+	host string
+}
+
+// HeaderMutation 设置与移除的头
+type HeaderMutation struct {
+	Set    map[string]string `json:"set,omitempty"`
+	Remove []string          `json:"remove,omitempty"` // 以 * 结尾时按前缀匹配
+}
+
+// HeaderRules 按顺序应用所有匹配路由的规则
+type HeaderRules struct {
+	rules []*HeaderRule
+}
+
+// envPlaceholder {env:NAME} 占位符
+var envPlaceholder = regexp.MustCompile(`\{env:([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// LoadHeaderRules 从 JSON 文件加载规则，path 为空时返回 nil
+func LoadHeaderRules(path, customDomain string) (*HeaderRules, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header rules: %w", err)
+	}
+	var rules []*HeaderRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse header rules: %w", err)
+	}
+	for i, rule := range rules {
+		switch {
+		case rule.Route == "" || rule.Route == "*":
+			rule.host = "*"
+		case strings.Contains(rule.Route, "."):
+			rule.host = rule.Route
+		default:
+			rule.host = rule.Route + "." + customDomain
+		}
+		for _, mutation := range []*HeaderMutation{&rule.Request, &rule.Response} {
+			mutation.Remove = canonicalHeaders(mutation.Remove)
+			for key, value := range mutation.Set {
+				var missing string
+				mutation.Set[key] = envPlaceholder.ReplaceAllStringFunc(value, func(m string) string {
+					name := envPlaceholder.FindStringSubmatch(m)[1]
+					v, ok := lookupEnv(name)
+					if !ok {
+						missing = name
+					}
+					return v
+				})
+				if missing != "" {
+					return nil, fmt.Errorf("header rule %d: %s references unset environment variable %s", i, key, missing)
+				}
+			}
+		}
+	}
+
+	log.Printf("Header rules enabled: %d rules", len(rules))
+	return &HeaderRules{rules: rules}, nil
+}
+
+// matching 返回匹配请求域名的规则
+func (h *HeaderRules) matching(host string) []*HeaderRule {
+	if h == nil {
+		return nil
+	}
+	var matched []*HeaderRule
+	for _, rule := range h.rules {
+		if rule.host == "*" || strings.EqualFold(rule.host, host) {
+			matched = append(matched, rule)
+		}
+	}
+	return matched
+}
+
+// expandHeaderValue 展开请求相关的占位符
+func expandHeaderValue(value string, r *http.Request) string {
+	if !strings.Contains(value, "{") {
+		return value
+	}
+	clientIP := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(clientIP); err == nil {
+		clientIP = host
+	}
+	return strings.NewReplacer(
+		"{user}", ClientUserFromContext(r.Context()),
+		"{client_ip}", clientIP,
+		"{host}", r.Host,
+	).Replace(value)
+}
+
+// ApplyRequest 改写发往上游的请求头，original 为客户端请求
+func (h *HeaderRules) ApplyRequest(original, req *http.Request) {
+	for _, rule := range h.matching(original.Host) {
+		for key := range req.Header {
+			if headerMatches(key, rule.Request.Remove) {
+				req.Header.Del(key)
+			}
+		}
+		for key, value := range rule.Request.Set {
+			req.Header.Set(key, expandHeaderValue(value, original))
+		}
+	}
+}
+
+// responseRules 转换为响应头规则，没有匹配的响应改写时返回 nil
+func (h *HeaderRules) responseRules(r *http.Request) *headerRules {
+	var result *headerRules
+	for _, rule := range h.matching(r.Host) {
+		if len(rule.Response.Set)+len(rule.Response.Remove) == 0 {
+			continue
+		}
+		rules := &headerRules{strip: rule.Response.Remove, add: make(http.Header)}
+		for key, value := range rule.Response.Set {
+			rules.add.Set(key, expandHeaderValue(value, r))
+		}
+		result = mergeHeaderRules(result, rules)
+	}
+	return result
+}
+
+// canonicalHeaders 规范化头名（保留前缀通配的 *）
+func canonicalHeaders(names []string) []string {
+	result := make([]string, len(names))
+	for i, name := range names {
+		result[i] = http.CanonicalHeaderKey(name)
+	}
+	return result
+}
@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"net/http"
+	"os"
+	"testing"
+)
+
+func TestHeaderRulesRewriteRequestAndResponse(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	upstream.addImage("team/app", "v1", []byte("layer"))
+	rulesFile := t.TempDir() + "/header-rules.json"
+	rules := `[{"route": "` + testRegistryHost + `",
+		"request": {"set": {"X-Org-Team": "{env:TEST_ORG_TEAM}", "X-Client-Host": "{host}"}, "remove": ["Cookie"]},
+		"response": {"set": {"X-Policy": "internal"}, "remove": ["Docker-Content-Digest", "X-Cache"]}}]`
+	if err := os.WriteFile(rulesFile, []byte(rules), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, client := newTestProxy(t, upstream, map[string]string{
+		"HEADER_RULES":  rulesFile,
+		"TEST_ORG_TEAM": "platform",
+		"CACHE_ENABLED": "false",
+	})
+
+	client.login("team/app")
+	resp, _ := client.do("GET", "/v2/team/app/manifests/v1", http.Header{"Cookie": {"session=secret"}})
+	sent := upstream.header("GET", "/v2/team/app/manifests/v1")
+	if got := sent.Get("X-Org-Team"); got != "platform" {
+		t.Errorf("upstream X-Org-Team %q, want platform", got)
+	}
+	if got := sent.Get("X-Client-Host"); got != testRegistryHost {
+		t.Errorf("upstream X-Client-Host %q, want %s", got, testRegistryHost)
+	}
+	if got := sent.Get("Cookie"); got != "" {
+		t.Errorf("Cookie %q was forwarded upstream", got)
+	}
+
+	if got := resp.Header.Get("X-Policy"); got != "internal" {
+		t.Errorf("X-Policy %q, want internal", got)
+	}
+	if resp.Header.Get("X-Cache") != "" {
+		t.Errorf("X-Cache %q was not removed", resp.Header.Get("X-Cache"))
+	}
+	if resp.Header.Get("Docker-Content-Digest") == "" {
+		t.Error("Docker-Content-Digest must always be forwarded")
+	}
+}
@@ -0,0 +1,256 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+// =============================================================================
+// 深度健康检查 - /health?deep=true 逐项检查运行依赖：缓存目录可写、剩余磁盘空间、
+// 上游域名解析与至少一个上游可达。缓存目录或上游不可用时整体为 unhealthy（503），
+// 磁盘空间不足或部分上游无法解析时为 degraded
+// =============================================================================
+
+// 单项检查状态
+const (
+	checkOK      = "ok"
+	checkFail    = "fail"
+	checkSkipped = "skipped"
+)
+
+// errDiskFreeUnsupported 当前平台无法查询剩余磁盘空间
+var errDiskFreeUnsupported = errors.New("free disk space is not available on this platform")
+
+// HealthCheck 单项检查结果
+type HealthCheck struct {
+	Status    string            `json:"status"`
+	Critical  bool              `json:"critical"` // 失败时整体为 unhealthy，否则为 degraded
+	Message   string            `json:"message,omitempty"`
+	Details   map[string]string `json:"details,omitempty"` // 上游 / 域名 -> 结果
+	LatencyMs float64           `json:"latencyMs"`
+}
+
+// runHealthChecks 并发执行各项检查，返回整体状态与各项结果
+func (p *ProxyServer) runHealthChecks(ctx context.Context) (string, map[string]*HealthCheck) {
+	if p.config.HealthCheckTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.config.HealthCheckTimeout)
+		defer cancel()
+	}
+
+	checks := map[string]func(context.Context) *HealthCheck{
+		"cache":    p.checkCacheWritable,
+		"disk":     p.checkDiskSpace,
+		"dns":      p.checkUpstreamDNS,
+		"upstream": p.checkUpstreamReachable,
+	}
+	results := make(map[string]*HealthCheck, len(checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check func(context.Context) *HealthCheck) {
+			defer wg.Done()
+			start := time.Now()
+			result := check(ctx)
+			result.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+			mu.Lock()
+			results[name] = result
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	status := "healthy"
+	for _, result := range results {
+		if result.Status != checkFail {
+			continue
+		}
+		if result.Critical {
+			return "unhealthy", results
+		}
+		status = "degraded"
+	}
+	return status, results
+}
+
+// checkCacheWritable 在缓存目录创建并删除一个临时文件
+func (p *ProxyServer) checkCacheWritable(ctx context.Context) *HealthCheck {
+	if !p.config.CacheEnabled {
+		return &HealthCheck{Status: checkSkipped, Message: "cache is disabled"}
+	}
+	result := &HealthCheck{Status: checkOK, Critical: true}
+	f, err := os.CreateTemp(p.config.CacheDir, ".health-*")
+	if err != nil {
+		result.Status, result.Message = checkFail, err.Error()
+		return result
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(time.Now().UTC().Format(time.RFC3339))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		result.Status, result.Message = checkFail, err.Error()
+	}
+	return result
+}
+
+// checkDiskSpace 缓存目录所在文件系统的剩余空间不低于 HEALTH_MIN_FREE_DISK
+func (p *ProxyServer) checkDiskSpace(ctx context.Context) *HealthCheck {
+	if !p.config.CacheEnabled {
+		return &HealthCheck{Status: checkSkipped, Message: "cache is disabled"}
+	}
+	free, err := diskFree(p.config.CacheDir)
+	if err == errDiskFreeUnsupported {
+		return &HealthCheck{Status: checkSkipped, Message: err.Error()}
+	}
+	if err != nil {
+		return &HealthCheck{Status: checkFail, Message: err.Error()}
+	}
+	result := &HealthCheck{Status: checkOK, Message: fmt.Sprintf("%s free", cache.FormatBytes(free))}
+	if p.config.HealthMinFreeDisk > 0 && free < p.config.HealthMinFreeDisk {
+		result.Status = checkFail
+		result.Message = fmt.Sprintf("%s free, below the %s minimum", cache.FormatBytes(free), cache.FormatBytes(p.config.HealthMinFreeDisk))
+	}
+	return result
+}
+
+// checkUpstreamDNS 用上游连接实际使用的解析器（含 DNS_OVERRIDES）解析各上游域名
+func (p *ProxyServer) checkUpstreamDNS(ctx context.Context) *HealthCheck {
+	result := &HealthCheck{Status: checkOK, Details: make(map[string]string)}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	failed := 0
+	for _, host := range p.healthCheckHosts() {
+		if net.ParseIP(host) != nil {
+			continue
+		}
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			addrs, err := p.transport.dialer.resolverFor(host).LookupHost(ctx, host)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed++
+				result.Details[host] = err.Error()
+				return
+			}
+			result.Details[host] = strings.Join(addrs, ", ")
+		}(host)
+	}
+	wg.Wait()
+	switch {
+	case len(result.Details) == 0:
+		result.Message = "no upstream hostnames to resolve"
+	case failed > 0:
+		result.Status = checkFail
+		result.Message = fmt.Sprintf("%d of %d upstream hostnames failed to resolve", failed, len(result.Details))
+	}
+	return result
+}
+
+// checkUpstreamReachable 请求各上游的 /v2/，任一返回非 5xx 即视为通过
+func (p *ProxyServer) checkUpstreamReachable(ctx context.Context) *HealthCheck {
+	if p.maintenance.active() != nil {
+		return &HealthCheck{Status: checkSkipped, Message: "maintenance mode: upstream requests are disabled"}
+	}
+	result := &HealthCheck{Status: checkFail, Critical: true, Details: make(map[string]string)}
+	upstreams := p.healthCheckUpstreams()
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	reachable := 0
+	for _, upstream := range upstreams {
+		wg.Add(1)
+		go func(upstream string) {
+			defer wg.Done()
+			detail, ok := p.probeUpstream(ctx, upstream)
+			mu.Lock()
+			defer mu.Unlock()
+			result.Details[upstream] = detail
+			if ok {
+				reachable++
+			}
+		}(upstream)
+	}
+	wg.Wait()
+	if reachable > 0 {
+		result.Status = checkOK
+	}
+	result.Message = fmt.Sprintf("%d of %d upstreams reachable", reachable, len(upstreams))
+	return result
+}
+
+// probeUpstream GET /v2/，任何非 5xx 响应（包括 401）都表示上游可达
+func (p *ProxyServer) probeUpstream(ctx context.Context, upstream string) (string, bool) {
+	req, err := http.NewRequestWithContext(ctx, "GET", upstream+"/v2/", nil)
+	if err != nil {
+		return err.Error(), false
+	}
+	p.setUserAgent(req)
+	p.authorizeUpstream(req)
+	resp, err := p.transport.RoundTrip(req)
+	if err != nil {
+		return err.Error(), false
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	resp.Body.Close()
+	return fmt.Sprintf("status %d", resp.StatusCode), resp.StatusCode < 500
+}
+
+// healthCheckUpstreams 当前路由、分流与镜像的上游地址（去重、排序）
+func (p *ProxyServer) healthCheckUpstreams() []string {
+	seen := make(map[string]bool)
+	for _, upstream := range p.current().routes {
+		seen[upstream] = true
+	}
+	for _, split := range p.current().splits {
+		seen[split.Upstream] = true
+	}
+	for _, mirrors := range p.config.Mirrors {
+		for _, mirror := range mirrors {
+			seen[mirror] = true
+		}
+	}
+	upstreams := make([]string, 0, len(seen))
+	for upstream := range seen {
+		upstreams = append(upstreams, upstream)
+	}
+	sort.Strings(upstreams)
+	return upstreams
+}
+
+// healthCheckHosts 上游地址中的域名（去重）
+func (p *ProxyServer) healthCheckHosts() []string {
+	seen := make(map[string]bool)
+	var hosts []string
+	for _, upstream := range p.healthCheckUpstreams() {
+		u, err := url.Parse(upstream)
+		if err != nil {
+			continue
+		}
+		// 对象存储源站按实际访问的地址解析
+		if origin, ok := p.transport.bucketOrigin(u.Host); ok && origin.pathStyle {
+			u = origin.Endpoint
+		}
+		if u.Hostname() == "" || seen[u.Hostname()] {
+			continue
+		}
+		seen[u.Hostname()] = true
+		hosts = append(hosts, u.Hostname())
+	}
+	return hosts
+}
@@ -0,0 +1,57 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestDeepHealth 覆盖 /health?deep=true 的各项检查与整体状态
+func TestDeepHealth(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	p, client := newTestProxy(t, upstream, map[string]string{"HEALTH_MIN_FREE_DISK": "0", "HEALTH_CHECK_TIMEOUT": "2s"})
+
+	deep := func() (int, string, map[string]HealthCheck) {
+		resp, body := client.do(http.MethodGet, "/health?deep=true", nil)
+		var health struct {
+			Status string
+			Checks map[string]HealthCheck
+		}
+		if err := json.Unmarshal(body, &health); err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode, health.Status, health.Checks
+	}
+
+	code, status, checks := deep()
+	if code != http.StatusOK || status != "healthy" {
+		t.Fatalf("deep health: status %d %q, checks %+v", code, status, checks)
+	}
+	for _, name := range []string{"cache", "disk", "dns", "upstream"} {
+		if checks[name].Status != checkOK {
+			t.Errorf("check %s = %+v", name, checks[name])
+		}
+	}
+
+	// 剩余空间低于下限只降级，不影响可用性
+	p.config.HealthMinFreeDisk = 1 << 60
+	code, status, checks = deep()
+	if code != http.StatusOK || status != "degraded" || checks["disk"].Status != checkFail {
+		t.Errorf("low disk: status %d %q, disk %+v", code, status, checks["disk"])
+	}
+	p.config.HealthMinFreeDisk = 0
+
+	// 所有上游不可达时返回 503
+	upstream.server.Close()
+	code, status, checks = deep()
+	if code != http.StatusServiceUnavailable || status != "unhealthy" || checks["upstream"].Status != checkFail {
+		t.Errorf("upstream down: status %d %q, upstream %+v", code, status, checks["upstream"])
+	}
+
+	// 非深度模式不执行检查
+	resp, body := client.do(http.MethodGet, "/health", nil)
+	if resp.StatusCode != http.StatusOK || strings.Contains(string(body), "checks") {
+		t.Errorf("/health: status %d, body %s", resp.StatusCode, body)
+	}
+}
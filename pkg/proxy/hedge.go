@@ -0,0 +1,188 @@
+package proxy
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+// =============================================================================
+// 对冲请求 - manifest 请求在延迟预算内未收到响应头时，向备用镜像并发请求，取先到者
+// =============================================================================
+
+// parseMirrors 解析 UPSTREAM_MIRRORS，返回 路由 host -> 镜像上游 URL 列表
+//
+//	UPSTREAM_MIRRORS="docker=mirror.gcr.io|dockerhub.example.com,quay=quay-mirror.example.com"
+func parseMirrors(value, customDomain string) map[string][]string {
+	result := make(map[string][]string)
+	for _, item := range strings.Split(value, ",") {
+		name, hosts, ok := strings.Cut(strings.TrimSpace(item), "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			continue
+		}
+		routeHost := name + "." + customDomain
+		for _, host := range strings.Split(hosts, "|") {
+			host = strings.TrimSpace(host)
+			host = strings.TrimPrefix(strings.TrimPrefix(host, "https://"), "http://")
+			host = strings.TrimSuffix(host, "/")
+			if host != "" {
+				result[routeHost] = append(result[routeHost], "https://"+host)
+			}
+		}
+	}
+	return result
+}
+
+// hedgeResult 单个候选上游的响应
+type hedgeResult struct {
+	upstream string
+	primary  bool
+	resp     *http.Response
+	err      error
+	cancel   context.CancelFunc
+}
+
+// discard 关闭未被采用的响应并取消其请求
+func (h *hedgeResult) discard() {
+	if h.resp != nil {
+		h.resp.Body.Close()
+	}
+	h.cancel()
+}
+
+// roundTripHedged 执行上游请求；配置了镜像的路由上，manifest GET 在 HEDGE_DELAY 内
+// 未收到主上游响应头（或主上游出错）时依次向镜像发起请求，采用第一个可用的响应
+// 主上游未通过健康检查时立即向镜像发起请求（故障转移），不受 HEDGE_DELAY 是否启用影响
+func (p *ProxyServer) roundTripHedged(r *http.Request, req *http.Request) (*http.Response, error) {
+	mirrors := p.config.Mirrors[r.Host]
+	pathType, repo, reference := cache.ParsePath(r.URL.Path)
+	delay := p.config.HedgeDelay
+	primaryDown := len(mirrors) > 0 && !p.upstreamHealth.Healthy(req.URL.Host)
+	if (delay <= 0 && !primaryDown) || len(mirrors) == 0 || req.Method != "GET" || pathType != "manifest" {
+		return p.roundTrip(req)
+	}
+	mirrors = p.healthyFirst(mirrors)
+
+	results := make(chan *hedgeResult, 1+len(mirrors))
+	accept := req.Header.Values("Accept")
+
+	ctx, cancel := context.WithCancel(req.Context())
+	go func() {
+		resp, err := p.roundTrip(req.WithContext(ctx))
+		results <- &hedgeResult{upstream: req.URL.Host, primary: true, resp: resp, err: err, cancel: cancel}
+	}()
+
+	next := 0
+	launchMirror := func() bool {
+		if next >= len(mirrors) {
+			return false
+		}
+		upstream := mirrors[next]
+		next++
+		ctx, cancel := context.WithCancel(req.Context())
+		go func() {
+			resp, err := p.fetchFromUpstream(ctx, upstream, repo, "manifests", reference, accept)
+			results <- &hedgeResult{upstream: upstream, resp: resp, err: err, cancel: cancel}
+		}()
+		if p.config.Debug {
+			log.Printf("[DEBUG] Hedging manifest request %s to mirror %s", r.URL.Path, upstream)
+		}
+		return true
+	}
+
+	first := delay
+	if primaryDown {
+		first = 0
+	}
+	timer := time.NewTimer(first)
+	defer timer.Stop()
+
+	pending := 1
+	var primary *hedgeResult
+	for pending > 0 {
+		select {
+		case <-timer.C:
+			if launchMirror() {
+				pending++
+				if delay > 0 {
+					timer.Reset(delay)
+				}
+			}
+
+		case result := <-results:
+			pending--
+			if !hedgeUsable(result) {
+				if result.primary {
+					// 主上游失败：保留结果作为兜底
+					primary = result
+				} else {
+					result.discard()
+				}
+				// 立即尝试下一个镜像
+				if launchMirror() {
+					pending++
+				}
+				continue
+			}
+
+			// 采用该响应，其余请求全部取消
+			if primary != nil {
+				primary.discard()
+			}
+			go func(n int) {
+				for i := 0; i < n; i++ {
+					(<-results).discard()
+				}
+			}(pending)
+
+			if !result.primary {
+				log.Printf("Hedged manifest request %s served by mirror %s", r.URL.Path, result.upstream)
+			}
+			result.resp.Body = &cancelBody{ReadCloser: result.resp.Body, cancel: result.cancel}
+			return result.resp, nil
+		}
+	}
+
+	// 镜像均不可用，返回主上游的结果
+	if primary.err != nil {
+		primary.cancel()
+		return nil, primary.err
+	}
+	primary.resp.Body = &cancelBody{ReadCloser: primary.resp.Body, cancel: primary.cancel}
+	return primary.resp, nil
+}
+
+// healthyFirst 健康的镜像排在前面，保持配置顺序
+func (p *ProxyServer) healthyFirst(mirrors []string) []string {
+	if p.upstreamHealth == nil {
+		return mirrors
+	}
+	ordered := make([]string, 0, len(mirrors))
+	var unhealthy []string
+	for _, mirror := range mirrors {
+		if u, err := url.Parse(mirror); err == nil && !p.upstreamHealth.Healthy(u.Host) {
+			unhealthy = append(unhealthy, mirror)
+			continue
+		}
+		ordered = append(ordered, mirror)
+	}
+	return append(ordered, unhealthy...)
+}
+
+// hedgeUsable 主上游除 5xx 外的响应都直接采用（401 / 404 等需要原样返回）
+// 镜像只采用 200，镜像缺失该 manifest 时继续等待主上游
+func hedgeUsable(result *hedgeResult) bool {
+	if result.err != nil {
+		return false
+	}
+	if result.primary {
+		return result.resp.StatusCode < 500
+	}
+	return result.resp.StatusCode == http.StatusOK
+}
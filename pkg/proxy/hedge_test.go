@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestHedgedManifestRequests(t *testing.T) {
+	primary, mirror := newFakeRegistry(t), newFakeRegistry(t)
+	primary.addImage("team/app", "v1", []byte("app layer"))
+	digest, _ := primary.addImage("team/app", "v2", []byte("app layer v2"))
+	mirror.addImage("team/app", "v1", []byte("app layer"))
+	mirror.addImage("team/app", "v2", []byte("app layer v2"))
+	primary.addImage("team/app", "primary-only", []byte("primary layer"))
+	p, client := newTestProxy(t, primary, map[string]string{"HEDGE_DELAY": "50ms"})
+	p.config.Mirrors = map[string][]string{testRegistryHost: {mirror.server.URL}}
+	client.login("team/app")
+
+	accept := http.Header{"Accept": {fakeManifestType}}
+	manifest := func(reference string) (*http.Response, time.Duration) {
+		t.Helper()
+		start := time.Now()
+		resp, body := client.do("GET", "/v2/team/app/manifests/"+reference, accept)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("manifest %s: status %d: %s", reference, resp.StatusCode, body)
+		}
+		return resp, time.Since(start)
+	}
+
+	// 主上游响应及时，不请求镜像
+	manifest("v1")
+	if n := mirror.count("GET", "/v2/team/app/manifests/v1"); n != 0 {
+		t.Errorf("mirror requested %d times while the primary was fast", n)
+	}
+
+	// 主上游变慢：镜像先返回
+	primary.configure(func(f *fakeRegistry) { f.manifestDelay = 2 * time.Second })
+	resp, elapsed := manifest("v2")
+	if elapsed > time.Second || resp.Header.Get("Docker-Content-Digest") != digest {
+		t.Errorf("slow primary: served in %v with digest %q", elapsed, resp.Header.Get("Docker-Content-Digest"))
+	}
+	if mirror.count("GET", "/v2/team/app/manifests/v2") == 0 {
+		t.Error("slow primary: mirror was not requested")
+	}
+
+	// 镜像缺少该 manifest：等待主上游
+	if _, elapsed := manifest("primary-only"); elapsed < 2*time.Second {
+		t.Errorf("manifest missing on the mirror served in %v, want the primary response", elapsed)
+	}
+}
+
+func TestParseMirrors(t *testing.T) {
+	mirrors := parseMirrors("docker=mirror.gcr.io|https://dockerhub.example.com/, quay=,=skip", "example.com")
+	want := []string{"https://mirror.gcr.io", "https://dockerhub.example.com"}
+	if got := mirrors["docker.example.com"]; len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("docker mirrors = %q, want %q", got, want)
+	}
+	if len(mirrors) != 1 {
+		t.Errorf("parseMirrors = %v, want only the docker route", mirrors)
+	}
+}
@@ -0,0 +1,138 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TestHelmRepository 覆盖 Helm chart 仓库路由：index.yaml 中的 chart 地址改写为相对地址，
+// index 与 chart 写入缓存，上游不可用时返回过期的 index
+func TestHelmRepository(t *testing.T) {
+	chart := []byte("chart archive")
+	var requests, failing atomic.Int64
+	var charts *httptest.Server
+	charts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch {
+		case failing.Load() != 0:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case r.URL.Path == "/stable/index.yaml":
+			fmt.Fprintf(w, "apiVersion: v1\nentries:\n  app:\n  - name: app\n    urls:\n    - %s/stable/app-1.0.0.tgz\n    - https://other.example.com/app-1.0.0.tgz\n", charts.URL)
+		case r.URL.Path == "/stable/app-1.0.0.tgz":
+			http.Redirect(w, r, "/storage/app-1.0.0.tgz", http.StatusFound)
+		case r.URL.Path == "/storage/app-1.0.0.tgz":
+			w.Write(chart)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(charts.Close)
+
+	p, client := newTestProxy(t, newFakeRegistry(t), map[string]string{
+		"HELM_ROUTES":        "charts=" + charts.URL + "/stable/",
+		"CACHE_MANIFEST_TTL": "1ms",
+	})
+	get := func(path string) (*http.Response, []byte) {
+		t.Helper()
+		req, _ := http.NewRequest("GET", client.base+path, nil)
+		req.Host = "charts.example.test"
+		resp, err := client.http.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, body
+	}
+
+	resp, index := get("/index.yaml")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Cache") != "MISS" {
+		t.Fatalf("index: status %d, X-Cache %q: %s", resp.StatusCode, resp.Header.Get("X-Cache"), index)
+	}
+	if !strings.Contains(string(index), "    - app-1.0.0.tgz\n") || !strings.Contains(string(index), "    - https://other.example.com/app-1.0.0.tgz\n") {
+		t.Errorf("chart urls not rewritten as expected:\n%s", index)
+	}
+
+	for i, want := range []string{"MISS", "HIT"} {
+		resp, body := get("/app-1.0.0.tgz")
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Cache") != want || !bytes.Equal(body, chart) {
+			t.Fatalf("chart fetch %d: status %d, X-Cache %q, body %q", i, resp.StatusCode, resp.Header.Get("X-Cache"), body)
+		}
+	}
+	if resp, _ := get("/missing.tgz"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("missing chart: status %d, want 404", resp.StatusCode)
+	}
+
+	// index 已过期，上游失败时返回过期内容
+	failing.Store(1)
+	time.Sleep(5 * time.Millisecond)
+	resp, stale := get("/index.yaml")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Cache") != "STALE" || !bytes.Equal(stale, index) {
+		t.Errorf("index with upstream down: status %d, X-Cache %q", resp.StatusCode, resp.Header.Get("X-Cache"))
+	}
+	if stats := p.helmStats.Stats(); stats["hits"] != int64(1) || stats["stale"] != int64(1) {
+		t.Errorf("helm stats = %v", stats)
+	}
+
+	// 镜像仓库路由不受影响
+	client.login("library/busybox")
+}
+
+// TestHelmRepositoryClientAuth Helm 仓库路由与 /v2 一样需要客户端认证，按认证用户限流并计入用量
+func TestHelmRepositoryClientAuth(t *testing.T) {
+	charts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("chart archive"))
+	}))
+	t.Cleanup(charts.Close)
+	hash, _ := bcrypt.GenerateFromPassword([]byte("alice-pw"), bcrypt.MinCost)
+	path := filepath.Join(t.TempDir(), "htpasswd")
+	os.WriteFile(path, []byte("alice:"+string(hash)+"\n"), 0o600)
+	p, client := newTestProxy(t, newFakeRegistry(t), map[string]string{
+		"HELM_ROUTES":       "charts=" + charts.URL,
+		"AUTH_HTPASSWD":     path,
+		"ADMIN_TOKEN":       "admin-token",
+		"CLIENT_RATE_LIMIT": "0.01",
+		"CLIENT_RATE_BURST": "2",
+	})
+	get := func(user string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest("GET", client.base+"/app-1.0.0.tgz", nil)
+		req.Host = "charts.example.test"
+		if user != "" {
+			req.SetBasicAuth(user, user+"-pw")
+		}
+		resp, err := client.http.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := get("")
+	if resp.StatusCode != http.StatusUnauthorized || !strings.HasPrefix(resp.Header.Get("WWW-Authenticate"), "Basic ") {
+		t.Fatalf("anonymous chart request: status %d, challenge %q, want 401 with a Basic challenge", resp.StatusCode, resp.Header.Get("WWW-Authenticate"))
+	}
+	if requests := p.helmStats.Stats()["misses"]; requests != int64(0) {
+		t.Errorf("anonymous request reached the upstream: %v misses", requests)
+	}
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if got := get("alice").StatusCode; got != want {
+			t.Errorf("alice request %d: status %d, want %d", i+1, got, want)
+		}
+	}
+	if report := p.usage.Report(time.Hour); len(report) != 1 || report[0].Repository != "charts.example.test" {
+		t.Errorf("usage report = %+v", report)
+	}
+}
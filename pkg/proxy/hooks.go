@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+// =============================================================================
+// 扩展钩子 - 嵌入使用者或定制构建无需修改请求处理器即可实现自定义策略、请求头注入或日志
+// =============================================================================
+
+// Hook 扩展点接口，通过 RegisterHook 注册；只关心部分事件时可嵌入 NopHook
+type Hook interface {
+	// OnRequest 在 /v2 请求进入处理器前调用（客户端认证之后），可修改请求头；
+	// 返回错误时以 403 DENIED 拒绝请求
+	OnRequest(r *http.Request) error
+
+	// OnUpstreamResponse 收到上游响应（包括跟随重定向后的存储响应）时调用，可修改响应头
+	OnUpstreamResponse(req *http.Request, resp *http.Response)
+
+	// OnCacheFill 内容写入缓存后调用，key 为缓存键
+	OnCacheFill(key string, entry *cache.CacheEntry)
+
+	// OnAuth 客户端认证通过后调用，identity 为用户名或 API token 名称；
+	// 返回错误时以 403 DENIED 拒绝请求
+	OnAuth(r *http.Request, identity string) error
+}
+
+// NopHook Hook 的空实现，用于嵌入
+type NopHook struct{}
+
+func (NopHook) OnRequest(*http.Request) error                    { return nil }
+func (NopHook) OnUpstreamResponse(*http.Request, *http.Response) {}
+func (NopHook) OnCacheFill(string, *cache.CacheEntry)            {}
+func (NopHook) OnAuth(*http.Request, string) error               { return nil }
+
+// RegisterHook 注册扩展钩子，按注册顺序调用；须在 Handler/Start 之前调用
+func (p *ProxyServer) RegisterHook(h Hook) {
+	p.hooks = append(p.hooks, h)
+}
+
+// hookMiddleware 依次调用 OnRequest，任一钩子返回错误即拒绝
+func (p *ProxyServer) hookMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, h := range p.hooks {
+			if err := h.OnRequest(r); err != nil {
+				p.writeRegistryError(w, http.StatusForbidden, "DENIED", err.Error())
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// hookUpstreamResponse 将上游响应交给各钩子
+func (p *ProxyServer) hookUpstreamResponse(req *http.Request, resp *http.Response) {
+	for _, h := range p.hooks {
+		h.OnUpstreamResponse(req, resp)
+	}
+}
+
+// hookCacheFill 通知各钩子内容已写入缓存
+func (p *ProxyServer) hookCacheFill(key string, entry *cache.CacheEntry) {
+	for _, h := range p.hooks {
+		h.OnCacheFill(key, entry)
+	}
+}
+
+// hookAuth 依次调用 OnAuth，返回第一个错误
+func (p *ProxyServer) hookAuth(r *http.Request, identity string) error {
+	for _, h := range p.hooks {
+		if err := h.OnAuth(r, identity); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+// recordingHook 记录收到的事件，拒绝 blocked/ 下的仓库与 banned 用户
+type recordingHook struct {
+	NopHook
+
+	mu         sync.Mutex
+	identities []string
+	upstream   []string
+	filled     []string
+}
+
+func (h *recordingHook) OnRequest(r *http.Request) error {
+	if strings.HasPrefix(r.URL.Path, "/v2/blocked/") {
+		return errors.New("repository is blocked by hook")
+	}
+	return nil
+}
+
+func (h *recordingHook) OnUpstreamResponse(req *http.Request, resp *http.Response) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.upstream = append(h.upstream, req.URL.Path)
+}
+
+func (h *recordingHook) OnCacheFill(key string, entry *cache.CacheEntry) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.filled = append(h.filled, key)
+}
+
+func (h *recordingHook) OnAuth(r *http.Request, identity string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.identities = append(h.identities, identity)
+	if identity == "banned" {
+		return errors.New("user is banned by hook")
+	}
+	return nil
+}
+
+func (h *recordingHook) seen(events *[]string, want string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, event := range *events {
+		if strings.Contains(event, want) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestHooks(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	_, layers := upstream.addImage("team/app", "v1", []byte("layer"))
+	upstream.addImage("blocked/app", "v1", []byte("blocked layer"))
+	p := newTestProxyServer(t, upstream, map[string]string{
+		"AUTH_HTPASSWD": writeHtpasswd(t, map[string]string{"dev": "s3cret", "banned": "s3cret"}),
+	})
+	hook := &recordingHook{}
+	p.RegisterHook(hook)
+	client := serveTestProxy(t, p)
+
+	// 以 Basic 认证换取 token，token 请求同样经过 OnAuth
+	login := func(user, repo string) (*http.Response, []byte) {
+		query := url.Values{"service": {"go-docker-proxy"}, "scope": {"repository:" + repo + ":pull"}}
+		client.token = ""
+		resp, body := client.do("GET", "/v2/auth?"+query.Encode(), basicAuth(user, "s3cret"))
+		var token struct {
+			Token string `json:"token"`
+		}
+		json.Unmarshal(body, &token)
+		client.token = token.Token
+		return resp, body
+	}
+	accept := http.Header{"Accept": {fakeManifestType}}
+
+	if resp, body := login("dev", "team/app"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("login as dev: status %d: %s", resp.StatusCode, body)
+	}
+	client.pull("team/app", "v1")
+	if !hook.seen(&hook.identities, "dev") {
+		t.Errorf("OnAuth identities = %v", hook.identities)
+	}
+	if !hook.seen(&hook.upstream, "/v2/team/app/manifests/v1") {
+		t.Errorf("OnUpstreamResponse paths = %v", hook.upstream)
+	}
+	eventually(t, "OnCacheFill for the layer", func() bool { return hook.seen(&hook.filled, layers[0]) })
+
+	// 钩子拒绝的请求返回 403 DENIED，不会到达上游
+	if resp, body := login("banned", "team/app"); resp.StatusCode != http.StatusForbidden || !strings.Contains(string(body), "DENIED") {
+		t.Errorf("login as banned: status %d: %s", resp.StatusCode, body)
+	}
+	login("dev", "blocked/app")
+	if resp, body := client.do("GET", "/v2/blocked/app/manifests/v1", accept); resp.StatusCode != http.StatusForbidden || !strings.Contains(string(body), "DENIED") {
+		t.Errorf("blocked repository: status %d: %s", resp.StatusCode, body)
+	}
+	if n := upstream.count("GET", "/v2/blocked/app/manifests/v1"); n != 0 {
+		t.Errorf("blocked repository reached upstream %d times", n)
+	}
+}
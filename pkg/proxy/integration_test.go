@@ -0,0 +1,258 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+// waitCached 等待 manifest 和 blob 写入缓存
+func waitCached(t *testing.T, p *ProxyServer, repo, tag string, digests []string) {
+	t.Helper()
+	manifestKey := cache.CacheKey(testRegistryHost, "/v2/"+repo+"/manifests/"+tag)
+	eventually(t, "manifest cache fill", func() bool {
+		_, found := p.cacheManager.Get(manifestKey)
+		return found
+	})
+	for _, digest := range digests {
+		eventually(t, "blob cache fill "+digest, func() bool { return blobCached(p, repo, digest) })
+	}
+}
+
+// blobCached 判断 blob 是否已写入缓存
+func blobCached(p *ProxyServer, repo, digest string) bool {
+	_, reader, found := p.cacheManager.GetBlobReader(cache.CacheKey(testRegistryHost, "/v2/"+repo+"/blobs/"+digest))
+	if found {
+		reader.Close()
+	}
+	return found
+}
+
+func TestPullThroughProxy(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	digest, _ := upstream.addImage("team/app", "v1", []byte("layer one"), []byte("layer two"))
+	_, client := newTestProxy(t, upstream, nil)
+
+	client.login("team/app")
+	manifest := client.pull("team/app", "v1")
+	if got := fakeDigest(manifest); got != digest {
+		t.Fatalf("manifest digest %s, want %s", got, digest)
+	}
+
+	// 按 digest 拉取同一 manifest
+	client.pull("team/app", digest)
+
+	if scopes := upstream.tokenScopes(); len(scopes) == 0 || scopes[0] != "repository:team/app:pull" {
+		t.Fatalf("upstream token scopes %q, want repository:team/app:pull", scopes)
+	}
+}
+
+func TestReferrersCachedPerArtifactType(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	subject, _ := upstream.addImage("team/app", "v1", []byte("layer"))
+	signature := upstream.addReferrer("team/app", subject, "application/vnd.dev.cosign.artifact.sig.v1+json")
+	sbom := upstream.addReferrer("team/app", subject, "application/spdx+json")
+	p, client := newTestProxy(t, upstream, nil)
+	client.login("team/app")
+
+	path := "/v2/team/app/referrers/" + subject
+	referrers := func(query string) []string {
+		t.Helper()
+		resp, body := client.do("GET", path+query, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET %s%s: status %d: %s", path, query, resp.StatusCode, body)
+		}
+		var index struct {
+			Manifests []fakeDescriptor `json:"manifests"`
+		}
+		if err := json.Unmarshal(body, &index); err != nil {
+			t.Fatalf("parsing referrers index: %v", err)
+		}
+		var digests []string
+		for _, descriptor := range index.Manifests {
+			digests = append(digests, descriptor.Digest)
+		}
+		return digests
+	}
+
+	if got := referrers(""); len(got) != 2 || got[0] != signature || got[1] != sbom {
+		t.Fatalf("referrers = %v, want [%s %s]", got, signature, sbom)
+	}
+	eventually(t, "referrers cache fill", func() bool {
+		_, found := p.cacheManager.Get(cache.ReferrersCacheKey(testRegistryHost, path, ""))
+		return found
+	})
+	if got := referrers(""); len(got) != 2 {
+		t.Errorf("cached referrers = %v", got)
+	}
+	if n := upstream.count("GET", path); n != 1 {
+		t.Errorf("referrers fetched from upstream %d times, want 1", n)
+	}
+
+	// 按 artifactType 过滤的结果单独缓存，不会返回未过滤的缓存
+	if got := referrers("?artifactType=" + url.QueryEscape("application/spdx+json")); len(got) != 1 || got[0] != sbom {
+		t.Errorf("filtered referrers = %v, want [%s]", got, sbom)
+	}
+	if n := upstream.count("GET", path); n != 2 {
+		t.Errorf("filtered referrers fetched from upstream %d times in total, want 2", n)
+	}
+}
+
+func TestManifestHeadReturnsDigest(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	digest, _ := upstream.addImage("team/app", "v1", []byte("layer"))
+	_, client := newTestProxy(t, upstream, nil)
+
+	client.login("team/app")
+	resp, body := client.do("HEAD", "/v2/team/app/manifests/v1", http.Header{"Accept": {fakeManifestType}})
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("HEAD manifest: status %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Docker-Content-Digest"); got != digest {
+		t.Fatalf("Docker-Content-Digest %q, want %q", got, digest)
+	}
+	if len(body) != 0 {
+		t.Fatalf("HEAD response has %d body bytes", len(body))
+	}
+}
+
+func TestRequestWithoutTokenGetsProxyChallenge(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	upstream.addImage("team/app", "v1", []byte("layer"))
+	_, client := newTestProxy(t, upstream, nil)
+
+	resp, _ := client.do("GET", "/v2/team/app/manifests/v1", nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("status %d, want 401", resp.StatusCode)
+	}
+	// 挑战必须指向代理自身，而不是上游的 token 服务
+	challenge := resp.Header.Get("WWW-Authenticate")
+	if !strings.Contains(challenge, testRegistryHost+"/v2/auth") {
+		t.Fatalf("challenge %q does not point at the proxy", challenge)
+	}
+}
+
+func TestUnknownManifestPassesThrough404(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	_, client := newTestProxy(t, upstream, nil)
+
+	client.login("team/app")
+	resp, body := client.do("GET", "/v2/team/app/manifests/missing", nil)
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("status %d, want 404", resp.StatusCode)
+	}
+	if !bytes.Contains(body, []byte("MANIFEST_UNKNOWN")) {
+		t.Fatalf("body %q does not carry the upstream error", body)
+	}
+}
+
+func TestRepeatPullServedFromCache(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	_, layers := upstream.addImage("team/app", "v1", []byte("cached layer"))
+	p, client := newTestProxy(t, upstream, nil)
+
+	client.login("team/app")
+	client.pull("team/app", "v1")
+	waitCached(t, p, "team/app", "v1", layers)
+
+	manifestPath := "/v2/team/app/manifests/v1"
+	blobPath := "/v2/team/app/blobs/" + layers[0]
+	manifestFetches := upstream.count("GET", manifestPath)
+	blobFetches := upstream.count("GET", blobPath)
+
+	client.pull("team/app", "v1")
+	if got := upstream.count("GET", manifestPath); got != manifestFetches {
+		t.Errorf("manifest fetched from upstream %d times, want %d", got, manifestFetches)
+	}
+	if got := upstream.count("GET", blobPath); got != blobFetches {
+		t.Errorf("blob fetched from upstream %d times, want %d", got, blobFetches)
+	}
+
+	resp, _ := client.do("GET", blobPath, nil)
+	if resp.Header.Get("X-Cache") != "HIT" {
+		t.Errorf("X-Cache %q, want HIT", resp.Header.Get("X-Cache"))
+	}
+}
+
+func TestBlobRedirectReturnedToClient(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	upstream.configure(func(f *fakeRegistry) { f.redirectBlobs = true })
+	_, layers := upstream.addImage("team/app", "v1", []byte("layer on s3"))
+	_, client := newTestProxy(t, upstream, nil)
+
+	client.login("team/app")
+	resp, _ := client.do("GET", "/v2/team/app/blobs/"+layers[0], nil)
+	if resp.StatusCode != http.StatusTemporaryRedirect {
+		t.Fatalf("status %d, want 307", resp.StatusCode)
+	}
+	if location := resp.Header.Get("Location"); !strings.HasPrefix(location, upstream.storage.URL) {
+		t.Fatalf("Location %q does not point at storage", location)
+	}
+}
+
+func TestBlobRedirectFollowedAndCached(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	upstream.configure(func(f *fakeRegistry) { f.redirectBlobs = true })
+	_, layers := upstream.addImage("team/app", "v1", []byte("layer on s3"))
+	p, client := newTestProxy(t, upstream, map[string]string{"FOLLOW_ALL_REDIRECTS": "true"})
+
+	client.login("team/app")
+	// pull 会校验内容；存储拒绝携带 Authorization 的请求，因此也验证了凭据没有转发到存储
+	client.pull("team/app", "v1")
+	waitCached(t, p, "team/app", "v1", layers)
+
+	storagePath := "/blobs/" + layers[0]
+	fetches := upstream.count("GET", storagePath)
+	if fetches != 1 {
+		t.Fatalf("storage fetched %d times, want 1", fetches)
+	}
+
+	resp, _ := client.do("GET", "/v2/team/app/blobs/"+layers[0], nil)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Cache") != "HIT" {
+		t.Fatalf("status %d, X-Cache %q; want cached 200", resp.StatusCode, resp.Header.Get("X-Cache"))
+	}
+	if got := upstream.count("GET", storagePath); got != fetches {
+		t.Fatalf("storage fetched %d times after cache hit, want %d", got, fetches)
+	}
+}
+
+func TestV2RetriesDroppedConnections(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	_, client := newTestProxy(t, upstream, map[string]string{"UPSTREAM_RETRIES": "2"})
+
+	// 两次断开后第三次成功：客户端拿到上游的认证挑战而不是 502
+	upstream.configure(func(f *fakeRegistry) { f.dropConnections = 2 })
+	resp, _ := client.do("GET", "/v2/", nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("status %d, want 401 after retries", resp.StatusCode)
+	}
+	if got := upstream.count("GET", "/v2/"); got != 3 {
+		t.Fatalf("upstream saw %d requests, want 3", got)
+	}
+
+	// 上游持续断开：重试用尽后返回 502
+	upstream.configure(func(f *fakeRegistry) { f.dropConnections = 100 })
+	resp, _ = client.do("GET", "/v2/", nil)
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("status %d, want 502 once retries are exhausted", resp.StatusCode)
+	}
+
+	// 重试次数、原因与结果按上游输出指标
+	_, body := client.do("GET", "/metrics", nil)
+	host := strings.TrimPrefix(upstream.server.URL, "http://")
+	for _, want := range []string{
+		`docker_proxy_upstream_retries_total{upstream="` + host + `",reason="connection"} 4`,
+		`docker_proxy_upstream_retried_requests_total{upstream="` + host + `",outcome="exhausted"} 1`,
+		`docker_proxy_upstream_retried_requests_total{upstream="` + host + `",outcome="recovered"} 1`,
+		`docker_proxy_upstream_retry_backoff_seconds_total{upstream="` + host + `"}`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+}
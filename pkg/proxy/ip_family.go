@@ -0,0 +1,174 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// =============================================================================
+// 地址族选择 - 上游连接只使用或优先使用 IPv4 / IPv6。IPv6 路径不通的网络中，
+// Go 默认按 DNS 返回顺序先尝试 IPv6，连接在超时前一直挂起；优先 IPv4 时先连 IPv4，
+// 在 UPSTREAM_FALLBACK_DELAY 内未连上再并发尝试另一地址族（Happy Eyeballs）
+// =============================================================================
+
+// 上游连接的地址族策略（UPSTREAM_IP_FAMILY）
+const (
+	ipFamilyAuto       = "auto"        // 按系统解析顺序，Go 默认的 Happy Eyeballs
+	ipFamilyIPv4       = "ipv4"        // 只解析 A 记录、只连接 IPv4
+	ipFamilyIPv6       = "ipv6"        // 只解析 AAAA 记录、只连接 IPv6
+	ipFamilyPreferIPv4 = "prefer-ipv4" // 先连接 IPv4，延迟后并发尝试 IPv6
+	ipFamilyPreferIPv6 = "prefer-ipv6" // 先连接 IPv6，延迟后并发尝试 IPv4
+)
+
+// validIPFamily UPSTREAM_IP_FAMILY 是否为支持的取值
+func validIPFamily(family string) bool {
+	switch family {
+	case ipFamilyAuto, ipFamilyIPv4, ipFamilyIPv6, ipFamilyPreferIPv4, ipFamilyPreferIPv6:
+		return true
+	}
+	return false
+}
+
+// familyNetwork 只使用单一地址族时对应的 network（tcp4/tcp6），其他策略返回原值
+func familyNetwork(family, network string) string {
+	if network != "tcp" {
+		return network
+	}
+	switch family {
+	case ipFamilyIPv4:
+		return "tcp4"
+	case ipFamilyIPv6:
+		return "tcp6"
+	}
+	return network
+}
+
+// dialPreferred 按优先的地址族解析并连接：优先地址族依次尝试，fallbackDelay 后并发尝试另一地址族，
+// 先建立的连接胜出（fallbackDelay < 0 表示优先地址族全部失败后才尝试另一地址族）
+func dialPreferred(ctx context.Context, dialer *net.Dialer, preferV4 bool, fallbackDelay time.Duration, host, port string) (net.Conn, error) {
+	resolver := dialer.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	addrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	return dialAddrs(ctx, dialer, preferV4, fallbackDelay, host, port, addrs)
+}
+
+// dialAddrs 按优先的地址族连接已解析的地址，规则同 dialPreferred
+func dialAddrs(ctx context.Context, dialer *net.Dialer, preferV4 bool, fallbackDelay time.Duration, host, port string, addrs []net.IPAddr) (net.Conn, error) {
+	var primary, fallback []string
+	for _, addr := range addrs {
+		// 绑定了出口地址时只能连接同一地址族
+		if local, ok := dialer.LocalAddr.(*net.TCPAddr); ok && (local.IP.To4() != nil) != (addr.IP.To4() != nil) {
+			continue
+		}
+		target := net.JoinHostPort(addr.String(), port)
+		if (addr.IP.To4() != nil) == preferV4 {
+			primary = append(primary, target)
+		} else {
+			fallback = append(fallback, target)
+		}
+	}
+	if len(primary) == 0 {
+		primary, fallback = fallback, nil
+	}
+	if len(primary) == 0 {
+		return nil, &net.DNSError{Err: "no suitable address", Name: host}
+	}
+	if len(fallback) == 0 {
+		return dialSerial(ctx, dialer, primary)
+	}
+
+	type dialResult struct {
+		conn    net.Conn
+		err     error
+		primary bool
+	}
+	returned := make(chan struct{})
+	defer close(returned)
+	results := make(chan dialResult)
+	start := func(ctx context.Context, primaryFamily bool) {
+		targets := primary
+		if !primaryFamily {
+			targets = fallback
+		}
+		conn, err := dialSerial(ctx, dialer, targets)
+		select {
+		case results <- dialResult{conn: conn, err: err, primary: primaryFamily}:
+		case <-returned:
+			if conn != nil {
+				conn.Close()
+			}
+		}
+	}
+
+	// 返回时取消仍在进行的另一路连接
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go start(ctx, true)
+
+	var timer <-chan time.Time
+	if fallbackDelay >= 0 {
+		t := time.NewTimer(fallbackDelay)
+		defer t.Stop()
+		timer = t.C
+	}
+
+	var primaryErr error
+	fallbackStarted, pending := false, 1
+	for {
+		select {
+		case <-timer:
+			timer = nil
+			fallbackStarted = true
+			pending++
+			go start(ctx, false)
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				return res.conn, nil
+			}
+			if res.primary {
+				primaryErr = res.err
+				if !fallbackStarted {
+					// 优先地址族全部失败，立即尝试另一地址族
+					timer = nil
+					fallbackStarted = true
+					pending++
+					go start(ctx, false)
+					continue
+				}
+			}
+			if pending == 0 {
+				// 两个地址族都已失败，返回优先地址族的错误
+				if !res.primary {
+					return nil, fmt.Errorf("%w (fallback: %v)", primaryErr, res.err)
+				}
+				return nil, res.err
+			}
+		}
+	}
+}
+
+// dialSerial 依次尝试各个地址，返回第一个成功的连接（都失败时返回第一个错误）
+func dialSerial(ctx context.Context, dialer *net.Dialer, targets []string) (net.Conn, error) {
+	var firstErr error
+	for _, target := range targets {
+		conn, err := dialer.DialContext(ctx, "tcp", target)
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, firstErr
+}
@@ -0,0 +1,35 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpstreamIPFamily(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(upstream.server.URL, "http://"))
+	addr := net.JoinHostPort("localhost", port)
+
+	// 假上游只监听 127.0.0.1
+	dial := func(family string) error {
+		d := newTestDialer(t, &Config{DNSTimeout: "5s", UpstreamIPFamily: family, UpstreamFallbackDelay: 50 * time.Millisecond})
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err == nil {
+			conn.Close()
+		}
+		return err
+	}
+	for _, family := range []string{ipFamilyAuto, ipFamilyIPv4, ipFamilyPreferIPv4, ipFamilyPreferIPv6} {
+		if err := dial(family); err != nil {
+			t.Errorf("%s: %v", family, err)
+		}
+	}
+	if err := dial(ipFamilyIPv6); err == nil {
+		t.Errorf("ipv6: connected to an IPv4-only upstream")
+	}
+}
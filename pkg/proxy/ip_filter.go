@@ -0,0 +1,192 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// =============================================================================
+// 来源 IP 访问控制 - 按 CIDR 允许 / 拒绝客户端，管理接口可单独设置允许列表
+// =============================================================================
+
+// IPFilter 来源 IP 过滤器
+type IPFilter struct {
+	allow      []*net.IPNet // 为空表示允许所有（deny 仍生效）
+	deny       []*net.IPNet
+	adminAllow []*net.IPNet // /admin、/stats、/metrics 与 /api/routes 的允许列表，为空时沿用 allow
+	trusted    []*net.IPNet // 可信反向代理，仅来自这些地址的 X-Forwarded-For / X-Real-IP 被采信
+	debug      bool
+}
+
+// IPFilterConfig 来源 IP 访问控制配置，各项为 CIDR 或单个 IP
+type IPFilterConfig struct {
+	Allowed        []string // 允许访问的来源
+	Denied         []string // 拒绝访问的来源，优先于 Allowed
+	AdminAllowed   []string // 允许访问 /admin、/stats、/metrics、/api/routes 的来源
+	TrustedProxies []string // 可信反向代理地址
+}
+
+// loadIPFilterConfig 从环境变量读取 ALLOWED_CIDRS、DENIED_CIDRS、ADMIN_ALLOWED_CIDRS 与 TRUSTED_PROXIES（逗号分隔）
+func loadIPFilterConfig() IPFilterConfig {
+	return IPFilterConfig{
+		Allowed:        getEnvList("ALLOWED_CIDRS"),
+		Denied:         getEnvList("DENIED_CIDRS"),
+		AdminAllowed:   getEnvList("ADMIN_ALLOWED_CIDRS"),
+		TrustedProxies: getEnvList("TRUSTED_PROXIES"),
+	}
+}
+
+// NewIPFilter 根据配置创建过滤器，允许与拒绝列表均未配置时返回 nil
+func NewIPFilter(config IPFilterConfig, debug bool) (*IPFilter, error) {
+	f := &IPFilter{debug: debug}
+
+	var err error
+	for _, item := range []struct {
+		key    string
+		values []string
+		target *[]*net.IPNet
+	}{
+		{"ALLOWED_CIDRS", config.Allowed, &f.allow},
+		{"DENIED_CIDRS", config.Denied, &f.deny},
+		{"ADMIN_ALLOWED_CIDRS", config.AdminAllowed, &f.adminAllow},
+		{"TRUSTED_PROXIES", config.TrustedProxies, &f.trusted},
+	} {
+		if *item.target, err = parseCIDRs(item.values); err != nil {
+			return nil, fmt.Errorf("%s: %w", item.key, err)
+		}
+	}
+
+	if len(f.allow) == 0 && len(f.deny) == 0 && len(f.adminAllow) == 0 {
+		return nil, nil
+	}
+	log.Printf("IP filter enabled: %d allowed, %d denied, %d admin allowed, %d trusted proxies",
+		len(f.allow), len(f.deny), len(f.adminAllow), len(f.trusted))
+	return f, nil
+}
+
+// parseCIDRs 解析 CIDR 列表，单个 IP 视为 /32 或 /128
+func parseCIDRs(values []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP %q", value)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", value)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP 获取客户端地址：直连地址属于可信代理时，取 X-Forwarded-For 中最右侧的非可信地址
+func (f *IPFilter) clientIP(r *http.Request) net.IP {
+	return forwardedClientIP(r, f.trusted)
+}
+
+// forwardedClientIP 按可信代理列表解析客户端地址，直连地址不是可信代理时忽略转发头
+func forwardedClientIP(r *http.Request, trusted []*net.IPNet) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !containsIP(trusted, ip) {
+		return ip
+	}
+
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		hops := strings.Split(xff, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := net.ParseIP(strings.TrimSpace(hops[i]))
+			if hop == nil {
+				break
+			}
+			ip = hop
+			if !containsIP(trusted, hop) {
+				break
+			}
+		}
+		return ip
+	}
+	if realIP := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); realIP != nil {
+		return realIP
+	}
+	return ip
+}
+
+// Allowed 判断来源是否允许访问该路径
+func (f *IPFilter) Allowed(ip net.IP, path string) bool {
+	if ip == nil {
+		return false
+	}
+	if containsIP(f.deny, ip) {
+		return false
+	}
+
+	allow := f.allow
+	if len(f.adminAllow) > 0 && (strings.HasPrefix(path, "/admin") || strings.HasPrefix(path, "/stats") || path == "/metrics" || path == "/api/routes") {
+		allow = f.adminAllow
+	}
+	return len(allow) == 0 || containsIP(allow, ip)
+}
+
+// realIPMiddleware 将 RemoteAddr 替换为经可信代理转发的客户端地址，供身份、访问日志等后续中间件使用；
+// 只有直连地址属于 TRUSTED_PROXIES 时才采信 X-Forwarded-For / X-Real-IP
+func realIPMiddleware(trusted []*net.IPNet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if len(trusted) > 0 {
+				if ip := forwardedClientIP(r, trusted); ip != nil {
+					r.RemoteAddr = ip.String()
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Middleware 必须位于 realIPMiddleware 之前，以便基于真实连接地址判断是否采信转发头
+// 健康检查端点不受限制
+func (f *IPFilter) Middleware(p *ProxyServer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/health" || r.URL.Path == "/healthz" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ip := f.clientIP(r)
+			if !f.Allowed(ip, r.URL.Path) {
+				if f.debug {
+					log.Printf("[DEBUG] IP filter denied %s %s", ip, r.URL.Path)
+				}
+				p.writeRegistryError(w, http.StatusForbidden, "DENIED", fmt.Sprintf("access from %s is not allowed", ip))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestIPFilterMiddleware(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		env     map[string]string
+		path    string
+		forward string
+		denied  bool
+	}{
+		{"outside allowlist", map[string]string{"ALLOWED_CIDRS": "10.0.0.0/8"}, "/v2/", "", true},
+		{"health check is exempt", map[string]string{"ALLOWED_CIDRS": "10.0.0.0/8"}, "/health", "", false},
+		{"inside allowlist", map[string]string{"ALLOWED_CIDRS": "127.0.0.1"}, "/v2/", "", false},
+		{"deny wins over allow", map[string]string{"ALLOWED_CIDRS": "127.0.0.1", "DENIED_CIDRS": "127.0.0.0/8"}, "/v2/", "", true},
+		{"admin allowlist", map[string]string{"ADMIN_ALLOWED_CIDRS": "10.0.0.0/8"}, "/metrics", "", true},
+		{"admin allowlist skips registry API", map[string]string{"ADMIN_ALLOWED_CIDRS": "10.0.0.0/8"}, "/v2/", "", false},
+		{"forwarded header from untrusted peer", map[string]string{"DENIED_CIDRS": "203.0.113.0/24"}, "/v2/", "203.0.113.5", false},
+		{"forwarded header from trusted proxy", map[string]string{"DENIED_CIDRS": "203.0.113.0/24", "TRUSTED_PROXIES": "127.0.0.1"}, "/v2/", "203.0.113.5", true},
+		{"trusted proxy forwarding an allowed client", map[string]string{"DENIED_CIDRS": "203.0.113.0/24", "TRUSTED_PROXIES": "127.0.0.1"}, "/v2/", "198.51.100.1", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			upstream := newFakeRegistry(t)
+			_, client := newTestProxy(t, upstream, tc.env)
+			header := http.Header{}
+			if tc.forward != "" {
+				header.Set("X-Forwarded-For", tc.forward)
+			}
+			resp, body := client.do("GET", tc.path, header)
+			if denied := resp.StatusCode == http.StatusForbidden; denied != tc.denied {
+				t.Errorf("GET %s: status %d, denied = %v, want %v: %s", tc.path, resp.StatusCode, denied, tc.denied, body)
+			}
+		})
+	}
+}
+
+func TestParseCIDRs(t *testing.T) {
+	nets, err := parseCIDRs([]string{"192.0.2.1", "2001:db8::/32"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nets) != 2 || nets[0].String() != "192.0.2.1/32" {
+		t.Errorf("parseCIDRs = %v", nets)
+	}
+	for _, value := range []string{"not-an-ip", "10.0.0.0/33"} {
+		if _, err := parseCIDRs([]string{value}); err == nil {
+			t.Errorf("parseCIDRs accepted %q", value)
+		}
+	}
+}
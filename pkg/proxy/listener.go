@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+)
+
+// =============================================================================
+// 监听配置 - 绑定地址、Unix socket 与 TLS，服务启动与 --health-check 自检共用
+// =============================================================================
+
+// ListenConfig 服务监听配置
+type ListenConfig struct {
+	Address     string // host:port（BIND_ADDRESS + PORT）
+	Socket      string // Unix socket 路径，设置后忽略 Address
+	TLSCertFile string
+	TLSKeyFile  string
+}
+
+// loadListenConfig 从环境变量读取监听配置
+//
+//	BIND_ADDRESS   绑定地址（默认监听所有地址）
+//	LISTEN_SOCKET  Unix socket 路径
+//	TLS_CERT_FILE  TLS 证书，与 TLS_KEY_FILE 同时设置时启用 HTTPS
+func loadListenConfig() ListenConfig {
+	return ListenConfig{
+		Address:     net.JoinHostPort(getEnv("BIND_ADDRESS", ""), getEnv("PORT", "8080")),
+		Socket:      getEnv("LISTEN_SOCKET", ""),
+		TLSCertFile: getEnv("TLS_CERT_FILE", ""),
+		TLSKeyFile:  getEnv("TLS_KEY_FILE", ""),
+	}
+}
+
+// TLS 是否启用 HTTPS
+func (c ListenConfig) TLS() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
+
+// String 用于启动日志
+func (c ListenConfig) String() string {
+	scheme := "http"
+	if c.TLS() {
+		scheme = "https"
+	}
+	if c.Socket != "" {
+		return scheme + "+unix://" + c.Socket
+	}
+	return scheme + "://" + c.Address
+}
+
+// Listen 创建监听器，Unix socket 会先删除残留的 socket 文件
+func (c ListenConfig) Listen() (net.Listener, error) {
+	if c.Socket == "" {
+		return net.Listen("tcp", c.Address)
+	}
+	if info, err := os.Stat(c.Socket); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(c.Socket)
+	}
+	return net.Listen("unix", c.Socket)
+}
+
+// Serve 在监听器上启动服务
+func (c ListenConfig) Serve(server *http.Server) error {
+	listener, err := c.Listen()
+	if err != nil {
+		return err
+	}
+	if c.TLS() {
+		return server.ServeTLS(listener, c.TLSCertFile, c.TLSKeyFile)
+	}
+	return server.Serve(listener)
+}
+
+// HealthCheckTarget 返回自检使用的 URL 与 client
+// 监听所有地址时改为访问回环地址；TLS 证书通常签发给对外域名，自检跳过证书校验
+func (c ListenConfig) HealthCheckTarget() (string, *http.Client) {
+	scheme := "http"
+	transport := &http.Transport{}
+	if c.TLS() {
+		scheme = "https"
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	client := &http.Client{Timeout: 3 * time.Second, Transport: transport}
+
+	if c.Socket != "" {
+		socket := c.Socket
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socket)
+		}
+		return scheme + "://localhost/health", client
+	}
+
+	host, port, err := net.SplitHostPort(c.Address)
+	if err != nil {
+		log.Printf("Invalid listen address %q: %v", c.Address, err)
+		host, port = "", getEnv("PORT", "8080")
+	}
+	switch host {
+	case "", "0.0.0.0":
+		host = "127.0.0.1"
+	case "::":
+		host = "::1"
+	}
+	return fmt.Sprintf("%s://%s/health", scheme, net.JoinHostPort(host, port)), client
+}
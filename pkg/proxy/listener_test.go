@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSelfSignedCert 写入 proxy.example.com 的自签名证书与私钥
+func writeSelfSignedCert(t *testing.T) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "proxy.example.com"},
+		DNSNames:     []string{"proxy.example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalPKCS8PrivateKey(key)
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600)
+	return certFile, keyFile
+}
+
+// serveHealth 按监听配置启动只提供 /health 的服务
+func serveHealth(t *testing.T, config ListenConfig) {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+	server := &http.Server{Handler: mux}
+	go config.Serve(server)
+	t.Cleanup(func() { server.Close() })
+}
+
+func TestListenConfigHealthCheck(t *testing.T) {
+	freeAddress := func() string {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+		return l.Addr().(*net.TCPAddr).AddrPort().String()
+	}
+	certFile, keyFile := writeSelfSignedCert(t)
+
+	for _, tc := range []struct {
+		name   string
+		config ListenConfig
+	}{
+		{"tcp", ListenConfig{Address: freeAddress()}},
+		{"tls", ListenConfig{Address: freeAddress(), TLSCertFile: certFile, TLSKeyFile: keyFile}},
+		{"unix socket", ListenConfig{Socket: filepath.Join(t.TempDir(), "proxy.sock")}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			serveHealth(t, tc.config)
+			target, client := tc.config.HealthCheckTarget()
+			eventually(t, "health check via "+target, func() bool {
+				resp, err := client.Get(target)
+				if err != nil {
+					return false
+				}
+				resp.Body.Close()
+				return resp.StatusCode == http.StatusOK
+			})
+		})
+	}
+}
+
+func TestListenSocketReplacesStaleFile(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "proxy.sock")
+	config := ListenConfig{Socket: socket}
+	first, err := config.Listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 模拟异常退出：socket 文件残留
+	first.(*net.UnixListener).SetUnlinkOnClose(false)
+	first.Close()
+
+	second, err := config.Listen()
+	if err != nil {
+		t.Fatalf("Listen with a stale socket file: %v", err)
+	}
+	second.Close()
+}
+
+func TestHealthCheckTargetAddress(t *testing.T) {
+	for address, want := range map[string]string{
+		":8080":          "http://127.0.0.1:8080/health",
+		"0.0.0.0:8080":   "http://127.0.0.1:8080/health",
+		"[::]:8080":      "http://[::1]:8080/health",
+		"10.0.0.5:5000":  "http://10.0.0.5:5000/health",
+		"localhost:9000": "http://localhost:9000/health",
+	} {
+		if got, _ := (ListenConfig{Address: address}).HealthCheckTarget(); got != want {
+			t.Errorf("HealthCheckTarget(%q) = %q, want %q", address, got, want)
+		}
+	}
+}
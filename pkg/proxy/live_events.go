@@ -0,0 +1,186 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// =============================================================================
+// 实时活动流 - GET /admin/events 以 Server-Sent Events 推送 manifest / blob 拉取事件
+// （仓库、tag、客户端、字节数、缓存状态），无需查看日志即可观察镜像活动；
+// 没有订阅者时不做任何记录
+// =============================================================================
+
+const (
+	// adminEventsPath 事件流路径，不受 REQUEST_TIMEOUT 限制
+	adminEventsPath = "/admin/events"
+	// liveEventBuffer 每个订阅者的事件缓冲，订阅者读取过慢时丢弃新事件
+	liveEventBuffer = 256
+	// liveEventHeartbeat 没有事件时发送注释行的间隔，防止中间代理断开空闲连接
+	liveEventHeartbeat = 15 * time.Second
+)
+
+// LiveEvent 一次已完成的拉取请求
+type LiveEvent struct {
+	Time       time.Time `json:"time"`
+	Host       string    `json:"host"`
+	Repository string    `json:"repository"`
+	Type       string    `json:"type"` // manifest、blob 或 file（Helm 仓库与文件镜像的文件，Tag 为路径）
+	Tag        string    `json:"tag,omitempty"`
+	Digest     string    `json:"digest,omitempty"`
+	Method     string    `json:"method"`
+	Status     int       `json:"status"`
+	Client     string    `json:"client"` // 客户端身份：用户名、token:名称、cert:CN 或来源 IP
+	Bytes      int64     `json:"bytes"`
+	Cache      string    `json:"cache,omitempty"` // X-Cache：HIT、MISS、STALE 等
+	DurationMs float64   `json:"durationMs"`
+}
+
+// eventStream 向所有订阅者广播事件
+type eventStream struct {
+	mu          sync.Mutex
+	subscribers map[chan LiveEvent]struct{}
+	count       atomic.Int32 // 订阅者数量，供中间件快速判断
+	dropped     atomic.Int64
+	closed      chan struct{} // 关闭时结束所有订阅，避免长连接拖住关闭排空
+	closeOnce   sync.Once
+}
+
+func newEventStream() *eventStream {
+	return &eventStream{subscribers: make(map[chan LiveEvent]struct{}), closed: make(chan struct{})}
+}
+
+// close 结束所有订阅
+func (s *eventStream) close() {
+	s.closeOnce.Do(func() { close(s.closed) })
+}
+
+// subscribe 注册订阅者，返回事件通道与取消函数
+func (s *eventStream) subscribe() (chan LiveEvent, func()) {
+	ch := make(chan LiveEvent, liveEventBuffer)
+	s.mu.Lock()
+	s.subscribers[ch] = struct{}{}
+	s.count.Store(int32(len(s.subscribers)))
+	s.mu.Unlock()
+	return ch, func() {
+		s.mu.Lock()
+		delete(s.subscribers, ch)
+		s.count.Store(int32(len(s.subscribers)))
+		s.mu.Unlock()
+	}
+}
+
+// publish 非阻塞地发送事件，订阅者缓冲已满时丢弃
+func (s *eventStream) publish(event LiveEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.subscribers {
+		select {
+		case ch <- event:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+// eventStreamMiddleware 有订阅者时，为 manifest 与 blob 的 GET / HEAD 请求生成事件
+func (p *ProxyServer) eventStreamMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p.events.count.Load() == 0 || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		pathType, repo, reference := p.accountedPath(r)
+		if pathType != "manifest" && pathType != "blob" && pathType != "file" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		client := clientIdentityOf(r).String()
+		event := LiveEvent{
+			Time:       start,
+			Host:       host,
+			Repository: repo,
+			Type:       pathType,
+			Digest:     ww.Header().Get("Docker-Content-Digest"),
+			Method:     r.Method,
+			Status:     ww.Status(),
+			Client:     client,
+			Bytes:      int64(ww.BytesWritten()),
+			Cache:      ww.Header().Get("X-Cache"),
+			DurationMs: float64(time.Since(start).Microseconds()) / 1000,
+		}
+		if strings.HasPrefix(reference, "sha256:") {
+			event.Digest = reference
+		} else {
+			event.Tag = reference
+		}
+		p.events.publish(event)
+	})
+}
+
+// registerEventAdminRoutes 注册事件流接口
+//
+//	GET /admin/events?repo=<前缀>&host=<路由域名>
+func (p *ProxyServer) registerEventAdminRoutes(r chi.Router) {
+	r.Get("/events", p.handleEvents)
+}
+
+// handleEvents 以 text/event-stream 推送事件（event: pull，data 为 JSON），直到客户端断开
+func (p *ProxyServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		p.writeErrorResponse(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	repoPrefix := r.URL.Query().Get("repo")
+	hostFilter := strings.ToLower(r.URL.Query().Get("host"))
+
+	events, cancel := p.events.subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // 关闭 nginx 的响应缓冲
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(liveEventHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-p.events.closed:
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		case event := <-events:
+			if !strings.HasPrefix(event.Repository, repoPrefix) || (hostFilter != "" && event.Host != hostFilter) {
+				continue
+			}
+			data, _ := json.Marshal(event)
+			fmt.Fprintf(w, "event: pull\ndata: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAdminEventStream(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	upstream.addImage("team/app", "v1", []byte("event layer"))
+	_, client := newTestProxy(t, upstream, map[string]string{"ADMIN_TOKEN": "admin-token", "REQUEST_TIMEOUT": "500ms"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", client.base+"/admin/events?repo=team/", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("status = %d, content type = %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	lines := bufio.NewScanner(resp.Body)
+	if !lines.Scan() || lines.Text() != ": connected" {
+		t.Fatalf("first line = %q", lines.Text())
+	}
+
+	// 事件流不受 REQUEST_TIMEOUT 限制
+	time.Sleep(600 * time.Millisecond)
+	client.login("team/app")
+	client.pull("team/app", "v1")
+
+	events := make(map[string]LiveEvent)
+	for len(events) < 2 && lines.Scan() {
+		data, ok := strings.CutPrefix(lines.Text(), "data: ")
+		if !ok {
+			continue
+		}
+		var event LiveEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			t.Fatal(err)
+		}
+		events[event.Type] = event
+	}
+	manifest, blob := events["manifest"], events["blob"]
+	if manifest.Repository != "team/app" || manifest.Tag != "v1" || manifest.Cache != "MISS" || manifest.Status != http.StatusOK || manifest.Client == "" {
+		t.Errorf("manifest event = %+v", manifest)
+	}
+	if blob.Repository != "team/app" || blob.Digest == "" || blob.Bytes == 0 {
+		t.Errorf("blob event = %+v", blob)
+	}
+}
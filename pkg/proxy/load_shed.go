@@ -0,0 +1,136 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+// =============================================================================
+// 并发限制与过载保护 - 限制同时进行的上游请求与 blob 传输，排队超时或队列已满时返回 503
+// =============================================================================
+
+// concurrencyLimiter 带等待队列的并发限制
+type concurrencyLimiter struct {
+	name     string
+	slots    chan struct{}
+	queue    int64         // 最大排队数
+	maxWait  time.Duration // 最长排队时间
+	waiting  atomic.Int64
+	shed     atomic.Int64 // 被拒绝的请求数
+	admitted atomic.Int64
+}
+
+// newConcurrencyLimiter limit <= 0 时返回 nil（不限制）
+func newConcurrencyLimiter(name string, limit, queue int, maxWait time.Duration) *concurrencyLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	log.Printf("Concurrency limit for %s: %d (queue %d, wait %s)", name, limit, queue, maxWait)
+	return &concurrencyLimiter{
+		name:    name,
+		slots:   make(chan struct{}, limit),
+		queue:   int64(queue),
+		maxWait: maxWait,
+	}
+}
+
+// Acquire 获取名额，返回 ok=false 表示应拒绝该请求
+func (l *concurrencyLimiter) Acquire(ctx context.Context) (release func(), ok bool) {
+	if l == nil {
+		return func() {}, true
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+		l.admitted.Add(1)
+		return l.release, true
+	default:
+	}
+
+	if l.waiting.Add(1) > l.queue {
+		l.waiting.Add(-1)
+		l.shed.Add(1)
+		return nil, false
+	}
+	defer l.waiting.Add(-1)
+
+	timer := time.NewTimer(l.maxWait)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		l.admitted.Add(1)
+		return l.release, true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	l.shed.Add(1)
+	return nil, false
+}
+
+func (l *concurrencyLimiter) release() {
+	<-l.slots
+}
+
+// Stats 当前状态
+func (l *concurrencyLimiter) Stats() map[string]interface{} {
+	return map[string]interface{}{
+		"limit":    cap(l.slots),
+		"inFlight": len(l.slots),
+		"waiting":  l.waiting.Load(),
+		"admitted": l.admitted.Load(),
+		"shed":     l.shed.Load(),
+	}
+}
+
+// limitStats 已启用的并发限制状态，均未启用时返回 nil
+func (p *ProxyServer) limitStats() map[string]interface{} {
+	stats := make(map[string]interface{})
+	for _, l := range []*concurrencyLimiter{p.upstreamLimit, p.blobLimit} {
+		if l != nil {
+			stats[l.name] = l.Stats()
+		}
+	}
+	if len(stats) == 0 {
+		return nil
+	}
+	return stats
+}
+
+// writeOverloaded 返回 503 与 Retry-After，客户端（docker / containerd）会按提示退避重试
+func (p *ProxyServer) writeOverloaded(w http.ResponseWriter, l *concurrencyLimiter) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(p.config.LimitRetryAfter.Seconds())))
+	p.writeRegistryError(w, http.StatusServiceUnavailable, "UNAVAILABLE",
+		fmt.Sprintf("proxy is overloaded (%s limit reached), retry later", l.name))
+}
+
+// blobLimitMiddleware 限制同时进行的 blob 传输（包括缓存命中）
+func (p *ProxyServer) blobLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if pathType, _, _ := cache.ParsePath(r.URL.Path); pathType != "blob" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		release, ok := p.blobLimit.Acquire(r.Context())
+		if !ok {
+			if p.config.Debug {
+				log.Printf("[DEBUG] Shedding blob request %s", r.URL.Path)
+			}
+			p.writeOverloaded(w, p.blobLimit)
+			return
+		}
+		defer release()
+		next.ServeHTTP(w, r)
+	})
+}
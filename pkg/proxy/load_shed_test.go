@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBlobStreamLimitShedsLoad(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	layer := bytes.Repeat([]byte("limited layer "), 20000)
+	_, layers := upstream.addImage("team/app", "v1", layer, []byte("second layer"))
+	p, client := newTestProxy(t, upstream, map[string]string{
+		"MAX_BLOB_STREAMS":  "1",
+		"LIMIT_QUEUE_SIZE":  "0",
+		"LIMIT_RETRY_AFTER": "7s",
+	})
+	client.login("team/app")
+
+	// 第一个 blob 传输停在一半，占用唯一的名额
+	gate := make(chan struct{})
+	upstream.configure(func(f *fakeRegistry) { f.blobGate = gate })
+	req, _ := http.NewRequest("GET", client.base+"/v2/team/app/blobs/"+layers[0], nil)
+	req.Host = testRegistryHost
+	req.Header.Set("Authorization", "Bearer "+client.token)
+	resp, err := client.http.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	second := "/v2/team/app/blobs/" + layers[1]
+	shed, body := client.do("GET", second, nil)
+	if shed.StatusCode != http.StatusServiceUnavailable || shed.Header.Get("Retry-After") != "7" || !strings.Contains(string(body), "UNAVAILABLE") {
+		t.Errorf("blob over the limit: status %d, Retry-After %q: %s", shed.StatusCode, shed.Header.Get("Retry-After"), body)
+	}
+	if stats := p.blobLimit.Stats(); stats["shed"] != int64(1) || stats["inFlight"] != 1 {
+		t.Errorf("blob limit stats = %v", stats)
+	}
+
+	// manifest 不受 blob 名额限制
+	if resp, _ := client.do("GET", "/v2/team/app/manifests/v1", http.Header{"Accept": {fakeManifestType}}); resp.StatusCode != http.StatusOK {
+		t.Errorf("manifest while blob limit is full: status %d", resp.StatusCode)
+	}
+
+	close(gate)
+	if data, err := io.ReadAll(resp.Body); err != nil || !bytes.Equal(data, layer) {
+		t.Fatalf("first blob: %v, intact=%v", err, bytes.Equal(data, layer))
+	}
+	eventually(t, "blob slot release", func() bool { return p.blobLimit.Stats()["inFlight"] == 0 })
+	if resp, _ := client.do("GET", second, nil); resp.StatusCode != http.StatusOK {
+		t.Errorf("blob after the slot was released: status %d", resp.StatusCode)
+	}
+}
+
+func TestConcurrencyLimiterQueue(t *testing.T) {
+	l := newConcurrencyLimiter("test", 1, 1, time.Second)
+	release, ok := l.Acquire(context.Background())
+	if !ok {
+		t.Fatal("first Acquire failed")
+	}
+
+	// 第二个请求排队，第三个请求因队列已满立即被拒绝
+	queued := make(chan bool)
+	go func() {
+		release, ok := l.Acquire(context.Background())
+		if ok {
+			release()
+		}
+		queued <- ok
+	}()
+	eventually(t, "request to queue", func() bool { return l.waiting.Load() == 1 })
+	if _, ok := l.Acquire(context.Background()); ok {
+		t.Error("Acquire succeeded with a full queue")
+	}
+	release()
+	if !<-queued {
+		t.Error("queued request was shed")
+	}
+
+	// 排队超时
+	l = newConcurrencyLimiter("test", 1, 1, 20*time.Millisecond)
+	l.Acquire(context.Background())
+	if _, ok := l.Acquire(context.Background()); ok {
+		t.Error("Acquire succeeded after the queue timeout")
+	}
+}
@@ -0,0 +1,145 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// =============================================================================
+// 维护模式 - 只从缓存提供内容，不再向上游发出任何请求（上游故障或需要暂停出口流量时）。
+// 缓存命中照常返回，过期的 manifest 在保留期内仍可返回，未命中返回 503 与 Retry-After；
+// /v2/ 与 /v2/auth 由代理自行应答，客户端无需访问上游即可拉取已缓存的镜像
+// =============================================================================
+
+// errMaintenance 维护模式下阻止的上游请求（预取、复制、健康检查等后台任务）
+var errMaintenance = errors.New("upstream requests are disabled in maintenance mode")
+
+// MaintenanceState 维护模式状态
+type MaintenanceState struct {
+	Enabled           bool          `json:"enabled"`
+	RetryAfter        time.Duration `json:"-"`
+	RetryAfterSeconds int64         `json:"retryAfterSeconds"`
+	Message           string        `json:"message,omitempty"`
+	Since             *time.Time    `json:"since,omitempty"`
+}
+
+// maintenanceMode 当前维护状态，切换时同时暂停上游 Transport
+type maintenanceMode struct {
+	state    atomic.Pointer[MaintenanceState]
+	rejected atomic.Int64 // 维护期间因缓存未命中返回 503 的请求数
+}
+
+// set 切换维护模式，返回新的状态
+func (m *maintenanceMode) set(transport *upstreamTransport, enabled bool, retryAfter time.Duration, message string) *MaintenanceState {
+	state := &MaintenanceState{Enabled: enabled}
+	if enabled {
+		state.RetryAfter = retryAfter
+		state.RetryAfterSeconds = int64(math.Ceil(retryAfter.Seconds()))
+		state.Message = message
+		now := time.Now().UTC()
+		state.Since = &now
+		if previous := m.state.Load(); previous != nil && previous.Enabled {
+			state.Since = previous.Since
+		}
+	}
+	m.state.Store(state)
+	transport.paused.Store(enabled)
+	return state
+}
+
+// active 维护模式开启时返回状态，否则返回 nil
+func (m *maintenanceMode) active() *MaintenanceState {
+	if state := m.state.Load(); state != nil && state.Enabled {
+		return state
+	}
+	return nil
+}
+
+// serveMaintenance 维护期间缓存未命中：有过期的 manifest 时返回过期内容，否则返回 503
+func (p *ProxyServer) serveMaintenance(w http.ResponseWriter, r *http.Request, cacheKey string, state *MaintenanceState) {
+	if p.serveStale(w, r, cacheKey) {
+		return
+	}
+	p.maintenance.rejected.Add(1)
+	message := state.Message
+	if message == "" {
+		message = "proxy is in maintenance mode and the content is not cached"
+	}
+	w.Header().Set("Retry-After", strconv.FormatInt(state.RetryAfterSeconds, 10))
+	p.writeRegistryError(w, http.StatusServiceUnavailable, "UNAVAILABLE", message)
+}
+
+// writeMaintenanceToken 维护期间 /v2/auth 不访问上游：启用客户端认证时发放代理 token，否则返回占位 token
+// （缓存内容本就不校验上游 token，维护结束后客户端收到上游的 401 会重新认证）
+func (p *ProxyServer) writeMaintenanceToken(w http.ResponseWriter, r *http.Request) {
+	if p.clientAuth != nil {
+		p.clientAuth.WriteProxyToken(w, ClientUserFromContext(r.Context()))
+		return
+	}
+	p.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"token":        "maintenance",
+		"access_token": "maintenance",
+		"expires_in":   defaultTokenExpiresIn,
+		"issued_at":    time.Now().UTC().Format(time.RFC3339),
+	})
+}
+
+// writeMetrics 输出维护模式指标
+func (m *maintenanceMode) writeMetrics(w *metricsWriter) {
+	enabled := 0.0
+	if m.active() != nil {
+		enabled = 1
+	}
+	w.gauge("docker_proxy_maintenance_mode", "Whether the proxy serves only from cache (1) or normally (0)", enabled)
+	w.counter("docker_proxy_maintenance_rejected_requests_total", "Cache misses answered with 503 in maintenance mode", float64(m.rejected.Load()))
+}
+
+// registerMaintenanceAdminRoutes 维护模式管理接口
+//
+//	GET  /admin/maintenance   当前状态
+//	POST /admin/maintenance   {"enabled": true, "retryAfter": "10m", "message": "..."}
+func (p *ProxyServer) registerMaintenanceAdminRoutes(r chi.Router) {
+	r.Get("/maintenance", func(w http.ResponseWriter, r *http.Request) {
+		state := p.maintenance.active()
+		if state == nil {
+			state = &MaintenanceState{}
+		}
+		p.writeJSON(w, http.StatusOK, state)
+	})
+	r.Post("/maintenance", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Enabled    bool   `json:"enabled"`
+			RetryAfter string `json:"retryAfter"`
+			Message    string `json:"message"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			p.writeErrorResponse(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		retryAfter := p.config.MaintenanceRetryAfter
+		if req.RetryAfter != "" {
+			d, err := parseDurationValue(req.RetryAfter)
+			if err != nil || d < 0 {
+				p.writeErrorResponse(w, fmt.Sprintf("invalid retryAfter %q", req.RetryAfter), http.StatusBadRequest)
+				return
+			}
+			retryAfter = d
+		}
+		state := p.maintenance.set(p.transport, req.Enabled, retryAfter, req.Message)
+		if state.Enabled {
+			log.Printf("Maintenance mode enabled: serving from cache only (Retry-After %s)", retryAfter)
+		} else {
+			log.Println("Maintenance mode disabled")
+		}
+		p.writeJSON(w, http.StatusOK, state)
+	})
+}
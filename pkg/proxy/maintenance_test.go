@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	upstream.addImage("team/app", "v1", []byte("cached layer"))
+	upstream.addImage("team/app", "v2", []byte("uncached layer"))
+	p, client := newTestProxy(t, upstream, map[string]string{"ADMIN_TOKEN": "admin-token"})
+
+	client.login("team/app")
+	manifest := client.pull("team/app", "v1")
+	var parsed struct {
+		Config struct{ Digest string }   `json:"config"`
+		Layers []struct{ Digest string } `json:"layers"`
+	}
+	json.Unmarshal(manifest, &parsed)
+	digests := []string{parsed.Config.Digest}
+	for _, layer := range parsed.Layers {
+		digests = append(digests, layer.Digest)
+	}
+	waitCached(t, p, "team/app", "v1", digests)
+
+	setMaintenance := func(body string) {
+		req, _ := http.NewRequest("POST", client.base+"/admin/maintenance", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer admin-token")
+		resp, err := client.http.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("POST /admin/maintenance: status %d", resp.StatusCode)
+		}
+	}
+	upstreamRequests := func() (total int) {
+		upstream.configure(func(f *fakeRegistry) {
+			for _, n := range f.requests {
+				total += n
+			}
+		})
+		return total
+	}
+
+	setMaintenance(`{"enabled": true, "retryAfter": "2m"}`)
+	before := upstreamRequests()
+
+	// 新客户端在维护期间也能完成认证并拉取已缓存的镜像
+	client.login("team/app")
+	client.pull("team/app", "v1")
+
+	// 未缓存的内容返回 503 与 Retry-After
+	resp, body := client.do("GET", "/v2/team/app/manifests/v2", http.Header{"Accept": {fakeManifestType}})
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") != "120" || !strings.Contains(string(body), "UNAVAILABLE") {
+		t.Fatalf("uncached manifest: status %d, Retry-After %q, body %s", resp.StatusCode, resp.Header.Get("Retry-After"), body)
+	}
+	if got := upstreamRequests(); got != before {
+		t.Errorf("upstream received %d requests in maintenance mode", got-before)
+	}
+
+	setMaintenance(`{"enabled": false}`)
+	client.login("team/app")
+	client.pull("team/app", "v2")
+}
@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// =============================================================================
+// Manifest 解析 - 兼容 Docker schema2 与 OCI image spec
+// =============================================================================
+
+const (
+	MediaTypeDockerManifest     = "application/vnd.docker.distribution.manifest.v2+json"
+	MediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+	MediaTypeOCIManifest        = "application/vnd.oci.image.manifest.v1+json"
+	MediaTypeOCIIndex           = "application/vnd.oci.image.index.v1+json"
+)
+
+// ManifestPlatform 描述 manifest list / image index 中条目的平台信息
+type ManifestPlatform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// String 返回 os/arch[/variant] 形式的平台字符串
+func (p *ManifestPlatform) String() string {
+	if p == nil {
+		return ""
+	}
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// ManifestDescriptor manifest 中引用的内容描述符
+type ManifestDescriptor struct {
+	MediaType    string            `json:"mediaType"`
+	Digest       string            `json:"digest"`
+	Size         int64             `json:"size"`
+	URLs         []string          `json:"urls,omitempty"`
+	Platform     *ManifestPlatform `json:"platform,omitempty"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+// ImageManifest 单平台 manifest 或多平台 index 的通用结构
+type ImageManifest struct {
+	SchemaVersion int                  `json:"schemaVersion"`
+	MediaType     string               `json:"mediaType,omitempty"`
+	Config        *ManifestDescriptor  `json:"config,omitempty"`
+	Layers        []ManifestDescriptor `json:"layers,omitempty"`
+	Manifests     []ManifestDescriptor `json:"manifests,omitempty"`
+	Subject       *ManifestDescriptor  `json:"subject,omitempty"`
+}
+
+// ParseManifest 解析 manifest 内容
+// contentType 优先于内容中的 mediaType 字段（OCI manifest 中该字段可选）
+func ParseManifest(data []byte, contentType string) (*ImageManifest, error) {
+	var m ImageManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if ct := normalizeMediaType(contentType); ct != "" && ct != "application/json" {
+		m.MediaType = ct
+	}
+	return &m, nil
+}
+
+// IsIndex 判断是否为多平台 manifest list / image index
+func (m *ImageManifest) IsIndex() bool {
+	return IsIndexMediaType(m.MediaType) || (m.MediaType == "" && len(m.Manifests) > 0)
+}
+
+// IsIndexMediaType 判断媒体类型是否为 manifest list / image index
+func IsIndexMediaType(mediaType string) bool {
+	mediaType = normalizeMediaType(mediaType)
+	return mediaType == MediaTypeDockerManifestList || mediaType == MediaTypeOCIIndex
+}
+
+// normalizeMediaType 去除 Content-Type 中的参数部分
+func normalizeMediaType(mediaType string) string {
+	if idx := strings.Index(mediaType, ";"); idx != -1 {
+		mediaType = mediaType[:idx]
+	}
+	return strings.TrimSpace(mediaType)
+}
+
+// MatchPlatform 判断平台是否匹配配置的平台列表
+// 配置项格式为 os/arch 或 os/arch/variant，未指定 variant 时匹配所有 variant
+func MatchPlatform(platform *ManifestPlatform, patterns []string) bool {
+	if platform == nil {
+		return false
+	}
+	for _, pattern := range patterns {
+		parts := strings.Split(pattern, "/")
+		if len(parts) < 2 {
+			continue
+		}
+		if parts[0] != platform.OS || parts[1] != platform.Architecture {
+			continue
+		}
+		if len(parts) >= 3 && parts[2] != platform.Variant {
+			continue
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+// =============================================================================
+// manifest HEAD - Docker 拉取镜像时先 HEAD 标签取得 digest，再 GET manifest。
+// HEAD 未命中时向上游发送 GET 并缓存完整内容（同时按 digest 缓存），随后的 GET 直接命中
+// =============================================================================
+
+// manifestHeadAsGet 返回以 GET 方法转发的请求副本
+func manifestHeadAsGet(r *http.Request) *http.Request {
+	get := r.WithContext(r.Context())
+	get.Method = http.MethodGet
+	return get
+}
+
+// headOnlyWriter 丢弃 body，以 GET 转发的 HEAD 请求只向客户端返回响应头
+type headOnlyWriter struct {
+	http.ResponseWriter
+}
+
+func (w headOnlyWriter) Write(p []byte) (int, error) { return len(p), nil }
+
+func (w headOnlyWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// cacheManifestByDigest 按标签拉取的 manifest 同时以 digest 引用缓存，
+// 客户端 HEAD 标签后按 digest GET 时直接命中。digest 必须与内容一致
+func (p *ProxyServer) cacheManifestByDigest(cacheKey, digest string, entry *cache.CacheEntry) {
+	pathType, _, reference := cache.ParsePath(cacheKey)
+	if pathType != "manifest" || strings.HasPrefix(reference, "sha256:") || !strings.HasPrefix(digest, "sha256:") {
+		return
+	}
+	sum := sha256.Sum256(entry.Data)
+	if digest != "sha256:"+hex.EncodeToString(sum[:]) {
+		return
+	}
+
+	digestKey := replaceLastPathSegment(cacheKey, digest)
+	byDigest := *entry
+	if ttl := p.cacheManager.TTLFor(digestKey, http.Header(entry.Headers)); ttl > 0 {
+		byDigest.ExpiresAt = entry.CachedAt.Add(ttl)
+	}
+	p.cacheManager.Put(digestKey, &byDigest)
+}
@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestManifestHeadPopulatesCacheForGet(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	digest, _ := upstream.addImage("team/app", "v1", []byte("layer"))
+	_, client := newTestProxy(t, upstream, nil)
+
+	client.login("team/app")
+	accept := http.Header{"Accept": {fakeManifestType}}
+	resp, body := client.do("HEAD", "/v2/team/app/manifests/v1", accept)
+	if resp.StatusCode != http.StatusOK || len(body) != 0 {
+		t.Fatalf("HEAD manifest: status %d, %d body bytes", resp.StatusCode, len(body))
+	}
+
+	// Docker 在 HEAD 标签之后按 digest GET，两者都应命中缓存
+	for _, reference := range []string{"v1", digest} {
+		path := "/v2/team/app/manifests/" + reference
+		eventually(t, "manifest cache fill "+reference, func() bool {
+			resp, _ := client.do("GET", path, accept)
+			return resp.Header.Get("X-Cache") == "HIT"
+		})
+		resp, body := client.do("GET", path, accept)
+		if fakeDigest(body) != digest {
+			t.Fatalf("GET %s: body digest %s, want %s", reference, fakeDigest(body), digest)
+		}
+		if got := upstream.count("GET", path) + upstream.count("HEAD", path); reference == "v1" && got != 1 {
+			t.Errorf("manifest %s requested from upstream %d times, want 1", reference, got)
+		}
+		if resp.Header.Get("X-Cache") != "HIT" {
+			t.Errorf("GET %s: X-Cache %q, want HIT", reference, resp.Header.Get("X-Cache"))
+		}
+	}
+	if got := upstream.count("GET", "/v2/team/app/manifests/"+digest); got != 0 {
+		t.Errorf("manifest fetched by digest from upstream %d times, want 0", got)
+	}
+}
+
+// TestPrefetchPlatformManifestsVerifiesDigest 预取的平台 manifest 与 index 中的 digest 不一致时不写入缓存
+func TestConcurrentManifestHeadAndGetCoalesce(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	digest, _ := upstream.addImage("team/app", "v1", []byte("layer"))
+	upstream.configure(func(f *fakeRegistry) { f.manifestDelay = 200 * time.Millisecond })
+	_, client := newTestProxy(t, upstream, nil)
+	client.login("team/app")
+
+	path := "/v2/team/app/manifests/v1"
+	methods := []string{"HEAD", "GET", "HEAD", "GET"}
+	errs := make(chan error, len(methods))
+	for _, method := range methods {
+		go func(method string) {
+			req, _ := http.NewRequest(method, client.base+path, nil)
+			req.Host = testRegistryHost
+			req.Header.Set("Accept", fakeManifestType)
+			req.Header.Set("Authorization", "Bearer "+client.token)
+			resp, err := client.http.Do(req)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+			switch {
+			case resp.StatusCode != http.StatusOK:
+				err = fmt.Errorf("%s: status %d", method, resp.StatusCode)
+			case resp.Header.Get("Docker-Content-Digest") != digest:
+				err = fmt.Errorf("%s: Docker-Content-Digest %q", method, resp.Header.Get("Docker-Content-Digest"))
+			case method == "GET" && fakeDigest(body) != digest:
+				err = fmt.Errorf("GET: body digest %s", fakeDigest(body))
+			}
+			errs <- err
+		}(method)
+	}
+	for range methods {
+		if err := <-errs; err != nil {
+			t.Error(err)
+		}
+	}
+
+	if got := upstream.count("GET", path) + upstream.count("HEAD", path); got != 1 {
+		t.Errorf("manifest requested from upstream %d times, want 1", got)
+	}
+}
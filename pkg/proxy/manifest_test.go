@@ -0,0 +1,52 @@
+package proxy
+
+import "testing"
+
+func TestParseManifestIndex(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		contentType string
+		index       bool
+	}{
+		{"oci index", `{"schemaVersion":2,"mediaType":"` + MediaTypeOCIIndex + `","manifests":[]}`, "", true},
+		{"docker list by content type", `{"schemaVersion":2,"manifests":[]}`, MediaTypeDockerManifestList + "; charset=utf-8", true},
+		{"index without media type", `{"schemaVersion":2,"manifests":[{"digest":"sha256:abc"}]}`, "application/json", true},
+		{"image manifest", `{"schemaVersion":2,"config":{"digest":"sha256:abc"},"layers":[]}`, MediaTypeOCIManifest, false},
+		{"content type overrides body", `{"schemaVersion":2,"mediaType":"` + MediaTypeOCIIndex + `"}`, MediaTypeDockerManifest, false},
+	}
+	for _, tt := range tests {
+		m, err := ParseManifest([]byte(tt.data), tt.contentType)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if m.IsIndex() != tt.index {
+			t.Errorf("%s: IsIndex = %v, want %v", tt.name, m.IsIndex(), tt.index)
+		}
+	}
+	if _, err := ParseManifest([]byte("not json"), MediaTypeOCIManifest); err == nil {
+		t.Error("ParseManifest accepted invalid JSON")
+	}
+}
+
+func TestMatchPlatform(t *testing.T) {
+	armv7 := &ManifestPlatform{OS: "linux", Architecture: "arm", Variant: "v7"}
+	tests := []struct {
+		platform *ManifestPlatform
+		patterns []string
+		want     bool
+	}{
+		{armv7, []string{"linux/arm"}, true},
+		{armv7, []string{"linux/arm/v7"}, true},
+		{armv7, []string{"linux/arm/v6"}, false},
+		{armv7, []string{"linux/amd64", "linux"}, false},
+		{&ManifestPlatform{OS: "windows", Architecture: "amd64"}, []string{"linux/amd64"}, false},
+		{nil, []string{"linux/amd64"}, false},
+	}
+	for _, tt := range tests {
+		if got := MatchPlatform(tt.platform, tt.patterns); got != tt.want {
+			t.Errorf("MatchPlatform(%s, %v) = %v, want %v", tt.platform, tt.patterns, got, tt.want)
+		}
+	}
+}
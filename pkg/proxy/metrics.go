@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// =============================================================================
+// Prometheus 指标 - 以文本格式输出，无需额外依赖
+// =============================================================================
+
+// metricsWriter 按 Prometheus 文本格式写指标，同名指标只输出一次 HELP / TYPE
+type metricsWriter struct {
+	w    io.Writer
+	seen map[string]bool
+}
+
+func (m *metricsWriter) gauge(name, help string, value float64, labels ...string) {
+	m.write(name, help, "gauge", value, labels)
+}
+
+func (m *metricsWriter) counter(name, help string, value float64, labels ...string) {
+	m.write(name, help, "counter", value, labels)
+}
+
+// write labels 为 key, value 交替的列表
+func (m *metricsWriter) write(name, help, kind string, value float64, labels []string) {
+	if !m.seen[name] {
+		m.seen[name] = true
+		fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(labels[i])
+			b.WriteString(`="`)
+			b.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(labels[i+1]))
+			b.WriteByte('"')
+		}
+		b.WriteByte('}')
+	}
+	fmt.Fprintf(m.w, "%s %s\n", b.String(), strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// handleMetrics 输出 Prometheus 指标
+func (p *ProxyServer) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m := &metricsWriter{w: w, seen: make(map[string]bool)}
+
+	m.gauge("docker_proxy_uptime_seconds", "Time since the proxy started", time.Since(startTime).Seconds())
+	build := GetBuildInfo()
+	m.gauge("docker_proxy_build_info", "Build information of the running binary", 1,
+		"version", build.Version, "commit", build.GitCommit, "go_version", build.GoVersion)
+
+	if p.cacheManager != nil {
+		stats := p.cacheManager.Statistics()
+		m.counter("docker_proxy_cache_hits_total", "Cache hits", float64(stats.BlobHits.Load()), "type", "blob")
+		m.counter("docker_proxy_cache_hits_total", "Cache hits", float64(stats.ManifestHits.Load()), "type", "manifest")
+		m.counter("docker_proxy_cache_misses_total", "Cache misses", float64(stats.BlobMisses.Load()), "type", "blob")
+		m.counter("docker_proxy_cache_misses_total", "Cache misses", float64(stats.ManifestMisses.Load()), "type", "manifest")
+		m.counter("docker_proxy_cache_verified_blobs_total", "Cached blobs whose digest was re-verified on read", float64(stats.BlobVerified.Load()))
+		m.counter("docker_proxy_cache_corrupted_blobs_total", "Cached blobs that failed digest verification and were evicted", float64(stats.BlobCorrupted.Load()))
+		m.gauge("docker_proxy_cache_size_bytes", "Total size of cached content", float64(stats.TotalSize.Load()))
+		for pattern, used := range p.cacheManager.QuotaUsage() {
+			m.gauge("docker_proxy_cache_quota_used_bytes", "Blob cache space used by repositories matching a quota", float64(used), "pattern", pattern)
+		}
+	}
+
+	p.cacheWrites.writeMetrics(m)
+	p.rateLimits.writeMetrics(m)
+	p.retryStats.writeMetrics(m)
+	p.chainStats.writeMetrics(m)
+	p.clientStats.writeMetrics(m)
+	p.maintenance.writeMetrics(m)
+	p.transport.sessions.writeMetrics(m)
+	p.transport.dialer.fallbacks.writeMetrics(m)
+	p.transport.dialer.poison.writeMetrics(m)
+	if p.upstreamHealth != nil {
+		p.upstreamHealth.writeMetrics(m)
+	}
+	if p.cluster != nil {
+		p.cluster.writeMetrics(m)
+	}
+}
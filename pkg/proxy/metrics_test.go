@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// scrapeMetrics 读取 /metrics，返回 {指标名}{标签} -> 值，并检查 HELP 只出现一次
+func scrapeMetrics(t *testing.T, client *testClient) map[string]float64 {
+	t.Helper()
+	resp, body := client.do("GET", "/metrics", nil)
+	if resp.StatusCode != 200 || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Fatalf("/metrics: status %d, Content-Type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	values := make(map[string]float64)
+	help := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if name, ok := strings.CutPrefix(line, "# HELP "); ok {
+			name, _, _ = strings.Cut(name, " ")
+			if help[name] {
+				t.Errorf("duplicate HELP for %s", name)
+			}
+			help[name] = true
+			continue
+		}
+		idx := strings.LastIndex(line, " ")
+		if strings.HasPrefix(line, "#") || idx == -1 {
+			continue
+		}
+		value, err := strconv.ParseFloat(line[idx+1:], 64)
+		if err != nil {
+			t.Errorf("invalid sample %q", line)
+		}
+		values[line[:idx]] = value
+	}
+	return values
+}
+
+func TestMetricsCacheCounters(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	_, layers := upstream.addImage("team/app", "v1", []byte("metrics layer"))
+	p, client := newTestProxy(t, upstream, nil)
+	client.login("team/app")
+	client.pull("team/app", "v1")
+	waitCached(t, p, "team/app", "v1", layers)
+	client.pull("team/app", "v1")
+
+	metrics := scrapeMetrics(t, client)
+	// 第二次拉取的 config 与层均命中缓存
+	if hits := metrics[`docker_proxy_cache_hits_total{type="blob"}`]; hits < 2 {
+		t.Errorf("blob cache hits = %v, want >= 2", hits)
+	}
+	if misses := metrics[`docker_proxy_cache_misses_total{type="blob"}`]; misses < 2 {
+		t.Errorf("blob cache misses = %v, want >= 2", misses)
+	}
+	if metrics["docker_proxy_cache_size_bytes"] <= 0 || metrics["docker_proxy_uptime_seconds"] <= 0 {
+		t.Errorf("cache size %v, uptime %v", metrics["docker_proxy_cache_size_bytes"], metrics["docker_proxy_uptime_seconds"])
+	}
+	found := false
+	for name := range metrics {
+		found = found || strings.HasPrefix(name, "docker_proxy_build_info{version=")
+	}
+	if !found {
+		t.Error("build info metric missing")
+	}
+}
+
+func TestMetricsWriterEscapesLabels(t *testing.T) {
+	var b strings.Builder
+	m := &metricsWriter{w: &b, seen: make(map[string]bool)}
+	m.counter("requests_total", "Requests", 1, "path", `a"b\c`)
+	m.counter("requests_total", "Requests", 2, "path", "d")
+
+	want := "# HELP requests_total Requests\n# TYPE requests_total counter\n" +
+		`requests_total{path="a\"b\\c"} 1` + "\n" + `requests_total{path="d"} 2` + "\n"
+	if b.String() != want {
+		t.Errorf("metrics output:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
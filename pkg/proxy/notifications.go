@@ -0,0 +1,352 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+// =============================================================================
+// 通知 Webhook - 兼容 docker/distribution 的事件格式
+// =============================================================================
+
+const (
+	// notificationMediaType distribution 事件信封的媒体类型
+	notificationMediaType = "application/vnd.docker.distribution.events.v1+json"
+	// notificationSignatureHeader HMAC-SHA256 签名头，值为 sha256=<hex>
+	notificationSignatureHeader = "X-Registry-Signature"
+	// notificationQueueSize 每个端点的事件队列长度，队列满时丢弃事件
+	notificationQueueSize = 1024
+
+	EventActionPull      = "pull"
+	EventActionPush      = "push"
+	EventActionCacheFill = "cache-fill"
+)
+
+// NotificationTarget 事件涉及的内容
+type NotificationTarget struct {
+	MediaType  string `json:"mediaType,omitempty"`
+	Size       int64  `json:"size,omitempty"`
+	Digest     string `json:"digest,omitempty"`
+	Length     int64  `json:"length,omitempty"`
+	Repository string `json:"repository"`
+	URL        string `json:"url,omitempty"`
+	Tag        string `json:"tag,omitempty"`
+}
+
+// NotificationRequest 触发事件的请求
+type NotificationRequest struct {
+	ID        string `json:"id,omitempty"`
+	Addr      string `json:"addr,omitempty"`
+	Host      string `json:"host,omitempty"`
+	Method    string `json:"method,omitempty"`
+	UserAgent string `json:"useragent,omitempty"`
+}
+
+// NotificationActor 发起请求的客户端身份
+type NotificationActor struct {
+	Name string `json:"name,omitempty"`
+}
+
+// NotificationSource 产生事件的代理节点
+type NotificationSource struct {
+	Addr       string `json:"addr,omitempty"`
+	InstanceID string `json:"instanceID,omitempty"`
+}
+
+// NotificationEvent 单个事件
+type NotificationEvent struct {
+	ID        string              `json:"id"`
+	Timestamp time.Time           `json:"timestamp"`
+	Action    string              `json:"action"`
+	Target    NotificationTarget  `json:"target"`
+	Request   NotificationRequest `json:"request,omitempty"`
+	Actor     NotificationActor   `json:"actor,omitempty"`
+	Source    NotificationSource  `json:"source"`
+}
+
+// notificationEnvelope 事件信封
+type notificationEnvelope struct {
+	Events []NotificationEvent `json:"events"`
+}
+
+// notificationEndpoint 单个 webhook 端点，独立队列与发送协程
+type notificationEndpoint struct {
+	url   string
+	queue chan NotificationEvent
+}
+
+// Notifier 将事件异步投递到所有配置的端点
+type Notifier struct {
+	endpoints []*notificationEndpoint
+	actions   map[string]bool
+	secret    []byte
+	retries   int
+	backoff   time.Duration
+	client    *http.Client
+	source    NotificationSource
+	debug     bool
+}
+
+// NotifyConfig 事件通知配置，Endpoints 为空时不启用
+type NotifyConfig struct {
+	Endpoints []string      // webhook URL
+	Actions   []string      // 需要发送的事件类型（为空时为 pull、push 与 cache-fill）
+	Secret    string        // HMAC-SHA256 签名密钥（可选）
+	Retries   int           // 失败重试次数（指数退避）
+	Timeout   time.Duration // 单次投递超时
+}
+
+// loadNotifyConfig 从环境变量读取通知配置
+//
+//	NOTIFY_ENDPOINTS  逗号分隔的 webhook URL
+//	NOTIFY_ACTIONS    需要发送的事件类型（默认 pull,push,cache-fill）
+//	NOTIFY_SECRET     HMAC-SHA256 签名密钥（可选）
+//	NOTIFY_RETRIES    失败重试次数（默认 3）
+//	NOTIFY_TIMEOUT    单次投递超时（默认 5s）
+func loadNotifyConfig() NotifyConfig {
+	retries := 3
+	if v := getEnv("NOTIFY_RETRIES", ""); v != "" {
+		if _, err := fmt.Sscanf(v, "%d", &retries); err != nil || retries < 0 {
+			retries = 3
+		}
+	}
+	return NotifyConfig{
+		Endpoints: getEnvList("NOTIFY_ENDPOINTS"),
+		Actions:   getEnvList("NOTIFY_ACTIONS"),
+		Secret:    getEnv("NOTIFY_SECRET", ""),
+		Retries:   retries,
+		Timeout:   parseDuration(getEnv("NOTIFY_TIMEOUT", "5s"), 5*time.Second),
+	}
+}
+
+// NewNotifier 创建通知器，未配置端点时返回 nil
+func NewNotifier(config NotifyConfig, listenAddr string, debug bool) *Notifier {
+	urls := config.Endpoints
+	if len(urls) == 0 {
+		return nil
+	}
+
+	actions := config.Actions
+	if len(actions) == 0 {
+		actions = []string{EventActionPull, EventActionPush, EventActionCacheFill}
+	}
+
+	hostname, _ := os.Hostname()
+	n := &Notifier{
+		actions: make(map[string]bool),
+		secret:  []byte(config.Secret),
+		retries: max(config.Retries, 0),
+		backoff: time.Second,
+		client: &http.Client{
+			// 独立的 Transport：不经过上游连接设置、维护模式暂停与 DNS 污染检查
+			Transport: http.DefaultTransport.(*http.Transport).Clone(),
+			Timeout:   config.Timeout,
+		},
+		source: NotificationSource{Addr: hostname + listenAddr, InstanceID: newEventID()},
+		debug:  debug,
+	}
+	for _, action := range actions {
+		n.actions[action] = true
+	}
+
+	for _, u := range urls {
+		ep := &notificationEndpoint{url: u, queue: make(chan NotificationEvent, notificationQueueSize)}
+		n.endpoints = append(n.endpoints, ep)
+		go n.run(ep)
+		log.Printf("Notification endpoint: %s (actions: %s)", u, strings.Join(actions, ","))
+	}
+	return n
+}
+
+// Notify 投递事件（非阻塞），nil 通知器或未订阅的事件类型直接忽略
+func (n *Notifier) Notify(event NotificationEvent) {
+	if n == nil || !n.actions[event.Action] {
+		return
+	}
+
+	event.ID = newEventID()
+	event.Timestamp = time.Now().UTC()
+	event.Source = n.source
+
+	for _, ep := range n.endpoints {
+		select {
+		case ep.queue <- event:
+		default:
+			log.Printf("Notification queue full for %s, dropping %s event for %s", ep.url, event.Action, event.Target.Repository)
+		}
+	}
+}
+
+// run 按顺序发送端点队列中的事件
+func (n *Notifier) run(ep *notificationEndpoint) {
+	for event := range ep.queue {
+		body, err := json.Marshal(notificationEnvelope{Events: []NotificationEvent{event}})
+		if err != nil {
+			continue
+		}
+
+		backoff := n.backoff
+		for attempt := 0; ; attempt++ {
+			err = n.send(ep.url, body)
+			if err == nil {
+				break
+			}
+			if attempt >= n.retries {
+				log.Printf("Notification to %s failed after %d attempts: %v", ep.url, attempt+1, err)
+				break
+			}
+			if n.debug {
+				log.Printf("[DEBUG] Notification to %s failed (attempt %d): %v", ep.url, attempt+1, err)
+			}
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+}
+
+func (n *Notifier) send(endpoint string, body []byte) error {
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", notificationMediaType)
+	if len(n.secret) > 0 {
+		mac := hmac.New(sha256.New, n.secret)
+		mac.Write(body)
+		req.Header.Set(notificationSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// newEventID 生成随机事件 ID
+func newEventID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// notificationTarget 从请求路径 / 缓存键构建事件目标
+func notificationTarget(host, path string) (NotificationTarget, bool) {
+	pathType, repo, reference := cache.ParsePath(path)
+	if pathType != "manifest" && pathType != "blob" {
+		return NotificationTarget{}, false
+	}
+
+	target := NotificationTarget{Repository: repo}
+	if strings.HasPrefix(reference, "sha256:") {
+		target.Digest = reference
+	} else {
+		target.Tag = reference
+	}
+	if host != "" {
+		target.URL = "https://" + host + path[strings.Index(path, "/v2/"):]
+	}
+	return target, true
+}
+
+// notifyMiddleware 记录响应状态，请求完成后发送 pull / push 事件
+func (p *ProxyServer) notifyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+		p.notifyRequest(r, ww)
+	})
+}
+
+// notifyRequest 根据已完成的客户端请求发送 pull / push 事件
+func (p *ProxyServer) notifyRequest(r *http.Request, ww middleware.WrapResponseWriter) {
+	var action string
+	switch {
+	case r.Method == "GET" && ww.Status() == http.StatusOK:
+		action = EventActionPull
+	case r.Method == "PUT" && ww.Status() == http.StatusCreated:
+		action = EventActionPush
+	default:
+		return
+	}
+
+	target, ok := notificationTarget(r.Host, r.URL.Path)
+	if !ok {
+		return
+	}
+	header := ww.Header()
+	if digest := header.Get("Docker-Content-Digest"); digest != "" {
+		target.Digest = digest
+	}
+	target.MediaType = header.Get("Content-Type")
+	target.Size = int64(ww.BytesWritten())
+	target.Length = target.Size
+
+	id := clientIdentityOf(r)
+
+	p.notifier.Notify(NotificationEvent{
+		Action: action,
+		Target: target,
+		Request: NotificationRequest{
+			ID:        middleware.GetReqID(r.Context()),
+			Addr:      id.IP,
+			Host:      r.Host,
+			Method:    r.Method,
+			UserAgent: r.UserAgent(),
+		},
+		Actor: NotificationActor{Name: actorName(id)},
+	})
+}
+
+// actorName 事件的操作者：认证用户名，或已验证的客户端证书（cert:CN）
+func actorName(id *ClientIdentity) string {
+	if kind := id.Kind(); kind == IdentityIP {
+		return ""
+	}
+	return id.String()
+}
+
+// notifyCacheFill 内容写入缓存后发送 cache-fill 事件
+func (p *ProxyServer) notifyCacheFill(cacheKey string, entry *cache.CacheEntry) {
+	if p.notifier == nil {
+		return
+	}
+
+	idx := strings.Index(cacheKey, "/v2/")
+	if idx == -1 {
+		return
+	}
+	target, ok := notificationTarget(cacheKey[:idx], cacheKey[idx:])
+	if !ok {
+		return
+	}
+	if entry.Descriptor.Digest != "" {
+		target.Digest = entry.Descriptor.Digest
+	} else if values := entry.Headers["Docker-Content-Digest"]; len(values) > 0 {
+		target.Digest = values[0]
+	}
+	target.MediaType = entry.Descriptor.MediaType
+	target.Size = entry.Descriptor.Size
+	target.Length = entry.Descriptor.Size
+
+	p.notifier.Notify(NotificationEvent{Action: EventActionCacheFill, Target: target})
+}
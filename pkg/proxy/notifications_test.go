@@ -0,0 +1,143 @@
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// webhookRecorder 记录收到的事件，前 failures 次请求返回 500
+type webhookRecorder struct {
+	mu       sync.Mutex
+	failures int
+	attempts int
+	events   []NotificationEvent
+	badSig   int
+}
+
+func newWebhookRecorder(t *testing.T, secret string, failures int) (*webhookRecorder, string) {
+	rec := &webhookRecorder{failures: failures}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+
+		rec.attempts++
+		if rec.attempts <= rec.failures {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		if r.Header.Get(notificationSignatureHeader) != "sha256="+hex.EncodeToString(mac.Sum(nil)) ||
+			r.Header.Get("Content-Type") != notificationMediaType {
+			rec.badSig++
+		}
+		var envelope notificationEnvelope
+		json.Unmarshal(body, &envelope)
+		rec.events = append(rec.events, envelope.Events...)
+	}))
+	t.Cleanup(server.Close)
+	return rec, server.URL
+}
+
+// find 返回第一个满足条件的事件
+func (rec *webhookRecorder) find(match func(NotificationEvent) bool) (NotificationEvent, bool) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	for _, event := range rec.events {
+		if match(event) {
+			return event, true
+		}
+	}
+	return NotificationEvent{}, false
+}
+
+func TestNotificationsForPullAndCacheFill(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	manifestDigest, layers := upstream.addImage("team/app", "v1", []byte("layer"))
+	rec, endpoint := newWebhookRecorder(t, "webhook-secret", 0)
+	_, client := newTestProxy(t, upstream, map[string]string{
+		"NOTIFY_ENDPOINTS": endpoint,
+		"NOTIFY_SECRET":    "webhook-secret",
+		"NOTIFY_ACTIONS":   "pull,cache-fill",
+	})
+	client.login("team/app")
+	client.pull("team/app", "v1")
+
+	var pull NotificationEvent
+	eventually(t, "manifest pull event", func() bool {
+		var ok bool
+		pull, ok = rec.find(func(e NotificationEvent) bool {
+			return e.Action == EventActionPull && e.Target.Tag == "v1"
+		})
+		return ok
+	})
+	if pull.Target.Repository != "team/app" || pull.Target.Digest != manifestDigest || pull.Target.Size == 0 {
+		t.Errorf("pull event target = %+v", pull.Target)
+	}
+	eventually(t, "blob cache-fill event", func() bool {
+		_, ok := rec.find(func(e NotificationEvent) bool {
+			return e.Action == EventActionCacheFill && e.Target.Digest == layers[0]
+		})
+		return ok
+	})
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.badSig > 0 {
+		t.Errorf("%d deliveries had a wrong signature or content type", rec.badSig)
+	}
+}
+
+func TestNotificationRetries(t *testing.T) {
+	rec, endpoint := newWebhookRecorder(t, "", 2)
+	n := NewNotifier(NotifyConfig{Endpoints: []string{endpoint}, Retries: 2, Timeout: 5 * time.Second}, ":5000", false)
+	n.backoff = 10 * time.Millisecond
+
+	// 未订阅的事件类型不投递；失败两次后第三次投递成功
+	n.Notify(NotificationEvent{Action: "delete", Target: NotificationTarget{Repository: "team/app"}})
+	n.Notify(NotificationEvent{Action: EventActionPush, Target: NotificationTarget{Repository: "team/app", Tag: "v1"}})
+	eventually(t, "push event after retries", func() bool {
+		_, ok := rec.find(func(e NotificationEvent) bool { return e.Action == EventActionPush })
+		return ok
+	})
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if rec.attempts != 3 || len(rec.events) != 1 {
+		t.Errorf("attempts = %d, events = %d; want 3 attempts and 1 event", rec.attempts, len(rec.events))
+	}
+}
+
+// TestNotificationsDuringMaintenance 通知使用独立的 HTTP 客户端，维护模式暂停上游连接时仍能投递
+func TestNotificationsDuringMaintenance(t *testing.T) {
+	var deliveries atomic.Int64
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deliveries.Add(1)
+	}))
+	t.Cleanup(webhook.Close)
+	upstream := newFakeRegistry(t)
+	_, layers := upstream.addImage("team/app", "v1", []byte("cached layer"))
+	p, client := newTestProxy(t, upstream, map[string]string{
+		"NOTIFY_ENDPOINTS": webhook.URL,
+		"NOTIFY_ACTIONS":   EventActionPull,
+	})
+	client.login("team/app")
+	client.pull("team/app", "v1")
+	waitCached(t, p, "team/app", "v1", layers)
+	eventually(t, "pull notification", func() bool { return deliveries.Load() > 0 })
+
+	p.transport.paused.Store(true)
+	before := deliveries.Load()
+	client.pull("team/app", "v1")
+	eventually(t, "pull notification while upstream connections are paused", func() bool { return deliveries.Load() > before })
+}
@@ -0,0 +1,183 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// =============================================================================
+// 并行分块下载 - 大 blob 以多个并发 Range 请求拉取，按顺序重组并校验 sha256
+// =============================================================================
+
+// chunkResult 单个分块的下载结果
+type chunkResult struct {
+	data []byte
+	err  error
+}
+
+// parallelBody 按顺序输出并发下载的分块
+// 同时在内存中的分块数不超过并发数（下载槽位在分块被读取后释放）
+type parallelBody struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	results []chan chunkResult
+	slots   chan struct{}
+	current []byte
+	index   int
+
+	digest string
+	hash   hash.Hash
+}
+
+// wrapParallel 对支持 Range 的大 blob 响应启用并行分块下载
+// 第一个分块直接读取原响应体，其余分块并发发起 Range 请求
+func (p *ProxyServer) wrapParallel(req *http.Request, resp *http.Response, digest string) bool {
+	cfg := p.config
+	if cfg.ParallelChunks <= 1 || req.Method != "GET" || resp.StatusCode != http.StatusOK ||
+		resp.ContentLength < cfg.ParallelMinSize || req.Header.Get("Range") != "" ||
+		!strings.EqualFold(resp.Header.Get("Accept-Ranges"), "bytes") {
+		return false
+	}
+	if !strings.HasPrefix(digest, "sha256:") {
+		digest = ""
+	}
+
+	total := resp.ContentLength
+	chunkSize := cfg.ParallelChunkSize
+	count := int((total + chunkSize - 1) / chunkSize)
+
+	ctx, cancel := context.WithCancel(req.Context())
+	body := &parallelBody{
+		ctx:     ctx,
+		cancel:  cancel,
+		results: make([]chan chunkResult, count),
+		slots:   make(chan struct{}, cfg.ParallelChunks),
+		digest:  digest,
+		hash:    sha256.New(),
+	}
+	for i := range body.results {
+		body.results[i] = make(chan chunkResult, 1)
+	}
+
+	first := resp.Body
+	context.AfterFunc(ctx, func() { first.Close() })
+	go func() {
+		for i := 0; i < count; i++ {
+			select {
+			case body.slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+
+			start := int64(i) * chunkSize
+			end := start + chunkSize
+			if end > total {
+				end = total
+			}
+			if i == 0 {
+				go func() {
+					data := make([]byte, end-start)
+					_, err := io.ReadFull(first, data)
+					if err != nil {
+						// 原响应体读取失败，改用 Range 请求获取第一个分块
+						data, err = p.fetchChunk(ctx, req, start, end)
+					}
+					body.results[0] <- chunkResult{data: data, err: err}
+				}()
+				continue
+			}
+			go func(i int, start, end int64) {
+				data, err := p.fetchChunk(ctx, req, start, end)
+				body.results[i] <- chunkResult{data: data, err: err}
+			}(i, start, end)
+		}
+	}()
+
+	if p.config.Debug {
+		log.Printf("[DEBUG] Parallel download %s: %d bytes in %d chunks", req.URL.Path, total, count)
+	}
+	resp.Body = body
+	return true
+}
+
+// fetchChunk 下载 [start, end) 区间，失败时按 UPSTREAM_RESUME_RETRIES 重试
+func (p *ProxyServer) fetchChunk(ctx context.Context, origReq *http.Request, start, end int64) ([]byte, error) {
+	var lastErr error
+	for attempt := 0; attempt <= p.config.ResumeRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(time.Duration(attempt) * time.Second):
+			}
+		}
+
+		req := origReq.Clone(ctx)
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+		resp, err := p.transport.RoundTrip(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if resp.StatusCode != http.StatusPartialContent ||
+			!strings.HasPrefix(resp.Header.Get("Content-Range"), fmt.Sprintf("bytes %d-", start)) {
+			resp.Body.Close()
+			return nil, fmt.Errorf("upstream ignored range request (status %d)", resp.StatusCode)
+		}
+
+		data := make([]byte, end-start)
+		_, err = io.ReadFull(resp.Body, data)
+		resp.Body.Close()
+		if err == nil {
+			return data, nil
+		}
+		lastErr = err
+	}
+	return nil, fmt.Errorf("chunk %d-%d failed: %w", start, end-1, lastErr)
+}
+
+func (b *parallelBody) Read(buf []byte) (int, error) {
+	for len(b.current) == 0 {
+		if b.index >= len(b.results) {
+			if b.digest != "" {
+				if actual := "sha256:" + hex.EncodeToString(b.hash.Sum(nil)); actual != b.digest {
+					return 0, fmt.Errorf("digest mismatch: expected %s, got %s", b.digest, actual)
+				}
+			}
+			return 0, io.EOF
+		}
+
+		select {
+		case result := <-b.results[b.index]:
+			if result.err != nil {
+				b.cancel()
+				return 0, result.err
+			}
+			b.current = result.data
+			b.hash.Write(result.data)
+			b.index++
+			<-b.slots
+		case <-b.ctx.Done():
+			return 0, b.ctx.Err()
+		}
+	}
+
+	n := copy(buf, b.current)
+	b.current = b.current[n:]
+	return n, nil
+}
+
+func (b *parallelBody) Close() error {
+	b.cancel()
+	return nil
+}
@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func TestParallelChunkedDownload(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	layer := make([]byte, 100<<10)
+	for i := range layer {
+		layer[i] = byte(i * 7)
+	}
+	small := bytes.Repeat([]byte("small"), 1000)
+	_, layers := upstream.addImage("team/app", "v1", layer, small)
+	p, client := newTestProxy(t, upstream, map[string]string{
+		"PARALLEL_DOWNLOAD_CHUNKS":     "3",
+		"PARALLEL_DOWNLOAD_CHUNK_SIZE": "32KB",
+		"PARALLEL_DOWNLOAD_MIN_SIZE":   "64KB",
+	})
+	client.login("team/app")
+
+	resp, body := client.do("GET", "/v2/team/app/blobs/"+layers[0], nil)
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, layer) {
+		t.Fatalf("status %d, received %d/%d bytes intact=%v", resp.StatusCode, len(body), len(layer), bytes.Equal(body, layer))
+	}
+
+	// 第一个分块来自原响应，其余分块各发起一次 Range 请求
+	var want []string
+	for start := 32 << 10; start < len(layer); start += 32 << 10 {
+		want = append(want, fmt.Sprintf("bytes=%d-%d", start, min(start+32<<10, len(layer))-1))
+	}
+	ranges := upstream.rangeRequests()
+	slices.Sort(ranges)
+	if !slices.Equal(ranges, want) {
+		t.Errorf("upstream Range requests %q, want %q", ranges, want)
+	}
+	eventually(t, "blob cache fill", func() bool { return blobCached(p, "team/app", layers[0]) })
+
+	// 小于 PARALLEL_DOWNLOAD_MIN_SIZE 的 blob 不分块
+	if resp, body := client.do("GET", "/v2/team/app/blobs/"+layers[1], nil); resp.StatusCode != http.StatusOK || !bytes.Equal(body, small) {
+		t.Fatalf("small blob: status %d", resp.StatusCode)
+	}
+	if n := len(upstream.rangeRequests()); n != len(want) {
+		t.Errorf("small blob issued %d Range requests", n-len(want))
+	}
+}
@@ -0,0 +1,124 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+)
+
+// =============================================================================
+// 平台过滤 - 不缓存集群不使用的平台的 blob
+// =============================================================================
+
+const (
+	// platformFilterSize 记录的 manifest / blob digest 最大数量
+	platformFilterSize = 100000
+	// platformFilterTTL 记录的有效期，过期后重新通过 index 学习
+	platformFilterTTL = 7 * 24 * time.Hour
+)
+
+// PlatformFilter 通过解析已缓存的 image index 学习各 manifest 所属平台，
+// 进而判断某个 blob 是否只属于被排除的平台
+type PlatformFilter struct {
+	platforms []string // 排除的平台列表 (os/arch[/variant])
+
+	skippedManifests *expirable.LRU[string, string]   // manifest digest -> 平台
+	skippedBlobs     *expirable.LRU[string, struct{}] // 仅属于排除平台的 blob
+	keptBlobs        *expirable.LRU[string, struct{}] // 被保留平台引用过的 blob
+
+	skipped atomic.Int64
+}
+
+// NewPlatformFilter 创建平台过滤器，platforms 为空时返回 nil（不过滤）
+func NewPlatformFilter(platforms []string) *PlatformFilter {
+	if len(platforms) == 0 {
+		return nil
+	}
+	return &PlatformFilter{
+		platforms:        platforms,
+		skippedManifests: expirable.NewLRU[string, string](platformFilterSize, nil, platformFilterTTL),
+		skippedBlobs:     expirable.NewLRU[string, struct{}](platformFilterSize, nil, platformFilterTTL),
+		keptBlobs:        expirable.NewLRU[string, struct{}](platformFilterSize, nil, platformFilterTTL),
+	}
+}
+
+// ObserveManifest 在 manifest 写入缓存时调用
+//   - index：记录属于排除平台的子 manifest digest
+//   - 单平台 manifest：根据自身 digest 是否被排除，登记其 config 和 layers
+func (f *PlatformFilter) ObserveManifest(digest string, data []byte, contentType string) {
+	if f == nil {
+		return
+	}
+
+	manifest, err := ParseManifest(data, contentType)
+	if err != nil {
+		return
+	}
+
+	if manifest.IsIndex() {
+		for _, desc := range manifest.Manifests {
+			if desc.Digest != "" && MatchPlatform(desc.Platform, f.platforms) {
+				f.skippedManifests.Add(desc.Digest, desc.Platform.String())
+			}
+		}
+		return
+	}
+
+	if digest == "" {
+		hash := sha256.Sum256(data)
+		digest = "sha256:" + hex.EncodeToString(hash[:])
+	}
+
+	blobs := make([]string, 0, len(manifest.Layers)+1)
+	if manifest.Config != nil && manifest.Config.Digest != "" {
+		blobs = append(blobs, manifest.Config.Digest)
+	}
+	for _, layer := range manifest.Layers {
+		if layer.Digest != "" {
+			blobs = append(blobs, layer.Digest)
+		}
+	}
+
+	if _, skipped := f.skippedManifests.Get(digest); skipped {
+		for _, blob := range blobs {
+			// 已被保留平台引用的 blob（如共享 layer）不能跳过
+			if !f.keptBlobs.Contains(blob) {
+				f.skippedBlobs.Add(blob, struct{}{})
+			}
+		}
+		return
+	}
+
+	for _, blob := range blobs {
+		f.keptBlobs.Add(blob, struct{}{})
+		f.skippedBlobs.Remove(blob)
+	}
+}
+
+// SkipBlob 判断 blob 是否应跳过缓存（仍然会流式传输给客户端）
+func (f *PlatformFilter) SkipBlob(digest string) bool {
+	if f == nil || digest == "" {
+		return false
+	}
+	if f.skippedBlobs.Contains(digest) {
+		f.skipped.Add(1)
+		return true
+	}
+	return false
+}
+
+// Stats 获取统计信息
+func (f *PlatformFilter) Stats() map[string]interface{} {
+	if f == nil {
+		return nil
+	}
+	return map[string]interface{}{
+		"platforms":        f.platforms,
+		"skippedManifests": f.skippedManifests.Len(),
+		"skippedBlobs":     f.skippedBlobs.Len(),
+		"skippedFills":     f.skipped.Load(),
+	}
+}
@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+func TestSkipPlatformBlobs(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	shared := []byte("shared layer")
+	linux, linuxLayers := upstream.addImage("team/app", "linux", shared, []byte("linux layer"))
+	windows, windowsLayers := upstream.addImage("team/app", "windows", shared, []byte("windows layer"))
+	upstream.addIndex("team/app", "multi", map[string]string{"linux/amd64": linux, "windows/amd64": windows})
+	p, client := newTestProxy(t, upstream, map[string]string{"CACHE_SKIP_PLATFORMS": "windows/amd64"})
+	client.login("team/app")
+
+	manifestCached := func(reference string) func() bool {
+		return func() bool {
+			_, found := p.cacheManager.Get(cache.CacheKey(testRegistryHost, "/v2/team/app/manifests/"+reference))
+			return found
+		}
+	}
+	blobCached := func(digest string) bool {
+		return p.cacheManager.HasBlob(cache.CacheKey(testRegistryHost, "/v2/team/app/blobs/"+digest))
+	}
+
+	// 平台归属通过经过代理的 index 学习
+	if resp, _ := client.do("GET", "/v2/team/app/manifests/multi", http.Header{"Accept": {fakeIndexType}}); resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET index: status %d", resp.StatusCode)
+	}
+	eventually(t, "index cache fill", manifestCached("multi"))
+	client.pull("team/app", linux)
+	eventually(t, "linux manifest cache fill", manifestCached(linux))
+	client.pull("team/app", windows)
+	eventually(t, "windows manifest cache fill", manifestCached(windows))
+
+	// 排除平台独有的 blob 照常传输但不缓存，与保留平台共享的 blob 仍缓存
+	resp, body := client.do("GET", "/v2/team/app/blobs/"+windowsLayers[1], nil)
+	if resp.StatusCode != http.StatusOK || fakeDigest(body) != windowsLayers[1] || resp.Header.Get("X-Cache") != "BYPASS" {
+		t.Fatalf("windows-only blob: status %d, X-Cache %q", resp.StatusCode, resp.Header.Get("X-Cache"))
+	}
+	for _, digest := range linuxLayers {
+		eventually(t, "linux blob cache fill", func() bool { return blobCached(digest) })
+	}
+	if blobCached(windowsLayers[1]) {
+		t.Error("blob used only by an excluded platform was cached")
+	}
+	if p.platformFilter.SkipBlob(windowsLayers[0]) {
+		t.Error("layer shared with a kept platform is skipped")
+	}
+}
@@ -0,0 +1,305 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+// =============================================================================
+// 响应策略拦截 - 在写出 manifest / blob 响应前执行策略检查
+// =============================================================================
+
+// guardBodyLimit 需要检查内容时最多缓冲的 manifest 大小，超过后放行
+const guardBodyLimit = 4 * 1024 * 1024
+
+// errPolicyDenied 响应被策略拒绝后继续写入原响应体时返回，使上游复制（与缓存写入）尽早中止
+var errPolicyDenied = errors.New("response denied by policy")
+
+// policyViolation 策略拒绝时返回给客户端的错误
+type policyViolation struct {
+	status  int
+	code    string
+	message string
+}
+
+// deniedViolation 403 DENIED
+func deniedViolation(message string) *policyViolation {
+	return &policyViolation{status: http.StatusForbidden, code: "DENIED", message: message}
+}
+
+// manifestPolicyCheck 按 manifest digest 检查，denied=true 时以 403 DENIED 拒绝
+type manifestPolicyCheck func(r *http.Request, digest string) (message string, denied bool)
+
+// guardCheck 根据响应头检查
+type guardCheck func(r *http.Request, header http.Header) *policyViolation
+
+// guardBodyCheck 根据完整的 manifest 内容检查（仅 GET）
+type guardBodyCheck func(r *http.Request, header http.Header, body []byte) *policyViolation
+
+// digestGuardCheck 将按 digest 的 manifest 检查适配为响应头检查，只用于不返回内容的 HEAD；
+// GET 由 manifestDigestCheck 按实际返回的内容检查
+func digestGuardCheck(check manifestPolicyCheck) guardCheck {
+	return func(r *http.Request, header http.Header) *policyViolation {
+		if r.Method == "GET" {
+			return nil
+		}
+		digest := header.Get("Docker-Content-Digest")
+		if _, _, reference := cache.ParsePath(r.URL.Path); isDigestReference(reference) && reference != digest {
+			return digestMismatch(reference, digest)
+		}
+		if message, denied := check(r, digest); denied {
+			return deniedViolation(message)
+		}
+		return nil
+	}
+}
+
+// manifestDigestCheck 将按 digest 的 manifest 检查适配为内容检查：digest 由返回给客户端的内容计算，
+// 与请求的 digest 或上游的 Docker-Content-Digest 不一致时拒绝，避免以其他 manifest 的 digest 掩护未经检查的内容
+func manifestDigestCheck(check manifestPolicyCheck) guardBodyCheck {
+	return func(r *http.Request, header http.Header, body []byte) *policyViolation {
+		digest := digestOf(body)
+		if _, _, reference := cache.ParsePath(r.URL.Path); isDigestReference(reference) && reference != digest {
+			return digestMismatch(reference, digest)
+		}
+		if claimed := header.Get("Docker-Content-Digest"); claimed != "" && claimed != digest {
+			return digestMismatch(claimed, digest)
+		}
+		if message, denied := check(r, digest); denied {
+			return deniedViolation(message)
+		}
+		return nil
+	}
+}
+
+func digestMismatch(expected, actual string) *policyViolation {
+	return deniedViolation(fmt.Sprintf("manifest digest mismatch: expected %s, got %s", expected, actual))
+}
+
+// isDigestReference manifest 引用是否为 digest（tag 不能包含冒号）
+func isDigestReference(reference string) bool {
+	return strings.Contains(reference, ":")
+}
+
+// guardChecks 返回某类路径已启用的策略检查
+func (p *ProxyServer) guardChecks(pathType string) ([]guardCheck, []guardBodyCheck) {
+	var checks []guardCheck
+	var bodyChecks []guardBodyCheck
+
+	switch pathType {
+	case "manifest":
+		if p.scanner != nil {
+			checks = append(checks, digestGuardCheck(p.scanPolicyCheck))
+			bodyChecks = append(bodyChecks, manifestDigestCheck(p.scanPolicyCheck))
+		}
+		if p.signatures != nil {
+			checks = append(checks, digestGuardCheck(p.signaturePolicyCheck))
+			bodyChecks = append(bodyChecks, manifestDigestCheck(p.signaturePolicyCheck))
+		}
+		if p.config.MaxImageSize > 0 {
+			bodyChecks = append(bodyChecks, p.imageSizeCheck)
+		}
+	case "blob":
+		if p.config.MaxBlobSize > 0 {
+			checks = append(checks, p.blobSizeCheck)
+		}
+	}
+	return checks, bodyChecks
+}
+
+// verifiesManifestDigest 是否有按 manifest digest 的检查，此时 GET 必须缓冲并校验完整内容
+func (p *ProxyServer) verifiesManifestDigest() bool {
+	return p.scanner != nil || p.signatures != nil
+}
+
+// hasGuardChecks 是否启用了任何响应策略检查
+func (p *ProxyServer) hasGuardChecks() bool {
+	for _, pathType := range []string{"manifest", "blob"} {
+		if checks, bodyChecks := p.guardChecks(pathType); len(checks)+len(bodyChecks) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// policyGuardMiddleware 包装 manifest / blob 请求的 ResponseWriter，
+// 无论响应来自缓存还是上游，都在写出 200 / 206 响应前执行检查
+func (p *ProxyServer) policyGuardMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pathType, _, _ := cache.ParsePath(r.URL.Path)
+		checks, bodyChecks := p.guardChecks(pathType)
+		if len(checks)+len(bodyChecks) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.Method != "GET" {
+			bodyChecks = nil
+		}
+		verifyDigest := pathType == "manifest" && r.Method == "GET" && p.verifiesManifestDigest()
+		if verifyDigest {
+			// 206 响应不经过检查，按 digest 检查的 manifest 总是返回完整内容
+			r.Header.Del("Range")
+		}
+
+		g := &policyGuardWriter{ResponseWriter: w, p: p, r: r, checks: checks, bodyChecks: bodyChecks, verifyDigest: verifyDigest}
+		if pathType == "blob" {
+			// 交给客户端的重定向同样检查目标大小；大小未知的响应在写出时计数
+			g.redirects = true
+			g.bodyLimit = p.config.MaxBlobSize
+		}
+		next.ServeHTTP(g, r)
+		g.finish()
+		if g.aborted {
+			// 响应头已经发出，只能中断连接，客户端不会把截断的内容当作完整的 blob
+			log.Printf("Aborted %s after %s: blob exceeds limit %s",
+				r.URL.Path, cache.FormatBytes(g.written), cache.FormatBytes(g.bodyLimit))
+			panic(http.ErrAbortHandler)
+		}
+	})
+}
+
+// policyGuardWriter 在 WriteHeader 时执行响应头检查；有内容检查时缓冲 manifest，请求结束后检查
+type policyGuardWriter struct {
+	http.ResponseWriter
+	p          *ProxyServer
+	r          *http.Request
+	checks     []guardCheck
+	bodyChecks []guardBodyCheck
+
+	verifyDigest bool  // 内容超过缓冲上限时拒绝而不是放行
+	redirects    bool  // 重定向响应同样执行响应头检查
+	bodyLimit    int64 // 写出的内容超过该大小时中断响应（0 不限制）
+
+	wroteHeader bool
+	status      int
+	denied      bool
+	aborted     bool // 写出途中超过 bodyLimit，请求结束后中断连接
+	written     int64
+	buffering   bool
+	buf         bytes.Buffer
+}
+
+func (g *policyGuardWriter) WriteHeader(statusCode int) {
+	if g.wroteHeader {
+		return
+	}
+	g.wroteHeader = true
+	g.status = statusCode
+
+	// 206 同样检查响应头（Range 请求不能绕过大小限制），内容检查只针对完整响应
+	if statusCode == http.StatusOK || statusCode == http.StatusPartialContent || (g.redirects && isRedirect(statusCode)) {
+		for _, check := range g.checks {
+			if v := check(g.r, g.Header()); v != nil {
+				g.deny(v)
+				return
+			}
+		}
+	}
+	if statusCode == http.StatusOK {
+		if len(g.bodyChecks) > 0 {
+			g.buffering = true
+			return
+		}
+	}
+	g.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (g *policyGuardWriter) Write(b []byte) (int, error) {
+	if !g.wroteHeader {
+		g.WriteHeader(http.StatusOK)
+	}
+	if g.denied {
+		return 0, errPolicyDenied
+	}
+	if g.bodyLimit > 0 && g.status == http.StatusOK {
+		if g.written+int64(len(b)) > g.bodyLimit {
+			g.denied, g.aborted = true, true
+			return 0, errPolicyDenied
+		}
+		g.written += int64(len(b))
+	}
+	if g.buffering {
+		if g.buf.Len()+len(b) <= guardBodyLimit {
+			return g.buf.Write(b)
+		}
+		if g.verifyDigest {
+			g.buffering = false
+			g.buf.Reset()
+			g.deny(deniedViolation(fmt.Sprintf("manifest exceeds %d bytes and cannot be verified", guardBodyLimit)))
+			return 0, errPolicyDenied
+		}
+		// 超过缓冲上限，放弃内容检查直接透传
+		g.flushBuffer()
+	}
+	return g.ResponseWriter.Write(b)
+}
+
+func (g *policyGuardWriter) Flush() {
+	if g.denied || g.buffering {
+		return
+	}
+	if f, ok := g.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// finish 请求处理结束后执行内容检查并写出缓冲的响应
+func (g *policyGuardWriter) finish() {
+	if !g.buffering {
+		return
+	}
+	for _, check := range g.bodyChecks {
+		if v := check(g.r, g.Header(), g.buf.Bytes()); v != nil {
+			g.buffering = false
+			g.deny(v)
+			return
+		}
+	}
+	g.flushBuffer()
+}
+
+func (g *policyGuardWriter) flushBuffer() {
+	g.buffering = false
+	g.ResponseWriter.WriteHeader(g.status)
+	if g.buf.Len() > 0 {
+		_, _ = g.ResponseWriter.Write(g.buf.Bytes())
+		g.buf.Reset()
+	}
+}
+
+func (g *policyGuardWriter) deny(v *policyViolation) {
+	g.denied = true
+	g.Header().Del("Content-Length")
+	g.Header().Del("Docker-Content-Digest")
+	g.Header().Del("Content-Range")
+	g.Header().Del("Location")
+	g.p.writeRegistryError(g.ResponseWriter, v.status, v.code, v.message)
+}
+
+// repositoryName 策略匹配使用的仓库名：{路由域名}/{仓库}
+func repositoryName(host, repo string) string {
+	if idx := strings.Index(host, ":"); idx != -1 {
+		host = host[:idx]
+	}
+	return host + "/" + repo
+}
+
+// matchRepository 仓库名匹配，模式以 * 结尾时按前缀匹配
+func matchRepository(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if pattern == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeCosignPolicy 写入对 registry.test/team/* 生效的公钥签名策略，返回 COSIGN_POLICY 路径与签名私钥
+func writeCosignPolicy(t *testing.T) (string, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "cosign.pub")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	policyFile := filepath.Join(dir, "policy.json")
+	policy := `[{"repositories": ["` + testRegistryHost + `/team/*"], "keys": ["` + keyFile + `"]}]`
+	if err := os.WriteFile(policyFile, []byte(policy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return policyFile, key
+}
+
+func TestSignaturePolicyChecksServedManifestDigest(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	signed, _ := upstream.addImage("team/app", "signed", []byte("signed layer"))
+	unsigned, _ := upstream.addImage("team/app", "unsigned", []byte("unsigned layer"))
+	pinned, _ := upstream.addImage("team/app", "pinned", []byte("pinned layer"))
+	policyFile, _ := writeCosignPolicy(t)
+	p, client := newTestProxy(t, upstream, map[string]string{"COSIGN_POLICY": policyFile})
+
+	// 视为已校验通过的签名结果
+	p.signatures.results.Add(testRegistryHost+"/team/app@"+signed, "")
+	p.signatures.results.Add(testRegistryHost+"/team/app@"+pinned, "")
+
+	client.login("team/app")
+	accept := http.Header{"Accept": {fakeManifestType}}
+	if resp, body := client.do("GET", "/v2/team/app/manifests/signed", accept); resp.StatusCode != http.StatusOK {
+		t.Fatalf("signed manifest: status %d: %s", resp.StatusCode, body)
+	}
+	if resp, _ := client.do("GET", "/v2/team/app/manifests/unsigned", accept); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("unsigned manifest: status %d, want 403", resp.StatusCode)
+	}
+
+	// 镜像源以已签名 manifest 的 digest 提供未签名的内容（按 tag 以及按 digest 请求）
+	upstream.configure(func(f *fakeRegistry) {
+		f.manifestDigest = signed
+		f.manifests["team/app:latest"] = f.manifests["team/app:unsigned"]
+		f.manifests["team/app:"+pinned] = f.manifests["team/app:unsigned"]
+	})
+	for _, reference := range []string{"latest", pinned} {
+		resp, body := client.do("GET", "/v2/team/app/manifests/"+reference, accept)
+		if resp.StatusCode != http.StatusForbidden || !strings.Contains(string(body), "digest mismatch") {
+			t.Errorf("spoofed manifest %s: status %d: %s", reference, resp.StatusCode, body)
+		}
+		if resp.Header.Get("Docker-Content-Digest") != "" {
+			t.Errorf("spoofed manifest %s: denied response carries Docker-Content-Digest", reference)
+		}
+	}
+
+	// Range 请求同样返回经过检查的完整内容
+	header := http.Header{"Accept": {fakeManifestType}, "Range": {"bytes=0-9"}}
+	if resp, _ := client.do("GET", "/v2/team/app/manifests/"+unsigned, header); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("ranged unsigned manifest: status %d, want 403", resp.StatusCode)
+	}
+}
+
+func TestScanPolicyChecksServedManifestDigest(t *testing.T) {
+	// 扫描器总是失败，拦截只取决于预置的扫描结果
+	scanner := filepath.Join(t.TempDir(), "trivy")
+	if err := os.WriteFile(scanner, []byte("#!/bin/sh\nexit 1\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	upstream := newFakeRegistry(t)
+	clean, _ := upstream.addImage("team/app", "clean", []byte("clean layer"))
+	vulnerable, _ := upstream.addImage("team/app", "vulnerable", []byte("vulnerable layer"))
+	p, client := newTestProxy(t, upstream, map[string]string{
+		"SCAN_ENABLED":        "true",
+		"SCAN_BINARY":         scanner,
+		"SCAN_BLOCK_SEVERITY": "HIGH",
+	})
+	p.scanner.results[clean] = &ScanResult{Digest: clean, Status: ScanStatusPassed}
+	p.scanner.results[vulnerable] = &ScanResult{Digest: vulnerable, Status: ScanStatusFailed, Counts: map[string]int{"CRITICAL": 1}}
+
+	client.login("team/app")
+	accept := http.Header{"Accept": {fakeManifestType}}
+	if resp, body := client.do("GET", "/v2/team/app/manifests/clean", accept); resp.StatusCode != http.StatusOK {
+		t.Fatalf("clean manifest: status %d: %s", resp.StatusCode, body)
+	}
+	if resp, _ := client.do("GET", "/v2/team/app/manifests/vulnerable", accept); resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("vulnerable manifest: status %d, want 403", resp.StatusCode)
+	}
+
+	// 镜像源以通过扫描的 digest 提供存在漏洞的内容
+	upstream.configure(func(f *fakeRegistry) {
+		f.manifestDigest = clean
+		f.manifests["team/app:latest"] = f.manifests["team/app:vulnerable"]
+	})
+	resp, body := client.do("GET", "/v2/team/app/manifests/latest", accept)
+	if resp.StatusCode != http.StatusForbidden || !strings.Contains(string(body), "digest mismatch") {
+		t.Errorf("spoofed manifest: status %d: %s", resp.StatusCode, body)
+	}
+}
@@ -0,0 +1,144 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+// =============================================================================
+// 多平台预取 - 缓存 manifest list 时预先拉取指定平台的 manifest
+// =============================================================================
+
+// prefetchTimeout 单个平台 manifest 预取的超时时间
+const prefetchTimeout = 30 * time.Second
+
+// prefetchPlatformManifests 解析已缓存的 manifest list / image index，
+// 对匹配 PREFETCH_PLATFORMS 的平台预先拉取并缓存其 manifest，
+// 使客户端紧接着的平台 manifest 请求直接命中缓存；ctx 取消（缓存关闭）时停止预取
+func (p *ProxyServer) prefetchPlatformManifests(ctx context.Context, cacheKey string, upstreamReq *http.Request, data []byte, contentType string) {
+	if len(p.config.PrefetchPlatforms) == 0 || upstreamReq == nil || p.cacheManager == nil {
+		return
+	}
+
+	manifest, err := ParseManifest(data, contentType)
+	if err != nil || !manifest.IsIndex() {
+		return
+	}
+
+	for _, desc := range manifest.Manifests {
+		if ctx.Err() != nil {
+			return
+		}
+		if desc.Digest == "" || !MatchPlatform(desc.Platform, p.config.PrefetchPlatforms) {
+			continue
+		}
+
+		platformKey := replaceLastPathSegment(cacheKey, desc.Digest)
+		if _, found := p.cacheManager.Get(platformKey); found {
+			continue
+		}
+
+		targetURL := *upstreamReq.URL
+		targetURL.Path = replaceLastPathSegment(targetURL.Path, desc.Digest)
+		targetURL.RawQuery = ""
+
+		if err := p.prefetchManifest(ctx, &targetURL, upstreamReq.Header, platformKey, desc.Digest); err != nil {
+			if p.config.Debug {
+				log.Printf("[DEBUG] Prefetch %s (%s) failed: %v", desc.Digest, desc.Platform, err)
+			}
+			continue
+		}
+		if p.config.Debug {
+			log.Printf("[DEBUG] Prefetched platform manifest %s (%s)", desc.Digest, desc.Platform)
+		}
+	}
+}
+
+// prefetchManifest 拉取单个 manifest，校验内容与 index 中的 digest 一致后写入缓存
+// 复用原始请求的 Authorization（客户端的 token 对同一仓库具有 pull 权限）
+func (p *ProxyServer) prefetchManifest(ctx context.Context, targetURL *url.URL, header http.Header, cacheKey, digest string) error {
+	ctx, cancel := context.WithTimeout(ctx, prefetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", targetURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	if auth := header.Get("Authorization"); auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	if accept := header.Values("Accept"); len(accept) > 0 {
+		req.Header["Accept"] = accept
+	} else {
+		req.Header.Set("Accept", strings.Join([]string{
+			MediaTypeOCIManifest, MediaTypeDockerManifest,
+		}, ", "))
+	}
+	p.setClientUserAgent(req, header.Get("User-Agent"))
+
+	resp, err := p.transport.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	p.rateLimits.observe(req, resp)
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected upstream status %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, p.config.CacheMaxBlobSize+1))
+	if err != nil {
+		return err
+	}
+	if len(body) == 0 || int64(len(body)) > p.config.CacheMaxBlobSize {
+		return fmt.Errorf("manifest size %d not cacheable", len(body))
+	}
+	if strings.HasPrefix(digest, "sha256:") && digestOf(body) != digest {
+		return fmt.Errorf("manifest digest mismatch: got %s", digestOf(body))
+	}
+
+	headers := make(map[string][]string)
+	for _, key := range []string{"Content-Type", "Docker-Content-Digest", "Etag"} {
+		if values := resp.Header.Values(key); len(values) > 0 {
+			headers[key] = values
+		}
+	}
+	headers["Content-Length"] = []string{strconv.Itoa(len(body))}
+
+	entry := &cache.CacheEntry{
+		Descriptor: cache.Descriptor{
+			Digest:    digest,
+			Size:      int64(len(body)),
+			MediaType: resp.Header.Get("Content-Type"),
+		},
+		Data:       body,
+		Headers:    headers,
+		StatusCode: resp.StatusCode,
+		CachedAt:   time.Now(),
+		ExpiresAt:  time.Now().Add(p.cacheManager.TTLFor(cacheKey, resp.Header)),
+	}
+	if err := p.cacheManager.Put(cacheKey, entry); err != nil {
+		return err
+	}
+	p.afterCacheFill(cacheKey, entry)
+	p.platformFilter.ObserveManifest(entry.Descriptor.Digest, body, entry.Descriptor.MediaType)
+	return nil
+}
+
+// replaceLastPathSegment 将路径最后一段替换为 segment
+func replaceLastPathSegment(path, segment string) string {
+	if idx := strings.LastIndex(path, "/"); idx != -1 {
+		return path[:idx+1] + segment
+	}
+	return segment
+}
@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+func TestPrefetchPlatformManifests(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	amd64, _ := upstream.addImage("team/app", "amd64", []byte("amd64 layer"))
+	arm64, _ := upstream.addImage("team/app", "arm64", []byte("arm64 layer"))
+	upstream.addIndex("team/app", "multi", map[string]string{"linux/amd64": amd64, "linux/arm64": arm64})
+	p, client := newTestProxy(t, upstream, map[string]string{"PREFETCH_PLATFORMS": "linux/arm64"})
+	client.login("team/app")
+
+	resp, body := client.do("GET", "/v2/team/app/manifests/multi", http.Header{"Accept": {fakeIndexType}})
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != fakeIndexType {
+		t.Fatalf("GET index: status %d, Content-Type %q: %s", resp.StatusCode, resp.Header.Get("Content-Type"), body)
+	}
+
+	// 只预取配置的平台
+	platformKey := func(digest string) string {
+		return cache.CacheKey(testRegistryHost, "/v2/team/app/manifests/"+digest)
+	}
+	eventually(t, "arm64 manifest prefetch", func() bool {
+		_, found := p.cacheManager.Get(platformKey(arm64))
+		return found
+	})
+	if _, found := p.cacheManager.Get(platformKey(amd64)); found {
+		t.Error("manifest of a platform not in PREFETCH_PLATFORMS was prefetched")
+	}
+
+	// 客户端随后的平台 manifest 请求直接命中缓存
+	resp, body = client.do("GET", "/v2/team/app/manifests/"+arm64, http.Header{"Accept": {fakeManifestType}})
+	if resp.StatusCode != http.StatusOK || fakeDigest(body) != arm64 {
+		t.Fatalf("GET arm64 manifest: status %d", resp.StatusCode)
+	}
+	if n := upstream.count("GET", "/v2/team/app/manifests/"+arm64); n != 1 {
+		t.Errorf("arm64 manifest fetched from upstream %d times, want 1 (prefetch only)", n)
+	}
+}
+
+func TestPrefetchPlatformManifestsVerifiesDigest(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	amd64, _ := upstream.addImage("team/app", "amd64", []byte("amd64 layer"))
+	arm64, _ := upstream.addImage("team/app", "arm64", []byte("arm64 layer"))
+	upstream.configure(func(f *fakeRegistry) {
+		f.manifests["team/app:"+arm64] = []byte(`{"schemaVersion":2,"tampered":true}`)
+	})
+	p, _ := newTestProxy(t, upstream, map[string]string{"PREFETCH_PLATFORMS": "linux/amd64,linux/arm64"})
+
+	index, _ := json.Marshal(ImageManifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeOCIIndex,
+		Manifests: []ManifestDescriptor{
+			{MediaType: MediaTypeOCIManifest, Digest: amd64, Platform: &ManifestPlatform{OS: "linux", Architecture: "amd64"}},
+			{MediaType: MediaTypeOCIManifest, Digest: arm64, Platform: &ManifestPlatform{OS: "linux", Architecture: "arm64"}},
+		},
+	})
+	req, _ := http.NewRequest("GET", upstream.server.URL+"/v2/team/app/manifests/latest", nil)
+	req.Header.Set("Authorization", "Bearer fake-token")
+	p.prefetchPlatformManifests(context.Background(), cache.CacheKey(testRegistryHost, "/v2/team/app/manifests/latest"), req, index, MediaTypeOCIIndex)
+
+	if entry, found := p.cacheManager.Get(cache.CacheKey(testRegistryHost, "/v2/team/app/manifests/"+amd64)); !found || entry.Descriptor.Digest != amd64 {
+		t.Errorf("amd64 manifest not prefetched")
+	}
+	if _, found := p.cacheManager.Get(cache.CacheKey(testRegistryHost, "/v2/team/app/manifests/"+arm64)); found {
+		t.Error("manifest with mismatched digest was cached")
+	}
+}
@@ -0,0 +1,173 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// =============================================================================
+// TLS 会话恢复与连接预热 - 上游 TLS 会话缓存让新连接通过会话票据恢复握手，省去证书链的传输与校验；
+// UPSTREAM_PREWARM 列出的上游在启动时及每个 UPSTREAM_PREWARM_INTERVAL 并发请求 GET /v2/，
+// 使连接池中保持 UPSTREAM_PREWARM_CONNS 条已完成握手的连接，冷启动后的首次拉取不必等待 TCP 与 TLS 握手
+// =============================================================================
+
+// upstreamIdleConnTimeout 上游空闲连接的保留时间，预热间隔必须小于该值才能让连接一直保持
+const upstreamIdleConnTimeout = 90 * time.Second
+
+// sessionCache 统计查找结果的 TLS 会话缓存，命中表示握手时提供了可恢复的会话
+type sessionCache struct {
+	tls.ClientSessionCache
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// newSessionCache size <= 0 时返回 nil（不启用会话恢复）
+func newSessionCache(size int) *sessionCache {
+	if size <= 0 {
+		return nil
+	}
+	return &sessionCache{ClientSessionCache: tls.NewLRUClientSessionCache(size)}
+}
+
+func (c *sessionCache) Get(sessionKey string) (*tls.ClientSessionState, bool) {
+	session, ok := c.ClientSessionCache.Get(sessionKey)
+	if ok {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+	return session, ok
+}
+
+// writeMetrics 输出会话缓存的命中与未命中次数
+func (c *sessionCache) writeMetrics(m *metricsWriter) {
+	if c == nil {
+		return
+	}
+	m.counter("docker_proxy_upstream_tls_session_cache_total", "Upstream TLS handshakes by session cache lookup (hit offers session resumption)", float64(c.hits.Load()), "result", "hit")
+	m.counter("docker_proxy_upstream_tls_session_cache_total", "Upstream TLS handshakes by session cache lookup (hit offers session resumption)", float64(c.misses.Load()), "result", "miss")
+}
+
+// connPrewarmer 定期向上游发起请求，保持连接池中的已握手连接
+type connPrewarmer struct {
+	p        *ProxyServer
+	hosts    []string // UPSTREAM_PREWARM 条目，* 表示所有路由、镜像与分流上游
+	conns    int      // 每个上游保持的连接数
+	interval time.Duration
+	timeout  time.Duration // 单次预热请求的超时
+}
+
+// newConnPrewarmer 未配置 UPSTREAM_PREWARM 时返回 nil
+func newConnPrewarmer(p *ProxyServer) *connPrewarmer {
+	config := p.config
+	if len(config.UpstreamPrewarm) == 0 || config.UpstreamPrewarmConns <= 0 {
+		return nil
+	}
+	w := &connPrewarmer{
+		p:        p,
+		hosts:    config.UpstreamPrewarm,
+		conns:    config.UpstreamPrewarmConns,
+		interval: config.UpstreamPrewarmInterval,
+		timeout:  config.UpstreamDial.DialTimeout + config.UpstreamDial.TLSHandshakeTimeout + 10*time.Second,
+	}
+	if w.interval <= 0 || w.interval >= upstreamIdleConnTimeout {
+		w.interval = upstreamIdleConnTimeout * 2 / 3
+		log.Printf("UPSTREAM_PREWARM_INTERVAL must be below the %s idle connection timeout, using %s", upstreamIdleConnTimeout, w.interval)
+	}
+	log.Printf("Upstream connection prewarming enabled: %d connections to %d upstreams every %s", w.conns, len(w.targets()), w.interval)
+	return w
+}
+
+// targets 需要预热的上游地址（去重排序），随热重载的路由变化
+func (w *connPrewarmer) targets() []string {
+	seen := make(map[string]bool)
+	for _, host := range w.hosts {
+		if host == "*" {
+			for _, upstream := range w.p.healthCheckUpstreams() {
+				seen[upstream] = true
+			}
+			continue
+		}
+		if !strings.HasPrefix(host, "http://") && !strings.HasPrefix(host, "https://") {
+			host = "https://" + host
+		}
+		seen[strings.TrimSuffix(host, "/")] = true
+	}
+	targets := make([]string, 0, len(seen))
+	for target := range seen {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// Run 立即预热一次，之后按间隔刷新，直到 ctx 结束
+func (w *connPrewarmer) Run(ctx context.Context) {
+	if w == nil {
+		return
+	}
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		w.warmAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *connPrewarmer) warmAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, target := range w.targets() {
+		wg.Add(1)
+		go func(target string) {
+			defer wg.Done()
+			w.warm(ctx, target)
+		}(target)
+	}
+	wg.Wait()
+}
+
+// warm 并发发起 conns 个请求，全部收到响应头后才读完响应体，使每个请求占用不同的连接；
+// 已有的空闲连接被复用并刷新空闲计时，不足时新建连接（HTTP/2 上游共用一条连接）
+func (w *connPrewarmer) warm(ctx context.Context, target string) {
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+
+	var received, done sync.WaitGroup
+	var failures atomic.Int32
+	received.Add(w.conns)
+	done.Add(w.conns)
+	for i := 0; i < w.conns; i++ {
+		go func() {
+			defer done.Done()
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, target+"/v2/", nil)
+			var resp *http.Response
+			if err == nil {
+				w.p.setUserAgent(req)
+				resp, err = w.p.transport.RoundTrip(req)
+			}
+			received.Done()
+			if err != nil {
+				if failures.Add(1) == 1 && w.p.config.Debug {
+					log.Printf("[DEBUG] Prewarming connection to %s failed: %v", target, err)
+				}
+				return
+			}
+			received.Wait()
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}()
+	}
+	done.Wait()
+}
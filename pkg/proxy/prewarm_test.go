@@ -0,0 +1,40 @@
+package proxy
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpstreamPrewarm(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	p, _ := newTestProxy(t, upstream, map[string]string{
+		"UPSTREAM_PREWARM":       "*",
+		"UPSTREAM_PREWARM_CONNS": "3",
+	})
+	addr := strings.TrimPrefix(upstream.server.URL, "http://")
+	dialed := func() int64 {
+		p.transport.dialer.conns.mu.Lock()
+		defer p.transport.dialer.conns.mu.Unlock()
+		return p.transport.dialer.conns.dialed[addr]
+	}
+
+	// 启动时预热：连接池中保持 3 条连接
+	eventually(t, "startup prewarming", func() bool { return upstream.count("GET", "/v2/") >= 3 })
+	if n := dialed(); n != 3 {
+		t.Fatalf("connections dialed by prewarming = %d, want 3", n)
+	}
+	// 上游收到请求后，启动预热还要读完响应体才把连接放回空闲池
+	time.Sleep(50 * time.Millisecond)
+
+	// 刷新复用已有的空闲连接，不新建连接
+	before := upstream.count("GET", "/v2/")
+	p.prewarmer.warmAll(context.Background())
+	if got := upstream.count("GET", "/v2/") - before; got != 3 {
+		t.Errorf("prewarm requests = %d, want 3", got)
+	}
+	if n := dialed(); n != 3 {
+		t.Errorf("connections dialed after refresh = %d, want 3 (idle connections reused)", n)
+	}
+}
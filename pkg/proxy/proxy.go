@@ -0,0 +1,2422 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+const (
+	// 默认最大可缓存的响应大小 (50MB)，超过此大小的响应将直接流式传输不缓存（CACHE_MAX_BLOB_SIZE）
+	maxCacheableSize = 50 * 1024 * 1024
+	// 流式传输缓冲区大小 (256KB)，适合大文件传输
+	streamBufferSize = 256 * 1024
+)
+
+type Config struct {
+	Port                string
+	CacheDir            string
+	CacheEnabled        bool          // 缓存开关
+	CacheManifestTTL    time.Duration // manifest by tag 缓存时间
+	CacheBlobTTL        time.Duration // blob 缓存时间 (不可变内容)
+	FollowAllRedirects  bool          // 跟随所有重定向（启用后可缓存外部存储内容）
+	Debug               bool
+	CustomDomain        string
+	Routes              map[string]string
+	BlockedHostPatterns []string      // 黑名单域名模式
+	DNSEnabled          bool          // 是否启用自定义DNS
+	DNSServers          []string      // DNS服务器列表
+	DNSTimeout          string        // DNS查询超时时间
+	PrefetchPlatforms   []string      // 缓存 manifest list 时预取的平台列表 (os/arch[/variant])
+	CacheSkipPlatforms  []string      // 不缓存其 blob 的平台列表 (os/arch[/variant])
+	AuthHtpasswd        string        // 客户端认证 htpasswd 文件路径（为空则不启用）
+	APITokensFile       string        // API token 定义文件（JSON）
+	APITokensEnabled    bool          // 是否启用 API token 认证与配额
+	AuthChallengeTTL    time.Duration // 上游认证挑战 (realm/service) 缓存时间
+	ScopeRewriteFile    string        // scope 重写规则文件（JSON）
+	TagPolicyFile       string        // tag 策略文件（JSON）
+	HeaderRulesFile     string        // 请求 / 响应头改写规则文件（JSON）
+	MaxBlobSize         int64         // 单个 blob 大小上限（0 表示不限制）
+	MaxImageSize        int64         // 镜像总大小上限（0 表示不限制）
+	CacheMaxBlobSize    int64         // 超过该大小的响应直接流式传输不缓存
+	CacheVerifyReads    float64       // 读取缓存 blob 时重新校验 sha256 的比例（0 不校验，1 每次校验）
+	CacheCompressMeta   bool          // gzip 压缩磁盘上的 manifest 与 .meta 文件
+	CacheFsync          bool          // 提交缓存文件前 fsync，断电后不丢失已提交的内容
+	ManifestHeadFetch   bool          // manifest HEAD 未命中时向上游发送 GET 并缓存完整内容
+	CacheDetachMax      int           // 客户端断开后继续在后台缓存的最大传输数（0 表示不启用）
+	CacheDetachTimeout  time.Duration // 后台继续传输的超时时间
+	ResumeRetries       int           // 上游 blob 传输中断时的续传次数（0 表示不续传）
+	ParallelChunks      int           // 大 blob 并行下载的并发分块数（<= 1 表示不启用）
+	ParallelChunkSize   int64         // 并行下载的分块大小
+	ParallelMinSize     int64         // 启用并行下载的最小 blob 大小
+	CacheWriteWorkers   int           // 缓存写入 worker 数
+	CacheWriteQueue     int           // 缓存写入队列容量
+
+	// 按上游 Cache-Control / Expires 计算缓存有效期，并按内容类别限制上下限
+	CacheTTLPolicy cache.TTLPolicy
+
+	// 按仓库或命名空间限制 blob 缓存占用，超出时只淘汰匹配仓库的 blob
+	CacheQuotas []cache.Quota
+
+	// blob 缓存总大小上限（超过时回收最早缓存的 blob）与后台回收间隔
+	CacheMaxSize         int64
+	CacheCleanupInterval time.Duration
+
+	// 上游是另一个 go-docker-proxy 实例的 host（CHAINED_ROUTES 注册）
+	ChainedUpstreams map[string]bool
+	// Helm chart 仓库路由：域名 -> 仓库地址（HELM_ROUTES 注册）
+	HelmRoutes map[string]string
+	// 文件镜像路由：域名 -> 上游与路径允许列表（FILE_MIRROR_ROUTES 注册）
+	FileMirrors map[string]*FileMirrorRoute
+	// 对象存储源站：上游 host -> 存储桶（BUCKET_ROUTES 注册）
+	BucketOrigins map[string]*BucketOrigin
+
+	// 以上路由的原始条目，启动与热重载时解析注册
+	ChainedRouteEntries    []string // CHAINED_ROUTES
+	HelmRouteEntries       []string // HELM_ROUTES
+	FileMirrorRouteEntries []string // FILE_MIRROR_ROUTES
+	BucketRouteEntries     []string // BUCKET_ROUTES
+
+	// 私有仓库与外部层路由：name -> 上游 host（ECR_ROUTES、GAR_ROUTES、ACR_ROUTES、FOREIGN_LAYER_ROUTES）
+	ECRRoutes          map[string]string
+	GARRoutes          map[string]string
+	ACRRoutes          map[string]string
+	ForeignLayerRoutes map[string]string
+
+	TargetUpstream string // 调试模式下未匹配任何路由时使用的上游
+	// 上游 host -> 仓库类型与路径前缀（UPSTREAM_FLAVORS）
+	UpstreamFlavors map[string]UpstreamFlavor
+	// 路由域名 -> 说明（ROUTE_DESCRIPTIONS，/api/routes 展示）
+	RouteDescriptions map[string]string
+	// 路由域名 -> 蓝绿切换的新上游与分流权重（UPSTREAM_SPLITS）
+	UpstreamSplits map[string]UpstreamSplit
+
+	// 按上游域名指定专用 DNS 服务器（同时匹配子域名），优先于 DNS_SERVERS
+	DNSOverrides map[string][]string
+	// DNS 解析失败或结果异常时改连的上游 IP（DNS_FALLBACK_IPS，只匹配域名本身）
+	DNSFallbackIPs map[string][]net.IPAddr
+	// DNS 污染检测：拒绝异常与未声明的内网地址，改用备用解析器（ip:端口 走 TCP，https:// 为 DoH）
+	DNSPoisonCheck      bool
+	DNSPrivateHosts     []string // 允许解析到内网地址的域名（同时匹配子域名）
+	DNSSecondaryServers []string
+
+	// 上游连接的出口地址（本地 IP 或网卡名），可按上游域名覆盖（同时匹配子域名）
+	EgressBind      string
+	EgressOverrides map[string]string
+
+	// 上游连接的地址族：auto、ipv4、ipv6、prefer-ipv4、prefer-ipv6
+	UpstreamIPFamily      string
+	UpstreamFallbackDelay time.Duration // 另一地址族的并发尝试延迟（负值表示优先地址族全部失败后才尝试）
+
+	// 上游连接参数，可按上游域名覆盖（同时匹配子域名）
+	UpstreamDial          DialSettings
+	UpstreamDialOverrides []string // UPSTREAM_DIAL_OVERRIDES 原始条目，启动时解析
+	UpstreamTLSProfiles   []string // UPSTREAM_TLS_PROFILES 原始条目（按上游域名的 ClientHello 设置），启动时解析
+
+	// 上游 TLS 会话恢复与连接预热
+	UpstreamTLSSessionCache int           // TLS 会话缓存条目数（0 表示不启用会话恢复）
+	UpstreamPrewarm         []string      // 预热的上游域名或地址，* 表示所有路由上游
+	UpstreamPrewarmConns    int           // 每个上游保持的预热连接数
+	UpstreamPrewarmInterval time.Duration // 预热刷新间隔，需小于上游空闲连接超时（90s）
+
+	// 对冲请求：主上游在 HedgeDelay 内未返回响应头时向备用镜像并发请求 manifest
+	Mirrors    map[string][]string // 路由 host -> 备用镜像上游
+	HedgeDelay time.Duration       // 0 表示不启用
+
+	// 重定向策略：按目标域名在服务器端跟随或交给客户端，优先于 FollowAllRedirects 与黑名单
+	RedirectRules   []RedirectRule
+	RedirectMaxHops int // 服务器端跟随的最大重定向次数
+
+	// 按路由剥离、保留或添加返回给客户端的响应头（路由 host，* 表示全部路由）
+	ResponseHeaders map[string]*headerRules
+
+	// 访问日志：常规请求的记录比例与慢请求阈值（0 不启用）
+	AccessLogSample      float64
+	SlowRequestThreshold time.Duration
+	TimingHeader         bool // 返回 X-Proxy-Timing 各阶段耗时
+
+	// 服务端超时
+	ServerReadTimeout       time.Duration
+	ServerWriteTimeout      time.Duration // 0 表示不限制，支持大文件长时间传输
+	ServerIdleTimeout       time.Duration
+	ServerReadHeaderTimeout time.Duration
+	ShutdownTimeout         time.Duration // 关闭时等待进行中的传输完成的时间上限
+
+	// 上游超时与重试的默认值，可由 TimeoutsFile 按路由和请求类别覆盖
+	UpstreamTimeouts Timeouts
+	TimeoutsFile     string
+	RetryStatuses    map[int]bool // 返回这些状态码时按重试设置重试幂等请求
+	RetryBodyLimit   int64        // 读入内存以便重试 / 重定向时重发的请求体大小上限
+
+	// 上游返回 429 后按上游暂停回源，期间返回过期缓存或 429
+	RateLimitBackoff    time.Duration // 429 未带 Retry-After 时的暂停时间（0 表示不暂停，按重试设置处理）
+	RateLimitMaxBackoff time.Duration // 暂停时间上限
+	CacheStaleTTL       time.Duration // manifest 过期后继续保留、可在限流时返回的时间
+
+	// 并发限制与过载保护（0 表示不限制）
+	MaxUpstreamRequests int           // 同时进行的上游请求数
+	MaxBlobStreams      int           // 同时进行的 blob 传输数
+	LimitQueueSize      int           // 达到上限后允许排队的请求数
+	LimitQueueTimeout   time.Duration // 最长排队时间，超时返回 503
+	LimitRetryAfter     time.Duration // 503 响应的 Retry-After
+
+	// 按客户端身份（用户、API token、证书或来源 IP）限流：每秒请求数与突发上限（0 表示不限制）
+	ClientRateLimit float64
+	ClientRateBurst int
+
+	// 内存缓存：manifest 与小 blob 在总字节预算内常驻内存
+	HotCacheSize    int64 // 0 表示不启用
+	HotCacheMaxItem int64 // 单个对象上限，更大的对象只走文件缓存
+
+	Listen ListenConfig // 监听地址、Unix socket 与 TLS
+
+	CORS CORSConfig // 浏览器跨域访问（未配置来源时不启用）
+
+	Security SecurityConfig // 安全响应头与代理标识
+
+	Admin AdminAuthConfig // 管理接口认证（未配置任何方式时不开放 /admin）
+
+	IPFilter IPFilterConfig // 来源 IP 访问控制与可信反向代理
+
+	Cluster ClusterConfig // 集群缓存共享（未配置同伴时不启用）
+
+	Notify NotifyConfig // 事件通知（未配置端点时不启用）
+
+	Scan ScanConfig // 漏洞扫描
+
+	Signatures SignatureConfig // cosign 签名校验（未配置策略时不启用）
+
+	ErrorReports ErrorReportConfig // panic 与 5xx 突增上报
+
+	CacheEncryption CacheEncryptionConfig // 缓存静态加密密钥（未配置时不加密）
+
+	// 上游健康检查：探测间隔（0 表示不启用）、单次探测超时与连续失败次数阈值
+	UpstreamHealthInterval  time.Duration
+	UpstreamHealthTimeout   time.Duration
+	UpstreamHealthThreshold int
+
+	// 维护模式：启动时即只从缓存提供内容，也可通过 /admin/maintenance 切换
+	MaintenanceMode       bool
+	MaintenanceRetryAfter time.Duration // 缓存未命中时 503 响应的 Retry-After
+
+	// 深度健康检查（/health?deep=true）
+	HealthCheckTimeout time.Duration // 全部检查的总超时
+	HealthMinFreeDisk  int64         // 缓存目录剩余空间下限（0 表示不检查下限）
+
+	UsageRetention time.Duration // 用量报告保留时间（0 表示不统计）
+
+	ReplicationFile string // 镜像复制配置文件（JSON，为空则不启用）
+
+	SingleDomainHosts []string // 单域名模式的域名（Docker Hub 镜像，其他仓库以域名前缀访问）
+}
+
+type ProxyServer struct {
+	config         *Config
+	cacheManager   *cache.CacheManager   // 新的统一缓存管理器
+	platformFilter *PlatformFilter       // 平台过滤器（未配置时为 nil）
+	clientAuth     *ClientAuth           // 客户端认证（未配置时为 nil）
+	apiTokens      *TokenStore           // API token 与配额（未配置时为 nil）
+	adminAuth      *AdminAuth            // 管理接口认证（未配置时为 nil）
+	maintenance    *maintenanceMode      // 维护模式：只从缓存提供内容
+	authChallenges *AuthChallengeCache   // 上游认证挑战缓存
+	scopeRewriter  *ScopeRewriter        // scope 重写规则（未配置时为 nil）
+	notifier       *Notifier             // 事件通知（未配置时为 nil）
+	scanner        *Scanner              // 漏洞扫描（未启用时为 nil）
+	signatures     *SignatureVerifier    // cosign 签名校验（未配置时为 nil）
+	tagPolicies    *TagPolicies          // tag 策略（未配置时为 nil）
+	headerRules    *HeaderRules          // 请求 / 响应头改写规则（未配置时为 nil）
+	ipFilter       *IPFilter             // 来源 IP 访问控制（未配置时为 nil）
+	trustedProxies []*net.IPNet          // 可信反向代理，仅采信来自这些地址的转发头
+	detach         *detachLimiter        // 断开后继续缓存（未启用时为 nil）
+	cacheWrites    *cacheWriteQueue      // 响应返回后的异步缓存写入
+	rateLimits     *rateLimitTracker     // 上游返回的限流额度
+	retryStats     *retryStats           // 上游重试统计
+	chainStats     *chainStats           // 级联上游代理的缓存状态统计
+	helmStats      helmStats             // Helm chart 仓库请求统计
+	mirrorStats    fileMirrorStats       // 文件镜像请求统计
+	routeStats     *routeStats           // 按路由统计的请求数与缓存命中
+	clientStats    *clientStats          // 按客户端身份统计的请求数与字节数
+	clientLimiter  *clientLimiter        // 按客户端身份限流（未配置时为 nil）
+	events         *eventStream          // /admin/events 实时活动流
+	errorReporter  *ErrorReporter        // panic 与 5xx 突增上报（未配置时为 nil）
+	accessLog      *accessLog            // 抽样访问日志与慢请求日志
+	timeouts       *TimeoutTable         // 按路由与请求类别的超时设置
+	upstreamLimit  *concurrencyLimiter   // 上游请求并发限制（未配置时为 nil）
+	blobLimit      *concurrencyLimiter   // blob 传输并发限制（未配置时为 nil）
+	upstreamHealth *UpstreamHealth       // 上游健康检查（未启用时为 nil）
+	prewarmer      *connPrewarmer        // 上游连接预热（未配置时为 nil）
+	requests       *requestTracker       // 正在处理的请求（运行时诊断）
+	blobStreams    *blobStreamTracker    // 进行中的 blob 传输（关闭时排空）
+	usage          *UsageTracker         // 用量统计（未开放管理接口时为 nil）
+	cluster        *Cluster              // 集群缓存共享（未配置时为 nil）
+	replicator     *Replicator           // 镜像复制（未配置时为 nil）
+	foreignLayers  *ForeignLayerRewriter // 外部层地址改写（未配置时为 nil）
+	transport      *upstreamTransport
+	server         *http.Server
+	stopped        chan struct{} // Shutdown 完成后关闭
+	reloadMu       sync.Mutex    // 串行化 SIGHUP 与 /admin/reload 触发的重载
+	startOnce      sync.Once
+	live           atomic.Pointer[liveConfig] // 可热重载的路由与凭据
+	hooks          []Hook                     // 扩展钩子（RegisterHook 注册）
+}
+
+// LoadConfig 从环境变量（及 CONFIG_FILE）加载代理配置，配置文件无法读取时返回错误
+func LoadConfig() (*Config, error) {
+	if err := applyConfigFile(); err != nil {
+		return nil, fmt.Errorf("failed to load config file: %w", err)
+	}
+	return loadEnvConfig(), nil
+}
+
+// loadEnvConfig 从环境变量构建配置
+func loadEnvConfig() *Config {
+	customDomain := getEnv("CUSTOM_DOMAIN", "example.com")
+
+	// 内置黑名单：这些域名被墙，需要服务器端处理重定向
+	// 注意：只包含被墙的域名，不包含可以正常访问的外部存储
+	defaultBlockedHostPatterns := []string{
+		"cloudflare.docker.com",
+		"docker.com",
+		"docker.io",
+	}
+
+	// 从环境变量加载额外的黑名单
+	blockedHostPatterns := make([]string, len(defaultBlockedHostPatterns))
+	copy(blockedHostPatterns, defaultBlockedHostPatterns)
+	if externalBlocked := getEnv("BLOCKED_HOSTS", ""); externalBlocked != "" {
+		externalPatterns := strings.Split(externalBlocked, ",")
+		for _, pattern := range externalPatterns {
+			pattern = strings.TrimSpace(pattern)
+			if pattern != "" {
+				blockedHostPatterns = append(blockedHostPatterns, pattern)
+			}
+		}
+	}
+
+	// 解析DNS服务器列表
+	var dnsServers []string
+	if dnsServersStr := getEnv("DNS_SERVERS", ""); dnsServersStr != "" {
+		for _, server := range strings.Split(dnsServersStr, ",") {
+			server = strings.TrimSpace(server)
+			if server != "" {
+				dnsServers = append(dnsServers, server)
+			}
+		}
+	}
+
+	// 解析缓存 TTL 配置
+	manifestTTL := parseDuration(getEnv("CACHE_MANIFEST_TTL", "1d"), 24*time.Hour)
+	blobTTL := parseDuration(getEnv("CACHE_BLOB_TTL", "1y"), 365*24*time.Hour) // 默认 1 年
+	// 默认上游只能缩短 tag manifest 的有效期，不影响不可变内容
+	ttlPolicy := cache.TTLPolicy{
+		HonorUpstream: getEnv("CACHE_HONOR_UPSTREAM_TTL", "true") == "true",
+		Manifest: cache.TTLBounds{
+			Min: parseDuration(getEnv("CACHE_MANIFEST_TTL_MIN", "0"), 0),
+			Max: parseDuration(getEnv("CACHE_MANIFEST_TTL_MAX", ""), manifestTTL),
+		},
+		Blob: cache.TTLBounds{
+			Min: parseDuration(getEnv("CACHE_BLOB_TTL_MIN", ""), blobTTL),
+			Max: parseDuration(getEnv("CACHE_BLOB_TTL_MAX", "0"), 0),
+		},
+		Hosts: parseCacheTTLOverrides(getEnvList("CACHE_TTL_OVERRIDES")),
+	}
+
+	// 缓存上限与回收间隔必须为正数，无效时使用默认值
+	cacheDefaults := cache.DefaultCacheConfig()
+	cacheMaxSize := parseSize(getEnv("CACHE_MAX_SIZE", ""), cacheDefaults.MaxSize)
+	if cacheMaxSize <= 0 {
+		cacheMaxSize = cacheDefaults.MaxSize
+	}
+	cleanupInterval := parseDuration(getEnv("CACHE_CLEANUP_INTERVAL", ""), cacheDefaults.CleanupInterval)
+	if cleanupInterval <= 0 {
+		cleanupInterval = cacheDefaults.CleanupInterval
+	}
+
+	config := &Config{
+		Port:                getEnv("PORT", "8080"),
+		CacheDir:            getEnv("CACHE_DIR", "./cache"),
+		CacheEnabled:        getEnv("CACHE_ENABLED", "true") == "true", // 默认启用缓存
+		CacheManifestTTL:    manifestTTL,
+		CacheBlobTTL:        blobTTL,
+		CacheTTLPolicy:      ttlPolicy,
+		CacheQuotas:         parseCacheQuotas(getEnvList("CACHE_QUOTAS")),
+		FollowAllRedirects:  getEnv("FOLLOW_ALL_REDIRECTS", "false") == "true", // 跟随所有重定向以缓存
+		RedirectRules:       parseRedirectRules(getEnvList("REDIRECT_RULES")),
+		RedirectMaxHops:     parseInt(getEnv("REDIRECT_MAX_HOPS", "10"), 10),
+		Debug:               getEnv("DEBUG", "false") == "true",
+		CustomDomain:        customDomain,
+		Routes:              buildRoutes(customDomain),
+		BlockedHostPatterns: blockedHostPatterns,
+		DNSEnabled:          getEnv("DNS_ENABLED", "false") == "true",
+		DNSServers:          dnsServers,
+		DNSTimeout:          getEnv("DNS_TIMEOUT", "5s"),
+		DNSOverrides:        parseDNSOverrides(getEnvList("DNS_OVERRIDES")),
+		DNSFallbackIPs:      parseFallbackIPs(getEnvList("DNS_FALLBACK_IPS")),
+		DNSPoisonCheck:      getEnv("DNS_POISON_CHECK", "false") == "true",
+		DNSPrivateHosts:     getEnvList("DNS_PRIVATE_HOSTS"),
+		DNSSecondaryServers: getEnvList("DNS_SECONDARY_SERVERS"),
+		EgressBind:          getEnv("EGRESS_BIND", ""),
+		EgressOverrides:     parseEgressOverrides(getEnvList("EGRESS_BIND_OVERRIDES")),
+		PrefetchPlatforms:   getEnvList("PREFETCH_PLATFORMS"),
+		CacheSkipPlatforms:  getEnvList("CACHE_SKIP_PLATFORMS"),
+		AuthHtpasswd:        getEnv("AUTH_HTPASSWD", ""),
+		APITokensFile:       getEnv("API_TOKENS_FILE", ""),
+		APITokensEnabled:    getEnv("API_TOKENS_ENABLED", "false") == "true" || getEnv("API_TOKENS_FILE", "") != "",
+		AuthChallengeTTL:    parseDuration(getEnv("AUTH_CHALLENGE_TTL", "10m"), 10*time.Minute),
+		ScopeRewriteFile:    getEnv("SCOPE_REWRITE_RULES", ""),
+		UpstreamFlavors:     parseUpstreamFlavors(getEnvList("UPSTREAM_FLAVORS")),
+		RouteDescriptions:   parseRouteDescriptions(getEnvList("ROUTE_DESCRIPTIONS"), customDomain),
+		UpstreamSplits:      parseUpstreamSplits(getEnvList("UPSTREAM_SPLITS"), customDomain),
+		TagPolicyFile:       getEnv("TAG_POLICY", ""),
+		HeaderRulesFile:     getEnv("HEADER_RULES", ""),
+		MaxBlobSize:         parseSize(getEnv("MAX_BLOB_SIZE", ""), 0),
+		MaxImageSize:        parseSize(getEnv("MAX_IMAGE_SIZE", ""), 0),
+		CacheMaxBlobSize:    parseSize(getEnv("CACHE_MAX_BLOB_SIZE", ""), maxCacheableSize),
+		CacheVerifyReads:    parseFloat(getEnv("CACHE_VERIFY_READS", "0"), 0),
+		CacheCompressMeta:   getEnv("CACHE_COMPRESS_METADATA", "false") == "true",
+		CacheFsync:          getEnv("CACHE_FSYNC", "false") == "true",
+		ManifestHeadFetch:   getEnv("MANIFEST_HEAD_FETCH", "true") == "true",
+		CacheDetachMax:      parseInt(getEnv("CACHE_DETACH_MAX", "0"), 0),
+		CacheDetachTimeout:  parseDuration(getEnv("CACHE_DETACH_TIMEOUT", "10m"), 10*time.Minute),
+		ResumeRetries:       parseInt(getEnv("UPSTREAM_RESUME_RETRIES", "3"), 3),
+		ParallelChunks:      parseInt(getEnv("PARALLEL_DOWNLOAD_CHUNKS", "0"), 0),
+		ParallelChunkSize:   parseSize(getEnv("PARALLEL_DOWNLOAD_CHUNK_SIZE", ""), 8<<20),
+		ParallelMinSize:     parseSize(getEnv("PARALLEL_DOWNLOAD_MIN_SIZE", ""), 64<<20),
+		CacheWriteWorkers:   parseInt(getEnv("CACHE_WRITE_WORKERS", "8"), 8),
+		CacheWriteQueue:     parseInt(getEnv("CACHE_WRITE_QUEUE", "256"), 256),
+		Mirrors:             parseMirrors(getEnv("UPSTREAM_MIRRORS", ""), customDomain),
+		ResponseHeaders: parseResponseHeaderRules(getEnv("RESPONSE_HEADERS_STRIP", ""), getEnv("RESPONSE_HEADERS_KEEP", ""),
+			getEnv("RESPONSE_HEADERS_ADD", ""), customDomain),
+		HedgeDelay: parseDuration(getEnv("HEDGE_DELAY", "0"), 0),
+
+		UpstreamIPFamily:      strings.ToLower(getEnv("UPSTREAM_IP_FAMILY", ipFamilyAuto)),
+		UpstreamFallbackDelay: parseDuration(getEnv("UPSTREAM_FALLBACK_DELAY", "300ms"), 300*time.Millisecond),
+
+		UpstreamDial: DialSettings{
+			DialTimeout:         parseDuration(getEnv("UPSTREAM_DIAL_TIMEOUT", "30s"), 30*time.Second),
+			TLSHandshakeTimeout: parseDuration(getEnv("UPSTREAM_TLS_HANDSHAKE_TIMEOUT", "10s"), 10*time.Second),
+			KeepAlive:           parseDuration(getEnv("UPSTREAM_KEEPALIVE", "30s"), 30*time.Second),
+			MaxConnsPerHost:     parseInt(getEnv("UPSTREAM_MAX_CONNS_PER_HOST", "50"), 50),
+		},
+		UpstreamDialOverrides: getEnvList("UPSTREAM_DIAL_OVERRIDES"),
+		UpstreamTLSProfiles:   getEnvList("UPSTREAM_TLS_PROFILES"),
+
+		UpstreamTLSSessionCache: parseInt(getEnv("UPSTREAM_TLS_SESSION_CACHE", "256"), 256),
+		UpstreamPrewarm:         getEnvList("UPSTREAM_PREWARM"),
+		UpstreamPrewarmConns:    parseInt(getEnv("UPSTREAM_PREWARM_CONNS", "2"), 2),
+		UpstreamPrewarmInterval: parseDuration(getEnv("UPSTREAM_PREWARM_INTERVAL", "60s"), 60*time.Second),
+
+		AccessLogSample:      parseFloat(getEnv("ACCESS_LOG_SAMPLE", "1"), 1),
+		SlowRequestThreshold: parseDuration(getEnv("SLOW_REQUEST_THRESHOLD", "0"), 0),
+		TimingHeader:         getEnv("TIMING_HEADER", "false") == "true",
+
+		ServerReadTimeout:       parseDuration(getEnv("SERVER_READ_TIMEOUT", "30s"), 30*time.Second),
+		ServerWriteTimeout:      parseDuration(getEnv("SERVER_WRITE_TIMEOUT", "0"), 0),
+		ServerIdleTimeout:       parseDuration(getEnv("SERVER_IDLE_TIMEOUT", "120s"), 120*time.Second),
+		ServerReadHeaderTimeout: parseDuration(getEnv("SERVER_READ_HEADER_TIMEOUT", "10s"), 10*time.Second),
+		ShutdownTimeout:         parseDuration(getEnv("SHUTDOWN_TIMEOUT", "15s"), 15*time.Second),
+
+		UpstreamTimeouts: Timeouts{
+			ResponseHeader: parseDuration(getEnv("UPSTREAM_RESPONSE_HEADER_TIMEOUT", "30s"), 30*time.Second),
+			Request:        parseDuration(getEnv("REQUEST_TIMEOUT", "60s"), 60*time.Second),
+			Retries:        parseInt(getEnv("UPSTREAM_RETRIES", "2"), 2),
+			Backoff:        parseDuration(getEnv("UPSTREAM_RETRY_BACKOFF", "100ms"), 100*time.Millisecond),
+			MaxBackoff:     parseDuration(getEnv("UPSTREAM_RETRY_MAX_BACKOFF", "5s"), 5*time.Second),
+		},
+		TimeoutsFile:   getEnv("TIMEOUTS_FILE", ""),
+		RetryStatuses:  parseRetryStatuses(getEnv("UPSTREAM_RETRY_STATUSES", "429,502,503")),
+		RetryBodyLimit: parseSize(getEnv("UPSTREAM_RETRY_BODY_LIMIT", ""), 1<<20),
+
+		RateLimitBackoff:    parseDuration(getEnv("UPSTREAM_429_BACKOFF", "30s"), 30*time.Second),
+		RateLimitMaxBackoff: parseDuration(getEnv("UPSTREAM_429_MAX_BACKOFF", "10m"), 10*time.Minute),
+		CacheStaleTTL:       parseDuration(getEnv("CACHE_STALE_TTL", "24h"), 24*time.Hour),
+
+		MaxUpstreamRequests: parseInt(getEnv("MAX_UPSTREAM_REQUESTS", "0"), 0),
+		MaxBlobStreams:      parseInt(getEnv("MAX_BLOB_STREAMS", "0"), 0),
+		LimitQueueSize:      parseInt(getEnv("LIMIT_QUEUE_SIZE", "100"), 100),
+		LimitQueueTimeout:   parseDuration(getEnv("LIMIT_QUEUE_TIMEOUT", "10s"), 10*time.Second),
+		LimitRetryAfter:     parseDuration(getEnv("LIMIT_RETRY_AFTER", "5s"), 5*time.Second),
+
+		ClientRateLimit: parseFloat(getEnv("CLIENT_RATE_LIMIT", "0"), 0),
+		ClientRateBurst: parseInt(getEnv("CLIENT_RATE_BURST", "0"), 0),
+
+		HotCacheSize:    parseSize(getEnv("HOT_CACHE_SIZE", ""), 64<<20),
+		HotCacheMaxItem: parseSize(getEnv("HOT_CACHE_MAX_ITEM_SIZE", ""), 1<<20),
+
+		Listen: loadListenConfig(),
+
+		CORS: loadCORSConfig(),
+
+		Security: loadSecurityConfig(),
+
+		Admin: loadAdminAuthConfig(),
+
+		IPFilter: loadIPFilterConfig(),
+
+		Cluster: loadClusterConfig(),
+
+		Notify: loadNotifyConfig(),
+
+		Scan: loadScanConfig(),
+
+		Signatures: loadSignatureConfig(),
+
+		ErrorReports: loadErrorReportConfig(),
+
+		CacheEncryption: loadCacheEncryptionConfig(),
+
+		UpstreamHealthInterval:  parseDuration(getEnv("UPSTREAM_HEALTH_INTERVAL", "0"), 0),
+		UpstreamHealthTimeout:   parseDuration(getEnv("UPSTREAM_HEALTH_TIMEOUT", "5s"), 5*time.Second),
+		UpstreamHealthThreshold: parseInt(getEnv("UPSTREAM_HEALTH_THRESHOLD", "3"), 3),
+
+		MaintenanceMode:       getEnv("MAINTENANCE_MODE", "false") == "true",
+		MaintenanceRetryAfter: parseDuration(getEnv("MAINTENANCE_RETRY_AFTER", "5m"), 5*time.Minute),
+
+		CacheMaxSize:         cacheMaxSize,
+		CacheCleanupInterval: cleanupInterval,
+
+		HealthCheckTimeout: parseDuration(getEnv("HEALTH_CHECK_TIMEOUT", "5s"), 5*time.Second),
+		HealthMinFreeDisk:  parseSize(getEnv("HEALTH_MIN_FREE_DISK", ""), 1<<30),
+
+		UsageRetention: parseDuration(getEnv("USAGE_REPORT_RETENTION", "7d"), 7*24*time.Hour),
+
+		ReplicationFile: getEnv("REPLICATION_FILE", ""),
+
+		SingleDomainHosts: getEnvList("SINGLE_DOMAIN"),
+
+		ChainedRouteEntries:    getEnvList("CHAINED_ROUTES"),
+		HelmRouteEntries:       getEnvList("HELM_ROUTES"),
+		FileMirrorRouteEntries: getEnvList("FILE_MIRROR_ROUTES"),
+		BucketRouteEntries:     getEnvList("BUCKET_ROUTES"),
+		ECRRoutes:              parseNamedHosts(getEnv("ECR_ROUTES", "")),
+		GARRoutes:              parseNamedHosts(getEnv("GAR_ROUTES", "")),
+		ACRRoutes:              parseNamedHosts(getEnv("ACR_ROUTES", "")),
+		ForeignLayerRoutes:     parseNamedHosts(getEnv("FOREIGN_LAYER_ROUTES", "")),
+
+		TargetUpstream: getEnv("TARGET_UPSTREAM", ""),
+	}
+
+	return config
+}
+
+// NewProxyServer 根据配置创建代理服务器，规则文件、密钥、出口地址等无法加载时返回错误
+func NewProxyServer(config *Config) (_ *ProxyServer, err error) {
+	timeouts, err := LoadTimeouts(config.TimeoutsFile, config.CustomDomain, config.UpstreamTimeouts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load timeouts: %w", err)
+	}
+
+	dialOverrides, err := parseDialOverrides(config.UpstreamDialOverrides, config.UpstreamDial)
+	if err != nil {
+		return nil, fmt.Errorf("UPSTREAM_DIAL_OVERRIDES: %w", err)
+	}
+	tlsProfiles, err := parseTLSProfiles(config.UpstreamTLSProfiles)
+	if err != nil {
+		return nil, fmt.Errorf("UPSTREAM_TLS_PROFILES: %w", err)
+	}
+
+	// 配置高性能的 Transport（优化大文件传输）
+	dialer, err := newUpstreamDialer(config)
+	if err != nil {
+		return nil, err
+	}
+	baseTransport := &http.Transport{
+		// 自定义DNS只作用于上游连接，不替换全局解析器
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   20,
+		MaxConnsPerHost:       config.UpstreamDial.MaxConnsPerHost,
+		IdleConnTimeout:       upstreamIdleConnTimeout,
+		TLSHandshakeTimeout:   config.UpstreamDial.TLSHandshakeTimeout,
+		ExpectContinueTimeout: 1 * time.Second,
+		ResponseHeaderTimeout: timeouts.MaxResponseHeader(), // 按请求的设置在 roundTrip 中生效
+		DisableKeepAlives:     false,
+
+		// TLS 配置
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: false,
+			MinVersion:         tls.VersionTLS12,
+		},
+
+		// 启用 HTTP/2
+		ForceAttemptHTTP2: true,
+
+		// 禁用压缩，让客户端直接处理
+		DisableCompression: true,
+
+		// 增大写缓冲区，优化大文件传输
+		WriteBufferSize: 256 * 1024, // 256KB
+		ReadBufferSize:  256 * 1024, // 256KB
+	}
+	// TLS 会话缓存由所有上游 Transport 共用（Clone 保留同一缓存）
+	sessions := newSessionCache(config.UpstreamTLSSessionCache)
+	if sessions != nil {
+		baseTransport.TLSClientConfig.ClientSessionCache = sessions
+	}
+	transport := newUpstreamTransport(baseTransport, dialer, dialOverrides)
+	transport.sessions = sessions
+	transport.applyTLSProfiles(tlsProfiles)
+
+	// 注册级联代理路由、私有仓库路由（ECR 等）及其认证器
+	registerChainedRoutes(config)
+	registerHelmRoutes(config)
+	registerFileMirrorRoutes(config)
+	registerBucketRoutes(config, transport)
+	transport.setBucketOrigins(config.BucketOrigins)
+	upstreamAuth := buildUpstreamAuth(config, transport)
+	foreignLayers := NewForeignLayerRewriter(config)
+	live := newLiveConfig(config, upstreamAuth)
+
+	cacheCipher, keySource, err := loadCacheCipher(config.CacheEncryption)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load cache encryption key: %w", err)
+	}
+	if cacheCipher != nil {
+		log.Printf("Cache encryption at rest enabled (key from %s)", keySource)
+	}
+
+	// 创建缓存管理器
+	cacheConfig := &cache.CacheConfig{
+		Dir:             config.CacheDir,
+		MaxSize:         config.CacheMaxSize,
+		ManifestTTL:     config.CacheManifestTTL,
+		BlobTTL:         config.CacheBlobTTL,
+		CleanupInterval: config.CacheCleanupInterval,
+		HotCacheSize:    config.HotCacheSize,
+		HotCacheMaxItem: config.HotCacheMaxItem,
+		TTLPolicy:       config.CacheTTLPolicy,
+		VerifyRate:      config.CacheVerifyReads,
+		Quotas:          config.CacheQuotas,
+		CompressMeta:    config.CacheCompressMeta,
+		Fsync:           config.CacheFsync,
+		Cipher:          cacheCipher,
+		StaleTTL:        config.CacheStaleTTL,
+		Debug:           config.Debug,
+	}
+
+	cacheManager, err := cache.NewCacheManager(cacheConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cache manager: %w", err)
+	}
+	// 之后的配置加载失败时关闭缓存管理器，停止其后台任务
+	defer func() {
+		if err != nil {
+			cacheManager.Close()
+		}
+	}()
+
+	scopeRewriter, err := LoadScopeRewriter(config.ScopeRewriteFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load scope rewrite rules: %w", err)
+	}
+
+	scanner, err := NewScanner(config.Scan, config.CacheDir, config.Debug)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize scanner: %w", err)
+	}
+
+	signatureVerifier, err := NewSignatureVerifier(config.Signatures, config.Debug)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load cosign policy: %w", err)
+	}
+
+	tagPolicies, err := LoadTagPolicies(config.TagPolicyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tag policy: %w", err)
+	}
+
+	ipFilter, err := NewIPFilter(config.IPFilter, config.Debug)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load IP filter: %w", err)
+	}
+	trustedProxies, err := parseCIDRs(config.IPFilter.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TRUSTED_PROXIES: %w", err)
+	}
+
+	headerRules, err := LoadHeaderRules(config.HeaderRulesFile, config.CustomDomain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load header rules: %w", err)
+	}
+
+	var apiTokens *TokenStore
+	if config.APITokensEnabled {
+		apiTokens, err = NewTokenStore(config.APITokensFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load API tokens: %w", err)
+		}
+	}
+
+	var clientAuth *ClientAuth
+	if config.AuthHtpasswd != "" || apiTokens != nil {
+		clientAuth, err = NewClientAuth(config.AuthHtpasswd, apiTokens, config.Debug)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client auth: %w", err)
+		}
+	}
+
+	adminAuth, err := NewAdminAuth(config.Admin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load admin auth: %w", err)
+	}
+
+	// 用量报告只通过管理接口查看
+	var usage *UsageTracker
+	if adminAuth != nil {
+		usage = NewUsageTracker(config.UsageRetention)
+	}
+
+	p := &ProxyServer{
+		config:         config,
+		cacheManager:   cacheManager,
+		requests:       newRequestTracker(),
+		blobStreams:    newBlobStreamTracker(),
+		stopped:        make(chan struct{}),
+		platformFilter: NewPlatformFilter(config.CacheSkipPlatforms),
+		clientAuth:     clientAuth,
+		apiTokens:      apiTokens,
+		adminAuth:      adminAuth,
+		maintenance:    &maintenanceMode{},
+		authChallenges: NewAuthChallengeCache(config.AuthChallengeTTL),
+		scopeRewriter:  scopeRewriter,
+		notifier:       NewNotifier(config.Notify, ":"+config.Port, config.Debug),
+		errorReporter:  NewErrorReporter(config.ErrorReports),
+		accessLog:      newAccessLog(config),
+		scanner:        scanner,
+		signatures:     signatureVerifier,
+		tagPolicies:    tagPolicies,
+		headerRules:    headerRules,
+		ipFilter:       ipFilter,
+		trustedProxies: trustedProxies,
+		detach:         newDetachLimiter(cacheManager.Context(), config.CacheDetachMax, config.CacheDetachTimeout),
+		cacheWrites:    newCacheWriteQueue(cacheManager.Context(), config.CacheWriteWorkers, config.CacheWriteQueue),
+		rateLimits:     newRateLimitTracker(config.RateLimitBackoff, config.RateLimitMaxBackoff),
+		retryStats:     newRetryStats(),
+		chainStats:     newChainStats(),
+		routeStats:     newRouteStats(),
+		clientStats:    newClientStats(),
+		clientLimiter:  newClientLimiter(config.ClientRateLimit, config.ClientRateBurst),
+		events:         newEventStream(),
+		timeouts:       timeouts,
+		upstreamLimit:  newConcurrencyLimiter("upstream", config.MaxUpstreamRequests, config.LimitQueueSize, config.LimitQueueTimeout),
+		blobLimit:      newConcurrencyLimiter("blob", config.MaxBlobStreams, config.LimitQueueSize, config.LimitQueueTimeout),
+		usage:          usage,
+		foreignLayers:  foreignLayers,
+		transport:      transport,
+	}
+	p.live.Store(live)
+	p.upstreamHealth = NewUpstreamHealth(p)
+	p.prewarmer = newConnPrewarmer(p)
+	if p.cluster, err = NewCluster(p); err != nil {
+		return nil, fmt.Errorf("failed to load cluster config: %w", err)
+	}
+	if p.replicator, err = NewReplicator(p, config.ReplicationFile); err != nil {
+		return nil, fmt.Errorf("failed to load replication config: %w", err)
+	}
+	if config.MaintenanceMode {
+		p.maintenance.set(transport, true, config.MaintenanceRetryAfter, "")
+		log.Println("Maintenance mode enabled: serving from cache only")
+	}
+	return p, nil
+}
+
+// 根据自定义域名构建路由映射，参考 ciiiii/cloudflare-docker-proxy
+func buildRoutes(customDomain string) map[string]string {
+	dockerHub := dockerHubUpstream
+
+	routes := map[string]string{
+		// production - 使用 ciiiii 版本的简洁命名规则
+		fmt.Sprintf("docker.%s", customDomain):     dockerHub,
+		fmt.Sprintf("quay.%s", customDomain):       "https://quay.io",
+		fmt.Sprintf("gcr.%s", customDomain):        "https://gcr.io",
+		fmt.Sprintf("k8s-gcr.%s", customDomain):    "https://k8s.gcr.io",
+		fmt.Sprintf("k8s.%s", customDomain):        "https://registry.k8s.io",
+		fmt.Sprintf("ghcr.%s", customDomain):       "https://ghcr.io",
+		fmt.Sprintf("cloudsmith.%s", customDomain): "https://docker.cloudsmith.io",
+		fmt.Sprintf("ecr.%s", customDomain):        "https://public.ecr.aws",
+		fmt.Sprintf("gitlab.%s", customDomain):     "https://registry.gitlab.com",
+
+		// AI/ML 镜像体积大，缓存收益最明显
+		fmt.Sprintf("nvcr.%s", customDomain):    "https://nvcr.io",
+		fmt.Sprintf("ollama.%s", customDomain):  "https://registry.ollama.ai",
+		fmt.Sprintf("elastic.%s", customDomain): "https://docker.elastic.co",
+
+		// staging
+		fmt.Sprintf("docker-staging.%s", customDomain): dockerHub,
+	}
+
+	applyRouteOverrides(routes, customDomain)
+	return routes
+}
+
+// applyRouteOverrides 按 EXTRA_ROUTES（name=仓库地址，逗号分隔，默认 https）增加或覆盖内置路由，
+// 按 DISABLED_ROUTES（name，逗号分隔）移除不需要的内置路由
+func applyRouteOverrides(routes map[string]string, customDomain string) {
+	for _, name := range getEnvList("DISABLED_ROUTES") {
+		delete(routes, strings.ToLower(name)+"."+customDomain)
+	}
+	for _, entry := range getEnvList("EXTRA_ROUTES") {
+		name, upstream, ok := strings.Cut(entry, "=")
+		name, upstream = strings.ToLower(strings.TrimSpace(name)), strings.TrimSuffix(strings.TrimSpace(upstream), "/")
+		if !strings.HasPrefix(upstream, "http://") && !strings.HasPrefix(upstream, "https://") {
+			upstream = "https://" + upstream
+		}
+		u, err := url.Parse(upstream)
+		if !ok || name == "" || err != nil || u.Host == "" {
+			log.Printf("Ignoring invalid EXTRA_ROUTES entry %q (expected name=https://registry.example.com)", entry)
+			continue
+		}
+		routes[name+"."+customDomain] = u.Scheme + "://" + u.Host
+	}
+}
+
+// NewHandler 根据配置创建代理并返回其 HTTP 处理器，便于嵌入到其他服务中；配置无效时返回错误
+func NewHandler(config *Config) (http.Handler, error) {
+	p, err := NewProxyServer(config)
+	if err != nil {
+		return nil, err
+	}
+	return p.Handler(), nil
+}
+
+// Handler 构建代理的路由，并在首次调用时启动后台任务（上游健康检查、集群、复制）
+func (p *ProxyServer) Handler() http.Handler {
+	p.startOnce.Do(p.startBackground)
+
+	r := chi.NewRouter()
+
+	// 添加中间件
+	r.Use(requestIDMiddleware)
+	if p.ipFilter != nil {
+		r.Use(p.ipFilter.Middleware(p))
+	}
+	r.Use(realIPMiddleware(p.trustedProxies))
+	r.Use(p.clientIdentityMiddleware)
+	r.Use(p.requests.middleware)
+	r.Use(p.blobStreams.middleware)
+	r.Use(p.accessLog.middleware)
+	r.Use(middleware.Recoverer)
+	if p.errorReporter != nil {
+		r.Use(p.errorReportMiddleware)
+	}
+	r.Use(p.securityHeaderMiddleware)
+	if len(p.config.CORS.AllowedOrigins) > 0 {
+		r.Use(p.corsMiddleware)
+	}
+	r.Use(p.singleDomainMiddleware)
+	r.Use(p.timeoutMiddleware)
+	r.Use(p.routeStatsMiddleware)
+	r.Use(p.helmMiddleware)
+	r.Use(p.fileMirrorMiddleware)
+
+	if p.config.Debug {
+		log.Println("[DEBUG] Debug mode enabled")
+	}
+
+	// 健康检查端点
+	r.Get("/health", p.handleHealth)
+	r.Get("/healthz", p.handleHealth)
+	r.Get("/version", p.handleVersion)
+
+	// 缓存统计端点
+	r.Group(func(r chi.Router) {
+		r.Use(p.metricsAuthMiddleware)
+		r.Get("/stats", p.handleStats)
+		r.Get("/stats/cache", p.handleCacheStats)
+		r.Get("/metrics", p.handleMetrics)
+		r.Get("/api/routes", p.handleRoutesAPI)
+	})
+
+	// 客户端镜像配置生成
+	p.registerSetupRoutes(r)
+
+	// 管理接口
+	p.registerAdminRoutes(r)
+
+	// 集群节点间接口
+	if p.cluster != nil {
+		p.registerClusterRoutes(r)
+	}
+
+	// 路由定义
+	r.Get("/", p.handleRoot)
+	r.Route("/v2", func(r chi.Router) {
+		r.Use(p.clientAccessMiddlewares()...)
+		if len(p.hooks) > 0 {
+			r.Use(p.hookMiddleware)
+		}
+		r.Use(p.clientAccountingMiddlewares()...)
+		if p.blobLimit != nil {
+			r.Use(p.blobLimitMiddleware)
+		}
+		if p.notifier != nil {
+			r.Use(p.notifyMiddleware)
+		}
+		if p.tagPolicies != nil {
+			r.Use(p.tagPolicyMiddleware)
+		}
+		if p.foreignLayers != nil {
+			r.Use(p.foreignLayerMiddleware)
+		}
+		if p.hasGuardChecks() {
+			r.Use(p.policyGuardMiddleware)
+		}
+		r.Use(p.responseHeaderMiddleware)
+		r.Get("/", p.handleV2Root)
+		r.Get("/auth", p.handleAuth)
+		r.HandleFunc("/*", p.handleV2Request)
+	})
+
+	return r
+}
+
+// clientAccessMiddlewares 客户端认证与按身份限流，/v2 与 Helm 仓库、文件镜像路由共用
+func (p *ProxyServer) clientAccessMiddlewares() []func(http.Handler) http.Handler {
+	var middlewares []func(http.Handler) http.Handler
+	if p.clientAuth != nil {
+		middlewares = append(middlewares, p.clientAuth.Middleware(p))
+	}
+	if p.clientLimiter != nil {
+		middlewares = append(middlewares, p.clientRateLimitMiddleware)
+	}
+	return middlewares
+}
+
+// clientAccountingMiddlewares 用量统计与实时事件，/v2 与 Helm 仓库、文件镜像路由共用
+func (p *ProxyServer) clientAccountingMiddlewares() []func(http.Handler) http.Handler {
+	var middlewares []func(http.Handler) http.Handler
+	if p.usage != nil {
+		middlewares = append(middlewares, p.usageMiddleware)
+	}
+	if p.adminAuth != nil {
+		middlewares = append(middlewares, p.eventStreamMiddleware)
+	}
+	return middlewares
+}
+
+// fileRoute 请求是否属于 Helm 仓库或文件镜像路由（不走镜像仓库协议，认证使用 Basic 挑战，用量按文件统计）
+func (p *ProxyServer) fileRoute(r *http.Request) bool {
+	live, host := p.current(), routeHostname(r)
+	if _, ok := live.helmRoutes[host]; ok {
+		return true
+	}
+	_, ok := live.fileMirrors[host]
+	return ok
+}
+
+// accountedPath 用量与事件统计的请求类型：镜像仓库的 manifest / blob，Helm 仓库与文件镜像的文件（reference 为路径）
+func (p *ProxyServer) accountedPath(r *http.Request) (pathType, repo, reference string) {
+	if p.fileRoute(r) {
+		return "file", "", r.URL.Path
+	}
+	return cache.ParsePath(r.URL.Path)
+}
+
+func (p *ProxyServer) startBackground() {
+	go p.upstreamHealth.Run(context.Background())
+	go p.prewarmer.Run(context.Background())
+	go p.cluster.Run(context.Background())
+	go p.replicator.Run(context.Background())
+	go p.apiTokens.Run(context.Background())
+}
+
+// Start 监听并处理请求，直到 Shutdown 完成；监听失败时返回错误
+func (p *ProxyServer) Start() error {
+	handler := p.Handler()
+
+	log.Printf("Starting %s", GetBuildInfo())
+	log.Printf("Starting proxy server on %s", p.config.Listen)
+	log.Printf("Custom domain: %s", p.config.CustomDomain)
+	log.Printf("Cache directory: %s", p.config.CacheDir)
+	log.Printf("Cache enabled: %v", p.config.CacheEnabled)
+	log.Printf("Debug mode: %v", p.config.Debug)
+
+	// 打印路由配置
+	if p.config.Debug {
+		log.Println("Available routes:")
+		for host, upstream := range p.current().routes {
+			log.Printf("  %s -> %s", host, upstream)
+		}
+	}
+
+	p.server = &http.Server{
+		Addr:    p.config.Listen.Address,
+		Handler: handler,
+
+		ReadTimeout:       p.config.ServerReadTimeout,
+		WriteTimeout:      p.config.ServerWriteTimeout,
+		IdleTimeout:       p.config.ServerIdleTimeout,
+		ReadHeaderTimeout: p.config.ServerReadHeaderTimeout,
+		MaxHeaderBytes:    1 << 20, // 1MB
+	}
+	if tlsConfig := p.adminAuth.TLSConfig(); tlsConfig != nil {
+		if p.config.Listen.TLS() {
+			p.server.TLSConfig = tlsConfig
+		} else {
+			log.Println("ADMIN_CLIENT_CA is set but TLS is not enabled, client certificates cannot be used for admin auth")
+		}
+	}
+
+	// Shutdown 调用后 Serve 立即返回，等待排空与缓存写入完成后再退出
+	if err := p.config.Listen.Serve(p.server); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	<-p.stopped
+	return nil
+}
+
+// Shutdown 停止接受请求，等待进行中的传输（超时后强制断开）、缓存写入与客户端断开后继续的缓存填充完成，随后关闭缓存管理器：
+// ctx 结束时仍未完成的写入被取消（未提交的 blob 不会进入缓存），排队中的写入不再执行
+func (p *ProxyServer) Shutdown(ctx context.Context) error {
+	defer close(p.stopped)
+	var err error
+	if p.server != nil {
+		err = p.drainConnections(ctx)
+	}
+	// 等待已返回响应的缓存写入与后台缓存填充完成
+	if drainErr := p.cacheWrites.drain(ctx); err == nil {
+		err = drainErr
+	}
+	if drainErr := p.detach.wait(ctx); err == nil {
+		err = drainErr
+	}
+	if pending, detached := p.cacheWrites.pending.Load(), p.detach.active(); pending > 0 || detached > 0 {
+		log.Printf("Shutdown: cancelling %d pending cache writes and %d background cache fills", pending, detached)
+	}
+	p.apiTokens.SaveUsage()
+
+	// 取消生命周期 context，等待清理、GC 等后台任务与已取消的写入退出
+	p.cacheManager.Close()
+	grace, cancel := context.WithTimeout(context.Background(), cacheShutdownGrace)
+	defer cancel()
+	p.cacheWrites.drain(grace)
+	p.detach.wait(grace)
+	return err
+}
+
+// 健康检查处理器
+func (p *ProxyServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	health := map[string]interface{}{
+		"status":    "healthy",
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+		"version":   Version,
+		"uptime":    time.Since(startTime).String(),
+	}
+
+	// 深度模式：逐项检查缓存目录、磁盘空间、上游解析与可达性，并附带上游健康检查结果；
+	// 任一关键检查失败或所有上游均不可用时返回 503
+	statusCode := http.StatusOK
+	if r.URL.Query().Get("deep") == "true" {
+		status, checks := p.runHealthChecks(r.Context())
+		health["checks"] = checks
+		if p.upstreamHealth != nil {
+			upstreamStatus, upstreams := p.upstreamHealth.Summary()
+			health["upstreams"] = upstreams
+			if upstreamStatus == "unhealthy" || (upstreamStatus == "degraded" && status == "healthy") {
+				status = upstreamStatus
+			}
+		}
+		health["status"] = status
+		if status == "unhealthy" {
+			statusCode = http.StatusServiceUnavailable
+		}
+	}
+
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(health)
+}
+
+// 统计信息处理器
+func (p *ProxyServer) handleStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	stats := map[string]interface{}{
+		"uptime":  time.Since(startTime).String(),
+		"enabled": p.config.CacheEnabled,
+	}
+
+	if p.cacheManager != nil {
+		stats["cache"] = p.cacheManager.Stats()
+	}
+	if limits := p.limitStats(); limits != nil {
+		stats["limits"] = limits
+	}
+	if p.cluster != nil {
+		stats["cluster"] = p.cluster.Stats()
+	}
+	if p.replicator != nil {
+		stats["replication"] = p.replicator.Stats()
+	}
+	if p.foreignLayers != nil {
+		stats["foreignLayers"] = p.foreignLayers.Stats()
+	}
+	if p.adminAuth != nil {
+		stats["events"] = map[string]interface{}{
+			"subscribers": p.events.count.Load(),
+			"dropped":     p.events.dropped.Load(),
+		}
+	}
+	if len(p.current().helmRoutes) > 0 {
+		stats["helm"] = p.helmStats.Stats()
+	}
+	if len(p.current().fileMirrors) > 0 {
+		stats["fileMirror"] = p.mirrorStats.Stats()
+	}
+	if limits := p.rateLimits.Statuses(); len(limits) > 0 {
+		stats["upstreamRateLimits"] = limits
+	}
+
+	json.NewEncoder(w).Encode(stats)
+}
+
+// 详细缓存统计
+func (p *ProxyServer) handleCacheStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	stats := map[string]interface{}{
+		"config": map[string]interface{}{
+			"directory":   p.config.CacheDir,
+			"manifestTTL": p.cacheManager.ManifestTTL().String(),
+			"blobTTL":     p.cacheManager.BlobStore().TTL().String(),
+			"enabled":     p.config.CacheEnabled,
+		},
+	}
+
+	if p.cacheManager != nil {
+		stats["stats"] = p.cacheManager.Stats()
+	}
+	if p.platformFilter != nil {
+		stats["platformFilter"] = p.platformFilter.Stats()
+	}
+
+	json.NewEncoder(w).Encode(stats)
+}
+
+var startTime = time.Now()
+
+// 执行健康检查
+// PerformHealthCheck 请求自身的 /health，默认按监听配置（地址、Unix socket、TLS）确定目标
+func PerformHealthCheck(url string) {
+	target, client := loadListenConfig().HealthCheckTarget()
+	if url != "" {
+		target = url
+	}
+
+	resp, err := client.Get(target)
+	if err != nil {
+		log.Printf("Health check failed: %v", err)
+		os.Exit(1)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("Health check failed: status code %d", resp.StatusCode)
+		os.Exit(1)
+	}
+
+	log.Println("Health check passed")
+}
+
+func (p *ProxyServer) handleRoot(w http.ResponseWriter, r *http.Request) {
+	upstream := p.routeByHost(r.Host)
+	if upstream == "" {
+		// 返回可用路由信息与诊断
+		p.writeRoutesResponse(w, r)
+		return
+	}
+	http.Redirect(w, r, "/v2/", http.StatusMovedPermanently)
+}
+
+func (p *ProxyServer) handleV2Root(w http.ResponseWriter, r *http.Request) {
+	upstream := p.routeByHost(r.Host)
+	if upstream == "" {
+		if p.config.Debug {
+			log.Printf("[DEBUG] No upstream found for host: %s", r.Host)
+		}
+		p.writeRoutesResponse(w, r)
+		return
+	}
+
+	if p.config.Debug {
+		log.Printf("[DEBUG] /v2/ request - Host: %s, Upstream: %s", r.Host, upstream)
+	}
+
+	// 维护模式不访问上游，直接返回指向代理 /v2/auth 的认证挑战
+	if p.maintenance.active() != nil {
+		p.responseUnauthorized(w, r)
+		return
+	}
+
+	upstreamURL, _ := url.Parse(upstream + "/v2/")
+	req := p.createProxyRequest(r, upstreamURL)
+
+	// 检查是否需要认证（重试由 roundTrip 按重试策略处理）
+	resp, err := p.roundTrip(req)
+	if err != nil {
+		if p.config.Debug {
+			log.Printf("[DEBUG] /v2/ RoundTrip failed: %v", err)
+		}
+		attempts := p.timeoutsFromContext(r.Context()).Retries + 1
+		p.writeErrorResponse(w, fmt.Sprintf("upstream connection failed after %d attempts: %v", attempts, err), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	if p.config.Debug {
+		log.Printf("[DEBUG] /v2/ response status: %d", resp.StatusCode)
+	}
+
+	// 如果返回 401，返回认证挑战
+	if resp.StatusCode == http.StatusUnauthorized {
+		if p.config.Debug {
+			log.Printf("[DEBUG] /v2/ returning 401 auth challenge")
+		}
+		p.invalidateUpstreamAuth(upstreamURL.Host)
+		if wwwAuth, err := p.parseAuthenticate(resp.Header.Get("WWW-Authenticate")); err == nil {
+			p.authChallenges.Set(upstream, wwwAuth)
+		}
+		p.responseUnauthorized(w, r)
+		return
+	}
+
+	p.copyResponseRoundTrip(w, resp)
+}
+
+func (p *ProxyServer) handleAuth(w http.ResponseWriter, r *http.Request) {
+	upstream := p.routeByHost(r.Host)
+	if upstream == "" {
+		if p.config.Debug {
+			log.Printf("[DEBUG] /v2/auth - No upstream found for host: %s", r.Host)
+		}
+		p.writeRoutesResponse(w, r)
+		return
+	}
+
+	// 客户端可能携带多个 scope 参数（如跨仓库挂载），内部以空格连接
+	scope := strings.Join(r.URL.Query()["scope"], " ")
+	if p.config.Debug {
+		log.Printf("[DEBUG] /v2/auth - Host: %s, Upstream: %s, Scope: %s", r.Host, upstream, scope)
+	}
+
+	if p.maintenance.active() != nil {
+		p.writeMaintenanceToken(w, r)
+		return
+	}
+
+	// 优先使用缓存的认证挑战，签发 token 只需一次上游请求
+	wwwAuth, cached := p.authChallenges.Get(upstream)
+	if cached {
+		if p.config.Debug {
+			log.Printf("[DEBUG] /v2/auth using cached challenge for %s: realm=%s", upstream, wwwAuth["realm"])
+		}
+	} else {
+		var ok bool
+		if wwwAuth, ok = p.probeAuthChallenge(w, r, upstream); !ok {
+			return
+		}
+	}
+
+	// 处理Docker Hub library镜像的scope，以及 Harbor / Artifactory 的仓库前缀
+	originalScope := scope
+	flavor := p.flavorFor(upstream)
+	if flavor.Name == FlavorDockerHub && scope != "" {
+		scope = p.processDockerHubScope(scope)
+	}
+	scope = flavor.rewriteScope(scope)
+
+	// 自定义 scope 重写规则
+	scope = p.scopeRewriter.Rewrite(upstream, scope)
+	if p.config.Debug && scope != originalScope {
+		log.Printf("[DEBUG] /v2/auth scope rewritten: %s -> %s", originalScope, scope)
+	}
+
+	token, err := p.fetchTokenWithRoundTrip(r.Context(), wwwAuth, scope, r.Header.Get("Authorization"))
+	if err != nil {
+		if p.config.Debug {
+			log.Printf("[DEBUG] /v2/auth token fetch error: %v", err)
+		}
+		p.authChallenges.Invalidate(upstream)
+		p.writeErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer token.Body.Close()
+
+	// realm 可能已变更（404 / 5xx），丢弃缓存以便下次重新探测
+	if token.StatusCode == http.StatusNotFound || token.StatusCode >= 500 {
+		p.authChallenges.Invalidate(upstream)
+	}
+
+	if p.config.Debug {
+		log.Printf("[DEBUG] /v2/auth token fetched successfully, status: %d", token.StatusCode)
+	}
+
+	// 启用客户端认证时登记发放的上游 token，后续 /v2/* 请求据此校验
+	if p.clientAuth != nil {
+		body, err := p.clientAuth.RegisterUpstreamToken(token, ClientUserFromContext(r.Context()))
+		if err != nil {
+			p.writeErrorResponse(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		token.Body = io.NopCloser(bytes.NewReader(body))
+		token.Header.Del("Content-Length")
+	}
+
+	p.copyResponseRoundTrip(w, token)
+}
+
+// probeAuthChallenge 请求上游 /v2/ 获取认证挑战并缓存
+// 返回 false 时已向客户端写入响应
+func (p *ProxyServer) probeAuthChallenge(w http.ResponseWriter, r *http.Request, upstream string) (map[string]string, bool) {
+	upstreamURL, _ := url.Parse(upstream + "/v2/")
+	req := p.createProxyRequest(r, upstreamURL)
+	req.Method = "GET"
+
+	// 使用 RoundTrip 直接调用
+	resp, err := p.roundTrip(req)
+	if err != nil {
+		if p.config.Debug {
+			log.Printf("[DEBUG] /v2/auth RoundTrip error: %v", err)
+		}
+		p.writeErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		if p.config.Debug {
+			log.Printf("[DEBUG] /v2/auth unexpected status: %d", resp.StatusCode)
+		}
+		// 启用客户端认证时，上游无需认证也要发放代理 token
+		if p.clientAuth != nil && resp.StatusCode == http.StatusOK {
+			p.clientAuth.WriteProxyToken(w, ClientUserFromContext(r.Context()))
+			return nil, false
+		}
+		p.copyResponseRoundTrip(w, resp)
+		return nil, false
+	}
+
+	authenticateStr := resp.Header.Get("WWW-Authenticate")
+	if authenticateStr == "" {
+		if p.config.Debug {
+			log.Printf("[DEBUG] /v2/auth missing WWW-Authenticate header")
+		}
+		p.copyResponseRoundTrip(w, resp)
+		return nil, false
+	}
+
+	if p.config.Debug {
+		log.Printf("[DEBUG] /v2/auth WWW-Authenticate: %s", authenticateStr)
+	}
+
+	wwwAuth, err := p.parseAuthenticate(authenticateStr)
+	if err != nil {
+		if p.config.Debug {
+			log.Printf("[DEBUG] /v2/auth parse error: %v", err)
+		}
+		p.writeErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	p.authChallenges.Set(upstream, wwwAuth)
+	return wwwAuth, true
+}
+
+func (p *ProxyServer) handleV2Request(w http.ResponseWriter, r *http.Request) {
+	timing := timingFromContext(r.Context())
+	timing.markRouted()
+	upstream := p.routeByHost(r.Host)
+	if upstream == "" {
+		if p.config.Debug {
+			log.Printf("[DEBUG] /v2/* No upstream found for host: %s, path: %s", r.Host, r.URL.Path)
+		}
+		p.writeRoutesResponse(w, r)
+		return
+	}
+
+	if p.config.Debug {
+		log.Printf("[DEBUG] /v2/* Request - Method: %s, Host: %s, Path: %s, Upstream: %s",
+			r.Method, r.Host, r.URL.Path, upstream)
+	}
+
+	flavor := p.flavorFor(upstream)
+	isDockerHub := flavor.Name == FlavorDockerHub
+
+	// 处理Docker Hub library镜像重定向
+	if isDockerHub {
+		if redirectURL := p.processDockerHubLibraryRedirect(r.URL.Path); redirectURL != "" {
+			if p.config.Debug {
+				log.Printf("[DEBUG] /v2/* Library redirect: %s -> %s", r.URL.Path, redirectURL)
+			}
+			http.Redirect(w, r, redirectURL, http.StatusMovedPermanently)
+			return
+		}
+	}
+
+	// 生成缓存键
+	cacheKey := cache.CacheKey(r.Host, r.URL.Path)
+	if strings.Contains(r.URL.Path, "/referrers/") {
+		// OCI 1.1 Referrers API：按 artifactType 过滤的结果单独缓存
+		cacheKey = cache.ReferrersCacheKey(r.Host, r.URL.Path, r.URL.Query().Get("artifactType"))
+	}
+	// 路由禁用缓存时既不读取也不写入
+	isCacheableRequest := cache.IsCacheable(r.URL.Path) && (p.cacheManager == nil || !p.cacheManager.CachingDisabled(cacheKey))
+	isBlob := strings.Contains(r.URL.Path, "/blobs/")
+	isHead := r.Method == "HEAD"
+
+	// 检查缓存（如果启用）
+	if p.config.CacheEnabled && isCacheableRequest && p.cacheManager != nil {
+		lookupStart := time.Now()
+		// 对于 blob 使用流式传输
+		if isBlob {
+			entry, reader, found := p.cacheManager.GetBlobReader(cacheKey)
+			timing.add(PhaseCache, time.Since(lookupStart))
+			if found {
+				if p.config.Debug {
+					log.Printf("[DEBUG] /v2/* Cache HIT (streaming): %s", r.URL.Path)
+				}
+				if isHead {
+					reader.Close() // HEAD 请求不需要 body
+					p.serveCachedHeadEntry(w, entry)
+				} else {
+					p.serveCachedBlobStream(w, r, entry, reader)
+				}
+				return
+			}
+		} else if directive := clientCacheDirective(r); directive != clientCacheRefresh {
+			// manifest 等小文件使用内存缓存；客户端要求时先向上游确认
+			// 只含响应头的条目（来自 HEAD）只能响应 HEAD
+			entry, found := p.cacheManager.Get(cacheKey)
+			timing.add(PhaseCache, time.Since(lookupStart))
+			if found && (isHead || len(entry.Data) > 0) &&
+				(directive != clientCacheRevalidate || p.maintenance.active() != nil || p.revalidateManifest(r, upstream, cacheKey, entry)) {
+				if p.config.Debug {
+					log.Printf("[DEBUG] /v2/* Cache HIT: %s", r.URL.Path)
+				}
+				// 重启后过滤器状态为空，从命中的 manifest 重新学习
+				if p.platformFilter != nil && len(entry.Data) > 0 {
+					p.platformFilter.ObserveManifest(entry.Descriptor.Digest, entry.Data, entry.Descriptor.MediaType)
+				}
+				if isHead {
+					p.serveCachedHeadEntry(w, entry)
+				} else {
+					p.serveCachedEntry(w, entry)
+				}
+				return
+			}
+		}
+		if p.config.Debug {
+			log.Printf("[DEBUG] /v2/* Cache MISS: %s", r.URL.Path)
+		}
+	}
+
+	// 维护模式不回源：返回过期缓存或 503
+	if state := p.maintenance.active(); state != nil {
+		p.serveMaintenance(w, r, cacheKey, state)
+		return
+	}
+
+	// 上游因 429 暂停期间不回源：返回过期缓存或 429，由所有请求共同等待同一个 Retry-After
+	if upstreamURL, err := url.Parse(upstream); err == nil {
+		if wait := p.rateLimits.pausedFor(upstreamURL.Host); wait > 0 {
+			p.serveThrottled(w, r, cacheKey, wait)
+			return
+		}
+	}
+
+	// 请求去重：防止多个客户端同时拉取相同内容时重复请求上游
+	// 类似 distribution/distribution 的 inflight 机制；同一 manifest 的 HEAD 与 GET 共用一次上游请求
+	if p.config.CacheEnabled && isCacheableRequest && (r.Method == "GET" || (isHead && !isBlob)) && p.cacheManager != nil {
+		first, wait, done := p.cacheManager.TryInflight(cacheKey)
+
+		if !first {
+			// 不是第一个请求，等待第一个请求完成
+			if p.config.Debug {
+				log.Printf("[DEBUG] /v2/* Waiting for inflight request: %s", r.URL.Path)
+			}
+
+			result, err := wait(r.Context())
+			if err != nil {
+				// 请求被取消
+				if p.config.Debug {
+					log.Printf("[DEBUG] /v2/* Inflight wait cancelled: %v", err)
+				}
+				p.writeErrorResponse(w, "request cancelled", http.StatusRequestTimeout)
+				return
+			}
+
+			// 第一个请求已完成，从缓存获取结果
+			if result != nil && result.Cached {
+				// 对于 blob 使用流式传输
+				if isBlob {
+					if entry, reader, found := p.cacheManager.GetBlobReader(cacheKey); found {
+						if p.config.Debug {
+							log.Printf("[DEBUG] /v2/* Inflight cache HIT (streaming): %s", r.URL.Path)
+						}
+						p.serveCachedBlobStream(w, r, entry, reader)
+						return
+					}
+				} else if entry, found := p.cacheManager.Get(cacheKey); found && (isHead || len(entry.Data) > 0) {
+					if p.config.Debug {
+						log.Printf("[DEBUG] /v2/* Inflight cache HIT: %s", r.URL.Path)
+					}
+					if isHead {
+						p.serveCachedHeadEntry(w, entry)
+					} else {
+						p.serveCachedEntry(w, entry)
+					}
+					return
+				}
+			}
+
+			// 缓存获取失败，回退到直接请求（不进入 inflight 追踪，因为第一个请求已失败）
+			if p.config.Debug {
+				log.Printf("[DEBUG] /v2/* Inflight fallback to direct request: %s", r.URL.Path)
+			}
+			// 回退请求不缓存，避免重复尝试缓存失败的内容
+			upstreamURL, _ := url.Parse(upstream + flavor.upstreamPath(r.URL.Path))
+			upstreamURL.RawQuery = r.URL.RawQuery
+			// 等待期间进入维护模式，或第一个请求收到 429 后上游已暂停，不再逐个回源
+			if state := p.maintenance.active(); state != nil {
+				p.serveMaintenance(w, r, cacheKey, state)
+				return
+			}
+			if wait := p.rateLimits.pausedFor(upstreamURL.Host); wait > 0 {
+				p.serveThrottled(w, r, cacheKey, wait)
+				return
+			}
+			p.proxyRequestWithRoundTripAndKey(w, r, upstreamURL, false, "")
+			return
+		}
+
+		// 是第一个请求，需要执行实际工作
+		// 请求完成后调用 done 通知等待者
+		defer func() {
+			// 检查是否已缓存
+			// 对于 blob，需要验证文件实际存在而不仅仅是元数据（不打开内容）
+			cached := false
+			pathType, _, _ := cache.ParsePath(cacheKey)
+			if pathType == "blob" {
+				cached = p.cacheManager.HasBlob(cacheKey)
+			} else {
+				_, cached = p.cacheManager.Get(cacheKey)
+			}
+
+			done(&cache.InflightResult{
+				CacheKey: cacheKey,
+				Cached:   cached,
+			})
+		}()
+	}
+
+	// manifest HEAD 未命中：向上游发送 GET 缓存完整内容，随后的 GET 直接命中。
+	// 响应仍按 HEAD 返回，只发送响应头
+	if isHead && !isBlob && p.config.ManifestHeadFetch && p.config.CacheEnabled && isCacheableRequest && p.cacheManager != nil {
+		w, r = headOnlyWriter{w}, manifestHeadAsGet(r)
+	}
+
+	// 转发请求
+	upstreamURL, _ := url.Parse(upstream + flavor.upstreamPath(r.URL.Path))
+	upstreamURL.RawQuery = r.URL.RawQuery
+
+	p.proxyRequestWithRoundTripAndKey(w, r, upstreamURL, isCacheableRequest, cacheKey)
+}
+
+// proxyRequestWithRoundTripAndKey 使用 RoundTrip 进行底层代理控制（带缓存键）
+func (p *ProxyServer) proxyRequestWithRoundTripAndKey(w http.ResponseWriter, r *http.Request, targetURL *url.URL, enableCache bool, cacheKey string) {
+	if p.config.Debug {
+		log.Printf("[DEBUG] Proxy request to: %s", targetURL.String())
+	}
+
+	// 创建代理请求
+	req := p.createProxyRequest(r, targetURL)
+
+	// 可缓存内容：客户端断开后上游传输继续，保证内容写入缓存
+	if enableCache {
+		var release func()
+		req, release = p.detachCacheFill(r, req)
+		defer release()
+	}
+
+	// 上游并发已满时排队，排队失败返回 503
+	releaseSlot, ok := p.upstreamLimit.Acquire(r.Context())
+	if !ok {
+		p.writeOverloaded(w, p.upstreamLimit)
+		return
+	}
+	defer releaseSlot()
+
+	// 集群中其他节点已缓存（或归属其他节点）的 blob 先从节点获取，否则回源上游
+	// （配置了分流的路由按权重选择上游，配置了镜像的 manifest 请求会对冲）
+	resp, cacheable := p.cluster.fetchBlob(r, req)
+	fromPeer := resp != nil
+	var err error
+	if !fromPeer {
+		resp, err = p.roundTripSplit(r, req)
+	} else if !cacheable {
+		enableCache = false
+	}
+	if err != nil {
+		if p.config.Debug {
+			log.Printf("[DEBUG] Proxy RoundTrip error: %v", err)
+		}
+		p.writeErrorResponse(w, fmt.Sprintf("transport error: %v", err), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	if !fromPeer {
+		p.observeChainedResponse(targetURL.Host, resp)
+		p.flavorFor(targetURL.Host).rewriteResponse(resp)
+	}
+
+	if p.config.Debug {
+		log.Printf("[DEBUG] Proxy response status: %d from %s", resp.StatusCode, targetURL.Host)
+	}
+
+	// 处理认证
+	if resp.StatusCode == http.StatusUnauthorized {
+		if p.config.Debug {
+			log.Printf("[DEBUG] Proxy got 401, returning auth challenge")
+		}
+		p.invalidateUpstreamAuth(targetURL.Host)
+		p.responseUnauthorized(w, r)
+		return
+	}
+
+	// 上游限流：有过期缓存时返回过期内容，否则透传 429（含上游的 Retry-After）
+	if resp.StatusCode == http.StatusTooManyRequests && p.serveStale(w, r, cacheKey) {
+		return
+	}
+
+	// 处理重定向 (301, 302, 303, 307, 308)
+	// 对于 AWS S3 等外部存储的重定向,直接返回给客户端让其直接下载
+	// 这样避免代理服务器处理 AWS 签名等复杂问题
+	if isRedirect(resp.StatusCode) {
+		location := resp.Header.Get("Location")
+		if location != "" {
+			if p.config.Debug {
+				log.Printf("[DEBUG] Proxy got redirect %d to: %s", resp.StatusCode, location)
+			}
+
+			// 检查重定向目标（相对地址按上游地址解析）
+			redirectURL, err := targetURL.Parse(location)
+			if err == nil && hasRequestBody(req) {
+				// 带请求体的请求（推送）不能改为 GET 跟随，按原方法和请求体重发或交给客户端
+				if p.shouldFollowRedirect(redirectURL.Host) {
+					p.resendRedirect(w, req, resp, redirectURL)
+				} else {
+					p.copyResponseRoundTrip(w, resp)
+				}
+				return
+			}
+			if err == nil {
+				// 决定是否跟随重定向（REDIRECT_RULES，其次 FOLLOW_ALL_REDIRECTS 与黑名单域名）
+				if p.shouldFollowRedirect(redirectURL.Host) {
+					if p.config.Debug {
+						log.Printf("[DEBUG] Following redirect to %s server-side", redirectURL.Host)
+					}
+					// 跟随重定向并缓存内容
+					p.followRedirectWithCache(w, r, targetURL, redirectURL, cacheKey, enableCache)
+					return
+				}
+
+				// 非黑名单域名:直接返回重定向响应给客户端
+				// 这些域名可以正常访问 (如 AWS S3, Cloudflare R2, GCS, Azure Blob 等)
+				// 让客户端自己处理重定向,减少代理服务器负担和流量
+				if p.config.Debug {
+					log.Printf("[DEBUG] Non-blocked host (%s), returning redirect to client", redirectURL.Host)
+				}
+				p.copyResponseRoundTrip(w, resp)
+				return
+			}
+		}
+	}
+
+	// 大 blob 并行分块下载，否则在传输中断时自动续传
+	if strings.Contains(r.URL.Path, "/blobs/") && !fromPeer {
+		digest := cache.GetDigestFromPath(r.URL.Path)
+		if p.wrapParallel(req, resp, digest) || p.wrapResumable(req, resp, digest) {
+			defer resp.Body.Close()
+		}
+	}
+
+	shouldCache := p.config.CacheEnabled && enableCache && cache.IsCacheable(r.URL.Path) && p.cacheManager != nil
+
+	if shouldCache {
+		// 使用传入的 cacheKey，如果为空则生成新的
+		if cacheKey == "" {
+			cacheKey = cache.CacheKey(r.Host, r.URL.Path)
+		}
+		p.copyResponseWithCacheRoundTrip(w, resp, cacheKey, true)
+	} else {
+		p.copyResponseWithCacheRoundTrip(w, resp, "", false)
+	}
+}
+
+// 检查域名是否在黑名单中
+func (p *ProxyServer) isBlockedHost(host string) bool {
+	for _, pattern := range p.current().blockedHosts {
+		if strings.Contains(host, pattern) {
+			if p.config.Debug {
+				log.Printf("[DEBUG] Host %s matched blocked pattern: %s", host, pattern)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// 使用 RoundTrip 获取 token
+func (p *ProxyServer) fetchTokenWithRoundTrip(ctx context.Context, wwwAuth map[string]string, scope, authorization string) (*http.Response, error) {
+	tokenURL, err := url.Parse(wwwAuth["realm"])
+	if err != nil {
+		return nil, err
+	}
+
+	q := tokenURL.Query()
+	if service, exists := wwwAuth["service"]; exists && service != "" {
+		q.Set("service", service)
+	}
+	// 多个 scope 按规范分别作为 scope 参数发送，GitLab 等 token 服务不接受空格连接的 scope
+	for _, item := range strings.Fields(scope) {
+		q.Add("scope", item)
+	}
+	tokenURL.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", tokenURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	// 设置 User-Agent
+	p.setUserAgent(req)
+
+	return p.roundTrip(req)
+}
+
+func (p *ProxyServer) routeByHost(host string) string {
+	originalHost := host
+	// 移除端口号
+	if idx := strings.Index(host, ":"); idx != -1 {
+		host = host[:idx]
+	}
+
+	if upstream, exists := p.current().routes[host]; exists {
+		if p.config.Debug {
+			log.Printf("[DEBUG] Route matched: %s -> %s", originalHost, upstream)
+		}
+		return upstream
+	}
+
+	// 调试模式下的默认上游
+	if p.config.Debug {
+		log.Printf("[DEBUG] No route found for host: %s", originalHost)
+		if targetUpstream := p.config.TargetUpstream; targetUpstream != "" {
+			log.Printf("[DEBUG] 使用 TARGET_UPSTREAM: %s", targetUpstream)
+			return targetUpstream
+		}
+	}
+
+	return ""
+}
+
+func (p *ProxyServer) processDockerHubLibraryRedirect(path string) string {
+	parts := strings.Split(path, "/")
+	if len(parts) == 5 && parts[1] == "v2" {
+		newPath := strings.Join(append(parts[:2], append([]string{"library"}, parts[2:]...)...), "/")
+		if p.config.Debug {
+			log.Printf("[DEBUG] Docker Hub library redirect: %s -> %s", path, newPath)
+		}
+		return newPath
+	}
+	return ""
+}
+
+func (p *ProxyServer) processDockerHubScope(scope string) string {
+	scopes := strings.Fields(scope)
+	for i, item := range scopes {
+		parts := strings.Split(item, ":")
+		if len(parts) == 3 && !strings.Contains(parts[1], "/") {
+			scopes[i] = strings.Join([]string{parts[0], "library/" + parts[1], parts[2]}, ":")
+			if p.config.Debug {
+				log.Printf("[DEBUG] Docker Hub scope rewrite: %s -> %s", item, scopes[i])
+			}
+		}
+	}
+	return strings.Join(scopes, " ")
+}
+
+func (p *ProxyServer) parseAuthenticate(authenticateStr string) (map[string]string, error) {
+	re := regexp.MustCompile(`(\w+)="([^"]*)"`)
+	matches := re.FindAllStringSubmatch(authenticateStr, -1)
+
+	result := make(map[string]string)
+	for _, match := range matches {
+		if len(match) == 3 {
+			result[match[1]] = match[2]
+		}
+	}
+
+	if _, hasRealm := result["realm"]; !hasRealm {
+		return nil, fmt.Errorf("invalid WWW-Authenticate header: %s", authenticateStr)
+	}
+
+	return result, nil
+}
+
+func (p *ProxyServer) responseUnauthorized(w http.ResponseWriter, r *http.Request) {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	// 使用 hostname 而不是 host（与原版保持一致）
+	hostname := clientHost(r)
+	if idx := strings.Index(hostname, ":"); idx != -1 {
+		hostname = hostname[:idx]
+	}
+
+	var authHeader string
+	if p.config.Debug {
+		authHeader = fmt.Sprintf(`Bearer realm="%s://%s/v2/auth",service="go-docker-proxy"`, scheme, clientHost(r))
+	} else {
+		authHeader = fmt.Sprintf(`Bearer realm="%s://%s/v2/auth",service="go-docker-proxy"`, scheme, hostname)
+	}
+
+	w.Header().Set("WWW-Authenticate", authHeader)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "UNAUTHORIZED",
+	})
+}
+
+func (p *ProxyServer) createProxyRequest(originalReq *http.Request, targetURL *url.URL) *http.Request {
+	body, contentLength := p.proxyRequestBody(originalReq)
+	req, _ := http.NewRequestWithContext(
+		originalReq.Context(),
+		originalReq.Method,
+		targetURL.String(),
+		body,
+	)
+	if req.GetBody == nil && body != nil {
+		req.ContentLength = contentLength // 流式请求体
+	}
+
+	// 复制关键请求头，过滤不需要的头
+	skipHeaders := map[string]bool{
+		"Connection":       true,
+		"Proxy-Connection": true,
+		"Upgrade":          true,
+		"Host":             true,
+		"Content-Length":   true, // 由 req.ContentLength 决定
+	}
+
+	for key, values := range originalReq.Header {
+		if !skipHeaders[key] {
+			for _, value := range values {
+				req.Header.Add(key, value)
+			}
+		}
+	}
+
+	// 设置正确的 Host
+	req.Host = targetURL.Host
+	req.Header.Set("Host", targetURL.Host)
+
+	// 设置 User-Agent
+	p.setClientUserAgent(req, originalReq.Header.Get("User-Agent"))
+
+	// 私有上游：注入代理持有的凭据
+	p.authorizeUpstream(req)
+
+	// 按路由改写请求头（可以覆盖上面设置的值）
+	p.headerRules.ApplyRequest(originalReq, req)
+
+	return req
+}
+
+// 专门为 RoundTrip 优化的响应复制（支持大文件流式传输）
+func (p *ProxyServer) copyResponseRoundTrip(w http.ResponseWriter, resp *http.Response) {
+	// 复制响应头，过滤不需要的头
+	skipHeaders := map[string]bool{
+		"Connection":        true,
+		"Proxy-Connection":  true,
+		"Upgrade":           true,
+		"Transfer-Encoding": true,
+		"Content-Length":    false, // 保留 Content-Length
+	}
+
+	for key, values := range resp.Header {
+		if !skipHeaders[key] {
+			for _, value := range values {
+				w.Header().Add(key, value)
+			}
+		}
+	}
+
+	w.WriteHeader(resp.StatusCode)
+
+	// 使用大缓冲区流式传输，支持大文件
+	if resp.Body != nil {
+		p.streamCopy(w, resp.Body)
+	}
+}
+
+// streamCopy 高效流式复制，支持大文件传输
+func (p *ProxyServer) streamCopy(dst io.Writer, src io.Reader) (written int64, err error) {
+	// 使用 bufio 包装，提高读取效率
+	bufReader := bufio.NewReaderSize(src, streamBufferSize)
+	buf := make([]byte, streamBufferSize)
+
+	// 尝试获取 Flusher 接口，用于实时刷新数据到客户端
+	flusher, canFlush := dst.(http.Flusher)
+
+	for {
+		nr, readErr := bufReader.Read(buf)
+		if nr > 0 {
+			nw, writeErr := dst.Write(buf[:nr])
+			if nw > 0 {
+				written += int64(nw)
+			}
+			if writeErr != nil {
+				err = writeErr
+				break
+			}
+			if nr != nw {
+				err = io.ErrShortWrite
+				break
+			}
+			// 定期刷新，确保数据及时发送到客户端
+			if canFlush {
+				flusher.Flush()
+			}
+		}
+		if readErr != nil {
+			if readErr != io.EOF {
+				err = readErr
+			}
+			break
+		}
+	}
+	return written, err
+}
+
+// 带缓存的响应复制（RoundTrip版本，支持大文件流式传输）
+func (p *ProxyServer) copyResponseWithCacheRoundTrip(w http.ResponseWriter, resp *http.Response, cacheKey string, shouldStore bool) {
+	skipHeaders := map[string]bool{
+		"Connection":        true,
+		"Proxy-Connection":  true,
+		"Upgrade":           true,
+		"Transfer-Encoding": true,
+	}
+
+	headersToCache := make(map[string][]string)
+	for key, values := range resp.Header {
+		if skipHeaders[key] {
+			continue
+		}
+		headersToCache[key] = append(headersToCache[key], values...)
+	}
+
+	for key, values := range headersToCache {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	// 上游代理的缓存状态只属于本次响应，不随缓存内容重放
+	delete(headersToCache, headerCacheUpstream)
+
+	if resp.Body == nil {
+		w.WriteHeader(resp.StatusCode)
+		return
+	}
+
+	// 判断请求类型
+	method := ""
+	if resp.Request != nil {
+		method = resp.Request.Method
+	}
+	isManifest := strings.Contains(cacheKey, "/manifests/")
+	isBlob := strings.Contains(cacheKey, "/blobs/") // referrers 路径中的 digest 是 subject，不是响应内容的 digest
+
+	// HEAD 请求：对于 manifest 需要缓存 headers，其他直接返回
+	if method == "HEAD" {
+		if isManifest && resp.StatusCode == http.StatusOK && shouldStore && p.cacheManager != nil && p.cacheManager.TTLFor(cacheKey, resp.Header) > 0 {
+			// manifest HEAD 请求，缓存 headers 后返回
+			w.Header().Set("X-Cache", "MISS")
+			w.WriteHeader(resp.StatusCode)
+
+			// 异步存储 headers 到缓存：只含响应头，队列已满时可以丢弃
+			p.cacheWrites.submit(cacheKey, true, func(context.Context) {
+				mediaType := ""
+				if ct, ok := headersToCache["Content-Type"]; ok && len(ct) > 0 {
+					mediaType = ct[0]
+				}
+
+				digest := ""
+				if dcd, ok := headersToCache["Docker-Content-Digest"]; ok && len(dcd) > 0 {
+					digest = dcd[0]
+				}
+
+				// 从 Content-Length 获取大小
+				size := int64(0)
+				if cl, ok := headersToCache["Content-Length"]; ok && len(cl) > 0 {
+					if parsedSize, err := strconv.ParseInt(cl[0], 10, 64); err == nil {
+						size = parsedSize
+					}
+				}
+
+				entry := &cache.CacheEntry{
+					Descriptor: cache.Descriptor{
+						Digest:    digest,
+						Size:      size,
+						MediaType: mediaType,
+					},
+					Headers:    headersToCache,
+					StatusCode: resp.StatusCode,
+					CachedAt:   time.Now(),
+					ExpiresAt:  time.Now().Add(p.cacheManager.TTLFor(cacheKey, resp.Header)),
+				}
+				p.cacheManager.Put(cacheKey, entry)
+				p.afterCacheFill(cacheKey, entry)
+				if p.config.Debug {
+					log.Printf("[DEBUG] Cached manifest HEAD response: %s", cacheKey)
+				}
+			})
+			return
+		}
+		// 非 manifest HEAD 请求，直接返回
+		w.WriteHeader(resp.StatusCode)
+		return
+	}
+
+	// 仅属于排除平台的 blob：照常传输但不缓存
+	if shouldStore && isBlob && p.platformFilter.SkipBlob(cache.GetDigestFromPath(cacheKey)) {
+		if p.config.Debug {
+			log.Printf("[DEBUG] Skipping cache for excluded platform blob: %s", cacheKey)
+		}
+		w.Header().Set("X-Cache", "BYPASS")
+		shouldStore = false
+	}
+
+	// 不需要缓存或非 200 响应，直接流式传输
+	if !shouldStore || resp.StatusCode != http.StatusOK || p.cacheManager == nil {
+		w.WriteHeader(resp.StatusCode)
+		if _, err := p.streamCopy(w, resp.Body); err != nil {
+			if p.config.Debug {
+				log.Printf("[DEBUG] Stream copy error: %v", err)
+			}
+		}
+		return
+	}
+
+	// 检查 Content-Length，判断是否为大文件
+	contentLength := resp.ContentLength
+	if contentLength < 0 {
+		// 尝试从 Header 获取
+		if clStr := resp.Header.Get("Content-Length"); clStr != "" {
+			if cl, err := strconv.ParseInt(clStr, 10, 64); err == nil {
+				contentLength = cl
+			}
+		}
+	}
+
+	// blob：边传输边写入缓存，校验 digest 后提交（长度未知时写入中超过上限则放弃缓存）
+	if digest := cache.GetDigestFromPath(cacheKey); isBlob && digest != "" && contentLength <= p.config.CacheMaxBlobSize {
+		p.streamBlobToCache(w, resp, cacheKey, digest, contentLength, headersToCache)
+		return
+	}
+
+	// 大文件：直接流式传输，不缓存到内存
+	if contentLength > p.config.CacheMaxBlobSize || contentLength < 0 {
+		if p.config.Debug {
+			if contentLength > 0 {
+				log.Printf("[DEBUG] Large file detected (%d bytes), streaming without memory cache: %s",
+					contentLength, cacheKey)
+			} else {
+				log.Printf("[DEBUG] Unknown content length, streaming without memory cache: %s", cacheKey)
+			}
+		}
+		w.Header().Set("X-Cache", "BYPASS")
+		w.WriteHeader(resp.StatusCode)
+		if _, err := p.streamCopy(w, resp.Body); err != nil {
+			if p.config.Debug {
+				log.Printf("[DEBUG] Large file stream error: %v", err)
+			}
+		}
+		return
+	}
+
+	// 小文件：读取到内存并缓存
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		w.WriteHeader(resp.StatusCode)
+		if len(bodyBytes) > 0 {
+			_, _ = w.Write(bodyBytes)
+		}
+		if p.config.Debug {
+			log.Printf("[DEBUG] Cache read error: %v", err)
+		}
+		return
+	}
+
+	// 上游要求不缓存（no-store / max-age=0 等）且未配置下限时直接返回
+	ttl := p.cacheManager.TTLFor(cacheKey, resp.Header)
+	if ttl <= 0 {
+		if p.config.Debug {
+			log.Printf("[DEBUG] Upstream freshness is zero, not caching: %s", cacheKey)
+		}
+		w.Header().Set("X-Cache", "BYPASS")
+		w.WriteHeader(resp.StatusCode)
+		_, _ = w.Write(bodyBytes)
+		return
+	}
+
+	// 验证响应内容：只缓存有效的响应
+	if len(bodyBytes) == 0 {
+		if p.config.Debug {
+			log.Printf("[DEBUG] Skipping cache for empty response: %s", cacheKey)
+		}
+		w.WriteHeader(resp.StatusCode)
+		return
+	}
+
+	headersToCache["Content-Length"] = []string{strconv.Itoa(len(bodyBytes))}
+
+	w.Header().Set("X-Cache", "MISS")
+	w.WriteHeader(resp.StatusCode)
+	_, _ = w.Write(bodyBytes)
+
+	// 获取 mediaType
+	mediaType := ""
+	if ct, ok := headersToCache["Content-Type"]; ok && len(ct) > 0 {
+		mediaType = ct[0]
+	}
+
+	entry := &cache.CacheEntry{
+		Descriptor: cache.Descriptor{
+			Size:      int64(len(bodyBytes)),
+			MediaType: mediaType,
+		},
+		Data:       bodyBytes,
+		Headers:    headersToCache,
+		StatusCode: resp.StatusCode,
+		CachedAt:   time.Now(),
+		ExpiresAt:  time.Now().Add(ttl),
+	}
+	// 小文件同步写入缓存：请求结束时条目已可读，合并到本请求的 HEAD/GET 直接从缓存响应
+	stored := p.cacheManager.Put(cacheKey, entry) == nil
+
+	// 其余处理异步执行
+	p.cacheWrites.submit(cacheKey, false, func(ctx context.Context) {
+		if stored {
+			p.afterCacheFill(cacheKey, entry)
+		}
+
+		if isManifest {
+			digest := ""
+			if dcd, ok := headersToCache["Docker-Content-Digest"]; ok && len(dcd) > 0 {
+				digest = dcd[0]
+			}
+			p.platformFilter.ObserveManifest(digest, bodyBytes, mediaType)
+			p.cacheManifestByDigest(cacheKey, digest, entry)
+		}
+
+		// manifest list / image index：预取配置平台的 manifest
+		if isManifest && IsIndexMediaType(mediaType) {
+			p.prefetchPlatformManifests(ctx, cacheKey, resp.Request, bodyBytes, mediaType)
+		}
+	})
+}
+
+// afterCacheFill 内容写入缓存后的处理：发送通知、提交漏洞扫描、调用扩展钩子
+func (p *ProxyServer) afterCacheFill(cacheKey string, entry *cache.CacheEntry) {
+	p.notifyCacheFill(cacheKey, entry)
+	p.scanCacheFill(cacheKey, entry)
+	p.hookCacheFill(cacheKey, entry)
+}
+
+// serveCachedEntry 提供缓存响应（用于小文件如 manifest）
+func (p *ProxyServer) serveCachedEntry(w http.ResponseWriter, entry *cache.CacheEntry) {
+	for key, values := range entry.Headers {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+
+	w.Header().Set("X-Cache", "HIT")
+	w.WriteHeader(entry.StatusCode)
+	if len(entry.Data) > 0 {
+		_, _ = w.Write(entry.Data)
+	}
+}
+
+// serveCachedHeadEntry 提供 HEAD 请求的缓存响应（只返回 headers）
+func (p *ProxyServer) serveCachedHeadEntry(w http.ResponseWriter, entry *cache.CacheEntry) {
+	for key, values := range entry.Headers {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+
+	w.Header().Set("X-Cache", "HIT")
+	w.WriteHeader(entry.StatusCode)
+	// HEAD 请求不返回 body
+}
+
+// serveCachedBlobStream 流式提供 blob 缓存响应（用于大文件）
+// 缓存文件可 Seek 时使用 http.ServeContent：支持 Range / If-None-Match / If-Modified-Since，
+// 且直接写入连接时由内核 sendfile 零拷贝发送
+func (p *ProxyServer) serveCachedBlobStream(w http.ResponseWriter, r *http.Request, entry *cache.CacheEntry, reader io.ReadCloser) {
+	defer reader.Close()
+
+	for key, values := range entry.Headers {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+
+	w.Header().Set("X-Cache", "HIT")
+
+	if rs, ok := reader.(io.ReadSeeker); ok && entry.StatusCode == http.StatusOK {
+		// Content-Length 由 ServeContent 按实际范围设置
+		w.Header().Del("Content-Length")
+		if entry.Descriptor.Digest != "" {
+			w.Header().Set("ETag", `"`+entry.Descriptor.Digest+`"`)
+		}
+		modTime := entry.CachedAt
+		if f, ok := reader.(*os.File); ok && modTime.IsZero() {
+			if info, err := f.Stat(); err == nil {
+				modTime = info.ModTime()
+			}
+		}
+		http.ServeContent(w, r, "", modTime, rs)
+		return
+	}
+
+	w.WriteHeader(entry.StatusCode)
+
+	// 使用流式复制，不占用大量内存
+	if _, err := p.streamCopy(w, reader); err != nil {
+		if p.config.Debug {
+			log.Printf("[DEBUG] Blob stream copy error: %v", err)
+		}
+	}
+}
+
+func (p *ProxyServer) writeErrorResponse(w http.ResponseWriter, message string, statusCode int) {
+	id := w.Header().Get(middleware.RequestIDHeader)
+	if statusCode >= http.StatusInternalServerError {
+		log.Printf("Request %s failed: %d %s", id, statusCode, message)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":     message,
+		"requestId": id,
+	})
+}
+
+func (p *ProxyServer) writeJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeRegistryError 返回 Docker Registry / OCI 规范格式的错误，客户端会显示 message，
+// 请求 ID 放在 detail 中
+func (p *ProxyServer) writeRegistryError(w http.ResponseWriter, statusCode int, code, message string) {
+	id := w.Header().Get(middleware.RequestIDHeader)
+	if statusCode >= http.StatusInternalServerError {
+		log.Printf("Request %s failed: %d %s: %s", id, statusCode, code, message)
+	}
+	p.writeJSON(w, statusCode, map[string]interface{}{
+		"errors": []map[string]interface{}{
+			{"code": code, "message": message, "detail": map[string]string{"requestId": id}},
+		},
+	})
+}
+
+func getEnv(key, defaultValue string) string {
+	if value, _ := lookupEnv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvList 读取逗号分隔的环境变量列表，忽略空白项
+func getEnvList(key string) []string {
+	var result []string
+	value, _ := lookupEnv(key)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// parseDuration 解析时间间隔字符串，支持扩展格式，无效时使用默认值
+// 支持格式: 1h, 24h, 1d, 7d, 30d, 1y, 365d 等
+// 标准格式: h(小时), m(分钟), s(秒)
+// 扩展格式: d(天), w(周), M(月=30天), y(年=365天)
+func parseDuration(s string, defaultValue time.Duration) time.Duration {
+	if strings.TrimSpace(s) == "" {
+		return defaultValue
+	}
+	d, err := parseDurationValue(s)
+	if err != nil {
+		return defaultValue
+	}
+	return d
+}
+
+// parseDurationValue 严格解析时间间隔字符串（格式同 parseDuration），供配置校验报告错误
+func parseDurationValue(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+
+	// 先尝试标准格式
+	if d, err := time.ParseDuration(s); err == nil {
+		return d, nil
+	}
+
+	// 处理扩展格式
+	var multiplier time.Duration
+	var numStr string
+
+	switch {
+	case strings.HasSuffix(s, "y"):
+		multiplier = 365 * 24 * time.Hour
+		numStr = strings.TrimSuffix(s, "y")
+	case strings.HasSuffix(s, "M"):
+		multiplier = 30 * 24 * time.Hour
+		numStr = strings.TrimSuffix(s, "M")
+	case strings.HasSuffix(s, "w"):
+		multiplier = 7 * 24 * time.Hour
+		numStr = strings.TrimSuffix(s, "w")
+	case strings.HasSuffix(s, "d"):
+		multiplier = 24 * time.Hour
+		numStr = strings.TrimSuffix(s, "d")
+	default:
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+
+	num, err := strconv.ParseFloat(strings.TrimSpace(numStr), 64)
+	if err != nil || num < 0 {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+
+	return time.Duration(float64(multiplier) * num), nil
+}
+
+// parseInt 解析整数配置，无效时使用默认值
+func parseInt(s string, defaultValue int) int {
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return defaultValue
+	}
+	return n
+}
+
+// parseCacheQuotas 解析 CACHE_QUOTAS（pattern=size，逗号分隔，按顺序匹配）
+func parseCacheQuotas(entries []string) []cache.Quota {
+	var quotas []cache.Quota
+	for _, entry := range entries {
+		pattern, size, ok := strings.Cut(entry, "=")
+		pattern = strings.Trim(strings.TrimSpace(pattern), "/")
+		maxSize, err := parseSizeValue(size)
+		if !ok || pattern == "" || err != nil || maxSize <= 0 {
+			log.Printf("Ignoring invalid CACHE_QUOTAS entry %q (expected repo/pattern=size)", entry)
+			continue
+		}
+		quotas = append(quotas, cache.Quota{Pattern: pattern, MaxSize: maxSize})
+	}
+	return quotas
+}
+
+// parseCacheTTLOverrides 解析 CACHE_TTL_OVERRIDES（host=manifest:1h;blob:30d 或 host=off，逗号分隔）
+func parseCacheTTLOverrides(entries []string) map[string]cache.TTLOverride {
+	if len(entries) == 0 {
+		return nil
+	}
+	overrides := make(map[string]cache.TTLOverride)
+	for _, entry := range entries {
+		host, override, ok := parseCacheTTLOverride(entry)
+		if !ok {
+			log.Printf("Ignoring invalid CACHE_TTL_OVERRIDES entry %q (expected host=manifest:1h;blob:30d or host=off)", entry)
+			continue
+		}
+		overrides[host] = override
+	}
+	return overrides
+}
+
+// parseCacheTTLOverride 解析单个路由的固定有效期，只给出其中一类时另一类沿用全局设置；off 表示该路由不缓存
+func parseCacheTTLOverride(entry string) (string, cache.TTLOverride, bool) {
+	var override cache.TTLOverride
+	host, spec, ok := strings.Cut(entry, "=")
+	host = strings.ToLower(strings.TrimSpace(host))
+	if !ok || host == "" {
+		return "", override, false
+	}
+	if strings.TrimSpace(spec) == "off" {
+		override.Disabled = true
+		return host, override, true
+	}
+	for _, item := range strings.Split(spec, ";") {
+		class, value, _ := strings.Cut(strings.TrimSpace(item), ":")
+		ttl, err := parseDurationValue(value)
+		if err != nil || ttl <= 0 {
+			return "", override, false
+		}
+		switch strings.TrimSpace(class) {
+		case cache.ContentClassManifest:
+			override.Manifest = ttl
+		case cache.ContentClassBlob:
+			override.Blob = ttl
+		default:
+			return "", override, false
+		}
+	}
+	return host, override, true
+}
+
+// parseFloat 解析小数配置，无效时使用默认值
+func parseFloat(s string, defaultValue float64) float64 {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return defaultValue
+	}
+	return f
+}
@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRouteOverrides(t *testing.T) {
+	t.Setenv("EXTRA_ROUTES", "harbor=harbor.example.com/,quay=https://quay.mirror.example.com")
+	t.Setenv("DISABLED_ROUTES", "cloudsmith")
+	routes := buildRoutes("example.com")
+
+	want := map[string]string{
+		"nvcr.example.com":   "https://nvcr.io",
+		"ollama.example.com": "https://registry.ollama.ai",
+		"harbor.example.com": "https://harbor.example.com",
+		"quay.example.com":   "https://quay.mirror.example.com",
+	}
+	for host, upstream := range want {
+		if routes[host] != upstream {
+			t.Errorf("route %s = %q, want %q", host, routes[host], upstream)
+		}
+	}
+	if upstream, ok := routes["cloudsmith.example.com"]; ok {
+		t.Errorf("disabled route still present: %s", upstream)
+	}
+}
+
+func TestCachedBlobConditionalAndRangeRequests(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	layer := []byte("0123456789abcdef")
+	_, layers := upstream.addImage("team/app", "v1", layer)
+	p, client := newTestProxy(t, upstream, nil)
+
+	client.login("team/app")
+	client.pull("team/app", "v1")
+	waitCached(t, p, "team/app", "v1", layers)
+	blobPath := "/v2/team/app/blobs/" + layers[0]
+	etag := `"` + layers[0] + `"`
+
+	cases := []struct {
+		name   string
+		header http.Header
+		status int
+		body   string
+	}{
+		{"range", http.Header{"Range": {"bytes=2-5"}}, http.StatusPartialContent, "2345"},
+		{"suffix range", http.Header{"Range": {"bytes=-3"}}, http.StatusPartialContent, "def"},
+		{"if-range matching etag", http.Header{"Range": {"bytes=10-"}, "If-Range": {etag}}, http.StatusPartialContent, "abcdef"},
+		{"if-range stale etag", http.Header{"Range": {"bytes=10-"}, "If-Range": {`"sha256:other"`}}, http.StatusOK, string(layer)},
+		{"if-none-match", http.Header{"If-None-Match": {etag}}, http.StatusNotModified, ""},
+		{"if-modified-since later", http.Header{"If-Modified-Since": {time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)}}, http.StatusNotModified, ""},
+		{"if-modified-since earlier", http.Header{"If-Modified-Since": {time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)}}, http.StatusOK, string(layer)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, body := client.do(http.MethodGet, blobPath, tc.header)
+			if resp.StatusCode != tc.status || string(body) != tc.body {
+				t.Errorf("response = %d %q, want %d %q", resp.StatusCode, body, tc.status, tc.body)
+			}
+			if got := resp.Header.Get("X-Cache"); got != "HIT" {
+				t.Errorf("X-Cache = %q, want HIT", got)
+			}
+		})
+	}
+	if n := upstream.count(http.MethodGet, blobPath); n != 1 {
+		t.Errorf("upstream blob requests = %d, want 1", n)
+	}
+
+	// 经过全部中间件后，ServeContent 仍能使用连接的 ReadFrom（sendfile）
+	req := httptest.NewRequest(http.MethodGet, blobPath, nil)
+	req.Host = testRegistryHost
+	req.Header.Set("Authorization", "Bearer "+client.token)
+	rec := newSendfileRecorder()
+	p.Handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Body.String() != string(layer) {
+		t.Fatalf("response = %d %q", rec.Code, rec.Body.String())
+	}
+	if !rec.readFrom {
+		t.Error("cached blob was not written through io.ReaderFrom")
+	}
+}
@@ -0,0 +1,251 @@
+package proxy
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// =============================================================================
+// 上游限流额度 - 记录 Docker Hub 等上游返回的 RateLimit-Limit / RateLimit-Remaining，
+// 按来源身份（Docker-RateLimit-Source：匿名为出口 IP，认证为账号）输出指标，
+// 便于在匿名拉取开始返回 429 之前告警。上游返回 429 后按上游暂停回源（遵循 Retry-After），
+// 暂停期间的请求返回过期缓存或直接返回 429，不再由每个请求各自重试
+// =============================================================================
+
+// rateLimitWarnRatio 剩余额度低于该比例时记录一次警告
+const rateLimitWarnRatio = 0.1
+
+// RateLimitStatus 某个上游、某个来源身份的最近一次限流额度
+type RateLimitStatus struct {
+	Upstream      string        `json:"upstream"`
+	Source        string        `json:"source"`
+	Limit         int64         `json:"limit"`
+	Remaining     int64         `json:"remaining"`
+	Window        time.Duration `json:"-"`
+	WindowSeconds int64         `json:"windowSeconds"`
+	UpdatedAt     time.Time     `json:"updatedAt"`
+
+	warned bool
+}
+
+// rateLimitTracker 记录各上游的限流额度与 429 暂停状态
+type rateLimitTracker struct {
+	backoff    time.Duration // 429 未带 Retry-After 时的暂停时间（0 表示不暂停，429 按重试设置处理）
+	maxBackoff time.Duration // 暂停时间上限
+
+	mu      sync.Mutex
+	entries map[string]*RateLimitStatus // upstream + " " + source
+	until   map[string]time.Time        // 上游 host -> 恢复回源的时间
+
+	throttled atomic.Int64 // 暂停期间直接返回 429 的请求数
+	stale     atomic.Int64 // 因限流返回过期缓存的请求数
+}
+
+func newRateLimitTracker(backoff, maxBackoff time.Duration) *rateLimitTracker {
+	return &rateLimitTracker{
+		backoff:    backoff,
+		maxBackoff: maxBackoff,
+		entries:    make(map[string]*RateLimitStatus),
+		until:      make(map[string]time.Time),
+	}
+}
+
+// parseRateLimit 解析 "100;w=21600" 形式的限流头，返回数量与窗口
+func parseRateLimit(value string) (int64, time.Duration, bool) {
+	count, params, _ := strings.Cut(value, ";")
+	n, err := strconv.ParseInt(strings.TrimSpace(count), 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	var window time.Duration
+	for _, param := range strings.Split(params, ";") {
+		if key, v, ok := strings.Cut(strings.TrimSpace(param), "="); ok && key == "w" {
+			if seconds, err := strconv.ParseInt(v, 10, 64); err == nil {
+				window = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return n, window, true
+}
+
+// observe 从上游响应中记录限流额度，上游返回 429 时暂停回源
+func (t *rateLimitTracker) observe(req *http.Request, resp *http.Response) {
+	if t == nil || resp == nil || req == nil || req.URL == nil {
+		return
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		t.throttle(req.URL.Host, resp.Header.Get("Retry-After"))
+	}
+	limit, window, ok := parseRateLimit(resp.Header.Get("RateLimit-Limit"))
+	if !ok {
+		return
+	}
+	remaining, _, ok := parseRateLimit(resp.Header.Get("RateLimit-Remaining"))
+	if !ok {
+		return
+	}
+	source := resp.Header.Get("Docker-RateLimit-Source")
+	if source == "" {
+		source = "unknown"
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	key := req.URL.Host + " " + source
+	status := t.entries[key]
+	if status == nil {
+		status = &RateLimitStatus{Upstream: req.URL.Host, Source: source}
+		t.entries[key] = status
+	}
+	// 额度回升说明进入了新的窗口，重新允许警告
+	if remaining > status.Remaining {
+		status.warned = false
+	}
+	status.Limit, status.Remaining, status.Window, status.UpdatedAt = limit, remaining, window, time.Now()
+	status.WindowSeconds = int64(window.Seconds())
+
+	if limit > 0 && float64(remaining) < float64(limit)*rateLimitWarnRatio && !status.warned {
+		status.warned = true
+		log.Printf("Upstream rate limit nearly exhausted: %s (source %s) has %d of %d pulls left", status.Upstream, source, remaining, limit)
+	}
+}
+
+// throttle 按 Retry-After（未提供时使用默认暂停时间）暂停对上游的请求
+func (t *rateLimitTracker) throttle(host, retryAfter string) {
+	if t.backoff <= 0 {
+		return
+	}
+	wait, ok := parseRetryAfter(retryAfter)
+	if !ok || wait <= 0 {
+		wait = t.backoff
+	}
+	if t.maxBackoff > 0 && wait > t.maxBackoff {
+		wait = t.maxBackoff
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	until := time.Now().Add(wait)
+	if previous := t.until[host]; until.After(previous) {
+		if time.Now().After(previous) {
+			log.Printf("Upstream %s returned 429, pausing upstream requests for %s", host, wait.Round(time.Second))
+		}
+		t.until[host] = until
+	}
+}
+
+// pausedFor 上游剩余的暂停时间，未暂停时返回 0
+func (t *rateLimitTracker) pausedFor(host string) time.Duration {
+	if t == nil || t.backoff <= 0 {
+		return 0
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	until, ok := t.until[host]
+	if !ok {
+		return 0
+	}
+	wait := time.Until(until)
+	if wait <= 0 {
+		delete(t.until, host)
+		return 0
+	}
+	return wait
+}
+
+// handles429 是否由暂停机制统一处理 429（不再按请求重试）
+func (t *rateLimitTracker) handles429() bool {
+	return t != nil && t.backoff > 0
+}
+
+// Statuses 返回仍在窗口内的限流额度（窗口已过的记录不再代表当前额度）
+func (t *rateLimitTracker) Statuses() []RateLimitStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var result []RateLimitStatus
+	for key, status := range t.entries {
+		if status.Window > 0 && time.Since(status.UpdatedAt) > status.Window {
+			delete(t.entries, key)
+			continue
+		}
+		result = append(result, *status)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Upstream != result[j].Upstream {
+			return result[i].Upstream < result[j].Upstream
+		}
+		return result[i].Source < result[j].Source
+	})
+	return result
+}
+
+// writeMetrics 输出限流额度指标
+func (t *rateLimitTracker) writeMetrics(m *metricsWriter) {
+	statuses := t.Statuses()
+	for _, s := range statuses {
+		m.gauge("docker_proxy_upstream_ratelimit_limit", "Pull limit reported by the upstream for the current window", float64(s.Limit), "upstream", s.Upstream, "source", s.Source)
+	}
+	for _, s := range statuses {
+		m.gauge("docker_proxy_upstream_ratelimit_remaining", "Pulls remaining in the current upstream rate-limit window", float64(s.Remaining), "upstream", s.Upstream, "source", s.Source)
+	}
+	for _, s := range statuses {
+		m.gauge("docker_proxy_upstream_ratelimit_window_seconds", "Length of the upstream rate-limit window", s.Window.Seconds(), "upstream", s.Upstream, "source", s.Source)
+	}
+
+	t.mu.Lock()
+	hosts := make([]string, 0, len(t.until))
+	for host := range t.until {
+		hosts = append(hosts, host)
+	}
+	t.mu.Unlock()
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		m.gauge("docker_proxy_upstream_backoff_seconds", "Remaining time upstream requests are paused after a 429", t.pausedFor(host).Seconds(), "upstream", host)
+	}
+	m.counter("docker_proxy_upstream_throttled_requests_total", "Requests answered with 429 while the upstream was paused", float64(t.throttled.Load()))
+	m.counter("docker_proxy_stale_responses_total", "Expired cached manifests served because the upstream was rate limited", float64(t.stale.Load()))
+}
+
+// serveThrottled 上游限流时的响应：有过期缓存时返回过期内容，否则返回 429 与剩余的暂停时间
+func (p *ProxyServer) serveThrottled(w http.ResponseWriter, r *http.Request, cacheKey string, wait time.Duration) {
+	if p.serveStale(w, r, cacheKey) {
+		return
+	}
+	p.rateLimits.throttled.Add(1)
+	w.Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(wait.Seconds())), 10))
+	p.writeRegistryError(w, http.StatusTooManyRequests, "TOOMANYREQUESTS", "upstream rate limit exceeded, retry later")
+}
+
+// serveStale 返回已过期但仍在保留期内的 manifest，没有可用内容时返回 false
+func (p *ProxyServer) serveStale(w http.ResponseWriter, r *http.Request, cacheKey string) bool {
+	if cacheKey == "" || p.cacheManager == nil || !p.config.CacheEnabled {
+		return false
+	}
+	entry, ok := p.cacheManager.GetStale(cacheKey)
+	if !ok {
+		return false
+	}
+	if p.config.Debug {
+		log.Printf("[DEBUG] /v2/* Upstream rate limited, serving stale cache: %s", r.URL.Path)
+	}
+	p.rateLimits.stale.Add(1)
+	for key, values := range entry.Headers {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	w.Header().Set("X-Cache", "STALE")
+	w.Header().Set("Warning", `110 - "Response is Stale"`)
+	w.WriteHeader(entry.StatusCode)
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(entry.Data)
+	}
+	return true
+}
@@ -0,0 +1,63 @@
+package proxy
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpstreamRateLimitMetrics(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	upstream.addImage("team/app", "v1", []byte("layer"))
+	upstream.configure(func(f *fakeRegistry) { f.rateLimit = "7" })
+	_, client := newTestProxy(t, upstream, nil)
+
+	client.login("team/app")
+	client.pull("team/app", "v1")
+
+	_, body := client.do("GET", "/metrics", nil)
+	host := strings.TrimPrefix(upstream.server.URL, "http://")
+	for _, want := range []string{
+		`docker_proxy_upstream_ratelimit_limit{upstream="` + host + `",source="203.0.113.7"} 100`,
+		`docker_proxy_upstream_ratelimit_remaining{upstream="` + host + `",source="203.0.113.7"} 7`,
+		`docker_proxy_upstream_ratelimit_window_seconds{upstream="` + host + `",source="203.0.113.7"} 21600`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics missing %q", want)
+		}
+	}
+}
+
+func TestUpstream429PausesUpstreamAndServesStale(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	upstream.addImage("team/app", "v1", []byte("layer"))
+	upstream.addImage("team/app", "v2", []byte("other layer"))
+	_, client := newTestProxy(t, upstream, map[string]string{"CACHE_MANIFEST_TTL": "1ms"})
+
+	client.login("team/app")
+	want := client.pull("team/app", "v1")
+	time.Sleep(10 * time.Millisecond)
+	upstream.configure(func(f *fakeRegistry) { f.throttle = 1 })
+
+	// 上游返回 429：不按请求重试，返回过期的缓存内容
+	for i := 0; i < 2; i++ {
+		resp, body := client.do("GET", "/v2/team/app/manifests/v1", http.Header{"Accept": {fakeManifestType}})
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("X-Cache") != "STALE" || !bytes.Equal(body, want) {
+			t.Fatalf("request %d: status %d, X-Cache %q, want stale manifest", i, resp.StatusCode, resp.Header.Get("X-Cache"))
+		}
+	}
+	if n := upstream.count("GET", "/v2/team/app/manifests/v1"); n != 2 {
+		t.Errorf("upstream manifest requests = %d, want 2 (pull and one 429)", n)
+	}
+
+	// 暂停期间没有缓存的内容直接返回 429，不回源
+	resp, _ := client.do("GET", "/v2/team/app/manifests/v2", http.Header{"Accept": {fakeManifestType}})
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" {
+		t.Fatalf("uncached manifest while paused: status %d, Retry-After %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	if n := upstream.count("GET", "/v2/team/app/manifests/v2"); n != 0 {
+		t.Errorf("upstream was contacted %d times while paused", n)
+	}
+}
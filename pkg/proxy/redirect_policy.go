@@ -0,0 +1,171 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+// =============================================================================
+// 重定向策略 - 上游重定向（blob 存储地址等）在服务器端跟随还是交给客户端，
+// 按目标域名规则决定；跟随时限制跳数、检测循环，并保留 Range 等请求头
+// =============================================================================
+
+// RedirectRule 按目标域名决定是否在服务器端跟随重定向
+type RedirectRule struct {
+	Pattern string // 完整域名、*.example.com（匹配子域名）或 *（全部）
+	Follow  bool   // true 服务器端跟随，false 交给客户端
+}
+
+// redirectPreservedHeaders 跟随重定向时从客户端请求保留的请求头（不携带认证信息）：
+// Range 与条件请求头使断点续传与部分下载对存储同样有效
+var redirectPreservedHeaders = []string{
+	"Accept", "Accept-Encoding", "Range", "If-Range",
+	"If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since",
+}
+
+// parseRedirectRules 解析 REDIRECT_RULES（pattern=follow|pass，逗号分隔）
+func parseRedirectRules(entries []string) []RedirectRule {
+	var rules []RedirectRule
+	for _, entry := range entries {
+		pattern, action, ok := strings.Cut(entry, "=")
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		action = strings.TrimSpace(action)
+		if !ok || pattern == "" || (action != "follow" && action != "pass") {
+			log.Printf("Ignoring invalid REDIRECT_RULES entry %q (expected host=follow|pass)", entry)
+			continue
+		}
+		rules = append(rules, RedirectRule{Pattern: pattern, Follow: action == "follow"})
+	}
+	return rules
+}
+
+// matches 规则是否匹配目标域名
+func (r RedirectRule) matches(host string) bool {
+	host = strings.ToLower(host)
+	if h, _, ok := strings.Cut(host, ":"); ok {
+		host = h
+	}
+	if r.Pattern == "*" || r.Pattern == host {
+		return true
+	}
+	suffix, ok := strings.CutPrefix(r.Pattern, "*")
+	return ok && strings.HasPrefix(suffix, ".") && strings.HasSuffix(host, suffix)
+}
+
+// shouldFollowRedirect 是否在服务器端跟随指向 host 的重定向：
+// 先按 REDIRECT_RULES 顺序匹配，未匹配时 FOLLOW_ALL_REDIRECTS 或黑名单域名跟随，其他交给客户端
+func (p *ProxyServer) shouldFollowRedirect(host string) bool {
+	for _, rule := range p.config.RedirectRules {
+		if rule.matches(host) {
+			return rule.Follow
+		}
+	}
+	return p.config.FollowAllRedirects || p.isBlockedHost(host)
+}
+
+// isRedirect 状态码是否为带 Location 的重定向
+func isRedirect(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// redirectChain 一次请求已经跟随的重定向
+type redirectChain struct {
+	visited map[string]bool // 已请求过的地址（含最初的上游地址）
+	hops    int
+}
+
+// followRedirectWithCache 在服务器端跟随重定向并支持缓存（用于黑名单域名与 FOLLOW_ALL_REDIRECTS），
+// from 为返回重定向的上游地址
+func (p *ProxyServer) followRedirectWithCache(w http.ResponseWriter, originalReq *http.Request, from, targetURL *url.URL, cacheKey string, enableCache bool) {
+	chain := &redirectChain{visited: map[string]bool{from.String(): true}}
+	p.followRedirectHop(w, originalReq, targetURL, cacheKey, enableCache, chain)
+}
+
+func (p *ProxyServer) followRedirectHop(w http.ResponseWriter, originalReq *http.Request, targetURL *url.URL, cacheKey string, enableCache bool, chain *redirectChain) {
+	maxHops := p.config.RedirectMaxHops
+	if chain.hops >= maxHops {
+		if p.config.Debug {
+			log.Printf("[DEBUG] Max redirects (%d) exceeded", maxHops)
+		}
+		p.writeErrorResponse(w, fmt.Sprintf("too many redirects (more than %d)", maxHops), http.StatusBadGateway)
+		return
+	}
+	if chain.visited[targetURL.String()] {
+		p.writeErrorResponse(w, fmt.Sprintf("redirect loop detected at %s", targetURL.Redacted()), http.StatusBadGateway)
+		return
+	}
+	chain.visited[targetURL.String()] = true
+	chain.hops++
+
+	if p.config.Debug {
+		log.Printf("[DEBUG] Following redirect with cache (%d/%d): %s", chain.hops, maxHops, targetURL.Redacted())
+	}
+
+	// 创建新的 GET 请求，不带原始请求的认证信息
+	req, err := http.NewRequestWithContext(originalReq.Context(), "GET", targetURL.String(), nil)
+	if err != nil {
+		if p.config.Debug {
+			log.Printf("[DEBUG] Failed to create redirect request: %v", err)
+		}
+		p.writeErrorResponse(w, fmt.Sprintf("invalid redirect URL: %v", err), http.StatusBadGateway)
+		return
+	}
+	p.setUserAgent(req)
+	for _, key := range redirectPreservedHeaders {
+		if value := originalReq.Header.Get(key); value != "" {
+			req.Header.Set(key, value)
+		}
+	}
+
+	resp, err := p.withRetries(req, p.transport.RoundTrip)
+	if err != nil {
+		if p.config.Debug {
+			log.Printf("[DEBUG] Redirect request error: %v", err)
+		}
+		p.writeErrorResponse(w, fmt.Sprintf("redirect request failed: %v", err), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	p.hookUpstreamResponse(req, resp)
+
+	if p.config.Debug {
+		log.Printf("[DEBUG] Redirect response status: %d, Content-Length: %d", resp.StatusCode, resp.ContentLength)
+	}
+
+	// 嵌套重定向：按目标域名的策略继续跟随，或将（解析为绝对地址的）重定向交给客户端
+	if location := resp.Header.Get("Location"); isRedirect(resp.StatusCode) && location != "" {
+		if nextURL, err := targetURL.Parse(location); err == nil {
+			if p.shouldFollowRedirect(nextURL.Host) {
+				p.followRedirectHop(w, originalReq, nextURL, cacheKey, enableCache, chain)
+				return
+			}
+			resp.Header.Set("Location", nextURL.String())
+			p.copyResponseRoundTrip(w, resp)
+			return
+		}
+	}
+
+	// 外部存储：大文件并行分块下载，否则在传输中断时自动续传（按编码后内容无法校验摘要，存储返回压缩内容时跳过）
+	if digest := cache.GetDigestFromPath(cacheKey); resp.Header.Get("Content-Encoding") == "" &&
+		(p.wrapParallel(req, resp, digest) || p.wrapResumable(req, resp, digest)) {
+		defer resp.Body.Close()
+	}
+
+	// 使用带缓存的响应处理（只缓存完整的 200 响应，Range 请求的 206 与条件请求的 304 直接返回）
+	shouldCache := p.config.CacheEnabled && enableCache && cacheKey != "" && p.cacheManager != nil
+	if shouldCache {
+		p.copyResponseWithCacheRoundTrip(w, resp, cacheKey, true)
+	} else {
+		p.copyResponseRoundTrip(w, resp)
+	}
+}
@@ -0,0 +1,59 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRedirectRules(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	upstream.configure(func(f *fakeRegistry) { f.redirectBlobs = true })
+	_, layers := upstream.addImage("team/app", "v1", []byte("layer on object storage"))
+	blobPath := "/v2/team/app/blobs/" + layers[0]
+	storagePath := "/blobs/" + layers[0]
+
+	// 规则优先于 FOLLOW_ALL_REDIRECTS
+	_, client := newTestProxy(t, upstream, map[string]string{"FOLLOW_ALL_REDIRECTS": "true", "REDIRECT_RULES": "*=pass"})
+	client.login("team/app")
+	if resp, _ := client.do("GET", blobPath, nil); resp.StatusCode != http.StatusTemporaryRedirect {
+		t.Fatalf("pass rule: status %d, want 307", resp.StatusCode)
+	}
+
+	// 服务器端跟随时保留 Range，206 响应直接返回
+	_, client = newTestProxy(t, upstream, map[string]string{"REDIRECT_RULES": "127.0.0.1=follow"})
+	client.login("team/app")
+	resp, body := client.do("GET", blobPath, http.Header{"Range": {"bytes=0-4"}})
+	if resp.StatusCode != http.StatusPartialContent || string(body) != "layer" {
+		t.Fatalf("ranged follow: status %d, body %q", resp.StatusCode, body)
+	}
+	if got := upstream.header("GET", storagePath).Get("Range"); got != "bytes=0-4" {
+		t.Errorf("storage Range = %q, want bytes=0-4", got)
+	}
+
+	// 存储重定向回同一地址：检测到循环，不会一直跟随到跳数上限
+	upstream.configure(func(f *fakeRegistry) { f.storageLoop = true })
+	before := upstream.count("GET", storagePath)
+	resp, body = client.do("GET", blobPath, nil)
+	if resp.StatusCode != http.StatusBadGateway || !strings.Contains(string(body), "redirect loop") {
+		t.Fatalf("loop: status %d, body %s", resp.StatusCode, body)
+	}
+	if n := upstream.count("GET", storagePath) - before; n != 1 {
+		t.Errorf("storage requested %d times during loop, want 1", n)
+	}
+
+	// 条件请求头同样转发给存储
+	upstream.configure(func(f *fakeRegistry) { f.storageLoop = false })
+	resp, _ = client.do("GET", blobPath, http.Header{"If-None-Match": {`"etag"`}})
+	if got := upstream.header("GET", storagePath).Get("If-None-Match"); got != `"etag"` {
+		t.Errorf("If-None-Match not forwarded to storage (status %d)", resp.StatusCode)
+	}
+
+	// 超过跳数上限
+	_, client = newTestProxy(t, upstream, map[string]string{"REDIRECT_RULES": "127.0.0.1=follow", "REDIRECT_MAX_HOPS": "0"})
+	client.login("team/app")
+	resp, body = client.do("GET", blobPath, nil)
+	if resp.StatusCode != http.StatusBadGateway || !strings.Contains(string(body), "too many redirects") {
+		t.Fatalf("max hops: status %d, body %s", resp.StatusCode, body)
+	}
+}
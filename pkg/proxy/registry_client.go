@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// =============================================================================
+// 内部上游客户端 - 代理以自身身份访问上游（签名校验等内部请求）
+// =============================================================================
+
+// fetchFromUpstream 请求上游 /v2/{repo}/{kind}/{reference}
+// 私有上游注入代理持有的凭据；公共上游遇到 401 时按挑战匿名获取 pull token 后重试
+func (p *ProxyServer) fetchFromUpstream(ctx context.Context, upstream, repo, kind, reference string, accept []string) (*http.Response, error) {
+	flavor := p.flavorFor(upstream)
+	target := upstream + "/v2/" + flavor.repository(repo) + "/" + kind + "/" + reference
+
+	newRequest := func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(accept) > 0 {
+			req.Header.Set("Accept", strings.Join(accept, ", "))
+		}
+		p.setUserAgent(req)
+		p.authorizeUpstream(req)
+		return req, nil
+	}
+
+	req, err := newRequest()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.transport.RoundTrip(req)
+	if err == nil {
+		p.rateLimits.observe(req, resp)
+	}
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// 匿名 token 流程
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+	if !strings.HasPrefix(strings.ToLower(challenge), "bearer ") {
+		return nil, fmt.Errorf("upstream requires unsupported authentication: %q", challenge)
+	}
+	wwwAuth, err := p.parseAuthenticate(challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	scope := p.scopeRewriter.Rewrite(upstream, "repository:"+flavor.repository(repo)+":pull")
+	tokenResp, err := p.fetchTokenWithRoundTrip(ctx, wwwAuth, scope, "")
+	if err != nil {
+		return nil, err
+	}
+	token, err := readRegistryToken(tokenResp)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err = newRequest()
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return p.transport.RoundTrip(req)
+}
+
+// readRegistryToken 读取 token 服务响应（兼容 token 与 access_token 字段）并关闭 body
+func readRegistryToken(resp *http.Response) (string, error) {
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request status %d", resp.StatusCode)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err := json.Unmarshal(body, &token); err != nil {
+		return "", fmt.Errorf("invalid token response: %w", err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	return token.Token, nil
+}
@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFetchFromUpstreamAnonymousToken(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	digest, _ := upstream.addImage("team/app", "v1", []byte("layer"))
+	p, _ := newTestProxy(t, upstream, nil)
+
+	// 公共上游返回 401 后匿名获取 pull token 重试
+	resp, err := p.fetchFromUpstream(context.Background(), upstream.server.URL, "team/app", "manifests", "v1", []string{fakeManifestType})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || fakeDigest(body) != digest {
+		t.Fatalf("fetchFromUpstream: status %d", resp.StatusCode)
+	}
+	if scopes := upstream.tokenScopes(); !slices.Equal(scopes, []string{"repository:team/app:pull"}) {
+		t.Errorf("token scopes = %v", scopes)
+	}
+	if got := upstream.header("GET", "/v2/team/app/manifests/v1").Get("Accept"); got != fakeManifestType {
+		t.Errorf("Accept = %q", got)
+	}
+}
+
+func TestFetchFromUpstreamUnsupportedChallenge(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	t.Cleanup(server.Close)
+	p, _ := newTestProxy(t, newFakeRegistry(t), nil)
+
+	_, err := p.fetchFromUpstream(context.Background(), server.URL, "team/app", "manifests", "v1", nil)
+	if err == nil || !strings.Contains(err.Error(), "unsupported authentication") {
+		t.Errorf("fetchFromUpstream with Basic challenge: %v", err)
+	}
+}
+
+func TestReadRegistryToken(t *testing.T) {
+	for body, want := range map[string]string{
+		`{"token": "a"}`:                      "a",
+		`{"access_token": "b"}`:               "b",
+		`{"token": "a", "access_token": "b"}`: "a",
+	} {
+		resp := &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body))}
+		if token, err := readRegistryToken(resp); err != nil || token != want {
+			t.Errorf("readRegistryToken(%s) = %q, %v", body, token, err)
+		}
+	}
+	for _, resp := range []*http.Response{
+		{StatusCode: http.StatusForbidden, Body: io.NopCloser(strings.NewReader(`{"token": "a"}`))},
+		{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(`not json`))},
+	} {
+		if _, err := readRegistryToken(resp); err == nil {
+			t.Errorf("readRegistryToken accepted status %d response", resp.StatusCode)
+		}
+	}
+}
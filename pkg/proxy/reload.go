@@ -0,0 +1,216 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// =============================================================================
+// 配置热重载 - SIGHUP 或 POST /admin/reload 重新读取路由、黑名单、凭据与缓存 TTL
+// =============================================================================
+
+// liveConfig 可热重载的配置，重载时整体原子替换，
+// 同一请求内的路由判断始终基于同一版本
+type liveConfig struct {
+	routes           map[string]string                // 域名 -> 上游
+	blockedHosts     []string                         // 服务器端跟随重定向的域名模式
+	upstreamAuth     map[string]UpstreamAuthenticator // 私有上游 host -> 认证器
+	chainedUpstreams map[string]bool                  // 级联上游代理的 host
+	helmRoutes       map[string]string                // Helm chart 仓库域名 -> 仓库地址
+	fileMirrors      map[string]*FileMirrorRoute      // 文件镜像域名 -> 路由
+	flavors          map[string]UpstreamFlavor        // 上游 host -> 仓库类型
+	descriptions     map[string]string                // 路由域名 -> 说明
+	splits           map[string]UpstreamSplit         // 路由域名 -> 蓝绿切换分流
+	singleDomain     *SingleDomain                    // 单域名模式（未配置时为 nil）
+	responseHeaders  map[string]*headerRules          // 路由 host（* 表示全部路由）-> 响应头规则
+	loadedAt         time.Time
+}
+
+// newLiveConfig 汇总已注册私有路由与外部层路由的配置
+func newLiveConfig(config *Config, upstreamAuth map[string]UpstreamAuthenticator) *liveConfig {
+	return &liveConfig{
+		routes:           config.Routes,
+		blockedHosts:     config.BlockedHostPatterns,
+		upstreamAuth:     upstreamAuth,
+		chainedUpstreams: config.ChainedUpstreams,
+		helmRoutes:       config.HelmRoutes,
+		fileMirrors:      config.FileMirrors,
+		flavors:          config.UpstreamFlavors,
+		descriptions:     config.RouteDescriptions,
+		splits:           config.UpstreamSplits,
+		singleDomain:     NewSingleDomain(config),
+		responseHeaders:  config.ResponseHeaders,
+		loadedAt:         time.Now(),
+	}
+}
+
+// current 返回当前生效的可热重载配置
+func (p *ProxyServer) current() *liveConfig {
+	return p.live.Load()
+}
+
+// Reload 重新读取 CONFIG_FILE 与 htpasswd 等凭据文件，原子替换路由、黑名单、上游凭据与响应头规则，并更新缓存 TTL 及其上下限
+// 监听地址、缓存目录、限流等其他设置仍需重启生效。新配置校验失败时保持原配置（包括 CONFIG_FILE 中的值）不变
+func (p *ProxyServer) Reload() error {
+	p.reloadMu.Lock()
+	defer p.reloadMu.Unlock()
+
+	values, err := readConfigFile()
+	if err != nil {
+		return fmt.Errorf("failed to load config file: %w", err)
+	}
+	// 新值暂时生效以构建配置，失败时恢复；进程环境变量始终不变
+	previous := configFileValues.Swap(values)
+	config, upstreamAuth, clientUsers, adminUsers, err := p.loadReloadable()
+	if err != nil {
+		configFileValues.Store(previous)
+		return err
+	}
+
+	live := newLiveConfig(config, upstreamAuth)
+	p.live.Store(live)
+	if p.clientAuth != nil {
+		p.clientAuth.setUsers(clientUsers)
+	}
+	p.adminAuth.setUsers(adminUsers)
+	p.transport.setBucketOrigins(config.BucketOrigins)
+	if p.cacheManager != nil {
+		p.cacheManager.SetTTL(config.CacheManifestTTL, config.CacheBlobTTL)
+		p.cacheManager.SetTTLPolicy(config.CacheTTLPolicy)
+		p.cacheManager.SetQuotas(config.CacheQuotas)
+	}
+
+	log.Printf("Configuration reloaded: %d routes, %d blocked host patterns, manifest TTL %s, blob TTL %s",
+		len(live.routes), len(live.blockedHosts), config.CacheManifestTTL, config.CacheBlobTTL)
+	return nil
+}
+
+// loadReloadable 按当前配置值构建并校验可热重载的部分，不修改任何运行中的状态
+func (p *ProxyServer) loadReloadable() (*Config, map[string]UpstreamAuthenticator, map[string]string, map[string]string, error) {
+	c := &configChecker{}
+	c.checkValues()
+	if len(c.problems) > 0 {
+		return nil, nil, nil, nil, fmt.Errorf("invalid configuration: %s", strings.Join(c.problems, "; "))
+	}
+
+	config := loadEnvConfig()
+	registerChainedRoutes(config)
+	registerHelmRoutes(config)
+	registerFileMirrorRoutes(config)
+	registerBucketRoutes(config, p.transport)
+	upstreamAuth := buildUpstreamAuth(config, p.transport)
+	NewForeignLayerRewriter(config) // 只为注册外部层路由，改写器本身不随重载替换
+
+	// htpasswd 加载失败时保持原配置不变
+	var clientUsers map[string]string
+	if p.clientAuth != nil {
+		var err error
+		if clientUsers, err = p.clientAuth.loadUsers(); err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("failed to reload client auth: %w", err)
+		}
+	}
+	adminUsers, err := p.adminAuth.loadUsers()
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("failed to reload admin auth: %w", err)
+	}
+	return config, upstreamAuth, clientUsers, adminUsers, nil
+}
+
+// configFileValues 当前生效的 CONFIG_FILE 内容（nil 表示未配置），优先于进程环境变量。
+// 进程环境变量在运行期间无法从外部修改，热重载的配置需放在该文件中
+var configFileValues atomic.Pointer[map[string]string]
+
+// lookupEnv 读取配置项：CONFIG_FILE 中的值优先，其次为进程环境变量
+func lookupEnv(key string) (string, bool) {
+	if values := configFileValues.Load(); values != nil {
+		if value, ok := (*values)[key]; ok {
+			return value, true
+		}
+	}
+	return os.LookupEnv(key)
+}
+
+// configEnviron 进程环境变量叠加 CONFIG_FILE 中的值，用于启动子进程
+func configEnviron() []string {
+	env := os.Environ()
+	if values := configFileValues.Load(); values != nil {
+		for key, value := range *values {
+			env = append(env, key+"="+value)
+		}
+	}
+	return env
+}
+
+// applyConfigFile 读取 CONFIG_FILE（KEY=VALUE 格式，与 docker env_file / .env 相同）并使其中的值生效，
+// 上次由文件设置、本次已删除的配置项恢复为进程环境变量中的值
+func applyConfigFile() error {
+	values, err := readConfigFile()
+	if err != nil {
+		return err
+	}
+	configFileValues.Store(values)
+	return nil
+}
+
+// readConfigFile 解析 CONFIG_FILE，未配置时返回 nil
+func readConfigFile() (*map[string]string, error) {
+	path := os.Getenv("CONFIG_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	values, err := parseEnvFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &values, nil
+}
+
+// parseEnvFile 解析 KEY=VALUE 文件，支持 # 注释、export 前缀与引号
+func parseEnvFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, i+1)
+		}
+		if key == "CONFIG_FILE" {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
+// handleAdminReload POST /admin/reload
+func (p *ProxyServer) handleAdminReload(w http.ResponseWriter, r *http.Request) {
+	if err := p.Reload(); err != nil {
+		p.writeErrorResponse(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	live := p.current()
+	p.writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":       "reloaded",
+		"routes":       live.routes,
+		"blockedHosts": live.blockedHosts,
+		"loadedAt":     live.loadedAt.UTC().Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestReloadKeepsConfigOnInvalidFile(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	configFile := filepath.Join(t.TempDir(), "proxy.env")
+	writeConfig := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(configFile, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeConfig("BLOCKED_HOSTS=first.example\n")
+	t.Cleanup(func() { configFileValues.Store(nil) })
+	p, _ := newTestProxy(t, upstream, map[string]string{"CONFIG_FILE": configFile})
+
+	if !slices.Contains(p.current().blockedHosts, "first.example") {
+		t.Fatalf("blocked hosts %v missing first.example", p.current().blockedHosts)
+	}
+
+	// 校验失败：原配置与 CONFIG_FILE 中的旧值保持不变，也不写入进程环境变量
+	writeConfig("BLOCKED_HOSTS=second.example\nCACHE_MANIFEST_TTL=soon\n")
+	before := p.current()
+	if err := p.Reload(); err == nil {
+		t.Fatal("Reload accepted an invalid CACHE_MANIFEST_TTL")
+	}
+	if p.current() != before {
+		t.Error("failed reload replaced the live config")
+	}
+	if value := getEnv("BLOCKED_HOSTS", ""); value != "first.example" {
+		t.Errorf("BLOCKED_HOSTS = %q after failed reload, want first.example", value)
+	}
+	for _, key := range []string{"BLOCKED_HOSTS", "CACHE_MANIFEST_TTL"} {
+		if _, ok := os.LookupEnv(key); ok {
+			t.Errorf("reload set %s in the process environment", key)
+		}
+	}
+
+	writeConfig("BLOCKED_HOSTS=second.example\n")
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := p.Reload(); err != nil {
+				t.Errorf("Reload: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if hosts := p.current().blockedHosts; !slices.Contains(hosts, "second.example") || slices.Contains(hosts, "first.example") {
+		t.Errorf("blocked hosts after reload = %v", hosts)
+	}
+}
@@ -0,0 +1,658 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+// =============================================================================
+// 镜像复制 - 将缓存的镜像（manifest + blob）推送到私有仓库（Harbor / ECR 等）
+// =============================================================================
+
+// replicationAccept 拉取源 manifest 时接受的媒体类型
+var replicationAccept = []string{
+	MediaTypeOCIIndex, MediaTypeDockerManifestList,
+	MediaTypeOCIManifest, MediaTypeDockerManifest,
+}
+
+// ReplicationTarget 复制目标仓库
+type ReplicationTarget struct {
+	Name        string `json:"name"`
+	Registry    string `json:"registry"`    // 如 https://harbor.example.com
+	Namespace   string `json:"namespace"`   // 目标仓库前缀，如 mirror -> mirror/library/nginx
+	Username    string `json:"username"`    // Basic 认证或换取 token 的用户名
+	Password    string `json:"password"`    // 密码
+	PasswordEnv string `json:"passwordEnv"` // 从环境变量读取密码，优先于 password
+
+	mu     sync.Mutex
+	tokens map[string]string // 目标仓库 -> push token
+	basic  bool              // 目标仓库使用 Basic 认证
+}
+
+// ReplicationJob 复制任务
+type ReplicationJob struct {
+	Name     string   `json:"name"`
+	Target   string   `json:"target"`
+	Images   []string `json:"images"`   // {路由域名}/{仓库}:{tag|@digest}，如 docker.example.com/library/nginx:1.27
+	Interval string   `json:"interval"` // 定时执行间隔，为空时只能通过管理接口触发
+
+	target   *ReplicationTarget
+	interval time.Duration
+	running  atomic.Bool
+
+	mu   sync.Mutex
+	last *ReplicationStatus
+}
+
+// ReplicationStatus 单次复制的结果
+type ReplicationStatus struct {
+	Job              string    `json:"job,omitempty"`
+	Target           string    `json:"target"`
+	Running          bool      `json:"running,omitempty"`
+	StartedAt        time.Time `json:"startedAt"`
+	Duration         string    `json:"duration,omitempty"`
+	Images           int       `json:"images"`
+	ManifestsPushed  int       `json:"manifestsPushed"`
+	ManifestsSkipped int       `json:"manifestsSkipped"`
+	BlobsPushed      int       `json:"blobsPushed"`
+	BlobsSkipped     int       `json:"blobsSkipped"`
+	BytesPushed      int64     `json:"bytesPushed"`
+	Errors           []string  `json:"errors,omitempty"`
+}
+
+// Replicator 管理复制目标与任务
+type Replicator struct {
+	p       *ProxyServer
+	targets map[string]*ReplicationTarget
+	jobs    []*ReplicationJob
+}
+
+// NewReplicator 从 REPLICATION_FILE 加载复制配置，未配置时返回 nil
+//
+//	{
+//	  "targets": [{"name": "harbor", "registry": "https://harbor.example.com", "namespace": "mirror",
+//	               "username": "robot$sync", "passwordEnv": "HARBOR_PASSWORD"}],
+//	  "jobs": [{"name": "base-images", "target": "harbor", "interval": "6h",
+//	            "images": ["docker.example.com/library/nginx:1.27"]}]
+//	}
+func NewReplicator(p *ProxyServer, path string) (*Replicator, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read replication config: %w", err)
+	}
+	var cfg struct {
+		Targets []*ReplicationTarget `json:"targets"`
+		Jobs    []*ReplicationJob    `json:"jobs"`
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse replication config: %w", err)
+	}
+
+	r := &Replicator{p: p, targets: make(map[string]*ReplicationTarget)}
+	for i, t := range cfg.Targets {
+		if t.Name == "" || t.Registry == "" {
+			return nil, fmt.Errorf("replication target %d: name and registry are required", i)
+		}
+		if !strings.Contains(t.Registry, "://") {
+			t.Registry = "https://" + t.Registry
+		}
+		t.Registry = strings.TrimSuffix(t.Registry, "/")
+		t.Namespace = strings.Trim(t.Namespace, "/")
+		if t.PasswordEnv != "" {
+			t.Password = getEnv(t.PasswordEnv, "")
+		}
+		t.tokens = make(map[string]string)
+		r.targets[t.Name] = t
+	}
+	for i, job := range cfg.Jobs {
+		if job.target = r.targets[job.Target]; job.target == nil {
+			return nil, fmt.Errorf("replication job %d: unknown target %q", i, job.Target)
+		}
+		if job.Name == "" {
+			job.Name = fmt.Sprintf("job-%d", i)
+		}
+		if job.Interval != "" {
+			if job.interval = parseDuration(job.Interval, 0); job.interval <= 0 {
+				return nil, fmt.Errorf("replication job %s: invalid interval %q", job.Name, job.Interval)
+			}
+		}
+		r.jobs = append(r.jobs, job)
+	}
+
+	log.Printf("Replication enabled: %d targets, %d jobs", len(r.targets), len(r.jobs))
+	return r, nil
+}
+
+// Run 按间隔执行定时任务，启动时先执行一次
+func (r *Replicator) Run(ctx context.Context) {
+	if r == nil {
+		return
+	}
+	for _, job := range r.jobs {
+		if job.interval <= 0 {
+			continue
+		}
+		go func(job *ReplicationJob) {
+			ticker := time.NewTicker(job.interval)
+			defer ticker.Stop()
+			for {
+				r.RunJob(ctx, job)
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+		}(job)
+	}
+}
+
+// RunJob 执行复制任务，同一任务不会并发执行
+func (r *Replicator) RunJob(ctx context.Context, job *ReplicationJob) (*ReplicationStatus, bool) {
+	if !job.running.CompareAndSwap(false, true) {
+		return nil, false
+	}
+	defer job.running.Store(false)
+
+	status := r.Replicate(ctx, job.target, job.Images)
+	status.Job = job.Name
+
+	job.mu.Lock()
+	job.last = status
+	job.mu.Unlock()
+
+	log.Printf("Replication job %s: %d images, %d manifests and %d blobs pushed (%s), %d errors",
+		job.Name, status.Images, status.ManifestsPushed, status.BlobsPushed, cache.FormatBytes(status.BytesPushed), len(status.Errors))
+	return status, true
+}
+
+// Replicate 将镜像列表复制到目标仓库，单个镜像失败不影响其余镜像
+func (r *Replicator) Replicate(ctx context.Context, t *ReplicationTarget, images []string) *ReplicationStatus {
+	rs := &replication{
+		r:      r,
+		t:      t,
+		pushed: make(map[string]bool),
+		status: &ReplicationStatus{Target: t.Name, StartedAt: time.Now()},
+	}
+	for _, image := range images {
+		if err := rs.image(ctx, image); err != nil {
+			rs.status.Errors = append(rs.status.Errors, fmt.Sprintf("%s: %v", image, err))
+			continue
+		}
+		rs.status.Images++
+	}
+	rs.status.Duration = time.Since(rs.status.StartedAt).Round(time.Millisecond).String()
+	return rs.status
+}
+
+// Stats 返回各任务最近一次执行结果
+func (r *Replicator) Stats() []ReplicationStatus {
+	result := make([]ReplicationStatus, 0, len(r.jobs))
+	for _, job := range r.jobs {
+		status := ReplicationStatus{Job: job.Name, Target: job.Target}
+		job.mu.Lock()
+		if job.last != nil {
+			status = *job.last
+		}
+		job.mu.Unlock()
+		status.Running = job.running.Load()
+		result = append(result, status)
+	}
+	return result
+}
+
+// -----------------------------------------------------------------------------
+// 单次复制
+// -----------------------------------------------------------------------------
+
+// replication 单次复制过程，记录已推送的 blob 避免重复检查
+type replication struct {
+	r      *Replicator
+	t      *ReplicationTarget
+	pushed map[string]bool // {目标仓库}@{digest}
+	status *ReplicationStatus
+}
+
+// image 复制单个镜像：先推送引用的 blob 与子 manifest，最后按 tag 推送顶层 manifest
+func (rs *replication) image(ctx context.Context, image string) error {
+	upstream := ""
+	if parts := strings.SplitN(image, "/", 2); len(parts) == 2 &&
+		(strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		host := parts[0]
+		if h, _, ok := strings.Cut(host, ":"); ok {
+			host = h
+		}
+		if upstream = rs.r.p.current().routes[host]; upstream == "" {
+			return fmt.Errorf("no route for %s", parts[0])
+		}
+	}
+	repo, reference := parseImageRef(image)
+	targetRepo := repo
+	if rs.t.Namespace != "" {
+		targetRepo = path.Join(rs.t.Namespace, repo)
+	}
+
+	data, mediaType, err := rs.sourceManifest(ctx, upstream, repo, reference)
+	if err != nil {
+		return err
+	}
+	digest := digestOf(data)
+	if err := rs.pushTree(ctx, upstream, repo, targetRepo, data, mediaType, digest); err != nil {
+		return err
+	}
+	if strings.HasPrefix(reference, "sha256:") {
+		return nil
+	}
+	return rs.putManifest(ctx, targetRepo, reference, data, mediaType)
+}
+
+// sourceManifest 获取源 manifest：tag 优先从上游获取最新内容，digest 优先使用缓存
+func (rs *replication) sourceManifest(ctx context.Context, upstream, repo, reference string) ([]byte, string, error) {
+	isDigest := strings.HasPrefix(reference, "sha256:")
+	if upstream != "" && !isDigest {
+		if data, mediaType, err := rs.fetchManifest(ctx, upstream, repo, reference); err == nil {
+			return data, mediaType, nil
+		} else if rs.r.p.config.Debug {
+			log.Printf("[DEBUG] Replication: upstream manifest %s:%s unavailable, using cache: %v", repo, reference, err)
+		}
+	}
+
+	if cm := rs.r.p.cacheManager; cm != nil {
+		// 过期的 tag 缓存同样可以复制
+		entry, err := cm.GetManifest(ctx, repo, reference)
+		if err != nil {
+			entry, err = readCachedManifest(cm, repo, reference)
+		}
+		if err == nil && entry.StatusCode == http.StatusOK {
+			mediaType := ""
+			if ct := entry.Headers["Content-Type"]; len(ct) > 0 {
+				mediaType = ct[0]
+			}
+			return entry.Data, manifestMediaType(entry.Data, mediaType), nil
+		}
+	}
+
+	if upstream != "" && isDigest {
+		return rs.fetchManifest(ctx, upstream, repo, reference)
+	}
+	return nil, "", fmt.Errorf("manifest %s:%s not found in cache", repo, reference)
+}
+
+func (rs *replication) fetchManifest(ctx context.Context, upstream, repo, reference string) ([]byte, string, error) {
+	resp, err := rs.r.p.fetchFromUpstream(ctx, upstream, repo, "manifests", reference, replicationAccept)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("upstream manifest status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCacheableSize))
+	if err != nil {
+		return nil, "", err
+	}
+	if strings.HasPrefix(reference, "sha256:") && digestOf(data) != reference {
+		return nil, "", fmt.Errorf("manifest digest mismatch for %s", reference)
+	}
+	return data, manifestMediaType(data, resp.Header.Get("Content-Type")), nil
+}
+
+// pushTree 推送 manifest 及其引用的全部内容，目标已存在时整体跳过
+func (rs *replication) pushTree(ctx context.Context, upstream, repo, targetRepo string, data []byte, mediaType, digest string) error {
+	if rs.exists(ctx, targetRepo, "manifests", digest) {
+		rs.status.ManifestsSkipped++
+		return nil
+	}
+
+	m, err := ParseManifest(data, mediaType)
+	if err != nil {
+		return err
+	}
+	if m.IsIndex() {
+		for _, child := range m.Manifests {
+			childData, childType, err := rs.sourceManifest(ctx, upstream, repo, child.Digest)
+			if err != nil {
+				return fmt.Errorf("%s: %w", child.Platform.String(), err)
+			}
+			if err := rs.pushTree(ctx, upstream, repo, targetRepo, childData, childType, child.Digest); err != nil {
+				return err
+			}
+		}
+	} else {
+		blobs := append([]ManifestDescriptor{}, m.Layers...)
+		if m.Config != nil {
+			blobs = append(blobs, *m.Config)
+		}
+		for _, desc := range blobs {
+			if err := rs.pushBlob(ctx, upstream, repo, targetRepo, desc); err != nil {
+				return fmt.Errorf("blob %s: %w", desc.Digest, err)
+			}
+		}
+	}
+	return rs.putManifest(ctx, targetRepo, digest, data, mediaType)
+}
+
+// pushBlob 以单次 PUT 上传 blob，目标已存在时跳过
+func (rs *replication) pushBlob(ctx context.Context, upstream, repo, targetRepo string, desc ManifestDescriptor) error {
+	key := targetRepo + "@" + desc.Digest
+	// 外部层（foreign layer）由客户端从 urls 下载，不复制
+	if rs.pushed[key] || len(desc.URLs) > 0 || rs.exists(ctx, targetRepo, "blobs", desc.Digest) {
+		rs.pushed[key] = true
+		rs.status.BlobsSkipped++
+		return nil
+	}
+
+	resp, err := rs.r.do(ctx, rs.t, targetRepo, func() (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, "POST", rs.t.Registry+"/v2/"+targetRepo+"/blobs/uploads/", nil)
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("start upload: status %d", resp.StatusCode)
+	}
+	location, err := url.Parse(rs.t.Registry + "/v2/")
+	if err == nil {
+		location, err = location.Parse(resp.Header.Get("Location"))
+	}
+	if err != nil {
+		return fmt.Errorf("invalid upload location: %w", err)
+	}
+	q := location.Query()
+	q.Set("digest", desc.Digest)
+	location.RawQuery = q.Encode()
+
+	resp, err = rs.r.do(ctx, rs.t, targetRepo, func() (*http.Request, error) {
+		body, err := rs.openBlob(ctx, upstream, repo, desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, "PUT", location.String(), body)
+		if err != nil {
+			body.Close()
+			return nil, err
+		}
+		req.ContentLength = desc.Size
+		req.Header.Set("Content-Type", "application/octet-stream")
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("upload: status %d", resp.StatusCode)
+	}
+
+	rs.pushed[key] = true
+	rs.status.BlobsPushed++
+	rs.status.BytesPushed += desc.Size
+	return nil
+}
+
+// openBlob 优先读取本地缓存，未缓存时从上游拉取（跟随存储重定向）
+func (rs *replication) openBlob(ctx context.Context, upstream, repo, digest string) (io.ReadCloser, error) {
+	if cm := rs.r.p.cacheManager; cm != nil {
+		if _, reader, err := cm.GetBlob(ctx, "", digest); err == nil {
+			return reader, nil
+		}
+	}
+	if upstream == "" {
+		return nil, fmt.Errorf("not found in cache")
+	}
+
+	resp, err := rs.r.p.fetchFromUpstream(ctx, upstream, repo, "blobs", digest, nil)
+	if err != nil {
+		return nil, err
+	}
+	if location := resp.Header.Get("Location"); resp.StatusCode >= 300 && resp.StatusCode < 400 && location != "" {
+		resp.Body.Close()
+		u, err := resp.Request.URL.Parse(location)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		rs.r.p.setUserAgent(req)
+		if resp, err = rs.r.p.transport.RoundTrip(req); err != nil {
+			return nil, err
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("upstream blob status %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// putManifest 按 tag 或 digest 推送 manifest
+func (rs *replication) putManifest(ctx context.Context, targetRepo, reference string, data []byte, mediaType string) error {
+	resp, err := rs.r.do(ctx, rs.t, targetRepo, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "PUT", rs.t.Registry+"/v2/"+targetRepo+"/manifests/"+reference, strings.NewReader(string(data)))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", mediaType)
+		return req, nil
+	})
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("push manifest %s: status %d", reference, resp.StatusCode)
+	}
+	if strings.HasPrefix(reference, "sha256:") {
+		rs.status.ManifestsPushed++
+	}
+	return nil
+}
+
+// exists 检查目标仓库是否已有该内容（blob 可能以重定向响应）
+func (rs *replication) exists(ctx context.Context, targetRepo, kind, digest string) bool {
+	resp, err := rs.r.do(ctx, rs.t, targetRepo, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "HEAD", rs.t.Registry+"/v2/"+targetRepo+"/"+kind+"/"+digest, nil)
+		if err != nil {
+			return nil, err
+		}
+		if kind == "manifests" {
+			req.Header.Set("Accept", strings.Join(replicationAccept, ", "))
+		}
+		return req, nil
+	})
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK || (resp.StatusCode >= 300 && resp.StatusCode < 400)
+}
+
+// -----------------------------------------------------------------------------
+// 目标仓库认证
+// -----------------------------------------------------------------------------
+
+// do 发送请求，遇到 401 时按挑战登录后用新请求重试一次
+func (r *Replicator) do(ctx context.Context, t *ReplicationTarget, repo string, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		r.p.setUserAgent(req)
+		if err := r.authorize(ctx, t, repo, req); err != nil {
+			return nil, err
+		}
+
+		// 复制目标不是镜像仓库上游，不做 DNS 污染检查
+		resp, err := r.p.transport.RoundTrip(req.WithContext(withoutPoisonCheck(req.Context())))
+		if err != nil || resp.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			return resp, err
+		}
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if err := r.login(ctx, t, repo, req.URL.Host, challenge); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// authorize 为请求添加目标仓库凭据；目标与已配置的私有上游（如 ECR）同名时复用其认证器
+func (r *Replicator) authorize(ctx context.Context, t *ReplicationTarget, repo string, req *http.Request) error {
+	if auth, ok := r.p.current().upstreamAuth[req.URL.Host]; ok {
+		return auth.Authorize(ctx, req)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if token := t.tokens[repo]; token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	} else if t.basic {
+		req.SetBasicAuth(t.Username, t.Password)
+	}
+	return nil
+}
+
+// login 按 WWW-Authenticate 挑战获取 push 权限
+func (r *Replicator) login(ctx context.Context, t *ReplicationTarget, repo, host, challenge string) error {
+	if auth, ok := r.p.current().upstreamAuth[host]; ok {
+		auth.Invalidate()
+		return nil
+	}
+
+	scheme := strings.ToLower(challenge)
+	switch {
+	case strings.HasPrefix(scheme, "basic "):
+		if t.Username == "" {
+			return fmt.Errorf("target %s requires credentials", t.Name)
+		}
+		t.mu.Lock()
+		t.basic = true
+		t.mu.Unlock()
+		return nil
+
+	case strings.HasPrefix(scheme, "bearer "):
+		wwwAuth, err := r.p.parseAuthenticate(challenge)
+		if err != nil {
+			return err
+		}
+		authorization := ""
+		if t.Username != "" {
+			authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(t.Username+":"+t.Password))
+		}
+		resp, err := r.p.fetchTokenWithRoundTrip(withoutPoisonCheck(ctx), wwwAuth, "repository:"+repo+":pull,push", authorization)
+		if err != nil {
+			return err
+		}
+		token, err := readRegistryToken(resp)
+		if err != nil {
+			return fmt.Errorf("target %s: %w", t.Name, err)
+		}
+		t.mu.Lock()
+		t.tokens[repo] = token
+		t.mu.Unlock()
+		return nil
+	}
+	return fmt.Errorf("target %s requires unsupported authentication: %q", t.Name, challenge)
+}
+
+// digestOf 计算内容的 sha256 digest
+func digestOf(data []byte) string {
+	hash := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(hash[:])
+}
+
+// manifestMediaType 去掉 Content-Type 参数，缺失时从 manifest 的 mediaType 字段推断
+func manifestMediaType(data []byte, contentType string) string {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && mediaType != "application/octet-stream" {
+		return mediaType
+	}
+	var m struct {
+		MediaType string `json:"mediaType"`
+	}
+	if json.Unmarshal(data, &m) == nil && m.MediaType != "" {
+		return m.MediaType
+	}
+	return MediaTypeDockerManifest
+}
+
+// -----------------------------------------------------------------------------
+// 管理接口
+// -----------------------------------------------------------------------------
+
+// registerReplicationAdminRoutes 注册复制管理接口
+//
+//	GET  /admin/replication              任务状态
+//	POST /admin/replication/{job}/run    后台执行任务
+//	POST /admin/replication              {"target": "harbor", "images": [...]} 立即复制指定镜像
+func (p *ProxyServer) registerReplicationAdminRoutes(r chi.Router) {
+	r.Get("/replication", func(w http.ResponseWriter, r *http.Request) {
+		targets := make([]string, 0, len(p.replicator.targets))
+		for name := range p.replicator.targets {
+			targets = append(targets, name)
+		}
+		p.writeJSON(w, http.StatusOK, map[string]interface{}{
+			"targets": targets,
+			"jobs":    p.replicator.Stats(),
+		})
+	})
+
+	r.Post("/replication/{job}/run", func(w http.ResponseWriter, r *http.Request) {
+		name := chi.URLParam(r, "job")
+		for _, job := range p.replicator.jobs {
+			if job.Name != name {
+				continue
+			}
+			if job.running.Load() {
+				p.writeErrorResponse(w, "replication job is already running", http.StatusConflict)
+				return
+			}
+			go p.replicator.RunJob(context.Background(), job)
+			p.writeJSON(w, http.StatusAccepted, map[string]string{"job": name, "status": "started"})
+			return
+		}
+		p.writeErrorResponse(w, "replication job not found", http.StatusNotFound)
+	})
+
+	r.Post("/replication", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Target string   `json:"target"`
+			Images []string `json:"images"`
+		}
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil || len(req.Images) == 0 {
+			p.writeErrorResponse(w, "request body must be {\"target\": ..., \"images\": [...]}", http.StatusBadRequest)
+			return
+		}
+		target := p.replicator.targets[req.Target]
+		if target == nil {
+			p.writeErrorResponse(w, "replication target not found", http.StatusNotFound)
+			return
+		}
+		p.writeJSON(w, http.StatusOK, p.replicator.Replicate(r.Context(), target, req.Images))
+	})
+}
@@ -0,0 +1,161 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// pushRegistry 支持单次 PUT 上传的最小目标仓库，要求 Basic 认证
+type pushRegistry struct {
+	server *httptest.Server
+
+	mu        sync.Mutex
+	blobs     map[string][]byte // {仓库}@{digest}
+	manifests map[string][]byte // {仓库}:{引用}
+	uploads   int
+}
+
+func newPushRegistry(t *testing.T, username, password string) *pushRegistry {
+	t.Helper()
+	reg := &pushRegistry{blobs: make(map[string][]byte), manifests: make(map[string][]byte)}
+	reg.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != username || pass != password {
+			w.Header().Set("WWW-Authenticate", `Basic realm="push"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		path := strings.TrimPrefix(r.URL.Path, "/v2/")
+		reg.mu.Lock()
+		defer reg.mu.Unlock()
+
+		switch {
+		case r.Method == "POST" && strings.HasSuffix(path, "/blobs/uploads/"):
+			reg.uploads++
+			w.Header().Set("Location", fmt.Sprintf("/v2/%s%d", path, reg.uploads))
+			w.WriteHeader(http.StatusAccepted)
+		case r.Method == "PUT" && strings.Contains(path, "/blobs/uploads/"):
+			repo, _, _ := strings.Cut(path, "/blobs/uploads/")
+			data, _ := io.ReadAll(r.Body)
+			digest := r.URL.Query().Get("digest")
+			if fakeDigest(data) != digest {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			reg.blobs[repo+"@"+digest] = data
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == "PUT" && strings.Contains(path, "/manifests/"):
+			repo, reference, _ := strings.Cut(path, "/manifests/")
+			data, _ := io.ReadAll(r.Body)
+			reg.manifests[repo+":"+reference] = data
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == "HEAD" && strings.Contains(path, "/blobs/"):
+			repo, digest, _ := strings.Cut(path, "/blobs/")
+			if _, ok := reg.blobs[repo+"@"+digest]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case r.Method == "HEAD" && strings.Contains(path, "/manifests/"):
+			repo, reference, _ := strings.Cut(path, "/manifests/")
+			if _, ok := reg.manifests[repo+":"+reference]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(reg.server.Close)
+	return reg
+}
+
+func TestReplicationPushesImage(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	manifestDigest, layers := upstream.addImage("team/app", "v1", []byte("replicated layer"))
+	target := newPushRegistry(t, "robot", "push-secret")
+
+	replicationFile := filepath.Join(t.TempDir(), "replication.json")
+	os.WriteFile(replicationFile, []byte(fmt.Sprintf(`{
+		"targets": [{"name": "harbor", "registry": %q, "namespace": "mirror", "username": "robot", "passwordEnv": "HARBOR_PASSWORD"}],
+		"jobs": [{"name": "apps", "target": "harbor", "images": ["%s/team/app:v1"]}]
+	}`, target.server.URL, testRegistryHost)), 0o600)
+	_, client := newTestProxy(t, upstream, map[string]string{
+		"ADMIN_TOKEN":      testAdminToken,
+		"REPLICATION_FILE": replicationFile,
+		"HARBOR_PASSWORD":  "push-secret",
+	})
+
+	replicate := func() ReplicationStatus {
+		t.Helper()
+		body := fmt.Sprintf(`{"target": "harbor", "images": ["%s/team/app:v1"]}`, testRegistryHost)
+		resp, data := client.admin("POST", "/admin/replication", body)
+		var status ReplicationStatus
+		if resp.StatusCode != http.StatusOK || json.Unmarshal(data, &status) != nil {
+			t.Fatalf("POST /admin/replication: status %d: %s", resp.StatusCode, data)
+		}
+		return status
+	}
+
+	// 镜像未缓存时从上游拉取并推送
+	status := replicate()
+	if status.Images != 1 || status.BlobsPushed != 2 || status.ManifestsPushed == 0 || len(status.Errors) != 0 {
+		t.Errorf("first replication = %+v", status)
+	}
+	target.mu.Lock()
+	if _, ok := target.manifests["mirror/team/app:v1"]; !ok {
+		t.Error("tag mirror/team/app:v1 was not pushed")
+	}
+	if _, ok := target.manifests["mirror/team/app:"+manifestDigest]; !ok {
+		t.Error("manifest was not pushed by digest")
+	}
+	if _, ok := target.blobs["mirror/team/app@"+layers[0]]; !ok {
+		t.Error("layer was not pushed")
+	}
+	target.mu.Unlock()
+
+	// 目标已有该 manifest，只更新 tag
+	if status := replicate(); status.ManifestsSkipped != 1 || status.BlobsPushed != 0 {
+		t.Errorf("second replication = %+v", status)
+	}
+
+	if resp, _ := client.admin("POST", "/admin/replication", `{"target": "missing", "images": ["team/app:v1"]}`); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown target: status %d, want 404", resp.StatusCode)
+	}
+	if resp, _ := client.admin("POST", "/admin/replication/apps/run", ""); resp.StatusCode != http.StatusAccepted {
+		t.Errorf("run job: status %d, want 202", resp.StatusCode)
+	}
+	eventually(t, "replication job to finish", func() bool {
+		_, data := client.admin("GET", "/admin/replication", "")
+		return strings.Contains(string(data), `"job":"apps"`) && strings.Contains(string(data), `"images":1`)
+	})
+}
+
+func TestReplicationWrongCredentials(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	upstream.addImage("team/app", "v1", []byte("layer"))
+	target := newPushRegistry(t, "robot", "push-secret")
+
+	replicationFile := filepath.Join(t.TempDir(), "replication.json")
+	os.WriteFile(replicationFile, []byte(fmt.Sprintf(`{"targets": [{"name": "harbor", "registry": %q, "username": "robot", "password": "wrong"}]}`,
+		target.server.URL)), 0o600)
+	p, _ := newTestProxy(t, upstream, map[string]string{"REPLICATION_FILE": replicationFile})
+
+	status := p.replicator.Replicate(context.Background(), p.replicator.targets["harbor"], []string{testRegistryHost + "/team/app:v1"})
+	if status.Images != 0 || len(status.Errors) != 1 {
+		t.Errorf("replication with wrong password = %+v", status)
+	}
+}
+
+func TestNewReplicatorRejectsUnknownTarget(t *testing.T) {
+	replicationFile := filepath.Join(t.TempDir(), "replication.json")
+	os.WriteFile(replicationFile, []byte(`{"jobs": [{"target": "missing", "images": ["nginx"]}]}`), 0o600)
+	if _, err := NewReplicator(nil, replicationFile); err == nil {
+		t.Error("NewReplicator accepted a job with an unknown target")
+	}
+}
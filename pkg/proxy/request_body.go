@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+)
+
+// =============================================================================
+// 请求体重放 - 小请求体缓存在内存中，重试与跟随重定向时可以重新发送
+// =============================================================================
+
+// proxyRequestBody 返回转发到上游的请求体与长度（-1 表示未知）
+// 不超过 UPSTREAM_RETRY_BODY_LIMIT 的请求体读入内存（http.NewRequest 据此设置 GetBody），
+// 原始请求体同时替换为内存副本，同一请求可以多次构造上游请求；
+// 更大或读取出错的请求体流式转发，只能发送一次
+func (p *ProxyServer) proxyRequestBody(r *http.Request) (io.Reader, int64) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, 0
+	}
+	limit := p.config.RetryBodyLimit
+	if limit <= 0 || r.ContentLength > limit {
+		return r.Body, r.ContentLength
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil || int64(len(data)) > limit {
+		// 已读取的部分放回流的开头
+		return io.MultiReader(bytes.NewReader(data), r.Body), r.ContentLength
+	}
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	return bytes.NewReader(data), int64(len(data))
+}
+
+// hasRequestBody 请求是否携带请求体
+func hasRequestBody(req *http.Request) bool {
+	return req.Body != nil && req.Body != http.NoBody
+}
+
+// resendRedirect 以原方法和请求体向 307/308 重定向目标重新发送带请求体的请求（如推送时的上传地址）。
+// 请求体是流式转发、已被消费时无法重发，把重定向返回给客户端由其自行重发
+func (p *ProxyServer) resendRedirect(w http.ResponseWriter, req *http.Request, resp *http.Response, target *url.URL) {
+	if req.GetBody == nil || (resp.StatusCode != http.StatusTemporaryRedirect && resp.StatusCode != http.StatusPermanentRedirect) {
+		if p.config.Debug {
+			log.Printf("[DEBUG] %s body cannot be re-sent to %s, returning redirect %d to client", req.Method, target.Host, resp.StatusCode)
+		}
+		p.copyResponseRoundTrip(w, resp)
+		return
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		p.writeErrorResponse(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	redirect := req.Clone(req.Context())
+	redirect.URL = target
+	redirect.Host = target.Host
+	redirect.Header.Set("Host", target.Host)
+	redirect.Body = body
+	// 跨域重定向不携带上游凭据
+	if target.Host != req.URL.Host {
+		redirect.Header.Del("Authorization")
+	}
+
+	redirected, err := p.withRetries(redirect, p.transport.RoundTrip)
+	if err != nil {
+		p.writeErrorResponse(w, "redirect request failed: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer redirected.Body.Close()
+	p.hookUpstreamResponse(redirect, redirected)
+	p.copyResponseRoundTrip(w, redirected)
+}
@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRetriedRequestResendsBody(t *testing.T) {
+	p := newTestProxyServer(t, newFakeRegistry(t), map[string]string{"UPSTREAM_RETRIES": "2"})
+	upstream := newFlakyUpstream(t, 2, http.StatusServiceUnavailable)
+	payload := `{"mediaType":"application/vnd.oci.image.manifest.v1+json"}`
+
+	client := httptest.NewRequest(http.MethodPut, "/v2/team/app/manifests/v1", strings.NewReader(payload))
+	body, length := p.proxyRequestBody(client)
+	req, _ := http.NewRequest(http.MethodPut, upstream.URL+"/v2/team/app/manifests/v1", body)
+	req.ContentLength = length
+	resp, err := p.withRetries(req, p.transport.RoundTrip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || len(upstream.bodies) != 3 {
+		t.Fatalf("status %d after %d attempts, want 200 after 3", resp.StatusCode, len(upstream.bodies))
+	}
+	for i, got := range upstream.bodies {
+		if got != payload {
+			t.Errorf("attempt %d sent %q, want %q", i+1, got, payload)
+		}
+	}
+	// 原始请求体替换为内存副本，可以再次读取
+	if again, _ := io.ReadAll(client.Body); string(again) != payload {
+		t.Errorf("client body after buffering = %q", again)
+	}
+}
+
+func TestStreamedRequestBodyNotRetried(t *testing.T) {
+	p := newTestProxyServer(t, newFakeRegistry(t), map[string]string{
+		"UPSTREAM_RETRIES":          "2",
+		"UPSTREAM_RETRY_BODY_LIMIT": "16",
+	})
+	upstream := newFlakyUpstream(t, 1, http.StatusServiceUnavailable)
+	payload := strings.Repeat("layer chunk ", 8)
+
+	// 超过 UPSTREAM_RETRY_BODY_LIMIT 的请求体流式转发，http.NewRequest 不会设置 GetBody
+	body, length := p.proxyRequestBody(httptest.NewRequest(http.MethodPut, "/v2/team/app/blobs/uploads/1", strings.NewReader(payload)))
+	req, _ := http.NewRequest(http.MethodPut, upstream.URL+"/v2/team/app/blobs/uploads/1", body)
+	req.ContentLength = length
+	if req.GetBody != nil {
+		t.Fatal("streamed body can be re-read")
+	}
+	resp, err := p.withRetries(req, p.transport.RoundTrip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusServiceUnavailable || len(upstream.bodies) != 1 {
+		t.Fatalf("status %d after %d attempts, want 503 after 1", resp.StatusCode, len(upstream.bodies))
+	}
+	if upstream.bodies[0] != payload {
+		t.Errorf("streamed body = %q, want %q", upstream.bodies[0], payload)
+	}
+}
@@ -0,0 +1,45 @@
+package proxy
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// =============================================================================
+// 请求 ID - 每个请求都分配 ID，通过 X-Request-Id 返回给客户端并转发给上游，
+// 同时写入访问日志与错误响应，便于按用户反馈的 ID 查找日志
+// =============================================================================
+
+// requestIDPattern 可沿用的传入请求 ID（来自前置负载均衡或客户端），其他值重新生成
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:/+=-]{1,128}$`)
+
+// newRequestID 生成 16 字节随机请求 ID
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// requestIDMiddleware 确定请求 ID 并写入 context（访问日志与 middleware.GetReqID 使用）和响应头
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(middleware.RequestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(middleware.RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), middleware.RequestIDKey, id)))
+	})
+}
+
+// setRequestID 将请求 ID 转发给上游，便于与上游日志关联
+func setRequestID(req *http.Request) {
+	if id := middleware.GetReqID(req.Context()); id != "" {
+		req.Header.Set(middleware.RequestIDHeader, id)
+	}
+}
@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRequestIDPropagation(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	upstream.addImage("team/app", "v1", []byte("layer"))
+	_, client := newTestProxy(t, upstream, nil)
+	client.login("team/app")
+
+	manifest := "/v2/team/app/manifests/v1"
+	resp, _ := client.do("GET", manifest, http.Header{"Accept": {fakeManifestType}})
+	id := resp.Header.Get("X-Request-Id")
+	if id == "" {
+		t.Fatal("response has no X-Request-Id")
+	}
+	if got := upstream.header("GET", manifest).Get("X-Request-Id"); got != id {
+		t.Errorf("upstream X-Request-Id = %q, want %q", got, id)
+	}
+
+	// 前置负载均衡传入的 ID 沿用，不合法的值重新生成
+	resp, _ = client.do("GET", "/v2/team/app/manifests/v2", http.Header{"X-Request-Id": {"lb-1234"}})
+	if got := resp.Header.Get("X-Request-Id"); got != "lb-1234" {
+		t.Errorf("X-Request-Id = %q, want the incoming lb-1234", got)
+	}
+	resp, _ = client.do("GET", manifest, http.Header{"X-Request-Id": {"bad id\twith spaces"}})
+	if got := resp.Header.Get("X-Request-Id"); got == "" || strings.Contains(got, " ") {
+		t.Errorf("X-Request-Id = %q, want a generated ID", got)
+	}
+
+	// 代理自身返回的错误在 detail 中带请求 ID（上游 429 后暂停期间的请求）
+	upstream.configure(func(f *fakeRegistry) { f.throttle = 1 })
+	client.do("GET", "/v2/team/app/manifests/v3", nil)
+	resp, body := client.do("GET", "/v2/team/app/manifests/v3", nil)
+	var parsed struct {
+		Errors []struct {
+			Detail struct {
+				RequestID string `json:"requestId"`
+			} `json:"detail"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil || len(parsed.Errors) == 0 {
+		t.Fatalf("status %d: unexpected error body %s", resp.StatusCode, body)
+	}
+	if got := parsed.Errors[0].Detail.RequestID; got != resp.Header.Get("X-Request-Id") || got == "" {
+		t.Errorf("error detail requestId = %q, header %q", got, resp.Header.Get("X-Request-Id"))
+	}
+}
@@ -0,0 +1,203 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// =============================================================================
+// 响应头控制 - 按路由剥离、保留或添加返回给客户端的响应头
+//
+//	RESPONSE_HEADERS_STRIP="*=RateLimit-*|Docker-Ratelimit-Source"
+//	RESPONSE_HEADERS_KEEP="ghcr=X-GitHub-Request-Id"
+//	RESPONSE_HEADERS_ADD="*=X-Mirror-Name:mirror-1,docker=X-Upstream:docker-hub"
+//
+// 路由名与 UPSTREAM_MIRRORS 相同，* 表示全部路由。规则在写出响应时执行，
+// 缓存中保存的仍是上游原始响应头，修改规则后对已缓存内容立即生效
+// =============================================================================
+
+// essentialResponseHeaders 客户端拉取依赖的响应头，不受剥离与保留规则影响
+var essentialResponseHeaders = map[string]bool{
+	"Content-Type":                    true,
+	"Content-Length":                  true,
+	"Content-Range":                   true,
+	"Content-Encoding":                true,
+	"Docker-Content-Digest":           true,
+	"Docker-Distribution-Api-Version": true,
+	"Location":                        true,
+	"Www-Authenticate":                true,
+	"Retry-After":                     true,
+}
+
+// headerRules 单个路由的响应头规则
+type headerRules struct {
+	strip []string    // 剥离的响应头，支持前缀通配（RateLimit-*）
+	keep  []string    // 非空时只保留这些响应头（及必要响应头）
+	add   http.Header // 添加或覆盖的响应头
+}
+
+// parseResponseHeaderRules 解析 RESPONSE_HEADERS_*，返回 路由 host（* 表示全部路由）-> 规则
+func parseResponseHeaderRules(strip, keep, add, customDomain string) map[string]*headerRules {
+	rules := make(map[string]*headerRules)
+	ruleFor := func(name string) *headerRules {
+		host := name
+		if name != "*" {
+			host = name + "." + customDomain
+		}
+		if rules[host] == nil {
+			rules[host] = &headerRules{add: make(http.Header)}
+		}
+		return rules[host]
+	}
+	each := func(value string, fn func(rule *headerRules, item string)) {
+		for _, entry := range strings.Split(value, ",") {
+			name, items, ok := strings.Cut(strings.TrimSpace(entry), "=")
+			name = strings.TrimSpace(name)
+			if !ok || name == "" {
+				continue
+			}
+			for _, item := range strings.Split(items, "|") {
+				if item = strings.TrimSpace(item); item != "" {
+					fn(ruleFor(name), item)
+				}
+			}
+		}
+	}
+
+	each(strip, func(rule *headerRules, item string) {
+		rule.strip = append(rule.strip, http.CanonicalHeaderKey(item))
+	})
+	each(keep, func(rule *headerRules, item string) {
+		rule.keep = append(rule.keep, http.CanonicalHeaderKey(item))
+	})
+	each(add, func(rule *headerRules, item string) {
+		if key, value, ok := strings.Cut(item, ":"); ok && strings.TrimSpace(key) != "" {
+			rule.add.Add(strings.TrimSpace(key), strings.TrimSpace(value))
+		}
+	})
+	return rules
+}
+
+// responseHeaderRulesFor 合并全部路由（*）与指定路由的规则
+func responseHeaderRulesFor(rules map[string]*headerRules, host string) *headerRules {
+	return mergeHeaderRules(rules["*"], rules[host])
+}
+
+// mergeHeaderRules 合并两组规则：剥离规则取并集，保留列表与添加的同名响应头以 over 为准
+func mergeHeaderRules(base, over *headerRules) *headerRules {
+	switch {
+	case base == nil:
+		return over
+	case over == nil:
+		return base
+	}
+	merged := &headerRules{
+		strip: append(append([]string{}, base.strip...), over.strip...),
+		keep:  over.keep,
+		add:   base.add.Clone(),
+	}
+	if len(merged.keep) == 0 {
+		merged.keep = base.keep
+	}
+	for key, values := range over.add {
+		merged.add[key] = values
+	}
+	return merged
+}
+
+// headerMatches 响应头名是否匹配规则（支持 Prefix-* 前缀通配）
+func headerMatches(key string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if key == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// apply 按规则修改响应头
+func (h *headerRules) apply(header http.Header) {
+	for key := range header {
+		if essentialResponseHeaders[key] {
+			continue
+		}
+		if headerMatches(key, h.strip) || (len(h.keep) > 0 && !headerMatches(key, h.keep)) {
+			header.Del(key)
+		}
+	}
+	for key, values := range h.add {
+		header[key] = values
+	}
+}
+
+// responseHeaderMiddleware 在写出响应头前执行当前路由的响应头规则（RESPONSE_HEADERS_* 与 HEADER_RULES）
+func (p *ProxyServer) responseHeaderMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rules := mergeHeaderRules(responseHeaderRulesFor(p.current().responseHeaders, r.Host), p.headerRules.responseRules(r))
+		if rules == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(&headerRuleWriter{ResponseWriter: w, rules: rules}, r)
+	})
+}
+
+// headerRuleWriter 首次写出响应头时执行规则
+type headerRuleWriter struct {
+	http.ResponseWriter
+	rules       *headerRules
+	wroteHeader bool
+}
+
+func (h *headerRuleWriter) WriteHeader(statusCode int) {
+	if h.wroteHeader {
+		return
+	}
+	h.wroteHeader = true
+	h.rules.apply(h.Header())
+	h.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (h *headerRuleWriter) Write(b []byte) (int, error) {
+	if !h.wroteHeader {
+		h.WriteHeader(http.StatusOK)
+	}
+	return h.ResponseWriter.Write(b)
+}
+
+func (h *headerRuleWriter) Flush() {
+	if !h.wroteHeader {
+		h.WriteHeader(http.StatusOK)
+	}
+	if f, ok := h.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// ReadFrom 保留底层连接的 sendfile 零拷贝发送
+func (h *headerRuleWriter) ReadFrom(src io.Reader) (int64, error) {
+	if !h.wroteHeader {
+		h.WriteHeader(http.StatusOK)
+	}
+	if rf, ok := h.ResponseWriter.(io.ReaderFrom); ok {
+		return rf.ReadFrom(src)
+	}
+	return io.Copy(h.ResponseWriter, src)
+}
+
+// Hijack chi 的 WrapResponseWriter 只在 Flush、Hijack 与 ReadFrom 齐全时才保留 ReadFrom
+func (h *headerRuleWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if hj, ok := h.ResponseWriter.(http.Hijacker); ok {
+		return hj.Hijack()
+	}
+	return nil, nil, http.ErrNotSupported
+}
+
+func (h *headerRuleWriter) Unwrap() http.ResponseWriter { return h.ResponseWriter }
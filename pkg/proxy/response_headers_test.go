@@ -0,0 +1,32 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestResponseHeaderRules(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	digest, _ := upstream.addImage("team/app", "v1", []byte("layer"))
+	p, client := newTestProxy(t, upstream, map[string]string{
+		"RESPONSE_HEADERS_STRIP": "*=X-Cache|Docker-Content-Digest",
+		"RESPONSE_HEADERS_ADD":   "*=X-Mirror-Name:test-mirror",
+	})
+
+	client.login("team/app")
+	accept := http.Header{"Accept": {fakeManifestType}}
+	for _, source := range []string{"upstream", "cache"} {
+		resp, _ := client.do("GET", "/v2/team/app/manifests/v1", accept)
+		if resp.Header.Get("X-Cache") != "" {
+			t.Errorf("%s: X-Cache %q was not stripped", source, resp.Header.Get("X-Cache"))
+		}
+		if got := resp.Header.Get("X-Mirror-Name"); got != "test-mirror" {
+			t.Errorf("%s: X-Mirror-Name %q, want test-mirror", source, got)
+		}
+		// 客户端依赖的响应头不受剥离规则影响
+		if got := resp.Header.Get("Docker-Content-Digest"); got != digest {
+			t.Errorf("%s: Docker-Content-Digest %q, want %q", source, got, digest)
+		}
+		waitCached(t, p, "team/app", "v1", nil)
+	}
+}
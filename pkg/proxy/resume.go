@@ -0,0 +1,136 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// =============================================================================
+// 断点续传 - 上游连接中途断开时以 Range 请求从已接收位置继续，最终校验 digest
+// =============================================================================
+
+// resumableBody 包装上游 blob 响应体，读取出错时自动续传
+type resumableBody struct {
+	p       *ProxyServer
+	req     *http.Request // 原始上游请求，续传时复制并附加 Range
+	body    io.ReadCloser
+	offset  int64
+	total   int64
+	retries int
+	digest  string // 期望的 sha256 digest，为空时不校验
+	hash    hash.Hash
+}
+
+// wrapResumable 对完整（200）且长度已知的 blob GET 响应启用续传
+func (p *ProxyServer) wrapResumable(req *http.Request, resp *http.Response, digest string) bool {
+	if p.config.ResumeRetries <= 0 || req.Method != "GET" || resp.StatusCode != http.StatusOK ||
+		resp.ContentLength <= 0 || req.Header.Get("Range") != "" {
+		return false
+	}
+	if !strings.HasPrefix(digest, "sha256:") {
+		digest = ""
+	}
+
+	resp.Body = &resumableBody{
+		p:       p,
+		req:     req,
+		body:    resp.Body,
+		total:   resp.ContentLength,
+		retries: p.config.ResumeRetries,
+		digest:  digest,
+		hash:    sha256.New(),
+	}
+	return true
+}
+
+func (b *resumableBody) Read(buf []byte) (int, error) {
+	for {
+		n, err := b.body.Read(buf)
+		if n > 0 {
+			b.hash.Write(buf[:n])
+			b.offset += int64(n)
+		}
+
+		if err == io.EOF && b.offset >= b.total {
+			if verifyErr := b.verify(); verifyErr != nil {
+				return n, verifyErr
+			}
+			return n, io.EOF
+		}
+		if err == nil {
+			return n, nil
+		}
+
+		// 连接中断（或提前 EOF）：尝试续传
+		if resumeErr := b.resume(err); resumeErr != nil {
+			return n, resumeErr
+		}
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// resume 以 Range 请求从当前位置重新获取剩余内容
+func (b *resumableBody) resume(cause error) error {
+	b.body.Close()
+	if cause == io.EOF {
+		cause = io.ErrUnexpectedEOF
+	}
+
+	for attempt := 1; attempt <= b.retries; attempt++ {
+		ctx := b.req.Context()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		log.Printf("Upstream transfer of %s interrupted at %d/%d bytes (%v), resuming (attempt %d/%d)",
+			b.req.URL.Host+b.req.URL.Path, b.offset, b.total, cause, attempt, b.retries)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * time.Second):
+		}
+
+		req := b.req.Clone(ctx)
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", b.offset))
+		resp, err := b.p.transport.RoundTrip(req)
+		if err != nil {
+			cause = err
+			continue
+		}
+
+		expected := fmt.Sprintf("bytes %d-", b.offset)
+		if resp.StatusCode != http.StatusPartialContent || !strings.HasPrefix(resp.Header.Get("Content-Range"), expected) {
+			resp.Body.Close()
+			return fmt.Errorf("upstream does not support resuming (status %d): %w", resp.StatusCode, cause)
+		}
+
+		b.body = resp.Body
+		return nil
+	}
+	return fmt.Errorf("resume failed after %d attempts: %w", b.retries, cause)
+}
+
+// verify 校验完整内容的 digest，拼接出错的内容不会进入缓存
+func (b *resumableBody) verify() error {
+	if b.digest == "" {
+		return nil
+	}
+	if actual := "sha256:" + hex.EncodeToString(b.hash.Sum(nil)); actual != b.digest {
+		return fmt.Errorf("digest mismatch: expected %s, got %s", b.digest, actual)
+	}
+	return nil
+}
+
+func (b *resumableBody) Close() error {
+	return b.body.Close()
+}
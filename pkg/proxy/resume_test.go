@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestInterruptedBlobTransferResumes(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	layer := bytes.Repeat([]byte("resumable layer data "), 4096)
+	_, layers := upstream.addImage("team/app", "v1", layer)
+	_, client := newTestProxy(t, upstream, map[string]string{"UPSTREAM_RESUME_RETRIES": "2"})
+
+	client.login("team/app")
+	upstream.configure(func(f *fakeRegistry) { f.truncateBlobs = 1 })
+	resp, body := client.do("GET", "/v2/team/app/blobs/"+layers[0], nil)
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(body, layer) {
+		t.Fatalf("status %d, received %d/%d bytes intact=%v", resp.StatusCode, len(body), len(layer), bytes.Equal(body, layer))
+	}
+
+	want := fmt.Sprintf("bytes=%d-", len(layer)/2)
+	if ranges := upstream.rangeRequests(); len(ranges) != 1 || ranges[0] != want {
+		t.Fatalf("upstream Range requests %q, want [%s]", ranges, want)
+	}
+}
+
+func TestResumeRejectsUnusableResponses(t *testing.T) {
+	layer := bytes.Repeat([]byte("resumable layer data "), 4096)
+	half := len(layer) / 2
+	for _, tc := range []struct {
+		name   string
+		resume func(w http.ResponseWriter)
+		want   string
+	}{
+		{"range ignored", func(w http.ResponseWriter) {
+			w.Write(layer)
+		}, "does not support resuming"},
+		{"different content", func(w http.ResponseWriter) {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", half, len(layer)-1, len(layer)))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(bytes.ToUpper(layer[half:]))
+		}, "digest mismatch"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// 完整请求只发送一半内容后断开，续传请求由 tc.resume 响应
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Range") != "" {
+					tc.resume(w)
+					return
+				}
+				w.Header().Set("Content-Length", fmt.Sprint(len(layer)))
+				w.Write(layer[:half])
+				w.(http.Flusher).Flush()
+				panic(http.ErrAbortHandler)
+			}))
+			t.Cleanup(server.Close)
+
+			p, _ := newTestProxy(t, newFakeRegistry(t), map[string]string{"UPSTREAM_RESUME_RETRIES": "1"})
+			req, _ := http.NewRequest("GET", server.URL+"/v2/team/app/blobs/"+fakeDigest(layer), nil)
+			resp, err := p.transport.RoundTrip(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if !p.wrapResumable(req, resp, fakeDigest(layer)) {
+				t.Fatal("wrapResumable did not wrap a complete blob response")
+			}
+			if _, err := io.ReadAll(resp.Body); err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("read error = %v, want %q", err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package proxy
+
+import (
+	"context"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// =============================================================================
+// 上游重试策略 - 指数退避 + 随机抖动，按状态码与 Retry-After 重试幂等请求
+// =============================================================================
+
+// retryDrainLimit 重试前读取并丢弃的响应体上限，便于复用连接
+const retryDrainLimit = 64 << 10
+
+// parseRetryStatuses 解析 UPSTREAM_RETRY_STATUSES（逗号分隔的状态码）
+func parseRetryStatuses(value string) map[int]bool {
+	statuses := make(map[int]bool)
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		code, err := strconv.Atoi(item)
+		if err != nil || code < 100 || code > 599 {
+			log.Printf("Ignoring invalid UPSTREAM_RETRY_STATUSES entry %q", item)
+			continue
+		}
+		statuses[code] = true
+	}
+	return statuses
+}
+
+// retryable 请求是否可以安全重发：方法幂等，且请求体为空或可以重新获取
+// POST / PATCH 与已被读取的流式请求体不重试
+func retryable(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+	default:
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// retryBackoff 第 attempt 次重试（从 1 开始）前的等待时间：base * 2^(attempt-1)，
+// 不超过 max，并在 [d/2, d] 内随机抖动，避免大量客户端同时重试
+func retryBackoff(base, max time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	d := base
+	for i := 1; i < attempt && (max <= 0 || d < max); i++ {
+		d *= 2
+	}
+	if max > 0 && d > max {
+		d = max
+	}
+	half := d / 2
+	return half + rand.N(d-half+1)
+}
+
+// parseRetryAfter 解析 Retry-After（秒数或 HTTP 日期）
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// sleepContext 等待 d，context 结束时提前返回 false
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// withRetries 按请求生效的重试设置执行 do：连接失败或返回 UPSTREAM_RETRY_STATUSES 中的状态码时重试。
+// 上游给出的 Retry-After 优先于计算的退避时间，超过 UPSTREAM_RETRY_MAX_BACKOFF 或请求截止时间时
+// 不再重试，直接返回上游响应
+func (p *ProxyServer) withRetries(req *http.Request, do func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	t := p.timeoutsFromContext(req.Context())
+	if t.Retries <= 0 {
+		return do(req)
+	}
+	if !retryable(req) {
+		resp, err := do(req)
+		if p.config.Debug && (err != nil || p.config.RetryStatuses[resp.StatusCode]) {
+			reason := "method is not idempotent"
+			if hasRequestBody(req) && req.GetBody == nil {
+				reason = "request body is streamed (larger than UPSTREAM_RETRY_BODY_LIMIT)"
+			}
+			log.Printf("[DEBUG] Upstream %s %s not retried: %s", req.Method, req.URL.Redacted(), reason)
+		}
+		return resp, err
+	}
+
+	ctx := req.Context()
+	var record retryRecord
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				p.retryStats.finish(req, &record, retryOutcomeGaveUp, nil, err)
+				return nil, err
+			}
+			req = req.Clone(ctx)
+			req.Body = body
+		}
+
+		resp, err := do(req)
+		if attempt >= t.Retries || ctx.Err() != nil {
+			outcome := retryOutcomeRecovered
+			switch {
+			case ctx.Err() != nil:
+				outcome = retryOutcomeCanceled
+			case err != nil || p.config.RetryStatuses[resp.StatusCode]:
+				outcome = retryOutcomeExhausted
+			}
+			p.retryStats.finish(req, &record, outcome, resp, err)
+			return resp, err
+		}
+
+		wait := retryBackoff(t.Backoff, t.MaxBackoff, attempt+1)
+		if err == nil {
+			// 429 由按上游的暂停统一处理，不再由每个请求各自重试
+			if !p.config.RetryStatuses[resp.StatusCode] ||
+				(resp.StatusCode == http.StatusTooManyRequests && p.rateLimits.handles429()) {
+				p.retryStats.finish(req, &record, retryOutcomeRecovered, resp, nil)
+				return resp, nil
+			}
+			if after, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				if t.MaxBackoff > 0 && after > t.MaxBackoff {
+					p.retryStats.finish(req, &record, retryOutcomeGaveUp, resp, nil)
+					return resp, nil
+				}
+				wait = after
+			}
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+				p.retryStats.finish(req, &record, retryOutcomeGaveUp, resp, nil)
+				return resp, nil
+			}
+			io.CopyN(io.Discard, resp.Body, retryDrainLimit)
+			resp.Body.Close()
+		}
+
+		if p.config.Debug {
+			if err != nil {
+				log.Printf("[DEBUG] Upstream %s %s failed (attempt %d/%d): %v, retrying in %s",
+					req.Method, req.URL.Redacted(), attempt+1, t.Retries+1, err, wait)
+			} else {
+				log.Printf("[DEBUG] Upstream %s %s returned %d (attempt %d/%d), retrying in %s",
+					req.Method, req.URL.Redacted(), resp.StatusCode, attempt+1, t.Retries+1, wait)
+			}
+		}
+		p.retryStats.retry(req, &record, retryReason(resp, err), wait)
+		if !sleepContext(ctx, wait) {
+			p.retryStats.finish(req, &record, retryOutcomeCanceled, nil, ctx.Err())
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// =============================================================================
+// 重试统计 - 按上游记录重试次数与原因、退避时间和重试后的结果，
+// 原因区分 DNS / 建连失败（多为本地网络）与超时、连接中断和上游状态码（多为上游问题）
+// =============================================================================
+
+// 重试后的请求结果
+const (
+	retryOutcomeRecovered = "recovered" // 重试后成功
+	retryOutcomeExhausted = "exhausted" // 用完重试次数仍然失败
+	retryOutcomeGaveUp    = "gave_up"   // Retry-After 超过上限或请求截止时间，不再等待
+	retryOutcomeCanceled  = "canceled"  // 等待期间请求被取消或超时
+)
+
+// retryStats 各上游的重试统计
+type retryStats struct {
+	mu       sync.Mutex
+	retries  map[[2]string]int64      // [上游, 原因] -> 重试次数
+	outcomes map[[2]string]int64      // [上游, 结果] -> 发生过重试的请求数
+	backoff  map[string]time.Duration // 上游 -> 累计退避时间
+}
+
+func newRetryStats() *retryStats {
+	return &retryStats{
+		retries:  make(map[[2]string]int64),
+		outcomes: make(map[[2]string]int64),
+		backoff:  make(map[string]time.Duration),
+	}
+}
+
+// retryRecord 一个请求的重试过程
+type retryRecord struct {
+	reasons []string
+	waited  time.Duration
+}
+
+// retryReason 重试原因：上游状态码，或按连接错误分类（dns、connect、timeout、connection）
+func retryReason(resp *http.Response, err error) string {
+	if err == nil {
+		return strconv.Itoa(resp.StatusCode)
+	}
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &dnsErr):
+		return "dns"
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return "connect"
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout(),
+		strings.Contains(err.Error(), "timeout"):
+		return "timeout"
+	}
+	return "connection"
+}
+
+// retry 记录一次重试
+func (s *retryStats) retry(req *http.Request, record *retryRecord, reason string, wait time.Duration) {
+	record.reasons = append(record.reasons, reason)
+	record.waited += wait
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retries[[2]string{req.URL.Host, reason}]++
+	s.backoff[req.URL.Host] += wait
+}
+
+// finish 记录发生过重试的请求的结果，并输出一行 key=value 格式的日志
+func (s *retryStats) finish(req *http.Request, record *retryRecord, outcome string, resp *http.Response, err error) {
+	if len(record.reasons) == 0 {
+		return
+	}
+	if s != nil {
+		s.mu.Lock()
+		s.outcomes[[2]string{req.URL.Host, outcome}]++
+		s.mu.Unlock()
+	}
+
+	result := "error"
+	switch {
+	case err != nil:
+		result = strconv.Quote(err.Error())
+	case resp != nil:
+		result = strconv.Itoa(resp.StatusCode)
+	}
+	log.Printf("Upstream retry: upstream=%s method=%s path=%s attempts=%d outcome=%s reasons=%s backoff=%s result=%s request_id=%s",
+		req.URL.Host, req.Method, req.URL.Path, len(record.reasons)+1, outcome, strings.Join(record.reasons, ","),
+		record.waited.Round(time.Millisecond), result, middleware.GetReqID(req.Context()))
+}
+
+// writeMetrics 输出重试指标
+func (s *retryStats) writeMetrics(m *metricsWriter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range sortedPairs(s.retries) {
+		m.counter("docker_proxy_upstream_retries_total", "Upstream request retries by reason (status code, dns, connect, timeout or connection)",
+			float64(s.retries[key]), "upstream", key[0], "reason", key[1])
+	}
+	hosts := make([]string, 0, len(s.backoff))
+	for host := range s.backoff {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		m.counter("docker_proxy_upstream_retry_backoff_seconds_total", "Time spent waiting between upstream retries",
+			s.backoff[host].Seconds(), "upstream", host)
+	}
+	for _, key := range sortedPairs(s.outcomes) {
+		m.counter("docker_proxy_upstream_retried_requests_total", "Upstream requests that were retried, by final outcome",
+			float64(s.outcomes[key]), "upstream", key[0], "outcome", key[1])
+	}
+}
+
+// sortedPairs 按字典序返回二元组键
+func sortedPairs(m map[[2]string]int64) [][2]string {
+	keys := make([][2]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	return keys
+}
@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// flakyUpstream 前 failures 次请求返回 status，之后返回 200；记录每次请求的到达时间与请求体
+type flakyUpstream struct {
+	*httptest.Server
+	mu         sync.Mutex
+	failures   int
+	status     int
+	retryAfter string
+	arrivals   []time.Time
+	bodies     []string
+}
+
+func newFlakyUpstream(t *testing.T, failures, status int) *flakyUpstream {
+	t.Helper()
+	u := &flakyUpstream{failures: failures, status: status}
+	u.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		u.mu.Lock()
+		u.arrivals = append(u.arrivals, time.Now())
+		u.bodies = append(u.bodies, string(body))
+		fail := len(u.arrivals) <= u.failures
+		u.mu.Unlock()
+		if fail {
+			if u.retryAfter != "" {
+				w.Header().Set("Retry-After", u.retryAfter)
+			}
+			w.WriteHeader(u.status)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(u.Close)
+	return u
+}
+
+// attempts 收到的请求数
+func (u *flakyUpstream) attempts() int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return len(u.arrivals)
+}
+
+// gaps 相邻两次请求的间隔
+func (u *flakyUpstream) gaps() []time.Duration {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	var gaps []time.Duration
+	for i := 1; i < len(u.arrivals); i++ {
+		gaps = append(gaps, u.arrivals[i].Sub(u.arrivals[i-1]))
+	}
+	return gaps
+}
+
+func TestRetryPolicy(t *testing.T) {
+	p := newTestProxyServer(t, newFakeRegistry(t), map[string]string{"UPSTREAM_RETRIES": "2"})
+
+	for _, tc := range []struct {
+		name       string
+		method     string
+		failures   int
+		status     int
+		retryAfter string
+		wantStatus int
+		attempts   int
+	}{
+		{"GET recovers", http.MethodGet, 2, http.StatusServiceUnavailable, "", http.StatusOK, 3},
+		{"HEAD recovers", http.MethodHead, 1, http.StatusBadGateway, "", http.StatusOK, 2},
+		{"attempt limit", http.MethodGet, 5, http.StatusServiceUnavailable, "", http.StatusServiceUnavailable, 3},
+		{"POST not retried", http.MethodPost, 1, http.StatusServiceUnavailable, "", http.StatusServiceUnavailable, 1},
+		{"PATCH not retried", http.MethodPatch, 1, http.StatusBadGateway, "", http.StatusBadGateway, 1},
+		{"404 not retried", http.MethodGet, 1, http.StatusNotFound, "", http.StatusNotFound, 1},
+		{"401 not retried", http.MethodGet, 1, http.StatusUnauthorized, "", http.StatusUnauthorized, 1},
+		{"500 not in retry statuses", http.MethodGet, 1, http.StatusInternalServerError, "", http.StatusInternalServerError, 1},
+		{"Retry-After beyond max backoff", http.MethodGet, 1, http.StatusServiceUnavailable, "3600", http.StatusServiceUnavailable, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			upstream := newFlakyUpstream(t, tc.failures, tc.status)
+			upstream.retryAfter = tc.retryAfter
+			req, _ := http.NewRequest(tc.method, upstream.URL+"/v2/team/app/manifests/v1", nil)
+			resp, err := p.withRetries(req, p.transport.RoundTrip)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tc.wantStatus || upstream.attempts() != tc.attempts {
+				t.Errorf("status %d after %d attempts, want %d after %d", resp.StatusCode, upstream.attempts(), tc.wantStatus, tc.attempts)
+			}
+		})
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := newTestProxyServer(t, newFakeRegistry(t), map[string]string{
+		"UPSTREAM_RETRIES":           "3",
+		"UPSTREAM_RETRY_BACKOFF":     "40ms",
+		"UPSTREAM_RETRY_MAX_BACKOFF": "50ms",
+	})
+	upstream := newFlakyUpstream(t, 3, http.StatusServiceUnavailable)
+	req, _ := http.NewRequest(http.MethodGet, upstream.URL+"/v2/", nil)
+	resp, err := p.withRetries(req, p.transport.RoundTrip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// 退避为 40ms、80ms（截断为 50ms）、50ms，各自在 [d/2, d] 内抖动
+	minimum := []time.Duration{20 * time.Millisecond, 25 * time.Millisecond, 25 * time.Millisecond}
+	gaps := upstream.gaps()
+	if resp.StatusCode != http.StatusOK || len(gaps) != len(minimum) {
+		t.Fatalf("status %d after %d attempts", resp.StatusCode, upstream.attempts())
+	}
+	for i, gap := range gaps {
+		if gap < minimum[i] {
+			t.Errorf("retry %d after %s, want at least %s", i+1, gap, minimum[i])
+		}
+	}
+
+	for attempt, d := range map[int]time.Duration{1: 40 * time.Millisecond, 2: 50 * time.Millisecond, 5: 50 * time.Millisecond} {
+		for i := 0; i < 100; i++ {
+			if wait := retryBackoff(40*time.Millisecond, 50*time.Millisecond, attempt); wait < d/2 || wait > d {
+				t.Fatalf("retryBackoff(attempt %d) = %s, want within [%s, %s]", attempt, wait, d/2, d)
+			}
+		}
+	}
+}
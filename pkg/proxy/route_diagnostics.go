@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// =============================================================================
+// 路由诊断 - Host 没有匹配的路由时，说明可能的原因并按路由表给出可用域名与 docker pull 示例
+// =============================================================================
+
+// exampleImages 常见仓库的示例镜像，其他仓库使用通用占位
+var exampleImages = map[string]string{
+	"docker.io":           "library/nginx:latest",
+	"ghcr.io":             "OWNER/IMAGE:TAG",
+	"quay.io":             "prometheus/prometheus:latest",
+	"gcr.io":              "distroless/static:latest",
+	"registry.k8s.io":     "pause:3.9",
+	"mcr.microsoft.com":   "dotnet/runtime:8.0",
+	"registry.gitlab.com": "GROUP/PROJECT/IMAGE:TAG",
+	"nvcr.io":             "nvidia/cuda:12.4.1-base-ubuntu22.04",
+	"registry.ollama.ai":  "library/llama3:latest",
+	"docker.elastic.co":   "elasticsearch/elasticsearch:8.15.0",
+}
+
+// routeExample 一个可用的代理域名及拉取示例
+type routeExample struct {
+	Registry string `json:"registry"` // 上游仓库，如 docker.io
+	Host     string `json:"host"`     // 代理域名（含非默认端口）
+	Pull     string `json:"pull"`     // docker pull 示例
+}
+
+// routeDiagnostics 未匹配路由时返回的内容
+type routeDiagnostics struct {
+	Message  string            `json:"message"`
+	Error    string            `json:"error"`
+	Host     string            `json:"host"`
+	Hints    []string          `json:"hints"`
+	Examples []routeExample    `json:"examples"`
+	Routes   map[string]string `json:"routes"`
+	Setup    []string          `json:"setup"` // 客户端配置生成接口
+}
+
+// diagnoseRoute 根据请求的 Host 推断路由失败的原因
+func (p *ProxyServer) diagnoseRoute(r *http.Request) *routeDiagnostics {
+	host := r.Host
+	name := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		name = h
+	}
+
+	d := &routeDiagnostics{
+		Message: "Available registry routes",
+		Error:   fmt.Sprintf("no registry route for host %q", host),
+		Host:    host,
+		Routes:  p.current().routes,
+		Setup:   []string{"/setup/docker", "/setup/containerd"},
+	}
+
+	switch {
+	case name == "":
+		d.Hints = append(d.Hints, "the request has no Host header; the proxy selects the upstream registry by hostname")
+	case name == "localhost" || net.ParseIP(name) != nil:
+		d.Hints = append(d.Hints, "the proxy selects the upstream registry by hostname, so it cannot be reached by IP address or localhost; "+
+			"point one of the hostnames below at this server (DNS or /etc/hosts) and pull through it")
+	case p.config.CustomDomain != "" && strings.HasSuffix(name, "."+p.config.CustomDomain):
+		d.Hints = append(d.Hints, fmt.Sprintf("%q is not a configured route of %s; use one of the hostnames below", name, p.config.CustomDomain))
+	default:
+		d.Hints = append(d.Hints, fmt.Sprintf("%q is not routed by this proxy (CUSTOM_DOMAIN is %q)", name, p.config.CustomDomain),
+			"if the proxy runs behind a reverse proxy or load balancer, make sure it forwards the original Host header")
+	}
+	d.Hints = append(d.Hints, "for Docker Hub, configure the mirror in daemon.json (GET /setup/docker) instead of prefixing image names")
+
+	for _, ns := range p.mirrorNamespaces(r) {
+		if len(ns.Mirrors) == 0 {
+			continue
+		}
+		mirror := ns.Mirrors[0]
+		if _, rest, ok := strings.Cut(mirror, "://"); ok {
+			mirror = rest
+		}
+		image := exampleImages[ns.Namespace]
+		if image == "" {
+			image = "NAMESPACE/IMAGE:TAG"
+		}
+		d.Examples = append(d.Examples, routeExample{
+			Registry: ns.Namespace,
+			Host:     mirror,
+			Pull:     "docker pull " + mirror + "/" + image,
+		})
+	}
+	return d
+}
+
+// routeDiagnosticsPage 浏览器访问时显示的诊断页面
+var routeDiagnosticsPage = template.Must(template.New("routes").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>go-docker-proxy: unknown host</title>
+<style>body{font-family:sans-serif;max-width:60em;margin:2em auto;padding:0 1em}code,pre{background:#f4f4f4;padding:.1em .3em}td,th{padding:.2em 1em .2em 0;text-align:left}</style>
+</head>
+<body>
+<h1>No registry route for {{if .Host}}<code>{{.Host}}</code>{{else}}this request{{end}}</h1>
+<ul>{{range .Hints}}<li>{{.}}</li>{{end}}</ul>
+<h2>Available registries</h2>
+<table>
+<tr><th>Registry</th><th>Proxy host</th><th>Example</th></tr>
+{{range .Examples}}<tr><td>{{.Registry}}</td><td><code>{{.Host}}</code></td><td><code>{{.Pull}}</code></td></tr>
+{{end}}</table>
+<p>Client configuration: {{range $i, $path := .Setup}}{{if $i}}, {{end}}<a href="{{$path}}">{{$path}}</a>{{end}}</p>
+</body>
+</html>
+`))
+
+// writeRoutesResponse 返回 404 与路由诊断：浏览器显示 HTML 页面，其他客户端返回 JSON（保留原有的 routes 与 message 字段）
+func (p *ProxyServer) writeRoutesResponse(w http.ResponseWriter, r *http.Request) {
+	d := p.diagnoseRoute(r)
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusNotFound)
+		_ = routeDiagnosticsPage.Execute(w, d)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusNotFound)
+	json.NewEncoder(w).Encode(d)
+}
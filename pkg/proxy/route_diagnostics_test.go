@@ -0,0 +1,49 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestUnknownHostDiagnostics(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	_, client := newTestProxy(t, upstream, nil)
+
+	get := func(host, accept string) (*http.Response, []byte) {
+		req, _ := http.NewRequest("GET", client.base+"/v2/", nil)
+		req.Host = host
+		req.Header.Set("Accept", accept)
+		resp, err := client.http.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, body
+	}
+
+	resp, body := get("typo.example.test", "application/json")
+	var d routeDiagnostics
+	if err := json.Unmarshal(body, &d); err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("status %d: %s", resp.StatusCode, body)
+	}
+	if d.Routes[testRegistryHost] == "" || d.Message != "Available registry routes" {
+		t.Errorf("route table missing from %s", body)
+	}
+	if len(d.Hints) == 0 || !strings.Contains(d.Hints[0], "not a configured route of example.test") {
+		t.Errorf("hints = %q", d.Hints)
+	}
+	if len(d.Examples) != 1 || d.Examples[0].Pull != "docker pull "+testRegistryHost+"/NAMESPACE/IMAGE:TAG" {
+		t.Errorf("examples = %+v", d.Examples)
+	}
+
+	// 浏览器访问 IP 地址时显示 HTML 页面
+	resp, body = get("10.0.0.1", "text/html,application/xhtml+xml")
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") ||
+		!strings.Contains(string(body), "cannot be reached by IP address") || !strings.Contains(string(body), "docker pull "+testRegistryHost) {
+		t.Errorf("HTML page: %s", body)
+	}
+}
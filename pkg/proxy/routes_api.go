@@ -0,0 +1,218 @@
+package proxy
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// =============================================================================
+// 路由列表接口 - GET /api/routes 返回每个路由的上游、说明、健康状态、请求数与缓存命中率，
+// 供仪表盘展示；内置路由带默认说明，可通过 ROUTE_DESCRIPTIONS 覆盖或补充
+// =============================================================================
+
+// builtinRouteDescriptions 内置上游的默认说明（按上游 host）
+var builtinRouteDescriptions = map[string]string{
+	"registry-1.docker.io": "Docker Hub",
+	"quay.io":              "Red Hat Quay.io",
+	"gcr.io":               "Google Container Registry",
+	"k8s.gcr.io":           "Kubernetes GCR (legacy)",
+	"registry.k8s.io":      "Kubernetes Registry",
+	"ghcr.io":              "GitHub Container Registry",
+	"docker.cloudsmith.io": "Cloudsmith Docker",
+	"public.ecr.aws":       "AWS ECR Public",
+	"registry.gitlab.com":  "GitLab Container Registry",
+	"nvcr.io":              "NVIDIA NGC",
+	"registry.ollama.ai":   "Ollama model registry",
+	"docker.elastic.co":    "Elastic",
+}
+
+// parseRouteDescriptions 解析 ROUTE_DESCRIPTIONS（路由名=说明，逗号分隔），返回 路由域名 -> 说明
+func parseRouteDescriptions(entries []string, customDomain string) map[string]string {
+	descriptions := make(map[string]string)
+	for _, entry := range entries {
+		name, description, ok := strings.Cut(entry, "=")
+		name, description = strings.ToLower(strings.TrimSpace(name)), strings.TrimSpace(description)
+		if !ok || name == "" || description == "" {
+			log.Printf("Ignoring invalid ROUTE_DESCRIPTIONS entry %q (expected name=description)", entry)
+			continue
+		}
+		descriptions[name+"."+customDomain] = description
+	}
+	return descriptions
+}
+
+// routeCounter 单个路由的请求计数
+type routeCounter struct {
+	Requests int64
+	Hits     int64
+	Misses   int64
+	Errors   int64
+
+	SplitServed    int64 // 由蓝绿切换的新上游响应的请求
+	SplitFallbacks int64 // 分流到新上游但回退主上游的请求
+}
+
+// routeStats 按路由域名统计请求与缓存命中
+type routeStats struct {
+	mu       sync.Mutex
+	counters map[string]*routeCounter
+}
+
+func newRouteStats() *routeStats {
+	return &routeStats{counters: make(map[string]*routeCounter)}
+}
+
+// get 返回路由的计数快照
+func (s *routeStats) get(host string) routeCounter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.counters[host]; ok {
+		return *c
+	}
+	return routeCounter{}
+}
+
+// addSplit 记录一次分流到新上游的请求，served 为 false 表示回退到了主上游
+func (s *routeStats) addSplit(host string, served bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.counters[host]
+	if !ok {
+		c = &routeCounter{}
+		s.counters[host] = c
+	}
+	if served {
+		c.SplitServed++
+	} else {
+		c.SplitFallbacks++
+	}
+}
+
+// routeStatsMiddleware 统计已配置路由（镜像仓库、Helm、文件镜像）的请求数、缓存命中（X-Cache: HIT）、
+// 未命中（MISS）与 5xx 错误；单域名模式下按解析出的路由统计
+func (p *ProxyServer) routeStatsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := strings.ToLower(r.Host)
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		live := p.current()
+		// 镜像仓库路由只统计 /v2/ 请求，不含同一域名上的 /health、/api/routes 等
+		_, isRoute := live.routes[host]
+		isRoute = isRoute && strings.HasPrefix(r.URL.Path, "/v2/")
+		_, isHelm := live.helmRoutes[host]
+		_, isMirror := live.fileMirrors[host]
+		if !isRoute && !isHelm && !isMirror {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		p.routeStats.mu.Lock()
+		defer p.routeStats.mu.Unlock()
+		c, ok := p.routeStats.counters[host]
+		if !ok {
+			c = &routeCounter{}
+			p.routeStats.counters[host] = c
+		}
+		c.Requests++
+		switch ww.Header().Get("X-Cache") {
+		case "HIT":
+			c.Hits++
+		case "MISS":
+			c.Misses++
+		}
+		if ww.Status() >= http.StatusInternalServerError {
+			c.Errors++
+		}
+	})
+}
+
+// routeInfo /api/routes 中的单个路由
+type routeInfo struct {
+	Host        string  `json:"host"`
+	Label       string  `json:"label"` // 路由名，即域名去掉 CUSTOM_DOMAIN 的部分
+	Kind        string  `json:"kind"`  // registry、helm 或 files
+	Upstream    string  `json:"upstream"`
+	Description string  `json:"description,omitempty"`
+	Status      string  `json:"status"` // healthy、unhealthy，未启用健康检查时为 unknown
+	Requests    int64   `json:"requests"`
+	CacheHits   int64   `json:"cacheHits"`
+	CacheMisses int64   `json:"cacheMisses"`
+	Errors      int64   `json:"errors"`
+	HitRatio    float64 `json:"hitRatio"` // HIT / (HIT + MISS)，无缓存请求时为 0
+
+	// 蓝绿切换状态，只有配置了 UPSTREAM_SPLITS 的路由才有
+	Split *splitInfo `json:"split,omitempty"`
+}
+
+// splitInfo 路由的蓝绿切换状态：新上游、权重与分流结果
+type splitInfo struct {
+	Upstream  string `json:"upstream"`
+	Weight    int    `json:"weight"`
+	Served    int64  `json:"served"`    // 由新上游响应
+	Fallbacks int64  `json:"fallbacks"` // 新上游不可用或内容不一致，回退主上游
+}
+
+// handleRoutesAPI 返回所有路由的说明、健康状态与请求统计（按域名排序）
+func (p *ProxyServer) handleRoutesAPI(w http.ResponseWriter, r *http.Request) {
+	live := p.current()
+	routes := make([]routeInfo, 0, len(live.routes)+len(live.helmRoutes)+len(live.fileMirrors))
+	for host, upstream := range live.routes {
+		routes = append(routes, p.describeRoute(host, "registry", upstream))
+	}
+	for host, repo := range live.helmRoutes {
+		routes = append(routes, p.describeRoute(host, "helm", repo))
+	}
+	for host, route := range live.fileMirrors {
+		routes = append(routes, p.describeRoute(host, "files", route.Upstream))
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Host < routes[j].Host })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"routes": routes})
+}
+
+// describeRoute 汇总单个路由的信息，上游地址中的凭据不会输出
+func (p *ProxyServer) describeRoute(host, kind, upstream string) routeInfo {
+	info := routeInfo{
+		Host:     host,
+		Label:    strings.TrimSuffix(host, "."+p.config.CustomDomain),
+		Kind:     kind,
+		Upstream: upstream,
+		Status:   "unknown",
+	}
+	if u, err := url.Parse(upstream); err == nil && u.Host != "" {
+		info.Upstream = u.Redacted()
+		info.Description = builtinRouteDescriptions[u.Host]
+		if kind == "registry" && p.upstreamHealth != nil {
+			info.Status = "unhealthy"
+			if p.upstreamHealth.Healthy(u.Host) {
+				info.Status = "healthy"
+			}
+		}
+	}
+	if description, ok := p.current().descriptions[host]; ok {
+		info.Description = description
+	}
+
+	c := p.routeStats.get(host)
+	info.Requests, info.CacheHits, info.CacheMisses, info.Errors = c.Requests, c.Hits, c.Misses, c.Errors
+	if c.Hits+c.Misses > 0 {
+		info.HitRatio = float64(c.Hits) / float64(c.Hits+c.Misses)
+	}
+	if split, ok := p.current().splits[host]; ok && kind == "registry" {
+		info.Split = &splitInfo{Upstream: split.Upstream, Weight: split.Weight, Served: c.SplitServed, Fallbacks: c.SplitFallbacks}
+	}
+	return info
+}
@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestRoutesAPI(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	_, layers := upstream.addImage("library/alpine", "3.20", []byte("alpine layer"))
+	p, client := newTestProxy(t, upstream, nil)
+	p.current().descriptions[testRegistryHost] = "test registry"
+
+	client.login("library/alpine")
+	client.pull("library/alpine", "3.20")
+	waitCached(t, p, "library/alpine", "3.20", layers)
+	client.pull("library/alpine", "3.20")
+
+	resp, body := client.do(http.MethodGet, "/api/routes", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d: %s", resp.StatusCode, body)
+	}
+	var result struct {
+		Routes []routeInfo `json:"routes"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Routes) != 1 {
+		t.Fatalf("routes = %+v", result.Routes)
+	}
+	route := result.Routes[0]
+	if route.Host != testRegistryHost || route.Kind != "registry" || route.Description != "test registry" || route.Status != "unknown" {
+		t.Errorf("route = %+v", route)
+	}
+	if route.CacheHits == 0 || route.CacheMisses == 0 || route.Requests < route.CacheHits+route.CacheMisses {
+		t.Errorf("counts = %+v", route)
+	}
+	if route.HitRatio <= 0 || route.HitRatio >= 1 {
+		t.Errorf("hit ratio = %v", route.HitRatio)
+	}
+
+	if got := parseRouteDescriptions([]string{"docker=Docker Hub (mirror)"}, "example.test"); got["docker.example.test"] != "Docker Hub (mirror)" {
+		t.Errorf("descriptions = %v", got)
+	}
+}
@@ -0,0 +1,468 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+// =============================================================================
+// 漏洞扫描 - manifest 首次写入缓存时调用 Trivy / Grype 扫描，可按严重级别拦截
+// =============================================================================
+
+// 扫描状态
+const (
+	ScanStatusPending = "pending"
+	ScanStatusPassed  = "passed"
+	ScanStatusFailed  = "failed" // 超过拦截阈值
+	ScanStatusError   = "error"
+)
+
+// severityOrder 严重级别从低到高
+var severityOrder = []string{"UNKNOWN", "NEGLIGIBLE", "LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+func severityRank(severity string) int {
+	severity = strings.ToUpper(severity)
+	for i, s := range severityOrder {
+		if s == severity {
+			return i
+		}
+	}
+	return 0
+}
+
+// ScanResult 单个 manifest 的扫描结果
+type ScanResult struct {
+	Digest    string         `json:"digest"`
+	Image     string         `json:"image"`
+	Status    string         `json:"status"`
+	Counts    map[string]int `json:"counts,omitempty"` // 严重级别 -> 漏洞数
+	Error     string         `json:"error,omitempty"`
+	ScannedAt time.Time      `json:"scannedAt,omitempty"`
+}
+
+// Summary 扫描摘要，用于 DENIED 错误信息
+func (r *ScanResult) Summary() string {
+	var parts []string
+	for i := len(severityOrder) - 1; i >= 0; i-- {
+		if n := r.Counts[severityOrder[i]]; n > 0 {
+			parts = append(parts, fmt.Sprintf("%s=%d", severityOrder[i], n))
+		}
+	}
+	if len(parts) == 0 {
+		return "no vulnerabilities"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// scanJob 待扫描的镜像
+type scanJob struct {
+	digest string
+	image  string
+}
+
+// Scanner 异步扫描队列，结果持久化到缓存目录
+type Scanner struct {
+	tool          string // trivy 或 grype
+	binary        string
+	server        string // Trivy server 地址（client/server 模式）
+	blockSeverity string // 达到该级别即拦截，为空只记录不拦截
+	insecure      bool
+	timeout       time.Duration
+	resultsFile   string
+	debug         bool
+
+	queue chan scanJob
+
+	mu      sync.RWMutex
+	results map[string]*ScanResult // digest -> result
+}
+
+// ScanConfig 漏洞扫描配置，Enabled 为 false 时不启用
+type ScanConfig struct {
+	Enabled       bool
+	Tool          string        // trivy 或 grype
+	Binary        string        // 扫描器可执行文件路径（为空时与 Tool 同名）
+	TrivyServer   string        // Trivy server 地址，设置后以 client 模式扫描
+	BlockSeverity string        // 拦截阈值（LOW/MEDIUM/HIGH/CRITICAL），为空只扫描不拦截
+	Concurrency   int           // 并发扫描数
+	Timeout       time.Duration // 单次扫描超时
+	Insecure      bool          // 通过 HTTP 访问代理自身拉取镜像
+}
+
+// loadScanConfig 从环境变量读取扫描配置
+//
+//	SCAN_ENABLED          启用扫描
+//	SCANNER               trivy（默认）或 grype
+//	SCAN_BINARY           扫描器可执行文件路径（默认与 SCANNER 同名）
+//	SCAN_TRIVY_SERVER     Trivy server 地址
+//	SCAN_BLOCK_SEVERITY   拦截阈值
+//	SCAN_CONCURRENCY      并发扫描数（默认 1）
+//	SCAN_TIMEOUT          单次扫描超时（默认 10m）
+//	SCAN_INSECURE         通过 HTTP 访问代理自身拉取镜像
+func loadScanConfig() ScanConfig {
+	concurrency := 1
+	fmt.Sscanf(getEnv("SCAN_CONCURRENCY", "1"), "%d", &concurrency)
+	return ScanConfig{
+		Enabled:       getEnv("SCAN_ENABLED", "false") == "true",
+		Tool:          strings.ToLower(getEnv("SCANNER", "trivy")),
+		Binary:        getEnv("SCAN_BINARY", ""),
+		TrivyServer:   getEnv("SCAN_TRIVY_SERVER", ""),
+		BlockSeverity: strings.ToUpper(getEnv("SCAN_BLOCK_SEVERITY", "")),
+		Concurrency:   concurrency,
+		Timeout:       parseDuration(getEnv("SCAN_TIMEOUT", "10m"), 10*time.Minute),
+		Insecure:      getEnv("SCAN_INSECURE", "false") == "true",
+	}
+}
+
+// NewScanner 创建扫描器，扫描未启用时返回 nil
+func NewScanner(config ScanConfig, cacheDir string, debug bool) (*Scanner, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+
+	tool := config.Tool
+	if tool != "trivy" && tool != "grype" {
+		return nil, fmt.Errorf("unsupported scanner %q (trivy or grype)", tool)
+	}
+
+	binaryName := config.Binary
+	if binaryName == "" {
+		binaryName = tool
+	}
+	binary, err := exec.LookPath(binaryName)
+	if err != nil {
+		return nil, fmt.Errorf("scanner binary not found: %w", err)
+	}
+
+	s := &Scanner{
+		tool:          tool,
+		binary:        binary,
+		server:        config.TrivyServer,
+		blockSeverity: strings.ToUpper(config.BlockSeverity),
+		insecure:      config.Insecure,
+		timeout:       config.Timeout,
+		resultsFile:   filepath.Join(cacheDir, "scan-results.json"),
+		debug:         debug,
+		queue:         make(chan scanJob, 256),
+		results:       make(map[string]*ScanResult),
+	}
+	s.load()
+
+	concurrency := config.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	for i := 0; i < concurrency; i++ {
+		go s.worker()
+	}
+
+	log.Printf("Vulnerability scanning enabled: %s (block severity: %q)", tool, s.blockSeverity)
+	return s, nil
+}
+
+// Submit 提交扫描，已有结果或正在扫描的 digest 会被忽略（扫描出错的会重试）
+func (s *Scanner) Submit(digest, image string) {
+	if s == nil || digest == "" {
+		return
+	}
+
+	s.mu.Lock()
+	if existing, exists := s.results[digest]; exists && existing.Status != ScanStatusError {
+		s.mu.Unlock()
+		return
+	}
+	s.results[digest] = &ScanResult{Digest: digest, Image: image, Status: ScanStatusPending}
+	s.mu.Unlock()
+
+	select {
+	case s.queue <- scanJob{digest: digest, image: image}:
+	default:
+		// 队列已满，移除 pending 状态以便下次缓存写入时重新提交
+		s.mu.Lock()
+		delete(s.results, digest)
+		s.mu.Unlock()
+		log.Printf("Scan queue full, skipping %s", image)
+	}
+}
+
+// Denied 判断 digest 是否因扫描结果被拦截
+func (s *Scanner) Denied(digest string) (*ScanResult, bool) {
+	if s == nil || s.blockSeverity == "" || digest == "" {
+		return nil, false
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result, ok := s.results[digest]
+	if !ok || result.Status != ScanStatusFailed {
+		return nil, false
+	}
+	return result, true
+}
+
+// Results 返回所有扫描结果（按扫描时间倒序）
+func (s *Scanner) Results() []*ScanResult {
+	s.mu.RLock()
+	results := make([]*ScanResult, 0, len(s.results))
+	for _, r := range s.results {
+		copied := *r
+		results = append(results, &copied)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].ScannedAt.After(results[j].ScannedAt)
+	})
+	return results
+}
+
+// Forget 删除扫描结果，下次缓存写入时重新扫描
+func (s *Scanner) Forget(digest string) bool {
+	s.mu.Lock()
+	_, ok := s.results[digest]
+	delete(s.results, digest)
+	s.mu.Unlock()
+	if ok {
+		s.save()
+	}
+	return ok
+}
+
+func (s *Scanner) worker() {
+	for job := range s.queue {
+		result := s.scan(job)
+
+		s.mu.Lock()
+		s.results[job.digest] = result
+		s.mu.Unlock()
+		s.save()
+
+		switch result.Status {
+		case ScanStatusError:
+			log.Printf("Scan of %s failed: %s", job.image, result.Error)
+		case ScanStatusFailed:
+			log.Printf("Scan of %s exceeds %s threshold: %s", job.image, s.blockSeverity, result.Summary())
+		default:
+			if s.debug {
+				log.Printf("[DEBUG] Scan of %s passed: %s", job.image, result.Summary())
+			}
+		}
+	}
+}
+
+// scan 执行扫描器并统计各级别漏洞数
+func (s *Scanner) scan(job scanJob) *ScanResult {
+	result := &ScanResult{Digest: job.digest, Image: job.image, ScannedAt: time.Now()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+
+	var args []string
+	env := configEnviron()
+	if s.tool == "trivy" {
+		args = []string{"image", "--quiet", "--format", "json", "--scanners", "vuln"}
+		if s.server != "" {
+			args = append(args, "--server", s.server)
+		}
+		if s.insecure {
+			args = append(args, "--insecure")
+		}
+		args = append(args, job.image)
+	} else {
+		args = []string{"registry:" + job.image, "-o", "json", "-q"}
+		if s.insecure {
+			env = append(env, "GRYPE_REGISTRY_INSECURE_USE_HTTP=true")
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, s.binary, args...)
+	cmd.Env = env
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		result.Status = ScanStatusError
+		result.Error = fmt.Sprintf("%v: %s", err, strings.TrimSpace(lastLine(stderr.String())))
+		return result
+	}
+
+	counts, err := parseScanOutput(s.tool, stdout.Bytes())
+	if err != nil {
+		result.Status = ScanStatusError
+		result.Error = err.Error()
+		return result
+	}
+	result.Counts = counts
+	result.Status = ScanStatusPassed
+
+	if s.blockSeverity != "" {
+		threshold := severityRank(s.blockSeverity)
+		for severity, n := range counts {
+			if n > 0 && severityRank(severity) >= threshold {
+				result.Status = ScanStatusFailed
+				break
+			}
+		}
+	}
+	return result
+}
+
+// parseScanOutput 解析 Trivy / Grype 的 JSON 报告
+func parseScanOutput(tool string, data []byte) (map[string]int, error) {
+	counts := make(map[string]int)
+
+	if tool == "trivy" {
+		var report struct {
+			Results []struct {
+				Vulnerabilities []struct {
+					Severity string `json:"Severity"`
+				} `json:"Vulnerabilities"`
+			} `json:"Results"`
+		}
+		if err := json.Unmarshal(data, &report); err != nil {
+			return nil, fmt.Errorf("invalid trivy report: %w", err)
+		}
+		for _, r := range report.Results {
+			for _, v := range r.Vulnerabilities {
+				counts[strings.ToUpper(v.Severity)]++
+			}
+		}
+		return counts, nil
+	}
+
+	var report struct {
+		Matches []struct {
+			Vulnerability struct {
+				Severity string `json:"severity"`
+			} `json:"vulnerability"`
+		} `json:"matches"`
+	}
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("invalid grype report: %w", err)
+	}
+	for _, m := range report.Matches {
+		counts[strings.ToUpper(m.Vulnerability.Severity)]++
+	}
+	return counts, nil
+}
+
+func lastLine(s string) string {
+	s = strings.TrimSpace(s)
+	if idx := strings.LastIndex(s, "\n"); idx != -1 {
+		return s[idx+1:]
+	}
+	return s
+}
+
+// load 读取持久化的扫描结果（pending 状态的结果丢弃，重新扫描）
+func (s *Scanner) load() {
+	data, err := os.ReadFile(s.resultsFile)
+	if err != nil {
+		return
+	}
+	var results []*ScanResult
+	if err := json.Unmarshal(data, &results); err != nil {
+		log.Printf("Ignoring invalid scan results file: %v", err)
+		return
+	}
+	for _, r := range results {
+		if r.Status != ScanStatusPending && r.Status != ScanStatusError {
+			s.results[r.Digest] = r
+		}
+	}
+}
+
+// save 原子写入扫描结果
+func (s *Scanner) save() {
+	s.mu.RLock()
+	results := make([]*ScanResult, 0, len(s.results))
+	for _, r := range s.results {
+		if r.Status != ScanStatusPending {
+			results = append(results, r)
+		}
+	}
+	data, err := json.MarshalIndent(results, "", "  ")
+	s.mu.RUnlock()
+	if err != nil {
+		return
+	}
+
+	tmp := s.resultsFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		log.Printf("Failed to save scan results: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, s.resultsFile); err != nil {
+		log.Printf("Failed to save scan results: %v", err)
+	}
+}
+
+// scanCacheFill manifest 写入缓存后提交扫描（manifest list / index 由各平台 manifest 分别扫描）
+func (p *ProxyServer) scanCacheFill(cacheKey string, entry *cache.CacheEntry) {
+	if p.scanner == nil || IsIndexMediaType(entry.Descriptor.MediaType) {
+		return
+	}
+	pathType, repo, _ := cache.ParsePath(cacheKey)
+	idx := strings.Index(cacheKey, "/v2/")
+	if pathType != "manifest" || idx <= 0 {
+		return
+	}
+
+	// 拦截检查按返回内容计算的 digest 查找扫描结果，扫描同样以内容为准
+	digest := entry.Descriptor.Digest
+	if len(entry.Data) > 0 {
+		digest = digestOf(entry.Data)
+	} else if values := entry.Headers["Docker-Content-Digest"]; digest == "" && len(values) > 0 {
+		digest = values[0]
+	}
+	if digest == "" {
+		return
+	}
+
+	// 通过代理自身拉取，复用缓存与上游认证
+	p.scanner.Submit(digest, cacheKey[:idx]+"/"+repo+"@"+digest)
+}
+
+// scanPolicyCheck manifest 策略检查：拒绝扫描未通过的镜像
+func (p *ProxyServer) scanPolicyCheck(r *http.Request, digest string) (string, bool) {
+	result, denied := p.scanner.Denied(digest)
+	if !denied {
+		return "", false
+	}
+	return fmt.Sprintf("image %s blocked by vulnerability policy (>= %s): %s",
+		result.Digest, p.scanner.blockSeverity, result.Summary()), true
+}
+
+// registerScanAdminRoutes 扫描结果查询与重新扫描
+func (p *ProxyServer) registerScanAdminRoutes(r chi.Router) {
+	r.Get("/scans", func(w http.ResponseWriter, r *http.Request) {
+		p.writeJSON(w, http.StatusOK, map[string]interface{}{
+			"scanner":       p.scanner.tool,
+			"blockSeverity": p.scanner.blockSeverity,
+			"results":       p.scanner.Results(),
+		})
+	})
+	r.Delete("/scans/{digest}", func(w http.ResponseWriter, r *http.Request) {
+		if !p.scanner.Forget(chi.URLParam(r, "digest")) {
+			p.writeErrorResponse(w, "scan result not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFakeTrivy 写入模拟 trivy 的脚本：team/vulnerable 的镜像报告一个 CRITICAL 漏洞
+func writeFakeTrivy(t *testing.T) string {
+	t.Helper()
+	script := `#!/bin/sh
+for arg; do image="$arg"; done
+case "$image" in
+*/team/vulnerable@sha256:*) echo '{"Results": [{"Vulnerabilities": [{"Severity": "CRITICAL"}, {"Severity": "low"}]}]}' ;;
+*@sha256:*) echo '{"Results": []}' ;;
+*) echo "unexpected image $image" >&2; exit 1 ;;
+esac
+`
+	path := filepath.Join(t.TempDir(), "trivy")
+	if err := os.WriteFile(path, []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestScannerBlocksVulnerableImages(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	clean, _ := upstream.addImage("team/clean", "v1", []byte("clean layer"))
+	vulnerable, _ := upstream.addImage("team/vulnerable", "v1", []byte("vulnerable layer"))
+	p, client := newTestProxy(t, upstream, map[string]string{
+		"SCAN_ENABLED":        "true",
+		"SCAN_BINARY":         writeFakeTrivy(t),
+		"SCAN_BLOCK_SEVERITY": "HIGH",
+		"ADMIN_TOKEN":         testAdminToken,
+	})
+
+	// 首次拉取触发异步扫描，扫描完成前不拦截
+	accept := http.Header{"Accept": {fakeManifestType}}
+	for _, repo := range []string{"team/clean", "team/vulnerable"} {
+		client.login(repo)
+		if resp, body := client.do("GET", "/v2/"+repo+"/manifests/v1", accept); resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s before scan: status %d: %s", repo, resp.StatusCode, body)
+		}
+	}
+	scanned := func(digest string) bool {
+		for _, r := range p.scanner.Results() {
+			if r.Digest == digest && r.Status != ScanStatusPending {
+				return true
+			}
+		}
+		return false
+	}
+	eventually(t, "scans to finish", func() bool { return scanned(clean) && scanned(vulnerable) })
+
+	if resp, body := client.do("GET", "/v2/team/vulnerable/manifests/v1", accept); resp.StatusCode != http.StatusForbidden ||
+		!strings.Contains(string(body), "vulnerability policy") {
+		t.Errorf("vulnerable image after scan: status %d: %s", resp.StatusCode, body)
+	}
+	client.login("team/clean")
+	if resp, _ := client.do("GET", "/v2/team/clean/manifests/v1", accept); resp.StatusCode != http.StatusOK {
+		t.Errorf("clean image after scan: status %d, want 200", resp.StatusCode)
+	}
+
+	resp, body := client.admin("GET", "/admin/scans", "")
+	var report struct {
+		Results []*ScanResult `json:"results"`
+	}
+	if resp.StatusCode != http.StatusOK || json.Unmarshal(body, &report) != nil || len(report.Results) != 2 {
+		t.Fatalf("GET /admin/scans: status %d: %s", resp.StatusCode, body)
+	}
+	for _, r := range report.Results {
+		if r.Digest == vulnerable && (r.Status != ScanStatusFailed || r.Counts["CRITICAL"] != 1 || r.Counts["LOW"] != 1) {
+			t.Errorf("vulnerable scan result = %+v", r)
+		}
+	}
+
+	// 删除扫描结果后不再拦截
+	if resp, _ := client.admin("DELETE", "/admin/scans/"+vulnerable, ""); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("DELETE scan result: status %d, want 204", resp.StatusCode)
+	}
+	client.login("team/vulnerable")
+	if resp, _ := client.do("GET", "/v2/team/vulnerable/manifests/v1", accept); resp.StatusCode != http.StatusOK {
+		t.Errorf("vulnerable image after forgetting the result: status %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestParseScanOutputGrype(t *testing.T) {
+	report := `{"matches": [{"vulnerability": {"severity": "High"}}, {"vulnerability": {"severity": "High"}}, {"vulnerability": {"severity": "Medium"}}]}`
+	counts, err := parseScanOutput("grype", []byte(report))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts["HIGH"] != 2 || counts["MEDIUM"] != 1 {
+		t.Errorf("counts = %v", counts)
+	}
+	if _, err := parseScanOutput("trivy", []byte("not json")); err == nil {
+		t.Error("parsed an invalid trivy report")
+	}
+}
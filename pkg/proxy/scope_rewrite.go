@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// =============================================================================
+// Scope 重写规则 - 处理各类仓库的 token scope 差异（Harbor 项目前缀、多级组织等）
+// =============================================================================
+
+// ScopeRewriteRule 单条 scope 重写规则
+//
+//	{"upstream": "harbor.example.com", "match": "^repository:([^/]+):(.*)$", "replace": "repository:library/$1:$2"}
+//
+// upstream 为上游 host（"*" 或留空表示所有上游），replace 支持 $1 形式的分组引用
+type ScopeRewriteRule struct {
+	Upstream string `json:"upstream"`
+	Match    string `json:"match"`
+	Replace  string `json:"replace"`
+
+	re *regexp.Regexp
+}
+
+// ScopeRewriter 按顺序匹配规则，每个 scope 只应用第一条匹配的规则
+type ScopeRewriter struct {
+	rules []*ScopeRewriteRule
+}
+
+// LoadScopeRewriter 从 JSON 文件加载规则，path 为空时返回 nil
+func LoadScopeRewriter(path string) (*ScopeRewriter, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scope rewrite rules: %w", err)
+	}
+
+	var rules []*ScopeRewriteRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse scope rewrite rules: %w", err)
+	}
+	return NewScopeRewriter(rules)
+}
+
+// NewScopeRewriter 编译规则
+func NewScopeRewriter(rules []*ScopeRewriteRule) (*ScopeRewriter, error) {
+	for i, rule := range rules {
+		re, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return nil, fmt.Errorf("scope rewrite rule %d: invalid match %q: %w", i, rule.Match, err)
+		}
+		rule.re = re
+	}
+	return &ScopeRewriter{rules: rules}, nil
+}
+
+// Rewrite 重写 scope（多个 scope 以空格分隔时逐个处理）
+func (s *ScopeRewriter) Rewrite(upstream, scope string) string {
+	if s == nil || scope == "" {
+		return scope
+	}
+
+	host := upstream
+	if u, err := url.Parse(upstream); err == nil && u.Host != "" {
+		host = u.Host
+	}
+
+	scopes := strings.Fields(scope)
+	for i, item := range scopes {
+		for _, rule := range s.rules {
+			if rule.Upstream != "" && rule.Upstream != "*" && rule.Upstream != host {
+				continue
+			}
+			if rule.re.MatchString(item) {
+				scopes[i] = rule.re.ReplaceAllString(item, rule.Replace)
+				break
+			}
+		}
+	}
+	return strings.Join(scopes, " ")
+}
@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScopeRewriteRules(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	upstreamHost := strings.TrimPrefix(upstream.server.URL, "http://")
+	rulesFile := filepath.Join(t.TempDir(), "scope-rules.json")
+	os.WriteFile(rulesFile, []byte(`[
+		{"upstream": "other.example.com", "match": "^repository:(.*)$", "replace": "repository:wrong/$1"},
+		{"upstream": "`+upstreamHost+`", "match": "^repository:([^/]+):(.*)$", "replace": "repository:library/$1:$2"}
+	]`), 0o600)
+	_, client := newTestProxy(t, upstream, map[string]string{"SCOPE_REWRITE_RULES": rulesFile})
+
+	// 单级仓库名加上 library/ 前缀，多级仓库名不匹配规则保持不变
+	for _, tt := range []struct{ scope, want string }{
+		{"repository:app:pull", "repository:library/app:pull"},
+		{"repository:team/app:pull", "repository:team/app:pull"},
+	} {
+		resp, body := client.do("GET", "/v2/auth?scope="+tt.scope, nil)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("token for %s: status %d: %s", tt.scope, resp.StatusCode, body)
+		}
+		if scopes := upstream.tokenScopes(); scopes[len(scopes)-1] != tt.want {
+			t.Errorf("upstream scope for %s = %q, want %q", tt.scope, scopes[len(scopes)-1], tt.want)
+		}
+	}
+}
+
+func TestScopeRewriterMultipleScopes(t *testing.T) {
+	rewriter, err := NewScopeRewriter([]*ScopeRewriteRule{
+		{Upstream: "*", Match: "^repository:org/(.*)$", Replace: "repository:org/group/$1"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := rewriter.Rewrite("https://registry.example.com", "repository:org/app:pull repository:base/img:pull")
+	if want := "repository:org/group/app:pull repository:base/img:pull"; got != want {
+		t.Errorf("Rewrite = %q, want %q", got, want)
+	}
+
+	if _, err := NewScopeRewriter([]*ScopeRewriteRule{{Match: "("}}); err == nil {
+		t.Error("accepted an invalid match pattern")
+	}
+}
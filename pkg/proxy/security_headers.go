@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// =============================================================================
+// 安全响应头与代理标识 - X-Content-Type-Options、HTTPS 下的 HSTS，
+// 以及 Server / User-Agent 的隐藏或自定义
+// =============================================================================
+
+// defaultUserAgent 发往上游的默认 User-Agent
+const defaultUserAgent = "go-docker-proxy/1.0"
+
+// SecurityConfig 安全响应头与代理标识配置
+type SecurityConfig struct {
+	NoSniff               bool          // X-Content-Type-Options: nosniff
+	HSTSMaxAge            time.Duration // HTTPS 响应的 Strict-Transport-Security（0 表示不发送）
+	HSTSIncludeSubdomains bool
+	Server                string // 响应的 Server 头：空为透传上游，off 为移除，其他值覆盖
+	UserAgent             string // 发往上游的 User-Agent，空表示不发送
+	UserAgentMode         string // 转发客户端请求时的 User-Agent：forward、proxy 或 append
+}
+
+// loadSecurityConfig 从环境变量读取安全响应头配置
+func loadSecurityConfig() SecurityConfig {
+	userAgent := getEnv("USER_AGENT", defaultUserAgent)
+	if userAgent == "off" {
+		userAgent = ""
+	}
+	return SecurityConfig{
+		NoSniff:               getEnv("SECURITY_HEADERS", "true") == "true",
+		HSTSMaxAge:            parseDuration(getEnv("HSTS_MAX_AGE", "365d"), 365*24*time.Hour),
+		HSTSIncludeSubdomains: getEnv("HSTS_INCLUDE_SUBDOMAINS", "false") == "true",
+		Server:                getEnv("SERVER_HEADER", ""),
+		UserAgent:             userAgent,
+		UserAgentMode:         getEnv("USER_AGENT_MODE", "forward"),
+	}
+}
+
+// setUserAgent 设置发往上游的 User-Agent；配置为 off 时显式置空，net/http 不会补充默认值
+func (p *ProxyServer) setUserAgent(req *http.Request) {
+	req.Header["User-Agent"] = []string{p.config.Security.UserAgent}
+}
+
+// setClientUserAgent 设置转发客户端请求时的 User-Agent。部分仓库按 docker / containerd 版本
+// 决定返回的内容，forward 透传客户端的值（客户端未发送时使用 USER_AGENT），
+// proxy 始终使用 USER_AGENT，append 在客户端的值后追加 USER_AGENT
+func (p *ProxyServer) setClientUserAgent(req *http.Request, clientUA string) {
+	ua := p.config.Security.UserAgent
+	switch {
+	case clientUA == "" || p.config.Security.UserAgentMode == "proxy":
+	case p.config.Security.UserAgentMode == "append" && ua != "":
+		ua = clientUA + " " + ua
+	default:
+		ua = clientUA
+	}
+	req.Header["User-Agent"] = []string{ua}
+}
+
+// securityRules 生成响应头规则，tls 表示请求经 HTTPS 到达
+func (c *SecurityConfig) securityRules(tls bool) *headerRules {
+	rules := &headerRules{add: make(http.Header)}
+	if c.NoSniff {
+		rules.add.Set("X-Content-Type-Options", "nosniff")
+	}
+	if tls && c.HSTSMaxAge > 0 {
+		hsts := fmt.Sprintf("max-age=%d", int64(c.HSTSMaxAge.Seconds()))
+		if c.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		rules.add.Set("Strict-Transport-Security", hsts)
+	}
+	switch c.Server {
+	case "":
+	case "off":
+		rules.strip = []string{"Server"}
+	default:
+		rules.add.Set("Server", c.Server)
+	}
+	return rules
+}
+
+// securityHeaderMiddleware 在所有响应（包括缓存命中与上游透传）写出前设置安全响应头
+func (p *ProxyServer) securityHeaderMiddleware(next http.Handler) http.Handler {
+	plain, secure := p.config.Security.securityRules(false), p.config.Security.securityRules(true)
+	if len(secure.add)+len(secure.strip) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rules := plain
+		if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+			rules = secure
+		}
+		next.ServeHTTP(&headerRuleWriter{ResponseWriter: w, rules: rules}, r)
+	})
+}
@@ -0,0 +1,55 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSecurityResponseHeaders(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	upstream.addImage("team/app", "v1", []byte("layer"))
+	_, client := newTestProxy(t, upstream, map[string]string{"SERVER_HEADER": "mirror"})
+
+	client.login("team/app")
+	resp, _ := client.do("GET", "/v2/team/app/manifests/v1", nil)
+	if got := resp.Header.Get("X-Content-Type-Options"); got != "nosniff" {
+		t.Errorf("X-Content-Type-Options %q, want nosniff", got)
+	}
+	if got := resp.Header.Get("Server"); got != "mirror" {
+		t.Errorf("Server %q, want mirror", got)
+	}
+	if got := resp.Header.Get("Strict-Transport-Security"); got != "" {
+		t.Errorf("plain HTTP response carries Strict-Transport-Security %q", got)
+	}
+
+	resp, _ = client.do("GET", "/v2/team/app/manifests/v1", http.Header{"X-Forwarded-Proto": {"https"}})
+	if got := resp.Header.Get("Strict-Transport-Security"); !strings.HasPrefix(got, "max-age=31536000") {
+		t.Errorf("Strict-Transport-Security %q, want max-age=31536000", got)
+	}
+}
+
+func TestUpstreamUserAgentModes(t *testing.T) {
+	const clientUA = "docker/27.0.1 go/go1.22.4 os/linux arch/amd64"
+	for mode, want := range map[string]string{
+		"forward": clientUA,
+		"proxy":   "mirror/2.0",
+		"append":  clientUA + " mirror/2.0",
+	} {
+		t.Run(mode, func(t *testing.T) {
+			upstream := newFakeRegistry(t)
+			upstream.addImage("team/app", "v1", []byte("layer"))
+			_, client := newTestProxy(t, upstream, map[string]string{
+				"USER_AGENT":      "mirror/2.0",
+				"USER_AGENT_MODE": mode,
+				"CACHE_ENABLED":   "false",
+			})
+
+			client.login("team/app")
+			client.do("GET", "/v2/team/app/manifests/v1", http.Header{"User-Agent": {clientUA}})
+			if got := upstream.header("GET", "/v2/team/app/manifests/v1").Get("User-Agent"); got != want {
+				t.Errorf("upstream User-Agent %q, want %q", got, want)
+			}
+		})
+	}
+}
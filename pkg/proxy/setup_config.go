@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// =============================================================================
+// 客户端配置生成 - /setup/containerd 与 /setup/docker 按路由表输出镜像配置
+// =============================================================================
+
+const (
+	dockerHubUpstream  = "https://registry-1.docker.io"
+	containerdCertsDir = "/etc/containerd/certs.d"
+)
+
+// mirrorNamespace 一个上游仓库及指向它的代理地址
+type mirrorNamespace struct {
+	Namespace string   // containerd 中的仓库名，如 docker.io、ghcr.io
+	Server    string   // 上游地址
+	Mirrors   []string // 代理地址，短域名在前（生产路由优先于 staging 等别名）
+}
+
+// registerSetupRoutes 注册配置生成接口
+//
+//	GET /setup/containerd                  写入 certs.d/*/hosts.toml 的 shell 脚本
+//	GET /setup/containerd?registry=ghcr.io 单个仓库的 hosts.toml
+//	GET /setup/docker                      daemon.json 片段
+func (p *ProxyServer) registerSetupRoutes(r chi.Router) {
+	r.Get("/setup/containerd", p.handleSetupContainerd)
+	r.Get("/setup/docker", p.handleSetupDocker)
+}
+
+// mirrorNamespaces 按上游归并路由表
+func (p *ProxyServer) mirrorNamespaces(r *http.Request) []*mirrorNamespace {
+	scheme, port := p.externalScheme(r)
+
+	byUpstream := make(map[string]*mirrorNamespace)
+	for domain, upstream := range p.current().routes {
+		u, err := url.Parse(upstream)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		ns, ok := byUpstream[upstream]
+		if !ok {
+			ns = &mirrorNamespace{Namespace: u.Host, Server: upstream}
+			if upstream == dockerHubUpstream {
+				ns.Namespace = "docker.io"
+			}
+			byUpstream[upstream] = ns
+		}
+		host := domain
+		if port != "" {
+			host = net.JoinHostPort(domain, port)
+		}
+		ns.Mirrors = append(ns.Mirrors, scheme+"://"+host)
+	}
+
+	result := make([]*mirrorNamespace, 0, len(byUpstream))
+	for _, ns := range byUpstream {
+		sort.Slice(ns.Mirrors, func(i, j int) bool {
+			if len(ns.Mirrors[i]) != len(ns.Mirrors[j]) {
+				return len(ns.Mirrors[i]) < len(ns.Mirrors[j])
+			}
+			return ns.Mirrors[i] < ns.Mirrors[j]
+		})
+		result = append(result, ns)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Namespace < result[j].Namespace })
+	return result
+}
+
+// externalScheme 客户端访问代理使用的协议与端口：优先取反向代理传递的协议，端口沿用请求中的端口
+func (p *ProxyServer) externalScheme(r *http.Request) (scheme, port string) {
+	scheme = "http"
+	if r.TLS != nil || p.config.Listen.TLS() {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+	if _, p, err := net.SplitHostPort(clientHost(r)); err == nil {
+		port = p
+	}
+	return scheme, port
+}
+
+// hostsTOML 渲染 containerd hosts.toml
+func (ns *mirrorNamespace) hostsTOML() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "server = %q\n", ns.Server)
+	for _, mirror := range ns.Mirrors {
+		fmt.Fprintf(&b, "\n[host.%q]\n  capabilities = [\"pull\", \"resolve\"]\n", mirror)
+	}
+	return b.String()
+}
+
+func (p *ProxyServer) handleSetupContainerd(w http.ResponseWriter, r *http.Request) {
+	namespaces := p.mirrorNamespaces(r)
+
+	if registry := r.URL.Query().Get("registry"); registry != "" {
+		for _, ns := range namespaces {
+			if ns.Namespace == registry {
+				w.Header().Set("Content-Type", "application/toml; charset=utf-8")
+				fmt.Fprint(w, ns.hostsTOML())
+				return
+			}
+		}
+		p.writeErrorResponse(w, "no route for registry "+registry, http.StatusNotFound)
+		return
+	}
+
+	dir := r.URL.Query().Get("dir")
+	if dir == "" {
+		dir = containerdCertsDir
+	}
+
+	w.Header().Set("Content-Type", "text/x-shellscript; charset=utf-8")
+	fmt.Fprintf(w, "#!/bin/sh\n")
+	fmt.Fprintf(w, "# containerd registry mirrors generated by go-docker-proxy\n")
+	fmt.Fprintf(w, "# requires config_path = %q in the CRI registry section of /etc/containerd/config.toml\n", dir)
+	fmt.Fprintf(w, "set -e\n")
+	for _, ns := range namespaces {
+		path := dir + "/" + ns.Namespace
+		fmt.Fprintf(w, "\nmkdir -p '%s'\ncat > '%s/hosts.toml' <<'EOF'\n%sEOF\n", path, path, ns.hostsTOML())
+	}
+}
+
+func (p *ProxyServer) handleSetupDocker(w http.ResponseWriter, r *http.Request) {
+	// Docker 的 registry-mirrors 只对 Docker Hub 生效
+	var mirrors, insecure []string
+	for _, ns := range p.mirrorNamespaces(r) {
+		if ns.Namespace != "docker.io" {
+			continue
+		}
+		for _, mirror := range ns.Mirrors {
+			mirrors = append(mirrors, mirror)
+			if host, ok := strings.CutPrefix(mirror, "http://"); ok {
+				insecure = append(insecure, host)
+			}
+		}
+	}
+	if len(mirrors) == 0 {
+		p.writeErrorResponse(w, "no Docker Hub route configured", http.StatusNotFound)
+		return
+	}
+
+	config := map[string]interface{}{"registry-mirrors": mirrors}
+	if len(insecure) > 0 {
+		config["insecure-registries"] = insecure
+	}
+	p.writeJSON(w, http.StatusOK, config)
+}
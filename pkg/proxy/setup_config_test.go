@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSetupConfig(t *testing.T) {
+	t.Setenv("CACHE_DIR", t.TempDir())
+	config := loadTestConfig(t)
+	config.Routes = map[string]string{
+		"docker.example.test":         dockerHubUpstream,
+		"docker-staging.example.test": dockerHubUpstream,
+		"ghcr.example.test":           "https://ghcr.io",
+	}
+	server := httptest.NewServer(newConfiguredProxy(t, config).Handler())
+	t.Cleanup(server.Close)
+
+	get := func(path string, header http.Header) (*http.Response, string) {
+		t.Helper()
+		req, _ := http.NewRequest("GET", server.URL+path, nil)
+		req.Host = "docker.example.test:5000"
+		for key, values := range header {
+			req.Header[key] = values
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	resp, body := get("/setup/containerd?registry=docker.io", nil)
+	want := `server = "https://registry-1.docker.io"
+
+[host."http://docker.example.test:5000"]
+  capabilities = ["pull", "resolve"]
+
+[host."http://docker-staging.example.test:5000"]
+  capabilities = ["pull", "resolve"]
+`
+	if resp.StatusCode != http.StatusOK || body != want {
+		t.Errorf("hosts.toml for docker.io: status %d:\n%s", resp.StatusCode, body)
+	}
+	if resp, _ := get("/setup/containerd?registry=quay.io", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unrouted registry: status %d, want 404", resp.StatusCode)
+	}
+
+	// 脚本为每个上游写入一个 hosts.toml，协议取自反向代理
+	_, script := get("/setup/containerd?dir=/tmp/certs.d", http.Header{"X-Forwarded-Proto": {"https"}})
+	for _, line := range []string{
+		"mkdir -p '/tmp/certs.d/docker.io'",
+		"mkdir -p '/tmp/certs.d/ghcr.io'",
+		`[host."https://ghcr.example.test:5000"]`,
+	} {
+		if !strings.Contains(script, line) {
+			t.Errorf("setup script is missing %q:\n%s", line, script)
+		}
+	}
+
+	resp, body = get("/setup/docker", nil)
+	var daemon struct {
+		Mirrors  []string `json:"registry-mirrors"`
+		Insecure []string `json:"insecure-registries"`
+	}
+	if err := json.Unmarshal([]byte(body), &daemon); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("daemon.json: status %d: %s", resp.StatusCode, body)
+	}
+	if len(daemon.Mirrors) != 2 || daemon.Mirrors[0] != "http://docker.example.test:5000" || len(daemon.Insecure) != 2 {
+		t.Errorf("daemon.json = %s", body)
+	}
+}
+
+func TestSetupDockerWithoutDockerHubRoute(t *testing.T) {
+	_, client := newTestProxy(t, newFakeRegistry(t), nil)
+	if resp, _ := client.do("GET", "/setup/docker", nil); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("/setup/docker without a Docker Hub route: status %d, want 404", resp.StatusCode)
+	}
+}
@@ -0,0 +1,161 @@
+package proxy
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// =============================================================================
+// 单域名模式 - 在一个域名上充当 Docker Hub 镜像，其他仓库以命名空间前缀访问
+// =============================================================================
+
+// originalHostKey 单域名模式改写前客户端请求的 Host
+type originalHostKey struct{}
+
+// SingleDomain 将 {域名}/v2/[{仓库域名}/]{name}/... 映射到对应的路由域名
+type SingleDomain struct {
+	hosts      map[string]bool   // 单域名模式的域名
+	registries map[string]string // 仓库域名或路由域名 -> 路由域名
+	dockerHub  string            // 未带命名空间前缀时使用的 Docker Hub 路由域名
+}
+
+// NewSingleDomain 根据 SINGLE_DOMAIN 创建，未配置或没有 Docker Hub 路由时返回 nil
+func NewSingleDomain(config *Config) *SingleDomain {
+	if len(config.SingleDomainHosts) == 0 {
+		return nil
+	}
+
+	s := &SingleDomain{hosts: make(map[string]bool), registries: make(map[string]string)}
+	for _, host := range config.SingleDomainHosts {
+		s.hosts[host] = true
+	}
+	// 同一上游有多个路由时使用最短的域名（生产路由优先于 staging 等别名）
+	prefer := func(key, domain string) {
+		if current, ok := s.registries[key]; !ok || len(domain) < len(current) || (len(domain) == len(current) && domain < current) {
+			s.registries[key] = domain
+		}
+	}
+	for domain, upstream := range config.Routes {
+		if s.hosts[domain] {
+			continue
+		}
+		s.registries[domain] = domain
+		u, err := url.Parse(upstream)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		prefer(u.Host, domain)
+		if upstream == dockerHubUpstream {
+			prefer("docker.io", domain)
+			prefer("index.docker.io", domain)
+		}
+	}
+
+	if s.dockerHub = s.registries["docker.io"]; s.dockerHub == "" {
+		log.Printf("SINGLE_DOMAIN ignored: no Docker Hub route configured")
+		return nil
+	}
+	log.Printf("Single-domain mode: %s (Docker Hub via %s)", strings.Join(config.SingleDomainHosts, ", "), s.dockerHub)
+	return s
+}
+
+// resolve 拆分 {仓库域名}/{name} 形式的仓库名，返回路由域名与去掉前缀的仓库名
+func (s *SingleDomain) resolve(name string) (routeHost, repo string, ok bool) {
+	if first, rest, found := strings.Cut(name, "/"); found && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		routeHost, ok = s.registries[first]
+		name = rest
+	} else {
+		routeHost, ok = s.dockerHub, true
+	}
+	// Docker Hub 官方镜像补 library/
+	if routeHost == s.dockerHub && !strings.Contains(name, "/") {
+		name = "library/" + name
+	}
+	return routeHost, name, ok
+}
+
+// singleDomainMiddleware 将单域名模式的请求改写为对应路由域名的请求，后续处理与子域名访问一致
+func (p *ProxyServer) singleDomainMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		sd := p.current().singleDomain
+		if sd == nil || !sd.hosts[host] || !strings.HasPrefix(r.URL.Path, "/v2/") && r.URL.Path != "/v2" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		routeHost := sd.dockerHub
+		r2 := r.Clone(context.WithValue(r.Context(), originalHostKey{}, r.Host))
+
+		switch rest := strings.TrimPrefix(r.URL.Path, "/v2/"); {
+		case rest == "auth":
+			// token 请求：去掉 scope 中的命名空间前缀，按第一个 scope 选择路由
+			query := r.URL.Query()
+			scopes := query["scope"]
+			for i, scope := range scopes {
+				parts := strings.Split(scope, ":")
+				if len(parts) != 3 || parts[0] != "repository" {
+					continue
+				}
+				target, repo, ok := sd.resolve(parts[1])
+				if !ok {
+					continue
+				}
+				if i == 0 {
+					routeHost = target
+				}
+				parts[1] = repo
+				scopes[i] = strings.Join(parts, ":")
+			}
+			r2.URL.RawQuery = query.Encode()
+
+		case rest != "" && rest != "_catalog":
+			name, suffix, found := splitRepositoryPath(rest)
+			if !found {
+				break
+			}
+			target, repo, ok := sd.resolve(name)
+			if !ok {
+				p.writeRegistryError(w, http.StatusNotFound, "NAME_UNKNOWN", "no route for registry "+strings.SplitN(name, "/", 2)[0])
+				return
+			}
+			routeHost = target
+			r2.URL.Path = "/v2/" + repo + "/" + suffix
+			r2.URL.RawPath = ""
+		}
+
+		if p.config.Debug {
+			log.Printf("[DEBUG] Single-domain: %s%s -> %s%s", r.Host, r.URL.Path, routeHost, r2.URL.Path)
+		}
+		r2.Host = routeHost
+		r2.RequestURI = r2.URL.RequestURI()
+		next.ServeHTTP(w, r2)
+	})
+}
+
+// splitRepositoryPath 将 {name}/manifests/... 等路径拆分为仓库名与其后的部分
+func splitRepositoryPath(path string) (name, suffix string, ok bool) {
+	parts := strings.Split(path, "/")
+	for i := 1; i < len(parts); i++ {
+		switch parts[i] {
+		case "manifests", "blobs", "tags", "referrers":
+			return strings.Join(parts[:i], "/"), strings.Join(parts[i:], "/"), true
+		}
+	}
+	return "", "", false
+}
+
+// clientHost 客户端实际访问的 Host（单域名模式下为改写前的域名）
+func clientHost(r *http.Request) string {
+	if host, ok := r.Context().Value(originalHostKey{}).(string); ok {
+		return host
+	}
+	return r.Host
+}
@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestSingleDomainNamespaces(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	_, layers := upstream.addImage("team/app", "v1", []byte("layer"))
+	t.Setenv("CACHE_DIR", t.TempDir())
+	t.Setenv("CUSTOM_DOMAIN", "example.test")
+	t.Setenv("SINGLE_DOMAIN", testRegistryHost)
+	config := loadTestConfig(t)
+	config.Routes = map[string]string{
+		"docker.example.test": dockerHubUpstream,
+		"ghcr.example.test":   upstream.server.URL,
+	}
+	server := httptest.NewServer(newConfiguredProxy(t, config).Handler())
+	t.Cleanup(server.Close)
+	client := &testClient{t: t, base: server.URL, http: &http.Client{Timeout: 10 * time.Second}}
+
+	// token 请求按 scope 的命名空间选择路由，上游看到的是去掉前缀的仓库名
+	query := url.Values{"service": {"go-docker-proxy"}, "scope": {"repository:ghcr.example.test/team/app:pull"}}
+	resp, body := client.do("GET", "/v2/auth?"+query.Encode(), nil)
+	var token struct {
+		Token string `json:"token"`
+	}
+	if resp.StatusCode != http.StatusOK || json.Unmarshal(body, &token) != nil || token.Token == "" {
+		t.Fatalf("token request: status %d: %s", resp.StatusCode, body)
+	}
+	if scopes := upstream.tokenScopes(); !slices.Contains(scopes, "repository:team/app:pull") {
+		t.Errorf("upstream token scopes = %v", scopes)
+	}
+	client.token = token.Token
+
+	// 路由域名与上游域名都可以作为命名空间前缀
+	for _, prefix := range []string{"ghcr.example.test", upstream.server.Listener.Addr().String()} {
+		client.pull(prefix+"/team/app", "v1")
+	}
+	if n := upstream.count("GET", "/v2/team/app/blobs/"+layers[0]); n == 0 {
+		t.Error("layer was not fetched from the prefixed registry")
+	}
+
+	resp, body = client.do("GET", "/v2/quay.io/team/app/manifests/v1", nil)
+	if resp.StatusCode != http.StatusNotFound || !json.Valid(body) {
+		t.Errorf("unrouted namespace: status %d: %s", resp.StatusCode, body)
+	}
+}
+
+func TestSingleDomainResolve(t *testing.T) {
+	sd := NewSingleDomain(&Config{
+		SingleDomainHosts: []string{"mirror.example.test"},
+		Routes: map[string]string{
+			"mirror.example.test":         dockerHubUpstream,
+			"docker.example.test":         dockerHubUpstream,
+			"docker-staging.example.test": dockerHubUpstream,
+			"ghcr.example.test":           "https://ghcr.io",
+		},
+	})
+	if sd == nil {
+		t.Fatal("NewSingleDomain returned nil")
+	}
+	for name, want := range map[string][2]string{
+		"nginx":                      {"docker.example.test", "library/nginx"},
+		"bitnami/redis":              {"docker.example.test", "bitnami/redis"},
+		"docker.io/nginx":            {"docker.example.test", "library/nginx"},
+		"ghcr.io/org/tool":           {"ghcr.example.test", "org/tool"},
+		"ghcr.example.test/org/tool": {"ghcr.example.test", "org/tool"},
+	} {
+		if host, repo, ok := sd.resolve(name); !ok || host != want[0] || repo != want[1] {
+			t.Errorf("resolve(%q) = %q, %q, %v; want %q, %q", name, host, repo, ok, want[0], want[1])
+		}
+	}
+	if _, _, ok := sd.resolve("quay.io/org/tool"); ok {
+		t.Error("resolved an unrouted registry")
+	}
+
+	if NewSingleDomain(&Config{SingleDomainHosts: []string{"mirror.example.test"}, Routes: map[string]string{"ghcr.example.test": "https://ghcr.io"}}) != nil {
+		t.Error("single-domain mode enabled without a Docker Hub route")
+	}
+}
@@ -0,0 +1,161 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+// =============================================================================
+// 大小限制 - 单个 blob 与整个镜像（manifest 中各层之和）的大小上限
+// =============================================================================
+
+// blobSizeCheck 拒绝超过 MAX_BLOB_SIZE 的 blob；Range 请求按 blob 的总大小检查，不能分段拉取超限的 blob。
+// 大小未知（分块传输）的响应由 policyGuardWriter 在写出时计数，超过上限后中断
+func (p *ProxyServer) blobSizeCheck(r *http.Request, header http.Header) *policyViolation {
+	size, ok := p.blobTotalSize(r, header)
+	if !ok || size <= p.config.MaxBlobSize {
+		return nil
+	}
+	return blobTooLarge(size, p.config.MaxBlobSize)
+}
+
+func blobTooLarge(size, limit int64) *policyViolation {
+	return &policyViolation{
+		status:  http.StatusRequestEntityTooLarge,
+		code:    "DENIED",
+		message: fmt.Sprintf("blob size %s exceeds limit %s", cache.FormatBytes(size), cache.FormatBytes(limit)),
+	}
+}
+
+// blobTotalSize blob 的总大小：完整响应取 Content-Length，206 响应取 Content-Range 中的总长度，
+// 重定向取目标地址的大小，总长度未知（*）时查找缓存元数据
+func (p *ProxyServer) blobTotalSize(r *http.Request, header http.Header) (int64, bool) {
+	if location := header.Get("Location"); location != "" {
+		return p.redirectTargetSize(r, location)
+	}
+	if size, ok := contentTotalSize(header); ok {
+		return size, true
+	}
+	if p.cacheManager != nil {
+		if desc, err := p.cacheManager.BlobStore().Stat(r.Context(), cache.GetDigestFromPath(r.URL.Path)); err == nil {
+			return desc.Size, true
+		}
+	}
+	return 0, false
+}
+
+// contentTotalSize 响应对应的完整内容大小：有 Content-Range 时取其中的总长度，否则取 Content-Length
+func contentTotalSize(header http.Header) (int64, bool) {
+	contentRange := header.Get("Content-Range")
+	if contentRange == "" {
+		size, err := strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+		return size, err == nil
+	}
+	if idx := strings.LastIndex(contentRange, "/"); idx != -1 {
+		if size, err := strconv.ParseInt(contentRange[idx+1:], 10, 64); err == nil {
+			return size, true
+		}
+	}
+	return 0, false
+}
+
+// redirectTargetSize 交给客户端的重定向目标（blob 存储）的大小：先发送 HEAD，
+// 存储拒绝 HEAD 时（预签名地址通常只签了 GET）改用 Range: bytes=0-0 的 GET 读取 Content-Range
+func (p *ProxyServer) redirectTargetSize(r *http.Request, location string) (int64, bool) {
+	target, err := url.Parse(location)
+	if err != nil || !target.IsAbs() {
+		return 0, false
+	}
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequestWithContext(r.Context(), method, target.String(), nil)
+		if err != nil {
+			return 0, false
+		}
+		p.setUserAgent(req)
+		if method == http.MethodGet {
+			req.Header.Set("Range", "bytes=0-0")
+		}
+		resp, err := p.transport.RoundTrip(req)
+		if err != nil {
+			return 0, false
+		}
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 1))
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusPartialContent {
+			if size, ok := contentTotalSize(resp.Header); ok {
+				return size, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// imageSizeCheck 拒绝总大小（config + layers）超过 MAX_IMAGE_SIZE 的镜像
+// manifest list / image index 本身不检查，由客户端随后拉取的平台 manifest 检查
+func (p *ProxyServer) imageSizeCheck(r *http.Request, header http.Header, body []byte) *policyViolation {
+	manifest, err := ParseManifest(body, header.Get("Content-Type"))
+	if err != nil || manifest.IsIndex() {
+		return nil
+	}
+
+	var total int64
+	if manifest.Config != nil {
+		total = manifest.Config.Size
+	}
+	for _, layer := range manifest.Layers {
+		total += layer.Size
+	}
+	if total <= p.config.MaxImageSize {
+		return nil
+	}
+	return &policyViolation{
+		status: http.StatusRequestEntityTooLarge,
+		code:   "DENIED",
+		message: fmt.Sprintf("image size %s exceeds limit %s",
+			cache.FormatBytes(total), cache.FormatBytes(p.config.MaxImageSize)),
+	}
+}
+
+// parseSize 解析大小配置，支持 B/KB/MB/GB/TB 后缀（1024 进制），无后缀按字节
+func parseSize(s string, defaultValue int64) int64 {
+	if strings.TrimSpace(s) == "" {
+		return defaultValue
+	}
+	size, err := parseSizeValue(s)
+	if err != nil {
+		return defaultValue
+	}
+	return size
+}
+
+// parseSizeValue 严格解析大小字符串（格式同 parseSize），供配置校验报告错误
+func parseSizeValue(s string) (int64, error) {
+	original := s
+	s = strings.ToUpper(strings.TrimSpace(s))
+
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		value  int64
+	}{
+		{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1},
+	} {
+		if strings.HasSuffix(s, unit.suffix) {
+			multiplier = unit.value
+			s = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix))
+			break
+		}
+	}
+
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size %q", original)
+	}
+	return int64(value * float64(multiplier)), nil
+}
@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+func TestBlobSizeLimitAppliesToRangeRequests(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	small, large := []byte("small layer"), bytes.Repeat([]byte("x"), 200)
+	_, layers := upstream.addImage("team/app", "v1", small, large)
+	p, client := newTestProxy(t, upstream, map[string]string{"MAX_BLOB_SIZE": "100"})
+	client.login("team/app")
+
+	smallPath, largePath := "/v2/team/app/blobs/"+layers[0], "/v2/team/app/blobs/"+layers[1]
+	if resp, _ := client.do("GET", smallPath, http.Header{"Range": {"bytes=0-4"}}); resp.StatusCode != http.StatusPartialContent {
+		t.Errorf("ranged small blob: status %d, want 206", resp.StatusCode)
+	}
+	for _, rangeHeader := range []string{"", "bytes=0-49", "bytes=150-"} {
+		header := http.Header{}
+		if rangeHeader != "" {
+			header.Set("Range", rangeHeader)
+		}
+		resp, body := client.do("GET", largePath, header)
+		if resp.StatusCode != http.StatusRequestEntityTooLarge || bytes.Contains(body, large[:50]) {
+			t.Errorf("large blob from upstream with Range %q: status %d", rangeHeader, resp.StatusCode)
+		}
+	}
+
+	// 已缓存的超限 blob 同样不能分段拉取
+	entry := &cache.CacheEntry{Descriptor: cache.Descriptor{Digest: layers[1], Size: int64(len(large))}, Data: large}
+	if err := p.cacheManager.Put(cache.CacheKey(testRegistryHost, largePath), entry); err != nil {
+		t.Fatal(err)
+	}
+	requests := upstream.count("GET", largePath)
+	resp, _ := client.do("GET", largePath, http.Header{"Range": {"bytes=0-49"}})
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("ranged large blob from cache: status %d, want 413", resp.StatusCode)
+	}
+	if upstream.count("GET", largePath) != requests {
+		t.Error("ranged large blob was not served from cache")
+	}
+}
+
+func TestImageSizeLimit(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	upstream.addImage("team/app", "small", []byte("layer"))
+	upstream.addImage("team/app", "large", bytes.Repeat([]byte("x"), 200))
+	_, client := newTestProxy(t, upstream, map[string]string{"MAX_IMAGE_SIZE": "150"})
+	client.login("team/app")
+
+	accept := http.Header{"Accept": {fakeManifestType}}
+	if resp, _ := client.do("GET", "/v2/team/app/manifests/small", accept); resp.StatusCode != http.StatusOK {
+		t.Errorf("small image: status %d, want 200", resp.StatusCode)
+	}
+	if resp, _ := client.do("GET", "/v2/team/app/manifests/large", accept); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("large image: status %d, want 413", resp.StatusCode)
+	}
+}
+
+func TestBlobSizeLimitAppliesToRedirects(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	upstream.configure(func(f *fakeRegistry) { f.redirectBlobs = true })
+	small, large := []byte("small layer"), bytes.Repeat([]byte("x"), 200)
+	_, layers := upstream.addImage("team/app", "v1", small, large)
+	_, client := newTestProxy(t, upstream, map[string]string{"MAX_BLOB_SIZE": "100"})
+	client.login("team/app")
+
+	smallPath, largePath := "/v2/team/app/blobs/"+layers[0], "/v2/team/app/blobs/"+layers[1]
+	for _, getOnly := range []bool{false, true} {
+		// 存储拒绝 HEAD 时改用 Range GET 获取大小
+		upstream.configure(func(f *fakeRegistry) { f.storageGetOnly = getOnly })
+		if resp, _ := client.do("GET", smallPath, nil); resp.StatusCode != http.StatusTemporaryRedirect {
+			t.Errorf("small blob (GET-only storage %v): status %d, want 307", getOnly, resp.StatusCode)
+		}
+		resp, _ := client.do("GET", largePath, nil)
+		if resp.StatusCode != http.StatusRequestEntityTooLarge || resp.Header.Get("Location") != "" {
+			t.Errorf("large blob (GET-only storage %v): status %d, Location %q", getOnly, resp.StatusCode, resp.Header.Get("Location"))
+		}
+	}
+	if n := upstream.count(http.MethodGet, "/blobs/"+layers[1]); n != 1 {
+		t.Errorf("storage ranged GETs = %d, want 1", n)
+	}
+}
+
+func TestBlobSizeLimitAbortsChunkedBlobs(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	upstream.configure(func(f *fakeRegistry) { f.chunkedBlobs = true })
+	small, large := []byte("small layer"), bytes.Repeat([]byte("x"), 1000)
+	_, layers := upstream.addImage("team/app", "v1", small, large)
+	p, client := newTestProxy(t, upstream, map[string]string{"MAX_BLOB_SIZE": "300"})
+	client.login("team/app")
+
+	if resp, body := client.do("GET", "/v2/team/app/blobs/"+layers[0], nil); resp.StatusCode != http.StatusOK || !bytes.Equal(body, small) {
+		t.Fatalf("small chunked blob: status %d, %d bytes", resp.StatusCode, len(body))
+	}
+
+	// 超过上限时响应头已经写出，只能中断连接，不能让客户端把截断的内容当作完整响应
+	req, err := http.NewRequest("GET", client.base+"/v2/team/app/blobs/"+layers[1], nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Host = testRegistryHost
+	req.Header.Set("Authorization", "Bearer "+client.token)
+	// 响应头可能尚未发送到连接上，此时客户端直接读到 EOF
+	if resp, err := client.http.Do(req); err == nil {
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err == nil {
+			t.Errorf("large chunked blob: read %d bytes without error", len(body))
+		}
+		if len(body) > 300 {
+			t.Errorf("large chunked blob: client received %d bytes, limit 300", len(body))
+		}
+	}
+	if blobCached(p, "team/app", layers[1]) {
+		t.Error("oversized blob was cached")
+	}
+}
@@ -0,0 +1,112 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+// =============================================================================
+// Tag 策略 - 禁止 latest 等可变 tag、要求语义化版本或只允许按 digest 拉取
+// =============================================================================
+
+// semverTagPattern 语义化版本 tag（可带 v 前缀，允许省略 patch，允许预发布 / 构建后缀）
+var semverTagPattern = regexp.MustCompile(`^v?\d+\.\d+(\.\d+)?([-+][0-9A-Za-z.+-]+)?$`)
+
+// TagPolicy 一组仓库的 tag 规则
+//
+//	{"repositories": ["docker.example.com/myorg/*"], "denyTags": ["latest"], "requireSemver": true}
+type TagPolicy struct {
+	Repositories  []string `json:"repositories"`
+	DenyTags      []string `json:"denyTags,omitempty"`      // 禁止的 tag，以 * 结尾时按前缀匹配
+	AllowPattern  string   `json:"allowPattern,omitempty"`  // tag 必须匹配的正则
+	RequireSemver bool     `json:"requireSemver,omitempty"` // tag 必须是语义化版本
+	DigestOnly    bool     `json:"digestOnly,omitempty"`    // 只允许按 digest 拉取
+
+	allow *regexp.Regexp
+}
+
+// TagPolicies 按顺序匹配，第一条匹配仓库的策略生效
+type TagPolicies struct {
+	policies []*TagPolicy
+}
+
+// LoadTagPolicies 从 JSON 文件加载 tag 策略，path 为空时返回 nil
+func LoadTagPolicies(path string) (*TagPolicies, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tag policy: %w", err)
+	}
+	var policies []*TagPolicy
+	if err := json.Unmarshal(data, &policies); err != nil {
+		return nil, fmt.Errorf("failed to parse tag policy: %w", err)
+	}
+	for i, policy := range policies {
+		if policy.AllowPattern == "" {
+			continue
+		}
+		if policy.allow, err = regexp.Compile(policy.AllowPattern); err != nil {
+			return nil, fmt.Errorf("tag policy %d: invalid allowPattern: %w", i, err)
+		}
+	}
+
+	log.Printf("Tag policy enabled: %d policies", len(policies))
+	return &TagPolicies{policies: policies}, nil
+}
+
+// Check 检查对 {name}:{reference} 的拉取是否违反策略，返回违规说明
+func (t *TagPolicies) Check(name, reference string) (string, bool) {
+	if t == nil {
+		return "", false
+	}
+
+	var policy *TagPolicy
+	for _, tp := range t.policies {
+		if matchRepository(tp.Repositories, name) {
+			policy = tp
+			break
+		}
+	}
+	if policy == nil || strings.HasPrefix(reference, "sha256:") {
+		return "", false
+	}
+
+	switch {
+	case policy.DigestOnly:
+		return fmt.Sprintf("tag policy for %s requires pulling by digest (got tag %q)", name, reference), true
+	case matchRepository(policy.DenyTags, reference):
+		return fmt.Sprintf("tag %q is not allowed for %s by tag policy", reference, name), true
+	case policy.RequireSemver && !semverTagPattern.MatchString(reference):
+		return fmt.Sprintf("tag policy for %s requires semantic version tags (got %q)", name, reference), true
+	case policy.allow != nil && !policy.allow.MatchString(reference):
+		return fmt.Sprintf("tag %q does not match allowed pattern %q for %s", reference, policy.AllowPattern, name), true
+	}
+	return "", false
+}
+
+// tagPolicyMiddleware 在转发前拒绝违反 tag 策略的 manifest 请求
+func (p *ProxyServer) tagPolicyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pathType, repo, reference := cache.ParsePath(r.URL.Path)
+		if pathType == "manifest" {
+			if message, denied := p.tagPolicies.Check(repositoryName(r.Host, repo), reference); denied {
+				if p.config.Debug {
+					log.Printf("[DEBUG] Tag policy denied %s: %s", r.URL.Path, message)
+				}
+				p.writeRegistryError(w, http.StatusForbidden, "DENIED", message)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
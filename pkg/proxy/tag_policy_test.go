@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTagPolicyMiddleware(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	upstream.addImage("team/app", "latest", []byte("latest layer"))
+	upstream.addImage("team/app", "v1.2.3", []byte("release layer"))
+	pinned, _ := upstream.addImage("prod/app", "v1.0.0", []byte("prod layer"))
+	upstream.addImage("other/app", "latest", []byte("other layer"))
+
+	policyFile := filepath.Join(t.TempDir(), "tag-policy.json")
+	os.WriteFile(policyFile, []byte(`[
+		{"repositories": ["`+testRegistryHost+`/prod/*"], "digestOnly": true},
+		{"repositories": ["`+testRegistryHost+`/team/*"], "denyTags": ["latest", "dev-*"], "requireSemver": true}
+	]`), 0o600)
+	_, client := newTestProxy(t, upstream, map[string]string{"TAG_POLICY": policyFile})
+
+	accept := http.Header{"Accept": {fakeManifestType}}
+	for _, tt := range []struct {
+		repo, reference string
+		status          int
+	}{
+		{"team/app", "latest", http.StatusForbidden},
+		{"team/app", "dev-123", http.StatusForbidden},
+		{"team/app", "nightly", http.StatusForbidden},
+		{"team/app", "v1.2.3", http.StatusOK},
+		{"prod/app", "v1.0.0", http.StatusForbidden},
+		{"prod/app", pinned, http.StatusOK},
+		{"other/app", "latest", http.StatusOK},
+	} {
+		client.login(tt.repo)
+		resp, body := client.do("GET", "/v2/"+tt.repo+"/manifests/"+tt.reference, accept)
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s:%s: status %d, want %d: %s", tt.repo, tt.reference, resp.StatusCode, tt.status, body)
+		}
+		if tt.status == http.StatusForbidden && !strings.Contains(string(body), `"DENIED"`) {
+			t.Errorf("%s:%s: body %s, want a DENIED registry error", tt.repo, tt.reference, body)
+		}
+	}
+
+	// 被拒绝的请求不访问上游
+	for _, path := range []string{"/v2/team/app/manifests/latest", "/v2/prod/app/manifests/v1.0.0"} {
+		if n := upstream.count("GET", path); n != 0 {
+			t.Errorf("%s reached upstream %d times", path, n)
+		}
+	}
+}
+
+func TestTagPoliciesAllowPattern(t *testing.T) {
+	policyFile := filepath.Join(t.TempDir(), "tag-policy.json")
+	os.WriteFile(policyFile, []byte(`[{"repositories": ["*"], "allowPattern": "^release-[0-9]+$"}]`), 0o600)
+	policies, err := LoadTagPolicies(policyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, denied := policies.Check("docker.io/library/nginx", "release-42"); denied {
+		t.Error("release-42 denied by allowPattern")
+	}
+	if _, denied := policies.Check("docker.io/library/nginx", "release-x"); !denied {
+		t.Error("release-x allowed by allowPattern")
+	}
+
+	os.WriteFile(policyFile, []byte(`[{"repositories": ["*"], "allowPattern": "("}]`), 0o600)
+	if _, err := LoadTagPolicies(policyFile); err == nil {
+		t.Error("loaded a policy with an invalid allowPattern")
+	}
+}
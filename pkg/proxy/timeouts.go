@@ -0,0 +1,296 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+// =============================================================================
+// 超时配置 - 上游响应头超时、请求超时与重试，可按路由和请求类别（auth/manifest/blob）覆盖
+// =============================================================================
+
+// 请求类别
+const (
+	RequestClassDefault  = "default"
+	RequestClassAuth     = "auth"
+	RequestClassManifest = "manifest"
+	RequestClassBlob     = "blob"
+)
+
+// Timeouts 单个请求生效的超时设置
+type Timeouts struct {
+	ResponseHeader time.Duration // 等待上游响应头的超时（0 表示不限制）
+	Request        time.Duration // 整个请求的处理时间上限（0 表示不限制）
+	Retries        int           // 上游连接失败或返回可重试状态码时的重试次数
+	Backoff        time.Duration // 首次重试间隔（之后按指数递增并加入随机抖动）
+	MaxBackoff     time.Duration // 单次重试间隔上限，也是接受的最长 Retry-After（0 表示不限制）
+}
+
+// TimeoutSpec 超时覆盖项，未设置的字段沿用上一级
+type TimeoutSpec struct {
+	ResponseHeader string `json:"responseHeader,omitempty"`
+	Request        string `json:"request,omitempty"`
+	Retries        *int   `json:"retries,omitempty"`
+	Backoff        string `json:"backoff,omitempty"`
+	MaxBackoff     string `json:"maxBackoff,omitempty"`
+
+	// 按请求类别覆盖
+	Auth     *TimeoutSpec `json:"auth,omitempty"`
+	Manifest *TimeoutSpec `json:"manifest,omitempty"`
+	Blob     *TimeoutSpec `json:"blob,omitempty"`
+}
+
+// TimeoutFile TIMEOUTS_FILE 的内容
+//
+//	{"blob": {"request": "0"}, "routes": {"docker": {"manifest": {"responseHeader": "10s"}}}}
+type TimeoutFile struct {
+	TimeoutSpec
+	Routes map[string]*TimeoutSpec `json:"routes,omitempty"` // 路由名（子域名）或完整 host
+}
+
+// TimeoutTable 预先解析的超时表
+type TimeoutTable struct {
+	byRoute map[string]map[string]Timeouts // 路由 host -> 类别 -> 设置
+	global  map[string]Timeouts
+}
+
+var requestClasses = []string{RequestClassDefault, RequestClassAuth, RequestClassManifest, RequestClassBlob}
+
+// LoadTimeouts 以环境变量中的默认值为基础，叠加 path 中的全局 / 类别 / 路由覆盖
+func LoadTimeouts(path, customDomain string, base Timeouts) (*TimeoutTable, error) {
+	var file TimeoutFile
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read timeouts file: %w", err)
+		}
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("failed to parse timeouts file: %w", err)
+		}
+	}
+
+	global, err := resolveTimeouts(base, &file.TimeoutSpec)
+	if err != nil {
+		return nil, err
+	}
+	t := &TimeoutTable{byRoute: make(map[string]map[string]Timeouts), global: global}
+
+	for name, spec := range file.Routes {
+		host := name
+		if !strings.Contains(name, ".") {
+			host = name + "." + customDomain
+		}
+		classes := make(map[string]Timeouts)
+		for _, class := range requestClasses {
+			// 路由级设置叠加在全局类别设置之上
+			resolved, err := applyTimeoutSpec(global[class], spec)
+			if err == nil {
+				resolved, err = applyTimeoutSpec(resolved, spec.class(class))
+			}
+			if err != nil {
+				return nil, fmt.Errorf("timeouts for route %s: %w", name, err)
+			}
+			classes[class] = resolved
+		}
+		t.byRoute[host] = classes
+	}
+
+	if path != "" {
+		log.Printf("Timeouts loaded from %s: %d route overrides", path, len(t.byRoute))
+	}
+	return t, nil
+}
+
+// resolveTimeouts 计算 spec 下各类别的设置
+func resolveTimeouts(base Timeouts, spec *TimeoutSpec) (map[string]Timeouts, error) {
+	def, err := applyTimeoutSpec(base, spec)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]Timeouts{RequestClassDefault: def}
+	for _, class := range requestClasses[1:] {
+		if result[class], err = applyTimeoutSpec(def, spec.class(class)); err != nil {
+			return nil, fmt.Errorf("%s: %w", class, err)
+		}
+	}
+	return result, nil
+}
+
+func (s *TimeoutSpec) class(class string) *TimeoutSpec {
+	switch class {
+	case RequestClassAuth:
+		return s.Auth
+	case RequestClassManifest:
+		return s.Manifest
+	case RequestClassBlob:
+		return s.Blob
+	}
+	return nil
+}
+
+// applyTimeoutSpec 用 spec 中设置的字段覆盖 t
+func applyTimeoutSpec(t Timeouts, spec *TimeoutSpec) (Timeouts, error) {
+	if spec == nil {
+		return t, nil
+	}
+	for _, field := range []struct {
+		name   string
+		value  string
+		target *time.Duration
+	}{
+		{"responseHeader", spec.ResponseHeader, &t.ResponseHeader},
+		{"request", spec.Request, &t.Request},
+		{"backoff", spec.Backoff, &t.Backoff},
+		{"maxBackoff", spec.MaxBackoff, &t.MaxBackoff},
+	} {
+		if field.value == "" {
+			continue
+		}
+		d := parseDuration(field.value, -1)
+		if d < 0 {
+			return t, fmt.Errorf("invalid %s %q", field.name, field.value)
+		}
+		*field.target = d
+	}
+	if spec.Retries != nil {
+		t.Retries = *spec.Retries
+	}
+	return t, nil
+}
+
+// Get 返回路由 host 上某类请求的设置
+func (t *TimeoutTable) Get(host, class string) Timeouts {
+	if classes, ok := t.byRoute[host]; ok {
+		return classes[class]
+	}
+	return t.global[class]
+}
+
+// MaxResponseHeader 所有设置中最长的响应头超时，作为 Transport 的兜底值
+func (t *TimeoutTable) MaxResponseHeader() time.Duration {
+	var max time.Duration
+	check := func(classes map[string]Timeouts) bool {
+		for _, timeouts := range classes {
+			if timeouts.ResponseHeader == 0 {
+				return false
+			}
+			if timeouts.ResponseHeader > max {
+				max = timeouts.ResponseHeader
+			}
+		}
+		return true
+	}
+
+	if !check(t.global) {
+		return 0
+	}
+	for _, classes := range t.byRoute {
+		if !check(classes) {
+			return 0
+		}
+	}
+	return max
+}
+
+// requestClass 根据客户端请求路径判断请求类别
+func requestClass(path string) string {
+	if path == "/v2/auth" {
+		return RequestClassAuth
+	}
+	switch pathType, _, _ := cache.ParsePath(path); pathType {
+	case "manifest":
+		return RequestClassManifest
+	case "blob":
+		return RequestClassBlob
+	}
+	return RequestClassDefault
+}
+
+type timeoutsKey struct{}
+
+// timeoutsFromContext 返回请求生效的超时设置
+func (p *ProxyServer) timeoutsFromContext(ctx context.Context) Timeouts {
+	if t, ok := ctx.Value(timeoutsKey{}).(Timeouts); ok {
+		return t
+	}
+	return p.timeouts.global[RequestClassDefault]
+}
+
+// timeoutMiddleware 确定请求的超时设置并写入 context，设置了请求超时时超时后取消请求（/admin/events 除外）；
+// 尚未写出响应时返回 504，已经开始传输的响应（如 blob）只是被中止，不再追加状态码
+func (p *ProxyServer) timeoutMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t := p.timeouts.Get(r.Host, requestClass(r.URL.Path))
+		r = r.WithContext(context.WithValue(r.Context(), timeoutsKey{}, t))
+		// 事件流是长连接，不受请求超时限制
+		if t.Request <= 0 || r.URL.Path == adminEventsPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), t.Request)
+		defer cancel()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r.WithContext(ctx))
+		if ctx.Err() == context.DeadlineExceeded && ww.Status() == 0 {
+			p.writeErrorResponse(ww, fmt.Sprintf("request timed out after %s", t.Request), http.StatusGatewayTimeout)
+		}
+	})
+}
+
+// cancelBody 响应体关闭时取消对应请求的 context
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// roundTrip 执行上游请求，按 context 中的设置重试并限制每次等待响应头的时间
+func (p *ProxyServer) roundTrip(req *http.Request) (*http.Response, error) {
+	setRequestID(req)
+	start := time.Now()
+	resp, err := p.withRetries(req, p.roundTripOnce)
+	timingFromContext(req.Context()).addUpstream(time.Since(start))
+	if err == nil {
+		p.rateLimits.observe(req, resp)
+		p.hookUpstreamResponse(req, resp)
+	}
+	return resp, err
+}
+
+// roundTripOnce 执行一次上游请求，超过响应头超时时取消
+func (p *ProxyServer) roundTripOnce(req *http.Request) (*http.Response, error) {
+	limit := p.timeoutsFromContext(req.Context()).ResponseHeader
+	if limit <= 0 {
+		return p.transport.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithCancel(req.Context())
+	timer := time.AfterFunc(limit, cancel)
+	resp, err := p.transport.RoundTrip(req.WithContext(ctx))
+	if !timer.Stop() && err != nil && req.Context().Err() == nil {
+		err = fmt.Errorf("timeout awaiting response headers from %s after %s", req.URL.Host, limit)
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
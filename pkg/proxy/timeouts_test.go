@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestManifestResponseHeaderTimeout(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		timeouts string
+		ok       bool
+	}{
+		{"manifest override", `{"manifest": {"responseHeader": "100ms", "retries": 0}}`, false},
+		{"route override", `{"manifest": {"responseHeader": "100ms", "retries": 0},
+			"routes": {"` + testRegistryHost + `": {"manifest": {"responseHeader": "5s"}}}}`, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			upstream := newFakeRegistry(t)
+			upstream.addImage("team/app", "v1", []byte("app layer"))
+			timeoutsFile := filepath.Join(t.TempDir(), "timeouts.json")
+			os.WriteFile(timeoutsFile, []byte(tc.timeouts), 0o600)
+			_, client := newTestProxy(t, upstream, map[string]string{"TIMEOUTS_FILE": timeoutsFile})
+			client.login("team/app")
+
+			// 认证请求不受 manifest 超时影响；manifest 响应头延迟 500ms
+			upstream.configure(func(f *fakeRegistry) { f.manifestDelay = 500 * time.Millisecond })
+			resp, body := client.do("GET", "/v2/team/app/manifests/v1", http.Header{"Accept": {fakeManifestType}})
+			if ok := resp.StatusCode == http.StatusOK; ok != tc.ok {
+				t.Errorf("status %d, ok = %v, want %v: %s", resp.StatusCode, ok, tc.ok, body)
+			}
+			if !tc.ok && resp.StatusCode < 500 {
+				t.Errorf("timed out manifest: status %d, want 5xx", resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestLoadTimeoutsLayering(t *testing.T) {
+	timeoutsFile := filepath.Join(t.TempDir(), "timeouts.json")
+	os.WriteFile(timeoutsFile, []byte(`{
+		"request": "1m",
+		"blob": {"request": "0"},
+		"routes": {"docker": {"retries": 5, "manifest": {"responseHeader": "10s"}}}
+	}`), 0o600)
+	base := Timeouts{ResponseHeader: 30 * time.Second, Retries: 2}
+	table, err := LoadTimeouts(timeoutsFile, "example.com", base)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		host, class string
+		want        Timeouts
+	}{
+		{"quay.example.com", RequestClassManifest, Timeouts{ResponseHeader: 30 * time.Second, Request: time.Minute, Retries: 2}},
+		{"quay.example.com", RequestClassBlob, Timeouts{ResponseHeader: 30 * time.Second, Retries: 2}},
+		{"docker.example.com", RequestClassManifest, Timeouts{ResponseHeader: 10 * time.Second, Request: time.Minute, Retries: 5}},
+		{"docker.example.com", RequestClassBlob, Timeouts{ResponseHeader: 30 * time.Second, Retries: 5}},
+	} {
+		if got := table.Get(tt.host, tt.class); got != tt.want {
+			t.Errorf("Get(%s, %s) = %+v, want %+v", tt.host, tt.class, got, tt.want)
+		}
+	}
+	if got := table.MaxResponseHeader(); got != 30*time.Second {
+		t.Errorf("MaxResponseHeader = %v, want 30s", got)
+	}
+
+	os.WriteFile(timeoutsFile, []byte(`{"auth": {"responseHeader": "soon"}}`), 0o600)
+	if _, err := LoadTimeouts(timeoutsFile, "example.com", base); err == nil {
+		t.Error("loaded an invalid responseHeader")
+	}
+}
+
+// statusRecorder 记录每次 WriteHeader 调用
+type statusRecorder struct {
+	*httptest.ResponseRecorder
+	statuses []int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.statuses = append(r.statuses, status)
+	r.ResponseRecorder.WriteHeader(status)
+}
+
+func TestRequestTimeoutAfterResponseStarted(t *testing.T) {
+	p := newTestProxyServer(t, newFakeRegistry(t), map[string]string{"REQUEST_TIMEOUT": "50ms"})
+
+	for _, tc := range []struct {
+		name     string
+		started  bool
+		statuses []int
+	}{
+		{"before headers", false, []int{http.StatusGatewayTimeout}},
+		{"after headers", true, []int{http.StatusOK}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := &statusRecorder{ResponseRecorder: httptest.NewRecorder()}
+			handler := p.timeoutMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tc.started {
+					w.WriteHeader(http.StatusOK)
+					w.Write([]byte("partial blob"))
+				}
+				<-r.Context().Done()
+			}))
+			handler.ServeHTTP(rec, httptest.NewRequest("GET", "/v2/team/app/blobs/sha256:abc", nil))
+			if fmt.Sprint(rec.statuses) != fmt.Sprint(tc.statuses) {
+				t.Errorf("WriteHeader calls = %v, want %v", rec.statuses, tc.statuses)
+			}
+		})
+	}
+}
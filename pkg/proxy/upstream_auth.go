@@ -0,0 +1,105 @@
+package proxy
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// =============================================================================
+// 上游认证 - 私有仓库由代理持有凭据，客户端无需登录上游
+// =============================================================================
+
+// UpstreamAuthenticator 为发往私有上游的请求注入凭据
+type UpstreamAuthenticator interface {
+	// Authorize 为上游请求设置 Authorization（必要时刷新 token）
+	Authorize(ctx context.Context, req *http.Request) error
+	// Invalidate 上游返回 401 时丢弃缓存的 token，下次请求重新获取
+	Invalidate()
+}
+
+// parseNamedHosts 解析 "name=host,name2=host2" 格式的路由列表
+func parseNamedHosts(value string) map[string]string {
+	result := make(map[string]string)
+	for _, item := range strings.Split(value, ",") {
+		name, host, ok := strings.Cut(strings.TrimSpace(item), "=")
+		name, host = strings.TrimSpace(name), strings.TrimSpace(host)
+		if !ok || name == "" || host == "" {
+			continue
+		}
+		host = strings.TrimPrefix(strings.TrimPrefix(host, "https://"), "http://")
+		result[name] = strings.TrimSuffix(host, "/")
+	}
+	return result
+}
+
+// buildUpstreamAuth 根据配置注册私有仓库路由及其认证器
+// 路由形如 {name}.{CUSTOM_DOMAIN} -> https://{host}，认证器按上游 host 索引
+func buildUpstreamAuth(config *Config, transport http.RoundTripper) map[string]UpstreamAuthenticator {
+	authenticators := make(map[string]UpstreamAuthenticator)
+	client := &http.Client{Transport: transport, Timeout: 30 * time.Second}
+
+	register := func(kind, name, host string, auth UpstreamAuthenticator) {
+		routeHost := name + "." + config.CustomDomain
+		config.Routes[routeHost] = "https://" + host
+		authenticators[host] = auth
+		log.Printf("Private %s route: %s -> %s", kind, routeHost, host)
+	}
+
+	if routes := config.ECRRoutes; len(routes) > 0 {
+		creds := NewAWSCredentialProvider(client)
+		for name, host := range routes {
+			auth, err := NewECRAuthenticator(host, creds, client)
+			if err != nil {
+				log.Printf("Skipping ECR route %s: %v", name, err)
+				continue
+			}
+			register("ECR", name, host, auth)
+		}
+	}
+
+	if routes := config.GARRoutes; len(routes) > 0 {
+		// 所有 GAR / GCR 路由共用同一服务账号的 access token
+		auth, err := NewGARAuthenticator(getEnv("GOOGLE_APPLICATION_CREDENTIALS", ""), client)
+		if err != nil {
+			log.Printf("Skipping GAR routes: %v", err)
+		} else {
+			for name, host := range routes {
+				register("GAR", name, host, auth)
+			}
+		}
+	}
+
+	for name, host := range config.ACRRoutes {
+		register("ACR", name, host, NewACRAuthenticator(host, client))
+	}
+
+	return authenticators
+}
+
+// authorizeUpstream 私有上游：去掉客户端凭据，注入代理持有的凭据
+func (p *ProxyServer) authorizeUpstream(req *http.Request) {
+	auth, ok := p.current().upstreamAuth[req.URL.Host]
+	if !ok {
+		return
+	}
+
+	req.Header.Del("Authorization")
+	start := time.Now()
+	if err := auth.Authorize(req.Context(), req); err != nil {
+		log.Printf("Upstream auth for %s failed: %v", req.URL.Host, err)
+	}
+	timingFromContext(req.Context()).add(PhaseAuth, time.Since(start))
+}
+
+// invalidateUpstreamAuth 上游返回 401 时让对应认证器丢弃 token
+func (p *ProxyServer) invalidateUpstreamAuth(host string) {
+	if auth, ok := p.current().upstreamAuth[host]; ok {
+		if p.config.Debug {
+			log.Printf("[DEBUG] Upstream %s rejected credentials, invalidating token", host)
+		}
+		auth.Invalidate()
+	}
+}
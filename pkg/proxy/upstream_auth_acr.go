@@ -0,0 +1,240 @@
+package proxy
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+// =============================================================================
+// Azure Container Registry 认证 - 服务主体 / 工作负载标识 / 托管标识
+// =============================================================================
+
+const (
+	azureIMDSTokenURL = "http://169.254.169.254/metadata/identity/oauth2/token"
+	azureARMResource  = "https://management.azure.com/"
+	// acrTokenRefreshWindow ACR token 过期前多久刷新
+	acrTokenRefreshWindow = 5 * time.Minute
+)
+
+// acrToken 带过期时间的 token
+type acrToken struct {
+	value     string
+	expiresAt time.Time
+}
+
+func (t acrToken) valid() bool {
+	return t.value != "" && time.Now().Add(acrTokenRefreshWindow).Before(t.expiresAt)
+}
+
+// ACRAuthenticator 实现 ACR 的 token 交换流程：
+// AAD access token -> /oauth2/exchange 得到 refresh token -> /oauth2/token 按仓库 scope 得到 access token
+type ACRAuthenticator struct {
+	registry string
+	tenantID string
+	clientID string
+	secret   string
+	client   *http.Client
+
+	mu           sync.Mutex
+	refreshToken acrToken
+	accessTokens map[string]acrToken // scope -> token
+}
+
+// NewACRAuthenticator 创建 ACR 认证器
+// 凭据来自 AZURE_TENANT_ID / AZURE_CLIENT_ID / AZURE_CLIENT_SECRET（服务主体）、
+// AZURE_FEDERATED_TOKEN_FILE（AKS 工作负载标识），均未配置时使用托管标识
+func NewACRAuthenticator(registry string, client *http.Client) *ACRAuthenticator {
+	return &ACRAuthenticator{
+		registry:     registry,
+		tenantID:     getEnv("AZURE_TENANT_ID", ""),
+		clientID:     getEnv("AZURE_CLIENT_ID", ""),
+		secret:       getEnv("AZURE_CLIENT_SECRET", ""),
+		client:       client,
+		accessTokens: make(map[string]acrToken),
+	}
+}
+
+// Authorize 按请求路径中的仓库获取 pull 权限的 access token
+func (a *ACRAuthenticator) Authorize(ctx context.Context, req *http.Request) error {
+	scope := ""
+	if _, repo, _ := cache.ParsePath(req.URL.Path); repo != "" {
+		scope = "repository:" + repo + ":pull"
+	}
+
+	token, err := a.getAccessToken(ctx, scope)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// Invalidate 丢弃所有缓存的 token
+func (a *ACRAuthenticator) Invalidate() {
+	a.mu.Lock()
+	a.refreshToken = acrToken{}
+	a.accessTokens = make(map[string]acrToken)
+	a.mu.Unlock()
+}
+
+func (a *ACRAuthenticator) getAccessToken(ctx context.Context, scope string) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if token, ok := a.accessTokens[scope]; ok && token.valid() {
+		return token.value, nil
+	}
+
+	if !a.refreshToken.valid() {
+		aadToken, err := a.fetchAADToken(ctx)
+		if err != nil {
+			return "", err
+		}
+		refresh, err := a.exchange(ctx, aadToken)
+		if err != nil {
+			return "", err
+		}
+		a.refreshToken = refresh
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("service", a.registry)
+	form.Set("refresh_token", a.refreshToken.value)
+	if scope != "" {
+		form.Set("scope", scope)
+	}
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := a.postForm(ctx, "https://"+a.registry+"/oauth2/token", form, &result); err != nil {
+		return "", fmt.Errorf("ACR token request failed: %w", err)
+	}
+
+	token := acrToken{value: result.AccessToken, expiresAt: jwtExpiry(result.AccessToken, time.Hour)}
+	a.accessTokens[scope] = token
+	return token.value, nil
+}
+
+// exchange 用 AAD token 换取 ACR refresh token
+func (a *ACRAuthenticator) exchange(ctx context.Context, aadToken string) (acrToken, error) {
+	form := url.Values{}
+	form.Set("grant_type", "access_token")
+	form.Set("service", a.registry)
+	form.Set("access_token", aadToken)
+	if a.tenantID != "" {
+		form.Set("tenant", a.tenantID)
+	}
+
+	var result struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := a.postForm(ctx, "https://"+a.registry+"/oauth2/exchange", form, &result); err != nil {
+		return acrToken{}, fmt.Errorf("ACR token exchange failed: %w", err)
+	}
+	return acrToken{value: result.RefreshToken, expiresAt: jwtExpiry(result.RefreshToken, 3*time.Hour)}, nil
+}
+
+// fetchAADToken 获取 Azure Resource Manager 的 AAD access token
+func (a *ACRAuthenticator) fetchAADToken(ctx context.Context) (string, error) {
+	var result struct {
+		AccessToken string `json:"access_token"`
+	}
+
+	// 服务主体或工作负载标识：OAuth2 client credentials
+	federatedTokenFile := getEnv("AZURE_FEDERATED_TOKEN_FILE", "")
+	if a.tenantID != "" && a.clientID != "" && (a.secret != "" || federatedTokenFile != "") {
+		form := url.Values{}
+		form.Set("grant_type", "client_credentials")
+		form.Set("client_id", a.clientID)
+		form.Set("scope", azureARMResource+".default")
+		if a.secret != "" {
+			form.Set("client_secret", a.secret)
+		} else {
+			assertion, err := os.ReadFile(federatedTokenFile)
+			if err != nil {
+				return "", fmt.Errorf("failed to read federated token: %w", err)
+			}
+			form.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+			form.Set("client_assertion", strings.TrimSpace(string(assertion)))
+		}
+
+		authority := getEnv("AZURE_AUTHORITY_HOST", "")
+		if authority == "" {
+			authority = "https://login.microsoftonline.com/"
+		}
+		tokenURL := strings.TrimSuffix(authority, "/") + "/" + a.tenantID + "/oauth2/v2.0/token"
+		if err := a.postForm(ctx, tokenURL, form, &result); err != nil {
+			return "", fmt.Errorf("AAD token request failed: %w", err)
+		}
+		return result.AccessToken, nil
+	}
+
+	// 托管标识：Azure IMDS
+	q := url.Values{}
+	q.Set("api-version", "2018-02-01")
+	q.Set("resource", azureARMResource)
+	if a.clientID != "" {
+		q.Set("client_id", a.clientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", azureIMDSTokenURL+"?"+q.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata", "true")
+	if err := a.doJSON(req, &result); err != nil {
+		return "", fmt.Errorf("managed identity token request failed: %w", err)
+	}
+	return result.AccessToken, nil
+}
+
+func (a *ACRAuthenticator) postForm(ctx context.Context, endpoint string, form url.Values, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return a.doJSON(req, out)
+}
+
+func (a *ACRAuthenticator) doJSON(req *http.Request, out interface{}) error {
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, out)
+}
+
+// jwtExpiry 读取 JWT 的 exp 声明（不校验签名），解析失败时使用 fallback 有效期
+func jwtExpiry(token string, fallback time.Duration) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) == 3 {
+		if payload, err := base64.RawURLEncoding.DecodeString(parts[1]); err == nil {
+			var claims struct {
+				Exp int64 `json:"exp"`
+			}
+			if json.Unmarshal(payload, &claims) == nil && claims.Exp > 0 {
+				return time.Unix(claims.Exp, 0)
+			}
+		}
+	}
+	return time.Now().Add(fallback)
+}
@@ -0,0 +1,99 @@
+package proxy
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestACRAuthenticatorTokenExchange(t *testing.T) {
+	// 同一个 TLS 服务同时充当 AAD 与 ACR 的 token 端点
+	var mu sync.Mutex
+	calls := map[string]int{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		mu.Lock()
+		calls[r.URL.Path]++
+		mu.Unlock()
+
+		form := r.PostForm
+		switch r.URL.Path {
+		case "/tenant-1/oauth2/v2.0/token":
+			if form.Get("grant_type") != "client_credentials" || form.Get("client_id") != "client-1" || form.Get("client_secret") != "secret-1" {
+				http.Error(w, "bad client credentials", http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"access_token": "aad-token"})
+		case "/oauth2/exchange":
+			if form.Get("access_token") != "aad-token" || form.Get("tenant") != "tenant-1" {
+				http.Error(w, "bad exchange", http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"refresh_token": "refresh-token"})
+		case "/oauth2/token":
+			if form.Get("refresh_token") != "refresh-token" {
+				http.Error(w, "bad refresh token", http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]string{"access_token": testJWT(time.Now().Add(time.Hour)) + "|" + form.Get("scope")})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	t.Setenv("AZURE_TENANT_ID", "tenant-1")
+	t.Setenv("AZURE_CLIENT_ID", "client-1")
+	t.Setenv("AZURE_CLIENT_SECRET", "secret-1")
+	t.Setenv("AZURE_AUTHORITY_HOST", server.URL)
+	registry := strings.TrimPrefix(server.URL, "https://")
+	a := NewACRAuthenticator(registry, server.Client())
+
+	authorize := func(path string) string {
+		t.Helper()
+		req, _ := http.NewRequest("GET", "https://"+registry+path, nil)
+		if err := a.Authorize(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+		return req.Header.Get("Authorization")
+	}
+
+	// access token 按仓库 scope 区分，refresh token 复用
+	if got := authorize("/v2/team/app/manifests/v1"); !strings.HasSuffix(got, "|repository:team/app:pull") {
+		t.Errorf("Authorization = %q, want team/app pull scope", got)
+	}
+	authorize("/v2/team/app/blobs/sha256:abc")
+	if got := authorize("/v2/team/other/manifests/v1"); !strings.HasSuffix(got, "|repository:team/other:pull") {
+		t.Errorf("Authorization = %q, want team/other pull scope", got)
+	}
+	want := map[string]int{"/tenant-1/oauth2/v2.0/token": 1, "/oauth2/exchange": 1, "/oauth2/token": 2}
+	mu.Lock()
+	for path, n := range want {
+		if calls[path] != n {
+			t.Errorf("%s called %d times, want %d", path, calls[path], n)
+		}
+	}
+	mu.Unlock()
+}
+
+func TestJWTExpiry(t *testing.T) {
+	exp := time.Now().Add(2 * time.Hour).Truncate(time.Second)
+	if got := jwtExpiry(testJWT(exp), time.Minute); !got.Equal(exp) {
+		t.Errorf("jwtExpiry = %v, want %v", got, exp)
+	}
+	if got := jwtExpiry("opaque-token", time.Minute); got.After(time.Now().Add(time.Minute)) {
+		t.Errorf("jwtExpiry of an opaque token = %v, want fallback", got)
+	}
+}
+
+// testJWT 构造仅含 exp 声明的未签名 JWT
+func testJWT(exp time.Time) string {
+	claims, _ := json.Marshal(map[string]int64{"exp": exp.Unix()})
+	return "e30." + base64.RawURLEncoding.EncodeToString(claims) + ".sig"
+}
@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// =============================================================================
+// AWS ECR 私有仓库认证 - GetAuthorizationToken（12 小时有效）自动刷新
+// =============================================================================
+
+// ecrTokenRefreshWindow token 过期前多久刷新
+const ecrTokenRefreshWindow = 30 * time.Minute
+
+// ECRAuthenticator 通过 AWS 凭据获取 ECR registry token
+type ECRAuthenticator struct {
+	registryID string
+	region     string
+	endpoint   string
+	creds      *AWSCredentialProvider
+	client     *http.Client
+
+	mu        sync.Mutex
+	token     string // base64(AWS:password)
+	expiresAt time.Time
+}
+
+// NewECRAuthenticator 从 registry host 解析账号与区域
+// host 格式: {account}.dkr.ecr.{region}.amazonaws.com[.cn]
+func NewECRAuthenticator(host string, creds *AWSCredentialProvider, client *http.Client) (*ECRAuthenticator, error) {
+	parts := strings.Split(host, ".")
+	if len(parts) < 6 || parts[1] != "dkr" || parts[2] != "ecr" {
+		return nil, fmt.Errorf("invalid ECR registry host %q", host)
+	}
+
+	endpoint := "https://api.ecr." + parts[3] + ".amazonaws.com/"
+	if strings.HasSuffix(host, ".amazonaws.com.cn") {
+		endpoint = "https://api.ecr." + parts[3] + ".amazonaws.com.cn/"
+	}
+
+	return &ECRAuthenticator{
+		registryID: parts[0],
+		region:     parts[3],
+		endpoint:   endpoint,
+		creds:      creds,
+		client:     client,
+	}, nil
+}
+
+// Authorize ECR 使用 Basic 认证，token 本身即 base64(AWS:password)
+func (a *ECRAuthenticator) Authorize(ctx context.Context, req *http.Request) error {
+	token, err := a.getToken(ctx)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Basic "+token)
+	return nil
+}
+
+// Invalidate 丢弃缓存的 token
+func (a *ECRAuthenticator) Invalidate() {
+	a.mu.Lock()
+	a.token = ""
+	a.mu.Unlock()
+}
+
+func (a *ECRAuthenticator) getToken(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.token != "" && time.Now().Add(ecrTokenRefreshWindow).Before(a.expiresAt) {
+		return a.token, nil
+	}
+
+	token, expiresAt, err := a.fetchToken(ctx)
+	if err != nil {
+		// 刷新失败但旧 token 仍未过期时继续使用
+		if a.token != "" && time.Now().Before(a.expiresAt) {
+			return a.token, nil
+		}
+		return "", err
+	}
+	a.token = token
+	a.expiresAt = expiresAt
+	return token, nil
+}
+
+// fetchToken 调用 ECR GetAuthorizationToken
+func (a *ECRAuthenticator) fetchToken(ctx context.Context) (string, time.Time, error) {
+	creds, err := a.creds.Retrieve(ctx)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	payload, _ := json.Marshal(map[string][]string{"registryIds": {a.registryID}})
+	req, err := http.NewRequestWithContext(ctx, "POST", a.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken")
+	signRequestV4(req, sha256Hex(payload), creds, a.region, "ecr", time.Now())
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("GetAuthorizationToken request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("GetAuthorizationToken status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var result struct {
+		AuthorizationData []struct {
+			AuthorizationToken string  `json:"authorizationToken"`
+			ExpiresAt          float64 `json:"expiresAt"`
+		} `json:"authorizationData"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", time.Time{}, fmt.Errorf("invalid GetAuthorizationToken response: %w", err)
+	}
+	if len(result.AuthorizationData) == 0 || result.AuthorizationData[0].AuthorizationToken == "" {
+		return "", time.Time{}, fmt.Errorf("GetAuthorizationToken returned no token")
+	}
+
+	data := result.AuthorizationData[0]
+	expiresAt := time.Unix(int64(data.ExpiresAt), 0)
+	if data.ExpiresAt == 0 {
+		expiresAt = time.Now().Add(12 * time.Hour)
+	}
+	return data.AuthorizationToken, expiresAt, nil
+}
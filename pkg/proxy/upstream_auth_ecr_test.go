@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewECRAuthenticator(t *testing.T) {
+	a, err := NewECRAuthenticator("123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.registryID != "123456789012" || a.region != "cn-north-1" || a.endpoint != "https://api.ecr.cn-north-1.amazonaws.com.cn/" {
+		t.Errorf("parsed %q %q %q", a.registryID, a.region, a.endpoint)
+	}
+	if _, err := NewECRAuthenticator("registry.example.com", nil, nil); err == nil {
+		t.Error("accepted a non-ECR host")
+	}
+}
+
+func TestECRAuthenticatorCachesToken(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	var calls atomic.Int32
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.Header.Get("X-Amz-Target") != "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken" ||
+			!strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") {
+			http.Error(w, "unsigned request", http.StatusForbidden)
+			return
+		}
+		var input struct {
+			RegistryIDs []string `json:"registryIds"`
+		}
+		if json.NewDecoder(r.Body).Decode(&input) != nil || len(input.RegistryIDs) != 1 || input.RegistryIDs[0] != "123456789012" {
+			http.Error(w, "bad registryIds", http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"authorizationData": []map[string]any{{
+			"authorizationToken": "QVdTOnBhc3N3b3Jk",
+			"expiresAt":          time.Now().Add(12 * time.Hour).Unix(),
+		}}})
+	}))
+	t.Cleanup(api.Close)
+
+	a, err := NewECRAuthenticator("123456789012.dkr.ecr.us-east-1.amazonaws.com", NewAWSCredentialProvider(api.Client()), api.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.endpoint = api.URL + "/"
+
+	authorize := func() string {
+		t.Helper()
+		req, _ := http.NewRequest("GET", "https://123456789012.dkr.ecr.us-east-1.amazonaws.com/v2/", nil)
+		if err := a.Authorize(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+		return req.Header.Get("Authorization")
+	}
+	for range 2 {
+		if got := authorize(); got != "Basic QVdTOnBhc3N3b3Jk" {
+			t.Errorf("Authorization = %q", got)
+		}
+	}
+	if calls.Load() != 1 {
+		t.Errorf("GetAuthorizationToken called %d times, want 1", calls.Load())
+	}
+
+	// 上游返回 401 后丢弃 token 并重新获取
+	a.Invalidate()
+	authorize()
+	if calls.Load() != 2 {
+		t.Errorf("GetAuthorizationToken called %d times after Invalidate, want 2", calls.Load())
+	}
+}
@@ -0,0 +1,208 @@
+package proxy
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// =============================================================================
+// Google Artifact Registry / GCR 认证 - 服务账号密钥或 Workload Identity
+// =============================================================================
+
+const (
+	googleTokenURL      = "https://oauth2.googleapis.com/token"
+	googleCloudScope    = "https://www.googleapis.com/auth/cloud-platform"
+	googleMetadataToken = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+	// googleTokenRefreshWindow access token 过期前多久刷新
+	googleTokenRefreshWindow = 5 * time.Minute
+)
+
+// googleServiceAccountKey 服务账号 JSON 密钥中需要的字段
+type googleServiceAccountKey struct {
+	Type         string `json:"type"`
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// GARAuthenticator 使用 Google OAuth2 access token 访问 GAR / GCR
+// 两者的 Registry API 都直接接受 Bearer access token
+type GARAuthenticator struct {
+	key    *googleServiceAccountKey // 为 nil 时使用元数据服务（GCE / GKE Workload Identity）
+	signer *rsa.PrivateKey
+	client *http.Client
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// NewGARAuthenticator 创建认证器，keyFile 为空时使用元数据服务
+func NewGARAuthenticator(keyFile string, client *http.Client) (*GARAuthenticator, error) {
+	a := &GARAuthenticator{client: client}
+	if keyFile == "" {
+		return a, nil
+	}
+
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read service account key: %w", err)
+	}
+	var key googleServiceAccountKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("invalid service account key: %w", err)
+	}
+	if key.Type != "service_account" || key.ClientEmail == "" || key.PrivateKey == "" {
+		return nil, fmt.Errorf("credentials file is not a service account key")
+	}
+	if key.TokenURI == "" {
+		key.TokenURI = googleTokenURL
+	}
+
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("invalid service account private key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid service account private key: %w", err)
+	}
+	signer, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("service account private key is not RSA")
+	}
+
+	a.key = &key
+	a.signer = signer
+	return a, nil
+}
+
+// Authorize 设置 Bearer access token
+func (a *GARAuthenticator) Authorize(ctx context.Context, req *http.Request) error {
+	token, err := a.getToken(ctx)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return nil
+}
+
+// Invalidate 丢弃缓存的 token
+func (a *GARAuthenticator) Invalidate() {
+	a.mu.Lock()
+	a.token = ""
+	a.mu.Unlock()
+}
+
+func (a *GARAuthenticator) getToken(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.token != "" && time.Now().Add(googleTokenRefreshWindow).Before(a.expiresAt) {
+		return a.token, nil
+	}
+
+	var token string
+	var expiresIn int
+	var err error
+	if a.key != nil {
+		token, expiresIn, err = a.exchangeJWT(ctx)
+	} else {
+		token, expiresIn, err = a.fetchMetadataToken(ctx)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	a.token = token
+	a.expiresAt = time.Now().Add(time.Duration(expiresIn) * time.Second)
+	return token, nil
+}
+
+// googleTokenResponse OAuth2 token 响应
+type googleTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// exchangeJWT 用服务账号签名的 JWT 换取 access token（RFC 7523）
+func (a *GARAuthenticator) exchangeJWT(ctx context.Context) (string, int, error) {
+	now := time.Now()
+	header := map[string]string{"alg": "RS256", "typ": "JWT", "kid": a.key.PrivateKeyID}
+	claims := map[string]interface{}{
+		"iss":   a.key.ClientEmail,
+		"scope": googleCloudScope,
+		"aud":   a.key.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	}
+	headerJSON, _ := json.Marshal(header)
+	claimsJSON, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.signer, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to sign JWT: %w", err)
+	}
+	assertion := signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", assertion)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", a.key.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return a.doTokenRequest(req)
+}
+
+// fetchMetadataToken 从 GCE / GKE 元数据服务获取默认服务账号的 token
+func (a *GARAuthenticator) fetchMetadataToken(ctx context.Context) (string, int, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", googleMetadataToken, nil)
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	return a.doTokenRequest(req)
+}
+
+func (a *GARAuthenticator) doTokenRequest(req *http.Request) (string, int, error) {
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("google token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("google token request status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var tr googleTokenResponse
+	if err := json.Unmarshal(body, &tr); err != nil || tr.AccessToken == "" {
+		return "", 0, fmt.Errorf("invalid google token response")
+	}
+	if tr.ExpiresIn <= 0 {
+		tr.ExpiresIn = 3600
+	}
+	return tr.AccessToken, tr.ExpiresIn, nil
+}
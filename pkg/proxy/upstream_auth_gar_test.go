@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestGARAuthenticatorExchangesSignedJWT(t *testing.T) {
+	signer, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// token 端点校验 JWT 签名与声明
+	var calls atomic.Int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		r.ParseForm()
+		parts := strings.Split(r.PostForm.Get("assertion"), ".")
+		if r.PostForm.Get("grant_type") != "urn:ietf:params:oauth:grant-type:jwt-bearer" || len(parts) != 3 {
+			http.Error(w, "bad grant", http.StatusBadRequest)
+			return
+		}
+		signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if rsa.VerifyPKCS1v15(&signer.PublicKey, crypto.SHA256, digest[:], signature) != nil {
+			http.Error(w, "bad signature", http.StatusUnauthorized)
+			return
+		}
+		claimsJSON, _ := base64.RawURLEncoding.DecodeString(parts[1])
+		var claims map[string]any
+		json.Unmarshal(claimsJSON, &claims)
+		if claims["iss"] != "proxy@example.iam.gserviceaccount.com" || claims["scope"] != googleCloudScope {
+			http.Error(w, "bad claims", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(googleTokenResponse{AccessToken: "ya29.test", ExpiresIn: 3600})
+	}))
+	t.Cleanup(tokenServer.Close)
+
+	der, _ := x509.MarshalPKCS8PrivateKey(signer)
+	key, _ := json.Marshal(googleServiceAccountKey{
+		Type:         "service_account",
+		ClientEmail:  "proxy@example.iam.gserviceaccount.com",
+		PrivateKeyID: "key-1",
+		PrivateKey:   string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		TokenURI:     tokenServer.URL,
+	})
+	keyFile := filepath.Join(t.TempDir(), "key.json")
+	os.WriteFile(keyFile, key, 0o600)
+
+	a, err := NewGARAuthenticator(keyFile, tokenServer.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		req, _ := http.NewRequest("GET", "https://us-docker.pkg.dev/v2/", nil)
+		if err := a.Authorize(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+		if got := req.Header.Get("Authorization"); got != "Bearer ya29.test" {
+			t.Errorf("Authorization = %q", got)
+		}
+	}
+	if calls.Load() != 1 {
+		t.Errorf("token endpoint called %d times, want 1", calls.Load())
+	}
+}
+
+func TestNewGARAuthenticatorRejectsInvalidKey(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "key.json")
+	os.WriteFile(keyFile, []byte(`{"type": "authorized_user", "client_email": "a@b", "private_key": "x"}`), 0o600)
+	if _, err := NewGARAuthenticator(keyFile, nil); err == nil {
+		t.Error("accepted a non service account credentials file")
+	}
+}
@@ -0,0 +1,87 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+// stubAuthenticator 以固定 token 访问上游，记录 Invalidate 次数
+type stubAuthenticator struct {
+	mu          sync.Mutex
+	token       string
+	invalidated int
+}
+
+func (a *stubAuthenticator) Authorize(ctx context.Context, req *http.Request) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	req.Header.Set("Authorization", "Bearer "+a.token)
+	return nil
+}
+
+func (a *stubAuthenticator) Invalidate() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.invalidated++
+}
+
+func TestPrivateUpstreamUsesProxyCredentials(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	upstream.addImage("team/app", "v1", []byte("layer"))
+	p, client := newTestProxy(t, upstream, nil)
+	auth := &stubAuthenticator{token: "fake-token"}
+	u, _ := url.Parse(upstream.server.URL)
+	p.current().upstreamAuth[u.Host] = auth
+
+	// 客户端无需登录，客户端凭据不会转发给私有上游
+	manifestPath := "/v2/team/app/manifests/v1"
+	header := http.Header{"Accept": {fakeManifestType}, "Authorization": {"Bearer client-token"}}
+	if resp, body := client.do("GET", manifestPath, header); resp.StatusCode != http.StatusOK {
+		t.Fatalf("manifest from private upstream: status %d: %s", resp.StatusCode, body)
+	}
+	if got := upstream.header("GET", manifestPath).Get("Authorization"); got != "Bearer fake-token" {
+		t.Errorf("upstream Authorization = %q", got)
+	}
+
+	// 上游拒绝 token 时丢弃缓存的 token
+	auth.mu.Lock()
+	auth.token = "expired-token"
+	auth.mu.Unlock()
+	if resp, _ := client.do("GET", "/v2/team/app/manifests/v2", header); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("rejected token: status %d, want 401", resp.StatusCode)
+	}
+	auth.mu.Lock()
+	defer auth.mu.Unlock()
+	if auth.invalidated == 0 {
+		t.Error("authenticator was not invalidated after a 401")
+	}
+}
+
+func TestParseNamedHosts(t *testing.T) {
+	got := parseNamedHosts(" prod = https://123.dkr.ecr.us-east-1.amazonaws.com/ ,gar=europe-docker.pkg.dev,broken,=host,empty=")
+	want := map[string]string{"prod": "123.dkr.ecr.us-east-1.amazonaws.com", "gar": "europe-docker.pkg.dev"}
+	if len(got) != len(want) || got["prod"] != want["prod"] || got["gar"] != want["gar"] {
+		t.Errorf("parseNamedHosts = %v, want %v", got, want)
+	}
+}
+
+func TestBuildUpstreamAuthRegistersRoutes(t *testing.T) {
+	config := &Config{
+		CustomDomain: "example.test",
+		Routes:       map[string]string{},
+		ACRRoutes:    map[string]string{"acr": "example.azurecr.io"},
+		ECRRoutes:    map[string]string{"bad": "registry.example.com"},
+	}
+	auth := buildUpstreamAuth(config, http.DefaultTransport)
+
+	if config.Routes["acr.example.test"] != "https://example.azurecr.io" || auth["example.azurecr.io"] == nil {
+		t.Errorf("ACR route not registered: routes %v", config.Routes)
+	}
+	// 无法解析的 ECR 地址被跳过
+	if _, ok := config.Routes["bad.example.test"]; ok || len(auth) != 1 {
+		t.Errorf("invalid ECR route registered: routes %v", config.Routes)
+	}
+}
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// =============================================================================
+// 级联代理 - 路由的上游是另一个 go-docker-proxy 实例（边缘 → 区域 → 源站）。
+// 上游响应的 X-Cache 改写为 X-Cache-Upstream（逗号分隔，由近及远），
+// 边缘节点据此区分区域节点命中与回源，并按上游统计命中情况
+// =============================================================================
+
+// headerCacheUpstream 上游各级代理的缓存状态
+const headerCacheUpstream = "X-Cache-Upstream"
+
+// registerChainedRoutes 按 ChainedRouteEntries（CHAINED_ROUTES，name=上游代理地址），注册 {name}.{CUSTOM_DOMAIN} 路由
+// （可覆盖内置路由，如 docker=https://docker.regional.example.com），上游代理的 host 记录在 ChainedUpstreams
+func registerChainedRoutes(config *Config) {
+	chained := make(map[string]bool)
+	for _, entry := range config.ChainedRouteEntries {
+		name, upstream, ok := strings.Cut(entry, "=")
+		name, upstream = strings.TrimSpace(name), strings.TrimSuffix(strings.TrimSpace(upstream), "/")
+		if !strings.HasPrefix(upstream, "http://") && !strings.HasPrefix(upstream, "https://") {
+			upstream = "https://" + upstream
+		}
+		u, err := url.Parse(upstream)
+		if !ok || name == "" || err != nil || u.Host == "" {
+			log.Printf("Ignoring invalid CHAINED_ROUTES entry %q (expected name=https://proxy.example.com)", entry)
+			continue
+		}
+		routeHost := name + "." + config.CustomDomain
+		config.Routes[routeHost] = u.Scheme + "://" + u.Host
+		chained[u.Host] = true
+		log.Printf("Chained proxy route: %s -> %s", routeHost, u.Host)
+	}
+	config.ChainedUpstreams = chained
+}
+
+// chainStats 各上游代理返回的缓存状态统计
+type chainStats struct {
+	mu        sync.Mutex
+	responses map[[2]string]int64 // [上游, 缓存状态] -> 响应数
+}
+
+func newChainStats() *chainStats {
+	return &chainStats{responses: make(map[[2]string]int64)}
+}
+
+// observeChainedResponse 上游是级联代理时，把其 X-Cache 与 X-Cache-Upstream 合并为 X-Cache-Upstream 并计数；
+// 其他上游的响应不做修改
+func (p *ProxyServer) observeChainedResponse(host string, resp *http.Response) {
+	if !p.current().chainedUpstreams[host] {
+		return
+	}
+	state := resp.Header.Get("X-Cache")
+	if state == "" {
+		state = "NONE" // 未经过缓存的响应（如认证挑战、错误）
+	}
+	chain := state
+	if further := resp.Header.Get(headerCacheUpstream); further != "" {
+		chain += ", " + further
+	}
+	resp.Header.Del("X-Cache")
+	resp.Header.Set(headerCacheUpstream, chain)
+
+	p.chainStats.mu.Lock()
+	p.chainStats.responses[[2]string{host, state}]++
+	p.chainStats.mu.Unlock()
+}
+
+// writeMetrics 输出级联代理指标
+func (s *chainStats) writeMetrics(m *metricsWriter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range sortedPairs(s.responses) {
+		m.counter("docker_proxy_chained_upstream_responses_total", "Responses from chained upstream proxies by their cache state (HIT, MISS, STALE, BYPASS or NONE)",
+			float64(s.responses[key]), "upstream", key[0], "cache", key[1])
+	}
+}
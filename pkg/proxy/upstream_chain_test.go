@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+// TestChainedProxy 覆盖级联代理：边缘节点经区域节点回源，区域节点的缓存状态以 X-Cache-Upstream 返回并计入指标
+func TestChainedProxy(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	upstream.addImage("team/app", "v1", []byte("chained layer"))
+	// DEBUG 下认证挑战的 realm 保留端口，边缘节点才能向测试端口上的区域节点申请 token
+	regional, regionalClient := newTestProxy(t, upstream, map[string]string{"DEBUG": "true"})
+	// 边缘节点按上游地址（127.0.0.1:端口）访问区域节点
+	regional.current().routes["127.0.0.1"] = upstream.server.URL
+
+	pullVia := func(name string) *http.Response {
+		t.Helper()
+		_, edge := newTestProxy(t, &fakeRegistry{server: &httptest.Server{URL: regionalClient.base}},
+			map[string]string{"CHAINED_ROUTES": "regional=" + regionalClient.base})
+		edge.login("team/app")
+		resp, body := edge.do("GET", "/v2/team/app/manifests/v1", http.Header{"Accept": {fakeManifestType}})
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: GET manifest: status %d: %s", name, resp.StatusCode, body)
+		}
+		if got := resp.Header.Get("X-Cache"); got != "MISS" {
+			t.Errorf("%s: X-Cache = %q, want MISS", name, got)
+		}
+		return resp
+	}
+
+	if got := pullVia("first edge").Header.Get(headerCacheUpstream); got != "MISS" {
+		t.Errorf("first edge: X-Cache-Upstream = %q, want MISS", got)
+	}
+	regionalKey := cache.CacheKey(strings.TrimPrefix(regionalClient.base, "http://"), "/v2/team/app/manifests/v1")
+	eventually(t, "regional manifest cache fill", func() bool {
+		_, found := regional.cacheManager.Get(regionalKey)
+		return found
+	})
+	if got := pullVia("second edge").Header.Get(headerCacheUpstream); got != "HIT" {
+		t.Errorf("second edge: X-Cache-Upstream = %q, want HIT", got)
+	}
+	if n := upstream.count(http.MethodGet, "/v2/team/app/manifests/v1"); n != 1 {
+		t.Errorf("origin manifest requests = %d, want 1", n)
+	}
+}
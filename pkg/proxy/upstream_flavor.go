@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// =============================================================================
+// 上游类型 - 按仓库实现处理已知差异：Docker Hub 官方镜像的 library/ 补全、
+// Harbor 项目与 Artifactory 仓库 key 的路径前缀（请求路径与 token scope 同时加前缀）、
+// GitLab / Quay 的多级路径原样传递，无需手写 scope 重写规则
+// =============================================================================
+
+// 上游类型
+const (
+	FlavorDockerHub   = "dockerhub"
+	FlavorHarbor      = "harbor"
+	FlavorArtifactory = "artifactory"
+	FlavorGitLab      = "gitlab"
+	FlavorQuay        = "quay"
+)
+
+// knownFlavors 支持的上游类型，值表示是否接受路径前缀
+var knownFlavors = map[string]bool{
+	FlavorDockerHub:   false,
+	FlavorHarbor:      true,
+	FlavorArtifactory: true,
+	FlavorGitLab:      false,
+	FlavorQuay:        false,
+}
+
+// defaultFlavors 未在 UPSTREAM_FLAVORS 中指定时按上游 host 识别的类型
+var defaultFlavors = map[string]UpstreamFlavor{
+	"registry-1.docker.io": {Name: FlavorDockerHub},
+	"quay.io":              {Name: FlavorQuay},
+	"registry.gitlab.com":  {Name: FlavorGitLab},
+}
+
+// UpstreamFlavor 上游仓库的类型与路径前缀
+type UpstreamFlavor struct {
+	Name   string // 空表示通用 Registry，不做特殊处理
+	Prefix string // 仓库路径前缀：Harbor 项目（含代理缓存项目）或 Artifactory 仓库 key
+}
+
+// String 用于日志与 check 输出
+func (f UpstreamFlavor) String() string {
+	if f.Prefix != "" {
+		return f.Name + " (prefix " + f.Prefix + ")"
+	}
+	return f.Name
+}
+
+// parseUpstreamFlavors 解析 UPSTREAM_FLAVORS（上游host=类型[:前缀]，逗号分隔）
+func parseUpstreamFlavors(entries []string) map[string]UpstreamFlavor {
+	if len(entries) == 0 {
+		return nil
+	}
+	flavors := make(map[string]UpstreamFlavor)
+	for _, entry := range entries {
+		host, flavor, ok := parseUpstreamFlavor(entry)
+		if !ok {
+			log.Printf("Ignoring invalid UPSTREAM_FLAVORS entry %q (expected host=dockerhub|harbor[:project]|artifactory[:repo-key]|gitlab|quay)", entry)
+			continue
+		}
+		flavors[host] = flavor
+	}
+	return flavors
+}
+
+// parseUpstreamFlavor 解析单个上游的类型，只有 harbor 与 artifactory 接受前缀
+func parseUpstreamFlavor(entry string) (string, UpstreamFlavor, bool) {
+	host, spec, ok := strings.Cut(entry, "=")
+	host = strings.ToLower(strings.TrimSpace(host))
+	name, prefix, _ := strings.Cut(strings.TrimSpace(spec), ":")
+	name, prefix = strings.ToLower(strings.TrimSpace(name)), strings.Trim(strings.TrimSpace(prefix), "/")
+	acceptsPrefix, known := knownFlavors[name]
+	if !ok || host == "" || !known || (prefix != "" && !acceptsPrefix) {
+		return "", UpstreamFlavor{}, false
+	}
+	return host, UpstreamFlavor{Name: name, Prefix: prefix}, true
+}
+
+// flavorFor 返回上游地址对应的类型：先查 UPSTREAM_FLAVORS，再按内置 host 识别
+func (p *ProxyServer) flavorFor(upstream string) UpstreamFlavor {
+	host := upstream
+	if u, err := url.Parse(upstream); err == nil && u.Host != "" {
+		host = u.Host
+	}
+	host = strings.ToLower(host)
+	if flavor, ok := p.current().flavors[host]; ok {
+		return flavor
+	}
+	return defaultFlavors[host]
+}
+
+// repository 客户端看到的仓库名对应的上游仓库名
+func (f UpstreamFlavor) repository(repo string) string {
+	if f.Prefix == "" {
+		return repo
+	}
+	return f.Prefix + "/" + repo
+}
+
+// upstreamPath 客户端请求路径对应的上游路径：/v2/{repo}/... 加上仓库前缀，/v2/ 与 /v2/_catalog 不变
+func (f UpstreamFlavor) upstreamPath(path string) string {
+	rest, ok := strings.CutPrefix(path, "/v2/")
+	if f.Prefix == "" || !ok || rest == "" || strings.HasPrefix(rest, "_catalog") {
+		return path
+	}
+	return "/v2/" + f.repository(rest)
+}
+
+// rewriteScope token scope 中的仓库名加上前缀（repository:{name}:{actions}，多个 scope 以空格分隔）
+func (f UpstreamFlavor) rewriteScope(scope string) string {
+	if f.Prefix == "" || scope == "" {
+		return scope
+	}
+	scopes := strings.Fields(scope)
+	for i, item := range scopes {
+		if name, ok := strings.CutPrefix(item, "repository:"); ok {
+			scopes[i] = "repository:" + f.repository(name)
+		}
+	}
+	return strings.Join(scopes, " ")
+}
+
+// rewriteResponse 去掉分页 Link 等响应头中的仓库前缀，客户端按原路径继续请求
+func (f UpstreamFlavor) rewriteResponse(resp *http.Response) {
+	if f.Prefix == "" {
+		return
+	}
+	if link := resp.Header.Get("Link"); link != "" {
+		resp.Header.Set("Link", strings.ReplaceAll(link, "/v2/"+f.Prefix+"/", "/v2/"))
+	}
+}
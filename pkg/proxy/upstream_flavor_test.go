@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestUpstreamFlavorPrefix 覆盖 Harbor / Artifactory 类型的仓库前缀：请求路径与 token scope 加上前缀，
+// 分页 Link 去掉前缀，缓存仍按客户端路径保存
+func TestUpstreamFlavorPrefix(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	_, layers := upstream.addImage("dockerhub-proxy/team/app", "v1", []byte("harbor layer"))
+	upstreamHost := strings.TrimPrefix(upstream.server.URL, "http://")
+	p, client := newTestProxy(t, upstream, map[string]string{"UPSTREAM_FLAVORS": upstreamHost + "=harbor:dockerhub-proxy"})
+
+	client.login("team/app")
+	if scopes := upstream.tokenScopes(); len(scopes) == 0 || scopes[len(scopes)-1] != "repository:dockerhub-proxy/team/app:pull" {
+		t.Errorf("token scopes = %q, want the project prefix", scopes)
+	}
+	client.pull("team/app", "v1")
+	if n := upstream.count(http.MethodGet, "/v2/dockerhub-proxy/team/app/manifests/v1"); n != 1 {
+		t.Errorf("upstream manifest requests = %d, want 1", n)
+	}
+	if n := upstream.count(http.MethodGet, "/v2/dockerhub-proxy/team/app/blobs/"+layers[0]); n != 1 {
+		t.Errorf("upstream blob requests = %d, want 1", n)
+	}
+	waitCached(t, p, "team/app", "v1", layers)
+
+	resp := &http.Response{Header: http.Header{"Link": {`</v2/dockerhub-proxy/team/app/tags/list?last=v1&n=1>; rel="next"`}}}
+	p.flavorFor(upstream.server.URL).rewriteResponse(resp)
+	if got := resp.Header.Get("Link"); got != `</v2/team/app/tags/list?last=v1&n=1>; rel="next"` {
+		t.Errorf("Link = %q", got)
+	}
+}
+
+func TestGitLabNestedRepository(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	_, layers := upstream.addImage("group/subgroup/project/image", "v1", []byte("gitlab layer"))
+	upstreamHost := strings.TrimPrefix(upstream.server.URL, "http://")
+	p, client := newTestProxy(t, upstream, map[string]string{"UPSTREAM_FLAVORS": upstreamHost + "=gitlab"})
+
+	if route := buildRoutes("example.com")["gitlab.example.com"]; route != "https://registry.gitlab.com" {
+		t.Errorf("gitlab route = %q", route)
+	}
+
+	client.login("group/subgroup/project/image")
+	if scopes := upstream.tokenScopes(); len(scopes) == 0 || scopes[len(scopes)-1] != "repository:group/subgroup/project/image:pull" {
+		t.Errorf("token scopes = %q, want the nested path unchanged", scopes)
+	}
+	client.pull("group/subgroup/project/image", "v1")
+	waitCached(t, p, "group/subgroup/project/image", "v1", layers)
+
+	// 多个 scope 分别作为 scope 参数发送给 token 服务，而不是以空格连接
+	before := len(upstream.tokenScopes())
+	resp, _ := client.do(http.MethodGet, "/v2/auth?scope=repository:group/subgroup/project/image:pull&scope=repository:group/other/image:pull", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("auth status = %d", resp.StatusCode)
+	}
+	want := []string{"repository:group/subgroup/project/image:pull", "repository:group/other/image:pull"}
+	if got := upstream.tokenScopes()[before:]; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("token scopes = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,240 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+)
+
+// =============================================================================
+// 上游健康检查 - 定期探测各上游 /v2/，记录可用性与延迟，用于深度健康检查与故障转移
+// =============================================================================
+
+// UpstreamStatus 单个上游的健康状态
+type UpstreamStatus struct {
+	Upstream            string        `json:"upstream"`
+	Healthy             bool          `json:"healthy"`
+	StatusCode          int           `json:"statusCode,omitempty"`
+	Latency             time.Duration `json:"-"`
+	LatencyMs           float64       `json:"latencyMs"`
+	AvgLatencyMs        float64       `json:"avgLatencyMs"`
+	ConsecutiveFailures int           `json:"consecutiveFailures"`
+	Checks              int64         `json:"checks"`
+	Failures            int64         `json:"failures"`
+	LastError           string        `json:"lastError,omitempty"`
+	LastCheck           time.Time     `json:"lastCheck"`
+	LastSuccess         *time.Time    `json:"lastSuccess,omitempty"`
+}
+
+// UpstreamHealth 上游健康检查器，nil 表示未启用（所有上游视为健康）
+type UpstreamHealth struct {
+	p         *ProxyServer
+	interval  time.Duration
+	timeout   time.Duration
+	threshold int // 连续失败多少次判定为不健康
+
+	mu       sync.RWMutex
+	statuses map[string]*UpstreamStatus // 上游 host -> 状态
+	targets  map[string]string          // 上游 host -> URL
+}
+
+// NewUpstreamHealth 创建健康检查器，UpstreamHealthInterval <= 0 时返回 nil
+func NewUpstreamHealth(p *ProxyServer) *UpstreamHealth {
+	interval := p.config.UpstreamHealthInterval
+	if interval <= 0 {
+		return nil
+	}
+
+	h := &UpstreamHealth{
+		p:         p,
+		interval:  interval,
+		timeout:   p.config.UpstreamHealthTimeout,
+		threshold: p.config.UpstreamHealthThreshold,
+		statuses:  make(map[string]*UpstreamStatus),
+		targets:   make(map[string]string),
+	}
+	if h.threshold < 1 {
+		h.threshold = 1
+	}
+
+	upstreams := make([]string, 0, len(p.config.Routes))
+	for _, upstream := range p.config.Routes {
+		upstreams = append(upstreams, upstream)
+	}
+	for _, mirrors := range p.config.Mirrors {
+		upstreams = append(upstreams, mirrors...)
+	}
+	for _, split := range p.config.UpstreamSplits {
+		upstreams = append(upstreams, split.Upstream)
+	}
+	for _, upstream := range upstreams {
+		u, err := url.Parse(upstream)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		h.targets[u.Host] = upstream
+		// 首次探测前视为健康
+		h.statuses[u.Host] = &UpstreamStatus{Upstream: upstream, Healthy: true}
+	}
+
+	log.Printf("Upstream health checks enabled: %d upstreams every %s", len(h.targets), interval)
+	return h
+}
+
+// Run 周期性探测所有上游，直到 ctx 结束
+func (h *UpstreamHealth) Run(ctx context.Context) {
+	if h == nil {
+		return
+	}
+
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		h.checkAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *UpstreamHealth) checkAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for host, upstream := range h.targets {
+		wg.Add(1)
+		go func(host, upstream string) {
+			defer wg.Done()
+			h.check(ctx, host, upstream)
+		}(host, upstream)
+	}
+	wg.Wait()
+}
+
+// check 探测 GET /v2/，任何非 5xx 响应（包括 401）都表示上游可用
+func (h *UpstreamHealth) check(ctx context.Context, host, upstream string) {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	start := time.Now()
+	statusCode := 0
+	req, err := http.NewRequestWithContext(ctx, "GET", upstream+"/v2/", nil)
+	if err == nil {
+		h.p.setUserAgent(req)
+		h.p.authorizeUpstream(req)
+		var resp *http.Response
+		if resp, err = h.p.transport.RoundTrip(req); err == nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+			statusCode = resp.StatusCode
+			if statusCode >= 500 {
+				err = fmt.Errorf("status %d", statusCode)
+			}
+		}
+	}
+	latency := time.Since(start)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	status := h.statuses[host]
+	wasHealthy := status.Healthy
+	status.Checks++
+	status.LastCheck = time.Now()
+	status.StatusCode = statusCode
+	status.Latency = latency
+	status.LatencyMs = float64(latency.Microseconds()) / 1000
+	if status.AvgLatencyMs == 0 {
+		status.AvgLatencyMs = status.LatencyMs
+	} else {
+		status.AvgLatencyMs = status.AvgLatencyMs*0.8 + status.LatencyMs*0.2
+	}
+
+	if err != nil {
+		status.Failures++
+		status.ConsecutiveFailures++
+		status.LastError = err.Error()
+		if status.ConsecutiveFailures >= h.threshold {
+			status.Healthy = false
+		}
+	} else {
+		status.ConsecutiveFailures = 0
+		status.LastError = ""
+		lastSuccess := status.LastCheck
+		status.LastSuccess = &lastSuccess
+		status.Healthy = true
+	}
+
+	if wasHealthy != status.Healthy {
+		if status.Healthy {
+			log.Printf("Upstream %s is healthy again", host)
+		} else {
+			log.Printf("Upstream %s marked unhealthy after %d failed checks: %s", host, status.ConsecutiveFailures, status.LastError)
+		}
+	}
+}
+
+// Healthy 判断上游 host 是否健康，未启用或未知的上游视为健康
+func (h *UpstreamHealth) Healthy(host string) bool {
+	if h == nil {
+		return true
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	status, ok := h.statuses[host]
+	return !ok || status.Healthy
+}
+
+// Statuses 所有上游的状态快照（按 host 排序）
+func (h *UpstreamHealth) Statuses() []UpstreamStatus {
+	h.mu.RLock()
+	result := make([]UpstreamStatus, 0, len(h.statuses))
+	for _, status := range h.statuses {
+		result = append(result, *status)
+	}
+	h.mu.RUnlock()
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Upstream < result[j].Upstream })
+	return result
+}
+
+// Summary 深度健康检查结果：全部健康为 healthy，部分不健康为 degraded，全部不健康为 unhealthy
+func (h *UpstreamHealth) Summary() (string, []UpstreamStatus) {
+	statuses := h.Statuses()
+	unhealthy := 0
+	for _, status := range statuses {
+		if !status.Healthy {
+			unhealthy++
+		}
+	}
+	switch {
+	case unhealthy == 0:
+		return "healthy", statuses
+	case unhealthy < len(statuses):
+		return "degraded", statuses
+	}
+	return "unhealthy", statuses
+}
+
+// writeMetrics 输出上游健康指标
+func (h *UpstreamHealth) writeMetrics(m *metricsWriter) {
+	statuses := h.Statuses()
+	for _, status := range statuses {
+		up := 0.0
+		if status.Healthy {
+			up = 1
+		}
+		m.gauge("docker_proxy_upstream_up", "Whether the upstream passed its recent health checks", up, "upstream", status.Upstream)
+	}
+	for _, status := range statuses {
+		m.gauge("docker_proxy_upstream_probe_latency_seconds", "Latency of the last upstream health probe", status.Latency.Seconds(), "upstream", status.Upstream)
+	}
+	for _, status := range statuses {
+		m.counter("docker_proxy_upstream_probe_failures_total", "Failed upstream health probes", float64(status.Failures), "upstream", status.Upstream)
+	}
+}
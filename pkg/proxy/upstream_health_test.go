@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestUpstreamHealthChecks(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	p, client := newTestProxy(t, upstream, map[string]string{
+		"UPSTREAM_HEALTH_INTERVAL":  "1h",
+		"UPSTREAM_HEALTH_THRESHOLD": "2",
+	})
+	host := strings.TrimPrefix(upstream.server.URL, "http://")
+	h := p.upstreamHealth
+
+	// 401 也表示上游可用
+	h.checkAll(context.Background())
+	if !h.Healthy(host) {
+		t.Fatalf("upstream unhealthy after a 401 probe: %+v", h.Statuses())
+	}
+
+	// 连续失败达到阈值才判定为不健康
+	// Transport 会对复用连接上的失败自动重试一次，断开足够多的连接保证两次探测都失败
+	upstream.configure(func(f *fakeRegistry) { f.dropConnections = 100 })
+	h.checkAll(context.Background())
+	if !h.Healthy(host) {
+		t.Error("upstream unhealthy after one failed probe")
+	}
+	h.checkAll(context.Background())
+	if h.Healthy(host) {
+		t.Error("upstream healthy after two failed probes")
+	}
+	if summary, _ := h.Summary(); summary != "unhealthy" {
+		t.Errorf("summary = %q, want unhealthy", summary)
+	}
+
+	resp, body := client.do("GET", "/metrics", nil)
+	for _, want := range []string{
+		`docker_proxy_upstream_up{upstream="` + upstream.server.URL + `"} 0`,
+		`docker_proxy_upstream_probe_failures_total{upstream="` + upstream.server.URL + `"} 2`,
+		"# TYPE docker_proxy_upstream_up gauge",
+	} {
+		if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), want) {
+			t.Errorf("/metrics (status %d) missing %q", resp.StatusCode, want)
+		}
+	}
+
+	upstream.configure(func(f *fakeRegistry) { f.dropConnections = 0 })
+	h.checkAll(context.Background())
+	if !h.Healthy(host) {
+		t.Error("upstream still unhealthy after a successful probe")
+	}
+}
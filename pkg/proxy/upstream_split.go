@@ -0,0 +1,139 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+// =============================================================================
+// 蓝绿切换 - 路由按权重把 manifest / blob 拉取分流到新上游（如从 Docker Hub 逐步迁移到内部 Harbor）。
+// 分流按 仓库@引用 的哈希决定：同一 tag 或 digest 在同一权重下总是走同一上游，
+// 调高权重只会把更多引用从主上游移到新上游；新上游缺失内容或返回的 digest 与请求不符时回退主上游
+// =============================================================================
+
+// UpstreamSplit 路由的分流设置
+type UpstreamSplit struct {
+	Upstream string // 新上游地址
+	Weight   int    // 分流到新上游的百分比（0-100）
+}
+
+// parseUpstreamSplits 解析 UPSTREAM_SPLITS（路由名=新上游地址;百分比，逗号分隔），返回 路由域名 -> 分流设置
+//
+//	UPSTREAM_SPLITS="docker=https://harbor.example.com;20"
+func parseUpstreamSplits(entries []string, customDomain string) map[string]UpstreamSplit {
+	splits := make(map[string]UpstreamSplit)
+	for _, entry := range entries {
+		name, spec, ok := strings.Cut(entry, "=")
+		upstream, weight, hasWeight := strings.Cut(spec, ";")
+		name, upstream = strings.ToLower(strings.TrimSpace(name)), strings.TrimSuffix(strings.TrimSpace(upstream), "/")
+		if !strings.HasPrefix(upstream, "http://") && !strings.HasPrefix(upstream, "https://") {
+			upstream = "https://" + upstream
+		}
+		u, err := url.Parse(upstream)
+		percent, weightErr := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(weight), "%"))
+		if !ok || !hasWeight || name == "" || err != nil || u.Host == "" || weightErr != nil || percent < 0 || percent > 100 {
+			log.Printf("Ignoring invalid UPSTREAM_SPLITS entry %q (expected name=https://registry.example.com;0-100)", entry)
+			continue
+		}
+		splits[name+"."+customDomain] = UpstreamSplit{Upstream: u.Scheme + "://" + u.Host, Weight: percent}
+	}
+	return splits
+}
+
+// splitBucket 引用所在的分流桶（0-99）
+func splitBucket(repo, reference string) int {
+	h := fnv.New32a()
+	h.Write([]byte(repo + "@" + reference))
+	return int(h.Sum32() % 100)
+}
+
+// roundTripSplit 执行上游请求；路由配置了分流且引用落在新上游的桶内时，manifest / blob GET
+// 由新上游以代理自身身份匿名拉取，其余请求（含 Range 请求）以及新上游不可用时走主上游
+func (p *ProxyServer) roundTripSplit(r *http.Request, req *http.Request) (*http.Response, error) {
+	host := strings.ToLower(r.Host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	split, ok := p.current().splits[host]
+	pathType, repo, reference := cache.ParsePath(r.URL.Path)
+	if !ok || split.Weight == 0 || req.Method != http.MethodGet || req.Header.Get("Range") != "" ||
+		(pathType != "manifest" && pathType != "blob") || splitBucket(repo, reference) >= split.Weight {
+		return p.roundTripHedged(r, req)
+	}
+	if u, err := url.Parse(split.Upstream); err == nil && !p.upstreamHealth.Healthy(u.Host) {
+		p.routeStats.addSplit(host, false)
+		return p.roundTripHedged(r, req)
+	}
+
+	kind := "manifests"
+	if pathType == "blob" {
+		kind = "blobs"
+	}
+	resp, err := p.fetchFromUpstream(req.Context(), split.Upstream, repo, kind, reference, req.Header.Values("Accept"))
+	reason := splitFallbackReason(resp, err, reference)
+	if reason == "" && pathType == "manifest" {
+		reason = verifySplitManifest(resp, reference)
+	}
+	if reason != "" {
+		if resp != nil {
+			resp.Body.Close()
+		}
+		log.Printf("Split upstream %s could not serve %s (%s), falling back to primary", split.Upstream, r.URL.Path, reason)
+		p.routeStats.addSplit(host, false)
+		return p.roundTripHedged(r, req)
+	}
+	if isRedirect(resp.StatusCode) {
+		// 新上游的相对重定向地址按新上游解析，之后的重定向处理以主上游地址为基准
+		if location, err := resp.Request.URL.Parse(resp.Header.Get("Location")); err == nil {
+			resp.Header.Set("Location", location.String())
+		}
+	}
+	if p.config.Debug {
+		log.Printf("[DEBUG] Split request %s served by %s", r.URL.Path, split.Upstream)
+	}
+	p.routeStats.addSplit(host, true)
+	return resp, nil
+}
+
+// splitFallbackReason 新上游的响应不可采用时返回原因：只采用 200 与重定向（blob 可能重定向到对象存储），
+// digest 引用的响应必须与请求的 digest 一致
+func splitFallbackReason(resp *http.Response, err error, reference string) string {
+	if err != nil {
+		return err.Error()
+	}
+	if resp.StatusCode != http.StatusOK && !isRedirect(resp.StatusCode) {
+		return "status " + strconv.Itoa(resp.StatusCode)
+	}
+	if digest := resp.Header.Get("Docker-Content-Digest"); strings.HasPrefix(reference, "sha256:") && digest != "" && digest != reference {
+		return "digest mismatch " + digest
+	}
+	return ""
+}
+
+// verifySplitManifest 按 digest 拉取的 manifest 校验内容摘要，通过后替换为已读取的 body
+func verifySplitManifest(resp *http.Response, reference string) string {
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(reference, "sha256:") {
+		return ""
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCacheableSize))
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	if err != nil {
+		return err.Error()
+	}
+	if digest := fmt.Sprintf("sha256:%x", sha256.Sum256(data)); digest != reference {
+		return "digest mismatch " + digest
+	}
+	return ""
+}
@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestUpstreamSplit(t *testing.T) {
+	splits := parseUpstreamSplits([]string{"docker=harbor.example.com/;20", "quay=https://quay.example.com", "ghcr=https://ghcr.example.com;150"}, "example.com")
+	if len(splits) != 1 || splits["docker.example.com"] != (UpstreamSplit{Upstream: "https://harbor.example.com", Weight: 20}) {
+		t.Fatalf("splits = %+v", splits)
+	}
+
+	primary, secondary := newFakeRegistry(t), newFakeRegistry(t)
+	primary.addImage("library/alpine", "3.20", []byte("alpine layer"))
+	secondary.addImage("library/alpine", "3.20", []byte("alpine layer"))
+	primary.addImage("library/busybox", "1.36", []byte("busybox layer"))
+	nginx, _ := primary.addImage("library/nginx", "1.27", []byte("nginx layer"))
+	secondary.configure(func(f *fakeRegistry) { f.manifests["library/nginx:"+nginx] = []byte(`{"schemaVersion":2}`) })
+
+	p, client := newTestProxy(t, primary, nil)
+	p.current().splits = map[string]UpstreamSplit{testRegistryHost: {Upstream: secondary.server.URL, Weight: 100}}
+	client.login("library/alpine")
+
+	// 新上游拥有的内容全部由新上游响应
+	client.pull("library/alpine", "3.20")
+	if secondary.count("GET", "/v2/library/alpine/manifests/3.20") == 0 || primary.count("GET", "/v2/library/alpine/manifests/3.20") != 0 {
+		t.Errorf("alpine manifest requests: secondary %d, primary %d",
+			secondary.count("GET", "/v2/library/alpine/manifests/3.20"), primary.count("GET", "/v2/library/alpine/manifests/3.20"))
+	}
+
+	// 新上游缺失的镜像回退主上游
+	client.pull("library/busybox", "1.36")
+	if primary.count("GET", "/v2/library/busybox/manifests/1.36") != 1 {
+		t.Errorf("busybox manifest not fetched from primary")
+	}
+
+	// 新上游按 digest 返回的内容与 digest 不符时回退主上游
+	resp, body := client.do("GET", "/v2/library/nginx/manifests/"+nginx, http.Header{"Accept": {fakeManifestType}})
+	if resp.StatusCode != http.StatusOK || fakeDigest(body) != nginx {
+		t.Fatalf("nginx manifest: status %d, digest %s", resp.StatusCode, fakeDigest(body))
+	}
+
+	c := p.routeStats.get(testRegistryHost)
+	if c.SplitServed != 3 || c.SplitFallbacks != 4 {
+		t.Errorf("split served %d, fallbacks %d; want 3 and 4", c.SplitServed, c.SplitFallbacks)
+	}
+}
@@ -0,0 +1,216 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// =============================================================================
+// 上游 TLS 握手设置 - 按上游域名调整 ClientHello：SNI、ALPN、TLS 版本、椭圆曲线、TLS 1.2 密码套件，
+// 以及 Encrypted Client Hello（ECH）。用于按 SNI 阻断 docker.io 等域名的网络：
+// ECH 把真实域名加密在内层 ClientHello 中，外层只暴露 CDN 的公共名称；
+// sni 改为发送另一域名（证书按该域名校验），适用于同一 CDN 上的域前置
+// =============================================================================
+
+// TLSProfile 上游连接的 ClientHello 设置，零值字段沿用默认
+type TLSProfile struct {
+	ServerName string        // 发送的 SNI 并按其校验证书（为空时使用上游域名）
+	ALPN       []string      // ALPN 协议列表，如 h2、http/1.1
+	MinVersion uint16        // 最低 TLS 版本
+	MaxVersion uint16        // 最高 TLS 版本
+	Curves     []tls.CurveID // 支持的椭圆曲线
+	Ciphers    []uint16      // TLS 1.2 密码套件（TLS 1.3 的套件不可配置）
+	ECH        []byte        // ECHConfigList（DNS HTTPS 记录中 ech= 参数的 base64 内容）
+}
+
+var (
+	tlsVersionNames = map[string]uint16{"1.0": tls.VersionTLS10, "1.1": tls.VersionTLS11, "1.2": tls.VersionTLS12, "1.3": tls.VersionTLS13}
+	tlsCurveNames   = map[string]tls.CurveID{"x25519": tls.X25519, "p256": tls.CurveP256, "p384": tls.CurveP384, "p521": tls.CurveP521}
+)
+
+// parseTLSProfiles 解析 UPSTREAM_TLS_PROFILES：
+// host=sni:cdn.example.com;alpn:h2|http/1.1;min:1.2;max:1.3;curves:x25519|p256;ciphers:名称|名称;ech:base64（逗号分隔）
+func parseTLSProfiles(entries []string) (map[string]TLSProfile, error) {
+	profiles := make(map[string]TLSProfile)
+	for _, entry := range entries {
+		host, spec, ok := strings.Cut(entry, "=")
+		host = strings.ToLower(strings.TrimSpace(host))
+		if !ok || host == "" || strings.TrimSpace(spec) == "" {
+			return nil, fmt.Errorf("%q must be host=key:value;...", entry)
+		}
+		var profile TLSProfile
+		for _, item := range strings.Split(spec, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(item), ":")
+			if !ok {
+				return nil, fmt.Errorf("%s: %q must be key:value", host, item)
+			}
+			value = strings.TrimSpace(value)
+			var err error
+			switch strings.TrimSpace(key) {
+			case "sni":
+				profile.ServerName = value
+			case "alpn":
+				profile.ALPN = strings.Split(value, "|")
+			case "min":
+				profile.MinVersion, err = parseTLSVersion(value)
+			case "max":
+				profile.MaxVersion, err = parseTLSVersion(value)
+			case "curves":
+				profile.Curves, err = parseTLSCurves(value)
+			case "ciphers":
+				profile.Ciphers, err = parseTLSCiphers(value)
+			case "ech":
+				profile.ECH, err = base64.StdEncoding.DecodeString(value)
+				if err != nil {
+					err = fmt.Errorf("ech: invalid base64 ECHConfigList: %w", err)
+				}
+			default:
+				err = fmt.Errorf("unknown setting %q (sni, alpn, min, max, curves, ciphers or ech)", key)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", host, err)
+			}
+		}
+		if profile.ECH != nil && profile.MaxVersion != 0 && profile.MaxVersion < tls.VersionTLS13 {
+			return nil, fmt.Errorf("%s: ech requires TLS 1.3", host)
+		}
+		if profile.MinVersion != 0 && profile.MaxVersion != 0 && profile.MinVersion > profile.MaxVersion {
+			return nil, fmt.Errorf("%s: min version is above max version", host)
+		}
+		profiles[host] = profile
+	}
+	return profiles, nil
+}
+
+func parseTLSVersion(value string) (uint16, error) {
+	if version, ok := tlsVersionNames[value]; ok {
+		return version, nil
+	}
+	return 0, fmt.Errorf("unknown TLS version %q (1.0, 1.1, 1.2 or 1.3)", value)
+}
+
+func parseTLSCurves(value string) ([]tls.CurveID, error) {
+	var curves []tls.CurveID
+	for _, name := range strings.Split(value, "|") {
+		curve, ok := tlsCurveNames[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("unknown curve %q (x25519, p256, p384 or p521)", name)
+		}
+		curves = append(curves, curve)
+	}
+	return curves, nil
+}
+
+// parseTLSCiphers 按 Go 的密码套件名称解析（如 TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256），不接受不安全的套件
+func parseTLSCiphers(value string) ([]uint16, error) {
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+	var ciphers []uint16
+	for _, name := range strings.Split(value, "|") {
+		id, ok := known[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+		ciphers = append(ciphers, id)
+	}
+	return ciphers, nil
+}
+
+// apply 把设置写入 Transport 的 TLS 配置
+func (profile TLSProfile) apply(transport *http.Transport) {
+	config := transport.TLSClientConfig.Clone()
+	if profile.ServerName != "" {
+		config.ServerName = profile.ServerName
+	}
+	if profile.ALPN != nil {
+		config.NextProtos = profile.ALPN
+		h2 := false
+		for _, proto := range profile.ALPN {
+			h2 = h2 || proto == "h2"
+		}
+		if !h2 {
+			// 否则 Transport 初始化 HTTP/2 时会把 h2 加回 ALPN
+			transport.ForceAttemptHTTP2 = false
+			transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+		}
+	}
+	if profile.MinVersion != 0 {
+		config.MinVersion = profile.MinVersion
+	}
+	if profile.MaxVersion != 0 {
+		config.MaxVersion = profile.MaxVersion
+	}
+	if profile.Curves != nil {
+		config.CurvePreferences = profile.Curves
+	}
+	if profile.Ciphers != nil {
+		config.CipherSuites = profile.Ciphers
+	}
+	if profile.ECH != nil {
+		// ECH 只能在 TLS 1.3 中使用；服务器拒绝 ECH 时握手失败，不会回退到明文 SNI
+		config.EncryptedClientHelloConfigList = profile.ECH
+		config.MinVersion = tls.VersionTLS13
+	}
+	transport.TLSClientConfig = config
+}
+
+// String 日志中显示的设置
+func (profile TLSProfile) String() string {
+	var parts []string
+	if profile.ServerName != "" {
+		parts = append(parts, "sni "+profile.ServerName)
+	}
+	if profile.ALPN != nil {
+		parts = append(parts, "alpn "+strings.Join(profile.ALPN, "|"))
+	}
+	if profile.MinVersion != 0 || profile.MaxVersion != 0 {
+		parts = append(parts, fmt.Sprintf("versions %s-%s", tlsVersionName(profile.MinVersion), tlsVersionName(profile.MaxVersion)))
+	}
+	if profile.Curves != nil {
+		parts = append(parts, fmt.Sprintf("%d curves", len(profile.Curves)))
+	}
+	if profile.Ciphers != nil {
+		parts = append(parts, fmt.Sprintf("%d cipher suites", len(profile.Ciphers)))
+	}
+	if profile.ECH != nil {
+		parts = append(parts, "ECH")
+	}
+	return strings.Join(parts, ", ")
+}
+
+func tlsVersionName(version uint16) string {
+	for name, v := range tlsVersionNames {
+		if v == version {
+			return name
+		}
+	}
+	return "default"
+}
+
+// applyTLSProfiles 为配置了 TLS 设置的上游创建单独的 Transport（沿用其连接参数覆盖），
+// 并把设置应用到其子域名的连接参数覆盖上
+func (t *upstreamTransport) applyTLSProfiles(profiles map[string]TLSProfile) {
+	for host := range profiles {
+		if _, ok := t.overrides[host]; !ok {
+			parent := t.base
+			if transport, ok := lookupHostMap(t.overrides, host); ok {
+				parent = transport
+			}
+			t.overrides[host] = parent.Clone()
+		}
+	}
+	for host, transport := range t.overrides {
+		if profile, ok := lookupHostMap(profiles, host); ok {
+			profile.apply(transport)
+		}
+	}
+	for host, profile := range profiles {
+		log.Printf("上游 %s TLS 握手设置: %s", host, profile)
+	}
+}
@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestUpstreamTLSProfiles(t *testing.T) {
+	var sni string
+	var alpn []string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	server.TLS = &tls.Config{GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		sni, alpn = hello.ServerName, hello.SupportedProtos
+		return nil, nil
+	}}
+	server.StartTLS()
+	defer server.Close()
+
+	upstream := newFakeRegistry(t)
+	p, _ := newTestProxy(t, upstream, map[string]string{
+		"UPSTREAM_TLS_PROFILES": "127.0.0.1=sni:example.com;alpn:http/1.1;min:1.3;curves:x25519|p256",
+	})
+	transport := p.transport.overrides["127.0.0.1"]
+	if transport == nil {
+		t.Fatal("no transport for the TLS profile")
+	}
+	// 信任测试服务器的自签名证书（证书包含 example.com）
+	transport.TLSClientConfig.RootCAs = server.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+
+	req, _ := http.NewRequest("GET", server.URL+"/v2/", nil)
+	resp, err := p.transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if sni != "example.com" {
+		t.Errorf("SNI = %q, want example.com", sni)
+	}
+	if len(alpn) != 1 || alpn[0] != "http/1.1" || resp.ProtoMajor != 1 {
+		t.Errorf("ALPN = %v, protocol %s; want http/1.1 only", alpn, resp.Proto)
+	}
+	if resp.TLS == nil || resp.TLS.Version != tls.VersionTLS13 {
+		t.Errorf("TLS state = %+v, want TLS 1.3", resp.TLS)
+	}
+
+	for _, entry := range []string{
+		"registry.example.com=fingerprint:chrome",
+		"registry.example.com=ech:not-base64!",
+		"registry.example.com=ech:AAAA;max:1.2",
+		"registry.example.com=ciphers:TLS_RSA_WITH_RC4_128_SHA",
+	} {
+		if _, err := parseTLSProfiles([]string{entry}); err == nil {
+			t.Errorf("%q accepted", entry)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package proxy
+
+import (
+	"encoding/csv"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/DeyiXu/go-docker-proxy/pkg/cache"
+)
+
+// =============================================================================
+// 用量报告 - 按仓库统计拉取次数、独立客户端与出口流量，/admin/report 输出排行
+// =============================================================================
+
+const (
+	usageBucketSize  = time.Hour // 统计粒度，窗口按整小时计算
+	maxBucketClients = 10000     // 单个仓库每小时记录的独立客户端上限
+)
+
+// usageBucket 单个仓库一小时内的用量
+type usageBucket struct {
+	pulls         int64
+	blobDownloads int64
+	egressBytes   int64
+	cacheHitBytes int64
+	clients       map[string]struct{}
+}
+
+// repoUsage 单个仓库的用量
+type repoUsage struct {
+	buckets map[int64]*usageBucket // 小时序号 -> 用量
+	blobs   map[string]blobSeen    // 拉取过的 blob，用于估算缓存占用
+}
+
+type blobSeen struct {
+	size     int64
+	lastSeen time.Time
+}
+
+// UsageTracker 按仓库滚动统计用量（仅保存在内存中，重启后清零）
+type UsageTracker struct {
+	retention time.Duration
+
+	mu        sync.Mutex
+	repos     map[string]*repoUsage // {路由域名}/{仓库} -> 用量
+	lastPrune int64
+}
+
+// RepoUsageReport 单个仓库在统计窗口内的用量
+type RepoUsageReport struct {
+	Repository     string  `json:"repository"`
+	Pulls          int64   `json:"pulls"`
+	BlobDownloads  int64   `json:"blobDownloads"`
+	UniqueClients  int     `json:"uniqueClients"`
+	EgressBytes    int64   `json:"egressBytes"`
+	EgressHuman    string  `json:"egressHuman"`
+	CacheHitBytes  int64   `json:"cacheHitBytes"`
+	CacheHitRatio  float64 `json:"cacheHitRatio"`
+	FootprintBytes int64   `json:"footprintBytes"`
+	FootprintHuman string  `json:"footprintHuman"`
+}
+
+// NewUsageTracker 创建用量统计，retention <= 0 时返回 nil
+func NewUsageTracker(retention time.Duration) *UsageTracker {
+	if retention <= 0 {
+		return nil
+	}
+	return &UsageTracker{
+		retention: retention,
+		repos:     make(map[string]*repoUsage),
+	}
+}
+
+// Record 记录一次成功的 manifest / blob 下载（Helm 仓库与文件镜像的文件按 blob 下载计数）
+func (t *UsageTracker) Record(repository, pathType, client, digest string, bytes int64, cacheHit bool) {
+	now := time.Now()
+	hour := now.UnixNano() / int64(usageBucketSize)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if hour != t.lastPrune {
+		t.prune(now)
+		t.lastPrune = hour
+	}
+
+	repo, ok := t.repos[repository]
+	if !ok {
+		repo = &repoUsage{buckets: make(map[int64]*usageBucket), blobs: make(map[string]blobSeen)}
+		t.repos[repository] = repo
+	}
+	bucket, ok := repo.buckets[hour]
+	if !ok {
+		bucket = &usageBucket{clients: make(map[string]struct{})}
+		repo.buckets[hour] = bucket
+	}
+
+	switch pathType {
+	case "manifest":
+		bucket.pulls++
+	case "blob", "file":
+		bucket.blobDownloads++
+		if digest != "" {
+			repo.blobs[digest] = blobSeen{size: bytes, lastSeen: now}
+		}
+	}
+	bucket.egressBytes += bytes
+	if cacheHit {
+		bucket.cacheHitBytes += bytes
+	}
+	if client != "" && len(bucket.clients) < maxBucketClients {
+		bucket.clients[client] = struct{}{}
+	}
+}
+
+// prune 删除超出保留时间的用量（调用方需持有锁）
+func (t *UsageTracker) prune(now time.Time) {
+	oldest := now.Add(-t.retention).UnixNano() / int64(usageBucketSize)
+	for name, repo := range t.repos {
+		for hour := range repo.buckets {
+			if hour < oldest {
+				delete(repo.buckets, hour)
+			}
+		}
+		for digest, seen := range repo.blobs {
+			if now.Sub(seen.lastSeen) > t.retention {
+				delete(repo.blobs, digest)
+			}
+		}
+		if len(repo.buckets) == 0 {
+			delete(t.repos, name)
+		}
+	}
+}
+
+// Report 汇总最近 window 内各仓库的用量
+func (t *UsageTracker) Report(window time.Duration) []RepoUsageReport {
+	if window <= 0 || window > t.retention {
+		window = t.retention
+	}
+	now := time.Now()
+	since := now.Add(-window).UnixNano() / int64(usageBucketSize)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	result := make([]RepoUsageReport, 0, len(t.repos))
+	for name, repo := range t.repos {
+		report := RepoUsageReport{Repository: name}
+		clients := make(map[string]struct{})
+		for hour, bucket := range repo.buckets {
+			if hour <= since {
+				continue
+			}
+			report.Pulls += bucket.pulls
+			report.BlobDownloads += bucket.blobDownloads
+			report.EgressBytes += bucket.egressBytes
+			report.CacheHitBytes += bucket.cacheHitBytes
+			for client := range bucket.clients {
+				clients[client] = struct{}{}
+			}
+		}
+		if report.Pulls == 0 && report.BlobDownloads == 0 {
+			continue
+		}
+		for _, seen := range repo.blobs {
+			if now.Sub(seen.lastSeen) <= window {
+				report.FootprintBytes += seen.size
+			}
+		}
+
+		report.UniqueClients = len(clients)
+		report.EgressHuman = cache.FormatBytes(report.EgressBytes)
+		report.FootprintHuman = cache.FormatBytes(report.FootprintBytes)
+		if report.EgressBytes > 0 {
+			report.CacheHitRatio = float64(report.CacheHitBytes) / float64(report.EgressBytes) * 100
+		}
+		result = append(result, report)
+	}
+	return result
+}
+
+// sortUsageReport 按指定字段降序排序
+func sortUsageReport(reports []RepoUsageReport, by string) {
+	key := func(r RepoUsageReport) int64 {
+		switch by {
+		case "pulls":
+			return r.Pulls
+		case "clients":
+			return int64(r.UniqueClients)
+		case "footprint":
+			return r.FootprintBytes
+		}
+		return r.EgressBytes
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		if ki, kj := key(reports[i]), key(reports[j]); ki != kj {
+			return ki > kj
+		}
+		return reports[i].Repository < reports[j].Repository
+	})
+}
+
+// usageMiddleware 在 /v2 请求完成后记录用量
+func (p *ProxyServer) usageMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		if r.Method != "GET" || (ww.Status() != http.StatusOK && ww.Status() != http.StatusPartialContent) {
+			return
+		}
+		pathType, repo, reference := p.accountedPath(r)
+		if pathType != "manifest" && pathType != "blob" && pathType != "file" {
+			return
+		}
+
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		repository := host + "/" + repo
+		if repo == "" {
+			// 文件路由按路由域名汇总
+			repository = host
+		}
+		client := clientIdentityOf(r).String()
+		// Range 响应不是完整大小，不计入缓存占用
+		digest := ""
+		if pathType == "blob" && ww.Status() == http.StatusOK {
+			digest = reference
+		}
+		p.usage.Record(repository, pathType, client, digest, int64(ww.BytesWritten()), ww.Header().Get("X-Cache") == "HIT")
+	})
+}
+
+// registerUsageAdminRoutes 注册用量报告接口
+//
+//	GET /admin/report?window=24h&sort=egress&limit=50&format=csv
+func (p *ProxyServer) registerUsageAdminRoutes(r chi.Router) {
+	r.Get("/report", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		window := parseDuration(query.Get("window"), 24*time.Hour)
+		sortBy := query.Get("sort")
+		if sortBy == "" {
+			sortBy = "egress"
+		}
+		limit := parseInt(query.Get("limit"), 50)
+
+		reports := p.usage.Report(window)
+		sortUsageReport(reports, sortBy)
+		if limit > 0 && len(reports) > limit {
+			reports = reports[:limit]
+		}
+
+		if query.Get("format") == "csv" || strings.Contains(r.Header.Get("Accept"), "text/csv") {
+			writeUsageCSV(w, reports)
+			return
+		}
+		p.writeJSON(w, http.StatusOK, map[string]interface{}{
+			"generatedAt":  time.Now().UTC().Format(time.RFC3339),
+			"window":       window.String(),
+			"sort":         sortBy,
+			"repositories": reports,
+		})
+	})
+}
+
+func writeUsageCSV(w http.ResponseWriter, reports []RepoUsageReport) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="usage-report.csv"`)
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"repository", "pulls", "blob_downloads", "unique_clients", "egress_bytes", "cache_hit_bytes", "footprint_bytes"})
+	for _, r := range reports {
+		cw.Write([]string{
+			r.Repository,
+			strconv.FormatInt(r.Pulls, 10),
+			strconv.FormatInt(r.BlobDownloads, 10),
+			strconv.Itoa(r.UniqueClients),
+			strconv.FormatInt(r.EgressBytes, 10),
+			strconv.FormatInt(r.CacheHitBytes, 10),
+			strconv.FormatInt(r.FootprintBytes, 10),
+		})
+	}
+	cw.Flush()
+}
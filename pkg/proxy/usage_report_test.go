@@ -0,0 +1,64 @@
+package proxy
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestUsageReport(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	_, appLayers := upstream.addImage("team/app", "v1", []byte(strings.Repeat("app layer ", 100)))
+	upstream.addImage("team/tool", "v1", []byte("tool layer"))
+	p, client := newTestProxy(t, upstream, map[string]string{"ADMIN_TOKEN": testAdminToken})
+
+	client.login("team/app")
+	client.pull("team/app", "v1")
+	waitCached(t, p, "team/app", "v1", appLayers)
+	client.pull("team/app", "v1")
+	client.login("team/tool")
+	client.pull("team/tool", "v1")
+
+	resp, body := client.admin("GET", "/admin/report?sort=pulls", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /admin/report: status %d: %s", resp.StatusCode, body)
+	}
+	var report struct {
+		Repositories []RepoUsageReport `json:"repositories"`
+	}
+	if err := json.Unmarshal(body, &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Repositories) != 2 {
+		t.Fatalf("report = %s", body)
+	}
+	app := report.Repositories[0]
+	if app.Repository != testRegistryHost+"/team/app" || app.Pulls != 2 || app.BlobDownloads != 4 || app.UniqueClients != 1 {
+		t.Errorf("team/app usage = %+v", app)
+	}
+	// 第二次拉取全部命中缓存，blob 只计一次占用
+	if app.CacheHitBytes == 0 || app.CacheHitBytes >= app.EgressBytes || app.FootprintBytes == 0 || app.FootprintBytes >= app.EgressBytes {
+		t.Errorf("team/app bytes = %+v", app)
+	}
+
+	resp, body = client.admin("GET", "/admin/report?format=csv&limit=1&sort=egress", "")
+	if resp.Header.Get("Content-Type") != "text/csv; charset=utf-8" {
+		t.Errorf("csv Content-Type = %q", resp.Header.Get("Content-Type"))
+	}
+	rows, err := csv.NewReader(strings.NewReader(string(body))).ReadAll()
+	if err != nil || len(rows) != 2 || rows[0][0] != "repository" || rows[1][0] != testRegistryHost+"/team/app" {
+		t.Errorf("csv report = %q", body)
+	}
+}
+
+func TestUsageReportDisabledWithoutAdminToken(t *testing.T) {
+	p, _ := newTestProxy(t, newFakeRegistry(t), nil)
+	if p.usage != nil {
+		t.Error("usage tracking enabled without ADMIN_TOKEN")
+	}
+	if NewUsageTracker(0) != nil {
+		t.Error("NewUsageTracker(0) != nil")
+	}
+}
@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// =============================================================================
+// 构建信息 - 版本号、git commit 与构建时间在构建时通过 ldflags 注入：
+//
+//	go build -ldflags "-X github.com/DeyiXu/go-docker-proxy/pkg/proxy.Version=v1.2.0 \
+//	  -X github.com/DeyiXu/go-docker-proxy/pkg/proxy.GitCommit=$(git rev-parse HEAD) \
+//	  -X github.com/DeyiXu/go-docker-proxy/pkg/proxy.BuildDate=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// 未注入时使用 go build 记录的 VCS 信息
+// =============================================================================
+
+var (
+	Version   = "dev"
+	GitCommit = ""
+	BuildDate = ""
+)
+
+// BuildInfo 当前二进制的构建信息
+type BuildInfo struct {
+	Version   string `json:"version"`
+	GitCommit string `json:"gitCommit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+	Platform  string `json:"platform"`
+}
+
+// GetBuildInfo 返回构建信息，ldflags 未注入的字段取自二进制内嵌的 VCS 信息
+func GetBuildInfo() BuildInfo {
+	info := BuildInfo{
+		Version:   Version,
+		GitCommit: GitCommit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range bi.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.GitCommit == "":
+				info.GitCommit = setting.Value
+			case setting.Key == "vcs.time" && info.BuildDate == "":
+				info.BuildDate = setting.Value
+			}
+		}
+	}
+	if info.GitCommit == "" {
+		info.GitCommit = "unknown"
+	}
+	if info.BuildDate == "" {
+		info.BuildDate = "unknown"
+	}
+	return info
+}
+
+// String 用于 -version 与启动日志
+func (b BuildInfo) String() string {
+	commit := b.GitCommit
+	if len(commit) > 12 {
+		commit = commit[:12]
+	}
+	return fmt.Sprintf("go-docker-proxy %s (commit %s, built %s, %s %s)", b.Version, commit, b.BuildDate, b.GoVersion, b.Platform)
+}
+
+// handleVersion GET /version
+func (p *ProxyServer) handleVersion(w http.ResponseWriter, r *http.Request) {
+	p.writeJSON(w, http.StatusOK, GetBuildInfo())
+}
@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// TestVersion 覆盖 /version、健康检查中的版本号与 build_info 指标
+func TestVersion(t *testing.T) {
+	upstream := newFakeRegistry(t)
+	previous := Version
+	Version = "v9.9.9-test"
+	t.Cleanup(func() { Version = previous })
+	_, client := newTestProxy(t, upstream, nil)
+
+	resp, body := client.do(http.MethodGet, "/version", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("/version: status %d", resp.StatusCode)
+	}
+	var info BuildInfo
+	if err := json.Unmarshal(body, &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Version != "v9.9.9-test" || info.GoVersion == "" || info.GitCommit == "" {
+		t.Errorf("/version = %+v", info)
+	}
+
+	_, body = client.do(http.MethodGet, "/health", nil)
+	var health map[string]interface{}
+	if err := json.Unmarshal(body, &health); err != nil {
+		t.Fatal(err)
+	}
+	if health["version"] != "v9.9.9-test" {
+		t.Errorf("/health version = %v", health["version"])
+	}
+
+	_, body = client.do(http.MethodGet, "/metrics", nil)
+	if !strings.Contains(string(body), `docker_proxy_build_info{version="v9.9.9-test"`) {
+		t.Error("/metrics is missing docker_proxy_build_info")
+	}
+}